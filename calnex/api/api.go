@@ -18,6 +18,8 @@ package api
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"crypto/tls"
 	"encoding/csv"
 	"encoding/json"
@@ -27,6 +29,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -79,6 +82,17 @@ type Version struct {
 	Firmware string
 }
 
+// InstrumentInfo is a struct representing Calnex instrument info JSON response
+type InstrumentInfo struct {
+	Model        string
+	SerialNumber string
+}
+
+// Options is a struct representing Calnex licensed options JSON response
+type Options struct {
+	Options []string
+}
+
 // GNSS is a struct representing Calnex GNSS JSON response
 type GNSS struct {
 	AntennaStatus         string
@@ -151,152 +165,68 @@ const (
 	ChannelVP32
 )
 
-// MeasureChannelDatatypeMap is a Map of the measurement channels to the data type.
-// Only channels used for measurements defined here
-var MeasureChannelDatatypeMap = map[Channel]string{
-	ChannelA:    TE,
-	ChannelB:    TE,
-	ChannelC:    TE,
-	ChannelD:    TE,
-	ChannelE:    TE,
-	ChannelF:    TE,
-	ChannelVP1:  TWOWAYTE,
-	ChannelVP2:  TWOWAYTE,
-	ChannelVP3:  TWOWAYTE,
-	ChannelVP4:  TWOWAYTE,
-	ChannelVP5:  TWOWAYTE,
-	ChannelVP6:  TWOWAYTE,
-	ChannelVP7:  TWOWAYTE,
-	ChannelVP8:  TWOWAYTE,
-	ChannelVP9:  TWOWAYTE,
-	ChannelVP10: TWOWAYTE,
-	ChannelVP11: TWOWAYTE,
-	ChannelVP12: TWOWAYTE,
-	ChannelVP13: TWOWAYTE,
-	ChannelVP14: TWOWAYTE,
-	ChannelVP15: TWOWAYTE,
-	ChannelVP16: TWOWAYTE,
-	ChannelVP17: TWOWAYTE,
-	ChannelVP18: TWOWAYTE,
-	ChannelVP19: TWOWAYTE,
-	ChannelVP20: TWOWAYTE,
-	ChannelVP21: TWOWAYTE,
-	ChannelVP22: TWOWAYTE,
-	ChannelVP23: TWOWAYTE,
-	ChannelVP24: TWOWAYTE,
-	ChannelVP25: TWOWAYTE,
-	ChannelVP26: TWOWAYTE,
-	ChannelVP27: TWOWAYTE,
-	ChannelVP28: TWOWAYTE,
-	ChannelVP29: TWOWAYTE,
-	ChannelVP30: TWOWAYTE,
-	ChannelVP31: TWOWAYTE,
-	ChannelVP32: TWOWAYTE,
-}
-
-// channelStringToCalnex is a map of String channels to a Calnex variant
+// channelStringToCalnex is a map of String physical channels to a Calnex variant.
+// Virtual ports are named VP1, VP2 and so on
 var channelStringToCalnex = map[string]Channel{
-	"A":    ChannelA,
-	"B":    ChannelB,
-	"C":    ChannelC,
-	"D":    ChannelD,
-	"E":    ChannelE,
-	"F":    ChannelF,
-	"1":    ChannelONE,
-	"2":    ChannelTWO,
-	"VP1":  ChannelVP1,
-	"VP2":  ChannelVP2,
-	"VP3":  ChannelVP3,
-	"VP4":  ChannelVP4,
-	"VP5":  ChannelVP5,
-	"VP6":  ChannelVP6,
-	"VP7":  ChannelVP7,
-	"VP8":  ChannelVP8,
-	"VP9":  ChannelVP9,
-	"VP10": ChannelVP10,
-	"VP11": ChannelVP11,
-	"VP12": ChannelVP12,
-	"VP13": ChannelVP13,
-	"VP14": ChannelVP14,
-	"VP15": ChannelVP15,
-	"VP16": ChannelVP16,
-	"VP17": ChannelVP17,
-	"VP18": ChannelVP18,
-	"VP19": ChannelVP19,
-	"VP20": ChannelVP20,
-	"VP21": ChannelVP21,
-	"VP22": ChannelVP22,
-	"VP23": ChannelVP23,
-	"VP24": ChannelVP24,
-	"VP25": ChannelVP25,
-	"VP26": ChannelVP26,
-	"VP27": ChannelVP27,
-	"VP28": ChannelVP28,
-	"VP29": ChannelVP29,
-	"VP30": ChannelVP30,
-	"VP31": ChannelVP31,
-	"VP32": ChannelVP32,
-}
-
-// channelCalnexToString is a map of Calnex channels to a String variant
+	"A": ChannelA,
+	"B": ChannelB,
+	"C": ChannelC,
+	"D": ChannelD,
+	"E": ChannelE,
+	"F": ChannelF,
+	"1": ChannelONE,
+	"2": ChannelTWO,
+}
+
+// channelCalnexToString is a map of Calnex physical channels to a String variant
 var channelCalnexToString = map[Channel]string{
-	ChannelA:    "A",
-	ChannelB:    "B",
-	ChannelC:    "C",
-	ChannelD:    "D",
-	ChannelE:    "E",
-	ChannelF:    "F",
-	ChannelONE:  "1",
-	ChannelTWO:  "2",
-	ChannelVP1:  "VP1",
-	ChannelVP2:  "VP2",
-	ChannelVP3:  "VP3",
-	ChannelVP4:  "VP4",
-	ChannelVP5:  "VP5",
-	ChannelVP6:  "VP6",
-	ChannelVP7:  "VP7",
-	ChannelVP8:  "VP8",
-	ChannelVP9:  "VP9",
-	ChannelVP10: "VP10",
-	ChannelVP11: "VP11",
-	ChannelVP12: "VP12",
-	ChannelVP13: "VP13",
-	ChannelVP14: "VP14",
-	ChannelVP15: "VP15",
-	ChannelVP16: "VP16",
-	ChannelVP17: "VP17",
-	ChannelVP18: "VP18",
-	ChannelVP19: "VP19",
-	ChannelVP20: "VP20",
-	ChannelVP21: "VP21",
-	ChannelVP22: "VP22",
-	ChannelVP23: "VP23",
-	ChannelVP24: "VP24",
-	ChannelVP25: "VP25",
-	ChannelVP26: "VP26",
-	ChannelVP27: "VP27",
-	ChannelVP28: "VP28",
-	ChannelVP29: "VP29",
-	ChannelVP30: "VP30",
-	ChannelVP31: "VP31",
-	ChannelVP32: "VP32",
+	ChannelA:   "A",
+	ChannelB:   "B",
+	ChannelC:   "C",
+	ChannelD:   "D",
+	ChannelE:   "E",
+	ChannelF:   "F",
+	ChannelONE: "1",
+	ChannelTWO: "2",
 }
 
 // ChannelFromString returns Channel object from String version
 func ChannelFromString(value string) (*Channel, error) {
-	c, ok := channelStringToCalnex[value]
-	if !ok {
+	if c, ok := channelStringToCalnex[value]; ok {
+		return &c, nil
+	}
+	if !strings.HasPrefix(value, "VP") {
 		return nil, errBadChannel
 	}
-
+	vp, err := strconv.Atoi(strings.TrimPrefix(value, "VP"))
+	if err != nil || vp < 1 {
+		return nil, errBadChannel
+	}
+	c := ChannelVP1 + Channel(vp-1)
 	return &c, nil
 }
 
 // String returns String friendly channel name like "a" or "2"
 func (c Channel) String() string {
+	if c >= ChannelVP1 {
+		return fmt.Sprintf("VP%d", c-ChannelVP1+1)
+	}
 	return channelCalnexToString[c]
 }
 
+// Datatype returns type of data measured on the channel: TE for physical channels, TWOWAYTE for virtual ports.
+// Empty for channels which don't produce measurements
+func (c Channel) Datatype() string {
+	switch {
+	case c >= ChannelA && c <= ChannelF:
+		return TE
+	case c >= ChannelVP1:
+		return TWOWAYTE
+	default:
+		return ""
+	}
+}
+
 // UnmarshalText channel from string version
 func (c *Channel) UnmarshalText(value []byte) error {
 	channel := strings.ToUpper(string(value))
@@ -429,6 +359,8 @@ const (
 
 	gnssURL             = "https://%s/api/gnss/status"
 	instrumentStatusURL = "https://%s/api/instrument/status"
+	instrumentInfoURL   = "https://%s/api/instrument/info"
+	optionsURL          = "https://%s/api/option/list"
 )
 
 var (
@@ -437,6 +369,9 @@ var (
 	errAPI        = errors.New("invalid response from API")
 )
 
+// maxDownloadAttempts is how many times we try to resume interrupted download of measurement data
+const maxDownloadAttempts = 5
+
 func parseResponse(response string) (string, error) {
 	s := strings.Split(strings.TrimSuffix(response, "\n"), "=")
 	if len(s) != 2 {
@@ -462,18 +397,8 @@ func NewAPI(source string, insecureTLS bool) *API {
 // FetchCsv takes channel name (like 1, 2, c, d)
 // it returns list of CSV lines which is []string
 func (a *API) FetchCsv(channel Channel, allData bool) ([][]string, error) {
-	url := fmt.Sprintf(dataURL, a.source, channel, MeasureChannelDatatypeMap[channel], allData)
-	resp, err := a.Client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New(http.StatusText(resp.StatusCode))
-	}
-
-	b, err := io.ReadAll(resp.Body)
+	url := fmt.Sprintf(dataURL, a.source, channel, channel.Datatype(), allData)
+	b, err := a.download(url)
 	if err != nil {
 		return nil, err
 	}
@@ -500,10 +425,97 @@ func (a *API) FetchCsv(channel Channel, allData bool) ([][]string, error) {
 	return res, nil
 }
 
+// download fetches large response, asking for compressed transfer.
+// If transfer is interrupted, it is resumed with range request from where it stopped.
+// Returns decompressed response body
+func (a *API) download(url string) ([]byte, error) {
+	var body bytes.Buffer
+	var encoding, etag string
+	var err error
+	for attempt := 0; attempt < maxDownloadAttempts; attempt++ {
+		var done bool
+		done, err = a.downloadPart(url, &body, &encoding, &etag)
+		if done {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeBody(encoding, body.Bytes())
+}
+
+// downloadPart appends next part of the response to body.
+// It reports if download is finished, either successfully or with unrecoverable error
+func (a *API) downloadPart(url string, body *bytes.Buffer, encoding, etag *string) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return true, err
+	}
+	// setting it explicitly disables transparent gzip decoding by transport, we decode ourselves
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	if body.Len() > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", body.Len()))
+		if *etag != "" {
+			req.Header.Set("If-Range", *etag)
+		}
+	}
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		// nothing to resume, don't retry
+		return body.Len() == 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// full response, either first request or server doesn't support ranges
+		body.Reset()
+		*encoding = resp.Header.Get("Content-Encoding")
+		*etag = resp.Header.Get("ETag")
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", body.Len())) {
+			return true, fmt.Errorf("unexpected content range %q", resp.Header.Get("Content-Range"))
+		}
+	default:
+		return true, errors.New(http.StatusText(resp.StatusCode))
+	}
+
+	if _, err := io.Copy(body, resp.Body); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// decodeBody decompresses response body according to Content-Encoding
+func decodeBody(encoding string, b []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch encoding {
+	case "", "identity":
+		return b, nil
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(b))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(b))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s response: %w", encoding, err)
+	}
+	defer r.Close()
+	res, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s response: %w", encoding, err)
+	}
+	return res, nil
+}
+
 // FetchChannelProbe returns monitored protocol of the channel
 func (a *API) FetchChannelProbe(channel Channel) (*Probe, error) {
 	pth := path.Join(channel.CalnexAPI(), "ptp_synce", "mode", "probe_type")
-	if MeasureChannelDatatypeMap[channel] == TE {
+	if channel.Datatype() == TE {
 		pth = path.Join(channel.CalnexAPI(), "signal_type")
 	}
 	url := fmt.Sprintf(measureURL, a.source, pth)
@@ -534,7 +546,7 @@ func (a *API) FetchChannelProbe(channel Channel) (*Probe, error) {
 // FetchChannelTarget returns the measure target of the server monitored on the channel
 func (a *API) FetchChannelTarget(channel Channel, probe Probe) (string, error) {
 	pth := path.Join(channel.CalnexAPI(), "ptp_synce", probe.String(), probe.ServerType())
-	if MeasureChannelDatatypeMap[channel] == TE {
+	if channel.Datatype() == TE {
 		pth = path.Join(channel.CalnexAPI(), probe.ServerType())
 	}
 	url := fmt.Sprintf(measureURL, a.source, pth)
@@ -563,15 +575,10 @@ func (a *API) FetchUsedChannels() ([]Channel, error) {
 	if err != nil {
 		return channels, err
 	}
-	for ch := range MeasureChannelDatatypeMap {
-		chInstalled := f.Section("measure").Key(fmt.Sprintf("%s\\installed", ch.CalnexAPI())).String()
-		if chInstalled != "1" {
-			continue
-		}
-
-		chStatus := f.Section("measure").Key(fmt.Sprintf("%s\\used", ch.CalnexAPI())).String()
+	for _, ch := range ChannelsFromSettings(f.Section("measure")) {
+		chStatus := f.Section("measure").Key(fmt.Sprintf("%s\\used", ch.Channel.CalnexAPI())).String()
 		if chStatus == "Yes" {
-			channels = append(channels, ch)
+			channels = append(channels, ch.Channel)
 		}
 	}
 	return channels, err
@@ -857,3 +864,45 @@ func (a *API) GnssStatus() (*GNSS, error) {
 
 	return g, nil
 }
+
+// FetchInstrumentInfo returns model and serial number of the device
+func (a *API) FetchInstrumentInfo() (*InstrumentInfo, error) {
+	url := fmt.Sprintf(instrumentInfoURL, a.source)
+	resp, err := a.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(http.StatusText(resp.StatusCode))
+	}
+
+	i := &InstrumentInfo{}
+	if err = json.NewDecoder(resp.Body).Decode(i); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// FetchOptions returns options licensed on the device
+func (a *API) FetchOptions() (*Options, error) {
+	url := fmt.Sprintf(optionsURL, a.source)
+	resp, err := a.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(http.StatusText(resp.StatusCode))
+	}
+
+	o := &Options{}
+	if err = json.NewDecoder(resp.Body).Decode(o); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
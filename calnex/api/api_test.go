@@ -18,6 +18,8 @@ package api
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -34,24 +36,28 @@ import (
 
 func TestChannel(t *testing.T) {
 	legitChannelNamesToChannel := map[string]Channel{
-		"1":   ChannelONE,
-		"2":   ChannelTWO,
-		"C":   ChannelC,
-		"D":   ChannelD,
-		"VP1": ChannelVP1,
+		"1":    ChannelONE,
+		"2":    ChannelTWO,
+		"C":    ChannelC,
+		"D":    ChannelD,
+		"VP1":  ChannelVP1,
+		"VP32": ChannelVP32,
+		"VP64": Channel(72),
 	}
 	for channelS, channel := range legitChannelNamesToChannel {
 		c, err := ChannelFromString(channelS)
 		require.NoError(t, err)
 		require.Equal(t, channel, *c)
 
+		require.Equal(t, channelS, c.String())
+
 		c = new(Channel)
 		err = c.UnmarshalText([]byte(channelS))
 		require.NoError(t, err)
 		require.Equal(t, channel, *c)
 	}
 
-	wrongChannelNames := []string{"", "?", "z", "foo"}
+	wrongChannelNames := []string{"", "?", "z", "foo", "VP", "VP0", "VPfoo"}
 	for _, channelS := range wrongChannelNames {
 		c, err := ChannelFromString(channelS)
 		require.Nil(t, c)
@@ -152,6 +158,93 @@ func TestFetchCsv(t *testing.T) {
 	}
 }
 
+func gzipped(t *testing.T, data string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func TestFetchCsvGzip(t *testing.T) {
+	sampleResp := "1607961193.773740,-000.000000250501\n1607961194.773740,-000.000000250502\n"
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		require.Contains(t, r.Header.Get("Accept-Encoding"), "gzip")
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(gzipped(t, sampleResp))
+	}))
+	defer ts.Close()
+
+	parsed, _ := url.Parse(ts.URL)
+	calnexAPI := NewAPI(parsed.Host, true)
+	calnexAPI.Client = ts.Client()
+	lines, err := calnexAPI.FetchCsv(ChannelONE, true)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(lines))
+	require.Equal(t, "1607961194.773740,-000.000000250502", strings.Join(lines[1], ","))
+}
+
+func TestFetchCsvResume(t *testing.T) {
+	sampleResp := strings.Repeat("1607961193.773740,-000.000000250501\n", 1000)
+	data := gzipped(t, sampleResp)
+	requests := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		requests++
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("ETag", `"v1"`)
+		var start int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err == nil {
+			require.Equal(t, `"v1"`, r.Header.Get("If-Range"))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(data)-1, len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(data[start:])
+			return
+		}
+		// send half of the data and drop the connection
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		_, _ = w.Write(data[:len(data)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer ts.Close()
+
+	parsed, _ := url.Parse(ts.URL)
+	calnexAPI := NewAPI(parsed.Host, true)
+	calnexAPI.Client = ts.Client()
+	lines, err := calnexAPI.FetchCsv(ChannelONE, true)
+	require.NoError(t, err)
+	require.Equal(t, 2, requests)
+	require.Equal(t, 1000, len(lines))
+}
+
+func TestDecodeBody(t *testing.T) {
+	sampleResp := "1607961193.773740,-000.000000250501"
+	b, err := decodeBody("", []byte(sampleResp))
+	require.NoError(t, err)
+	require.Equal(t, sampleResp, string(b))
+
+	b, err = decodeBody("gzip", gzipped(t, sampleResp))
+	require.NoError(t, err)
+	require.Equal(t, sampleResp, string(b))
+
+	var z bytes.Buffer
+	w := zlib.NewWriter(&z)
+	_, err = w.Write([]byte(sampleResp))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	b, err = decodeBody("deflate", z.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, sampleResp, string(b))
+
+	_, err = decodeBody("gzip", []byte(sampleResp))
+	require.Error(t, err)
+	_, err = decodeBody("br", []byte(sampleResp))
+	require.Error(t, err)
+}
+
 func TestFetchCsvNoData(t *testing.T) {
 	sampleResp := "{\"message\": \"No data available\", \"result\": true}"
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter,
@@ -629,18 +722,18 @@ func TestParseResponse(t *testing.T) {
 	require.ErrorIs(t, errAPI, err)
 }
 
-func TestMeasureChannelDatatypeMap(t *testing.T) {
+func TestChannelDatatype(t *testing.T) {
 	for i := 0; i <= 5; i++ {
-		require.Equal(t, TE, MeasureChannelDatatypeMap[Channel(i)])
+		require.Equal(t, TE, Channel(i).Datatype())
 	}
 
 	for i := 6; i <= 8; i++ {
-		_, ok := MeasureChannelDatatypeMap[Channel(i)]
-		require.False(t, ok)
+		require.Equal(t, "", Channel(i).Datatype())
 	}
 
-	for i := 9; i <= 40; i++ {
-		require.Equal(t, TWOWAYTE, MeasureChannelDatatypeMap[Channel(i)])
+	// newer devices have more virtual ports
+	for i := 9; i <= 72; i++ {
+		require.Equal(t, TWOWAYTE, Channel(i).Datatype())
 	}
 }
 
@@ -760,3 +853,48 @@ func TestPushLicenseError(t *testing.T) {
 
 	require.Equal(t, originalLicense, uploadedLicense)
 }
+
+func TestFetchInstrumentInfo(t *testing.T) {
+	sampleResp := "{\"model\":\"Sentinel\",\"serialNumber\":\"CN123456\"}"
+	expected := &InstrumentInfo{
+		Model:        "Sentinel",
+		SerialNumber: "CN123456",
+	}
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		require.Equal(t, "/api/instrument/info", r.URL.Path)
+		fmt.Fprintln(w, sampleResp)
+	}))
+	defer ts.Close()
+
+	parsed, _ := url.Parse(ts.URL)
+	calnexAPI := NewAPI(parsed.Host, true)
+	calnexAPI.Client = ts.Client()
+
+	i, err := calnexAPI.FetchInstrumentInfo()
+	require.NoError(t, err)
+	require.Equal(t, expected, i)
+}
+
+func TestFetchOptions(t *testing.T) {
+	sampleResp := "{\"options\":[\"PTP\",\"NTP\"]}"
+	expected := &Options{
+		Options: []string{"PTP", "NTP"},
+	}
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		require.Equal(t, "/api/option/list", r.URL.Path)
+		fmt.Fprintln(w, sampleResp)
+	}))
+	defer ts.Close()
+
+	parsed, _ := url.Parse(ts.URL)
+	calnexAPI := NewAPI(parsed.Host, true)
+	calnexAPI.Client = ts.Client()
+
+	o, err := calnexAPI.FetchOptions()
+	require.NoError(t, err)
+	require.Equal(t, expected, o)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/go-ini/ini"
+)
+
+// ChannelCapabilities describes a measurement channel discovered on the device
+type ChannelCapabilities struct {
+	Channel  Channel
+	Datatype string
+	Probes   []Probe
+}
+
+// Supports checks if channel can measure with the probe
+func (c ChannelCapabilities) Supports(p Probe) bool {
+	for _, probe := range c.Probes {
+		if probe == p {
+			return true
+		}
+	}
+	return false
+}
+
+// channelKey matches settings keys of a channel like ch9\used
+var channelKey = regexp.MustCompile(`^ch(\d+)\\`)
+
+// probes returns probe types a channel supports judging by the settings it exposes
+func probes(s *ini.Section, ch Channel) []Probe {
+	if s.HasKey(fmt.Sprintf("%s\\signal_type", ch.CalnexAPI())) {
+		return []Probe{ProbePPS}
+	}
+	if s.HasKey(fmt.Sprintf("%s\\ptp_synce\\mode\\probe_type", ch.CalnexAPI())) {
+		return []Probe{ProbePTP, ProbeNTP}
+	}
+	if ch.Datatype() == TE {
+		return []Probe{ProbePPS}
+	}
+	return []Probe{ProbePTP, ProbeNTP}
+}
+
+// ChannelsFromSettings discovers measurement channels installed on the device, sorted by channel number.
+// Devices which don't report installed channels are assumed to have every channel they have settings for
+func ChannelsFromSettings(s *ini.Section) []ChannelCapabilities {
+	seen := map[Channel]bool{}
+	reportsInstalled := false
+	for _, k := range s.Keys() {
+		m := channelKey.FindStringSubmatch(k.Name())
+		if m == nil {
+			continue
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		ch := Channel(n)
+		if k.Name() == fmt.Sprintf("%s\\installed", ch.CalnexAPI()) {
+			reportsInstalled = true
+		}
+		if ch.Datatype() != "" {
+			seen[ch] = true
+		}
+	}
+
+	channels := []ChannelCapabilities{}
+	for ch := range seen {
+		if reportsInstalled && s.Key(fmt.Sprintf("%s\\installed", ch.CalnexAPI())).String() != "1" {
+			continue
+		}
+		channels = append(channels, ChannelCapabilities{
+			Channel:  ch,
+			Datatype: ch.Datatype(),
+			Probes:   probes(s, ch),
+		})
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Channel < channels[j].Channel })
+	return channels
+}
+
+// FetchChannels returns measurement channels installed on the device and probes they support
+func (a *API) FetchChannels() ([]ChannelCapabilities, error) {
+	f, err := a.FetchSettings()
+	if err != nil {
+		return nil, err
+	}
+	return ChannelsFromSettings(f.Section("measure")), nil
+}
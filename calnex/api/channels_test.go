@@ -0,0 +1,80 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelsFromSettings(t *testing.T) {
+	f, err := ini.Load([]byte("[measure]\nch0\\installed=1\nch0\\signal_type=1 PPS\nch6\\installed=1\nch8\\used=Yes\nch9\\installed=0\nch50\\installed=1\nch50\\ptp_synce\\mode\\probe_type=PTP\n"))
+	require.NoError(t, err)
+
+	expected := []ChannelCapabilities{
+		{Channel: ChannelA, Datatype: TE, Probes: []Probe{ProbePPS}},
+		{Channel: Channel(50), Datatype: TWOWAYTE, Probes: []Probe{ProbePTP, ProbeNTP}},
+	}
+	require.Equal(t, expected, ChannelsFromSettings(f.Section("measure")))
+}
+
+func TestChannelsFromSettingsNoInstalled(t *testing.T) {
+	f, err := ini.Load([]byte("[measure]\nch1\\used=No\nch7\\used=Yes\nch10\\used=No\n"))
+	require.NoError(t, err)
+
+	expected := []ChannelCapabilities{
+		{Channel: ChannelB, Datatype: TE, Probes: []Probe{ProbePPS}},
+		{Channel: ChannelVP2, Datatype: TWOWAYTE, Probes: []Probe{ProbePTP, ProbeNTP}},
+	}
+	require.Equal(t, expected, ChannelsFromSettings(f.Section("measure")))
+}
+
+func TestChannelCapabilitiesSupports(t *testing.T) {
+	c := ChannelCapabilities{Channel: ChannelVP1, Datatype: TWOWAYTE, Probes: []Probe{ProbePTP, ProbeNTP}}
+	require.True(t, c.Supports(ProbePTP))
+	require.True(t, c.Supports(ProbeNTP))
+	require.False(t, c.Supports(ProbePPS))
+}
+
+func TestFetchChannels(t *testing.T) {
+	sampleResp := "[measure]\nch0\\installed=1\nch7\\installed=1\nch41\\installed=1\nch41\\used=Yes\n"
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		fmt.Fprintln(w, sampleResp)
+	}))
+	defer ts.Close()
+
+	parsed, _ := url.Parse(ts.URL)
+	calnexAPI := NewAPI(parsed.Host, true)
+	calnexAPI.Client = ts.Client()
+
+	channels, err := calnexAPI.FetchChannels()
+	require.NoError(t, err)
+	require.Len(t, channels, 2)
+	require.Equal(t, ChannelA, channels[0].Channel)
+	require.Equal(t, "VP33", channels[1].Channel.String())
+
+	used, err := calnexAPI.FetchUsedChannels()
+	require.NoError(t, err)
+	require.Equal(t, []Channel{Channel(41)}, used)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/facebook/time/calnex/api"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(channelsCmd)
+	channelsCmd.Flags().BoolVar(&insecureTLS, "insecureTLS", false, "Ignore TLS certificate errors")
+	channelsCmd.Flags().StringVar(&source, "source", "", "device to list channels of")
+	if err := channelsCmd.MarkFlagRequired("source"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func listChannels() error {
+	api := api.NewAPI(source, insecureTLS)
+
+	channels, err := api.FetchChannels()
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range channels {
+		probes := make([]string, 0, len(ch.Probes))
+		for _, p := range ch.Probes {
+			probes = append(probes, p.String())
+		}
+		fmt.Printf("%s\t%s\t%s\n", ch.Channel, ch.Datatype, strings.Join(probes, ","))
+	}
+
+	return nil
+}
+
+var channelsCmd = &cobra.Command{
+	Use:   "channels",
+	Short: "list measurement channels installed on the device and probes they support",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listChannels(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -31,9 +31,14 @@ var (
 	allData     bool
 	apply       bool
 	channels    []string
+	dest        string
 	dir         string
+	endpoint    string
 	insecureTLS bool
+	parallel    int
+	region      string
 	source      string
+	spool       string
 	target      string
 )
 
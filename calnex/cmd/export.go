@@ -30,7 +30,10 @@ func init() {
 	exportCmd.Flags().BoolVar(&allData, "allData", true, "Export entire data from device every run. Set false for unread only")
 	exportCmd.Flags().BoolVar(&insecureTLS, "insecureTLS", false, "Ignore TLS certificate errors")
 	exportCmd.Flags().StringArrayVar(&channels, "channel", []string{}, "Channel name. Ex: 1, 2, C ,D, VP1. Repeat for multiple. Skip for auto-detection")
+	exportCmd.Flags().IntVar(&parallel, "parallel", export.DefaultParallel, "Max number of channels fetched concurrently. Lowered automatically if device is overloaded")
 	exportCmd.Flags().StringVar(&source, "source", "localhost", "Source of the data. Ex: calnex01.example.com")
+	exportCmd.Flags().StringVar(&spool, "spool", "", "File export is written to before upload. Temporary file if empty. Only with --dest")
+	uploadFlags(exportCmd)
 	if err := exportCmd.MarkFlagRequired("source"); err != nil {
 		log.Fatal(err)
 	}
@@ -48,9 +51,44 @@ var exportCmd = &cobra.Command{
 			}
 			chs = append(chs, *c)
 		}
-		l := export.JSONLogger{Out: os.Stdout}
-		if err := export.Export(source, insecureTLS, allData, chs, l); err != nil {
+		if dest == "" {
+			l := export.JSONLogger{Out: os.Stdout}
+			if err := export.Export(source, insecureTLS, allData, chs, parallel, l); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		if err := exportUpload(chs); err != nil {
 			log.Fatal(err)
 		}
 	},
 }
+
+// exportUpload writes export to the spool file and uploads it to object storage.
+// Temporary spool file is removed once uploaded, kept for resume otherwise
+func exportUpload(chs []api.Channel) error {
+	var f *os.File
+	var err error
+	if spool == "" {
+		f, err = os.CreateTemp("", "calnex-export-*.jsonl")
+	} else {
+		f, err = os.Create(spool)
+	}
+	if err != nil {
+		return err
+	}
+	exportErr := export.Export(source, insecureTLS, allData, chs, parallel, export.JSONLogger{Out: f})
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if exportErr != nil {
+		return exportErr
+	}
+	if err := upload(f.Name()); err != nil {
+		return err
+	}
+	if spool == "" {
+		return os.Remove(f.Name())
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/facebook/time/calnex/inventory"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	targets      []string
+	targetsFile  string
+	manifestFile string
+	format       string
+)
+
+func init() {
+	RootCmd.AddCommand(inventoryCmd)
+	inventoryCmd.Flags().BoolVar(&insecureTLS, "insecureTLS", false, "Ignore TLS certificate errors")
+	inventoryCmd.Flags().StringArrayVar(&targets, "target", []string{}, "device to check. Repeat for multiple")
+	inventoryCmd.Flags().StringVar(&targetsFile, "list", "", "file with devices to check, one per line")
+	inventoryCmd.Flags().StringVar(&manifestFile, "manifest", "", "json manifest with desired firmware versions and options")
+	inventoryCmd.Flags().IntVar(&parallel, "parallel", 8, "Max number of devices checked concurrently")
+	inventoryCmd.Flags().StringVar(&format, "format", "text", "output format, one of text or json")
+	if err := inventoryCmd.MarkFlagRequired("manifest"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readTargets reads devices from file, one per line, skipping empty lines and comments
+func readTargets(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var res []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res = append(res, line)
+	}
+	return res, s.Err()
+}
+
+func inventoryFunc() error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	all := targets
+	if targetsFile != "" {
+		fromFile, err := readTargets(targetsFile)
+		if err != nil {
+			return err
+		}
+		all = append(all, fromFile...)
+	}
+	if len(all) == 0 {
+		return fmt.Errorf("no devices to check, use --target or --list")
+	}
+	m, err := inventory.ReadManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	report := inventory.Report(all, insecureTLS, m, parallel)
+	if format == "json" {
+		return inventory.WriteJSON(os.Stdout, report)
+	}
+	return inventory.WriteText(os.Stdout, report)
+}
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "report model, serial, firmware and options of devices and their compliance with the manifest",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := inventoryFunc(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,74 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/facebook/time/calnex/export"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(uploadCmd)
+	uploadCmd.Flags().StringVar(&source, "file", "", "file to upload. Interrupted upload of the same file resumes")
+	uploadFlags(uploadCmd)
+	if err := uploadCmd.MarkFlagRequired("file"); err != nil {
+		log.Fatal(err)
+	}
+	if err := uploadCmd.MarkFlagRequired("dest"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// uploadFlags adds flags of object storage destination
+func uploadFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&dest, "dest", "", "object storage destination. Ex: s3://bucket/calnex/export.jsonl, gs://bucket/calnex/export.jsonl")
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "S3 compatible storage endpoint. Ex: https://minio.example.com. Skip for AWS or GCS")
+	cmd.Flags().StringVar(&region, "region", os.Getenv("AWS_REGION"), "S3 region")
+}
+
+// upload uploads the file to the object storage destination.
+// Credentials are AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, which are HMAC keys for GCS
+func upload(file string) error {
+	o, key, err := export.ParseDestination(dest, region)
+	if err != nil {
+		return err
+	}
+	if endpoint != "" {
+		o.Endpoint = endpoint
+	}
+	o.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	o.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if err := o.Upload(context.Background(), file, key); err != nil {
+		log.Errorf("Upload failed, run 'calnex upload --file %s --dest %s' to resume", file, dest)
+		return err
+	}
+	return nil
+}
+
+var uploadCmd = &cobra.Command{
+	Use:   "upload",
+	Short: "upload export to S3 or GCS",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := upload(source); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
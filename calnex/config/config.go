@@ -28,6 +28,8 @@ import (
 type CalnexConfig struct {
 	Measure        map[api.Channel]MeasureConfig `json:"measure"`
 	AntennaDelayNS int                           `json:"antennaDelayNS"`
+	// Output is time the device serves on its physical channels. Untouched if not set
+	Output map[api.Channel]OutputConfig `json:"output,omitempty"`
 }
 
 // MeasureConfig is a Calnex channel config
@@ -37,6 +39,36 @@ type MeasureConfig struct {
 	Name   string    `json:"name"`
 }
 
+// OutputConfig is a Calnex physical channel acting as NTP server or PTP master
+type OutputConfig struct {
+	Probe api.Probe `json:"probe"`
+	// Stratum of the NTP server. 1 if not set
+	Stratum int `json:"stratum"`
+	// Domain of the PTP master
+	Domain int `json:"domain"`
+	// LogSyncInterval and LogAnnounceInterval of the PTP master, 0 is 1 packet/s
+	LogSyncInterval     int  `json:"logSyncInterval"`
+	LogAnnounceInterval int  `json:"logAnnounceInterval"`
+	Multicast           bool `json:"multicast"`
+}
+
+// PTP log message interval range supported by Calnex
+const (
+	minLogInterval = -7
+	maxLogInterval = 4
+)
+
+// packetRate returns Calnex representation of PTP log message interval like "1 packet/16 s"
+func packetRate(logInterval int) string {
+	switch {
+	case logInterval > 0:
+		return fmt.Sprintf("1 packet/%d s", 1<<logInterval)
+	case logInterval < 0:
+		return fmt.Sprintf("%d packets/s", 1<<-logInterval)
+	}
+	return "1 packet/s"
+}
+
 type config struct {
 	changed bool
 }
@@ -59,7 +91,23 @@ func (c *config) set(s *ini.Section, name, value string) {
 	}
 }
 
-func (c *config) measureConfig(s *ini.Section, mc map[api.Channel]MeasureConfig) {
+func (c *config) measureConfig(s *ini.Section, mc map[api.Channel]MeasureConfig) error {
+	// discover channels before any settings are added
+	channels := api.ChannelsFromSettings(s)
+	installed := make(map[api.Channel]api.ChannelCapabilities, len(channels))
+	for _, ch := range channels {
+		installed[ch.Channel] = ch
+	}
+	for ch, m := range mc {
+		capabilities, ok := installed[ch]
+		if !ok {
+			return fmt.Errorf("channel %s is not installed on the device", ch)
+		}
+		if !capabilities.Supports(m.Probe) {
+			return fmt.Errorf("channel %s doesn't support %s probe", ch, m.Probe)
+		}
+	}
+
 	channelEnabled := make(map[api.Channel]bool)
 
 	for ch, m := range mc {
@@ -123,15 +171,71 @@ func (c *config) measureConfig(s *ini.Section, mc map[api.Channel]MeasureConfig)
 	}
 
 	// Disable unused channels and enable used
-	for ch, datatype := range api.MeasureChannelDatatypeMap {
-		if !channelEnabled[ch] {
-			c.set(s, fmt.Sprintf("%s\\used", ch.CalnexAPI()), api.NO)
-			if datatype == api.TWOWAYTE {
-				c.set(s, fmt.Sprintf("%s\\protocol_enabled", ch.CalnexAPI()), api.OFF)
-				c.set(s, fmt.Sprintf("%s\\ptp_synce\\mode\\probe_type", ch.CalnexAPI()), api.DISABLED)
+	for _, ch := range channels {
+		if !channelEnabled[ch.Channel] {
+			c.set(s, fmt.Sprintf("%s\\used", ch.Channel.CalnexAPI()), api.NO)
+			if ch.Datatype == api.TWOWAYTE {
+				c.set(s, fmt.Sprintf("%s\\protocol_enabled", ch.Channel.CalnexAPI()), api.OFF)
+				c.set(s, fmt.Sprintf("%s\\ptp_synce\\mode\\probe_type", ch.Channel.CalnexAPI()), api.DISABLED)
 			}
 		}
 	}
+	return nil
+}
+
+func (c *config) outputConfig(s *ini.Section, oc map[api.Channel]OutputConfig) error {
+	for ch, o := range oc {
+		if ch != api.ChannelONE && ch != api.ChannelTWO {
+			return fmt.Errorf("channel %s is not a physical channel and can't serve time", ch)
+		}
+		if o.Probe != api.ProbeNTP && o.Probe != api.ProbePTP {
+			return fmt.Errorf("channel %s can't serve %s", ch, o.Probe)
+		}
+		if o.Stratum < 0 || o.Stratum > 15 {
+			return fmt.Errorf("channel %s has invalid stratum %d", ch, o.Stratum)
+		}
+		if o.Domain < 0 || o.Domain > 255 {
+			return fmt.Errorf("channel %s has invalid domain %d", ch, o.Domain)
+		}
+		for _, i := range []int{o.LogSyncInterval, o.LogAnnounceInterval} {
+			if i < minLogInterval || i > maxLogInterval {
+				return fmt.Errorf("channel %s has log interval %d out of [%d, %d] range", ch, i, minLogInterval, maxLogInterval)
+			}
+		}
+	}
+
+	for ch := api.ChannelONE; ch <= api.ChannelTWO; ch++ {
+		o, ok := oc[ch]
+		if !ok {
+			c.set(s, fmt.Sprintf("%s\\protocol_enabled", ch.CalnexAPI()), api.OFF)
+			c.set(s, fmt.Sprintf("%s\\ptp_synce\\mode\\generator_type", ch.CalnexAPI()), api.DISABLED)
+			continue
+		}
+
+		c.set(s, fmt.Sprintf("%s\\protocol_enabled", ch.CalnexAPI()), api.ON)
+		switch o.Probe {
+		case api.ProbeNTP:
+			stratum := o.Stratum
+			if stratum == 0 {
+				stratum = 1
+			}
+			c.set(s, fmt.Sprintf("%s\\ptp_synce\\mode\\generator_type", ch.CalnexAPI()), "NTP Server")
+			c.set(s, fmt.Sprintf("%s\\ptp_synce\\ntp\\protocol_level", ch.CalnexAPI()), "UDP/IPv6")
+			c.set(s, fmt.Sprintf("%s\\ptp_synce\\ntp\\stratum", ch.CalnexAPI()), fmt.Sprintf("%d", stratum))
+		case api.ProbePTP:
+			mode := "Unicast"
+			if o.Multicast {
+				mode = "Multicast"
+			}
+			c.set(s, fmt.Sprintf("%s\\ptp_synce\\mode\\generator_type", ch.CalnexAPI()), "PTP Master")
+			c.set(s, fmt.Sprintf("%s\\ptp_synce\\ptp\\protocol_level", ch.CalnexAPI()), "UDP/IPv6")
+			c.set(s, fmt.Sprintf("%s\\ptp_synce\\ptp\\stack_mode", ch.CalnexAPI()), mode)
+			c.set(s, fmt.Sprintf("%s\\ptp_synce\\ptp\\domain", ch.CalnexAPI()), fmt.Sprintf("%d", o.Domain))
+			c.set(s, fmt.Sprintf("%s\\ptp_synce\\ptp\\log_sync_int", ch.CalnexAPI()), packetRate(o.LogSyncInterval))
+			c.set(s, fmt.Sprintf("%s\\ptp_synce\\ptp\\log_announce_int", ch.CalnexAPI()), packetRate(o.LogAnnounceInterval))
+		}
+	}
+	return nil
 }
 
 func (c *config) baseConfig(measure *ini.Section, gnss *ini.Section, antennaDelayNS int) {
@@ -185,7 +289,16 @@ func Config(target string, insecureTLS bool, cc *CalnexConfig, apply bool) error
 	c.baseConfig(m, g, cc.AntennaDelayNS)
 
 	// set measure config
-	c.measureConfig(m, cc.Measure)
+	if err := c.measureConfig(m, cc.Measure); err != nil {
+		return err
+	}
+
+	// set output config
+	if cc.Output != nil {
+		if err := c.outputConfig(f.Section("generate"), cc.Output); err != nil {
+			return err
+		}
+	}
 
 	if !apply {
 		log.Info("dry run. Exiting")
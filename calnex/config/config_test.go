@@ -403,7 +403,8 @@ ch30\ptp_synce\ptp\domain=0
 		},
 	}
 
-	c.measureConfig(s, cc.Measure)
+	err = c.measureConfig(s, cc.Measure)
+	require.NoError(t, err)
 	require.True(t, c.changed)
 
 	buf, err := api.ToBuffer(f)
@@ -411,6 +412,79 @@ ch30\ptp_synce\ptp\domain=0
 	require.Equal(t, expectedConfig, buf.String())
 }
 
+func TestOutputConfig(t *testing.T) {
+	testConfig := `[generate]
+ch6\protocol_enabled=Off
+ch7\protocol_enabled=On
+ch7\ptp_synce\mode\generator_type=PTP Master
+`
+
+	expectedConfig := `[generate]
+ch6\protocol_enabled=On
+ch7\protocol_enabled=Off
+ch7\ptp_synce\mode\generator_type=Disabled
+ch6\ptp_synce\mode\generator_type=PTP Master
+ch6\ptp_synce\ptp\protocol_level=UDP/IPv6
+ch6\ptp_synce\ptp\stack_mode=Multicast
+ch6\ptp_synce\ptp\domain=24
+ch6\ptp_synce\ptp\log_sync_int=16 packets/s
+ch6\ptp_synce\ptp\log_announce_int=1 packet/s
+`
+	c := config{}
+
+	f, err := ini.Load([]byte(testConfig))
+	require.NoError(t, err)
+
+	s := f.Section("generate")
+	err = c.outputConfig(s, map[api.Channel]OutputConfig{
+		api.ChannelONE: {Probe: api.ProbePTP, Domain: 24, LogSyncInterval: -4, Multicast: true},
+	})
+	require.NoError(t, err)
+	require.True(t, c.changed)
+
+	buf, err := api.ToBuffer(f)
+	require.NoError(t, err)
+	require.Equal(t, expectedConfig, buf.String())
+
+	// NTP server with default stratum
+	c = config{}
+	err = c.outputConfig(s, map[api.Channel]OutputConfig{api.ChannelTWO: {Probe: api.ProbeNTP}})
+	require.NoError(t, err)
+	require.True(t, c.changed)
+	require.Equal(t, "NTP Server", s.Key("ch7\\ptp_synce\\mode\\generator_type").Value())
+	require.Equal(t, "1", s.Key("ch7\\ptp_synce\\ntp\\stratum").Value())
+	require.Equal(t, api.DISABLED, s.Key("ch6\\ptp_synce\\mode\\generator_type").Value())
+}
+
+func TestOutputConfigInvalid(t *testing.T) {
+	f := ini.Empty()
+	s := f.Section("generate")
+
+	c := config{}
+	err := c.outputConfig(s, map[api.Channel]OutputConfig{api.ChannelVP1: {Probe: api.ProbeNTP}})
+	require.EqualError(t, err, "channel VP1 is not a physical channel and can't serve time")
+
+	err = c.outputConfig(s, map[api.Channel]OutputConfig{api.ChannelONE: {Probe: api.ProbePPS}})
+	require.EqualError(t, err, "channel 1 can't serve pps")
+
+	err = c.outputConfig(s, map[api.Channel]OutputConfig{api.ChannelONE: {Probe: api.ProbeNTP, Stratum: 16}})
+	require.EqualError(t, err, "channel 1 has invalid stratum 16")
+
+	err = c.outputConfig(s, map[api.Channel]OutputConfig{api.ChannelONE: {Probe: api.ProbePTP, Domain: 256}})
+	require.EqualError(t, err, "channel 1 has invalid domain 256")
+
+	err = c.outputConfig(s, map[api.Channel]OutputConfig{api.ChannelONE: {Probe: api.ProbePTP, LogAnnounceInterval: 5}})
+	require.EqualError(t, err, "channel 1 has log interval 5 out of [-7, 4] range")
+	require.False(t, c.changed)
+}
+
+func TestPacketRate(t *testing.T) {
+	require.Equal(t, "1 packet/16 s", packetRate(4))
+	require.Equal(t, "1 packet/2 s", packetRate(1))
+	require.Equal(t, "1 packet/s", packetRate(0))
+	require.Equal(t, "128 packets/s", packetRate(-7))
+}
+
 func TestConfig(t *testing.T) {
 	expectedConfig := `[gnss]
 antenna_delay=42 ns
@@ -555,11 +629,20 @@ ch30\ptp_synce\ptp\log_sync_int=1 packet/16 s
 ch30\ptp_synce\ptp\stack_mode=Unicast
 ch30\ptp_synce\ptp\domain=0
 `
+	// device reports settings of all its channels
+	settings := "[measure]"
+	for i := 0; i <= 40; i++ {
+		used := api.NO
+		if i == 6 || i == 9 || i == 22 {
+			used = api.YES
+		}
+		settings += fmt.Sprintf("\nch%d\\used=%s", i, used)
+	}
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter,
 		r *http.Request) {
 		if strings.Contains(r.URL.Path, "getsettings") {
 			// FetchSettings
-			fmt.Fprintln(w, "[measure]\nch0\\used=No\nch6\\used=Yes\nch9\\used=Yes\nch22\\used=Yes")
+			fmt.Fprintln(w, settings)
 		} else if strings.Contains(r.URL.Path, "getstatus") {
 			// FetchStatus
 			fmt.Fprintln(w, "{\n\"referenceReady\": true,\n\"modulesReady\": true,\n\"measurementActive\": true\n}")
@@ -606,6 +689,20 @@ ch30\ptp_synce\ptp\domain=0
 	require.NoError(t, err)
 }
 
+func TestMeasureConfigUnsupported(t *testing.T) {
+	f, err := ini.Load([]byte("[measure]\nch0\\installed=1\nch9\\installed=1\nch10\\installed=0\n"))
+	require.NoError(t, err)
+	s := f.Section("measure")
+
+	c := config{}
+	err = c.measureConfig(s, map[api.Channel]MeasureConfig{api.ChannelVP2: {Probe: api.ProbePTP}})
+	require.EqualError(t, err, "channel VP2 is not installed on the device")
+
+	err = c.measureConfig(s, map[api.Channel]MeasureConfig{api.ChannelA: {Probe: api.ProbeNTP}})
+	require.EqualError(t, err, "channel A doesn't support ntp probe")
+	require.False(t, c.changed)
+}
+
 func TestConfigFail(t *testing.T) {
 	cc := &CalnexConfig{Measure: map[api.Channel]MeasureConfig{}}
 
@@ -18,6 +18,8 @@ package export
 
 import (
 	"errors"
+	"net/http"
+	"sync"
 
 	"github.com/facebook/time/calnex/api"
 	log "github.com/sirupsen/logrus"
@@ -26,9 +28,12 @@ import (
 var errNoUsedChannels = errors.New("no used channels")
 var errNoTarget = errors.New("no target succeeds")
 
-// Export data from the device about specified channels to the specified output
-func Export(source string, insecureTLS bool, allData bool, channels []api.Channel, l Logger) (err error) {
-	var success bool
+// DefaultParallel is default number of channels fetched from the device concurrently
+const DefaultParallel = 4
+
+// Export data from the device about specified channels to the specified output.
+// Up to parallel channels are fetched concurrently, fewer if device struggles to keep up
+func Export(source string, insecureTLS bool, allData bool, channels []api.Channel, parallel int, l Logger) (err error) {
 	calnexAPI := api.NewAPI(source, insecureTLS)
 
 	if len(channels) == 0 {
@@ -38,41 +43,37 @@ func Export(source string, insecureTLS bool, allData bool, channels []api.Channe
 		}
 	}
 
-	for _, channel := range channels {
-		printSuccess := true
+	if parallel > len(channels) {
+		parallel = len(channels)
+	}
+	lim := newLimiter(parallel)
+	next := calnexAPI.Client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	calnexAPI.Client.Transport = &throttlingTransport{next: next, limiter: lim}
 
-		probe, err := calnexAPI.FetchChannelProbe(channel)
-		if err != nil {
-			log.Errorf("Failed to fetch protocol from %s, channel %s: %v", source, channel, err)
-			success = success || false
-			continue
-		}
-		target, err := calnexAPI.FetchChannelTarget(channel, *probe)
-		if err != nil {
-			log.Errorf("Failed to fetch target from %s, channel %s: %v", source, channel, err)
-			success = success || false
-			continue
-		}
-		csvLines, err := calnexAPI.FetchCsv(channel, allData)
-		if err != nil {
-			log.Errorf("Failed to fetch data from %s, channel %s: %v", source, channel, err)
-			success = success || false
-			continue
-		}
+	var success bool
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, channel := range channels {
+		wg.Add(1)
+		go func(channel api.Channel) {
+			defer wg.Done()
+			lim.acquire()
+			entries, ok := exportChannel(calnexAPI, source, allData, channel)
+			lim.release()
 
-		for _, csvLine := range csvLines {
-			entry, err := entryFromCSV(csvLine, channel.String(), target, probe.String(), source)
-			if err != nil {
-				printSuccess = false
-				success = success || printSuccess
-				log.Errorf("Failed to generate scribe line for %s, channel %s: %v", source, channel, err)
-				break
+			// keep entries of one channel together
+			mu.Lock()
+			defer mu.Unlock()
+			for _, entry := range entries {
+				l.PrintEntry(entry)
 			}
-
-			l.PrintEntry(entry)
-		}
-		success = success || printSuccess
+			success = success || ok
+		}(channel)
 	}
+	wg.Wait()
 
 	if !success {
 		return errNoTarget
@@ -80,3 +81,34 @@ func Export(source string, insecureTLS bool, allData bool, channels []api.Channe
 
 	return nil
 }
+
+// exportChannel fetches data of a single channel.
+// It returns entries generated so far and whether the whole channel was exported
+func exportChannel(calnexAPI *api.API, source string, allData bool, channel api.Channel) ([]*Entry, bool) {
+	probe, err := calnexAPI.FetchChannelProbe(channel)
+	if err != nil {
+		log.Errorf("Failed to fetch protocol from %s, channel %s: %v", source, channel, err)
+		return nil, false
+	}
+	target, err := calnexAPI.FetchChannelTarget(channel, *probe)
+	if err != nil {
+		log.Errorf("Failed to fetch target from %s, channel %s: %v", source, channel, err)
+		return nil, false
+	}
+	csvLines, err := calnexAPI.FetchCsv(channel, allData)
+	if err != nil {
+		log.Errorf("Failed to fetch data from %s, channel %s: %v", source, channel, err)
+		return nil, false
+	}
+
+	entries := make([]*Entry, 0, len(csvLines))
+	for _, csvLine := range csvLines {
+		entry, err := entryFromCSV(csvLine, channel.String(), target, probe.String(), source)
+		if err != nil {
+			log.Errorf("Failed to generate scribe line for %s, channel %s: %v", source, channel, err)
+			return entries, false
+		}
+		entries = append(entries, entry)
+	}
+	return entries, true
+}
@@ -0,0 +1,333 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultPartSize is default size of a multipart upload part
+	DefaultPartSize = 16 << 20
+	// MinPartSize is the smallest part S3 accepts, except for the last one
+	MinPartSize = 5 << 20
+	// DefaultRetries is default number of retries of a failed request
+	DefaultRetries = 5
+	// DefaultRetryBackoff is default delay before the first retry, doubled every next one
+	DefaultRetryBackoff = time.Second
+)
+
+const (
+	// gcsEndpoint is GCS XML API endpoint, which is S3 compatible
+	gcsEndpoint = "https://storage.googleapis.com"
+	// gcsRegion is the only region GCS accepts in SigV4 signatures
+	gcsRegion = "auto"
+	// metaSHA256 is metadata header carrying hex SHA256 of the whole object
+	metaSHA256 = "X-Amz-Meta-Sha256"
+	// errNoSuchUpload is the error code of unknown, aborted or completed multipart upload
+	errNoSuchUpload = "NoSuchUpload"
+)
+
+var errNoDestination = errors.New("destination must look like s3://bucket/key or gs://bucket/key")
+
+// StorageError is an error reply of the object storage
+type StorageError struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("object storage replied %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// ObjectStore is a bucket of S3 compatible object storage, such as AWS S3 or GCS via XML API with HMAC keys
+type ObjectStore struct {
+	// Endpoint is the base URL of the storage, buckets are addressed path-style
+	Endpoint string
+	// Region is the region requests are signed for
+	Region string
+	// Bucket is the bucket objects are uploaded to
+	Bucket string
+	// AccessKey and SecretKey are the credentials requests are signed with
+	AccessKey string
+	SecretKey string
+	// PartSize is the size of multipart upload parts, DefaultPartSize if 0
+	PartSize int64
+	// Retries is how many times a failed request is retried
+	Retries int
+	// RetryBackoff is delay before the first retry, doubled every next one
+	RetryBackoff time.Duration
+	// Client is the HTTP client, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// ParseDestination returns object store and object key of destination like s3://bucket/key or gs://bucket/key.
+// Credentials are left empty. Region is only used for S3 endpoint and signature
+func ParseDestination(dest string, region string) (*ObjectStore, string, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, "", errNoDestination
+	}
+	o := &ObjectStore{
+		Bucket:       u.Host,
+		Region:       region,
+		PartSize:     DefaultPartSize,
+		Retries:      DefaultRetries,
+		RetryBackoff: DefaultRetryBackoff,
+	}
+	switch u.Scheme {
+	case "s3":
+		if o.Region == "" {
+			o.Region = "us-east-1"
+		}
+		o.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", o.Region)
+	case "gs":
+		o.Region = gcsRegion
+		o.Endpoint = gcsEndpoint
+	default:
+		return nil, "", errNoDestination
+	}
+	return o, key, nil
+}
+
+func (o *ObjectStore) partSize() int64 {
+	if o.PartSize <= 0 {
+		return DefaultPartSize
+	}
+	return o.PartSize
+}
+
+func (o *ObjectStore) client() *http.Client {
+	if o.Client == nil {
+		return http.DefaultClient
+	}
+	return o.Client
+}
+
+// objectURL returns path-style URL of the object with the query
+func (o *ObjectStore) objectURL(key string, q url.Values) (*url.URL, error) {
+	u, err := url.Parse(o.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + o.Bucket + "/" + key
+	u.RawPath = awsEscape(u.Path, true)
+	u.RawQuery = canonicalQuery(q)
+	return u, nil
+}
+
+// retriable returns true if request may succeed if sent again
+func retriable(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// do sends signed request about the object and returns headers and body of a successful reply.
+// Network errors, throttling and server errors are retried with exponential backoff
+func (o *ObjectStore) do(ctx context.Context, method, key string, q url.Values, header http.Header, body []byte) (http.Header, []byte, error) {
+	u, err := o.objectURL(key, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	payloadHash := sha256.Sum256(body)
+	s := &signer{accessKey: o.AccessKey, secretKey: o.SecretKey, region: o.Region}
+	backoff := o.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			log.Warningf("Retrying %s %s in %v, attempt %d of %d: %v", method, u.Path, backoff, attempt, o.Retries, err)
+			select {
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		s.sign(req, hex.EncodeToString(payloadHash[:]), time.Now())
+
+		var resp *http.Response
+		resp, err = o.client().Do(req)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= o.Retries {
+				return nil, nil, err
+			}
+			continue
+		}
+		var respBody []byte
+		respBody, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil && resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+			return resp.Header, respBody, nil
+		}
+		if err == nil {
+			serr := &StorageError{StatusCode: resp.StatusCode, Code: http.StatusText(resp.StatusCode)}
+			_ = xml.Unmarshal(respBody, serr)
+			err = serr
+			if !retriable(resp.StatusCode) {
+				return nil, nil, err
+			}
+		}
+		if attempt >= o.Retries {
+			return nil, nil, err
+		}
+	}
+}
+
+type initiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+// initiate starts multipart upload of the object with hex SHA256 sum and returns its id
+func (o *ObjectStore) initiate(ctx context.Context, key, sum string) (string, error) {
+	h := http.Header{}
+	h.Set(metaSHA256, sum)
+	_, body, err := o.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, h, nil)
+	if err != nil {
+		return "", err
+	}
+	var res initiateResult
+	if err := xml.Unmarshal(body, &res); err != nil {
+		return "", err
+	}
+	if res.UploadID == "" {
+		return "", fmt.Errorf("no upload id in reply: %q", body)
+	}
+	return res.UploadID, nil
+}
+
+// uploadPart uploads the part and verifies storage received it intact.
+// Storage verifies Content-MD5 and payload SHA256, we verify ETag which is MD5 of the part
+func (o *ObjectStore) uploadPart(ctx context.Context, key, uploadID string, n int, data []byte) error {
+	sum := md5.Sum(data)
+	h := http.Header{}
+	h.Set("Content-Md5", base64.StdEncoding.EncodeToString(sum[:]))
+	q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+	rh, _, err := o.do(ctx, http.MethodPut, key, q, h, data)
+	if err != nil {
+		return err
+	}
+	if etag := strings.Trim(rh.Get("ETag"), `"`); etag != hex.EncodeToString(sum[:]) {
+		return fmt.Errorf("part %d checksum mismatch: sent %x, stored %s", n, sum, etag)
+	}
+	return nil
+}
+
+type listPartsResult struct {
+	IsTruncated          bool `xml:"IsTruncated"`
+	NextPartNumberMarker int  `xml:"NextPartNumberMarker"`
+	Parts                []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+// listParts returns ETags of parts already uploaded, by part number
+func (o *ObjectStore) listParts(ctx context.Context, key, uploadID string) (map[int]string, error) {
+	parts := map[int]string{}
+	marker := 0
+	for {
+		q := url.Values{"uploadId": {uploadID}}
+		if marker > 0 {
+			q.Set("part-number-marker", strconv.Itoa(marker))
+		}
+		_, body, err := o.do(ctx, http.MethodGet, key, q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res listPartsResult
+		if err := xml.Unmarshal(body, &res); err != nil {
+			return nil, err
+		}
+		for _, p := range res.Parts {
+			parts[p.PartNumber] = strings.Trim(p.ETag, `"`)
+		}
+		if !res.IsTruncated || res.NextPartNumberMarker <= marker {
+			return parts, nil
+		}
+		marker = res.NextPartNumberMarker
+	}
+}
+
+type completePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeUpload struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []completePart `xml:"Part"`
+}
+
+// complete assembles the object from parts with given ETags
+func (o *ObjectStore) complete(ctx context.Context, key, uploadID string, etags []string) error {
+	c := completeUpload{}
+	for i, etag := range etags {
+		c.Parts = append(c.Parts, completePart{PartNumber: i + 1, ETag: `"` + etag + `"`})
+	}
+	body, err := xml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, reply, err := o.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	// S3 may reply 200 and report failure in the body
+	var res struct {
+		XMLName xml.Name
+		StorageError
+	}
+	if err := xml.Unmarshal(reply, &res); err == nil && res.XMLName.Local == "Error" {
+		res.StatusCode = http.StatusOK
+		return &res.StorageError
+	}
+	return nil
+}
+
+// abort cancels multipart upload and frees parts uploaded so far
+func (o *ObjectStore) abort(ctx context.Context, key, uploadID string) error {
+	_, _, err := o.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	return err
+}
@@ -0,0 +1,270 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an in-memory S3 multipart upload API
+type fakeS3 struct {
+	sync.Mutex
+	nextID   int
+	uploads  map[string]map[int][]byte
+	meta     map[string]string
+	objects  map[string][]byte
+	objMeta  map[string]string
+	pageSize int
+	// partPuts counts part uploads by part number
+	partPuts map[int]int
+	// failPart is how many times upload of the part fails before it succeeds, -1 for always
+	failPart map[int]int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		uploads:  map[string]map[int][]byte{},
+		meta:     map[string]string{},
+		objects:  map[string][]byte{},
+		objMeta:  map[string]string{},
+		pageSize: 2,
+		partPuts: map[int]int{},
+		failPart: map[int]int{},
+	}
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>fake</Message></Error>", code)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		s3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		s3Error(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		return
+	}
+	q := r.URL.Query()
+	id := q.Get("uploadId")
+	if _, ok := q["uploads"]; r.Method == http.MethodPost && ok {
+		f.nextID++
+		id = fmt.Sprintf("upload-%d", f.nextID)
+		f.uploads[id] = map[int][]byte{}
+		f.meta[id] = r.Header.Get(metaSHA256)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+		return
+	}
+	parts, ok := f.uploads[id]
+	if !ok {
+		s3Error(w, http.StatusNotFound, errNoSuchUpload)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.partPuts[n]++
+		if left := f.failPart[n]; left != 0 {
+			f.failPart[n] = left - 1
+			s3Error(w, http.StatusServiceUnavailable, "SlowDown")
+			return
+		}
+		md := md5.Sum(body)
+		if r.Header.Get("Content-Md5") != base64.StdEncoding.EncodeToString(md[:]) {
+			s3Error(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+		parts[n] = body
+		w.Header().Set("ETag", fmt.Sprintf("%q", hex.EncodeToString(md[:])))
+	case http.MethodGet:
+		marker, _ := strconv.Atoi(q.Get("part-number-marker"))
+		var nums []int
+		for n := range parts {
+			if n > marker {
+				nums = append(nums, n)
+			}
+		}
+		sort.Ints(nums)
+		res := listPartsResult{}
+		if len(nums) > f.pageSize {
+			nums = nums[:f.pageSize]
+			res.IsTruncated = true
+			res.NextPartNumberMarker = nums[len(nums)-1]
+		}
+		for _, n := range nums {
+			md := md5.Sum(parts[n])
+			res.Parts = append(res.Parts, struct {
+				PartNumber int    `xml:"PartNumber"`
+				ETag       string `xml:"ETag"`
+			}{n, fmt.Sprintf("%q", hex.EncodeToString(md[:]))})
+		}
+		b, _ := xml.Marshal(res)
+		_, _ = w.Write(b)
+	case http.MethodPost:
+		var c completeUpload
+		if err := xml.Unmarshal(body, &c); err != nil {
+			s3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var obj []byte
+		for i, p := range c.Parts {
+			md := md5.Sum(parts[p.PartNumber])
+			if p.PartNumber != i+1 || p.ETag != fmt.Sprintf("%q", hex.EncodeToString(md[:])) {
+				// real S3 reports it with 200
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code><Message>fake</Message></Error>")
+				return
+			}
+			obj = append(obj, parts[p.PartNumber]...)
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		f.objects[key] = obj
+		f.objMeta[key] = f.meta[id]
+		delete(f.uploads, id)
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case http.MethodDelete:
+		delete(f.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newTestObjectStore(t *testing.T, f *fakeS3) *ObjectStore {
+	ts := httptest.NewServer(f)
+	t.Cleanup(ts.Close)
+	return &ObjectStore{
+		Endpoint:  ts.URL,
+		Region:    "us-east-1",
+		Bucket:    "bucket",
+		AccessKey: "key",
+		SecretKey: "secret",
+		PartSize:  4,
+		Retries:   2,
+		Client:    ts.Client(),
+	}
+}
+
+func TestParseDestination(t *testing.T) {
+	o, key, err := ParseDestination("s3://bucket/calnex/export.jsonl", "eu-west-1")
+	require.NoError(t, err)
+	require.Equal(t, "calnex/export.jsonl", key)
+	require.Equal(t, "bucket", o.Bucket)
+	require.Equal(t, "eu-west-1", o.Region)
+	require.Equal(t, "https://s3.eu-west-1.amazonaws.com", o.Endpoint)
+	require.Equal(t, int64(DefaultPartSize), o.PartSize)
+
+	o, _, err = ParseDestination("s3://bucket/export.jsonl", "")
+	require.NoError(t, err)
+	require.Equal(t, "us-east-1", o.Region)
+
+	o, key, err = ParseDestination("gs://bucket/export.jsonl", "eu-west-1")
+	require.NoError(t, err)
+	require.Equal(t, "export.jsonl", key)
+	require.Equal(t, gcsRegion, o.Region)
+	require.Equal(t, gcsEndpoint, o.Endpoint)
+
+	for _, dest := range []string{"s3://bucket", "s3:///key", "http://bucket/key", "/tmp/export.jsonl"} {
+		_, _, err = ParseDestination(dest, "")
+		require.ErrorIs(t, err, errNoDestination, dest)
+	}
+}
+
+func TestObjectURL(t *testing.T) {
+	o := &ObjectStore{Endpoint: "https://storage.example.com/", Bucket: "bucket"}
+	u, err := o.objectURL("calnex/a b+c.jsonl", map[string][]string{"uploadId": {"x/y"}})
+	require.NoError(t, err)
+	require.Equal(t, "https://storage.example.com/bucket/calnex/a%20b%2Bc.jsonl?uploadId=x%2Fy", u.String())
+}
+
+func TestObjectStoreRetry(t *testing.T) {
+	f := newFakeS3()
+	o := newTestObjectStore(t, f)
+	id, err := o.initiate(context.Background(), "key", "sum")
+	require.NoError(t, err)
+	require.Equal(t, "sum", f.meta[id])
+
+	// throttled twice, third attempt succeeds
+	f.failPart[1] = 2
+	require.NoError(t, o.uploadPart(context.Background(), "key", id, 1, []byte("data")))
+	require.Equal(t, 3, f.partPuts[1])
+
+	// out of retries
+	f.failPart[2] = -1
+	err = o.uploadPart(context.Background(), "key", id, 2, []byte("data"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SlowDown")
+	require.Equal(t, 3, f.partPuts[2])
+}
+
+func TestObjectStoreNoRetry(t *testing.T) {
+	f := newFakeS3()
+	o := newTestObjectStore(t, f)
+	_, err := o.listParts(context.Background(), "key", "nope")
+	var serr *StorageError
+	require.ErrorAs(t, err, &serr)
+	require.Equal(t, errNoSuchUpload, serr.Code)
+	require.Equal(t, http.StatusNotFound, serr.StatusCode)
+}
+
+func TestObjectStoreListPartsPaginated(t *testing.T) {
+	f := newFakeS3()
+	o := newTestObjectStore(t, f)
+	id, err := o.initiate(context.Background(), "key", "sum")
+	require.NoError(t, err)
+	for n := 1; n <= 5; n++ {
+		require.NoError(t, o.uploadPart(context.Background(), "key", id, n, bytes.Repeat([]byte{byte(n)}, n)))
+	}
+	parts, err := o.listParts(context.Background(), "key", id)
+	require.NoError(t, err)
+	require.Len(t, parts, 5)
+	md := md5.Sum([]byte{3, 3, 3})
+	require.Equal(t, hex.EncodeToString(md[:]), parts[3])
+}
+
+func TestObjectStoreCompleteError(t *testing.T) {
+	f := newFakeS3()
+	o := newTestObjectStore(t, f)
+	id, err := o.initiate(context.Background(), "key", "sum")
+	require.NoError(t, err)
+	err = o.complete(context.Background(), "key", id, []string{"missing"})
+	var serr *StorageError
+	require.ErrorAs(t, err, &serr)
+	require.Equal(t, "InvalidPart", serr.Code)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// slowResponse is how long device may take to start responding before we consider it overloaded
+const slowResponse = 5 * time.Second
+
+// limiter bounds number of concurrent channel fetches from one device.
+// The limit is halved every time device responds with 5xx or too slowly,
+// and grows back by one after limit consecutive healthy responses.
+type limiter struct {
+	sync.Mutex
+	cond *sync.Cond
+
+	max      int
+	limit    int
+	inflight int
+	healthy  int
+}
+
+func newLimiter(max int) *limiter {
+	if max < 1 {
+		max = 1
+	}
+	l := &limiter{max: max, limit: max}
+	l.cond = sync.NewCond(l)
+	return l
+}
+
+// acquire blocks until there is a free slot
+func (l *limiter) acquire() {
+	l.Lock()
+	defer l.Unlock()
+	for l.inflight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inflight++
+}
+
+// release frees the slot taken by acquire
+func (l *limiter) release() {
+	l.Lock()
+	defer l.Unlock()
+	l.inflight--
+	l.cond.Broadcast()
+}
+
+// observe adjusts the limit based on device response
+func (l *limiter) observe(status int, took time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	if status >= http.StatusInternalServerError || took > slowResponse {
+		l.healthy = 0
+		if l.limit > 1 {
+			l.limit /= 2
+			log.Warningf("device is overloaded (status %d in %v), lowering concurrency to %d", status, took, l.limit)
+		}
+		return
+	}
+	l.healthy++
+	if l.healthy >= l.limit && l.limit < l.max {
+		l.healthy = 0
+		l.limit++
+		l.cond.Broadcast()
+	}
+}
+
+// current returns current concurrency limit
+func (l *limiter) current() int {
+	l.Lock()
+	defer l.Unlock()
+	return l.limit
+}
+
+// throttlingTransport reports every device response to the limiter
+type throttlingTransport struct {
+	next    http.RoundTripper
+	limiter *limiter
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		// connection problems are treated same as server errors
+		t.limiter.observe(http.StatusServiceUnavailable, time.Since(start))
+		return resp, err
+	}
+	t.limiter.observe(resp.StatusCode, time.Since(start))
+	return resp, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterObserve(t *testing.T) {
+	l := newLimiter(8)
+	require.Equal(t, 8, l.current())
+
+	l.observe(http.StatusServiceUnavailable, time.Millisecond)
+	require.Equal(t, 4, l.current())
+	l.observe(http.StatusOK, 2*slowResponse)
+	require.Equal(t, 2, l.current())
+	l.observe(http.StatusInternalServerError, time.Millisecond)
+	require.Equal(t, 1, l.current())
+	l.observe(http.StatusBadGateway, time.Millisecond)
+	require.Equal(t, 1, l.current())
+
+	// recovers by one after limit healthy responses
+	l.observe(http.StatusOK, time.Millisecond)
+	require.Equal(t, 2, l.current())
+	l.observe(http.StatusNotFound, time.Millisecond)
+	require.Equal(t, 2, l.current())
+	l.observe(http.StatusOK, time.Millisecond)
+	require.Equal(t, 3, l.current())
+
+	for i := 0; i < 100; i++ {
+		l.observe(http.StatusOK, time.Millisecond)
+	}
+	require.Equal(t, 8, l.current())
+}
+
+func TestNewLimiterMin(t *testing.T) {
+	require.Equal(t, 1, newLimiter(0).current())
+	require.Equal(t, 1, newLimiter(-3).current())
+}
+
+func TestLimiterAcquire(t *testing.T) {
+	l := newLimiter(2)
+	var mu sync.Mutex
+	var inflight, maxInflight int
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.acquire()
+			mu.Lock()
+			inflight++
+			if inflight > maxInflight {
+				maxInflight = inflight
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			inflight--
+			mu.Unlock()
+			l.release()
+		}()
+	}
+	wg.Wait()
+	require.LessOrEqual(t, maxInflight, 2)
+	require.Equal(t, 0, l.inflight)
+}
+
+func TestThrottlingTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	l := newLimiter(4)
+	c := &http.Client{Transport: &throttlingTransport{next: http.DefaultTransport, limiter: l}}
+	resp, err := c.Get(ts.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, 2, l.current())
+}
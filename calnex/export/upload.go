@@ -0,0 +1,215 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// UploadStateSuffix is appended to the uploaded file name to get the name of the file upload progress is kept in
+const UploadStateSuffix = ".upload"
+
+// uploadState is what is needed to resume interrupted upload
+type uploadState struct {
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	UploadID string `json:"upload_id"`
+	PartSize int64  `json:"part_size"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+// readUploadState reads upload state from the file, nil if there is none
+func readUploadState(path string) (*uploadState, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := &uploadState{}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("parsing upload state %s: %w", path, err)
+	}
+	return st, nil
+}
+
+// write saves upload state atomically, so crash never leaves it half written
+func (st *uploadState) write(path string) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fileSHA256 returns hex SHA256 of the file
+func fileSHA256(f io.ReadSeeker) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Upload uploads the file to the object in parts.
+// Progress is kept next to the file, so interrupted upload of the same file resumes
+// where it stopped: parts already stored with matching checksum aren't sent again.
+// Progress is removed once the object is complete
+func (o *ObjectStore) Upload(ctx context.Context, path, key string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	sum, err := fileSHA256(f)
+	if err != nil {
+		return err
+	}
+
+	want := uploadState{
+		Endpoint: o.Endpoint,
+		Bucket:   o.Bucket,
+		Key:      key,
+		PartSize: o.partSize(),
+		Size:     fi.Size(),
+		SHA256:   sum,
+	}
+	statePath := path + UploadStateSuffix
+	st, err := readUploadState(statePath)
+	if err != nil {
+		log.Warningf("Ignoring upload state: %v", err)
+	}
+
+	uploaded := map[int]string{}
+	if st != nil {
+		resume := *st
+		resume.UploadID = ""
+		if resume != want {
+			log.Warningf("Upload state %s is for a different file or destination, starting over", statePath)
+			st = nil
+		} else if uploaded, err = o.listParts(ctx, key, st.UploadID); err != nil {
+			var serr *StorageError
+			if !errors.As(err, &serr) || serr.Code != errNoSuchUpload {
+				return fmt.Errorf("listing parts of upload %s: %w", st.UploadID, err)
+			}
+			log.Warningf("Upload %s is gone, starting over", st.UploadID)
+			st = nil
+			uploaded = map[int]string{}
+		} else {
+			log.Infof("Resuming upload %s of %s with %d parts already stored", st.UploadID, path, len(uploaded))
+		}
+	}
+	if st == nil {
+		if st, err = o.resetUpload(ctx, statePath, want); err != nil {
+			return err
+		}
+	}
+
+	partSize := st.PartSize
+	parts := int((st.Size + partSize - 1) / partSize)
+	if parts == 0 {
+		// empty object still needs a part
+		parts = 1
+	}
+	etags := make([]string, parts)
+	buf := make([]byte, partSize)
+	for i := 0; i < parts; i++ {
+		n := i + 1
+		size := partSize
+		if rest := st.Size - int64(i)*partSize; rest < size {
+			size = rest
+		}
+		data := buf[:size]
+		if _, err := f.ReadAt(data, int64(i)*partSize); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		md := md5.Sum(data)
+		etags[i] = hex.EncodeToString(md[:])
+		if uploaded[n] == etags[i] {
+			continue
+		}
+		if err := o.uploadPart(ctx, key, st.UploadID, n, data); err != nil {
+			return fmt.Errorf("uploading part %d of %d: %w", n, parts, err)
+		}
+		log.Debugf("Uploaded part %d of %d of %s", n, parts, path)
+	}
+
+	if err := o.complete(ctx, key, st.UploadID, etags); err != nil {
+		return fmt.Errorf("completing upload %s: %w", st.UploadID, err)
+	}
+	if err := os.Remove(statePath); err != nil {
+		log.Warningf("Failed to remove upload state: %v", err)
+	}
+	log.Infof("Uploaded %s to %s/%s in %d parts", path, o.Bucket, key, parts)
+	return nil
+}
+
+// resetUpload aborts previous upload, if any, and starts a new one
+func (o *ObjectStore) resetUpload(ctx context.Context, statePath string, want uploadState) (*uploadState, error) {
+	if old, _ := readUploadState(statePath); old != nil && old.UploadID != "" && old.Endpoint == o.Endpoint && old.Bucket == o.Bucket {
+		// best effort, storage expires abandoned uploads anyway
+		if err := o.abort(ctx, old.Key, old.UploadID); err != nil {
+			log.Warningf("Failed to abort previous upload %s: %v", old.UploadID, err)
+		}
+	}
+	id, err := o.initiate(ctx, want.Key, want.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("initiating upload: %w", err)
+	}
+	want.UploadID = id
+	if err := want.write(statePath); err != nil {
+		return nil, fmt.Errorf("saving upload state: %w", err)
+	}
+	return &want, nil
+}
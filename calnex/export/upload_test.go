@@ -0,0 +1,118 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFile(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "export.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	return path
+}
+
+func TestUpload(t *testing.T) {
+	f := newFakeS3()
+	o := newTestObjectStore(t, f)
+	data := "0123456789abcdefghij"
+	path := writeTestFile(t, data)
+
+	require.NoError(t, o.Upload(context.Background(), path, "calnex/export.jsonl"))
+	require.Equal(t, data, string(f.objects["calnex/export.jsonl"]))
+	sum := sha256.Sum256([]byte(data))
+	require.Equal(t, hex.EncodeToString(sum[:]), f.objMeta["calnex/export.jsonl"])
+	require.Len(t, f.partPuts, 5)
+	require.Empty(t, f.uploads)
+	require.NoFileExists(t, path+UploadStateSuffix)
+}
+
+func TestUploadEmpty(t *testing.T) {
+	f := newFakeS3()
+	o := newTestObjectStore(t, f)
+	path := writeTestFile(t, "")
+
+	require.NoError(t, o.Upload(context.Background(), path, "empty"))
+	require.Contains(t, f.objects, "empty")
+	require.Empty(t, f.objects["empty"])
+}
+
+func TestUploadResume(t *testing.T) {
+	f := newFakeS3()
+	o := newTestObjectStore(t, f)
+	data := "0123456789abcdefghij"
+	path := writeTestFile(t, data)
+
+	// network is gone by part 4
+	f.failPart[4] = -1
+	err := o.Upload(context.Background(), path, "key")
+	require.Error(t, err)
+	require.FileExists(t, path+UploadStateSuffix)
+	require.Empty(t, f.objects)
+	require.Equal(t, map[int]int{1: 1, 2: 1, 3: 1, 4: 3}, f.partPuts)
+
+	// and back
+	f.failPart = map[int]int{}
+	f.partPuts = map[int]int{}
+	require.NoError(t, o.Upload(context.Background(), path, "key"))
+	require.Equal(t, data, string(f.objects["key"]))
+	require.Equal(t, map[int]int{4: 1, 5: 1}, f.partPuts)
+	require.NoFileExists(t, path+UploadStateSuffix)
+}
+
+func TestUploadResumeGone(t *testing.T) {
+	f := newFakeS3()
+	o := newTestObjectStore(t, f)
+	data := "0123456789abcdefghij"
+	path := writeTestFile(t, data)
+
+	f.failPart[2] = -1
+	require.Error(t, o.Upload(context.Background(), path, "key"))
+	// storage expired the upload meanwhile
+	f.uploads = map[string]map[int][]byte{}
+	f.failPart = map[int]int{}
+	f.partPuts = map[int]int{}
+
+	require.NoError(t, o.Upload(context.Background(), path, "key"))
+	require.Equal(t, data, string(f.objects["key"]))
+	require.Len(t, f.partPuts, 5)
+}
+
+func TestUploadFileChanged(t *testing.T) {
+	f := newFakeS3()
+	o := newTestObjectStore(t, f)
+	path := writeTestFile(t, "0123456789abcdefghij")
+
+	f.failPart[2] = -1
+	require.Error(t, o.Upload(context.Background(), path, "key"))
+	require.Len(t, f.uploads, 1)
+
+	// file rewritten, stale upload is aborted and new one started
+	data := "9876543210abcdefghij"
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	f.failPart = map[int]int{}
+	require.NoError(t, o.Upload(context.Background(), path, "key"))
+	require.Equal(t, data, string(f.objects["key"]))
+	require.Empty(t, f.uploads)
+}
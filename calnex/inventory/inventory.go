@@ -0,0 +1,227 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	calnexAPI "github.com/facebook/time/calnex/api"
+	version "github.com/hashicorp/go-version"
+)
+
+// AnyModel is the manifest key for the firmware version of models not listed explicitly
+const AnyModel = "*"
+
+// Manifest describes the desired state of the devices
+type Manifest struct {
+	// Firmware is the minimum firmware version by model
+	Firmware map[string]string `json:"firmware"`
+	// Options every device must have licensed
+	Options []string `json:"options"`
+}
+
+// ReadManifest reads Manifest from json file
+func ReadManifest(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", path, err)
+	}
+	for model, v := range m.Firmware {
+		if _, err := version.NewVersion(strings.ToLower(v)); err != nil {
+			return nil, fmt.Errorf("bad firmware version %q for model %q: %w", v, model, err)
+		}
+	}
+	return m, nil
+}
+
+// desiredFirmware returns firmware version required for the model, empty if there is none
+func (m *Manifest) desiredFirmware(model string) string {
+	if v, found := m.Firmware[model]; found {
+		return v
+	}
+	return m.Firmware[AnyModel]
+}
+
+// Device is what the device reports about itself
+type Device struct {
+	Target            string   `json:"target"`
+	Model             string   `json:"model"`
+	SerialNumber      string   `json:"serial_number"`
+	Firmware          string   `json:"firmware"`
+	Options           []string `json:"options"`
+	MeasurementActive bool     `json:"measurement_active"`
+	// Error is set if the device couldn't be inventoried
+	Error string `json:"error,omitempty"`
+}
+
+// Inventory gathers everything we want to know about the target
+func Inventory(target string, insecureTLS bool) *Device {
+	d := &Device{Target: target}
+	api := calnexAPI.NewAPI(target, insecureTLS)
+	if err := d.fetch(api); err != nil {
+		d.Error = err.Error()
+	}
+	return d
+}
+
+func (d *Device) fetch(api *calnexAPI.API) error {
+	v, err := api.FetchVersion()
+	if err != nil {
+		return fmt.Errorf("fetching version: %w", err)
+	}
+	d.Firmware = v.Firmware
+
+	info, err := api.FetchInstrumentInfo()
+	if err != nil {
+		return fmt.Errorf("fetching instrument info: %w", err)
+	}
+	d.Model = info.Model
+	d.SerialNumber = info.SerialNumber
+
+	o, err := api.FetchOptions()
+	if err != nil {
+		return fmt.Errorf("fetching options: %w", err)
+	}
+	d.Options = o.Options
+
+	status, err := api.FetchStatus()
+	if err != nil {
+		return fmt.Errorf("fetching status: %w", err)
+	}
+	d.MeasurementActive = status.MeasurementActive
+	return nil
+}
+
+// Compliance is a Device checked against Manifest
+type Compliance struct {
+	Device
+	DesiredFirmware string   `json:"desired_firmware,omitempty"`
+	NeedsUpgrade    bool     `json:"needs_upgrade"`
+	MissingOptions  []string `json:"missing_options,omitempty"`
+	Compliant       bool     `json:"compliant"`
+}
+
+// Check compares device to manifest. Device which couldn't be inventoried is never compliant
+func Check(d *Device, m *Manifest) *Compliance {
+	c := &Compliance{Device: *d}
+	if d.Error != "" {
+		return c
+	}
+	c.DesiredFirmware = m.desiredFirmware(d.Model)
+	if c.DesiredFirmware != "" {
+		current, err := version.NewVersion(strings.ToLower(d.Firmware))
+		if err != nil {
+			c.Error = fmt.Sprintf("bad firmware version %q: %v", d.Firmware, err)
+			return c
+		}
+		desired, err := version.NewVersion(strings.ToLower(c.DesiredFirmware))
+		if err != nil {
+			c.Error = fmt.Sprintf("bad desired firmware version %q: %v", c.DesiredFirmware, err)
+			return c
+		}
+		c.NeedsUpgrade = current.LessThan(desired)
+	}
+	licensed := map[string]bool{}
+	for _, o := range d.Options {
+		licensed[strings.ToLower(o)] = true
+	}
+	for _, o := range m.Options {
+		if !licensed[strings.ToLower(o)] {
+			c.MissingOptions = append(c.MissingOptions, o)
+		}
+	}
+	c.Compliant = !c.NeedsUpgrade && len(c.MissingOptions) == 0
+	return c
+}
+
+// Report inventories all targets, at most parallel at a time, and checks them against manifest.
+// Results are in the order of targets
+func Report(targets []string, insecureTLS bool, m *Manifest, parallel int) []*Compliance {
+	if parallel < 1 {
+		parallel = 1
+	}
+	devices := make([]*Device, len(targets))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, target string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			devices[i] = Inventory(target, insecureTLS)
+		}(i, target)
+	}
+	wg.Wait()
+
+	report := make([]*Compliance, 0, len(devices))
+	for _, d := range devices {
+		report = append(report, Check(d, m))
+	}
+	return report
+}
+
+// WriteText writes report as a table, devices that need attention first
+func WriteText(w io.Writer, report []*Compliance) error {
+	sorted := make([]*Compliance, len(report))
+	copy(sorted, report)
+	sort.SliceStable(sorted, func(i, j int) bool { return !sorted[i].Compliant && sorted[j].Compliant })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tMODEL\tSERIAL\tFIRMWARE\tDESIRED\tOPTIONS\tMEASURING\tSTATUS")
+	for _, c := range sorted {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%t\t%s\n",
+			c.Target, c.Model, c.SerialNumber, c.Firmware, c.DesiredFirmware, strings.Join(c.Options, ","), c.MeasurementActive, c.status())
+	}
+	return tw.Flush()
+}
+
+// status is a short human readable compliance status
+func (c *Compliance) status() string {
+	if c.Error != "" {
+		return fmt.Sprintf("ERROR: %s", c.Error)
+	}
+	var problems []string
+	if c.NeedsUpgrade {
+		problems = append(problems, "NEEDS UPGRADE")
+	}
+	if len(c.MissingOptions) > 0 {
+		problems = append(problems, fmt.Sprintf("MISSING OPTIONS %s", strings.Join(c.MissingOptions, ",")))
+	}
+	if len(problems) == 0 {
+		return "OK"
+	}
+	return strings.Join(problems, "; ")
+}
+
+// WriteJSON writes report as json
+func WriteJSON(w io.Writer, report []*Compliance) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,159 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func calnexServer(t *testing.T, firmware string) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/version":
+			fmt.Fprintf(w, "{\"firmware\": %q}\n", firmware)
+		case "/api/instrument/info":
+			fmt.Fprintln(w, "{\"model\":\"Sentinel\",\"serialNumber\":\"CN123456\"}")
+		case "/api/option/list":
+			fmt.Fprintln(w, "{\"options\":[\"PTP\",\"NTP\"]}")
+		case "/api/getstatus":
+			fmt.Fprintln(w, "{\"referenceReady\": true, \"modulesReady\": true, \"measurementActive\": true}")
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func writeManifest(t *testing.T, content string) string {
+	p := path.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	return p
+}
+
+func TestReadManifest(t *testing.T) {
+	m, err := ReadManifest(writeManifest(t, `{"firmware": {"Sentinel": "2.13.1", "*": "2.11"}, "options": ["PTP"]}`))
+	require.NoError(t, err)
+	require.Equal(t, &Manifest{Firmware: map[string]string{"Sentinel": "2.13.1", AnyModel: "2.11"}, Options: []string{"PTP"}}, m)
+	require.Equal(t, "2.13.1", m.desiredFirmware("Sentinel"))
+	require.Equal(t, "2.11", m.desiredFirmware("Paragon"))
+
+	_, err = ReadManifest(writeManifest(t, `{"firmware": {"Sentinel": "latest"}}`))
+	require.Error(t, err)
+	_, err = ReadManifest(writeManifest(t, `not json`))
+	require.Error(t, err)
+	_, err = ReadManifest(path.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
+
+func TestInventory(t *testing.T) {
+	ts := calnexServer(t, "2.13.1.0.5583D-20210924")
+	defer ts.Close()
+	parsed, _ := url.Parse(ts.URL)
+
+	d := Inventory(parsed.Host, true)
+	require.Equal(t, &Device{
+		Target:            parsed.Host,
+		Model:             "Sentinel",
+		SerialNumber:      "CN123456",
+		Firmware:          "2.13.1.0.5583D-20210924",
+		Options:           []string{"PTP", "NTP"},
+		MeasurementActive: true,
+	}, d)
+}
+
+func TestInventoryUnreachable(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	parsed, _ := url.Parse(ts.URL)
+
+	d := Inventory(parsed.Host, true)
+	require.Contains(t, d.Error, "fetching version")
+	c := Check(d, &Manifest{})
+	require.False(t, c.Compliant)
+}
+
+func TestCheck(t *testing.T) {
+	d := &Device{Target: "calnex01", Model: "Sentinel", Firmware: "2.13.1.0.5583D-20210924", Options: []string{"PTP"}}
+
+	c := Check(d, &Manifest{Firmware: map[string]string{"Sentinel": "2.13.1"}, Options: []string{"ptp"}})
+	require.True(t, c.Compliant)
+	require.False(t, c.NeedsUpgrade)
+	require.Equal(t, "OK", c.status())
+
+	c = Check(d, &Manifest{Firmware: map[string]string{AnyModel: "3.0"}, Options: []string{"PTP", "NTP"}})
+	require.False(t, c.Compliant)
+	require.True(t, c.NeedsUpgrade)
+	require.Equal(t, "3.0", c.DesiredFirmware)
+	require.Equal(t, []string{"NTP"}, c.MissingOptions)
+	require.Equal(t, "NEEDS UPGRADE; MISSING OPTIONS NTP", c.status())
+
+	// no desired version for the model
+	c = Check(d, &Manifest{Firmware: map[string]string{"Paragon": "3.0"}})
+	require.True(t, c.Compliant)
+
+	c = Check(&Device{Target: "calnex02", Firmware: "garbage"}, &Manifest{Firmware: map[string]string{AnyModel: "3.0"}})
+	require.False(t, c.Compliant)
+	require.Contains(t, c.status(), "ERROR: bad firmware version")
+}
+
+func TestReport(t *testing.T) {
+	old := calnexServer(t, "2.11.1.0.5583D-20210924")
+	defer old.Close()
+	current := calnexServer(t, "2.13.1.0.5583D-20210924")
+	defer current.Close()
+	oldURL, _ := url.Parse(old.URL)
+	currentURL, _ := url.Parse(current.URL)
+
+	m := &Manifest{Firmware: map[string]string{"Sentinel": "2.13"}, Options: []string{"PTP"}}
+	report := Report([]string{currentURL.Host, oldURL.Host}, true, m, 0)
+	require.Len(t, report, 2)
+	require.Equal(t, currentURL.Host, report[0].Target)
+	require.True(t, report[0].Compliant)
+	require.Equal(t, oldURL.Host, report[1].Target)
+	require.True(t, report[1].NeedsUpgrade)
+
+	var b bytes.Buffer
+	require.NoError(t, WriteText(&b, report))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, 3)
+	require.True(t, strings.HasPrefix(lines[0], "TARGET"))
+	// devices needing attention go first
+	require.Contains(t, lines[1], oldURL.Host)
+	require.Contains(t, lines[1], "NEEDS UPGRADE")
+	require.Contains(t, lines[2], "OK")
+
+	b.Reset()
+	require.NoError(t, WriteJSON(&b, report))
+	var parsed []map[string]interface{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &parsed))
+	require.Len(t, parsed, 2)
+	require.Equal(t, true, parsed[1]["needs_upgrade"])
+	require.Equal(t, "CN123456", parsed[1]["serial_number"])
+}
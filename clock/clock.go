@@ -16,12 +16,7 @@ limitations under the License.
 
 package clock
 
-import (
-	"time"
-	"unsafe"
-
-	"golang.org/x/sys/unix"
-)
+import "errors"
 
 // PPBToTimexPPM is what we use to conver PPB to PPM.
 // man clock_adjtime(2):
@@ -55,68 +50,29 @@ const (
 	AdjTick uint32 = 0x4000
 )
 
-// Adjtime issues CLOCK_ADJTIME syscall to either adjust the parameters of given clock,
-// or read them if buf is empty.  man(2) clock_adjtime
-func Adjtime(clockid int32, buf *unix.Timex) (state int, err error) {
-	r0, _, errno := unix.Syscall(unix.SYS_CLOCK_ADJTIME, uintptr(clockid), uintptr(unsafe.Pointer(buf)), 0)
-	state = int(r0)
-	if errno != 0 {
-		err = errno
-	}
-	return state, err
-}
+// clock_adjtime status bits from usr/include/linux/timex.h
+const (
+	// insert leap second at the end of the UTC day
+	StaIns int32 = 0x0010
+	// delete leap second at the end of the UTC day
+	StaDel int32 = 0x0020
+)
+
+// Leap second to be applied at the end of the current UTC day, as used by SetLeap
+const (
+	LeapNone   = 0
+	LeapInsert = 1
+	LeapDelete = -1
+)
 
-// FrequencyPPB reads device frequency in PPB
-func FrequencyPPB(clockid int32) (freqPPB float64, state int, err error) {
-	tx := &unix.Timex{}
-	state, err = Adjtime(clockid, tx)
-	// man(2) clock_adjtime
-	freqPPB = float64(tx.Freq) / PPBToTimexPPM
-	return freqPPB, state, err
-}
+// ClockRealtime is the id of system realtime clock, same as CLOCK_REALTIME on every platform
+const ClockRealtime int32 = 0
 
-// AdjFreqPPB adjusts clock frequency in PPB
-func AdjFreqPPB(clockid int32, freqPPB float64) (state int, err error) {
-	tx := &unix.Timex{}
-	// man(2) clock_adjtime, turn ppb to ppm
-	tx.Freq = int64(freqPPB * PPBToTimexPPM)
-	tx.Modes = AdjFrequency
-	return Adjtime(clockid, tx)
-}
+// TimeOK is the state of synchronized clock, same as TIME_OK returned by clock_adjtime(2) on linux
+const TimeOK = 0
 
-// Step steps clock by given step
-func Step(clockid int32, step time.Duration) (state int, err error) {
-	sign := 1
-	if step < 0 {
-		sign = -1
-		step = step * -1
-	}
-	tx := &unix.Timex{}
-	tx.Modes = AdjSetOffset | AdjNano
-	tx.Time.Sec = int64(float64(sign) * (float64(step) / float64(time.Second)))
-	tx.Time.Usec = int64(time.Duration(sign) * (step % time.Second))
-	/*
-	 * The value of a timeval is the sum of its fields, but the
-	 * field tv_usec must always be non-negative.
-	 */
-	if tx.Time.Usec < 0 {
-		tx.Time.Sec--
-		tx.Time.Usec += 1000000000
-	}
-	return Adjtime(clockid, tx)
-}
+// defaultMaxFreqPPB is maximum frequency adjustment we assume when the clock doesn't report one
+const defaultMaxFreqPPB = 500000.0
 
-// MaxFreqPPB returns maximum frequency adjustment supported by the clock
-func MaxFreqPPB(clockid int32) (freqPPB float64, state int, err error) {
-	tx := &unix.Timex{}
-	state, err = Adjtime(clockid, tx)
-	if err != nil {
-		return 0.0, state, err
-	}
-	// man(2) clock_adjtime
-	freqPPB = float64(tx.Tolerance) / PPBToTimexPPM
-	if freqPPB == 0 {
-		freqPPB = 500000
-	}
-	return freqPPB, state, nil
-}
+// ErrUnsupported is returned when the operation is not supported by the clock on this platform
+var ErrUnsupported = errors.New("clock operation is not supported on this platform")
@@ -0,0 +1,69 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clock
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// There is no clock_adjtime(2) on darwin, so only system realtime clock can be stepped
+// with settimeofday(2), and frequency can't be read or adjusted.
+
+// FrequencyPPB is not supported on darwin
+func FrequencyPPB(_ int32) (freqPPB float64, state int, err error) {
+	return 0.0, TimeOK, ErrUnsupported
+}
+
+// AdjFreqPPB is not supported on darwin
+func AdjFreqPPB(_ int32, _ float64) (state int, err error) {
+	return TimeOK, ErrUnsupported
+}
+
+// Step steps system realtime clock by given step, with microsecond resolution
+func Step(clockid int32, step time.Duration) (state int, err error) {
+	if clockid != ClockRealtime {
+		return TimeOK, ErrUnsupported
+	}
+	tv := unix.Timeval{}
+	if err := unix.Gettimeofday(&tv); err != nil {
+		return TimeOK, err
+	}
+	tv = unix.NsecToTimeval(tv.Nano() + step.Nanoseconds())
+	return TimeOK, unix.Settimeofday(&tv)
+}
+
+// MaxFreqPPB is not supported on darwin
+func MaxFreqPPB(_ int32) (freqPPB float64, state int, err error) {
+	return 0.0, TimeOK, ErrUnsupported
+}
+
+// SetLeap is not supported on darwin
+func SetLeap(_ int32, _ int) (state int, err error) {
+	return TimeOK, ErrUnsupported
+}
+
+// SetTAIOffset is not supported on darwin
+func SetTAIOffset(_ int32, _ int) (state int, err error) {
+	return TimeOK, ErrUnsupported
+}
+
+// TAIOffset is not supported on darwin
+func TAIOffset(_ int32) (offset int, state int, err error) {
+	return 0, TimeOK, ErrUnsupported
+}
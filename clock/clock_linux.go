@@ -0,0 +1,123 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clock
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Adjtime issues CLOCK_ADJTIME syscall to either adjust the parameters of given clock,
+// or read them if buf is empty.  man(2) clock_adjtime
+func Adjtime(clockid int32, buf *unix.Timex) (state int, err error) {
+	r0, _, errno := unix.Syscall(unix.SYS_CLOCK_ADJTIME, uintptr(clockid), uintptr(unsafe.Pointer(buf)), 0)
+	state = int(r0)
+	if errno != 0 {
+		err = errno
+	}
+	return state, err
+}
+
+// FrequencyPPB reads device frequency in PPB
+func FrequencyPPB(clockid int32) (freqPPB float64, state int, err error) {
+	tx := &unix.Timex{}
+	state, err = Adjtime(clockid, tx)
+	// man(2) clock_adjtime
+	freqPPB = float64(tx.Freq) / PPBToTimexPPM
+	return freqPPB, state, err
+}
+
+// AdjFreqPPB adjusts clock frequency in PPB
+func AdjFreqPPB(clockid int32, freqPPB float64) (state int, err error) {
+	tx := &unix.Timex{}
+	// man(2) clock_adjtime, turn ppb to ppm
+	tx.Freq = int64(freqPPB * PPBToTimexPPM)
+	tx.Modes = AdjFrequency
+	return Adjtime(clockid, tx)
+}
+
+// Step steps clock by given step
+func Step(clockid int32, step time.Duration) (state int, err error) {
+	sign := 1
+	if step < 0 {
+		sign = -1
+		step = step * -1
+	}
+	tx := &unix.Timex{}
+	tx.Modes = AdjSetOffset | AdjNano
+	tx.Time.Sec = int64(float64(sign) * (float64(step) / float64(time.Second)))
+	tx.Time.Usec = int64(time.Duration(sign) * (step % time.Second))
+	/*
+	 * The value of a timeval is the sum of its fields, but the
+	 * field tv_usec must always be non-negative.
+	 */
+	if tx.Time.Usec < 0 {
+		tx.Time.Sec--
+		tx.Time.Usec += 1000000000
+	}
+	return Adjtime(clockid, tx)
+}
+
+// MaxFreqPPB returns maximum frequency adjustment supported by the clock
+func MaxFreqPPB(clockid int32) (freqPPB float64, state int, err error) {
+	tx := &unix.Timex{}
+	state, err = Adjtime(clockid, tx)
+	if err != nil {
+		return 0.0, state, err
+	}
+	// man(2) clock_adjtime
+	freqPPB = float64(tx.Tolerance) / PPBToTimexPPM
+	if freqPPB == 0 {
+		freqPPB = defaultMaxFreqPPB
+	}
+	return freqPPB, state, nil
+}
+
+// SetLeap arms kernel to insert (LeapInsert) or delete (LeapDelete) leap second at the end of the current UTC day,
+// or disarms it (LeapNone). Kernel only applies leap seconds to system realtime clock
+func SetLeap(clockid int32, leap int) (state int, err error) {
+	tx := &unix.Timex{}
+	if state, err = Adjtime(clockid, tx); err != nil {
+		return state, err
+	}
+	tx.Status &^= StaIns | StaDel
+	switch leap {
+	case LeapInsert:
+		tx.Status |= StaIns
+	case LeapDelete:
+		tx.Status |= StaDel
+	}
+	tx.Modes = AdjStatus
+	return Adjtime(clockid, tx)
+}
+
+// SetTAIOffset sets offset between TAI and UTC kernel uses for CLOCK_TAI, in seconds
+func SetTAIOffset(clockid int32, offset int) (state int, err error) {
+	tx := &unix.Timex{}
+	tx.Modes = AdjTAI
+	tx.Constant = int64(offset)
+	return Adjtime(clockid, tx)
+}
+
+// TAIOffset returns offset between TAI and UTC kernel uses for CLOCK_TAI, in seconds
+func TAIOffset(clockid int32) (offset int, state int, err error) {
+	tx := &unix.Timex{}
+	state, err = Adjtime(clockid, tx)
+	return int(tx.Tai), state, err
+}
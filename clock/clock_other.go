@@ -0,0 +1,57 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clock
+
+import "time"
+
+// FrequencyPPB is not supported on this platform
+func FrequencyPPB(_ int32) (freqPPB float64, state int, err error) {
+	return 0.0, TimeOK, ErrUnsupported
+}
+
+// AdjFreqPPB is not supported on this platform
+func AdjFreqPPB(_ int32, _ float64) (state int, err error) {
+	return TimeOK, ErrUnsupported
+}
+
+// Step is not supported on this platform
+func Step(_ int32, _ time.Duration) (state int, err error) {
+	return TimeOK, ErrUnsupported
+}
+
+// MaxFreqPPB is not supported on this platform
+func MaxFreqPPB(_ int32) (freqPPB float64, state int, err error) {
+	return 0.0, TimeOK, ErrUnsupported
+}
+
+// SetLeap is not supported on this platform
+func SetLeap(_ int32, _ int) (state int, err error) {
+	return TimeOK, ErrUnsupported
+}
+
+// SetTAIOffset is not supported on this platform
+func SetTAIOffset(_ int32, _ int) (state int, err error) {
+	return TimeOK, ErrUnsupported
+}
+
+// TAIOffset is not supported on this platform
+func TAIOffset(_ int32) (offset int, state int, err error) {
+	return 0, TimeOK, ErrUnsupported
+}
@@ -0,0 +1,134 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clock
+
+import (
+	"math"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// On windows only system realtime clock is supported. Frequency is controlled with SetSystemTimeAdjustment,
+// which adds adjustment instead of increment (both in 100ns units) to the clock on every clock interrupt,
+// so resolution of frequency adjustment is pretty coarse.
+
+var (
+	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
+
+	procGetSystemTimeAdjustment = modkernel32.NewProc("GetSystemTimeAdjustment")
+	procSetSystemTimeAdjustment = modkernel32.NewProc("SetSystemTimeAdjustment")
+	procSetSystemTime           = modkernel32.NewProc("SetSystemTime")
+)
+
+// systemTimeAdjustment returns current adjustment and increment of system clock
+func systemTimeAdjustment() (adjustment uint32, increment uint32, disabled bool, err error) {
+	var d int32
+	r, _, e := procGetSystemTimeAdjustment.Call(
+		uintptr(unsafe.Pointer(&adjustment)),
+		uintptr(unsafe.Pointer(&increment)),
+		uintptr(unsafe.Pointer(&d)),
+	)
+	if r == 0 {
+		return 0, 0, false, e
+	}
+	return adjustment, increment, d != 0, nil
+}
+
+// FrequencyPPB reads system clock frequency in PPB
+func FrequencyPPB(clockid int32) (freqPPB float64, state int, err error) {
+	if clockid != ClockRealtime {
+		return 0.0, TimeOK, ErrUnsupported
+	}
+	adjustment, increment, disabled, err := systemTimeAdjustment()
+	if err != nil {
+		return 0.0, TimeOK, err
+	}
+	// system is in charge of the clock, it's not adjusted
+	if disabled || increment == 0 {
+		return 0.0, TimeOK, nil
+	}
+	freqPPB = (float64(adjustment) - float64(increment)) / float64(increment) * 1e9
+	return freqPPB, TimeOK, nil
+}
+
+// AdjFreqPPB adjusts system clock frequency in PPB
+func AdjFreqPPB(clockid int32, freqPPB float64) (state int, err error) {
+	if clockid != ClockRealtime {
+		return TimeOK, ErrUnsupported
+	}
+	_, increment, _, err := systemTimeAdjustment()
+	if err != nil {
+		return TimeOK, err
+	}
+	adjustment := math.Round(float64(increment) * (1 + freqPPB/1e9))
+	r, _, e := procSetSystemTimeAdjustment.Call(uintptr(uint32(adjustment)), 0)
+	if r == 0 {
+		return TimeOK, e
+	}
+	return TimeOK, nil
+}
+
+// Step steps system clock by given step, with millisecond resolution
+func Step(clockid int32, step time.Duration) (state int, err error) {
+	if clockid != ClockRealtime {
+		return TimeOK, ErrUnsupported
+	}
+	ft := windows.Filetime{}
+	windows.GetSystemTimePreciseAsFileTime(&ft)
+	t := time.Unix(0, ft.Nanoseconds()+step.Nanoseconds()).UTC()
+	st := windows.Systemtime{
+		Year:         uint16(t.Year()),
+		Month:        uint16(t.Month()),
+		DayOfWeek:    uint16(t.Weekday()),
+		Day:          uint16(t.Day()),
+		Hour:         uint16(t.Hour()),
+		Minute:       uint16(t.Minute()),
+		Second:       uint16(t.Second()),
+		Milliseconds: uint16(t.Nanosecond() / int(time.Millisecond)),
+	}
+	r, _, e := procSetSystemTime.Call(uintptr(unsafe.Pointer(&st)))
+	if r == 0 {
+		return TimeOK, e
+	}
+	return TimeOK, nil
+}
+
+// MaxFreqPPB returns maximum frequency adjustment of system clock.
+// Windows doesn't report it, so we assume the same default as linux does
+func MaxFreqPPB(clockid int32) (freqPPB float64, state int, err error) {
+	if clockid != ClockRealtime {
+		return 0.0, TimeOK, ErrUnsupported
+	}
+	return defaultMaxFreqPPB, TimeOK, nil
+}
+
+// SetLeap is not supported on windows
+func SetLeap(_ int32, _ int) (state int, err error) {
+	return TimeOK, ErrUnsupported
+}
+
+// SetTAIOffset is not supported on windows
+func SetTAIOffset(_ int32, _ int) (state int, err error) {
+	return TimeOK, ErrUnsupported
+}
+
+// TAIOffset is not supported on windows
+func TAIOffset(_ int32) (offset int, state int, err error) {
+	return 0, TimeOK, ErrUnsupported
+}
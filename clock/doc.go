@@ -20,5 +20,9 @@ Package clock contains a wrapper around CLOCK_ADJTIME syscall.
 It allows interactions with supported clocks, such as system realtime clock or PHC.
 
 Supported methods include getting the frequency, adjusting the frequency, stepping the clock, etc.
+
+Full support is only available on linux. On darwin system realtime clock can be stepped with settimeofday(2),
+on windows system clock can be stepped and its frequency adjusted with SetSystemTime and SetSystemTimeAdjustment.
+Everything else returns ErrUnsupported, so callers can fall back to measuring without touching the clock.
 */
 package clock
@@ -24,6 +24,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/facebook/time/fbclock"
 	"github.com/facebook/time/fbclock/daemon"
 	ptp "github.com/facebook/time/ptp/protocol"
 
@@ -52,6 +53,7 @@ func main() {
 	flag.StringVar(&cfg.Iface, "iface", "eth0", "Network interface to use PHC device from. Used for linearizability tests as well. Must match what PTP client is configured to use")
 	flag.StringVar(&cfg.PTPClientAddress, "ptpclientaddress", ptp.PTP4lSock, "Path to PTP client management address")
 	flag.BoolVar(&cfg.SPTP, "sptp", false, "Connect to sptp instead ot ptp4l")
+	flag.BoolVar(&cfg.LegacyShmV1, "legacyshmv1", true, fmt.Sprintf("Also publish data to %s for clients built before shm versioning", fbclock.ShmPathV1))
 	flag.IntVar(&monitoringPort, "monitoringport", 21039, "Port to run monitoring server on")
 	flag.IntVar(&cfg.RingSize, "buffer", daemon.MathDefaultHistory, "Size of ring buffers, must be at least size of largest num of samples used in M and W formulas")
 	flag.StringVar(&cfg.Math.M, "m", daemon.MathDefaultM, "Math expression for M")
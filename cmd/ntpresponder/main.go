@@ -27,10 +27,12 @@ import (
 	"os/signal"
 	"runtime"
 
+	"github.com/facebook/time/ntp/responder/admin"
 	"github.com/facebook/time/ntp/responder/announce"
 	"github.com/facebook/time/ntp/responder/checker"
 	"github.com/facebook/time/ntp/responder/server"
 	"github.com/facebook/time/ntp/responder/stats"
+	"github.com/facebook/time/ntp/responder/steering"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -43,6 +45,9 @@ func main() {
 		debugger       bool
 		logLevel       string
 		monitoringport int
+		ntpKeyFile     string
+		steeringFile   string
+		adminConfig    admin.Config
 	)
 
 	flag.StringVar(&logLevel, "loglevel", "info", "Set a log level. Can be: debug, info, warning, error")
@@ -53,9 +58,21 @@ func main() {
 	flag.IntVar(&s.Stratum, "stratum", 1, "Stratum of the server")
 	flag.IntVar(&s.Workers, "workers", runtime.NumCPU()*100, "How many workers (routines) to run")
 	flag.Var(&s.ListenConfig.IPs, "ip", fmt.Sprintf("IP to listen to. Repeat for multiple. Default: %s", server.DefaultServerIPs))
+	flag.Var(&s.ListenConfig.Listeners, "listen", "Address to listen to as ip:port[/workers], for example [::1]:1123/10. Repeat for multiple. Overrides -ip and -port")
 	flag.BoolVar(&debugger, "pprof", false, "Enable pprof")
 	flag.BoolVar(&s.ListenConfig.ShouldAnnounce, "announce", false, "Advertize IPs")
 	flag.DurationVar(&s.ExtraOffset, "extraoffset", 0, "Extra offset to return to clients")
+	flag.BoolVar(&s.NTPOverPTP.Enabled, "ntpoverptp", false, "Experimental: also serve NTP over PTP (draft-mlichvar-ntp-ntp-over-ptp) on every IP")
+	flag.IntVar(&s.NTPOverPTP.Port, "ntpoverptpport", 319, "Port to serve NTP over PTP on")
+	flag.StringVar(&ntpKeyFile, "ntpoverptpkeys", "", "Keys file with SHA1 key to authenticate NTP over PTP requests and responses with. Unauthenticated if not set")
+	flag.StringVar(&steeringFile, "steering", "", "JSON file with per client prefix rules to steer or decline responses with. Reloaded on SIGHUP")
+	flag.IntVar(&s.ClientCacheSize, "clientcache", server.DefaultClientCacheSize, "How many recently seen clients each listener remembers to skip repeated request classification. 0 disables the cache")
+
+	flag.StringVar(&adminConfig.Socket, "adminsocket", "", "Unix socket to serve admin API for runtime config changes on")
+	flag.StringVar(&adminConfig.Addr, "adminaddr", "", "Address to serve admin API for runtime config changes on over TLS, for example [::1]:4443")
+	flag.StringVar(&adminConfig.CertFile, "admincert", "", "Certificate to serve admin API over TLS with")
+	flag.StringVar(&adminConfig.KeyFile, "adminkey", "", "Key to serve admin API over TLS with")
+	flag.StringVar(&adminConfig.ClientCAFile, "adminclientca", "", "CA which admin API client certificates must be signed by")
 
 	flag.Parse()
 	s.ListenConfig.IPs.SetDefault()
@@ -77,6 +94,53 @@ func main() {
 		log.Fatalf("Will not start without workers")
 	}
 
+	if s.ClientCacheSize < 0 {
+		log.Fatalf("Client cache size must not be negative")
+	}
+
+	if ntpKeyFile != "" {
+		var err error
+		s.NTPOverPTP.KeyID, s.NTPOverPTP.Key, err = server.ReadNTPKey(ntpKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to read NTP over PTP key: %v", err)
+		}
+	}
+
+	if steeringFile != "" {
+		rules, err := steering.ReadRules(steeringFile)
+		if err != nil {
+			log.Fatalf("Failed to read steering rules: %v", err)
+		}
+		ps, err := steering.NewPrefixSteering(rules)
+		if err != nil {
+			log.Fatalf("Invalid steering rules: %v", err)
+		}
+		s.Steering = ps
+		sigHup := make(chan os.Signal, 1)
+		signal.Notify(sigHup, syscall.SIGHUP)
+		go func() {
+			for range sigHup {
+				rules, err := steering.ReadRules(steeringFile)
+				if err == nil {
+					err = ps.SetRules(rules)
+				}
+				if err != nil {
+					log.Errorf("Failed to reload steering rules, keeping the old ones: %v", err)
+					continue
+				}
+				log.Warningf("Reloaded %d steering rules", len(rules))
+			}
+		}()
+	}
+
+	if err := adminConfig.Validate(); err != nil {
+		log.Fatalf("Invalid admin API config: %v", err)
+	}
+
+	if s.NTPOverPTP.Enabled {
+		log.Warningf("Will serve experimental NTP over PTP on port %d", s.NTPOverPTP.Port)
+	}
+
 	if debugger {
 		log.Warningf("Staring profiler on %s", pprofHTTP)
 		go func() {
@@ -92,13 +156,18 @@ func main() {
 	// Replace with your implementation of Stats
 	st := &stats.JSONStats{}
 	go st.Start(monitoringport)
+	if len(s.ListenConfig.Listeners) != 0 {
+		s.ListenerStats = func(addr server.ListenAddr) server.Stats {
+			return st.ForListener(addr.String())
+		}
+	}
 
 	// Replace with your implementation of Announce
 	s.Announce = &announce.NoopAnnounce{}
 
 	ch := &checker.SimpleChecker{
-		ExpectedListeners: int64(len(s.ListenConfig.IPs)),
-		ExpectedWorkers:   int64(s.Workers),
+		ExpectedListeners: int64(s.ExpectedListeners()),
+		ExpectedWorkers:   int64(s.ExpectedWorkers()),
 	}
 
 	// context is used in server in case work needs to be interrupted internally
@@ -129,6 +198,14 @@ func main() {
 		}
 	}()
 
+	if adminConfig.Enabled() {
+		go func() {
+			if err := admin.Start(&adminConfig, &s); err != nil {
+				log.Fatalf("Admin API failed: %v", err)
+			}
+		}()
+	}
+
 	go s.Start(ctx, cancelFunc)
 	<-shutdownFinish
 }
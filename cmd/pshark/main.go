@@ -126,10 +126,13 @@ type packetHandle interface {
 	LinkType() layers.LinkType
 }
 
-func run(input string, filter []ptp.MessageType) error {
+// run dumps PTP packets from the capture, or prints per-flow summary if stats is set
+func run(input string, filter []ptp.MessageType, stats bool) error {
 	// register mapping between ports and our custom PTP layer
 	layers.RegisterUDPPortLayerType(layers.UDPPort(ptp.PortEvent), LayerTypePTP)
 	layers.RegisterUDPPortLayerType(layers.UDPPort(ptp.PortGeneral), LayerTypePTP)
+	// lab setups often tunnel PTP over GRE-in-UDP, plain GRE is decoded by gopacket already
+	layers.RegisterUDPPortLayerType(layers.UDPPort(ptp.PortGREInUDP), layers.LayerTypeGRE)
 
 	filterMap := map[ptp.MessageType]bool{}
 	for _, v := range filter {
@@ -158,6 +161,11 @@ func run(input string, filter []ptp.MessageType) error {
 		}
 	}
 
+	var sum *summary
+	if stats {
+		sum = newSummary()
+	}
+
 	// Loop through packets in file
 	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
 	for packet := range packetSource.Packets() {
@@ -189,11 +197,18 @@ func run(input string, filter []ptp.MessageType) error {
 				srcPort = udp.SrcPort
 				dstPort = udp.DstPort
 			}
+			src := net.JoinHostPort(srcIP.String(), strconv.Itoa(int(srcPort)))
+			dst := net.JoinHostPort(dstIP.String(), strconv.Itoa(int(dstPort)))
+			if sum != nil {
+				h := &ptp.Header{}
+				if err := ptp.FromBytes(ptpContent.Contents, h); err != nil {
+					return fmt.Errorf("decoding PTPv2 header: %w", err)
+				}
+				sum.add(src, dst, packet.Metadata().Timestamp, h)
+				continue
+			}
 			// dump ip:port info on stdout
-			spew.Printf("%s -> %s\n",
-				net.JoinHostPort(srcIP.String(), strconv.Itoa(int(srcPort))),
-				net.JoinHostPort(dstIP.String(), strconv.Itoa(int(dstPort))),
-			)
+			spew.Printf("%s -> %s\n", src, dst)
 			// dump the packet itself
 			spew.Dump(ptpContent.Packet)
 			spew.Println()
@@ -202,6 +217,9 @@ func run(input string, filter []ptp.MessageType) error {
 			return fmt.Errorf("failed to decode: %w", err.Error())
 		}
 	}
+	if sum != nil {
+		sum.write(os.Stdout)
+	}
 	return nil
 }
 
@@ -214,13 +232,14 @@ func main() {
 	}
 	var msgTypes MultiMessageType
 	flag.Var(&msgTypes, "msgtype", fmt.Sprintf("Only print certain PTP message types. Choose from: %v. Repeat for multiple", msgTypes.GetDefaults()))
+	stats := flag.Bool("stats", false, "Print per-flow summary (message counts, rates, sequence gaps, correctionField) instead of every packet")
 	flag.Parse()
 	if len(flag.Args()) != 1 {
 		flag.Usage()
 		os.Exit(1)
 	}
 	msgTypes.SetDefault()
-	if err := run(flag.Arg(0), msgTypes); err != nil {
+	if err := run(flag.Arg(0), msgTypes, *stats); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,174 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// flowKey identifies a flow by its source and destination ip:port
+type flowKey struct {
+	src string
+	dst string
+}
+
+// flowStats is a summary of PTP messages seen in a single flow
+type flowStats struct {
+	first time.Time
+	last  time.Time
+	total int
+	// number of messages of every type
+	counts map[ptp.MessageType]int
+	// number of messages in every second of the capture, by unix time
+	perSecond map[int64]int
+	// sequence tracking per message type
+	lastSeq map[ptp.MessageType]uint16
+	missing map[ptp.MessageType]int
+
+	correctionMin  float64
+	correctionMax  float64
+	correctionSum  float64
+	correctionSeen int
+}
+
+func newFlowStats() *flowStats {
+	return &flowStats{
+		counts:    map[ptp.MessageType]int{},
+		perSecond: map[int64]int{},
+		lastSeq:   map[ptp.MessageType]uint16{},
+		missing:   map[ptp.MessageType]int{},
+	}
+}
+
+// add accounts a message captured at ts
+func (f *flowStats) add(ts time.Time, h *ptp.Header) {
+	if f.total == 0 || ts.Before(f.first) {
+		f.first = ts
+	}
+	if ts.After(f.last) {
+		f.last = ts
+	}
+	f.total++
+	f.perSecond[ts.Unix()]++
+
+	t := h.MessageType()
+	if last, ok := f.lastSeq[t]; ok {
+		// anything going backwards is a duplicate or reordered message rather than a gap
+		if gap := h.SequenceID - last; gap > 1 && gap < 0x8000 {
+			f.missing[t] += int(gap) - 1
+		}
+	}
+	f.lastSeq[t] = h.SequenceID
+	f.counts[t]++
+
+	// correction too big to be represented has no value to account
+	if h.CorrectionField.TooBig() {
+		return
+	}
+	c := h.CorrectionField.Nanoseconds()
+	if f.correctionSeen == 0 || c < f.correctionMin {
+		f.correctionMin = c
+	}
+	if f.correctionSeen == 0 || c > f.correctionMax {
+		f.correctionMax = c
+	}
+	f.correctionSum += c
+	f.correctionSeen++
+}
+
+// rates returns min, mean and max number of messages per second over the seconds the flow lasted
+func (f *flowStats) rates() (int, float64, int) {
+	firstSec, lastSec := f.first.Unix(), f.last.Unix()
+	seconds := lastSec - firstSec + 1
+	minRate, maxRate := f.perSecond[firstSec], 0
+	for sec := firstSec; sec <= lastSec; sec++ {
+		n := f.perSecond[sec]
+		if n < minRate {
+			minRate = n
+		}
+		if n > maxRate {
+			maxRate = n
+		}
+	}
+	return minRate, float64(f.total) / float64(seconds), maxRate
+}
+
+// summary collects flowStats of all flows in a capture
+type summary struct {
+	flows map[flowKey]*flowStats
+}
+
+func newSummary() *summary {
+	return &summary{flows: map[flowKey]*flowStats{}}
+}
+
+// add accounts a message of the flow captured at ts
+func (s *summary) add(src, dst string, ts time.Time, h *ptp.Header) {
+	k := flowKey{src: src, dst: dst}
+	f, ok := s.flows[k]
+	if !ok {
+		f = newFlowStats()
+		s.flows[k] = f
+	}
+	f.add(ts, h)
+}
+
+// write prints per-flow report, busiest flows first
+func (s *summary) write(w io.Writer) {
+	keys := make([]flowKey, 0, len(s.flows))
+	for k := range s.flows {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := s.flows[keys[i]], s.flows[keys[j]]
+		if a.total != b.total {
+			return a.total > b.total
+		}
+		if keys[i].src != keys[j].src {
+			return keys[i].src < keys[j].src
+		}
+		return keys[i].dst < keys[j].dst
+	})
+
+	for _, k := range keys {
+		f := s.flows[k]
+		minRate, meanRate, maxRate := f.rates()
+		fmt.Fprintf(w, "%s -> %s\n", k.src, k.dst)
+		fmt.Fprintf(w, "\tmessages: %d over %v\n", f.total, f.last.Sub(f.first))
+		fmt.Fprintf(w, "\trate: min %d/s, mean %.2f/s, max %d/s\n", minRate, meanRate, maxRate)
+
+		types := make([]ptp.MessageType, 0, len(f.counts))
+		for t := range f.counts {
+			types = append(types, t)
+		}
+		sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+		for _, t := range types {
+			fmt.Fprintf(w, "\t%s: %d, sequence gaps: %d\n", t, f.counts[t], f.missing[t])
+		}
+
+		if f.correctionSeen > 0 {
+			fmt.Fprintf(w, "\tcorrectionField: min %.3fns, mean %.3fns, max %.3fns\n",
+				f.correctionMin, f.correctionSum/float64(f.correctionSeen), f.correctionMax)
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func header(t ptp.MessageType, seq uint16, correctionNS float64) *ptp.Header {
+	return &ptp.Header{
+		SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(t, 0),
+		SequenceID:      seq,
+		CorrectionField: ptp.NewCorrection(correctionNS),
+	}
+}
+
+func TestFlowStats(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	f := newFlowStats()
+	f.add(start, header(ptp.MessageSync, 1, 10))
+	f.add(start.Add(100*time.Millisecond), header(ptp.MessageSync, 2, 20))
+	f.add(start.Add(200*time.Millisecond), header(ptp.MessageAnnounce, 7, 0))
+	// Sync 3 and 4 are lost
+	f.add(start.Add(2100*time.Millisecond), header(ptp.MessageSync, 5, 30))
+	// duplicate isn't a gap
+	f.add(start.Add(2200*time.Millisecond), header(ptp.MessageSync, 5, 30))
+	// wrap around isn't a gap either
+	f.add(start.Add(2300*time.Millisecond), header(ptp.MessageAnnounce, 65535, 0))
+	f.add(start.Add(2400*time.Millisecond), header(ptp.MessageAnnounce, 0, 0))
+
+	require.Equal(t, 7, f.total)
+	require.Equal(t, 4, f.counts[ptp.MessageSync])
+	require.Equal(t, 3, f.counts[ptp.MessageAnnounce])
+	require.Equal(t, 2, f.missing[ptp.MessageSync])
+	require.Equal(t, 0, f.missing[ptp.MessageAnnounce])
+	require.Equal(t, start, f.first)
+	require.Equal(t, start.Add(2400*time.Millisecond), f.last)
+
+	minRate, meanRate, maxRate := f.rates()
+	require.Equal(t, 0, minRate)
+	require.InDelta(t, 7.0/3, meanRate, 0.001)
+	require.Equal(t, 4, maxRate)
+
+	require.Equal(t, 0.0, f.correctionMin)
+	require.Equal(t, 30.0, f.correctionMax)
+	require.Equal(t, 7, f.correctionSeen)
+	require.InDelta(t, 90.0/7, f.correctionSum/float64(f.correctionSeen), 0.001)
+}
+
+func TestFlowStatsCorrectionTooBig(t *testing.T) {
+	f := newFlowStats()
+	h := header(ptp.MessageFollowUp, 1, 0)
+	h.CorrectionField = ptp.NewCorrection(1e20)
+	f.add(time.Unix(1700000000, 0), h)
+	require.Equal(t, 1, f.total)
+	require.Equal(t, 0, f.correctionSeen)
+}
+
+func TestSummaryWrite(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	s := newSummary()
+	s.add("[fd00::1]:319", "[fd00::2]:319", start, header(ptp.MessageDelayReq, 1, 0))
+	s.add("[fd00::2]:319", "[fd00::1]:319", start, header(ptp.MessageSync, 1, 0))
+	s.add("[fd00::2]:319", "[fd00::1]:319", start.Add(500*time.Millisecond), header(ptp.MessageSync, 2, 1.5))
+
+	var buf bytes.Buffer
+	s.write(&buf)
+	expected := `[fd00::2]:319 -> [fd00::1]:319
+	messages: 2 over 500ms
+	rate: min 2/s, mean 2.00/s, max 2/s
+	SYNC: 2, sequence gaps: 0
+	correctionField: min 0.000ns, mean 0.750ns, max 1.500ns
+
+[fd00::1]:319 -> [fd00::2]:319
+	messages: 1 over 0s
+	rate: min 1/s, mean 1.00/s, max 1/s
+	DELAY_REQ: 1, sequence gaps: 0
+	correctionField: min 0.000ns, mean 0.000ns, max 0.000ns
+
+`
+	require.Equal(t, expected, buf.String())
+}
@@ -22,8 +22,11 @@ import (
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"sort"
+	"strings"
 	"time"
 
+	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/facebook/time/ptp/ptp4u/drain"
 	"github.com/facebook/time/ptp/ptp4u/server"
 	"github.com/facebook/time/ptp/ptp4u/stats"
@@ -31,6 +34,37 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// profileNames returns names of all supported PTP profiles
+func profileNames() []string {
+	names := []string{}
+	for _, name := range ptp.ProfileToString {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfileDefaults replaces defaults of flags which weren't set explicitly with defaults of the profile
+func applyProfileDefaults(c *server.Config) {
+	p, err := c.PTPProfile()
+	if err != nil {
+		log.Fatal(err)
+	}
+	preset := p.Preset()
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["domainnumber"] {
+		c.DomainNumber = uint(preset.DefaultDomain)
+	}
+	if !set["multicastsyncinterval"] {
+		c.MulticastSyncInterval = preset.LogSyncInterval.Duration()
+	}
+	if !set["multicastannounceinterval"] {
+		c.MulticastAnnounceInterval = preset.LogAnnounceInterval.Duration()
+	}
+	log.Infof("Using %s profile: domain %d, multicast sync interval %v, multicast announce interval %v", p, c.DomainNumber, c.MulticastSyncInterval, c.MulticastAnnounceInterval)
+}
+
 func main() {
 	// Set reasonable defaults for Dynamic config
 	c := &server.Config{
@@ -46,37 +80,42 @@ func main() {
 	}
 
 	var ipaddr string
+	var multicast string
 
 	flag.IntVar(&c.DSCP, "dscp", 0, "DSCP for PTP packets, valid values are between 0-63 (used by send workers)")
+	flag.IntVar(&c.MaxSenders, "maxsenders", 1, "Max number of senders per worker autoscaling may run when its queue backs up or TX timestamps are slow. 1 disables autoscaling")
 	flag.IntVar(&c.MonitoringPort, "monitoringport", 8888, "Port to run monitoring server on")
 	flag.IntVar(&c.QueueSize, "queue", 0, "Size of the queue to send out packets")
 	flag.IntVar(&c.RecvWorkers, "recvworkers", 10, "Set the number of receive workers")
 	flag.IntVar(&c.SendWorkers, "workers", 100, "Set the number of send workers")
 	flag.UintVar(&c.DomainNumber, "domainnumber", 0, "Set the PTP domain by its number. Valid values are [0-255]")
 	flag.StringVar(&c.ConfigFile, "config", "", "Path to a config with dynamic settings")
+	flag.StringVar(&c.ControlAddr, "controladdr", "", "host:port or unix socket path to serve drain control API on. Disabled if empty")
 	flag.StringVar(&c.DebugAddr, "pprofaddr", "", "host:port for the pprof to bind")
 	flag.StringVar(&c.Interface, "iface", "eth0", "Set the interface")
-	flag.StringVar(&c.LogLevel, "loglevel", "warning", "Set a log level. Can be: debug, info, warning, error")
+	flag.StringVar(&c.LeapSecondFile, "leapsecondfile", "", "tzdata file with leap seconds, like /usr/share/zoneinfo/right/UTC. UTC offset and leap flags follow it instead of the config. Disabled if empty")
+	flag.DurationVar(&c.LeapSecondInterval, "leapsecondinterval", time.Hour, "How often leap second file is re-read")
+	flag.DurationVar(&c.LeapAnnounceWindow, "leapannouncewindow", 24*time.Hour, "How long before a leap second leap flags are set, up to 24h")
+	flag.StringVar(&c.LeapSecondClock, "leapsecondclock", server.LeapSecondClockSystem, "Clock leap second transitions follow: system or phc. phc needs hardware timestamps")
+	flag.StringVar(&c.MgmtSocket, "mgmtsocket", "", "Unix socket path to answer management requests on, for pmc and ptpcheck. Disabled if empty")
+	flag.StringVar(&c.StaticConfig.LogLevel, "loglevel", "warning", "Set a log level. Can be: debug, info, warning, error")
+	flag.StringVar(&c.PHCCheck, "phccheck", server.PHCCheckOff, fmt.Sprintf("What to do if PHC of the interface isn't disciplined at startup. Can be: %s, %s, %s", server.PHCCheckOff, server.PHCCheckRefuse, server.PHCCheckDegrade))
+	flag.StringVar(&c.PHCDevice, "phcdevice", "", "PHC device to check at startup. Taken from -iface if empty")
+	flag.DurationVar(&c.PHCMaxOffset, "phcmaxoffset", 10*time.Millisecond, "Max offset of PHC from system clock adjusted by UTC offset at startup. 0 disables the offset check")
 	flag.StringVar(&c.PidFile, "pidfile", "/var/run/ptp4u.pid", "Pid file location")
 	flag.StringVar(&c.TimestampType, "timestamptype", timestamp.HWTIMESTAMP, fmt.Sprintf("Timestamp type. Can be: %s, %s", timestamp.HWTIMESTAMP, timestamp.SWTIMESTAMP))
-	flag.StringVar(&ipaddr, "ip", "::", "IP to bind on")
+	flag.BoolVar(&c.TXTSBatch, "txtsbatch", false, "Read TX timestamps in batches and send Follow Ups once they are there, instead of waiting for every TX timestamp")
+	flag.StringVar(&ipaddr, "ip", "::", "Comma separated IPs to bind on, at most one IPv4 and one IPv6. The first one is primary, which management and multicast follow")
 	flag.StringVar(&c.DrainFileName, "drainfile", "/var/tmp/kill_ptp4u", "ptp4u drain file location")
 	flag.StringVar(&c.UndrainFileName, "undrainfile", "/var/tmp/unkill_ptp4u", "ptp4u force undrain file location")
+	flag.StringVar(&multicast, "multicast", "", "Comma separated interfaces to multicast Sync and Announce on, as iface or iface=group")
+	flag.DurationVar(&c.MulticastSyncInterval, "multicastsyncinterval", time.Second, "Interval of multicast Sync")
+	flag.DurationVar(&c.MulticastAnnounceInterval, "multicastannounceinterval", 2*time.Second, "Interval of multicast Announce")
+	flag.BoolVar(&c.OneStep, "onestep", false, "Send one-step Syncs to subscribers which accept them. Falls back to two-step if NIC doesn't support one-step hardware timestamps")
+	flag.BoolVar(&c.OneStepP2P, "onestepp2p", false, "Use P2P one-step mode, which also inserts timestamps into Pdelay_Resp. Requires -onestep")
+	flag.StringVar(&c.Profile, "profile", "", fmt.Sprintf("PTP profile to take default domain and multicast intervals from, one of %v", profileNames()))
 	flag.Parse()
 
-	switch c.LogLevel {
-	case "debug":
-		log.SetLevel(log.DebugLevel)
-	case "info":
-		log.SetLevel(log.InfoLevel)
-	case "warning":
-		log.SetLevel(log.WarnLevel)
-	case "error":
-		log.SetLevel(log.ErrorLevel)
-	default:
-		log.Fatalf("Unrecognized log level: %v", c.LogLevel)
-	}
-
 	if c.ConfigFile != "" {
 		dc, err := server.ReadDynamicConfig(c.ConfigFile)
 		if err != nil {
@@ -85,10 +124,34 @@ func main() {
 		c.DynamicConfig = *dc
 	}
 
+	// config file may override log level
+	if err := c.ApplyLogLevel(); err != nil {
+		log.Fatal(err)
+	}
+
+	if c.MaxSenders < 1 {
+		log.Fatalf("Unsupported MaxSenders value %v", c.MaxSenders)
+	}
+
+	if c.LeapSecondFile != "" && c.LeapSecondInterval <= 0 {
+		log.Fatalf("Unsupported LeapSecondInterval value %v", c.LeapSecondInterval)
+	}
+
+	if err := c.LeapSecondSanity(); err != nil {
+		log.Fatal(err)
+	}
+
 	if c.DSCP < 0 || c.DSCP > 63 {
 		log.Fatalf("Unsupported DSCP value %v", c.DSCP)
 	}
 
+	if c.Profile != "" {
+		applyProfileDefaults(c)
+	}
+	if err := c.ProfileSanity(); err != nil {
+		log.Fatal(err)
+	}
+
 	if c.DomainNumber > 255 {
 		log.Fatalf("Unsupported DomainNumber value %v", c.DomainNumber)
 	}
@@ -103,13 +166,45 @@ func main() {
 		log.Fatalf("Unrecognized timestamp type: %s", c.TimestampType)
 	}
 
-	c.IP = net.ParseIP(ipaddr)
+	if c.OneStep && c.TimestampType != timestamp.HWTIMESTAMP {
+		log.Fatalf("One-step Sync requires %s timestamps", timestamp.HWTIMESTAMP)
+	}
+
+	if c.OneStepP2P && !c.OneStep {
+		log.Fatal("P2P one-step mode requires -onestep")
+	}
+
+	for i, ip := range strings.Split(ipaddr, ",") {
+		parsed := net.ParseIP(strings.TrimSpace(ip))
+		if parsed == nil {
+			log.Fatalf("Invalid IP '%s'", ip)
+		}
+		if i == 0 {
+			c.IP = parsed
+		} else {
+			c.ExtraIPs = append(c.ExtraIPs, parsed)
+		}
+	}
+	if err := c.ListenSanity(); err != nil {
+		log.Fatal(err)
+	}
+	if multicast != "" {
+		c.Multicast = strings.Split(multicast, ",")
+	}
+	if err := c.PHCCheckSanity(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := c.MulticastSanity(); err != nil {
+		log.Fatal(err)
+	}
+
 	found, err := c.IfaceHasIP()
 	if err != nil {
 		log.Fatal(err)
 	}
 	if !found {
-		log.Fatalf("IP '%s' is not found on interface '%s'", c.IP, c.Interface)
+		log.Fatalf("IPs %v are not all found on interface '%s'", c.ListenIPs(), c.Interface)
 	}
 
 	if c.DebugAddr != "" {
@@ -0,0 +1,104 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/facebook/time/cmd/ptpcheck/checker"
+	"github.com/facebook/time/ptp/sptp/stats"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	burstServerFlag   string
+	burstCountFlag    int
+	burstIntervalFlag time.Duration
+	burstJSONFlag     bool
+)
+
+func init() {
+	RootCmd.AddCommand(burstCmd)
+	burstCmd.Flags().StringVarP(&rootClientFlag, "client", "C", "", rootClientFlagDesc)
+	burstCmd.Flags().StringVarP(&burstServerFlag, "server", "S", "", "GM to run burst with, as configured in sptp")
+	burstCmd.Flags().IntVarP(&burstCountFlag, "count", "c", stats.DefaultBurstCount, "number of exchanges")
+	burstCmd.Flags().DurationVarP(&burstIntervalFlag, "interval", "i", stats.DefaultBurstInterval, "interval between exchanges")
+	burstCmd.Flags().BoolVarP(&burstJSONFlag, "json", "j", false, "JSON output")
+}
+
+func printBurst(r *stats.BurstResult) {
+	fmt.Printf("GM %s: %d exchanges every %v, %d succeeded, %d failed\n",
+		r.GMAddress, r.Count, time.Duration(r.Interval), r.Succeeded, r.Failed)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"", "min(ns)", "max(ns)", "mean(ns)", "median(ns)", "stddev(ns)"})
+	for _, row := range []struct {
+		name string
+		s    stats.BurstSummary
+	}{{"offset", r.Offset}, {"delay", r.Delay}} {
+		table.Append([]string{
+			row.name,
+			fmt.Sprintf("%.0f", row.s.Min),
+			fmt.Sprintf("%.0f", row.s.Max),
+			fmt.Sprintf("%.0f", row.s.Mean),
+			fmt.Sprintf("%.0f", row.s.Median),
+			fmt.Sprintf("%.0f", row.s.StdDev),
+		})
+	}
+	table.Render()
+}
+
+func burstRun(address string) error {
+	if burstServerFlag == "" {
+		return fmt.Errorf("server must be specified")
+	}
+	f := checker.GetFlavour()
+	if f != checker.FlavourSPTP {
+		return fmt.Errorf("burst is only supported by sptp")
+	}
+	address = checker.GetServerAddress(address, f)
+	r, err := stats.FetchBurst(address, burstServerFlag, burstCountFlag, burstIntervalFlag)
+	if err != nil {
+		return fmt.Errorf("running burst: %w", err)
+	}
+	if burstJSONFlag {
+		str, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("marshaling json: %w", err)
+		}
+		fmt.Printf("%s\n", string(str))
+		return nil
+	}
+	printBurst(r)
+	return nil
+}
+
+var burstCmd = &cobra.Command{
+	Use:   "burst",
+	Short: "Run on-demand high-rate burst of exchanges with one GM via sptp and print statistics. Servo is not affected",
+	Run: func(c *cobra.Command, args []string) {
+		ConfigureVerbosity()
+		if err := burstRun(rootClientFlag); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
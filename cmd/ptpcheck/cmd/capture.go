@@ -0,0 +1,202 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
+
+	"github.com/facebook/time/ptp/pcapng"
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+)
+
+const (
+	captureSnapLen = 65535
+	// how often we check if capture needs to be stopped while there is no traffic
+	captureReadTimeout = 100 * time.Millisecond
+)
+
+var (
+	captureIfaceFlag        string
+	captureOutputFlag       string
+	captureCountFlag        int
+	captureDurationFlag     time.Duration
+	captureTimestampingFlag string
+)
+
+func init() {
+	RootCmd.AddCommand(captureCmd)
+	captureCmd.Flags().StringVarP(&captureIfaceFlag, "iface", "i", "eth0", "network interface to capture PTP traffic on")
+	captureCmd.Flags().StringVarP(&captureOutputFlag, "output", "o", "ptp.pcapng", "pcapng file to write captured packets to")
+	captureCmd.Flags().IntVarP(&captureCountFlag, "count", "c", 0, "stop after capturing this many PTP packets, 0 means no limit")
+	captureCmd.Flags().DurationVarP(&captureDurationFlag, "duration", "d", 0, "stop after capturing for this long, 0 means no limit")
+	captureCmd.Flags().StringVarP(&captureTimestampingFlag, "timestamping", "t", "hardware", "timestamping to use, either 'hardware' or 'software'")
+}
+
+// ptpPayload returns PTP message from Ethernet frame, either carried over UDP or directly over Ethernet, nil if frame is not PTP
+func ptpPayload(frame []byte) []byte {
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.NoCopy)
+	if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
+		udp := udpLayer.(*layers.UDP)
+		for _, port := range []layers.UDPPort{udp.SrcPort, udp.DstPort} {
+			if port == layers.UDPPort(ptp.PortEvent) || port == layers.UDPPort(ptp.PortGeneral) {
+				return udp.Payload
+			}
+		}
+		return nil
+	}
+	if dot1qLayer := packet.Layer(layers.LayerTypeDot1Q); dot1qLayer != nil {
+		dot1q := dot1qLayer.(*layers.Dot1Q)
+		if dot1q.Type == layers.EthernetType(ptp.EtherTypePTP) {
+			return dot1q.Payload
+		}
+		return nil
+	}
+	if ethLayer := packet.Layer(layers.LayerTypeEthernet); ethLayer != nil {
+		eth := ethLayer.(*layers.Ethernet)
+		if eth.EthernetType == layers.EthernetType(ptp.EtherTypePTP) {
+			return eth.Payload
+		}
+	}
+	return nil
+}
+
+// captureSocket opens raw socket receiving all frames on the interface, with RX timestamps enabled
+func captureSocket(iface *net.Interface, timestamping string) (int, error) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(timestamp.Htons(unix.ETH_P_ALL)))
+	if err != nil {
+		return -1, fmt.Errorf("creating packet socket: %w", err)
+	}
+	sa := &unix.SockaddrLinklayer{
+		Protocol: timestamp.Htons(unix.ETH_P_ALL),
+		Ifindex:  iface.Index,
+	}
+	if err := unix.Bind(fd, sa); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("binding packet socket to %s: %w", iface.Name, err)
+	}
+	switch timestamping {
+	case "hardware":
+		err = timestamp.EnableHWTimestamps(fd, iface.Name)
+	case "software":
+		err = timestamp.EnableSWTimestampsRx(fd)
+	default:
+		err = fmt.Errorf("unknown timestamping %q", timestamping)
+	}
+	if err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("enabling %s timestamping: %w", timestamping, err)
+	}
+	tv := unix.NsecToTimeval(captureReadTimeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("setting read timeout: %w", err)
+	}
+	return fd, nil
+}
+
+func captureRun(ctx context.Context, ifaceName, output string, count int, timestamping string) error {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return fmt.Errorf("looking up interface %q: %w", ifaceName, err)
+	}
+	fd, err := captureSocket(iface, timestamping)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("creating %q: %w", output, err)
+	}
+	defer f.Close()
+	w, err := pcapng.NewWriter(f, "ptpcheck capture", iface.Name, layers.LinkTypeEthernet, captureSnapLen)
+	if err != nil {
+		return fmt.Errorf("writing pcapng header: %w", err)
+	}
+
+	buf := make([]byte, captureSnapLen)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	captured := 0
+	log.Infof("capturing PTP traffic on %s with %s timestamps into %s", iface.Name, timestamping, output)
+	for ctx.Err() == nil && (count == 0 || captured < count) {
+		n, sa, ts, err := timestamp.ReadPacketWithRXTimestampBuf(fd, buf, oob)
+		tsSource := timestamping
+		if n == 0 {
+			if err != nil && !errors.Is(err, unix.EAGAIN) && !errors.Is(err, unix.EINTR) {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			// packet is read, but kernel didn't timestamp it, which happens to outgoing packets
+			log.Debugf("no RX timestamp: %v", err)
+			ts = time.Now()
+			tsSource = "userspace"
+		}
+		payload := ptpPayload(buf[:n])
+		if payload == nil {
+			continue
+		}
+		outgoing := false
+		if ll, ok := sa.(*unix.SockaddrLinklayer); ok {
+			outgoing = ll.Pkttype == unix.PACKET_OUTGOING
+		}
+		comment := pcapng.Comment(tsSource, outgoing, payload)
+		log.Debugf("%s %s", ts, comment)
+		if err := w.WritePacket(ts, buf[:n], n, comment); err != nil {
+			return fmt.Errorf("writing packet: %w", err)
+		}
+		captured++
+	}
+	log.Infof("captured %d PTP packets", captured)
+	return w.Flush()
+}
+
+var captureCmd = &cobra.Command{
+	Use:   "capture",
+	Short: "Capture PTP traffic into pcapng, with timestamps and decoded messages in packet comments",
+	Long:  "Capture PTP traffic into pcapng file, which can be read by pshark or wireshark. Every packet is annotated with a comment naming timestamp source, direction and decoded PTP message.",
+	Run: func(c *cobra.Command, args []string) {
+		ConfigureVerbosity()
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		if captureDurationFlag > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, captureDurationFlag)
+			defer cancel()
+		}
+		if err := captureRun(ctx, captureIfaceFlag, captureOutputFlag, captureCountFlag, captureTimestampingFlag); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,89 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+var (
+	testSrcMAC = net.HardwareAddr{0x0c, 0x42, 0xa1, 0x6d, 0x7c, 0xa6}
+	testDstMAC = net.HardwareAddr{0x01, 0x1b, 0x19, 0x00, 0x00, 0x00}
+)
+
+func testSync(t *testing.T) []byte {
+	sync := &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSync, 0),
+			Version:         ptp.Version,
+			MessageLength:   44,
+			DomainNumber:    1,
+			SourcePortIdentity: ptp.PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: 36138748164966842,
+			},
+			SequenceID: 116,
+		},
+		SyncDelayReqBody: ptp.SyncDelayReqBody{
+			OriginTimestamp: ptp.NewTimestamp(time.Unix(1621600325, 123456789)),
+		},
+	}
+	b, err := ptp.Bytes(sync)
+	require.NoError(t, err)
+	return b
+}
+
+func serialize(t *testing.T, l ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, l...)
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func udpFrame(t *testing.T, dstPort layers.UDPPort, payload []byte) []byte {
+	eth := &layers.Ethernet{SrcMAC: testSrcMAC, DstMAC: testDstMAC, EthernetType: layers.EthernetTypeIPv6}
+	ip := &layers.IPv6{Version: 6, NextHeader: layers.IPProtocolUDP, HopLimit: 64, SrcIP: net.ParseIP("fd00::1"), DstIP: net.ParseIP("fd00::2")}
+	udp := &layers.UDP{SrcPort: 12345, DstPort: dstPort}
+	require.NoError(t, udp.SetNetworkLayerForChecksum(ip))
+	return serialize(t, eth, ip, udp, gopacket.Payload(payload))
+}
+
+func TestPtpPayload(t *testing.T) {
+	sync := testSync(t)
+
+	require.Equal(t, sync, ptpPayload(udpFrame(t, layers.UDPPort(ptp.PortEvent), sync)))
+	require.Equal(t, sync, ptpPayload(udpFrame(t, layers.UDPPort(ptp.PortGeneral), sync)))
+	require.Nil(t, ptpPayload(udpFrame(t, 123, sync)))
+
+	eth := &layers.Ethernet{SrcMAC: testSrcMAC, DstMAC: testDstMAC, EthernetType: layers.EthernetType(ptp.EtherTypePTP)}
+	require.Equal(t, sync, ptpPayload(serialize(t, eth, gopacket.Payload(sync))))
+
+	eth = &layers.Ethernet{SrcMAC: testSrcMAC, DstMAC: testDstMAC, EthernetType: layers.EthernetTypeDot1Q}
+	dot1q := &layers.Dot1Q{VLANIdentifier: 100, Type: layers.EthernetType(ptp.EtherTypePTP)}
+	require.Equal(t, sync, ptpPayload(serialize(t, eth, dot1q, gopacket.Payload(sync))))
+
+	eth = &layers.Ethernet{SrcMAC: testSrcMAC, DstMAC: testDstMAC, EthernetType: layers.EthernetTypeARP}
+	require.Nil(t, ptpPayload(serialize(t, eth, gopacket.Payload(sync))))
+}
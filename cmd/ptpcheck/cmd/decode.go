@@ -0,0 +1,71 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var decodeIsJSON bool
+
+func init() {
+	RootCmd.AddCommand(decodeCmd)
+	decodeCmd.Flags().BoolVarP(&decodeIsJSON, "json", "j", false, "produce json output")
+}
+
+// decodeRun decodes hex encoded PTP message and prints it in human readable form
+func decodeRun(w io.Writer, payload string, isJSON bool) error {
+	payload = strings.NewReplacer(" ", "", ":", "", "\n", "").Replace(payload)
+	b, err := hex.DecodeString(payload)
+	if err != nil {
+		return fmt.Errorf("decoding hex: %w", err)
+	}
+	p, err := ptp.DecodePacket(b)
+	if err != nil {
+		return fmt.Errorf("decoding PTP message: %w", err)
+	}
+	if !isJSON {
+		_, err = fmt.Fprint(w, ptp.Dump(p))
+		return err
+	}
+	j, err := ptp.DumpJSON(p)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(j))
+	return err
+}
+
+var decodeCmd = &cobra.Command{
+	Use:   "decode <hex payload>",
+	Short: "Decode PTP message from hex and print it in human readable form",
+	Args:  cobra.ExactArgs(1),
+	Run: func(c *cobra.Command, args []string) {
+		ConfigureVerbosity()
+
+		if err := decodeRun(c.OutOrStdout(), args[0], decodeIsJSON); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
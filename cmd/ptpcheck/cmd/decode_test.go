@@ -0,0 +1,40 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeRun(t *testing.T) {
+	payload := hex.EncodeToString(testSync(t))
+
+	var out bytes.Buffer
+	require.NoError(t, decodeRun(&out, payload, false))
+	require.Contains(t, out.String(), "SYNC:\n  Header:\n    SdoIDAndMsgType: SYNC\n")
+
+	out.Reset()
+	require.NoError(t, decodeRun(&out, payload, true))
+	require.Contains(t, out.String(), `{"Header":{"SdoIDAndMsgType":"SYNC"`)
+
+	require.Error(t, decodeRun(&out, "zz", false))
+	require.Error(t, decodeRun(&out, "00", false))
+}
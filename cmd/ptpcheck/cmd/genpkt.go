@@ -0,0 +1,115 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/facebook/time/ptp/protocol/conformance"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	genpktListFlag   bool
+	genpktOutputFlag string
+)
+
+func init() {
+	RootCmd.AddCommand(genpktCmd)
+	genpktCmd.Flags().BoolVarP(&genpktListFlag, "list", "l", false, "list vectors with their descriptions instead of generating packets")
+	genpktCmd.Flags().StringVarP(&genpktOutputFlag, "output", "o", "", "directory to write packets to as raw <preset>/<vector>.bin files, instead of printing them in hex")
+}
+
+// genpktList prints presets and their vectors with descriptions
+func genpktList(w io.Writer, presets []string) error {
+	vectors, err := conformance.Generate(presets...)
+	if err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		malformed := ""
+		if v.Malformed {
+			malformed = " (malformed)"
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s%s\n", v.Name, v.Description, malformed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// genpktRun generates conformance test vectors of presets (all if none given), printing them in hex or writing them into dir
+func genpktRun(w io.Writer, presets []string, dir string) error {
+	vectors, err := conformance.Generate(presets...)
+	if err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		if dir == "" {
+			if _, err := fmt.Fprintf(w, "%s %s\n", v.Name, hex.EncodeToString(v.Packet)); err != nil {
+				return err
+			}
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(v.Name)+".bin")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, v.Packet, 0644); err != nil {
+			return err
+		}
+	}
+	if dir != "" {
+		_, err = fmt.Fprintf(w, "wrote %d packets to %s\n", len(vectors), dir)
+	}
+	return err
+}
+
+func genpktPresetNames() string {
+	var names []string
+	for _, p := range conformance.Presets() {
+		names = append(names, fmt.Sprintf("  %-14s %s", p.Name, p.Description))
+	}
+	return strings.Join(names, "\n")
+}
+
+var genpktCmd = &cobra.Command{
+	Use:   "genpkt [preset...]",
+	Short: "Generate edge-case PTP packets for conformance testing",
+	Long: "Generate edge-case PTP packets for testing third-party devices and parsers, from all presets if none are given. Presets:\n" +
+		genpktPresetNames() + "\n" +
+		"Packets are printed one per line as '<preset>/<vector> <hex payload>', which 'ptpcheck decode' accepts.",
+	Run: func(c *cobra.Command, args []string) {
+		ConfigureVerbosity()
+
+		var err error
+		if genpktListFlag {
+			err = genpktList(c.OutOrStdout(), args)
+		} else {
+			err = genpktRun(c.OutOrStdout(), args, genpktOutputFlag)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,59 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenpktRun(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, genpktRun(&out, []string{"timestamps"}, ""))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.NotEmpty(t, lines)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		require.Len(t, fields, 2, line)
+		require.True(t, strings.HasPrefix(fields[0], "timestamps/"), line)
+		// every printed packet can be decoded back
+		var decoded bytes.Buffer
+		require.NoError(t, decodeRun(&decoded, fields[1], false), line)
+	}
+
+	dir := t.TempDir()
+	out.Reset()
+	require.NoError(t, genpktRun(&out, []string{"tlv-chain"}, dir))
+	require.Contains(t, out.String(), "packets to "+dir)
+	b, err := os.ReadFile(filepath.Join(dir, "tlv-chain", "signaling-mixed-chain.bin"))
+	require.NoError(t, err)
+	require.NotEmpty(t, b)
+
+	require.Error(t, genpktRun(&out, []string{"nope"}, ""))
+}
+
+func TestGenpktList(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, genpktList(&out, nil))
+	require.Contains(t, out.String(), "reserved-bits/sync-all-reserved-set: SYNC with every reserved bit set\n")
+	require.Contains(t, out.String(), "tlv-chain/signaling-tlv-overrun: TLV length runs past the end of the message (malformed)\n")
+}
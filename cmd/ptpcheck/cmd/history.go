@@ -0,0 +1,100 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/facebook/time/cmd/ptpcheck/history"
+)
+
+// flags
+var (
+	historyDirFlag    string
+	historySinceFlag  time.Duration
+	historyFromFlag   string
+	historyToFlag     string
+	historyWidthFlag  int
+	historyHeightFlag int
+)
+
+func init() {
+	RootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().StringVarP(&historyDirFlag, "history", "H", history.DefaultDir, "directory history is kept in")
+	historyCmd.Flags().DurationVarP(&historySinceFlag, "since", "s", time.Hour, "show history for this long until now, unless --from is set")
+	historyCmd.Flags().StringVarP(&historyFromFlag, "from", "f", "", "start of the range, in RFC3339")
+	historyCmd.Flags().StringVarP(&historyToFlag, "to", "t", "", "end of the range, in RFC3339. Empty means now")
+	historyCmd.Flags().IntVar(&historyWidthFlag, "width", 80, "plot width in characters")
+	historyCmd.Flags().IntVar(&historyHeightFlag, "height", 15, "plot height in characters")
+}
+
+// historyRange returns time range to query from flags
+func historyRange(now time.Time, since time.Duration, fromStr, toStr string) (from, to time.Time, err error) {
+	to = now
+	if toStr != "" {
+		if to, err = time.Parse(time.RFC3339, toStr); err != nil {
+			return from, to, fmt.Errorf("parsing --to: %w", err)
+		}
+	}
+	from = to.Add(-since)
+	if fromStr != "" {
+		if from, err = time.Parse(time.RFC3339, fromStr); err != nil {
+			return from, to, fmt.Errorf("parsing --from: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("start of the range %v must be before its end %v", from, to)
+	}
+	return from, to, nil
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show PTP client history recorded by 'ptpcheck watch --record'",
+	Long: `Show PTP client history recorded by 'ptpcheck watch --record'.
+Plots offset from master over the requested range in the terminal, and lists changes of GM and client state.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ConfigureVerbosity()
+
+		from, to, err := historyRange(time.Now(), historySinceFlag, historyFromFlag, historyToFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := os.Stat(historyDirFlag); err != nil {
+			log.Fatalf("no history: %v", err)
+		}
+		store, err := history.NewStore(historyDirFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		records, err := store.Query(from, to)
+		if err != nil {
+			log.Fatal(err)
+		}
+		history.Plot(os.Stdout, records, historyWidthFlag, historyHeightFlag)
+		if len(records) > 0 {
+			fmt.Println()
+			history.Changes(os.Stdout, records)
+		}
+	},
+}
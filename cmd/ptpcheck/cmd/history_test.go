@@ -0,0 +1,46 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryRange(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	from, to, err := historyRange(now, time.Hour, "", "")
+	require.NoError(t, err)
+	require.Equal(t, now.Add(-time.Hour), from)
+	require.Equal(t, now, to)
+
+	from, to, err = historyRange(now, time.Hour, "", "2023-03-01T10:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, 3, 1, 9, 0, 0, 0, time.UTC), from)
+	require.Equal(t, time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC), to)
+
+	from, _, err = historyRange(now, time.Hour, "2023-02-28T00:00:00Z", "")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC), from)
+
+	_, _, err = historyRange(now, time.Hour, "2023-03-02T00:00:00Z", "")
+	require.Error(t, err)
+	_, _, err = historyRange(now, time.Hour, "yesterday", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/loadgen"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	loadgenServerFlag           string
+	loadgenClientsFlag          int
+	loadgenSourcesFlag          string
+	loadgenDomainFlag           uint8
+	loadgenAnnounceIntervalFlag int8
+	loadgenSyncIntervalFlag     int8
+	loadgenDelayReqIntervalFlag int8
+	loadgenGrantDurationFlag    time.Duration
+	loadgenDurationFlag         time.Duration
+	loadgenRampUpFlag           time.Duration
+	loadgenJSONFlag             bool
+)
+
+func init() {
+	RootCmd.AddCommand(loadgenCmd)
+	loadgenCmd.Flags().StringVarP(&loadgenServerFlag, "server", "S", "", "ptp4u to load")
+	loadgenCmd.Flags().IntVarP(&loadgenClientsFlag, "clients", "n", 10, "number of simulated clients")
+	loadgenCmd.Flags().StringVarP(&loadgenSourcesFlag, "sources", "s", "127.0.1.0/24", "prefix of local addresses clients bind to, one per client starting with the first host address")
+	loadgenCmd.Flags().Uint8Var(&loadgenDomainFlag, "domain", 0, "PTP domain to subscribe in")
+	loadgenCmd.Flags().Int8Var(&loadgenAnnounceIntervalFlag, "announce-interval", 1, "log2 of Announce interval requested")
+	loadgenCmd.Flags().Int8Var(&loadgenSyncIntervalFlag, "sync-interval", -4, "log2 of Sync interval requested")
+	loadgenCmd.Flags().Int8Var(&loadgenDelayReqIntervalFlag, "delayreq-interval", -4, "log2 of interval between Delay_Req, also requested for DelayResp grant")
+	loadgenCmd.Flags().DurationVar(&loadgenGrantDurationFlag, "grant-duration", 5*time.Minute, "grant duration requested, grants are renewed once 3/4 of it passed")
+	loadgenCmd.Flags().DurationVarP(&loadgenDurationFlag, "duration", "d", time.Minute, "how long to keep all clients subscribed")
+	loadgenCmd.Flags().DurationVar(&loadgenRampUpFlag, "ramp-up", 10*time.Second, "time to spread subscription of clients over")
+	loadgenCmd.Flags().BoolVarP(&loadgenJSONFlag, "json", "j", false, "JSON output")
+}
+
+func loadgenRun() error {
+	if loadgenServerFlag == "" {
+		return fmt.Errorf("server must be specified")
+	}
+	sources, err := loadgen.Sources(loadgenSourcesFlag, loadgenClientsFlag)
+	if err != nil {
+		return err
+	}
+	cfg := &loadgen.Config{
+		Server:           loadgenServerFlag,
+		Sources:          sources,
+		Domain:           loadgenDomainFlag,
+		AnnounceInterval: ptp.LogInterval(loadgenAnnounceIntervalFlag),
+		SyncInterval:     ptp.LogInterval(loadgenSyncIntervalFlag),
+		DelayReqInterval: ptp.LogInterval(loadgenDelayReqIntervalFlag),
+		GrantDuration:    loadgenGrantDurationFlag,
+		Duration:         loadgenDurationFlag,
+		RampUp:           loadgenRampUpFlag,
+	}
+	// report what was measured so far if interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	r, err := loadgen.Run(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if loadgenJSONFlag {
+		str, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("marshaling json: %w", err)
+		}
+		fmt.Printf("%s\n", string(str))
+		return nil
+	}
+	fmt.Print(r)
+	return nil
+}
+
+var loadgenCmd = &cobra.Command{
+	Use:   "loadgen",
+	Short: "Load ptp4u with simulated unicast clients and report grant latency, Sync jitter and TX timestamp failures",
+	Long: "Load ptp4u with simulated unicast clients and report grant latency, Sync jitter and TX timestamp failures.\n" +
+		"Unicast Syncs are sent to event port of the subscriber, so every client binds its own address from --sources,\n" +
+		"which have to be configured on the host. Any address of 127.0.0.0/8 works when ptp4u runs on the same host on a specific address",
+	Run: func(c *cobra.Command, args []string) {
+		ConfigureVerbosity()
+		if err := loadgenRun(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,127 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/facebook/time/cmd/ptpcheck/checker"
+	"github.com/facebook/time/ptp/sptp/stats"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maintenanceTokenFileFlag string
+	maintenanceJSONFlag      bool
+)
+
+func init() {
+	RootCmd.AddCommand(maintenanceCmd)
+	maintenanceCmd.Flags().StringVarP(&rootClientFlag, "client", "C", "", rootClientFlagDesc)
+	maintenanceCmd.Flags().StringVarP(&maintenanceTokenFileFlag, "token-file", "t", "", "file with maintenance token, as configured in sptp")
+	maintenanceCmd.Flags().BoolVarP(&maintenanceJSONFlag, "json", "j", false, "JSON output")
+}
+
+// parseMaintenanceArgs turns command line arguments into maintenance request
+func parseMaintenanceArgs(args []string) (*stats.MaintenanceRequest, error) {
+	req := &stats.MaintenanceRequest{Action: args[0]}
+	want := 0
+	switch req.Action {
+	case stats.MaintenanceStatus, stats.MaintenanceFreeze, stats.MaintenanceResume:
+	case stats.MaintenanceStep:
+		want = 1
+	case stats.MaintenanceSlew:
+		want = 2
+	default:
+		return nil, fmt.Errorf("unknown action %q", req.Action)
+	}
+	if len(args)-1 != want {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", req.Action, want, len(args)-1)
+	}
+	var err error
+	if want > 0 {
+		if req.Amount, err = time.ParseDuration(args[1]); err != nil {
+			return nil, fmt.Errorf("parsing amount: %w", err)
+		}
+	}
+	if want > 1 {
+		if req.Duration, err = time.ParseDuration(args[2]); err != nil {
+			return nil, fmt.Errorf("parsing duration: %w", err)
+		}
+	}
+	return req, nil
+}
+
+func printMaintenance(s *stats.MaintenanceState) {
+	fmt.Printf("frozen: %v\n", s.Frozen)
+	if !s.Slewing {
+		fmt.Printf("slewing: false\n")
+		return
+	}
+	fmt.Printf("slewing: true, %+.0f ppb until %v\n", s.SlewPPB, time.Unix(0, s.SlewEnd))
+}
+
+func maintenanceRun(address string, args []string) error {
+	req, err := parseMaintenanceArgs(args)
+	if err != nil {
+		return err
+	}
+	if maintenanceTokenFileFlag == "" {
+		return fmt.Errorf("token file must be specified")
+	}
+	token, err := os.ReadFile(maintenanceTokenFileFlag)
+	if err != nil {
+		return err
+	}
+	f := checker.GetFlavour()
+	if f != checker.FlavourSPTP {
+		return fmt.Errorf("maintenance is only supported by sptp")
+	}
+	address = checker.GetServerAddress(address, f)
+	s, err := stats.RequestMaintenance(address, strings.TrimSpace(string(token)), req)
+	if err != nil {
+		return fmt.Errorf("requesting %s: %w", req.Action, err)
+	}
+	if maintenanceJSONFlag {
+		str, err := json.Marshal(s)
+		if err != nil {
+			return fmt.Errorf("marshaling json: %w", err)
+		}
+		fmt.Printf("%s\n", string(str))
+		return nil
+	}
+	printMaintenance(s)
+	return nil
+}
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance <status|freeze|resume|step AMOUNT|slew AMOUNT DURATION>",
+	Short: "Control the clock disciplined by sptp manually: step or slew it by AMOUNT, freeze servo adjustments or resume them",
+	Args:  cobra.RangeArgs(1, 3),
+	Run: func(c *cobra.Command, args []string) {
+		ConfigureVerbosity()
+		if err := maintenanceRun(rootClientFlag, args); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
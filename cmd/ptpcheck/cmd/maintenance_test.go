@@ -0,0 +1,49 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/ptp/sptp/stats"
+)
+
+func TestParseMaintenanceArgs(t *testing.T) {
+	req, err := parseMaintenanceArgs([]string{"freeze"})
+	require.NoError(t, err)
+	require.Equal(t, &stats.MaintenanceRequest{Action: stats.MaintenanceFreeze}, req)
+
+	req, err = parseMaintenanceArgs([]string{"step", "-1.5ms"})
+	require.NoError(t, err)
+	require.Equal(t, &stats.MaintenanceRequest{Action: stats.MaintenanceStep, Amount: -1500 * time.Microsecond}, req)
+
+	req, err = parseMaintenanceArgs([]string{"slew", "100us", "10m"})
+	require.NoError(t, err)
+	require.Equal(t, &stats.MaintenanceRequest{Action: stats.MaintenanceSlew, Amount: 100 * time.Microsecond, Duration: 10 * time.Minute}, req)
+
+	_, err = parseMaintenanceArgs([]string{"reboot"})
+	require.EqualError(t, err, `unknown action "reboot"`)
+	_, err = parseMaintenanceArgs([]string{"step"})
+	require.EqualError(t, err, "step takes 1 arguments, got 0")
+	_, err = parseMaintenanceArgs([]string{"resume", "1s"})
+	require.EqualError(t, err, "resume takes 0 arguments, got 1")
+	_, err = parseMaintenanceArgs([]string{"slew", "1ms", "soon"})
+	require.Error(t, err)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/facebook/time/phc"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	phcHealthDevices    []string
+	phcHealthInterval   time.Duration
+	phcHealthCount      int
+	phcHealthThreshold  int
+	phcHealthStuckRatio float64
+	phcHealthJSON       bool
+)
+
+func init() {
+	RootCmd.AddCommand(phcHealthCmd)
+	phcHealthCmd.Flags().StringSliceVarP(&phcHealthDevices, "device", "d", []string{"/dev/ptp0"}, "PHC devices to monitor. Repeat or separate with commas for multiple")
+	phcHealthCmd.Flags().DurationVarP(&phcHealthInterval, "interval", "i", phc.DefaultHealthInterval, "How often PHCs are read")
+	phcHealthCmd.Flags().IntVarP(&phcHealthCount, "count", "c", 5, "How many times PHCs are read. 0 to monitor until interrupted")
+	phcHealthCmd.Flags().IntVarP(&phcHealthThreshold, "threshold", "t", phc.DefaultHealthThreshold, "Bad readings in a row before PHC is reported broken")
+	phcHealthCmd.Flags().Float64Var(&phcHealthStuckRatio, "stuck-ratio", phc.DefaultHealthStuckRatio, "Share of elapsed system time PHC has to advance by not to be considered stuck")
+	phcHealthCmd.Flags().BoolVarP(&phcHealthJSON, "json", "j", false, "produce json output")
+}
+
+func printPHCHealth(st phc.HealthStatus, isJSON bool) {
+	if !isJSON {
+		fmt.Println(st)
+		return
+	}
+	str, err := json.Marshal(st)
+	if err != nil {
+		log.Errorf("marshaling json: %v", err)
+		return
+	}
+	fmt.Println(string(str))
+}
+
+func phcHealthRun(m *phc.Monitor, count int, interval time.Duration, isJSON bool) error {
+	var sts []phc.HealthStatus
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		sts = m.Check()
+	}
+	var broken int
+	for _, st := range sts {
+		printPHCHealth(st, isJSON)
+		if !st.State.Healthy() {
+			broken++
+		}
+	}
+	if broken > 0 {
+		return fmt.Errorf("%d of %d PHCs are unhealthy", broken, len(sts))
+	}
+	return nil
+}
+
+var phcHealthCmd = &cobra.Command{
+	Use:   "phchealth",
+	Short: "Detect stuck or non-monotonic PHCs, like ones of NICs with hung firmware",
+	Run: func(c *cobra.Command, args []string) {
+		ConfigureVerbosity()
+		cfg := phc.HealthConfig{
+			Interval:   phcHealthInterval,
+			Threshold:  phcHealthThreshold,
+			StuckRatio: phcHealthStuckRatio,
+		}
+		onChange := func(st phc.HealthStatus) {
+			log.Infof("PHC health changed: %s", st)
+		}
+		m, err := phc.NewMonitor(cfg, phcHealthDevices, onChange)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if phcHealthCount == 0 {
+			// print every change until interrupted
+			log.Fatal(m.Run(context.Background()))
+		}
+		if err := phcHealthRun(m, phcHealthCount, phcHealthInterval, phcHealthJSON); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
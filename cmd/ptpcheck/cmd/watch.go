@@ -0,0 +1,108 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/facebook/time/cmd/ptpcheck/checker"
+	"github.com/facebook/time/cmd/ptpcheck/history"
+)
+
+// flags
+var (
+	watchIntervalFlag  time.Duration
+	watchCountFlag     int
+	watchRecordFlag    bool
+	watchHistoryFlag   string
+	watchRetentionFlag time.Duration
+)
+
+func init() {
+	RootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringVarP(&rootClientFlag, "client", "C", "", rootClientFlagDesc)
+	watchCmd.Flags().DurationVarP(&watchIntervalFlag, "interval", "i", time.Second, "interval between checks")
+	watchCmd.Flags().IntVarP(&watchCountFlag, "count", "c", 0, "stop after this many checks, 0 means run forever")
+	watchCmd.Flags().BoolVarP(&watchRecordFlag, "record", "r", false, "record every check to local history")
+	watchCmd.Flags().StringVarP(&watchHistoryFlag, "history", "H", history.DefaultDir, "directory to keep history in")
+	watchCmd.Flags().DurationVar(&watchRetentionFlag, "retention", 7*24*time.Hour, "remove history older than this, 0 means keep forever")
+}
+
+func printRecord(r *history.Record) {
+	ts := r.Time.Format(time.RFC3339)
+	switch r.State {
+	case history.StateError:
+		fmt.Printf("%s %-6s %s\n", ts, r.State, r.Error)
+	default:
+		fmt.Printf("%s %-6s GM %s offset %v path delay %v\n", ts, r.State, r.GrandmasterID, time.Duration(r.OffsetFromMaster), time.Duration(r.MeanPathDelay))
+	}
+}
+
+func runWatch(interval time.Duration, count int, store *history.Store, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+	for i := 0; count == 0 || i < count; i++ {
+		if i > 0 {
+			<-ticker.C
+		}
+		result, err := checker.RunCheck(rootClientFlag)
+		r := history.NewRecord(time.Now(), result, err)
+		printRecord(r)
+		if store == nil {
+			continue
+		}
+		if err := store.Append(r); err != nil {
+			log.Errorf("failed to record history: %v", err)
+		}
+		if retention > 0 && r.Time.Sub(lastPrune) > time.Hour {
+			if err := store.Prune(r.Time.Add(-retention)); err != nil {
+				log.Errorf("failed to remove old history: %v", err)
+			}
+			lastPrune = r.Time
+		}
+	}
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Periodically check PTP client state, optionally recording it to local history",
+	Long: `Periodically check PTP client state, printing offset, GM and state on every check.
+With --record every check is also stored in local history, which can be queried with 'ptpcheck history'
+for on-host forensics without external monitoring systems.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ConfigureVerbosity()
+
+		if watchIntervalFlag <= 0 {
+			log.Fatal("interval must be greater than zero")
+		}
+		var store *history.Store
+		if watchRecordFlag {
+			var err error
+			store, err = history.NewStore(watchHistoryFlag)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		runWatch(watchIntervalFlag, watchCountFlag, store, watchRetentionFlag)
+	},
+}
@@ -0,0 +1,206 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package history implements local on-host history of PTP client state, recorded by ptpcheck watch mode.
+Records are kept as JSON lines in flat files, one file per UTC day, so old days are removed by deleting files
+and nothing but the filesystem is needed to read them.
+*/
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/facebook/time/cmd/ptpcheck/checker"
+)
+
+// DefaultDir is where history is kept by default
+const DefaultDir = "/var/lib/ptpcheck/history"
+
+const (
+	fileSuffix = ".jsonl"
+	dayLayout  = "2006-01-02"
+)
+
+// States of PTP client recorded in history
+const (
+	StateOK    = "ok"
+	StateNoGM  = "no_gm"
+	StateError = "error"
+)
+
+// Record is a single observation of PTP client state
+type Record struct {
+	Time             time.Time `json:"time"`
+	State            string    `json:"state"`
+	Error            string    `json:"error,omitempty"`
+	GrandmasterID    string    `json:"gm,omitempty"`
+	OffsetFromMaster float64   `json:"offset_ns"`
+	MeanPathDelay    float64   `json:"path_delay_ns"`
+	StepsRemoved     int       `json:"steps_removed"`
+	IngressTimeNS    int64     `json:"ingress_time_ns,omitempty"`
+}
+
+// NewRecord turns result of a check into a record, err is the error the check failed with
+func NewRecord(t time.Time, r *checker.PTPCheckResult, err error) *Record {
+	rec := &Record{Time: t}
+	if err != nil {
+		rec.State = StateError
+		rec.Error = err.Error()
+		return rec
+	}
+	rec.State = StateOK
+	if !r.GrandmasterPresent {
+		rec.State = StateNoGM
+	}
+	rec.GrandmasterID = r.GrandmasterIdentity
+	rec.OffsetFromMaster = r.OffsetFromMasterNS
+	rec.MeanPathDelay = r.MeanPathDelayNS
+	rec.StepsRemoved = r.StepsRemoved
+	rec.IngressTimeNS = r.IngressTimeNS
+	return rec
+}
+
+// Store is a directory with history files
+type Store struct {
+	dir string
+}
+
+// NewStore returns store kept in the directory, creating it if needed
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating history dir: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) path(day time.Time) string {
+	return filepath.Join(s.dir, day.UTC().Format(dayLayout)+fileSuffix)
+}
+
+// Append adds record to the file of its day
+func (s *Store) Append(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path(r.Time), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening history file: %w", err)
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("writing history file: %w", err)
+	}
+	return f.Close()
+}
+
+// days returns days we have files for, oldest first
+func (s *Store) days() ([]time.Time, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	days := []time.Time{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		day, err := time.Parse(dayLayout, strings.TrimSuffix(name, fileSuffix))
+		if err != nil {
+			continue
+		}
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, nil
+}
+
+// readDay reads records from file of the day which are within [from, to)
+func (s *Store) readDay(day, from, to time.Time) ([]*Record, error) {
+	f, err := os.Open(s.path(day))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records := []*Record{}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		r := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			// line may be cut short if we crashed while writing it, this shouldn't make the rest of history unreadable
+			log.Warningf("skipping malformed history record %s:%d: %v", f.Name(), line, err)
+			continue
+		}
+		if r.Time.Before(from) || !r.Time.Before(to) {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// Query returns records within [from, to), oldest first
+func (s *Store) Query(from, to time.Time) ([]*Record, error) {
+	days, err := s.days()
+	if err != nil {
+		return nil, err
+	}
+	records := []*Record{}
+	firstDay := from.UTC().Truncate(24 * time.Hour)
+	for _, day := range days {
+		if day.Before(firstDay) || !day.Before(to) {
+			continue
+		}
+		r, err := s.readDay(day, from, to)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r...)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// Prune removes files of days which ended before the cutoff
+func (s *Store) Prune(before time.Time) error {
+	days, err := s.days()
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if !day.Add(24 * time.Hour).After(before) {
+			if err := os.Remove(s.path(day)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/cmd/ptpcheck/checker"
+)
+
+func TestNewRecord(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	r := NewRecord(now, &checker.PTPCheckResult{
+		GrandmasterPresent:  true,
+		GrandmasterIdentity: "001122.fffe.334455",
+		OffsetFromMasterNS:  -12.5,
+		MeanPathDelayNS:     300,
+		StepsRemoved:        1,
+	}, nil)
+	require.Equal(t, &Record{
+		Time:             now,
+		State:            StateOK,
+		GrandmasterID:    "001122.fffe.334455",
+		OffsetFromMaster: -12.5,
+		MeanPathDelay:    300,
+		StepsRemoved:     1,
+	}, r)
+
+	r = NewRecord(now, &checker.PTPCheckResult{}, nil)
+	require.Equal(t, StateNoGM, r.State)
+
+	r = NewRecord(now, nil, fmt.Errorf("connection refused"))
+	require.Equal(t, StateError, r.State)
+	require.Equal(t, "connection refused", r.Error)
+}
+
+func TestStoreAppendQuery(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(filepath.Join(dir, "history"))
+	require.NoError(t, err)
+
+	start := time.Date(2023, 3, 1, 23, 59, 58, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, s.Append(&Record{Time: start.Add(time.Duration(i) * time.Second), State: StateOK, OffsetFromMaster: float64(i)}))
+	}
+	days, err := s.days()
+	require.NoError(t, err)
+	require.Len(t, days, 2, "records are split by UTC day")
+
+	records, err := s.Query(start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	for i, r := range records {
+		require.Equal(t, float64(i), r.OffsetFromMaster)
+	}
+
+	records, err = s.Query(start.Add(time.Second), start.Add(3*time.Second))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, float64(1), records[0].OffsetFromMaster)
+	require.Equal(t, float64(2), records[1].OffsetFromMaster)
+
+	records, err = s.Query(start.Add(time.Hour), start.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, records)
+}
+
+func TestStoreSkipsMalformed(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, s.Append(&Record{Time: now, State: StateOK}))
+	f, err := os.OpenFile(s.path(now), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"time":"2023-03`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	records, err := s.Query(now, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+}
+
+func TestStorePrune(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	day1 := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	require.NoError(t, s.Append(&Record{Time: day1, State: StateOK}))
+	require.NoError(t, s.Append(&Record{Time: day2, State: StateOK}))
+	// unrelated files are left alone
+	require.NoError(t, os.WriteFile(filepath.Join(s.dir, "notes.txt"), nil, 0644))
+
+	require.NoError(t, s.Prune(day2))
+	days, err := s.days()
+	require.NoError(t, err)
+	require.Len(t, days, 1)
+	require.Equal(t, "2023-03-02", days[0].Format(dayLayout))
+	_, err = os.Stat(filepath.Join(s.dir, "notes.txt"))
+	require.NoError(t, err)
+}
+
+func TestPlot(t *testing.T) {
+	start := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	records := []*Record{}
+	for i := 0; i < 10; i++ {
+		r := &Record{Time: start.Add(time.Duration(i) * time.Second), State: StateOK, OffsetFromMaster: float64(i * 100)}
+		if i == 5 {
+			r.State = StateNoGM
+		}
+		records = append(records, r)
+	}
+	var b bytes.Buffer
+	Plot(&b, records, 10, 4)
+	lines := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+	require.Len(t, lines, 7)
+	require.Equal(t, "Offset from master:", lines[0])
+	require.Equal(t, "900ns |        **", lines[1])
+	require.Equal(t, "   0s |**   x    ", lines[4])
+	require.Contains(t, lines[6], "2023-03-01T12:00:00Z")
+	require.Contains(t, lines[6], "2023-03-01T12:00:09Z")
+
+	b.Reset()
+	Plot(&b, nil, 10, 4)
+	require.Equal(t, "No history records\n", b.String())
+}
+
+func TestChanges(t *testing.T) {
+	start := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	records := []*Record{
+		{Time: start, State: StateOK, GrandmasterID: "a"},
+		{Time: start.Add(time.Second), State: StateOK, GrandmasterID: "a"},
+		{Time: start.Add(2 * time.Second), State: StateError, Error: "timeout"},
+		{Time: start.Add(3 * time.Second), State: StateOK, GrandmasterID: "b"},
+	}
+	var b bytes.Buffer
+	Changes(&b, records)
+	require.Equal(t, `2023-03-01T12:00:00Z ok GM a
+2023-03-01T12:00:02Z error: timeout
+2023-03-01T12:00:03Z ok GM b
+`, b.String())
+}
@@ -0,0 +1,140 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// column is a summary of records falling into one column of the plot
+type column struct {
+	min, max float64
+	samples  int
+	// some records in the column are not usable
+	bad bool
+}
+
+// columns buckets records by time into width columns
+func columns(records []*Record, width int) []column {
+	cols := make([]column, width)
+	for i := range cols {
+		cols[i].min = math.Inf(1)
+		cols[i].max = math.Inf(-1)
+	}
+	first := records[0].Time
+	span := records[len(records)-1].Time.Sub(first)
+	for _, r := range records {
+		i := 0
+		if span > 0 {
+			i = int(int64(width-1) * int64(r.Time.Sub(first)) / int64(span))
+		}
+		c := &cols[i]
+		if r.State != StateOK {
+			c.bad = true
+			continue
+		}
+		c.min = math.Min(c.min, r.OffsetFromMaster)
+		c.max = math.Max(c.max, r.OffsetFromMaster)
+		c.samples++
+	}
+	return cols
+}
+
+// Plot draws offset from master over time, in width x height characters.
+// Each column shows range of offsets within its time slice, columns where client had no GM or check failed are marked with 'x'
+func Plot(w io.Writer, records []*Record, width, height int) {
+	if len(records) == 0 {
+		fmt.Fprintln(w, "No history records")
+		return
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 2 {
+		height = 2
+	}
+	cols := columns(records, width)
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, c := range cols {
+		if c.samples > 0 {
+			low = math.Min(low, c.min)
+			high = math.Max(high, c.max)
+		}
+	}
+	// row of the value, 0 is the top one
+	row := func(v float64) int {
+		if high == low {
+			return height / 2
+		}
+		return int(math.Round((high - v) / (high - low) * float64(height-1)))
+	}
+	grid := make([][]byte, height)
+	for i := range grid {
+		grid[i] = []byte(strings.Repeat(" ", width))
+	}
+	for x, c := range cols {
+		if c.samples > 0 {
+			for y := row(c.max); y <= row(c.min); y++ {
+				grid[y][x] = '*'
+			}
+		}
+		if c.bad {
+			grid[height-1][x] = 'x'
+		}
+	}
+	if math.IsInf(low, 0) {
+		low, high = 0, 0
+	}
+	labels := make([]string, height)
+	labels[0] = time.Duration(high).String()
+	labels[height-1] = time.Duration(low).String()
+	labelWidth := 0
+	for _, l := range labels {
+		if len(l) > labelWidth {
+			labelWidth = len(l)
+		}
+	}
+	fmt.Fprintln(w, "Offset from master:")
+	for y := range grid {
+		fmt.Fprintf(w, "%*s |%s\n", labelWidth, labels[y], grid[y])
+	}
+	fmt.Fprintf(w, "%*s +%s\n", labelWidth, "", strings.Repeat("-", width))
+	first := records[0].Time.Format(time.RFC3339)
+	last := records[len(records)-1].Time.Format(time.RFC3339)
+	fmt.Fprintf(w, "%*s  %s%*s\n", labelWidth, "", first, width-len(first), last)
+}
+
+// Changes describes periods of history between changes of GM or client state
+func Changes(w io.Writer, records []*Record) {
+	var prev *Record
+	for _, r := range records {
+		if prev != nil && prev.State == r.State && prev.GrandmasterID == r.GrandmasterID {
+			continue
+		}
+		switch r.State {
+		case StateError:
+			fmt.Fprintf(w, "%s %s: %s\n", r.Time.Format(time.RFC3339), r.State, r.Error)
+		default:
+			fmt.Fprintf(w, "%s %s GM %s\n", r.Time.Format(time.RFC3339), r.State, r.GrandmasterID)
+		}
+		prev = r
+	}
+}
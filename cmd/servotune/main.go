@@ -0,0 +1,183 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/facebook/time/ptp/sptp/client"
+	"github.com/facebook/time/servo"
+)
+
+func parseScales(s string) ([]float64, error) {
+	scales := []float64{}
+	for _, v := range strings.Split(s, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %w", v, err)
+		}
+		if f <= 0 {
+			return nil, fmt.Errorf("scale must be positive, got %v", f)
+		}
+		scales = append(scales, f)
+	}
+	return scales, nil
+}
+
+// readFilters returns candidate filter parameters: none, sptp defaults, both, or list read from JSON file
+func readFilters(filter string) ([]*servo.FilterParams, error) {
+	switch filter {
+	case "none":
+		return []*servo.FilterParams{nil}, nil
+	case "default":
+		return []*servo.FilterParams{servo.DefaultFilterParams()}, nil
+	case "both":
+		return []*servo.FilterParams{nil, servo.DefaultFilterParams()}, nil
+	}
+	b, err := os.ReadFile(filter)
+	if err != nil {
+		return nil, err
+	}
+	filters := []*servo.FilterParams{}
+	if err := json.Unmarshal(b, &filters); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filter, err)
+	}
+	return filters, nil
+}
+
+// readTrace reads measurement logs, oldest first, and reconstructs free-running clock offsets from them
+func readTrace(paths []string) ([]servo.SimSample, error) {
+	entries := []*client.MeasurementLogEntry{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		e, err := client.ReadMeasurementLog(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		entries = append(entries, e...)
+	}
+	return client.MeasurementLogTrace(entries), nil
+}
+
+func filterName(f *servo.FilterParams) string {
+	if f == nil {
+		return "none"
+	}
+	return fmt.Sprintf("ring=%d skip=%d stdev=%.1f/%.1f", f.RingSize, f.MaxSkipCount, f.OffsetStdevFactor, f.FreqStdevFactor)
+}
+
+func writeText(results []*servo.SimResult) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KP SCALE\tKI SCALE\tFILTER\tLOCKED AT\tRMS(ns)\tMAX(ns)\tSTEPS\tRESETS")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%.4f\t%.4f\t%s\t%d\t%.1f\t%d\t%d\t%d\n",
+			r.Config.KpScale, r.Config.KiScale, filterName(r.Config.Filter), r.LockedAt, r.RMS, r.MaxAbs, r.Steps, r.Resets)
+	}
+	return tw.Flush()
+}
+
+func main() {
+	var (
+		intervalFlag           time.Duration
+		firstStepThresholdFlag time.Duration
+		kpFlag                 string
+		kiFlag                 string
+		filterFlag             string
+		refineFlag             int
+		topFlag                int
+		formatFlag             string
+	)
+
+	flag.DurationVar(&intervalFlag, "interval", time.Second, "sync interval sptp was running with when recording the log")
+	flag.DurationVar(&firstStepThresholdFlag, "firststepthreshold", 0, "step the clock on first update if offset is larger than this, 0 means never")
+	flag.StringVar(&kpFlag, "kp", "0.1,0.3,0.5,0.7,0.9,1.2", "comma-separated list of candidate proportional scales")
+	flag.StringVar(&kiFlag, "ki", "0.05,0.1,0.2,0.3,0.5,0.7", "comma-separated list of candidate integral scales")
+	flag.StringVar(&filterFlag, "filter", "default", "candidate servo filters: none, default, both, or path to JSON list of filter params")
+	flag.IntVar(&refineFlag, "refine", 0, "refine the best grid result with this many more simulations, 0 means no refinement")
+	flag.IntVar(&topFlag, "top", 10, "how many best configurations to print, 0 means all")
+	flag.StringVar(&formatFlag, "format", "text", "output format, one of text or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] measurement.log.N ... measurement.log\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	// servo warns on every filtered sample, which is noise here
+	log.SetLevel(log.ErrorLevel)
+	if formatFlag != "text" && formatFlag != "json" {
+		log.Fatalf("unsupported format %q", formatFlag)
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	kpScales, err := parseScales(kpFlag)
+	if err != nil {
+		log.Fatalf("bad -kp: %v", err)
+	}
+	kiScales, err := parseScales(kiFlag)
+	if err != nil {
+		log.Fatalf("bad -ki: %v", err)
+	}
+	filters, err := readFilters(filterFlag)
+	if err != nil {
+		log.Fatalf("bad -filter: %v", err)
+	}
+	trace, err := readTrace(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(trace) < 2 {
+		log.Fatalf("not enough servo samples in the logs: %d", len(trace))
+	}
+
+	results := servo.Tune(trace, intervalFlag, int64(firstStepThresholdFlag), servo.GridConfigs(kpScales, kiScales, filters))
+	if refineFlag > 0 {
+		best := servo.Refine(trace, intervalFlag, int64(firstStepThresholdFlag), results[0].Config, refineFlag)
+		if best.Better(results[0]) {
+			results = append([]*servo.SimResult{best}, results...)
+		}
+	}
+	if topFlag > 0 && len(results) > topFlag {
+		results = results[:topFlag]
+	}
+	switch formatFlag {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	default:
+		err = writeText(results)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
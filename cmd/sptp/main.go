@@ -18,9 +18,11 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -59,10 +61,37 @@ func doWork(cfg *client.Config) error {
 	if err != nil {
 		return err
 	}
+	stats.SetBurster(p)
+	stats.SetCapturer(p)
+	stats.SetMaintainer(p)
 	ctx := context.Background()
 	return p.Run(ctx)
 }
 
+// doOneShot runs single exchange with all GMs and prints results. Returns error if no GM is reachable
+func doOneShot(cfg *client.Config, format string) error {
+	p, err := client.NewSPTP(cfg, client.NewJSONStats())
+	if err != nil {
+		return err
+	}
+	results := p.RunOneShot(context.Background())
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	default:
+		err = client.WriteOneShotText(os.Stdout, results)
+	}
+	if err != nil {
+		return err
+	}
+	if client.OneShotReachable(results) == 0 {
+		return fmt.Errorf("none of %d GMs is reachable", len(results))
+	}
+	return nil
+}
+
 func main() {
 	var (
 		verboseFlag        bool
@@ -72,6 +101,8 @@ func main() {
 		dscpFlag           int
 		configFlag         string
 		pprofFlag          string
+		oneShotFlag        bool
+		formatFlag         string
 	)
 
 	flag.BoolVar(&verboseFlag, "verbose", false, "verbose output")
@@ -81,6 +112,8 @@ func main() {
 	flag.IntVar(&dscpFlag, "dscp", 0, "DSCP for PTP packets, valid values are between 0-63 (used by send workers)")
 	flag.DurationVar(&intervalFlag, "interval", time.Second, "how often to send DelayReq to each GM")
 	flag.StringVar(&pprofFlag, "pprof", "", "Address to have the profiler listen on, disabled if empty.")
+	flag.BoolVar(&oneShotFlag, "oneshot", false, "run single exchange with all GMs, print results and exit. Exits with non-zero code if no GM is reachable")
+	flag.StringVar(&formatFlag, "format", "text", "output format for -oneshot, one of text or json")
 
 	flag.Parse()
 
@@ -92,6 +125,18 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := client.ApplyLoggingConfig(&cfg.Logging); err != nil {
+		log.Fatal(err)
+	}
+	if oneShotFlag {
+		if formatFlag != "text" && formatFlag != "json" {
+			log.Fatalf("unsupported format %q", formatFlag)
+		}
+		if err := doOneShot(cfg, formatFlag); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if pprofFlag != "" {
 		go func() {
 			err = http.ListenAndServe(pprofFlag, nil)
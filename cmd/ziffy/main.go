@@ -46,6 +46,16 @@ How to determine if a switch is operating as PTP TC?
 	If (Switch4.CorrectionField - Switch3.CorrectionField < threshold) then Switch3 did not modify the CorrectionField,
 	so it is not a Transparent Clock.
 
+How to find switches re-marking PTP traffic?
+
+	With -dscps Ziffy repeats the sweep for each DSCP value in the list and prints a per hop comparison.
+	Every switch returns the probe it dropped, so Ziffy can see which DSCP the probe had when it reached the switch.
+
+How to check TCs on L2 only networks?
+
+	With -transport l2 Ziffy sends PTP over IEEE 802.3 to the MAC address of a Ziffy receiver running with
+	the same flag. There is no hop limit on L2, so only the correction accumulated over the whole path is reported.
+
 Flags:
 `
 
@@ -54,6 +64,7 @@ func main() {
 
 	var messageType string
 	var nsCFThreshold int
+	var dscps string
 
 	flag.Usage = func() {
 		fmt.Fprint(flag.CommandLine.Output(), doc)
@@ -66,7 +77,7 @@ func main() {
 	flag.IntVar(&c.HopMax, "maxhop", 7, "max number of hops (used by sender)")
 	flag.IntVar(&c.HopMin, "minhop", 1, "min number of hops (used by sender)")
 	flag.DurationVar(&c.IcmpTimeout, "icmptime", 1*time.Second, "max timeout to wait for icmp packets (used by sender)")
-	flag.StringVar(&c.DestinationAddress, "addr", "", "IP address of receiver (used by sender)")
+	flag.StringVar(&c.DestinationAddress, "addr", "", "IP address of receiver, MAC address with -transport l2 (used by sender)")
 	flag.IntVar(&c.DestinationPort, "dp", ptp.PortEvent, "destination port to send packets to")
 	flag.IntVar(&c.SourcePort, "sp", 32768, "the base source port to start probing (used by sender)")
 	flag.IntVar(&c.PortCount, "portcount", 1, "port count to be used for probing each target ip (used by sender)")
@@ -75,6 +86,8 @@ func main() {
 	flag.BoolVar(&c.ContReached, "continue", false, "continue incrementing hop count after destination host responds (used by sender)")
 	flag.IntVar(&c.IPCount, "ipcount", 0, "number of additional IPs targeted in the same /64 prefix as destination to increase hashing entropy (used by sender)")
 	flag.IntVar(&c.DSCP, "dscp", 0, "DSCP for PTP packets, valid values are between 0-63 (used by sender)")
+	flag.StringVar(&dscps, "dscps", "", "comma separated list or ranges of DSCP values to compare, e.g. 0,8-10,46. Overrides -dscp (used by sender)")
+	flag.StringVar(&c.Transport, "transport", node.TransportUDP, "transport to send probes over. Can be 'udp' (default) or 'l2'. With 'l2' -addr is MAC address of receiver")
 	flag.DurationVar(&c.LLDPWaitTime, "lldptime", 5*time.Second, "max timeout to wait for LLDP packets (used by sender)")
 	flag.IntVar(&c.QueueCap, "qcap", 10000, "ICMP queue capacity (used by sender)")
 	flag.DurationVar(&c.IcmpReplyTime, "replytime", 1*time.Second, "waiting time for late icmp packets (used by sender)")
@@ -90,6 +103,17 @@ func main() {
 		log.Fatalf("unsupported DSCP value %v", c.DSCP)
 	}
 
+	if dscps != "" {
+		var err error
+		if c.DSCPs, err = node.ParseDSCPs(dscps); err != nil {
+			log.Fatalf("unsupported DSCP list %q: %v", dscps, err)
+		}
+	}
+
+	if c.Transport != node.TransportUDP && c.Transport != node.TransportL2 {
+		log.Fatalf("unsupported transport %q", c.Transport)
+	}
+
 	if c.IcmpTimeout < 100*time.Millisecond {
 		log.Warnf("setting timeout < 100ms for ICMP replies may lead to inaccurate results")
 	}
@@ -147,6 +171,9 @@ func main() {
 		}
 
 		node.PrettyPrint(c, info, ptp.NewCorrection(float64(nsCFThreshold)))
+		if len(s.Config.DSCPs) > 0 {
+			node.DSCPPrint(info)
+		}
 		if s.Config.CsvFile != "" {
 			node.CsvPrint(c, info, s.Config.CsvFile, ptp.NewCorrection(float64(nsCFThreshold)))
 		}
@@ -17,6 +17,9 @@ limitations under the License.
 package node
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
@@ -35,6 +38,14 @@ const (
 	PTPUnusedSize = 10
 )
 
+// Supported transports
+const (
+	// TransportUDP probes the path with PTP over UDP over IPv6, switch by switch
+	TransportUDP = "udp"
+	// TransportL2 probes the path with PTP over IEEE 802.3, end to end
+	TransportL2 = "l2"
+)
+
 // Config is the Ziffy config struct
 type Config struct {
 	Mode               string
@@ -49,6 +60,8 @@ type Config struct {
 	HopMin             int
 	IPCount            int
 	DSCP               int
+	DSCPs              []int
+	Transport          string
 	PTPRecvHandlers    int
 	ContReached        bool
 	IcmpTimeout        time.Duration
@@ -62,6 +75,48 @@ type Config struct {
 	QueueCap int
 }
 
+// ParseDSCPs parses comma separated list of DSCP values and ranges, like "0,8-10,46"
+func ParseDSCPs(s string) ([]int, error) {
+	res := []int{}
+	seen := map[int]bool{}
+	add := func(v int) error {
+		if v < 0 || v > 63 {
+			return fmt.Errorf("unsupported DSCP value %d", v)
+		}
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+		return nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("parsing DSCP %q: %w", part, err)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(to); err != nil {
+				return nil, fmt.Errorf("parsing DSCP %q: %w", part, err)
+			}
+		}
+		if hi < lo {
+			return nil, fmt.Errorf("invalid DSCP range %q", part)
+		}
+		for v := lo; v <= hi; v++ {
+			if err := add(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
 // SwitchPrintInfo contains print information for switches
 type SwitchPrintInfo struct {
 	ip        string
@@ -85,10 +140,16 @@ type SwitchTrafficInfo struct {
 	corrField ptp.Correction
 	routeIdx  int
 	hop       int
+	// DSCP of the probe as seen by the switch, -1 if unknown
+	dscp int
+	// time between sending the probe and getting the reply
+	rtt time.Duration
 }
 
 // PathInfo contains the list of switches in a path
 type PathInfo struct {
 	switches       []SwitchTrafficInfo
 	rackSwHostname string
+	// DSCP probes along this path were sent with
+	dscp int
 }
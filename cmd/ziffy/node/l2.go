@@ -0,0 +1,204 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// PTPEtherTypeStr Ether type string
+const PTPEtherTypeStr = "0x88f7"
+
+// newL2Socket opens packet socket for PTP ethertype bound to device
+func newL2Socket(device string) (int, int, error) {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return -1, 0, fmt.Errorf("unable to find interface %q: %w", device, err)
+	}
+	// SOCK_DGRAM so kernel builds and strips Ethernet header for us
+	connFd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM, int(timestamp.Htons(unix.ETH_P_1588)))
+	if err != nil {
+		return -1, 0, fmt.Errorf("unable to create packet socket: %w", err)
+	}
+	if err := unix.Bind(connFd, &unix.SockaddrLinklayer{Protocol: timestamp.Htons(unix.ETH_P_1588), Ifindex: iface.Index}); err != nil {
+		unix.Close(connFd)
+		return -1, 0, fmt.Errorf("unable to bind packet socket to %q: %w", device, err)
+	}
+	return connFd, iface.Index, nil
+}
+
+// l2Sockaddr builds destination address for packet socket
+func l2Sockaddr(ifindex int, mac net.HardwareAddr) *unix.SockaddrLinklayer {
+	sa := &unix.SockaddrLinklayer{
+		Protocol: timestamp.Htons(unix.ETH_P_1588),
+		Ifindex:  ifindex,
+		Halen:    uint8(len(mac)),
+	}
+	copy(sa.Addr[:], mac)
+	return sa
+}
+
+// parseL2Reply checks that the frame is a ziffy reply from mac and returns the PTP header of the probe
+func parseL2Reply(b []byte, sa unix.Sockaddr, mac net.HardwareAddr) (*ptp.Header, error) {
+	ll, ok := sa.(*unix.SockaddrLinklayer)
+	if !ok {
+		return nil, fmt.Errorf("not a link layer address")
+	}
+	// packet socket sees our own probes as well
+	if ll.Pkttype == unix.PACKET_OUTGOING {
+		return nil, fmt.Errorf("outgoing packet")
+	}
+	if net.HardwareAddr(ll.Addr[:ll.Halen]).String() != mac.String() {
+		return nil, fmt.Errorf("packet from unexpected address %v", net.HardwareAddr(ll.Addr[:ll.Halen]))
+	}
+	p, err := ptp.DecodePacket(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode ptp packet: %w", err)
+	}
+	var h *ptp.Header
+	switch v := p.(type) {
+	case *ptp.SyncDelayReq:
+		h = &v.Header
+	case *ptp.Signaling:
+		h = &v.Header
+	default:
+		return nil, fmt.Errorf("unexpected packet %T", v)
+	}
+	if h.ControlField != ZiffyHexa {
+		return nil, fmt.Errorf("no ziffy packet")
+	}
+	return h, nil
+}
+
+// startL2 probes the path to DestinationAddress MAC with PTP over IEEE 802.3.
+// There is no hop limit on L2, so each probe reports correction accumulated by all TCs on the way to the receiver and back.
+func (s *Sender) startL2() ([]PathInfo, error) {
+	dst, err := net.ParseMAC(s.Config.DestinationAddress)
+	if err != nil {
+		return nil, fmt.Errorf("%s transport requires MAC address of receiver: %w", TransportL2, err)
+	}
+	if len(s.Config.DSCPs) > 0 {
+		log.Warnf("DSCP sweep is not supported by %s transport, ignoring", TransportL2)
+	}
+	connFd, ifindex, err := newL2Socket(s.Config.Device)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(connFd)
+	tv := unix.NsecToTimeval(s.Config.IcmpTimeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(connFd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return nil, fmt.Errorf("setting SO_RCVTIMEO on sender socket: %w", err)
+	}
+	dstAddr := l2Sockaddr(ifindex, dst)
+
+	log.Infof("sending %v flows of PTP %v packets to %v over %s with a per probe timeout of %v.\n\n",
+		s.Config.PortCount, s.Config.MessageType, dst, TransportL2, s.Config.IcmpTimeout)
+
+	buf := make([]byte, 1024)
+	for i := 0; i < s.Config.PortCount; i++ {
+		s.routes = append(s.routes, PathInfo{switches: nil, dscp: -1})
+		// there is only one hop as far as we can see
+		hop := 1
+		var p ptp.Packet
+		switch s.Config.MessageType {
+		case ptp.MessageSync, ptp.MessageDelayReq:
+			p = formSyncPacket(s.Config.MessageType, hop, s.currentRoute)
+		case ptp.MessageSignaling:
+			p = formSignalingPacket(hop, s.currentRoute)
+		default:
+			return nil, fmt.Errorf("unsupported packet type %v", s.Config.MessageType)
+		}
+		s.markSent(s.currentRoute, hop, time.Now())
+		if err := s.sendEventMsg(p, connFd, dstAddr); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(s.Config.IcmpTimeout)
+		for time.Now().Before(deadline) {
+			n, sa, err := unix.Recvfrom(connFd, buf, 0)
+			if err != nil {
+				if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+					continue
+				}
+				return nil, fmt.Errorf("unable to read reply: %w", err)
+			}
+			received := time.Now()
+			h, err := parseL2Reply(buf[:n], sa, dst)
+			if err != nil {
+				log.Tracef("ignoring packet: %v", err)
+				continue
+			}
+			if int(h.SourcePortIdentity.PortNumber) != s.currentRoute {
+				log.Tracef("ignoring late reply for flow %d", h.SourcePortIdentity.PortNumber)
+				continue
+			}
+			s.routes[s.currentRoute].switches = append(s.routes[s.currentRoute].switches, SwitchTrafficInfo{
+				ip:        dst.String(),
+				corrField: h.CorrectionField,
+				hop:       hop,
+				routeIdx:  s.currentRoute,
+				dscp:      -1,
+				rtt:       s.rtt(s.currentRoute, hop, received),
+			})
+			log.Debugf("%v cf: %v flow: %v", dst, h.CorrectionField, s.currentRoute)
+			break
+		}
+		s.currentRoute++
+	}
+	return s.clearPaths(), nil
+}
+
+// handleL2Packet reflects ziffy probe received over IEEE 802.3 back to the sender
+func (r *Receiver) handleL2Packet(rawPacket gopacket.Packet) {
+	eth, ok := rawPacket.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	if !ok {
+		log.Tracef("unable to parse Ethernet Header")
+		return
+	}
+	p, err := ptp.DecodePacket(eth.Payload)
+	if err != nil {
+		log.Tracef("unable to decode ptp packet: %v", err)
+		return
+	}
+	var h *ptp.Header
+	switch v := p.(type) {
+	case *ptp.SyncDelayReq:
+		h = &v.Header
+	case *ptp.Signaling:
+		h = &v.Header
+	default:
+		log.Tracef("unexpected packet %T", v)
+		return
+	}
+	if h.ControlField != ZiffyHexa {
+		log.Tracef("no ziffy packet")
+		return
+	}
+	log.Debugf("Type=%v, CF=%v, sPort=%v, sMAC=%v", h.MessageType().String(), h.CorrectionField, h.SourcePortIdentity.PortNumber, eth.SrcMAC)
+	if err := unix.Sendto(r.l2Fd, eth.Payload, 0, l2Sockaddr(r.l2Ifindex, eth.SrcMAC)); err != nil {
+		log.Tracef("unable to send response: %v", err)
+	}
+}
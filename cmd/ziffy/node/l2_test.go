@@ -0,0 +1,70 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"net"
+	"testing"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestL2Sockaddr(t *testing.T) {
+	mac, err := net.ParseMAC("0c:42:a1:6d:7c:a6")
+	require.NoError(t, err)
+	sa := l2Sockaddr(3, mac)
+	require.Equal(t, 3, sa.Ifindex)
+	require.Equal(t, uint16(0xf788), sa.Protocol)
+	require.Equal(t, uint8(6), sa.Halen)
+	require.Equal(t, [8]byte{0x0c, 0x42, 0xa1, 0x6d, 0x7c, 0xa6}, sa.Addr)
+}
+
+func TestParseL2Reply(t *testing.T) {
+	mac, err := net.ParseMAC("0c:42:a1:6d:7c:a6")
+	require.NoError(t, err)
+	other, err := net.ParseMAC("0c:42:a1:6d:7c:a7")
+	require.NoError(t, err)
+
+	p := formSyncPacket(ptp.MessageSync, 1, 5)
+	p.CorrectionField = ptp.NewCorrection(1234)
+	b, err := ptp.Bytes(p)
+	require.NoError(t, err)
+
+	h, err := parseL2Reply(b, l2Sockaddr(1, mac), mac)
+	require.NoError(t, err)
+	require.Equal(t, uint16(5), h.SourcePortIdentity.PortNumber)
+	require.Equal(t, ptp.NewCorrection(1234), h.CorrectionField)
+
+	_, err = parseL2Reply(b, l2Sockaddr(1, other), mac)
+	require.Error(t, err)
+
+	outgoing := l2Sockaddr(1, mac)
+	outgoing.Pkttype = unix.PACKET_OUTGOING
+	_, err = parseL2Reply(b, outgoing, mac)
+	require.Error(t, err)
+
+	_, err = parseL2Reply(b, &unix.SockaddrInet6{}, mac)
+	require.Error(t, err)
+
+	p.ControlField = 0
+	b, err = ptp.Bytes(p)
+	require.NoError(t, err)
+	_, err = parseL2Reply(b, l2Sockaddr(1, mac), mac)
+	require.Error(t, err)
+}
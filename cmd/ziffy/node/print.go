@@ -24,6 +24,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/olekukonko/tablewriter"
@@ -51,6 +52,27 @@ type keyPair struct {
 	hop  int
 }
 
+type dscpKey struct {
+	host string
+	hop  int
+	dscp int
+}
+
+// DSCPPrintInfo contains per class print information for switches
+type DSCPPrintInfo struct {
+	ip       string
+	hostname string
+	hop      int
+	dscp     int
+	probes   int
+	remarked int
+	// how many times probe was seen with each DSCP value
+	seen     map[int]int
+	totalRTT time.Duration
+	rtts     int
+	totalCF  ptp.Correction
+}
+
 func min(x int, y int) int {
 	if x < y {
 		return x
@@ -328,3 +350,107 @@ func CsvPrint(c *Config, routes []PathInfo, path string, cfThreshold ptp.Correct
 		}
 	}
 }
+
+// computeDSCPInfo groups probes by switch and DSCP they were sent with
+func computeDSCPInfo(routes []PathInfo) map[dscpKey]*DSCPPrintInfo {
+	discovered := make(map[dscpKey]*DSCPPrintInfo)
+	for _, route := range routes {
+		for _, swh := range route.switches {
+			host := getHostNoPrefix(swh.ip)
+			if swh.hop == 1 && route.rackSwHostname != "" {
+				host = route.rackSwHostname
+			}
+			key := dscpKey{host: host, hop: swh.hop, dscp: route.dscp}
+			info := discovered[key]
+			if info == nil {
+				info = &DSCPPrintInfo{
+					ip:       swh.ip,
+					hostname: host,
+					hop:      swh.hop,
+					dscp:     route.dscp,
+					seen:     map[int]int{},
+				}
+				discovered[key] = info
+			}
+			info.probes++
+			info.totalCF += swh.corrField
+			if swh.dscp >= 0 {
+				info.seen[swh.dscp]++
+				if swh.dscp != route.dscp {
+					info.remarked++
+				}
+			}
+			if swh.rtt > 0 {
+				info.totalRTT += swh.rtt
+				info.rtts++
+			}
+		}
+	}
+	return discovered
+}
+
+// seenDSCP returns DSCP values switch has seen, most frequent first
+func (i *DSCPPrintInfo) seenDSCP() string {
+	values := make([]int, 0, len(i.seen))
+	for v := range i.seen {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(a, b int) bool {
+		if i.seen[values[a]] == i.seen[values[b]] {
+			return values[a] < values[b]
+		}
+		return i.seen[values[a]] > i.seen[values[b]]
+	})
+	res := make([]string, 0, len(values))
+	for _, v := range values {
+		res = append(res, strconv.Itoa(v))
+	}
+	return strings.Join(res, ",")
+}
+
+func computeDSCPPrintData(info map[dscpKey]*DSCPPrintInfo) [][]string {
+	aux := make([]*DSCPPrintInfo, 0, len(info))
+	for _, val := range info {
+		aux = append(aux, val)
+	}
+	sort.Slice(aux, func(i, j int) bool {
+		if aux[i].hop != aux[j].hop {
+			return aux[i].hop < aux[j].hop
+		}
+		if aux[i].hostname != aux[j].hostname {
+			return aux[i].hostname < aux[j].hostname
+		}
+		return aux[i].dscp < aux[j].dscp
+	})
+
+	ret := [][]string{
+		{"hop", "ip_address", "hostname", "dscp", "seen_dscp", "remarked", "probes", "avg_RTT(us)", "avg_total_CF(ns)"},
+	}
+	for _, val := range aux {
+		rttDisplay := ""
+		if val.rtts > 0 {
+			rttDisplay = strconv.FormatFloat(float64((val.totalRTT/time.Duration(val.rtts)).Nanoseconds())/1000, 'f', 3, 64)
+		}
+		avgCF := val.totalCF / ptp.Correction(val.probes)
+		ret = append(ret, []string{strconv.Itoa(val.hop), val.ip, val.hostname, strconv.Itoa(val.dscp), val.seenDSCP(),
+			strconv.Itoa(val.remarked), strconv.Itoa(val.probes), rttDisplay, strconv.FormatFloat(avgCF.Nanoseconds(), 'f', 4, 64)})
+	}
+	return ret
+}
+
+// DSCPPrint prints per hop comparison of probes sent with different DSCP values.
+// Switches which see probes with DSCP other than what we sent are re-marking PTP traffic.
+func DSCPPrint(routes []PathInfo) {
+	data := computeDSCPPrintData(computeDSCPInfo(routes))
+	for _, val := range data[1:] {
+		if val[5] != "0" {
+			log.Warnf("%v (hop %v) sees probes sent with DSCP %v as %v", val[2], val[0], val[3], val[4])
+		}
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetColWidth(maxColWidth)
+	table.SetHeader(data[0])
+	table.AppendBulk(data[1:])
+	table.Render()
+}
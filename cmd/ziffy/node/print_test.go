@@ -19,6 +19,7 @@ package node
 import (
 	"strconv"
 	"testing"
+	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/stretchr/testify/require"
@@ -144,3 +145,48 @@ func TestColNumber(t *testing.T) {
 	require.NotNil(t, err)
 	require.Equal(t, -1, nr)
 }
+
+func TestComputeDSCPInfo(t *testing.T) {
+	routes := []PathInfo{
+		{
+			dscp: 0,
+			switches: []SwitchTrafficInfo{
+				{ip: "sw1", hop: 1, dscp: 0, rtt: 100 * time.Microsecond, corrField: ptp.NewCorrection(100)},
+				{ip: "sw2", hop: 2, dscp: 0, rtt: 200 * time.Microsecond, corrField: ptp.NewCorrection(200)},
+			},
+		},
+		{
+			dscp: 46,
+			switches: []SwitchTrafficInfo{
+				{ip: "sw1", hop: 1, dscp: 46, rtt: 100 * time.Microsecond, corrField: ptp.NewCorrection(100)},
+				{ip: "sw2", hop: 2, dscp: 0, rtt: 300 * time.Microsecond, corrField: ptp.NewCorrection(300)},
+			},
+		},
+		{
+			dscp: 46,
+			switches: []SwitchTrafficInfo{
+				{ip: "sw1", hop: 1, dscp: 46, rtt: 300 * time.Microsecond, corrField: ptp.NewCorrection(300)},
+				{ip: "sw2", hop: 2, dscp: -1},
+			},
+		},
+	}
+	info := computeDSCPInfo(routes)
+	require.Equal(t, 4, len(info))
+
+	sw1 := info[dscpKey{host: "sw1", hop: 1, dscp: 46}]
+	require.Equal(t, 2, sw1.probes)
+	require.Equal(t, 0, sw1.remarked)
+	require.Equal(t, "46", sw1.seenDSCP())
+
+	sw2 := info[dscpKey{host: "sw2", hop: 2, dscp: 46}]
+	require.Equal(t, 2, sw2.probes)
+	require.Equal(t, 1, sw2.remarked)
+	require.Equal(t, "0", sw2.seenDSCP())
+	require.Equal(t, 1, sw2.rtts)
+
+	data := computeDSCPPrintData(info)
+	require.Equal(t, 5, len(data))
+	require.Equal(t, []string{"1", "sw1", "sw1", "0", "0", "0", "1", "100.000", "100.0000"}, data[1])
+	require.Equal(t, []string{"1", "sw1", "sw1", "46", "46", "0", "2", "200.000", "200.0000"}, data[2])
+	require.Equal(t, []string{"2", "sw2", "sw2", "46", "0", "1", "2", "300.000", "150.0000"}, data[4])
+}
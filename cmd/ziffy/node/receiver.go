@@ -30,6 +30,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/icmp"
 	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -47,6 +48,10 @@ type Receiver struct {
 
 	runningHandlers int
 	*sync.Mutex
+
+	// packet socket used to reply to probes sent over IEEE 802.3
+	l2Fd      int
+	l2Ifindex int
 }
 
 // Start listens for PTP packets and reply to sender
@@ -58,12 +63,28 @@ func (r *Receiver) Start() error {
 	defer handle.Close()
 
 	filter := "udp and port " + strconv.Itoa(r.Config.DestinationPort)
+	if r.Config.Transport == TransportL2 {
+		filter = "ether proto " + PTPEtherTypeStr
+		// don't reflect our own replies
+		if err := handle.SetDirection(pcap.DirectionIn); err != nil {
+			return fmt.Errorf("unable to set capture direction: %w", err)
+		}
+		if r.l2Fd, r.l2Ifindex, err = newL2Socket(r.Config.Device); err != nil {
+			return err
+		}
+		defer unix.Close(r.l2Fd)
+	}
 	if err := handle.SetBPFFilter(filter); err != nil {
 		return fmt.Errorf("unable to set BPF Filter: %w", err)
 	}
 
-	log.Infof("listening on port %v for PTP EVENT packets (SYNC/DELAY_REQ) with ZiffyHexa signature. Sending back the packets as icmp\n\n",
-		r.Config.DestinationPort)
+	if r.Config.Transport == TransportL2 {
+		log.Infof("listening on %v for PTP packets over %s with ZiffyHexa signature. Sending back the packets as is\n\n",
+			r.Config.Device, TransportL2)
+	} else {
+		log.Infof("listening on port %v for PTP EVENT packets (SYNC/DELAY_REQ) with ZiffyHexa signature. Sending back the packets as icmp\n\n",
+			r.Config.DestinationPort)
+	}
 
 	r.Mutex = &sync.Mutex{}
 	r.runningHandlers = 0
@@ -101,6 +122,11 @@ func (r *Receiver) handlePacket(rawPacket gopacket.Packet) {
 		}
 	}()
 
+	if r.Config.Transport == TransportL2 {
+		r.handleL2Packet(rawPacket)
+		return
+	}
+
 	ptpSync, srcIP, srcPort, err := parseSyncPacket(rawPacket)
 	if err != nil {
 		log.Tracef("unable to parse PTP: %v", err)
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net"
 	"sort"
+	"sync"
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
@@ -57,10 +58,25 @@ type Sender struct {
 	rackSwHostname string
 
 	currentRoute int
+	// DSCP we are currently probing with
+	dscp int
+
+	sentLock sync.Mutex
+	sentAt   map[probeKey]time.Time
+}
+
+// probeKey identifies single probe we sent
+type probeKey struct {
+	routeIdx int
+	hop      int
 }
 
 // Start sending PTP packets
 func (s *Sender) Start() ([]PathInfo, error) {
+	s.sentAt = map[probeKey]time.Time{}
+	if s.Config.Transport == TransportL2 {
+		return s.startL2()
+	}
 	icmpAddr, err := net.ResolveIPAddr("ip6:ipv6-icmp", "")
 	if err != nil {
 		return nil, fmt.Errorf("unable to resolve source address: %w", err)
@@ -88,18 +104,24 @@ func (s *Sender) Start() ([]PathInfo, error) {
 		s.Config.SourcePort, s.Config.SourcePort+s.Config.PortCount-1, s.Config.HopMax, s.Config.HopMin, s.Config.IPCount, s.Config.IcmpTimeout,
 		s.Config.PortCount+s.Config.PortCount*s.Config.IPCount)
 
-	for i := 0; i < s.Config.PortCount; i++ {
-		s.routes = append(s.routes, PathInfo{switches: nil, rackSwHostname: s.rackSwHostname})
-		if err := s.traceRoute(s.Config.DestinationAddress, s.Config.SourcePort+i, false); err != nil {
-			log.Errorf("traceRoute failed: %v", err)
-			continue
+	for _, dscp := range s.dscps() {
+		s.dscp = dscp
+		if len(s.Config.DSCPs) > 0 {
+			log.Infof("probing with DSCP %d", dscp)
 		}
+		for i := 0; i < s.Config.PortCount; i++ {
+			s.routes = append(s.routes, PathInfo{switches: nil, rackSwHostname: s.rackSwHostname, dscp: s.dscp})
+			if err := s.traceRoute(s.Config.DestinationAddress, s.Config.SourcePort+i, false); err != nil {
+				log.Errorf("traceRoute failed: %v", err)
+				continue
+			}
 
-		s.currentRoute++
-		s.popAllQueue()
-	}
-	if s.Config.IPCount != 0 {
-		s.sweepRackPrefix()
+			s.currentRoute++
+			s.popAllQueue()
+		}
+		if s.Config.IPCount != 0 {
+			s.sweepRackPrefix()
+		}
 	}
 
 	// Waiting for late packets, if any
@@ -110,6 +132,35 @@ func (s *Sender) Start() ([]PathInfo, error) {
 	return s.clearPaths(), nil
 }
 
+// dscps returns list of DSCP values to probe with
+func (s *Sender) dscps() []int {
+	if len(s.Config.DSCPs) > 0 {
+		return s.Config.DSCPs
+	}
+	return []int{s.Config.DSCP}
+}
+
+// markSent records when the probe was sent
+func (s *Sender) markSent(routeIdx int, hop int, t time.Time) {
+	s.sentLock.Lock()
+	defer s.sentLock.Unlock()
+	if s.sentAt == nil {
+		s.sentAt = map[probeKey]time.Time{}
+	}
+	s.sentAt[probeKey{routeIdx: routeIdx, hop: hop}] = t
+}
+
+// rtt returns time passed since the probe was sent, 0 if we don't know about the probe
+func (s *Sender) rtt(routeIdx int, hop int, t time.Time) time.Duration {
+	s.sentLock.Lock()
+	defer s.sentLock.Unlock()
+	sent, found := s.sentAt[probeKey{routeIdx: routeIdx, hop: hop}]
+	if !found {
+		return 0
+	}
+	return t.Sub(sent)
+}
+
 // Insert late packets into corresponding path
 // Fixes the scenario in which packets arrive after traceRoute finished
 func (s *Sender) popAllQueue() {
@@ -130,7 +181,7 @@ func (s *Sender) clearPaths() []PathInfo {
 	retPaths := make([]PathInfo, 0, len(s.routes))
 	idx := 0
 	for _, route := range s.routes {
-		retPaths = append(retPaths, PathInfo{switches: nil, rackSwHostname: s.rackSwHostname})
+		retPaths = append(retPaths, PathInfo{switches: nil, rackSwHostname: s.rackSwHostname, dscp: route.dscp})
 		// Sort each route. This fixes the scenario where a
 		// packet with lower hop arrives after a packet with higher hop
 		sortSwitchesByHop(route.switches)
@@ -154,7 +205,7 @@ func (s *Sender) sweepRackPrefix() {
 	for i := 1; i <= s.Config.IPCount; i++ {
 		newIP := s.formNewDest(i)
 		for j := 0; j < s.Config.PortCount; j++ {
-			s.routes = append(s.routes, PathInfo{rackSwHostname: s.rackSwHostname})
+			s.routes = append(s.routes, PathInfo{rackSwHostname: s.rackSwHostname, dscp: s.dscp})
 
 			if err := s.traceRoute(newIP.String(), s.Config.SourcePort+j, true); err != nil {
 				log.Errorf("sweepRackPrefix traceRoute failed: %v", err)
@@ -207,7 +258,7 @@ func (s *Sender) traceRoute(destinationIP string, sendingPort int, sweep bool) e
 			return err
 		}
 		// First 2 bits from Traffic Class are unused, so we shift the value 2 bits
-		if err := unix.SetsockoptInt(connFd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, s.Config.DSCP<<2); err != nil {
+		if err := unix.SetsockoptInt(connFd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, s.dscp<<2); err != nil {
 			return err
 		}
 		var p ptp.Packet
@@ -220,6 +271,7 @@ func (s *Sender) traceRoute(destinationIP string, sendingPort int, sweep bool) e
 			return fmt.Errorf("unsupported packet type %v", s.Config.MessageType)
 		}
 
+		s.markSent(s.currentRoute, hop, time.Now())
 		if err := s.sendEventMsg(p, connFd, ptpAddr); err != nil {
 			return err
 		}
@@ -265,6 +317,7 @@ func (s *Sender) monitorIcmp(conn net.PacketConn) {
 
 // handleIcmpPacket is a handler which gets called every time icmp packets arrive
 func (s *Sender) handleIcmpPacket(rawPacket []byte, l int, rAddr net.Addr) {
+	received := time.Now()
 	icmpType := rawPacket[0]
 	if ipv6.ICMPType(icmpType) != ipv6.ICMPTypeTimeExceeded {
 		log.Tracef("not ipv6 timeexceeded packet")
@@ -304,10 +357,27 @@ func (s *Sender) handleIcmpPacket(rawPacket []byte, l int, rAddr net.Addr) {
 		corrField: corrField,
 		hop:       int(sequenceID),
 		routeIdx:  int(portNum),
+		dscp:      quotedDSCP(rawPacket[:l]),
+		rtt:       s.rtt(int(portNum), int(sequenceID), received),
 	}
 	log.Debugf("%v cf: %v hop: %v", getLookUpName(rAddr.String()), corrField, sequenceID)
 }
 
+// quotedDSCP extracts DSCP from IPv6 header of the probe quoted in ICMP message,
+// which is the DSCP as seen by the switch that dropped the probe. Returns -1 if it can't be extracted.
+func quotedDSCP(icmpPacket []byte) int {
+	if len(icmpPacket) < ICMPHeaderSize+Ipv6HeaderSize {
+		return -1
+	}
+	ipHeader := icmpPacket[ICMPHeaderSize:]
+	if ipHeader[0]>>4 != 6 {
+		return -1
+	}
+	trafficClass := ipHeader[0]<<4 | ipHeader[1]>>4
+	// last 2 bits of Traffic Class are ECN
+	return int(trafficClass >> 2)
+}
+
 // formNewDest generates new ip address using the
 // rack prefix /64 of DestinationAddress by adding
 // :face:face:0:$i to the ipv6
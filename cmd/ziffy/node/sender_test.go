@@ -150,3 +150,51 @@ func TestRackSwHostnameMonitor(t *testing.T) {
 	require.NotNil(t, err)
 	require.NotNil(t, "", rackSwHostname)
 }
+
+func TestParseDSCPs(t *testing.T) {
+	dscps, err := ParseDSCPs("0,8-10, 46,9")
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 8, 9, 10, 46}, dscps)
+
+	dscps, err = ParseDSCPs("")
+	require.NoError(t, err)
+	require.Empty(t, dscps)
+
+	for _, s := range []string{"64", "-1", "10-8", "a", "1-b", "60-64"} {
+		_, err = ParseDSCPs(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestSenderDSCPs(t *testing.T) {
+	s := Sender{
+		Config: &Config{DSCP: 46},
+	}
+	require.Equal(t, []int{46}, s.dscps())
+	s.Config.DSCPs = []int{0, 46}
+	require.Equal(t, []int{0, 46}, s.dscps())
+}
+
+func TestSenderRTT(t *testing.T) {
+	s := Sender{}
+	sent := time.Now()
+	s.markSent(1, 3, sent)
+	require.Equal(t, 42*time.Microsecond, s.rtt(1, 3, sent.Add(42*time.Microsecond)))
+	require.Equal(t, time.Duration(0), s.rtt(1, 4, sent))
+}
+
+func TestQuotedDSCP(t *testing.T) {
+	packet := make([]byte, ICMPHeaderSize+Ipv6HeaderSize)
+	// version 6, traffic class 0xb8 (DSCP 46)
+	packet[ICMPHeaderSize] = 0x6b
+	packet[ICMPHeaderSize+1] = 0x80
+	require.Equal(t, 46, quotedDSCP(packet))
+
+	// ECN bits don't matter
+	packet[ICMPHeaderSize+1] = 0xb0
+	require.Equal(t, 46, quotedDSCP(packet))
+
+	packet[ICMPHeaderSize] = 0x4b
+	require.Equal(t, -1, quotedDSCP(packet))
+	require.Equal(t, -1, quotedDSCP(packet[:ICMPHeaderSize+1]))
+}
@@ -65,6 +65,59 @@ TEST(fbclock_test, test_write_read) {
   remove(test_shm);
 }
 
+TEST(fbclock_test, test_write_read_v2) {
+  int err;
+  char* test_shm = std::tmpnam(nullptr);
+
+  // open file, write versioned data into it
+  FILE* f = fopen(test_shm, "wb+");
+  int sfd_rw = fileno(f);
+  ASSERT_NE(sfd_rw, -1);
+
+  err = ftruncate(sfd_rw, FBCLOCK_SHMDATA_V2_SIZE);
+  ASSERT_EQ(err, 0);
+
+  fbclock_clockdata data = {
+      .ingress_time_ns = 1, .error_bound_ns = 2, .holdover_multiplier_ns = 3};
+  err = fbclock_clockdata_store_data_v2(sfd_rw, &data);
+  ASSERT_EQ(err, 0);
+
+  fclose(f);
+
+  // read data from the file
+  f = fopen(test_shm, "r");
+  int sfd_ro = fileno(f);
+  ASSERT_NE(sfd_ro, -1);
+
+  fbclock_shmdata_v2* shmp = (fbclock_shmdata_v2*)mmap(
+      nullptr, FBCLOCK_SHMDATA_V2_SIZE, PROT_READ, MAP_SHARED, sfd_ro, 0);
+  ASSERT_NE(shmp, MAP_FAILED);
+
+  uint32_t version = 0;
+  err = fbclock_shmdata_version(shmp, FBCLOCK_SHMDATA_V2_SIZE, &version);
+  ASSERT_EQ(err, 0);
+  EXPECT_EQ(version, FBCLOCK_SHMDATA_VERSION);
+
+  // v1 segments are detected by size
+  err = fbclock_shmdata_version(shmp, FBCLOCK_SHMDATA_SIZE, &version);
+  ASSERT_EQ(err, 0);
+  EXPECT_EQ(version, 1);
+
+  fbclock_clockdata read_data;
+
+  err = fbclock_clockdata_load_data(&shmp->payload, &read_data);
+  ASSERT_EQ(err, 0);
+
+  munmap(shmp, FBCLOCK_SHMDATA_V2_SIZE);
+  fclose(f);
+
+  EXPECT_EQ(data.ingress_time_ns, read_data.ingress_time_ns);
+  EXPECT_EQ(data.error_bound_ns, read_data.error_bound_ns);
+  EXPECT_EQ(data.holdover_multiplier_ns, read_data.holdover_multiplier_ns);
+
+  remove(test_shm);
+}
+
 int writer_thread(int sfd_rw, int tries) {
   int err;
   fbclock_clockdata data = {
@@ -108,6 +161,23 @@ int reader_thread(fbclock_shmdata* shmp, int tries) {
   return 0;
 }
 
+// fbclock_lib as it was before shared memory versioning
+typedef struct fbclock_lib_v1 {
+  char* ptp_path;
+  int shm_fd;
+  int dev_fd;
+  fbclock_shmdata* shmp;
+} fbclock_lib_v1;
+
+TEST(fbclock_test, test_lib_layout) {
+  EXPECT_EQ(sizeof(fbclock_lib), sizeof(fbclock_lib_v1));
+  EXPECT_EQ(
+      offsetof(fbclock_lib, ptp_path), offsetof(fbclock_lib_v1, ptp_path));
+  EXPECT_EQ(offsetof(fbclock_lib, shm_fd), offsetof(fbclock_lib_v1, shm_fd));
+  EXPECT_EQ(offsetof(fbclock_lib, dev_fd), offsetof(fbclock_lib_v1, dev_fd));
+  EXPECT_EQ(offsetof(fbclock_lib, shmp), offsetof(fbclock_lib_v1, shmp));
+}
+
 TEST(fbclock_test, test_concurrent) {
   int err;
   char* test_shm = std::tmpnam(nullptr);
@@ -33,6 +33,7 @@ type Config struct {
 	Iface                       string        // network interface to use
 	LinearizabilityTestInterval time.Duration // perform the linearizability test every so often
 	SPTP                        bool          // wherever we run in sptp or ptp4l mode
+	LegacyShmV1                 bool          // also publish legacy v1 shm for clients built before shm versioning
 }
 
 // EvalAndValidate makes sure config is valid and evaluates expressions for further use.
@@ -94,6 +94,9 @@ type Daemon struct {
 	stats StatsServer
 	l     Logger
 
+	// legacy v1 shared memory, published alongside the current one when enabled
+	shmV1 *fbclock.Shm
+
 	// function to get PHC time from configured PHC device
 	getPHCTime func() (time.Time, error)
 	// function to get PHC freq from configured PHC device
@@ -294,6 +297,11 @@ func (s *Daemon) doWork(shm *fbclock.Shm, data *DataPoint) error {
 	if err := fbclock.StoreFBClockData(shm.File.Fd(), *d); err != nil {
 		return err
 	}
+	if s.shmV1 != nil {
+		if err := fbclock.StoreFBClockDataV1(s.shmV1.File.Fd(), *d); err != nil {
+			return err
+		}
+	}
 	// aggregated stats over 1 minute
 	maxDp := s.state.aggregateDataPointsMax(minRingSize(s.cfg.RingSize, s.cfg.Interval))
 	s.stats.SetCounter("master_offset_ns.60.abs_max", int64(maxDp.MasterOffsetNS))
@@ -404,6 +412,13 @@ func (s *Daemon) Run(ctx context.Context) error {
 		return fmt.Errorf("opening fbclock shm: %w", err)
 	}
 	defer shm.Close()
+	if s.cfg.LegacyShmV1 {
+		s.shmV1, err = fbclock.OpenFBClockSHMV1()
+		if err != nil {
+			return fmt.Errorf("opening fbclock legacy v1 shm: %w", err)
+		}
+		defer s.shmV1.Close()
+	}
 
 	if s.cfg.LinearizabilityTestInterval != 0 {
 		go s.runLinearizabilityTests(ctx)
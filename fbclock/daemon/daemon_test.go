@@ -478,6 +478,13 @@ func TestDaemonDoWork(t *testing.T) {
 	shm, err := fbclock.OpenFBClockShmCustom(tmpFile.Name())
 	require.NoError(t, err)
 	defer shm.Close()
+	// legacy shared mem is published alongside
+	tmpFileV1, err := os.CreateTemp("", "daemon_test_v1")
+	require.NoError(t, err)
+	defer os.Remove(tmpFileV1.Name())
+	s.shmV1, err = fbclock.OpenFBClockShmV1Custom(tmpFileV1.Name())
+	require.NoError(t, err)
+	defer s.shmV1.Close()
 
 	// populate the data
 	var d *DataPoint
@@ -583,6 +590,14 @@ func TestDaemonDoWork(t *testing.T) {
 	require.Equal(t, want.IngressTimeNS, got.IngressTimeNS)
 	require.Equal(t, want.ErrorBoundNS, got.ErrorBoundNS)
 	require.InDelta(t, want.HoldoverMultiplierNS, got.HoldoverMultiplierNS, 0.001)
+	// same data in legacy layout
+	shmpDataV1, err := fbclock.MmapShmpData(s.shmV1.File.Fd())
+	require.NoError(t, err)
+	got, err = fbclock.ReadFBClockData(shmpDataV1)
+	require.NoError(t, err)
+	require.Equal(t, want.IngressTimeNS, got.IngressTimeNS)
+	require.Equal(t, want.ErrorBoundNS, got.ErrorBoundNS)
+	require.InDelta(t, want.HoldoverMultiplierNS, got.HoldoverMultiplierNS, 0.001)
 
 	// ptp4l has a hiccup, but that should be okay
 	d = &DataPoint{
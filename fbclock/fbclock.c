@@ -15,6 +15,7 @@ limitations under the License.
 */
 
 #include "fbclock.h"
+#include <errno.h>
 #include <fcntl.h> // For O_* constants
 #include <linux/ptp_clock.h>
 #include <math.h> // pow
@@ -81,6 +82,66 @@ int fbclock_clockdata_store_data(uint32_t fd, fbclock_clockdata* data) {
   return 0;
 }
 
+// fbclock_shmdata_init_v2 is used in shmem.go to write header of versioned
+// segment as soon as it's opened, so readers recognize it before first store.
+int fbclock_shmdata_init_v2(uint32_t fd) {
+  fbclock_shmdata_v2* shmp = mmap(
+      NULL, FBCLOCK_SHMDATA_V2_SIZE, PROT_READ | PROT_WRITE, MAP_SHARED, fd, 0);
+  if (shmp == MAP_FAILED) {
+    return FBCLOCK_E_SHMEM_MAP_FAILED;
+  }
+  shmp->magic = FBCLOCK_SHMDATA_MAGIC;
+  shmp->version = FBCLOCK_SHMDATA_VERSION;
+  munmap(shmp, FBCLOCK_SHMDATA_V2_SIZE);
+  return 0;
+}
+
+// fbclock_clockdata_store_data_v2 is used in shmem.go to store timing data in
+// versioned segment. Header is (re)written on every store, it never changes.
+int fbclock_clockdata_store_data_v2(uint32_t fd, fbclock_clockdata* data) {
+  fbclock_shmdata_v2* shmp = mmap(
+      NULL, FBCLOCK_SHMDATA_V2_SIZE, PROT_READ | PROT_WRITE, MAP_SHARED, fd, 0);
+  if (shmp == MAP_FAILED) {
+    return FBCLOCK_E_SHMEM_MAP_FAILED;
+  }
+  shmp->magic = FBCLOCK_SHMDATA_MAGIC;
+  shmp->version = FBCLOCK_SHMDATA_VERSION;
+  uint64_t crc = fbclock_clockdata_crc(data);
+  memcpy(&shmp->payload.data, data, FBCLOCK_CLOCKDATA_SIZE);
+  atomic_store(&shmp->payload.crc, crc);
+  munmap(shmp, FBCLOCK_SHMDATA_V2_SIZE);
+  return 0;
+}
+
+// fbclock_shmdata_version detects layout of the segment of given size.
+// v1 segment has no header and is exactly FBCLOCK_SHMDATA_SIZE long,
+// which is shorter than any versioned segment.
+int fbclock_shmdata_version(const void* shm, size_t size, uint32_t* version) {
+  if (size == FBCLOCK_SHMDATA_SIZE) {
+    *version = 1;
+    return 0;
+  }
+  if (size < FBCLOCK_SHMDATA_V2_SIZE) {
+    return FBCLOCK_E_SHMEM_VERSION;
+  }
+  const fbclock_shmdata_v2* shmp = shm;
+  // segment was created, but its header is not written yet.
+  // Payload is zeroed as well, so readers see no data rather than an error
+  if (shmp->magic == 0 && shmp->version == 0) {
+    *version = FBCLOCK_SHMDATA_VERSION;
+    return 0;
+  }
+  if (shmp->magic != FBCLOCK_SHMDATA_MAGIC) {
+    return FBCLOCK_E_SHMEM_VERSION;
+  }
+  // newer writers are expected to publish older versions side by side
+  if (shmp->version != FBCLOCK_SHMDATA_VERSION) {
+    return FBCLOCK_E_SHMEM_VERSION;
+  }
+  *version = shmp->version;
+  return 0;
+}
+
 int fbclock_clockdata_load_data(
     fbclock_shmdata* shmp,
     fbclock_clockdata* data) {
@@ -127,30 +188,68 @@ static int fbclock_read_ptp_offset_extended(int fd, struct phc_time_res* res) {
 int fbclock_init(fbclock_lib* lib, const char* shm_path) {
   lib->ptp_path = FBCLOCK_PTPPATH;
   int sfd = open(shm_path, O_RDONLY, 0);
+  // daemon which doesn't publish current version yet
+  if (sfd == -1 && errno == ENOENT && strcmp(shm_path, FBCLOCK_PATH) == 0) {
+    sfd = open(FBCLOCK_PATH_V1, O_RDONLY, 0);
+  }
   if (sfd == -1) {
     perror("open shmem device");
     return FBCLOCK_E_SHMEM_OPEN;
   }
-  lib->shm_fd = sfd;
+
+  struct stat st;
+  if (fstat(sfd, &st) == -1) {
+    perror("stat shmem device");
+    close(sfd);
+    return FBCLOCK_E_SHMEM_OPEN;
+  }
 
   int ffd = open(lib->ptp_path, O_RDONLY);
   if (ffd == -1) {
     perror("open PTP device");
+    close(sfd);
     return FBCLOCK_E_PTP_OPEN;
   }
-  lib->dev_fd = ffd;
 
-  fbclock_shmdata* shmp =
-      mmap(NULL, FBCLOCK_SHMDATA_SIZE, PROT_READ, MAP_SHARED, lib->shm_fd, 0);
-  if (shmp == MAP_FAILED) {
+  // only the known layout is mapped, so fbclock_destroy can tell its size
+  size_t size = FBCLOCK_SHMDATA_V2_SIZE;
+  if (st.st_size == FBCLOCK_SHMDATA_SIZE) {
+    size = FBCLOCK_SHMDATA_SIZE;
+  } else if (st.st_size < FBCLOCK_SHMDATA_V2_SIZE) {
+    close(ffd);
+    close(sfd);
+    return FBCLOCK_E_SHMEM_VERSION;
+  }
+  void* shm = mmap(NULL, size, PROT_READ, MAP_SHARED, sfd, 0);
+  if (shm == MAP_FAILED) {
+    close(ffd);
+    close(sfd);
     return FBCLOCK_E_SHMEM_MAP_FAILED;
   }
-  lib->shmp = shmp;
+  uint32_t version = 0;
+  int err = fbclock_shmdata_version(shm, size, &version);
+  if (err != 0) {
+    munmap(shm, size);
+    close(ffd);
+    close(sfd);
+    return err;
+  }
+  lib->shm_fd = sfd;
+  lib->dev_fd = ffd;
+  if (version == 1) {
+    lib->shmp = shm;
+  } else {
+    lib->shmp = &((fbclock_shmdata_v2*)shm)->payload;
+  }
   return 0;
 }
 
 int fbclock_destroy(fbclock_lib* lib) {
-  munmap(lib->shmp, FBCLOCK_SHMDATA_SIZE);
+  // fbclock_lib has no room to keep the mapping, but mmap returns page aligned
+  // address and payload of any layout lies within its first page
+  uintptr_t page = sysconf(_SC_PAGESIZE);
+  char* shm = (char*)((uintptr_t)lib->shmp & ~(page - 1));
+  munmap(shm, (char*)lib->shmp - shm + FBCLOCK_SHMDATA_SIZE);
   close(lib->dev_fd);
   close(lib->shm_fd);
   return 0;
@@ -245,6 +344,9 @@ const char* fbclock_strerror(int err_code) {
     case FBCLOCK_E_PHC_IN_THE_PAST:
       err_info = "PHC jumped back in time";
       break;
+    case FBCLOCK_E_SHMEM_VERSION:
+      err_info = "unsupported shmem layout version";
+      break;
     case 0:
       err_info = "no error";
       break;
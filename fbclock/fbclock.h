@@ -24,6 +24,7 @@ typedef std::atomic_uint_fast64_t atomic_uint64;
 typedef atomic_uint_fast64_t atomic_uint64;
 #endif
 
+#include <stddef.h>
 #include <stdint.h> /* for proper fixed width types */
 
 // error codes
@@ -34,6 +35,7 @@ typedef atomic_uint_fast64_t atomic_uint64;
 #define FBCLOCK_E_NO_DATA -5
 #define FBCLOCK_E_WOU_TOO_BIG -6
 #define FBCLOCK_E_PHC_IN_THE_PAST -7
+#define FBCLOCK_E_SHMEM_VERSION -8
 
 #ifdef __cplusplus
 extern "C" {
@@ -49,17 +51,34 @@ typedef struct fbclock_clockdata {
 } fbclock_clockdata;
 
 // Define a structure that will be imposed on the shared memory object.
+// This is the whole v1 segment, and the payload of later versions.
 typedef struct fbclock_shmdata {
   atomic_uint64 crc;
   fbclock_clockdata data;
 } fbclock_shmdata;
 
+// Versioned segment. Header never changes once the segment is written,
+// so readers can tell the layout before reading the payload.
+typedef struct fbclock_shmdata_v2 {
+  uint32_t magic; // FBCLOCK_SHMDATA_MAGIC
+  uint32_t version; // FBCLOCK_SHMDATA_VERSION of the writer
+  fbclock_shmdata payload;
+} fbclock_shmdata_v2;
+
+#define FBCLOCK_SHMDATA_MAGIC 0xFBC10C4D
+#define FBCLOCK_SHMDATA_VERSION 2
+
 #define FBCLOCK_SHMDATA_SIZE sizeof(fbclock_shmdata)
-#define FBCLOCK_PATH "/dev/shm/fbclock_data_v1"
+#define FBCLOCK_SHMDATA_V2_SIZE sizeof(fbclock_shmdata_v2)
+// current version, falls back to FBCLOCK_PATH_V1 if daemon doesn't publish it
+#define FBCLOCK_PATH "/dev/shm/fbclock_data_v2"
+// legacy version, published by daemon during the upgrade window
+#define FBCLOCK_PATH_V1 "/dev/shm/fbclock_data_v1"
 #define FBCLOCK_POW2_16 ((double)(1ULL << 16))
 #define FBCLOCK_PTPPATH "/dev/fbclock/ptp"
 
-// library
+// library. It's allocated by clients, so its layout must stay the same
+// for clients built against older headers to keep working with newer library
 typedef struct fbclock_lib {
   char* ptp_path; // path to PHC clock device
   int shm_fd; // file descriptor of opened shared mem
@@ -74,6 +93,9 @@ typedef struct fbclock_truetime {
 } fbclock_truetime;
 
 int fbclock_clockdata_store_data(uint32_t fd, fbclock_clockdata* data);
+int fbclock_shmdata_init_v2(uint32_t fd);
+int fbclock_clockdata_store_data_v2(uint32_t fd, fbclock_clockdata* data);
+int fbclock_shmdata_version(const void* shm, size_t size, uint32_t* version);
 int fbclock_clockdata_load_data(fbclock_shmdata* shm, fbclock_clockdata* data);
 double fbclock_window_of_uncertainty(
     double seconds,
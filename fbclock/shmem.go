@@ -41,6 +41,12 @@ import (
 // PTPPath is the path we set for PTP device
 const PTPPath = C.FBCLOCK_PTPPATH
 
+// ShmVersion is the layout version of shared memory written by StoreFBClockData
+const ShmVersion = C.FBCLOCK_SHMDATA_VERSION
+
+// ShmPathV1 is the path of legacy v1 shared memory, still read by clients built before versioning
+const ShmPathV1 = C.FBCLOCK_PATH_V1
+
 // Shm is POSIX shared memory
 type Shm struct {
 	Path string
@@ -81,9 +87,7 @@ type Data struct {
 	HoldoverMultiplierNS float64 // float stored as multiplier of  2**16
 }
 
-// OpenFBClockShmCustom returns opened POSIX shared mem used by fbclock,
-// with custom path
-func OpenFBClockShmCustom(path string) (*Shm, error) {
+func openFBClockShm(path string, size int64) (*Shm, error) {
 	shm, err := OpenShm(
 		path,
 		C.O_CREAT|C.O_RDWR,
@@ -92,18 +96,45 @@ func OpenFBClockShmCustom(path string) (*Shm, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := shm.File.Truncate(C.FBCLOCK_SHMDATA_SIZE); err != nil {
+	if err := shm.File.Truncate(size); err != nil {
 		shm.Close()
 		return nil, err
 	}
 	return shm, nil
 }
 
+// OpenFBClockShmCustom returns opened POSIX shared mem used by fbclock,
+// with custom path
+func OpenFBClockShmCustom(path string) (*Shm, error) {
+	shm, err := openFBClockShm(path, C.FBCLOCK_SHMDATA_V2_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	// readers must recognize the layout before first data is stored
+	// fbclock_shmdata_init_v2 comes from fbclock.c
+	if res := C.fbclock_shmdata_init_v2(C.uint(shm.File.Fd())); res != 0 {
+		shm.Close()
+		return nil, fmt.Errorf("failed to write header: %s", strerror(res))
+	}
+	return shm, nil
+}
+
 // OpenFBClockSHM returns opened POSIX shared mem used by fbclock
 func OpenFBClockSHM() (*Shm, error) {
 	return OpenFBClockShmCustom(C.FBCLOCK_PATH)
 }
 
+// OpenFBClockShmV1Custom returns opened POSIX shared mem with legacy v1 layout,
+// with custom path
+func OpenFBClockShmV1Custom(path string) (*Shm, error) {
+	return openFBClockShm(path, C.FBCLOCK_SHMDATA_SIZE)
+}
+
+// OpenFBClockSHMV1 returns opened POSIX shared mem with legacy v1 layout
+func OpenFBClockSHMV1() (*Shm, error) {
+	return OpenFBClockShmV1Custom(C.FBCLOCK_PATH_V1)
+}
+
 // FloatAsUint32 stores float as multiplier of 2**16.
 // Effectively this means we can store max 65k like this.
 func FloatAsUint32(val float64) uint32 {
@@ -128,29 +159,62 @@ func Uint64ToUint32(val uint64) uint32 {
 	return uint32(val)
 }
 
-// StoreFBClockData will store fbclock data in shared mem,
-// fd param should be open file descriptor of that shared mem.
-func StoreFBClockData(fd uintptr, d Data) error {
-	cData := &C.fbclock_clockdata{
+func toClockData(d Data) *C.fbclock_clockdata {
+	return &C.fbclock_clockdata{
 		ingress_time_ns:        C.int64_t(d.IngressTimeNS),
 		error_bound_ns:         C.uint32_t(Uint64ToUint32(d.ErrorBoundNS)),
 		holdover_multiplier_ns: C.uint32_t(FloatAsUint32(d.HoldoverMultiplierNS)),
 	}
+}
+
+// StoreFBClockData will store fbclock data in shared mem,
+// fd param should be open file descriptor of that shared mem.
+func StoreFBClockData(fd uintptr, d Data) error {
+	// fbclock_clockdata_store_data_v2 comes from fbclock.c
+	res := C.fbclock_clockdata_store_data_v2(C.uint(fd), toClockData(d))
+	if res != 0 {
+		return fmt.Errorf("failed to store data: %s", strerror(res))
+	}
+	return nil
+}
+
+// StoreFBClockDataV1 will store fbclock data in shared mem with legacy v1 layout,
+// fd param should be open file descriptor of that shared mem.
+func StoreFBClockDataV1(fd uintptr, d Data) error {
 	// fbclock_clockdata_store_data comes from fbclock.c
-	res := C.fbclock_clockdata_store_data(C.uint(fd), cData)
+	res := C.fbclock_clockdata_store_data(C.uint(fd), toClockData(d))
 	if res != 0 {
 		return fmt.Errorf("failed to store data: %s", strerror(res))
 	}
 	return nil
 }
 
-// MmapShmpData mmaps open file as fbclock shared memory. Used in tests only.
+// MmapShmpData mmaps open file as fbclock shared memory of any supported version,
+// returning pointer to the data payload. Used in tests only.
 func MmapShmpData(fd uintptr) (unsafe.Pointer, error) {
-	data, err := unix.Mmap(int(fd), 0, C.FBCLOCK_SHMDATA_SIZE, unix.PROT_READ, unix.MAP_SHARED)
+	var st unix.Stat_t
+	if err := unix.Fstat(int(fd), &st); err != nil {
+		return nil, err
+	}
+	if st.Size < C.FBCLOCK_SHMDATA_SIZE {
+		return nil, fmt.Errorf("failed to map data: %s", strerror(C.FBCLOCK_E_SHMEM_VERSION))
+	}
+	data, err := unix.Mmap(int(fd), 0, int(st.Size), unix.PROT_READ, unix.MAP_SHARED)
 	if err != nil {
 		return nil, err
 	}
-	return unsafe.Pointer(&data[0]), nil
+	var version C.uint32_t
+	// fbclock_shmdata_version comes from fbclock.c
+	res := C.fbclock_shmdata_version(unsafe.Pointer(&data[0]), C.size_t(st.Size), &version)
+	if res != 0 {
+		_ = unix.Munmap(data)
+		return nil, fmt.Errorf("failed to map data: %s", strerror(res))
+	}
+	if version == 1 {
+		return unsafe.Pointer(&data[0]), nil
+	}
+	shmp := (*C.fbclock_shmdata_v2)(unsafe.Pointer(&data[0]))
+	return unsafe.Pointer(&shmp.payload), nil
 }
 
 // ReadFBClockData will read Data from mmaped fbclock shared memory. Used in tests only
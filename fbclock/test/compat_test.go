@@ -0,0 +1,153 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	lib "github.com/facebook/time/fbclock"
+
+	"github.com/stretchr/testify/require"
+)
+
+var compatData = lib.Data{
+	IngressTimeNS:        1648137249050666302,
+	ErrorBoundNS:         314000000,
+	HoldoverMultiplierNS: 1.001,
+}
+
+// writeShm stores data the way a daemon of given shm version does
+func writeShm(t *testing.T, version int, d lib.Data) *lib.Shm {
+	tmpfile, err := os.CreateTemp("", "shmemcompattest")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(tmpfile.Name()) })
+	var shm *lib.Shm
+	if version == 1 {
+		shm, err = lib.OpenFBClockShmV1Custom(tmpfile.Name())
+		require.NoError(t, err)
+		err = lib.StoreFBClockDataV1(shm.File.Fd(), d)
+	} else {
+		shm, err = lib.OpenFBClockShmCustom(tmpfile.Name())
+		require.NoError(t, err)
+		err = lib.StoreFBClockData(shm.File.Fd(), d)
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { shm.Close() })
+	return shm
+}
+
+func readShm(t *testing.T, shm *lib.Shm) (*lib.Data, error) {
+	shmdata, err := lib.MmapShmpData(shm.File.Fd())
+	if err != nil {
+		return nil, err
+	}
+	return lib.ReadFBClockData(shmdata)
+}
+
+func TestShmCompatVersions(t *testing.T) {
+	for _, version := range []int{1, lib.ShmVersion} {
+		shm := writeShm(t, version, compatData)
+		got, err := readShm(t, shm)
+		require.NoError(t, err, "reading shm v%d", version)
+		require.Equal(t, compatData.IngressTimeNS, got.IngressTimeNS)
+		require.Equal(t, compatData.ErrorBoundNS, got.ErrorBoundNS)
+		require.InDelta(t, compatData.HoldoverMultiplierNS, got.HoldoverMultiplierNS, 0.001)
+	}
+}
+
+func TestShmCompatSizes(t *testing.T) {
+	v1 := writeShm(t, 1, compatData)
+	v2 := writeShm(t, lib.ShmVersion, compatData)
+	st1, err := v1.File.Stat()
+	require.NoError(t, err)
+	st2, err := v2.File.Stat()
+	require.NoError(t, err)
+	// v1 readers map the beginning of the segment, so layouts must never be confused by size
+	require.Equal(t, int64(24), st1.Size())
+	require.Greater(t, st2.Size(), st1.Size())
+}
+
+func TestShmCompatRewrite(t *testing.T) {
+	shm := writeShm(t, lib.ShmVersion, compatData)
+	d := compatData
+	d.IngressTimeNS++
+	require.NoError(t, lib.StoreFBClockData(shm.File.Fd(), d))
+	got, err := readShm(t, shm)
+	require.NoError(t, err)
+	require.Equal(t, d.IngressTimeNS, got.IngressTimeNS)
+}
+
+func TestShmCompatRejectsUnknown(t *testing.T) {
+	// header is magic followed by version
+	tests := []struct {
+		name   string
+		offset int64
+		value  uint32
+	}{
+		{name: "bad magic", offset: 0, value: 0xdeadbeef},
+		{name: "newer version", offset: 4, value: lib.ShmVersion + 1},
+		{name: "older version", offset: 4, value: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shm := writeShm(t, lib.ShmVersion, compatData)
+			b := make([]byte, 4)
+			binary.LittleEndian.PutUint32(b, tt.value)
+			_, err := shm.File.WriteAt(b, tt.offset)
+			require.NoError(t, err)
+			_, err = readShm(t, shm)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "unsupported shmem layout version")
+		})
+	}
+}
+
+func TestShmCompatRejectsTruncated(t *testing.T) {
+	shm := writeShm(t, lib.ShmVersion, compatData)
+	require.NoError(t, shm.File.Truncate(16))
+	_, err := readShm(t, shm)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported shmem layout version")
+}
+
+func TestShmCompatBeforeFirstStore(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "shmemcompattest")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(tmpfile.Name()) })
+	shm, err := lib.OpenFBClockShmCustom(tmpfile.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { shm.Close() })
+
+	// header is there as soon as segment is opened, with no data yet
+	b := make([]byte, 8)
+	_, err = shm.File.ReadAt(b, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0xFBC10C4D), binary.LittleEndian.Uint32(b))
+	require.Equal(t, uint32(lib.ShmVersion), binary.LittleEndian.Uint32(b[4:]))
+	got, err := readShm(t, shm)
+	require.NoError(t, err)
+	require.Equal(t, lib.Data{}, *got)
+
+	// segment which is not even initialized yet has no data either
+	_, err = shm.File.WriteAt(make([]byte, 8), 0)
+	require.NoError(t, err)
+	got, err = readShm(t, shm)
+	require.NoError(t, err)
+	require.Equal(t, lib.Data{}, *got)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const modeServer = 4
+
+// ErrUnsynchronized is returned when server reports it's not synchronized
+var ErrUnsynchronized = errors.New("server is not synchronized")
+
+// Measurement is a result of a single NTP query
+type Measurement struct {
+	ClientTransmit time.Time // T1
+	ServerReceive  time.Time // T2
+	ServerTransmit time.Time // T3
+	ClientReceive  time.Time // T4
+
+	Offset time.Duration
+	Delay  time.Duration
+	// OffsetError bounds how far Offset is from the true offset to the server:
+	// half of the delay, as the path can be fully asymmetric, plus precision of the server clock
+	OffsetError time.Duration
+	// RootDistance bounds the error relative to the reference clock of the server
+	RootDistance time.Duration
+
+	Stratum     uint8
+	ReferenceID uint32
+	// Timestamping is the kind of timestamps taken on the client side
+	Timestamping string
+}
+
+// ShortFormatToDuration converts NTP short format (16 bit seconds, 16 bit fraction) into time.Duration
+func ShortFormatToDuration(v uint32) time.Duration {
+	return time.Duration(int64(v) * time.Second.Nanoseconds() >> 16)
+}
+
+// PrecisionToDuration converts precision (log2 seconds) into time.Duration
+func PrecisionToDuration(p int8) time.Duration {
+	return time.Duration(math.Ldexp(float64(time.Second), int(p)))
+}
+
+// clientSettings is LI 0, VN 4, mode client
+const clientSettings = liNoWarning<<6 | vnLast<<3 | modeClient
+
+// newRequest returns client request which carries the transmit time as a cookie, server echoes it as origin time
+func newRequest(t time.Time) *Packet {
+	sec, frac := Time(t)
+	return &Packet{
+		Settings:   clientSettings,
+		TxTimeSec:  sec,
+		TxTimeFrac: frac,
+	}
+}
+
+// isResponseTo checks that response is a server reply to the request
+func isResponseTo(request, response *Packet) bool {
+	return response.Settings&0x7 == modeServer &&
+		response.OrigTimeSec == request.TxTimeSec &&
+		response.OrigTimeFrac == request.TxTimeFrac
+}
+
+// checkResponse verifies that server is able to provide time
+func checkResponse(response *Packet) error {
+	if response.Stratum == 0 {
+		id := []byte{byte(response.ReferenceID >> 24), byte(response.ReferenceID >> 16), byte(response.ReferenceID >> 8), byte(response.ReferenceID)}
+		return fmt.Errorf("got kiss-o'-death %q", id)
+	}
+	if response.Settings>>6 == liAlarmCondition {
+		return ErrUnsynchronized
+	}
+	return nil
+}
+
+// NewMeasurement calculates offset, delay and their error bounds from the server response
+// and client transmit and receive times
+func NewMeasurement(response *Packet, clientTransmit, clientReceive time.Time) *Measurement {
+	m := &Measurement{
+		ClientTransmit: clientTransmit,
+		ServerReceive:  Unix(response.RxTimeSec, response.RxTimeFrac),
+		ServerTransmit: Unix(response.TxTimeSec, response.TxTimeFrac),
+		ClientReceive:  clientReceive,
+		Stratum:        response.Stratum,
+		ReferenceID:    response.ReferenceID,
+	}
+	m.Offset = time.Duration(Offset(m.ClientTransmit, m.ServerReceive, m.ServerTransmit, m.ClientReceive))
+	m.Delay = time.Duration(RoundTripDelay(m.ClientTransmit, m.ServerReceive, m.ServerTransmit, m.ClientReceive))
+	// delay can't be negative, but timestamps taken by different clocks can make it so
+	delay := m.Delay
+	if delay < 0 {
+		delay = 0
+	}
+	m.OffsetError = delay/2 + PrecisionToDuration(response.Precision)
+	m.RootDistance = ShortFormatToDuration(response.RootDelay)/2 + ShortFormatToDuration(response.RootDispersion) + m.OffsetError
+	return m
+}
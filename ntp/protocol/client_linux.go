@@ -0,0 +1,146 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	"golang.org/x/sys/unix"
+)
+
+// Client queries NTP server using kernel or hardware timestamps in both directions,
+// so measurements don't include delays of the network stack and the scheduler
+type Client struct {
+	conn         *net.UDPConn
+	connFd       int
+	timestamping string
+	timeout      time.Duration
+
+	buf  []byte
+	oob  []byte
+	toob []byte
+}
+
+// NewClient creates Client connected to NTP server at address (host:port).
+// timestamping is either timestamp.HWTIMESTAMP, which are enabled on iface, or timestamp.SWTIMESTAMP
+func NewClient(address, iface, timestamping string, timeout time.Duration) (*Client, error) {
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	c, err := newClient(conn, iface, timestamping, timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClient(conn *net.UDPConn, iface, timestamping string, timeout time.Duration) (*Client, error) {
+	connFd, err := timestamp.ConnFd(conn)
+	if err != nil {
+		return nil, err
+	}
+	switch timestamping {
+	case timestamp.HWTIMESTAMP:
+		if err := timestamp.EnableHWTimestamps(connFd, iface); err != nil {
+			return nil, fmt.Errorf("failed to enable hardware timestamps on %s: %w", iface, err)
+		}
+	case timestamp.SWTIMESTAMP:
+		if err := timestamp.EnableSWTimestamps(connFd); err != nil {
+			return nil, fmt.Errorf("failed to enable software timestamps: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown timestamping %q", timestamping)
+	}
+	// reads are done with recvmsg directly, which needs blocking socket to honour the timeout
+	if err := unix.SetNonblock(connFd, false); err != nil {
+		return nil, err
+	}
+	tv := unix.NsecToTimeval(timeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(connFd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return nil, fmt.Errorf("failed to set receive timeout: %w", err)
+	}
+	return &Client{
+		conn:         conn,
+		connFd:       connFd,
+		timestamping: timestamping,
+		timeout:      timeout,
+		buf:          make([]byte, timestamp.PayloadSizeBytes),
+		oob:          make([]byte, timestamp.ControlSizeBytes),
+		toob:         make([]byte, timestamp.ControlSizeBytes),
+	}, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Query sends a request to the server and measures offset and delay to it.
+// Client transmit time is the TX timestamp of the request, client receive time is the RX timestamp of the response
+func (c *Client) Query() (*Measurement, error) {
+	request := newRequest(time.Now())
+	b, err := request.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(b); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	clientTransmit, _, err := timestamp.ReadTXtimestampBuf(c.connFd, c.oob, c.toob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TX timestamp: %w", err)
+	}
+
+	deadline := time.Now().Add(c.timeout)
+	for time.Now().Before(deadline) {
+		n, _, clientReceive, err := timestamp.ReadPacketWithRXTimestampBuf(c.connFd, c.buf, c.oob)
+		if errors.Is(err, unix.EAGAIN) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n < PacketSizeBytes {
+			continue
+		}
+		response, err := BytesToPacket(c.buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		// late responses to previous requests
+		if !isResponseTo(request, response) {
+			continue
+		}
+		if err := checkResponse(response); err != nil {
+			return nil, err
+		}
+		m := NewMeasurement(response, clientTransmit, clientReceive)
+		m.Timestamping = c.timestamping
+		return m, nil
+	}
+	return nil, fmt.Errorf("timeout waiting for reply from server for %v", c.timeout)
+}
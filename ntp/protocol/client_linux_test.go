@@ -0,0 +1,108 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+// serveOnce replies to a single request on conn, sending stale response first
+func serveOnce(conn *net.UDPConn, stratum uint8) error {
+	buf := make([]byte, PacketSizeBytes)
+	_, addr, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		return err
+	}
+	request, err := BytesToPacket(buf)
+	if err != nil {
+		return err
+	}
+
+	rxSec, rxFrac := Time(time.Now())
+	response := &Packet{
+		Settings:    0x24,
+		Stratum:     stratum,
+		Precision:   -20,
+		OrigTimeSec: request.TxTimeSec,
+		RxTimeSec:   rxSec,
+		RxTimeFrac:  rxFrac,
+	}
+	response.TxTimeSec, response.TxTimeFrac = Time(time.Now())
+	for _, origFrac := range []uint32{request.TxTimeFrac + 1, request.TxTimeFrac} {
+		response.OrigTimeFrac = origFrac
+		b, err := response.Bytes()
+		if err != nil {
+			return err
+		}
+		if _, err := conn.WriteToUDP(b, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestClientQuery(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer server.Close()
+
+	c, err := NewClient(server.LocalAddr().String(), "lo", timestamp.SWTIMESTAMP, time.Second)
+	require.NoError(t, err)
+	defer c.Close()
+
+	served := make(chan error, 1)
+	go func() { served <- serveOnce(server, 1) }()
+	m, err := c.Query()
+	require.NoError(t, <-served)
+	require.NoError(t, err)
+	require.Equal(t, uint8(1), m.Stratum)
+	require.Equal(t, timestamp.SWTIMESTAMP, m.Timestamping)
+	require.False(t, m.ClientTransmit.After(m.ClientReceive))
+	require.InDelta(t, 0, m.Offset, float64(time.Second))
+	require.GreaterOrEqual(t, m.OffsetError, PrecisionToDuration(-20))
+
+	go func() { served <- serveOnce(server, 0) }()
+	_, err = c.Query()
+	require.NoError(t, <-served)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "kiss-o'-death")
+}
+
+func TestClientQueryTimeout(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer server.Close()
+
+	c, err := NewClient(server.LocalAddr().String(), "lo", timestamp.SWTIMESTAMP, 50*time.Millisecond)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Query()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timeout waiting for reply")
+}
+
+func TestNewClientTimestamping(t *testing.T) {
+	_, err := NewClient("127.0.0.1:123", "lo", "magic", time.Second)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unknown timestamping "magic"`)
+}
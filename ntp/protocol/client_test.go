@@ -0,0 +1,101 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortFormatToDuration(t *testing.T) {
+	require.Equal(t, time.Second, ShortFormatToDuration(0x10000))
+	require.Equal(t, 1500*time.Millisecond, ShortFormatToDuration(0x18000))
+	require.Equal(t, time.Duration(0), ShortFormatToDuration(0))
+}
+
+func TestPrecisionToDuration(t *testing.T) {
+	require.Equal(t, time.Second, PrecisionToDuration(0))
+	require.Equal(t, 250*time.Millisecond, PrecisionToDuration(-2))
+	require.Equal(t, time.Duration(953), PrecisionToDuration(-20))
+}
+
+func TestNewRequest(t *testing.T) {
+	request := newRequest(time.Unix(usec, unsec))
+	require.Equal(t, uint8(0x23), request.Settings)
+	require.True(t, request.ValidSettingsFormat())
+	require.Equal(t, nsec, request.TxTimeSec)
+	require.Equal(t, nfrac, request.TxTimeFrac)
+}
+
+func TestIsResponseTo(t *testing.T) {
+	request := newRequest(time.Unix(usec, unsec))
+	response := &Packet{Settings: 0x24, OrigTimeSec: nsec, OrigTimeFrac: nfrac}
+	require.True(t, isResponseTo(request, response))
+
+	response.OrigTimeFrac++
+	require.False(t, isResponseTo(request, response))
+
+	// client mode
+	response = &Packet{Settings: 0x23, OrigTimeSec: nsec, OrigTimeFrac: nfrac}
+	require.False(t, isResponseTo(request, response))
+}
+
+func TestCheckResponse(t *testing.T) {
+	require.NoError(t, checkResponse(&Packet{Settings: 0x24, Stratum: 1}))
+	require.ErrorIs(t, checkResponse(&Packet{Settings: 0xe4, Stratum: 1}), ErrUnsynchronized)
+
+	err := checkResponse(&Packet{Settings: 0xe4, Stratum: 0, ReferenceID: 0x52415445})
+	require.Error(t, err)
+	require.Equal(t, `got kiss-o'-death "RATE"`, err.Error())
+}
+
+func TestNewMeasurement(t *testing.T) {
+	clientTransmit := time.Unix(usec, unsec)
+	serverReceive := clientTransmit.Add(forwardDelay).Add(time.Duration(offset))
+	serverTransmit := serverReceive.Add(time.Millisecond)
+	clientReceive := serverTransmit.Add(returnDelay).Add(-time.Duration(offset))
+	rxSec, rxFrac := Time(serverReceive)
+	txSec, txFrac := Time(serverTransmit)
+	response := &Packet{
+		Settings:       0x24,
+		Stratum:        2,
+		Precision:      -20,
+		RootDelay:      0x8000, // 500ms
+		RootDispersion: 0x1000, // 62.5ms
+		ReferenceID:    0x7f000001,
+		RxTimeSec:      rxSec,
+		RxTimeFrac:     rxFrac,
+		TxTimeSec:      txSec,
+		TxTimeFrac:     txFrac,
+	}
+
+	m := NewMeasurement(response, clientTransmit, clientReceive)
+	require.Equal(t, uint8(2), m.Stratum)
+	require.Equal(t, uint32(0x7f000001), m.ReferenceID)
+	require.InDelta(t, time.Duration(roundTripDelay), m.Delay, 10)
+	// asymmetry of the path shows up in the offset
+	require.InDelta(t, time.Duration(offset)-5*time.Millisecond, m.Offset, 10)
+	require.InDelta(t, 15*time.Millisecond+953, m.OffsetError, 10)
+	require.InDelta(t, 250*time.Millisecond+62500*time.Microsecond+m.OffsetError, m.RootDistance, 10)
+
+	// negative delay doesn't make the error bound smaller
+	m = NewMeasurement(response, clientTransmit, clientTransmit)
+	require.Less(t, m.Delay, time.Duration(0))
+	require.Equal(t, time.Duration(953), m.OffsetError)
+}
@@ -19,6 +19,7 @@ package protocol
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"net"
 )
 
@@ -125,6 +126,29 @@ func (p *Packet) Bytes() ([]byte, error) {
 	return bytes.Bytes(), err
 }
 
+// MarshalBinaryTo serializes Packet into b without allocating, returning number of bytes written
+func (p *Packet) MarshalBinaryTo(b []byte) (int, error) {
+	if len(b) < PacketSizeBytes {
+		return 0, fmt.Errorf("not enough buffer to write Packet: need %d, have %d", PacketSizeBytes, len(b))
+	}
+	b[0] = p.Settings
+	b[1] = p.Stratum
+	b[2] = byte(p.Poll)
+	b[3] = byte(p.Precision)
+	binary.BigEndian.PutUint32(b[4:], p.RootDelay)
+	binary.BigEndian.PutUint32(b[8:], p.RootDispersion)
+	binary.BigEndian.PutUint32(b[12:], p.ReferenceID)
+	binary.BigEndian.PutUint32(b[16:], p.RefTimeSec)
+	binary.BigEndian.PutUint32(b[20:], p.RefTimeFrac)
+	binary.BigEndian.PutUint32(b[24:], p.OrigTimeSec)
+	binary.BigEndian.PutUint32(b[28:], p.OrigTimeFrac)
+	binary.BigEndian.PutUint32(b[32:], p.RxTimeSec)
+	binary.BigEndian.PutUint32(b[36:], p.RxTimeFrac)
+	binary.BigEndian.PutUint32(b[40:], p.TxTimeSec)
+	binary.BigEndian.PutUint32(b[44:], p.TxTimeFrac)
+	return PacketSizeBytes, nil
+}
+
 // UnmarshalBinary fills the Packet from []bytes
 func (p *Packet) UnmarshalBinary(b []byte) error {
 	reader := bytes.NewReader(b)
@@ -0,0 +1,61 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketMarshalBinaryTo(t *testing.T) {
+	p := &Packet{
+		Settings:       0x24,
+		Stratum:        1,
+		Poll:           3,
+		Precision:      -32,
+		RootDelay:      1,
+		RootDispersion: 10,
+		ReferenceID:    0x41544f4d,
+		RefTimeSec:     3,
+		RefTimeFrac:    4,
+		OrigTimeSec:    5,
+		OrigTimeFrac:   6,
+		RxTimeSec:      7,
+		RxTimeFrac:     8,
+		TxTimeSec:      9,
+		TxTimeFrac:     10,
+	}
+	expected, err := p.Bytes()
+	require.NoError(t, err)
+
+	b := make([]byte, 64)
+	n, err := p.MarshalBinaryTo(b)
+	require.NoError(t, err)
+	require.Equal(t, PacketSizeBytes, n)
+	require.Equal(t, expected, b[:n])
+
+	parsed, err := BytesToPacket(b[:n])
+	require.NoError(t, err)
+	require.Equal(t, p, parsed)
+}
+
+func TestPacketMarshalBinaryToShortBuffer(t *testing.T) {
+	p := &Packet{}
+	_, err := p.MarshalBinaryTo(make([]byte, PacketSizeBytes-1))
+	require.Error(t, err)
+}
@@ -0,0 +1,201 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package admin implements authenticated API to get and change runtime configuration of the responder.
+It's served either over unix socket, where access is controlled by file permissions,
+or over HTTPS, where clients have to present a certificate signed by configured CA.
+*/
+package admin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/facebook/time/ntp/responder/server"
+)
+
+// ConfigPath is the http path runtime config is read and changed on
+const ConfigPath = "/config"
+
+// Configurable is a server which runtime config can be changed
+type Configurable interface {
+	RuntimeConfig() server.RuntimeConfig
+	SetRuntimeConfig(c server.RuntimeConfig) error
+}
+
+// Config describes where admin API is served
+type Config struct {
+	// Socket is a path to unix socket, only accessible by the owner
+	Socket string
+	// Addr is an address to serve HTTPS on, clients must present certificate signed by ClientCAFile
+	Addr         string
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+// Enabled returns true if admin API is served on any listener
+func (c *Config) Enabled() bool {
+	return c.Socket != "" || c.Addr != ""
+}
+
+// Validate Config is sane
+func (c *Config) Validate() error {
+	if c.Addr != "" && (c.CertFile == "" || c.KeyFile == "" || c.ClientCAFile == "") {
+		return fmt.Errorf("certificate, key and client CA are required to serve admin API on %s", c.Addr)
+	}
+	return nil
+}
+
+// Handler returns http handler of admin API
+func Handler(c Configurable) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ConfigPath, func(w http.ResponseWriter, r *http.Request) {
+		handleConfig(c, w, r)
+	})
+	return mux
+}
+
+// peer describes who sent the request, for audit
+func peer(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return fmt.Sprintf("%q from %s", r.TLS.PeerCertificates[0].Subject.CommonName, r.RemoteAddr)
+	}
+	return "unix socket"
+}
+
+// handleConfig replies with runtime config on GET.
+// On POST fields present in JSON body replace ones in current runtime config
+func handleConfig(c Configurable, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		cfg := c.RuntimeConfig()
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			http.Error(w, fmt.Sprintf("parsing config: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := c.SetRuntimeConfig(cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Warningf("[admin] runtime config changed by %s to %+v", peer(r), cfg)
+	default:
+		http.Error(w, "only GET and POST are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	js, err := json.Marshal(c.RuntimeConfig())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(js); err != nil {
+		log.Errorf("[admin] failed to reply: %v", err)
+	}
+}
+
+// listenUnix listens on unix socket only the owner can connect to, replacing stale socket file
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("removing stale socket %s: %w", path, err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("restricting access to %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// listenTLS listens for HTTPS, requiring clients to present certificate signed by client CA
+func listenTLS(c *Config) (net.Listener, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate: %w", err)
+	}
+	ca, err := os.ReadFile(c.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", c.ClientCAFile)
+	}
+	return tls.Listen("tcp", c.Addr, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+}
+
+// listeners opens all configured listeners
+func listeners(c *Config) ([]net.Listener, error) {
+	ls := []net.Listener{}
+	if c.Socket != "" {
+		l, err := listenUnix(c.Socket)
+		if err != nil {
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	if c.Addr != "" {
+		l, err := listenTLS(c)
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+// Start serves admin API on all configured listeners, until any of them fails
+func Start(c *Config, cfg Configurable) error {
+	ls, err := listeners(c)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: Handler(cfg), ReadHeaderTimeout: 5 * time.Second}
+	errs := make(chan error, len(ls))
+	for _, l := range ls {
+		log.Infof("Serving admin API on %s", l.Addr())
+		go func(l net.Listener) {
+			errs <- srv.Serve(l)
+		}(l)
+	}
+	err = <-errs
+	srv.Close()
+	return err
+}
@@ -0,0 +1,241 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/ntp/responder/server"
+)
+
+func request(t *testing.T, c *http.Client, method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func TestConfigValidate(t *testing.T) {
+	c := &Config{}
+	require.False(t, c.Enabled())
+	require.NoError(t, c.Validate())
+
+	c.Socket = "/run/ntpresponder.sock"
+	require.True(t, c.Enabled())
+	require.NoError(t, c.Validate())
+
+	c.Addr = "[::1]:4443"
+	require.EqualError(t, c.Validate(), "certificate, key and client CA are required to serve admin API on [::1]:4443")
+	c.CertFile, c.KeyFile, c.ClientCAFile = "cert.pem", "key.pem", "ca.pem"
+	require.NoError(t, c.Validate())
+}
+
+func TestHandler(t *testing.T) {
+	s := &server.Server{Stratum: 1}
+	ts := httptest.NewServer(Handler(s))
+	defer ts.Close()
+	c := ts.Client()
+
+	code, body := request(t, c, http.MethodGet, ts.URL+ConfigPath, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, `{"stratum":1,"drain":false,"blocklist":[]}`, body)
+
+	// only fields present are changed
+	code, body = request(t, c, http.MethodPost, ts.URL+ConfigPath, `{"blocklist": ["192.168.0.0/16"]}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, `{"stratum":1,"drain":false,"blocklist":["192.168.0.0/16"]}`, body)
+	code, body = request(t, c, http.MethodPost, ts.URL+ConfigPath, `{"stratum": 2, "drain": true}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, `{"stratum":2,"drain":true,"blocklist":["192.168.0.0/16"]}`, body)
+	require.Equal(t, server.RuntimeConfig{Stratum: 2, Drain: true, Blocklist: []string{"192.168.0.0/16"}}, s.RuntimeConfig())
+
+	// invalid changes are refused as a whole
+	code, body = request(t, c, http.MethodPost, ts.URL+ConfigPath, `{"stratum": 16, "drain": false}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, "stratum must be between 1 and 15, got 16", body)
+	code, body = request(t, c, http.MethodPost, ts.URL+ConfigPath, `{"smear": true}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, `parsing config: json: unknown field "smear"`, body)
+	require.Equal(t, server.RuntimeConfig{Stratum: 2, Drain: true, Blocklist: []string{"192.168.0.0/16"}}, s.RuntimeConfig())
+
+	code, _ = request(t, c, http.MethodPut, ts.URL+ConfigPath, `{}`)
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+}
+
+func TestStartUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	// stale socket is replaced
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+
+	s := &server.Server{Stratum: 1}
+	go func() {
+		_ = Start(&Config{Socket: path}, s)
+	}()
+	c := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	require.Eventually(t, func() bool {
+		fi, err := os.Stat(path)
+		return err == nil && fi.Mode()&os.ModeSocket != 0
+	}, time.Second, 10*time.Millisecond)
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	code, body := request(t, c, http.MethodPost, "http://unix"+ConfigPath, `{"stratum": 3}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, `{"stratum":3,"drain":false,"blocklist":[]}`, body)
+}
+
+// testCA issues certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM encoded certificate and key
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestListenersTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "admin CA")
+	certPEM, keyPEM := ca.issue(t, "ntpresponder", x509.ExtKeyUsageServerAuth)
+	c := &Config{
+		Addr:         "127.0.0.1:0",
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	require.NoError(t, os.WriteFile(c.CertFile, certPEM, 0600))
+	require.NoError(t, os.WriteFile(c.KeyFile, keyPEM, 0600))
+	require.NoError(t, os.WriteFile(c.ClientCAFile, ca.pem, 0600))
+
+	ls, err := listeners(c)
+	require.NoError(t, err)
+	require.Len(t, ls, 1)
+	s := &server.Server{Stratum: 1}
+	srv := &http.Server{Handler: Handler(s)}
+	go func() {
+		_ = srv.Serve(ls[0])
+	}()
+	defer srv.Close()
+	url := "https://" + ls[0].Addr().String() + ConfigPath
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	client := func(certPEM, keyPEM []byte) *http.Client {
+		tc := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		if certPEM != nil {
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			require.NoError(t, err)
+			tc.Certificates = []tls.Certificate{cert}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tc}}
+	}
+
+	// client certificate signed by configured CA is accepted
+	code, body := request(t, client(ca.issue(t, "operator", x509.ExtKeyUsageClientAuth)), http.MethodPost, url, `{"drain": true}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, `{"stratum":1,"drain":true,"blocklist":[]}`, body)
+
+	// no certificate, or certificate signed by some other CA are refused
+	for _, cl := range []*http.Client{client(nil, nil), client(newTestCA(t, "other CA").issue(t, "operator", x509.ExtKeyUsageClientAuth))} {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		resp, err := cl.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		require.Error(t, err)
+	}
+	require.True(t, s.RuntimeConfig().Drain)
+}
+
+func TestListenersTLSMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	_, err := listeners(&Config{
+		Socket:       filepath.Join(dir, "admin.sock"),
+		Addr:         "127.0.0.1:0",
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "loading certificate")
+}
@@ -0,0 +1,123 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"container/list"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultClientCacheSize is how many recently seen clients each listener remembers by default
+const DefaultClientCacheSize = 4096
+
+// clientKey identifies a client by its IP address. Port is ignored, as clients usually send from ephemeral ports
+type clientKey [16]byte
+
+// sockaddrToClientKey returns key of the client, IPv4 addresses are IPv4-mapped
+func sockaddrToClientKey(sa unix.Sockaddr) clientKey {
+	var key clientKey
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		key[10] = 0xff
+		key[11] = 0xff
+		copy(key[12:], sa.Addr[:])
+	case *unix.SockaddrInet6:
+		key = sa.Addr
+	}
+	return key
+}
+
+// clientEntry is what listener remembers about a recently seen client,
+// so repeated requests from it skip classification done for the previous ones
+type clientEntry struct {
+	key clientKey
+	// rt is runtime state the blocked verdict was made with. The verdict is stale once the state is replaced
+	rt      *runtimeState
+	blocked bool
+	// settings are LI, VN and Mode of the last request, valid is whether they passed format check
+	settings uint8
+	valid    bool
+	known    bool
+}
+
+// isBlocked returns true if requests from the client are dropped, reusing verdict made with the current runtime state
+func (e *clientEntry) isBlocked(rt *runtimeState, sa unix.Sockaddr) bool {
+	if e.rt != rt {
+		e.rt = rt
+		e.blocked = rt.blocked(sa)
+	}
+	return e.blocked
+}
+
+// validSettings returns true if LI, VN and Mode of the request are valid, reusing verdict made for the previous request of the client
+func (e *clientEntry) validSettings(request *ntp.Packet) bool {
+	if !e.known || e.settings != request.Settings {
+		e.settings = request.Settings
+		e.valid = request.ValidSettingsFormat()
+		e.known = true
+	}
+	return e.valid
+}
+
+// clientCache is an LRU of recently seen clients.
+// It's owned by a single listener and is not safe for concurrent use
+type clientCache struct {
+	size    int
+	entries map[clientKey]*list.Element
+	lru     *list.List
+}
+
+// newClientCache returns cache of up to size clients, nil if size is not positive
+func newClientCache(size int) *clientCache {
+	if size <= 0 {
+		return nil
+	}
+	return &clientCache{
+		size:    size,
+		entries: make(map[clientKey]*list.Element, size),
+		lru:     list.New(),
+	}
+}
+
+// get returns entry of the client and whether it was cached.
+// Missing entry is created, replacing the least recently used one if cache is full
+func (c *clientCache) get(key clientKey) (*clientEntry, bool) {
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*clientEntry), true
+	}
+	if c.lru.Len() < c.size {
+		e := &clientEntry{key: key}
+		c.entries[key] = c.lru.PushFront(e)
+		return e, false
+	}
+	// reuse the evicted element, so warm cache doesn't allocate
+	el := c.lru.Back()
+	e := el.Value.(*clientEntry)
+	delete(c.entries, e.key)
+	*e = clientEntry{key: key}
+	c.entries[key] = el
+	c.lru.MoveToFront(el)
+	return e, false
+}
+
+// len returns number of cached clients
+func (c *clientCache) len() int {
+	return c.lru.Len()
+}
@@ -0,0 +1,111 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+	"github.com/facebook/time/timestamp"
+)
+
+func testClientKey(ip string) clientKey {
+	return sockaddrToClientKey(timestamp.IPToSockaddr(net.ParseIP(ip), 123))
+}
+
+func TestSockaddrToClientKey(t *testing.T) {
+	require.Equal(t, testClientKey("192.168.0.1"), testClientKey("::ffff:192.168.0.1"))
+	require.Equal(t, testClientKey("192.168.0.1"), sockaddrToClientKey(timestamp.IPToSockaddr(net.ParseIP("192.168.0.1"), 4242)), "port is ignored")
+	require.NotEqual(t, testClientKey("192.168.0.1"), testClientKey("192.168.0.2"))
+	require.NotEqual(t, testClientKey("2001:db8::1"), testClientKey("2001:db8::2"))
+}
+
+func TestClientCacheDisabled(t *testing.T) {
+	require.Nil(t, newClientCache(0))
+	require.Nil(t, newClientCache(-1))
+}
+
+func TestClientCacheLRU(t *testing.T) {
+	c := newClientCache(2)
+
+	a, hit := c.get(testClientKey("10.0.0.1"))
+	require.False(t, hit)
+	a.blocked = true
+	_, hit = c.get(testClientKey("10.0.0.2"))
+	require.False(t, hit)
+	require.Equal(t, 2, c.len())
+
+	// 10.0.0.1 becomes the most recently used
+	got, hit := c.get(testClientKey("10.0.0.1"))
+	require.True(t, hit)
+	require.Same(t, a, got)
+
+	// so 10.0.0.2 is evicted
+	e, hit := c.get(testClientKey("10.0.0.3"))
+	require.False(t, hit)
+	require.False(t, e.blocked, "reused entry must be reset")
+	require.Equal(t, 2, c.len())
+	_, hit = c.get(testClientKey("10.0.0.1"))
+	require.True(t, hit)
+	_, hit = c.get(testClientKey("10.0.0.2"))
+	require.False(t, hit)
+	_, hit = c.get(testClientKey("10.0.0.3"))
+	require.False(t, hit)
+	require.Equal(t, 2, c.len())
+}
+
+func TestClientEntryIsBlocked(t *testing.T) {
+	blocklist, err := parseBlocklist([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	blocking := &runtimeState{blocklist: blocklist}
+	sa := timestamp.IPToSockaddr(net.ParseIP("10.1.2.3"), 123)
+
+	e := &clientEntry{}
+	require.True(t, e.isBlocked(blocking, sa))
+	// verdict is reused while runtime state is the same
+	e.blocked = false
+	require.False(t, e.isBlocked(blocking, sa))
+	// and made again once it's replaced
+	require.True(t, e.isBlocked(&runtimeState{blocklist: blocklist}, sa))
+	require.False(t, e.isBlocked(&runtimeState{}, sa))
+}
+
+func TestClientEntryValidSettings(t *testing.T) {
+	e := &clientEntry{}
+	require.True(t, e.validSettings(&ntp.Packet{Settings: 0x1B}))
+	require.True(t, e.validSettings(&ntp.Packet{Settings: 0x1B}))
+	require.False(t, e.validSettings(&ntp.Packet{Settings: 0x1C}))
+	require.True(t, e.validSettings(&ntp.Packet{Settings: 0x23}))
+	require.False(t, (&clientEntry{}).validSettings(&ntp.Packet{}))
+}
+
+func BenchmarkClientCacheGet(b *testing.B) {
+	c := newClientCache(DefaultClientCacheSize)
+	keys := make([]clientKey, 2*DefaultClientCacheSize)
+	for i := range keys {
+		keys[i][0] = byte(i)
+		keys[i][1] = byte(i >> 8)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.get(keys[i%len(keys)])
+	}
+}
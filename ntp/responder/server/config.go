@@ -19,6 +19,7 @@ package server
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 )
 
@@ -31,6 +32,105 @@ type ListenConfig struct {
 	Port           int
 	ShouldAnnounce bool
 	Iface          string
+	// Listeners are explicitly configured addresses, each with it's own port and (optionally) workers.
+	// If set, IPs and Port are ignored.
+	Listeners MultiListenAddrs
+}
+
+// Addrs returns all addresses server should listen on
+func (c *ListenConfig) Addrs() []ListenAddr {
+	if len(c.Listeners) != 0 {
+		return c.Listeners
+	}
+	addrs := make([]ListenAddr, 0, len(c.IPs))
+	for _, ip := range c.IPs {
+		addrs = append(addrs, ListenAddr{IP: ip, Port: c.Port})
+	}
+	return addrs
+}
+
+// AllIPs returns unique IPs from all addresses server should listen on
+func (c *ListenConfig) AllIPs() []net.IP {
+	addrs := c.Addrs()
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		found := false
+		for _, ip := range ips {
+			if ip.Equal(addr.IP) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ips = append(ips, addr.IP)
+		}
+	}
+	return ips
+}
+
+// ListenAddr is a single address to listen on.
+// Workers is number of workers dedicated to this listener, if 0 listener will use shared pool of workers.
+type ListenAddr struct {
+	IP      net.IP
+	Port    int
+	Workers int
+}
+
+// String returns ip:port[/workers] representation of ListenAddr
+func (l ListenAddr) String() string {
+	addr := net.JoinHostPort(l.IP.String(), strconv.Itoa(l.Port))
+	if l.Workers == 0 {
+		return addr
+	}
+	return fmt.Sprintf("%s/%d", addr, l.Workers)
+}
+
+// ParseListenAddr parses ip:port[/workers] into ListenAddr
+func ParseListenAddr(s string) (ListenAddr, error) {
+	l := ListenAddr{}
+	addr, workers, found := strings.Cut(s, "/")
+	if found {
+		w, err := strconv.Atoi(workers)
+		if err != nil || w < 1 {
+			return l, fmt.Errorf("invalid number of workers %q in %q", workers, s)
+		}
+		l.Workers = w
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return l, fmt.Errorf("invalid listen address %q: %w", s, err)
+	}
+	l.IP = net.ParseIP(host)
+	if l.IP == nil {
+		return l, fmt.Errorf("invalid ip address %q in %q", host, s)
+	}
+	l.Port, err = strconv.Atoi(port)
+	if err != nil || l.Port < 1 || l.Port > 65535 {
+		return l, fmt.Errorf("invalid port %q in %q", port, s)
+	}
+	return l, nil
+}
+
+// MultiListenAddrs is a wrapper allowing to set multiple listen addresses with flag parser
+type MultiListenAddrs []ListenAddr
+
+// Set adds listen address to the list
+func (m *MultiListenAddrs) Set(s string) error {
+	l, err := ParseListenAddr(s)
+	if err != nil {
+		return err
+	}
+	*m = append(*m, l)
+	return nil
+}
+
+// String returns joined list of listen addresses
+func (m *MultiListenAddrs) String() string {
+	addrs := make([]string, 0, len(*m))
+	for _, l := range *m {
+		addrs = append(addrs, l.String())
+	}
+	return strings.Join(addrs, ", ")
 }
 
 // MultiIPs is a wrapper allowing to set multiple IPs with flag parser
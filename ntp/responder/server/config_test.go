@@ -61,3 +61,45 @@ func TestConfigSetDefault(t *testing.T) {
 
 	require.Equal(t, DefaultServerIPs, m)
 }
+
+func TestParseListenAddr(t *testing.T) {
+	l, err := ParseListenAddr("[::1]:1123/10")
+	require.NoError(t, err)
+	require.Equal(t, ListenAddr{IP: net.ParseIP("::1"), Port: 1123, Workers: 10}, l)
+	require.Equal(t, "[::1]:1123/10", l.String())
+
+	l, err = ParseListenAddr("1.2.3.4:123")
+	require.NoError(t, err)
+	require.Equal(t, ListenAddr{IP: net.ParseIP("1.2.3.4"), Port: 123}, l)
+	require.Equal(t, "1.2.3.4:123", l.String())
+
+	for _, invalid := range []string{"", "1.2.3.4", "invalid:123", "1.2.3.4:0", "1.2.3.4:abc", "1.2.3.4:123/0", "1.2.3.4:123/abc"} {
+		_, err = ParseListenAddr(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestMultiListenAddrsSetString(t *testing.T) {
+	m := MultiListenAddrs{}
+	require.NoError(t, m.Set("1.2.3.4:123"))
+	require.NoError(t, m.Set("[::1]:1123/5"))
+	require.Error(t, m.Set("invalid"))
+	require.Len(t, m, 2)
+	require.Equal(t, "1.2.3.4:123, [::1]:1123/5", m.String())
+}
+
+func TestListenConfigAddrs(t *testing.T) {
+	c := ListenConfig{
+		IPs:  MultiIPs{net.ParseIP("1.2.3.4"), net.ParseIP("::1")},
+		Port: 123,
+	}
+	require.Equal(t, []ListenAddr{{IP: net.ParseIP("1.2.3.4"), Port: 123}, {IP: net.ParseIP("::1"), Port: 123}}, c.Addrs())
+	require.Equal(t, []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("::1")}, c.AllIPs())
+
+	c.Listeners = MultiListenAddrs{
+		{IP: net.ParseIP("::1"), Port: 123},
+		{IP: net.ParseIP("::1"), Port: 1123, Workers: 5},
+	}
+	require.Equal(t, []ListenAddr(c.Listeners), c.Addrs())
+	require.Equal(t, []net.IP{net.ParseIP("::1")}, c.AllIPs())
+}
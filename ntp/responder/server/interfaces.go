@@ -18,6 +18,8 @@ package server
 
 import (
 	"net"
+
+	ntp "github.com/facebook/time/ntp/protocol"
 )
 
 // Stats is a metric collection interface
@@ -38,6 +40,16 @@ type Stats interface {
 	IncWorkers()
 	// IncReadError atomically add 1 to the counter
 	IncReadError()
+	// IncBlocked atomically add 1 to the counter
+	IncBlocked()
+	// IncSteered atomically add 1 to the counter
+	IncSteered()
+	// IncDeclined atomically add 1 to the counter
+	IncDeclined()
+	// IncClientCacheHit atomically add 1 to the counter
+	IncClientCacheHit()
+	// IncClientCacheMiss atomically add 1 to the counter
+	IncClientCacheMiss()
 
 	// DecListeners atomically removes 1 from the counter
 	DecListeners()
@@ -76,3 +88,12 @@ type Checker interface {
 	// DecWorkers atomically removes 1 from the counter
 	DecWorkers()
 }
+
+// Steering decides per request how the server answers, for example to shift clients of some prefixes
+// to another server pool while it is being rebalanced
+type Steering interface {
+	// Steer is called for every valid request before response timestamps are filled in.
+	// It may replace reference data of the response (stratum, reference ID, root delay and dispersion).
+	// It returns steered if response was changed, and answer as false to drop the request
+	Steer(client net.IP, request, response *ntp.Packet) (answer, steered bool)
+}
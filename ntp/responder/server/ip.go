@@ -55,7 +55,7 @@ func (s *Server) deleteIPFromInterface(vip net.IP) error {
 
 // DeleteAllIPs deletes all IPs from interface specified in config
 func (s *Server) DeleteAllIPs() {
-	for _, vip := range s.ListenConfig.IPs {
+	for _, vip := range s.ListenConfig.AllIPs() {
 		if err := s.deleteIPFromInterface(vip); err != nil {
 			// Don't return error. Continue deleting
 			log.Errorf("[server]: %v", err)
@@ -0,0 +1,189 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+/*
+Experimental NTP over PTP support, as described in draft-mlichvar-ntp-ntp-over-ptp and implemented by chrony.
+NTP message is carried in NTP TLV of unicast PTP Delay_Req message with domain 123, sent to PTP event port.
+This way NTP clients behind firewalls that only let PTP through can still get time,
+and both sides get their packets timestamped the same way PTP packets are.
+*/
+const (
+	// ptpDomainNTP is PTP domain used by NTP over PTP
+	ptpDomainNTP = 123
+	// ptpTLVNTP is a TLV carrying NTP message
+	ptpTLVNTP ptp.TLVType = 0x2023
+	// ptpNTPPrefixLength is size of PTP header, origin timestamp and TLV header preceding NTP message
+	ptpNTPPrefixLength = 48
+	// ntpKeyIDLength is size of key ID preceding message digest
+	ntpKeyIDLength = 4
+	// ntpMACLength is size of key ID and SHA1 message digest appended to authenticated NTP packet
+	ntpMACLength = ntpKeyIDLength + sha1.Size
+)
+
+var (
+	errNotNTPOverPTP = errors.New("not an NTP over PTP message")
+	errNTPAuth       = errors.New("NTP authentication failed")
+)
+
+// NTPOverPTPConfig configures experimental NTP over PTP mode
+type NTPOverPTPConfig struct {
+	Enabled bool
+	// Port to serve NTP over PTP on, PTP event port by default
+	Port int
+	// KeyID and Key of SHA1 symmetric key. If Key is set, requests must be authenticated with it, and responses are signed
+	KeyID uint32
+	Key   []byte
+}
+
+// ReadNTPKey reads first SHA1 key from keys file in ntpd/chrony format, where each line is "ID TYPE KEY",
+// and KEY is either ASCII string or hex string prefixed by HEX:
+func ReadNTPKey(path string) (uint32, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexAny(line, "#!"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.EqualFold(fields[1], "SHA1") {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid key id %q: %w", fields[0], err)
+		}
+		key := []byte(fields[2])
+		if strings.HasPrefix(fields[2], "HEX:") {
+			key, err = hex.DecodeString(strings.TrimPrefix(fields[2], "HEX:"))
+			if err != nil {
+				return 0, nil, fmt.Errorf("invalid key %d: %w", id, err)
+			}
+		}
+		if len(key) == 0 {
+			return 0, nil, fmt.Errorf("empty key %d", id)
+		}
+		return uint32(id), key, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, nil, err
+	}
+	return 0, nil, fmt.Errorf("no SHA1 key found in %s", path)
+}
+
+// ntpDigest calculates legacy NTP MAC digest of the message
+func ntpDigest(key, msg []byte) []byte {
+	h := sha1.New()
+	h.Write(key)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// decode returns NTP packet carried in NTP over PTP message, verifying its MAC if key is configured
+func (c *NTPOverPTPConfig) decode(b []byte) ([]byte, error) {
+	if len(b) < ptpNTPPrefixLength+ntp.PacketSizeBytes {
+		return nil, errNotNTPOverPTP
+	}
+	// header fields are read at the same offsets encodeTo writes them
+	tlvType := ptp.TLVType(binary.BigEndian.Uint16(b[ptpNTPPrefixLength-4:]))
+	msgLen := int(binary.BigEndian.Uint16(b[ptpNTPPrefixLength-2:]))
+	if ptp.SdoIDAndMsgType(b[0]).MsgType() != ptp.MessageDelayReq ||
+		b[1]&ptp.MajorVersionMask != ptp.MajorVersion ||
+		int(binary.BigEndian.Uint16(b[2:])) != len(b) ||
+		b[4] != ptpDomainNTP ||
+		binary.BigEndian.Uint16(b[6:]) != ptp.FlagUnicast ||
+		tlvType != ptpTLVNTP ||
+		ptpNTPPrefixLength+msgLen != len(b) {
+		return nil, errNotNTPOverPTP
+	}
+	msg := b[ptpNTPPrefixLength:]
+	if len(c.Key) == 0 {
+		return msg, nil
+	}
+	if len(msg) != ntp.PacketSizeBytes+ntpMACLength {
+		return nil, fmt.Errorf("%w: unexpected message length %d", errNTPAuth, len(msg))
+	}
+	mac := msg[ntp.PacketSizeBytes:]
+	if keyID := binary.BigEndian.Uint32(mac); keyID != c.KeyID {
+		return nil, fmt.Errorf("%w: unknown key %d", errNTPAuth, keyID)
+	}
+	if subtle.ConstantTimeCompare(mac[ntpKeyIDLength:], ntpDigest(c.Key, msg[:ntp.PacketSizeBytes])) != 1 {
+		return nil, fmt.Errorf("%w: bad digest", errNTPAuth)
+	}
+	return msg[:ntp.PacketSizeBytes], nil
+}
+
+// encode wraps NTP packet into NTP over PTP message, signing it if key is configured
+func (c *NTPOverPTPConfig) encode(msg []byte) []byte {
+	b := make([]byte, c.encodedLength(len(msg)))
+	copy(b[ptpNTPPrefixLength:], msg)
+	return b[:c.encodeTo(b, len(msg))]
+}
+
+// encodedLength returns size of NTP over PTP message carrying NTP message of msgLen bytes
+func (c *NTPOverPTPConfig) encodedLength(msgLen int) int {
+	if len(c.Key) > 0 {
+		msgLen += ntpMACLength
+	}
+	return ptpNTPPrefixLength + msgLen
+}
+
+// encodeTo wraps NTP message of msgLen bytes, already placed in b right after the PTP prefix, into NTP over PTP message in place.
+// b must fit encodedLength(msgLen) bytes. It returns length of the resulting message
+func (c *NTPOverPTPConfig) encodeTo(b []byte, msgLen int) int {
+	msg := b[ptpNTPPrefixLength : ptpNTPPrefixLength+msgLen]
+	total := c.encodedLength(msgLen)
+	b[0] = byte(ptp.NewSdoIDAndMsgType(ptp.MessageDelayReq, 0))
+	b[1] = ptp.MajorVersion
+	binary.BigEndian.PutUint16(b[2:], uint16(total))
+	b[4] = ptpDomainNTP
+	b[5] = 0
+	binary.BigEndian.PutUint16(b[6:], ptp.FlagUnicast)
+	// the rest of the header and origin timestamp are left zero
+	for i := 8; i < ptpNTPPrefixLength-4; i++ {
+		b[i] = 0
+	}
+	binary.BigEndian.PutUint16(b[ptpNTPPrefixLength-4:], uint16(ptpTLVNTP))
+	binary.BigEndian.PutUint16(b[ptpNTPPrefixLength-2:], uint16(total-ptpNTPPrefixLength))
+	if len(c.Key) > 0 {
+		mac := b[ptpNTPPrefixLength+msgLen : total]
+		binary.BigEndian.PutUint32(mac, c.KeyID)
+		copy(mac[ntpKeyIDLength:], ntpDigest(c.Key, msg))
+	}
+	return total
+}
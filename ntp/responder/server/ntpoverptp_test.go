@@ -0,0 +1,203 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+	"github.com/facebook/time/ntp/responder/checker"
+	"github.com/facebook/time/ntp/responder/stats"
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+func TestNTPOverPTPEncodeDecode(t *testing.T) {
+	c := &NTPOverPTPConfig{}
+	msg, err := ntpRequest.Bytes()
+	require.NoError(t, err)
+
+	b := c.encode(msg)
+	require.Equal(t, ptpNTPPrefixLength+ntp.PacketSizeBytes, len(b))
+	// same layout chrony uses
+	require.Equal(t, "010200607b00040000000000000000000000000000000000000000000000000000000000000000000000000020230030", hex.EncodeToString(b[:ptpNTPPrefixLength]))
+	got, err := c.decode(b)
+	require.NoError(t, err)
+	require.Equal(t, msg, got)
+
+	// regular PTP Delay_Req is not NTP over PTP
+	delayReq, err := ptp.Bytes(&ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageDelayReq, 0),
+			Version:         ptp.Version,
+			MessageLength:   44,
+			FlagField:       ptp.FlagUnicast,
+		},
+	})
+	require.NoError(t, err)
+	_, err = c.decode(delayReq)
+	require.ErrorIs(t, err, errNotNTPOverPTP)
+
+	// neither is plain NTP
+	_, err = c.decode(msg)
+	require.ErrorIs(t, err, errNotNTPOverPTP)
+
+	wrongDomain := c.encode(msg)
+	wrongDomain[4] = 0
+	_, err = c.decode(wrongDomain)
+	require.ErrorIs(t, err, errNotNTPOverPTP)
+
+	wrongFlags := c.encode(msg)
+	wrongFlags[6] |= 0x2
+	_, err = c.decode(wrongFlags)
+	require.ErrorIs(t, err, errNotNTPOverPTP)
+
+	truncated := c.encode(msg)
+	_, err = c.decode(truncated[:len(truncated)-1])
+	require.ErrorIs(t, err, errNotNTPOverPTP)
+
+	// decoding is on the hot path
+	require.Equal(t, float64(0), testing.AllocsPerRun(100, func() { _, _ = c.decode(b) }))
+}
+
+func TestNTPOverPTPAuth(t *testing.T) {
+	c := &NTPOverPTPConfig{KeyID: 42, Key: []byte("secret")}
+	msg, err := ntpRequest.Bytes()
+	require.NoError(t, err)
+
+	b := c.encode(msg)
+	require.Equal(t, ptpNTPPrefixLength+ntp.PacketSizeBytes+ntpMACLength, len(b))
+	got, err := c.decode(b)
+	require.NoError(t, err)
+	require.Equal(t, msg, got)
+
+	// unauthenticated request
+	_, err = (&NTPOverPTPConfig{}).decode(b)
+	require.NoError(t, err, "server without key accepts any request")
+	_, err = c.decode((&NTPOverPTPConfig{}).encode(msg))
+	require.ErrorIs(t, err, errNTPAuth)
+
+	// different key
+	_, err = c.decode((&NTPOverPTPConfig{KeyID: 42, Key: []byte("guess")}).encode(msg))
+	require.ErrorIs(t, err, errNTPAuth)
+	_, err = c.decode((&NTPOverPTPConfig{KeyID: 1, Key: []byte("secret")}).encode(msg))
+	require.ErrorIs(t, err, errNTPAuth)
+
+	// tampered message
+	b[ptpNTPPrefixLength+40]++
+	_, err = c.decode(b)
+	require.ErrorIs(t, err, errNTPAuth)
+}
+
+func TestNTPOverPTPEncodeTo(t *testing.T) {
+	c := &NTPOverPTPConfig{KeyID: 42, Key: []byte("secret")}
+	msg, err := ntpRequest.Bytes()
+	require.NoError(t, err)
+
+	// worker buffer holds the previous response
+	buf := newResponseBuffer()
+	copy(buf[ptpNTPPrefixLength:], msg)
+	n := c.encodeTo(buf, len(msg))
+	require.Equal(t, c.encode(msg), buf[:n])
+}
+
+func TestReadNTPKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys")
+
+	require.NoError(t, os.WriteFile(path, []byte("# comment\n1 MD5 foo\n2 SHA1 HEX:0a0b0c # test key\n3 SHA1 bar\n"), 0600))
+	id, key, err := ReadNTPKey(path)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), id)
+	require.Equal(t, []byte{0x0a, 0x0b, 0x0c}, key)
+
+	require.NoError(t, os.WriteFile(path, []byte("3 sha1 bar\n"), 0600))
+	id, key, err = ReadNTPKey(path)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), id)
+	require.Equal(t, []byte("bar"), key)
+
+	require.NoError(t, os.WriteFile(path, []byte("1 MD5 foo\n"), 0600))
+	_, _, err = ReadNTPKey(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("1 SHA1 HEX:zz\n"), 0600))
+	_, _, err = ReadNTPKey(path)
+	require.Error(t, err)
+
+	_, _, err = ReadNTPKey(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
+
+func TestNTPOverPTPServer(t *testing.T) {
+	s := &Server{
+		Checker: &checker.SimpleChecker{
+			ExpectedListeners: 1,
+			ExpectedWorkers:   1,
+		},
+		Stats:      &stats.JSONStats{},
+		tasks:      make(chan task, 1),
+		NTPOverPTP: NTPOverPTPConfig{Enabled: true, KeyID: 42, Key: []byte("secret")},
+	}
+	go s.startWorker(s.tasks, s.Stats)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+	localAddr := conn.LocalAddr().(*net.UDPAddr)
+	go s.startNTPOverPTPListener(conn, s.tasks, s.Stats)
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, s.Checker.Check())
+
+	addr := net.JoinHostPort("127.0.0.1", fmt.Sprintf("%d", localAddr.Port))
+	sendConn, err := net.DialTimeout("udp", addr, time.Second)
+	require.NoError(t, err)
+	defer sendConn.Close()
+
+	sec, frac := ntp.Time(time.Now())
+	request := &ntp.Packet{
+		Settings:   0x1B,
+		TxTimeSec:  sec,
+		TxTimeFrac: frac,
+	}
+	msg, err := request.Bytes()
+	require.NoError(t, err)
+	// plain NTP is ignored
+	_, err = sendConn.Write(msg)
+	require.NoError(t, err)
+	_, err = sendConn.Write(s.NTPOverPTP.encode(msg))
+	require.NoError(t, err)
+
+	require.NoError(t, sendConn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 1024)
+	n, err := sendConn.Read(buf)
+	require.NoError(t, err)
+	respBytes, err := s.NTPOverPTP.decode(buf[:n])
+	require.NoError(t, err, "response must be NTP over PTP, signed with our key")
+	response, err := ntp.BytesToPacket(respBytes)
+	require.NoError(t, err)
+	require.Equal(t, sec, response.OrigTimeSec)
+	require.Equal(t, frac, response.OrigTimeFrac)
+	require.Equal(t, uint8(0x1C), response.Settings)
+}
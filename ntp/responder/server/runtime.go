@@ -0,0 +1,158 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/facebook/time/timestamp"
+)
+
+// RuntimeConfig is part of server configuration which can be changed while it's running
+type RuntimeConfig struct {
+	Stratum int  `json:"stratum"`
+	Drain   bool `json:"drain"`
+	// requests from these networks are dropped
+	Blocklist []string `json:"blocklist"`
+}
+
+// Validate RuntimeConfig is sane
+func (c *RuntimeConfig) Validate() error {
+	if c.Stratum < 1 || c.Stratum > 15 {
+		return fmt.Errorf("stratum must be between 1 and 15, got %d", c.Stratum)
+	}
+	_, err := parseBlocklist(c.Blocklist)
+	return err
+}
+
+// parseBlocklist parses networks in CIDR notation, single IPs are treated as /32 or /128
+func parseBlocklist(blocklist []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(blocklist))
+	for _, b := range blocklist {
+		if !strings.Contains(b, "/") {
+			ip := net.ParseIP(b)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid blocklist entry %q", b)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocklist entry %q: %w", b, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// runtimeState is RuntimeConfig ready to be used by listeners and workers
+type runtimeState struct {
+	RuntimeConfig
+	blocklist []*net.IPNet
+}
+
+// blocked returns true if requests from the address are dropped
+func (r *runtimeState) blocked(sa unix.Sockaddr) bool {
+	if len(r.blocklist) == 0 {
+		return false
+	}
+	ip := timestamp.SockaddrToIP(sa)
+	for _, n := range r.blocklist {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// runtimeConfig holds current runtimeState, which is replaced as a whole on every change
+type runtimeConfig struct {
+	sync.Mutex
+	state atomic.Value // *runtimeState
+}
+
+// initRuntime makes server start with runtime config from its static configuration, unless it was already changed
+func (s *Server) initRuntime() {
+	s.rt.state.CompareAndSwap(nil, &runtimeState{RuntimeConfig: RuntimeConfig{Stratum: s.Stratum}})
+}
+
+// runtime returns current runtime config
+func (s *Server) runtime() *runtimeState {
+	if r, ok := s.rt.state.Load().(*runtimeState); ok {
+		return r
+	}
+	return &runtimeState{RuntimeConfig: RuntimeConfig{Stratum: s.Stratum}}
+}
+
+// RuntimeConfig returns copy of the current runtime config
+func (s *Server) RuntimeConfig() RuntimeConfig {
+	c := s.runtime().RuntimeConfig
+	c.Blocklist = append([]string{}, c.Blocklist...)
+	return c
+}
+
+// SetRuntimeConfig validates and applies new runtime config. Draining withdraws announcement right away
+func (s *Server) SetRuntimeConfig(c RuntimeConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	blocklist, err := parseBlocklist(c.Blocklist)
+	if err != nil {
+		return err
+	}
+	s.rt.Lock()
+	defer s.rt.Unlock()
+	prev := s.runtime()
+	c.Blocklist = append([]string{}, c.Blocklist...)
+	s.rt.state.Store(&runtimeState{RuntimeConfig: c, blocklist: blocklist})
+	if prev.Stratum != c.Stratum {
+		log.Warningf("[server] stratum changed from %d to %d", prev.Stratum, c.Stratum)
+	}
+	if len(prev.Blocklist) != 0 || len(c.Blocklist) != 0 {
+		log.Warningf("[server] blocklist is set to %v", c.Blocklist)
+	}
+	if prev.Drain == c.Drain {
+		return nil
+	}
+	if !c.Drain {
+		log.Warningf("[server] undrained, will announce on next run")
+		return nil
+	}
+	log.Warningf("[server] drained")
+	if s.ListenConfig.ShouldAnnounce && s.Announce != nil {
+		if err := s.Announce.Withdraw(); err != nil {
+			log.Errorf("[server] failed to withdraw announce: %v", err)
+		}
+		if s.Stats != nil {
+			s.Stats.ResetAnnounce()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/ntp/responder/stats"
+	"github.com/facebook/time/timestamp"
+)
+
+type countingAnnounce struct {
+	withdrawn int
+}
+
+func (a *countingAnnounce) Advertise([]net.IP) error { return nil }
+
+func (a *countingAnnounce) Withdraw() error {
+	a.withdrawn++
+	return nil
+}
+
+func TestRuntimeConfigValidate(t *testing.T) {
+	c := &RuntimeConfig{Stratum: 1, Blocklist: []string{"10.0.0.0/8", "2001:db8::/32", "192.168.0.1", "::1"}}
+	require.NoError(t, c.Validate())
+
+	c.Stratum = 0
+	require.EqualError(t, c.Validate(), "stratum must be between 1 and 15, got 0")
+	c.Stratum = 16
+	require.EqualError(t, c.Validate(), "stratum must be between 1 and 15, got 16")
+
+	c.Stratum = 2
+	c.Blocklist = []string{"10.0.0.0/33"}
+	require.EqualError(t, c.Validate(), `invalid blocklist entry "10.0.0.0/33": invalid CIDR address: 10.0.0.0/33`)
+	c.Blocklist = []string{"meh"}
+	require.EqualError(t, c.Validate(), `invalid blocklist entry "meh"`)
+}
+
+func TestRuntimeBlocked(t *testing.T) {
+	blocklist, err := parseBlocklist([]string{"10.0.0.0/8", "192.168.0.1", "2001:db8::/32"})
+	require.NoError(t, err)
+	r := &runtimeState{blocklist: blocklist}
+
+	for ip, blocked := range map[string]bool{
+		"10.1.2.3":    true,
+		"11.1.2.3":    false,
+		"192.168.0.1": true,
+		"192.168.0.2": false,
+		"2001:db8::1": true,
+		"2001:db9::1": false,
+	} {
+		sa := timestamp.IPToSockaddr(net.ParseIP(ip), 123)
+		require.Equal(t, blocked, r.blocked(sa), ip)
+	}
+	require.False(t, (&runtimeState{}).blocked(timestamp.IPToSockaddr(net.ParseIP("10.1.2.3"), 123)))
+}
+
+func TestSetRuntimeConfig(t *testing.T) {
+	a := &countingAnnounce{}
+	s := &Server{Stratum: 1, Announce: a, Stats: &stats.JSONStats{}}
+	s.ListenConfig.ShouldAnnounce = true
+	s.initRuntime()
+	require.Equal(t, RuntimeConfig{Stratum: 1, Blocklist: []string{}}, s.RuntimeConfig())
+
+	require.NoError(t, s.SetRuntimeConfig(RuntimeConfig{Stratum: 2, Drain: true, Blocklist: []string{"10.0.0.0/8"}}))
+	require.Equal(t, RuntimeConfig{Stratum: 2, Drain: true, Blocklist: []string{"10.0.0.0/8"}}, s.RuntimeConfig())
+	require.Equal(t, 1, a.withdrawn)
+	require.True(t, s.runtime().blocked(timestamp.IPToSockaddr(net.ParseIP("10.0.0.1"), 123)))
+
+	// staying drained doesn't withdraw again
+	require.NoError(t, s.SetRuntimeConfig(RuntimeConfig{Stratum: 2, Drain: true}))
+	require.Equal(t, 1, a.withdrawn)
+	require.False(t, s.runtime().blocked(timestamp.IPToSockaddr(net.ParseIP("10.0.0.1"), 123)))
+
+	// invalid config is not applied
+	require.Error(t, s.SetRuntimeConfig(RuntimeConfig{Stratum: 16}))
+	require.Equal(t, RuntimeConfig{Stratum: 2, Drain: true, Blocklist: []string{}}, s.RuntimeConfig())
+
+	// initRuntime doesn't override changes made before start
+	s.initRuntime()
+	require.Equal(t, 2, s.RuntimeConfig().Stratum)
+}
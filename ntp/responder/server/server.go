@@ -28,6 +28,7 @@ import (
 	"time"
 
 	ntp "github.com/facebook/time/ntp/protocol"
+	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/facebook/time/timestamp"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
@@ -40,6 +41,8 @@ type task struct {
 	received time.Time
 	request  *ntp.Packet
 	stats    Stats
+	// set if request came encapsulated in PTP message
+	overPTP *NTPOverPTPConfig
 }
 
 // Server is a type for UDP server which handles connections.
@@ -48,45 +51,83 @@ type Server struct {
 	Workers      int
 	Announce     Announce
 	Stats        Stats
-	Checker      Checker
-	tasks        chan task
-	ExtraOffset  time.Duration
-	RefID        string
-	Stratum      int
+	// ListenerStats optionally provides Stats dedicated to a single listener.
+	// If not set, all listeners report to Stats.
+	ListenerStats func(addr ListenAddr) Stats
+	Checker       Checker
+	tasks         chan task
+	ExtraOffset   time.Duration
+	RefID         string
+	Stratum       int
+	// NTPOverPTP is experimental mode serving NTP over PTP event port, disabled by default
+	NTPOverPTP NTPOverPTPConfig
+	// Steering optionally changes or drops responses depending on the client
+	Steering Steering
+	// ClientCacheSize is how many recently seen clients each listener remembers, 0 disables the cache
+	ClientCacheSize int
+	// rt is configuration which can be changed while server is running
+	rt runtimeConfig
 }
 
 // Start UDP server.
 func (s *Server) Start(ctx context.Context, cancelFunc context.CancelFunc) {
+	s.initRuntime()
 	log.Infof("Creating %d goroutine workers", s.Workers)
 	s.tasks = make(chan task, s.Workers)
 	// Pre-create workers
 	for i := 0; i < s.Workers; i++ {
-		go s.startWorker()
+		go s.startWorker(s.tasks, s.Stats)
 	}
 
-	log.Infof("Starting %d listener(s)", len(s.ListenConfig.IPs))
+	addrs := s.ListenConfig.Addrs()
+	log.Infof("Starting %d listener(s)", len(addrs))
 
-	for _, ip := range s.ListenConfig.IPs {
-		log.Infof("Starting listener on %s:%d", ip.String(), s.ListenConfig.Port)
+	// Need to be sure IPs are on interface
+	for _, ip := range s.ListenConfig.AllIPs() {
+		if err := s.addIPToInterface(ip); err != nil {
+			log.Errorf("[server]: %v", err)
+		}
+	}
 
-		go func(ip net.IP) {
-			s.Stats.IncListeners()
-			// Need to be sure IP is on interface:
-			if err := s.addIPToInterface(ip); err != nil {
-				log.Errorf("[server]: %v", err)
+	for _, addr := range addrs {
+		log.Infof("Starting listener on %s", addr)
+		st := s.listenerStats(addr)
+		tasks := s.tasks
+		if addr.Workers > 0 {
+			log.Infof("Creating %d dedicated goroutine workers for %s", addr.Workers, addr)
+			tasks = make(chan task, addr.Workers)
+			for i := 0; i < addr.Workers; i++ {
+				go s.startWorker(tasks, st)
 			}
+		}
 
-			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: s.ListenConfig.Port})
+		go func(addr ListenAddr) {
+			st.IncListeners()
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: addr.IP, Port: addr.Port})
 			if err != nil {
 				log.Fatalf("listening error: %v", err)
 			}
 			defer conn.Close()
-			if err != nil {
-				log.Fatalf("failed to start listener: %v", err)
-			}
-			s.startListener(conn)
-			s.Stats.DecListeners()
-		}(ip)
+			s.startListener(conn, tasks, st)
+			st.DecListeners()
+		}(addr)
+	}
+
+	if s.NTPOverPTP.Enabled {
+		for _, addr := range s.ntpOverPTPAddrs() {
+			log.Warningf("Starting experimental NTP over PTP listener on %s", addr)
+			st := s.listenerStats(addr)
+			go func(addr ListenAddr) {
+				st.IncListeners()
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: addr.IP, Port: addr.Port})
+				if err != nil {
+					log.Fatalf("listening error: %v", err)
+				}
+				defer conn.Close()
+				s.startNTPOverPTPListener(conn, s.tasks, st)
+				st.DecListeners()
+			}(addr)
+		}
 	}
 
 	// Run checker periodically
@@ -108,10 +149,10 @@ func (s *Server) Start(ctx context.Context, cancelFunc context.CancelFunc) {
 		case <-ctx.Done():
 			return
 		case <-time.After(30 * time.Second):
-			if s.ListenConfig.ShouldAnnounce {
+			if s.ListenConfig.ShouldAnnounce && !s.runtime().Drain {
 				// First run will be 30 seconds delayed
 				log.Debug("Requesting VIPs announce")
-				err := s.Announce.Advertise(s.ListenConfig.IPs)
+				err := s.Announce.Advertise(s.ListenConfig.AllIPs())
 				if err != nil {
 					log.Errorf("Error during announcement: %v", err)
 					s.Stats.ResetAnnounce()
@@ -133,7 +174,56 @@ func (s *Server) Stop() {
 	s.DeleteAllIPs()
 }
 
-func (s *Server) startListener(conn *net.UDPConn) {
+// listenerStats returns Stats dedicated to the listener, if configured
+func (s *Server) listenerStats(addr ListenAddr) Stats {
+	if s.ListenerStats != nil {
+		return s.ListenerStats(addr)
+	}
+	return s.Stats
+}
+
+// ntpOverPTPAddrs returns addresses server should serve NTP over PTP on, if enabled
+func (s *Server) ntpOverPTPAddrs() []ListenAddr {
+	if !s.NTPOverPTP.Enabled {
+		return nil
+	}
+	port := s.NTPOverPTP.Port
+	if port == 0 {
+		port = ptp.PortEvent
+	}
+	ips := s.ListenConfig.AllIPs()
+	addrs := make([]ListenAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ListenAddr{IP: ip, Port: port})
+	}
+	return addrs
+}
+
+// ExpectedListeners returns total number of listeners server will run, including NTP over PTP ones
+func (s *Server) ExpectedListeners() int {
+	return len(s.ListenConfig.Addrs()) + len(s.ntpOverPTPAddrs())
+}
+
+// ExpectedWorkers returns total number of workers server will run, including dedicated per-listener workers
+func (s *Server) ExpectedWorkers() int {
+	workers := s.Workers
+	for _, addr := range s.ListenConfig.Addrs() {
+		workers += addr.Workers
+	}
+	return workers
+}
+
+func (s *Server) startListener(conn *net.UDPConn, tasks chan<- task, st Stats) {
+	s.listen(conn, tasks, st, nil)
+}
+
+// startNTPOverPTPListener serves NTP requests encapsulated in PTP messages
+func (s *Server) startNTPOverPTPListener(conn *net.UDPConn, tasks chan<- task, st Stats) {
+	s.listen(conn, tasks, st, &s.NTPOverPTP)
+}
+
+// listen reads requests from conn and hands them over to workers. If overPTP is set, requests are expected to be NTP over PTP
+func (s *Server) listen(conn *net.UDPConn, tasks chan<- task, st Stats, overPTP *NTPOverPTPConfig) {
 	s.Checker.IncListeners()
 	defer s.Checker.DecListeners()
 
@@ -155,6 +245,9 @@ func (s *Server) startListener(conn *net.UDPConn) {
 
 	buf := make([]byte, timestamp.PayloadSizeBytes)
 	oob := make([]byte, timestamp.ControlSizeBytes)
+	cache := newClientCache(s.ClientCacheSize)
+	// used instead of cache entry if cache is disabled
+	var uncached clientEntry
 
 	for {
 		request := new(ntp.Packet)
@@ -162,38 +255,91 @@ func (s *Server) startListener(conn *net.UDPConn) {
 		bbuf, clisa, rxTS, err := timestamp.ReadPacketWithRXTimestampBuf(connFd, buf, oob)
 		if err != nil {
 			log.Errorf("Failed to read packet on %s: %v", conn.LocalAddr(), err)
-			s.Stats.IncReadError()
+			st.IncReadError()
 			continue
 		}
 
-		if err := request.UnmarshalBinary(buf[:bbuf]); err != nil {
+		client := &uncached
+		if cache != nil {
+			var hit bool
+			client, hit = cache.get(sockaddrToClientKey(clisa))
+			if hit {
+				st.IncClientCacheHit()
+			} else {
+				st.IncClientCacheMiss()
+			}
+		} else {
+			uncached = clientEntry{}
+		}
+
+		if client.isBlocked(s.runtime(), clisa) {
+			st.IncBlocked()
+			continue
+		}
+
+		payload := buf[:bbuf]
+		if overPTP != nil {
+			if payload, err = overPTP.decode(payload); err != nil {
+				log.Debugf("Discarding packet on %s: %v", conn.LocalAddr(), err)
+				st.IncInvalidFormat()
+				continue
+			}
+		}
+
+		if err := request.UnmarshalBinary(payload); err != nil {
 			log.Errorf("failed to parse ntp packet: %s", err)
-			s.Stats.IncReadError()
+			st.IncReadError()
 			continue
 		}
-		s.Stats.IncRequests()
-		s.tasks <- task{connFd: connFd, addr: clisa, received: rxTS, request: request, stats: s.Stats}
+		st.IncRequests()
+		// drop invalid requests right away, so they don't occupy workers
+		if !client.validSettings(request) {
+			log.Debugf("Invalid query, discarding: %v", request)
+			st.IncInvalidFormat()
+			continue
+		}
+		tasks <- task{connFd: connFd, addr: clisa, received: rxTS, request: request, stats: st, overPTP: overPTP}
 	}
 }
 
-func (s *Server) startWorker() {
+func (s *Server) startWorker(tasks <-chan task, st Stats) {
 	s.Checker.IncWorkers()
 	defer s.Checker.DecWorkers()
-	defer s.Stats.DecWorkers()
+	defer st.DecWorkers()
 
-	// Pre-allocating response buffer
+	// Pre-allocating response and buffer it's serialized into
 	response := &ntp.Packet{}
+	buf := newResponseBuffer()
 	s.fillStaticHeaders(response)
-	s.Stats.IncWorkers()
+	st.IncWorkers()
 	for {
-		t := <-s.tasks
-		t.serve(response, s.ExtraOffset)
+		t := <-tasks
+		if s.Steering != nil {
+			// previous request might have been steered
+			s.fillStaticHeaders(response)
+		}
+		response.Stratum = uint8(s.runtime().Stratum)
+		t.serve(response, buf, s.ExtraOffset, s.Steering)
+	}
+}
+
+// responseBufferSize fits any response, including signed NTP over PTP one
+const responseBufferSize = ptpNTPPrefixLength + ntp.PacketSizeBytes + ntpMACLength
+
+// newResponseBuffer returns worker's buffer responses are serialized into.
+// Every byte is written, so its memory is faulted in before the first request rather than during a spike
+func newResponseBuffer() []byte {
+	buf := make([]byte, responseBufferSize)
+	for i := range buf {
+		buf[i] = 0xff
 	}
+	return buf
 }
 
 // serve checks the request format
 // gets time from local and respond.
-func (t *task) serve(response *ntp.Packet, extraoffset time.Duration) {
+// Response is serialized into buf, which must be at least responseBufferSize long
+func (t *task) serve(response *ntp.Packet, buf []byte, extraoffset time.Duration, steering Steering) {
 	log.Debugf("Received request: %+v", t.request)
 	if !t.request.ValidSettingsFormat() {
 		log.Debugf("Invalid query, discarding: %v", t.request)
@@ -201,12 +347,33 @@ func (t *task) serve(response *ntp.Packet, extraoffset time.Duration) {
 		return
 	}
 
+	if steering != nil {
+		answer, steered := steering.Steer(timestamp.SockaddrToIP(t.addr), t.request, response)
+		if !answer {
+			log.Debugf("Declined to answer the request: %v", t.request)
+			t.stats.IncDeclined()
+			return
+		}
+		if steered {
+			t.stats.IncSteered()
+		}
+	}
+	// steering goes first, so it doesn't delay transmit timestamp
 	generateResponse(time.Now().Add(extraoffset), t.received.Add(extraoffset), t.request, response)
-	responseBytes, err := response.Bytes()
+	msg := buf
+	if t.overPTP != nil {
+		// leave room for PTP prefix, so NTP over PTP message is built in place
+		msg = buf[ptpNTPPrefixLength:]
+	}
+	n, err := response.MarshalBinaryTo(msg)
 	if err != nil {
-		log.Errorf("Failed to convert ntp.%v to bytes %v: %v", response, responseBytes, err)
+		log.Errorf("Failed to convert ntp.%v to bytes: %v", response, err)
 		return
 	}
+	responseBytes := msg[:n]
+	if t.overPTP != nil {
+		responseBytes = buf[:t.overPTP.encodeTo(buf, n)]
+	}
 
 	log.Debugf("Writing response: %+v", response)
 	if err := unix.Sendto(t.connFd, responseBytes, unix.O_NONBLOCK, t.addr); err != nil {
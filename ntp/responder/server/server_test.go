@@ -117,7 +117,7 @@ func TestListener(t *testing.T) {
 	}
 	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
 	require.Nil(t, err)
-	go s.startListener(conn)
+	go s.startListener(conn, s.tasks, s.Stats)
 	time.Sleep(100 * time.Millisecond)
 
 	err = s.Checker.Check()
@@ -145,13 +145,60 @@ func TestWorker(t *testing.T) {
 
 	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 0)
 
-	go s.startWorker()
+	go s.startWorker(s.tasks, s.Stats)
 	time.Sleep(100 * time.Millisecond)
 	err = s.Checker.Check()
 	require.NoError(t, err)
 	s.tasks <- task{connFd: connFd, addr: sa, received: time.Now(), request: ntpRequest, stats: &stats.JSONStats{}}
 }
 
+// testSteering declines clients from 127.0.0.2 and answers the rest with stratum 2
+type testSteering struct{}
+
+func (testSteering) Steer(client net.IP, _, response *ntp.Packet) (bool, bool) {
+	if client.Equal(net.ParseIP("127.0.0.2")) {
+		return false, false
+	}
+	response.Stratum = 2
+	return true, true
+}
+
+func TestServeSteering(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+	connFd, err := timestamp.ConnFd(conn)
+	require.NoError(t, err)
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer client.Close()
+	clientPort := client.LocalAddr().(*net.UDPAddr).Port
+
+	st := &stats.JSONStats{}
+	response := &ntp.Packet{Stratum: 1}
+	declined := task{connFd: connFd, addr: timestamp.IPToSockaddr(net.ParseIP("127.0.0.2"), clientPort), received: time.Now(), request: ntpRequest, stats: st}
+	declined.serve(response, newResponseBuffer(), 0, testSteering{})
+	steered := task{connFd: connFd, addr: timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), clientPort), received: time.Now(), request: ntpRequest, stats: st}
+	steered.serve(response, newResponseBuffer(), 0, testSteering{})
+
+	buf := make([]byte, 128)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+	// other tests running in parallel may hit our ephemeral port, only the responder counts
+	var n int
+	for {
+		var from *net.UDPAddr
+		n, from, err = client.ReadFromUDP(buf)
+		require.NoError(t, err)
+		if from.Port == conn.LocalAddr().(*net.UDPAddr).Port {
+			break
+		}
+	}
+	got := &ntp.Packet{}
+	require.NoError(t, got.UnmarshalBinary(buf[:n]))
+	require.Equal(t, uint8(2), got.Stratum)
+	require.Equal(t, ntpRequest.TxTimeSec, got.OrigTimeSec)
+}
+
 func TestServer(t *testing.T) {
 	workers := 5
 	requests := 1000
@@ -165,13 +212,13 @@ func TestServer(t *testing.T) {
 	}
 	// create workers
 	for i := 0; i < workers; i++ {
-		go s.startWorker()
+		go s.startWorker(s.tasks, s.Stats)
 	}
 	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
 	require.Nil(t, err)
 	defer conn.Close()
 	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	go s.startListener(conn)
+	go s.startListener(conn, s.tasks, s.Stats)
 
 	time.Sleep(100 * time.Millisecond)
 
@@ -221,3 +268,46 @@ func Benchmark_fillStaticHeaders(b *testing.B) {
 		s.fillStaticHeaders(response)
 	}
 }
+
+func TestExpectedWorkers(t *testing.T) {
+	s := &Server{
+		Workers: 10,
+		ListenConfig: ListenConfig{
+			Listeners: MultiListenAddrs{
+				{IP: net.ParseIP("::1"), Port: 123},
+				{IP: net.ParseIP("::1"), Port: 1123, Workers: 5},
+			},
+		},
+	}
+	require.Equal(t, 15, s.ExpectedWorkers())
+}
+
+func TestExpectedListeners(t *testing.T) {
+	s := &Server{
+		ListenConfig: ListenConfig{
+			Listeners: MultiListenAddrs{
+				{IP: net.ParseIP("::1"), Port: 123},
+				{IP: net.ParseIP("::1"), Port: 1123, Workers: 5},
+			},
+		},
+	}
+	require.Equal(t, 2, s.ExpectedListeners())
+	require.Empty(t, s.ntpOverPTPAddrs())
+
+	// one more listener per unique IP
+	s.NTPOverPTP.Enabled = true
+	require.Equal(t, 3, s.ExpectedListeners())
+	require.Equal(t, []ListenAddr{{IP: net.ParseIP("::1"), Port: 319}}, s.ntpOverPTPAddrs())
+}
+
+func TestListenerStats(t *testing.T) {
+	st := &stats.JSONStats{}
+	s := &Server{Stats: st}
+	addr := ListenAddr{IP: net.ParseIP("::1"), Port: 1123}
+	require.Same(t, st, s.listenerStats(addr))
+
+	s.ListenerStats = func(addr ListenAddr) Stats {
+		return st.ForListener(addr.String())
+	}
+	require.Same(t, st.ForListener(addr.String()), s.listenerStats(addr))
+}
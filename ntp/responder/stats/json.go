@@ -25,6 +25,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"sync/atomic"
 
 	log "github.com/sirupsen/logrus"
@@ -41,11 +42,39 @@ type JSONStats struct {
 	listeners     int64
 	workers       int64
 	readError     int64
+	blocked       int64
+	steered       int64
+	declined      int64
 	announce      int64
+	cacheHit      int64
+	cacheMiss     int64
+
+	// parent receives a copy of every update, so it always has totals across all listeners
+	parent      *JSONStats
+	perListener sync.Map // name -> *JSONStats
+}
+
+// ForListener returns JSONStats dedicated to a single listener.
+// All updates are also accounted in j.
+func (j *JSONStats) ForListener(name string) *JSONStats {
+	l, _ := j.perListener.LoadOrStore(name, &JSONStats{parent: j})
+	return l.(*JSONStats)
 }
 
 // toMap converts struct to a map
 func (j *JSONStats) toMap() (export map[string]int64) {
+	export = j.countersMap()
+	j.perListener.Range(func(k, v any) bool {
+		for key, value := range v.(*JSONStats).countersMap() {
+			export[fmt.Sprintf("listener.%s.%s", k, key)] = value
+		}
+		return true
+	})
+	return export
+}
+
+// countersMap converts own counters to a map
+func (j *JSONStats) countersMap() (export map[string]int64) {
 	export = make(map[string]int64)
 
 	export["invalidformat"] = j.invalidFormat
@@ -54,7 +83,12 @@ func (j *JSONStats) toMap() (export map[string]int64) {
 	export["listeners"] = j.listeners
 	export["workers"] = j.workers
 	export["readError"] = j.readError
+	export["blocked"] = j.blocked
+	export["steered"] = j.steered
+	export["declined"] = j.declined
 	export["announce"] = j.announce
+	export["clientcache.hit"] = j.cacheHit
+	export["clientcache.miss"] = j.cacheMiss
 
 	return export
 }
@@ -86,41 +120,105 @@ func (j *JSONStats) Start(port int) {
 // IncInvalidFormat atomically add 1 to the counter
 func (j *JSONStats) IncInvalidFormat() {
 	atomic.AddInt64(&j.invalidFormat, 1)
+	if j.parent != nil {
+		j.parent.IncInvalidFormat()
+	}
 }
 
 // IncRequests atomically add 1 to the counter
 func (j *JSONStats) IncRequests() {
 	atomic.AddInt64(&j.requests, 1)
+	if j.parent != nil {
+		j.parent.IncRequests()
+	}
 }
 
 // IncResponses atomically add 1 to the counter
 func (j *JSONStats) IncResponses() {
 	atomic.AddInt64(&j.responses, 1)
+	if j.parent != nil {
+		j.parent.IncResponses()
+	}
 }
 
 // IncListeners atomically add 1 to the counter
 func (j *JSONStats) IncListeners() {
 	atomic.AddInt64(&j.listeners, 1)
+	if j.parent != nil {
+		j.parent.IncListeners()
+	}
 }
 
 // IncWorkers atomically add 1 to the counter
 func (j *JSONStats) IncWorkers() {
 	atomic.AddInt64(&j.workers, 1)
+	if j.parent != nil {
+		j.parent.IncWorkers()
+	}
 }
 
 // IncReadError atomically add 1 to the counter
 func (j *JSONStats) IncReadError() {
 	atomic.AddInt64(&j.readError, 1)
+	if j.parent != nil {
+		j.parent.IncReadError()
+	}
+}
+
+// IncBlocked atomically add 1 to the counter
+func (j *JSONStats) IncBlocked() {
+	atomic.AddInt64(&j.blocked, 1)
+	if j.parent != nil {
+		j.parent.IncBlocked()
+	}
+}
+
+// IncSteered atomically add 1 to the counter
+func (j *JSONStats) IncSteered() {
+	atomic.AddInt64(&j.steered, 1)
+	if j.parent != nil {
+		j.parent.IncSteered()
+	}
+}
+
+// IncDeclined atomically add 1 to the counter
+func (j *JSONStats) IncDeclined() {
+	atomic.AddInt64(&j.declined, 1)
+	if j.parent != nil {
+		j.parent.IncDeclined()
+	}
+}
+
+// IncClientCacheHit atomically add 1 to the counter
+func (j *JSONStats) IncClientCacheHit() {
+	atomic.AddInt64(&j.cacheHit, 1)
+	if j.parent != nil {
+		j.parent.IncClientCacheHit()
+	}
+}
+
+// IncClientCacheMiss atomically add 1 to the counter
+func (j *JSONStats) IncClientCacheMiss() {
+	atomic.AddInt64(&j.cacheMiss, 1)
+	if j.parent != nil {
+		j.parent.IncClientCacheMiss()
+	}
 }
 
 // DecListeners atomically removes 1 from the counter
 func (j *JSONStats) DecListeners() {
 	atomic.AddInt64(&j.listeners, -1)
+	if j.parent != nil {
+		j.parent.DecListeners()
+	}
 }
 
 // DecWorkers atomically removes 1 from the counter
 func (j *JSONStats) DecWorkers() {
 	atomic.AddInt64(&j.workers, -1)
+	if j.parent != nil {
+		j.parent.DecWorkers()
+	}
 }
 
 // SetAnnounce atomically sets counter to 1
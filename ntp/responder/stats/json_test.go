@@ -70,6 +70,41 @@ func TestJSONStatsReadError(t *testing.T) {
 	require.Equal(t, int64(1), stats.readError)
 }
 
+func TestJSONStatsBlocked(t *testing.T) {
+	j := JSONStats{}
+	l := j.ForListener("[::1]:123")
+
+	l.IncBlocked()
+	require.Equal(t, int64(1), l.blocked)
+	require.Equal(t, int64(1), j.blocked)
+}
+
+func TestJSONStatsSteered(t *testing.T) {
+	j := JSONStats{}
+	l := j.ForListener("[::1]:123")
+
+	l.IncSteered()
+	l.IncDeclined()
+	l.IncDeclined()
+	require.Equal(t, int64(1), l.steered)
+	require.Equal(t, int64(1), j.steered)
+	require.Equal(t, int64(2), l.declined)
+	require.Equal(t, int64(2), j.declined)
+}
+
+func TestJSONStatsClientCache(t *testing.T) {
+	j := JSONStats{}
+	l := j.ForListener("[::1]:123")
+
+	l.IncClientCacheHit()
+	l.IncClientCacheHit()
+	l.IncClientCacheMiss()
+	require.Equal(t, int64(2), l.cacheHit)
+	require.Equal(t, int64(2), j.cacheHit)
+	require.Equal(t, int64(1), l.cacheMiss)
+	require.Equal(t, int64(1), j.cacheMiss)
+}
+
 func TestJSONStatsAnnounce(t *testing.T) {
 	stats := JSONStats{}
 
@@ -89,6 +124,11 @@ func TestJSONStatsToMap(t *testing.T) {
 		workers:       5,
 		readError:     6,
 		announce:      7,
+		blocked:       8,
+		steered:       9,
+		declined:      10,
+		cacheHit:      11,
+		cacheMiss:     12,
 	}
 	result := j.toMap()
 
@@ -100,6 +140,33 @@ func TestJSONStatsToMap(t *testing.T) {
 	expectedMap["workers"] = 5
 	expectedMap["readError"] = 6
 	expectedMap["announce"] = 7
+	expectedMap["blocked"] = 8
+	expectedMap["steered"] = 9
+	expectedMap["declined"] = 10
+	expectedMap["clientcache.hit"] = 11
+	expectedMap["clientcache.miss"] = 12
 
 	require.Equal(t, expectedMap, result)
 }
+
+func TestJSONStatsForListener(t *testing.T) {
+	j := JSONStats{}
+	l1 := j.ForListener("[::1]:123")
+	l2 := j.ForListener("[::1]:1123")
+	require.Same(t, l1, j.ForListener("[::1]:123"))
+
+	l1.IncRequests()
+	l1.IncResponses()
+	l2.IncRequests()
+	l2.IncWorkers()
+
+	result := j.toMap()
+	require.Equal(t, int64(2), result["requests"])
+	require.Equal(t, int64(1), result["responses"])
+	require.Equal(t, int64(1), result["workers"])
+	require.Equal(t, int64(1), result["listener.[::1]:123.requests"])
+	require.Equal(t, int64(1), result["listener.[::1]:123.responses"])
+	require.Equal(t, int64(0), result["listener.[::1]:123.workers"])
+	require.Equal(t, int64(1), result["listener.[::1]:1123.requests"])
+	require.Equal(t, int64(1), result["listener.[::1]:1123.workers"])
+}
@@ -0,0 +1,172 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package steering implements GeoDNS-style steering of NTP responses by client prefix.
+It allows to gradually shift clients of some networks away from the server,
+or to answer them with different reference data while the server pool is being rebalanced.
+*/
+package steering
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+)
+
+// Rule describes how to answer clients from the prefix
+type Rule struct {
+	// Prefix in CIDR notation
+	Prefix string `json:"prefix"`
+	// Percent of clients from the prefix the rule applies to, 0 means all of them.
+	// Clients are picked by hash of their address, so the same clients are steered every time, and the rest are answered as usual
+	Percent int `json:"percent"`
+	// Decline to answer
+	Decline bool `json:"decline"`
+	// Stratum to answer with, 0 leaves it as is
+	Stratum int `json:"stratum"`
+	// RefID to answer with, empty leaves it as is
+	RefID string `json:"refid"`
+}
+
+// Validate Rule is sane
+func (r *Rule) Validate() error {
+	if _, _, err := net.ParseCIDR(r.Prefix); err != nil {
+		return fmt.Errorf("invalid prefix %q: %w", r.Prefix, err)
+	}
+	if r.Percent < 0 || r.Percent > 100 {
+		return fmt.Errorf("percent must be between 0 and 100, got %d", r.Percent)
+	}
+	if r.Stratum < 0 || r.Stratum > 15 {
+		return fmt.Errorf("stratum must be between 0 and 15, got %d", r.Stratum)
+	}
+	if len(r.RefID) > 4 {
+		return fmt.Errorf("refid must be at most 4 characters, got %q", r.RefID)
+	}
+	return nil
+}
+
+// rule is Rule ready to be matched against
+type rule struct {
+	Rule
+	net   *net.IPNet
+	refID uint32
+}
+
+// applies reports if the rule applies to the client, which must be within the prefix and normalized to 4 bytes if it's IPv4
+func (r *rule) applies(client net.IP) bool {
+	if r.Percent == 0 || r.Percent == 100 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(client)
+	return h.Sum32()%100 < uint32(r.Percent)
+}
+
+// PrefixSteering implements server.Steering, applying the most specific rule matching client address.
+// Rules can be replaced while server is running
+type PrefixSteering struct {
+	rules atomic.Value // []*rule, most specific first
+}
+
+// NewPrefixSteering returns PrefixSteering with the rules
+func NewPrefixSteering(rules []Rule) (*PrefixSteering, error) {
+	s := &PrefixSteering{}
+	if err := s.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ReadRules reads rules from JSON file
+func ReadRules(path string) ([]Rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := []Rule{}
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("parsing steering rules: %w", err)
+	}
+	return rules, nil
+}
+
+// SetRules validates and applies new rules
+func (s *PrefixSteering) SetRules(rules []Rule) error {
+	parsed := make([]*rule, 0, len(rules))
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		_, n, _ := net.ParseCIDR(r.Prefix)
+		if ip4 := n.IP.To4(); ip4 != nil {
+			n.IP = ip4
+		}
+		p := &rule{Rule: r, net: n}
+		if r.RefID != "" {
+			p.refID = binary.BigEndian.Uint32([]byte(fmt.Sprintf("%-4s", r.RefID)))
+		}
+		parsed = append(parsed, p)
+	}
+	sort.SliceStable(parsed, func(i, j int) bool {
+		oi, _ := parsed[i].net.Mask.Size()
+		oj, _ := parsed[j].net.Mask.Size()
+		return oi > oj
+	})
+	s.rules.Store(parsed)
+	return nil
+}
+
+// match returns the most specific rule for the client, nil if there is none
+func (s *PrefixSteering) match(client net.IP) *rule {
+	rules, _ := s.rules.Load().([]*rule)
+	for _, r := range rules {
+		if r.net.Contains(client) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Steer implements server.Steering
+func (s *PrefixSteering) Steer(client net.IP, _, response *ntp.Packet) (answer, steered bool) {
+	if ip4 := client.To4(); ip4 != nil {
+		client = ip4
+	}
+	r := s.match(client)
+	if r == nil || !r.applies(client) {
+		return true, false
+	}
+	if r.Decline {
+		return false, false
+	}
+	if r.Stratum != 0 {
+		response.Stratum = uint8(r.Stratum)
+		steered = true
+	}
+	if r.RefID != "" {
+		response.ReferenceID = r.refID
+		steered = true
+	}
+	return true, steered
+}
@@ -0,0 +1,107 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package steering
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+)
+
+func TestRuleValidate(t *testing.T) {
+	r := Rule{Prefix: "192.168.0.0/16", Percent: 50, Stratum: 2, RefID: "WEST"}
+	require.NoError(t, r.Validate())
+	r.Prefix = "192.168.0.1"
+	require.Error(t, r.Validate())
+	r = Rule{Prefix: "::/0", Percent: 101}
+	require.Error(t, r.Validate())
+	r = Rule{Prefix: "::/0", Stratum: 16}
+	require.Error(t, r.Validate())
+	r = Rule{Prefix: "::/0", RefID: "TOOLONG"}
+	require.Error(t, r.Validate())
+}
+
+func TestPrefixSteeringSteer(t *testing.T) {
+	s, err := NewPrefixSteering([]Rule{
+		{Prefix: "10.0.0.0/8", Stratum: 3, RefID: "EAST"},
+		{Prefix: "10.1.0.0/16", Decline: true},
+		{Prefix: "2401:db00::/32", Stratum: 2},
+	})
+	require.NoError(t, err)
+
+	response := &ntp.Packet{Stratum: 1, ReferenceID: 42}
+	answer, steered := s.Steer(net.ParseIP("192.168.0.1"), nil, response)
+	require.True(t, answer)
+	require.False(t, steered)
+	require.Equal(t, uint8(1), response.Stratum)
+
+	answer, steered = s.Steer(net.ParseIP("10.2.0.1"), nil, response)
+	require.True(t, answer)
+	require.True(t, steered)
+	require.Equal(t, uint8(3), response.Stratum)
+	require.Equal(t, uint32(0x45415354), response.ReferenceID)
+
+	// the most specific rule wins
+	answer, _ = s.Steer(net.ParseIP("10.1.0.1"), nil, response)
+	require.False(t, answer)
+
+	answer, steered = s.Steer(net.ParseIP("2401:db00::1"), nil, response)
+	require.True(t, answer)
+	require.True(t, steered)
+	require.Equal(t, uint8(2), response.Stratum)
+
+	require.NoError(t, s.SetRules(nil))
+	answer, steered = s.Steer(net.ParseIP("10.1.0.1"), nil, response)
+	require.True(t, answer)
+	require.False(t, steered)
+
+	require.Error(t, s.SetRules([]Rule{{Prefix: "nope"}}))
+}
+
+func TestPrefixSteeringPercent(t *testing.T) {
+	s, err := NewPrefixSteering([]Rule{{Prefix: "10.0.0.0/8", Percent: 30, Decline: true}})
+	require.NoError(t, err)
+	declined := 0
+	for i := 0; i < 1000; i++ {
+		client := net.IPv4(10, 0, byte(i/256), byte(i%256))
+		answer, _ := s.Steer(client, nil, &ntp.Packet{})
+		if !answer {
+			declined++
+		}
+		// same client is always steered the same way
+		again, _ := s.Steer(client.To4(), nil, &ntp.Packet{})
+		require.Equal(t, answer, again)
+	}
+	require.InDelta(t, 300, declined, 60)
+}
+
+func TestReadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "steering.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"prefix": "10.0.0.0/8", "percent": 10, "decline": true}]`), 0644))
+	rules, err := ReadRules(path)
+	require.NoError(t, err)
+	require.Equal(t, []Rule{{Prefix: "10.0.0.0/8", Percent: 10, Decline: true}}, rules)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{`), 0644))
+	_, err = ReadRules(path)
+	require.Error(t, err)
+}
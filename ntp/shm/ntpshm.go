@@ -40,11 +40,13 @@ const IPCCREAT = 00001000
 const NTPSHMSize = 96
 
 // NTPSHM Declaration of the SHM segment from ntp (ntpd/refclock_shm.c)
+// Padding is explicit, so both Go and binary layouts match what C compiler does on 64-bit platforms
 type NTPSHM struct {
 	Mode                 int32
 	Count                int32
 	ClockTimeStampSec    int64
 	ClockTimeStampUSec   int32
+	_                    int32
 	ReceiveTimeStampSec  int64
 	ReceiveTimeStampUSec int32
 	Leap                 int32
@@ -54,11 +56,22 @@ type NTPSHM struct {
 	ClockTimeStampNSec   int32
 	ReceiveTimeStampNSec int32
 	Dummy                [8]int32
+	_                    int32
 }
 
 // Create a segment in SHM and return the ID
 func Create() (uintptr, error) {
-	shmID, _, errno := unix.Syscall(unix.SYS_SHMGET, uintptr(SHMKEY), 0, uintptr(IPCCREAT|0600))
+	return CreateUnit(0)
+}
+
+// CreateUnit creates a segment of NTP SHM refclock unit in SHM and returns the ID.
+// Like ntpd does, units 0 and 1 are accessible by owner only, and the rest by everyone
+func CreateUnit(unit int) (uintptr, error) {
+	perm := 0600
+	if unit > 1 {
+		perm = 0666
+	}
+	shmID, _, errno := unix.Syscall(unix.SYS_SHMGET, uintptr(SHMKEY+unit), NTPSHMSize, uintptr(IPCCREAT|perm))
 	if errno != 0 {
 		return 0, fmt.Errorf("failed get shm: %s", unix.ErrnoName(errno))
 	}
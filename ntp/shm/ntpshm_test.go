@@ -17,6 +17,7 @@ limitations under the License.
 package shm
 
 import (
+	"encoding/binary"
 	"testing"
 	"time"
 	"unsafe"
@@ -27,10 +28,11 @@ import (
 )
 
 func TestNTPSHMStruct(t *testing.T) {
-	testBytes := []byte{1, 0, 0, 0, 240, 64, 0, 0, 189, 86, 202, 96, 0, 0, 0, 0, 51, 1, 0, 0, 189, 86, 202, 96, 0, 0, 0, 0, 34, 252, 0, 0, 0, 0, 0, 0, 236, 255, 255, 255, 3, 0, 0, 0, 0, 0, 0, 0, 121, 176, 4, 0, 182, 231, 216, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	testBytes := []byte{1, 0, 0, 0, 240, 64, 0, 0, 189, 86, 202, 96, 0, 0, 0, 0, 51, 1, 0, 0, 0, 0, 0, 0, 189, 86, 202, 96, 0, 0, 0, 0, 34, 252, 0, 0, 0, 0, 0, 0, 236, 255, 255, 255, 3, 0, 0, 0, 0, 0, 0, 0, 121, 176, 4, 0, 182, 231, 216, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
 	if hostendian.IsBigEndian {
-		testBytes = []byte{0, 0, 0, 1, 0, 0, 64, 240, 0, 0, 0, 0, 96, 202, 86, 189, 0, 0, 1, 51, 0, 0, 0, 0, 96, 202, 86, 189, 0, 0, 252, 34, 0, 0, 0, 0, 255, 255, 255, 236, 0, 0, 0, 3, 0, 0, 0, 0, 0, 4, 176, 121, 3, 216, 231, 182, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+		testBytes = []byte{0, 0, 0, 1, 0, 0, 64, 240, 0, 0, 0, 0, 96, 202, 86, 189, 0, 0, 1, 51, 0, 0, 0, 0, 0, 0, 0, 0, 96, 202, 86, 189, 0, 0, 252, 34, 0, 0, 0, 0, 255, 255, 255, 236, 0, 0, 0, 3, 0, 0, 0, 0, 0, 4, 176, 121, 3, 216, 231, 182, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
 	}
+	require.Equal(t, NTPSHMSize, len(testBytes))
 	testNTPSHM := NTPSHM{
 		Mode:                 1,
 		Count:                16624,
@@ -55,6 +57,17 @@ func TestNTPSHMStruct(t *testing.T) {
 	require.True(t, time.Unix(1623873213, 64546742).Equal(s.ReceiveTimeStamp()))
 }
 
+func TestNTPSHMLayout(t *testing.T) {
+	s := NTPSHM{}
+	require.Equal(t, uintptr(NTPSHMSize), unsafe.Sizeof(s))
+	require.Equal(t, NTPSHMSize, binary.Size(s))
+	// offsets of struct shmTime fields in ntpd/refclock_shm.c on 64-bit platforms
+	require.Equal(t, uintptr(8), unsafe.Offsetof(s.ClockTimeStampSec))
+	require.Equal(t, uintptr(24), unsafe.Offsetof(s.ReceiveTimeStampSec))
+	require.Equal(t, uintptr(48), unsafe.Offsetof(s.Valid))
+	require.Equal(t, uintptr(56), unsafe.Offsetof(s.ReceiveTimeStampNSec))
+}
+
 func TestNTPSHMReadID(t *testing.T) {
 	id, err := Create()
 	// Happens when we have no permissions
@@ -0,0 +1,97 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shm
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Leap indicator values of NTP SHM sample
+const (
+	LeapNoWarning int32 = iota
+	LeapAddSecond
+	LeapDelSecond
+	LeapNotInSync
+)
+
+// Sample is a single reference clock reading fed to NTP SHM refclock
+type Sample struct {
+	// Clock is the time of the reference clock
+	Clock time.Time
+	// Receive is system time when the reference clock was read
+	Receive time.Time
+	// Leap is one of Leap* values
+	Leap int32
+	// Precision is log2 of the reference clock precision in seconds
+	Precision int32
+}
+
+// Writer feeds samples to NTP SHM refclock segment using mode 1 protocol,
+// so chrony and ntpd can read it without ever seeing a half-written sample
+type Writer struct {
+	data []byte
+	shm  *NTPSHM
+}
+
+// NewWriter creates SHM segment of the unit if it doesn't exist yet and attaches to it for writing
+func NewWriter(unit int) (*Writer, error) {
+	id, err := CreateUnit(unit)
+	if err != nil {
+		return nil, err
+	}
+	data, err := unix.SysvShmAttach(int(id), 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to shm: %w", err)
+	}
+	return newWriter(data), nil
+}
+
+func newWriter(data []byte) *Writer {
+	w := &Writer{
+		data: data,
+		shm:  (*NTPSHM)(unsafe.Pointer(&data[0])),
+	}
+	w.shm.Mode = 1
+	return w
+}
+
+// Write publishes the sample. Count is bumped before and after the update,
+// and readers discard the sample if it changed while they were reading
+func (w *Writer) Write(s Sample) {
+	atomic.StoreInt32(&w.shm.Valid, 0)
+	atomic.AddInt32(&w.shm.Count, 1)
+	w.shm.ClockTimeStampSec = s.Clock.Unix()
+	w.shm.ClockTimeStampUSec = int32(s.Clock.Nanosecond() / 1000)
+	w.shm.ClockTimeStampNSec = int32(s.Clock.Nanosecond())
+	w.shm.ReceiveTimeStampSec = s.Receive.Unix()
+	w.shm.ReceiveTimeStampUSec = int32(s.Receive.Nanosecond() / 1000)
+	w.shm.ReceiveTimeStampNSec = int32(s.Receive.Nanosecond())
+	w.shm.Leap = s.Leap
+	w.shm.Precision = s.Precision
+	atomic.AddInt32(&w.shm.Count, 1)
+	atomic.StoreInt32(&w.shm.Valid, 1)
+}
+
+// Close detaches from the segment. The segment stays, so readers keep the last sample
+func (w *Writer) Close() error {
+	return unix.SysvShmDetach(w.data)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shm
+
+import (
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestWriterWrite(t *testing.T) {
+	data := make([]byte, NTPSHMSize)
+	w := newWriter(data)
+	clock := time.Unix(1623873213, 307321)
+	receive := time.Unix(1623873213, 64546742)
+	w.Write(Sample{Clock: clock, Receive: receive, Leap: LeapAddSecond, Precision: -20})
+
+	s, err := ptrToNTPSHM(uintptr(unsafe.Pointer(&data[0])))
+	require.NoError(t, err)
+	require.Equal(t, int32(1), s.Mode)
+	require.Equal(t, int32(2), s.Count)
+	require.Equal(t, int32(1), s.Valid)
+	require.Equal(t, int32(307), s.ClockTimeStampUSec)
+	require.Equal(t, int32(64546), s.ReceiveTimeStampUSec)
+	require.Equal(t, LeapAddSecond, s.Leap)
+	require.Equal(t, int32(-20), s.Precision)
+	require.True(t, clock.Equal(s.ClockTimeStamp()))
+	require.True(t, receive.Equal(s.ReceiveTimeStamp()))
+
+	// every update bumps count twice
+	w.Write(Sample{Clock: clock.Add(time.Second), Receive: receive.Add(time.Second)})
+	s, err = ptrToNTPSHM(uintptr(unsafe.Pointer(&data[0])))
+	require.NoError(t, err)
+	require.Equal(t, int32(4), s.Count)
+	require.Equal(t, LeapNoWarning, s.Leap)
+	require.True(t, clock.Add(time.Second).Equal(s.ClockTimeStamp()))
+}
+
+func TestNewWriter(t *testing.T) {
+	// unit nobody is likely to use
+	unit := 42
+	w, err := NewWriter(unit)
+	// Happens when we have no permissions
+	if err != nil {
+		t.SkipNow()
+	}
+	id, err := CreateUnit(unit)
+	require.NoError(t, err)
+	defer func() {
+		_, err := unix.SysvShmCtl(int(id), unix.IPC_RMID, nil)
+		require.NoError(t, err)
+	}()
+
+	clock := time.Unix(1623873213, 307321)
+	w.Write(Sample{Clock: clock, Receive: clock.Add(time.Millisecond)})
+	require.NoError(t, w.Close())
+
+	s, err := ReadID(id)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), s.Mode)
+	require.Equal(t, int32(1), s.Valid)
+	require.True(t, clock.Equal(s.ClockTimeStamp()))
+	require.True(t, clock.Add(time.Millisecond).Equal(s.ReceiveTimeStamp()))
+}
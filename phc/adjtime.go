@@ -22,7 +22,6 @@ import (
 	"time"
 
 	"github.com/facebook/time/clock"
-	"golang.org/x/sys/unix"
 )
 
 // FrequencyPPBFromDevice reads PHC device frequency in PPB
@@ -35,7 +34,7 @@ func FrequencyPPBFromDevice(phcDevice string) (freqPPB float64, err error) {
 	defer f.Close()
 	var state int
 	freqPPB, state, err = clock.FrequencyPPB(FDToClockID(f.Fd()))
-	if err == nil && state != unix.TIME_OK {
+	if err == nil && state != clock.TimeOK {
 		return freqPPB, fmt.Errorf("clock %q state %d is not TIME_OK", phcDevice, state)
 	}
 	return freqPPB, err
@@ -59,7 +58,7 @@ func ClockAdjFreq(phcDevice string, freqPPB float64) error {
 	}
 	defer f.Close()
 	state, err := clock.AdjFreqPPB(FDToClockID(f.Fd()), freqPPB)
-	if err == nil && state != unix.TIME_OK {
+	if err == nil && state != clock.TimeOK {
 		return fmt.Errorf("clock %q state %d is not TIME_OK", phcDevice, state)
 	}
 	return err
@@ -74,7 +73,7 @@ func ClockStep(phcDevice string, step time.Duration) error {
 	}
 	defer f.Close()
 	state, err := clock.Step(FDToClockID(f.Fd()), step)
-	if err == nil && state != unix.TIME_OK {
+	if err == nil && state != clock.TimeOK {
 		return fmt.Errorf("clock %q state %d is not TIME_OK", phcDevice, state)
 	}
 	return err
@@ -18,6 +18,7 @@ limitations under the License.
 Package phc contains code to work with PTP Hardware Clock (PHC).
 It allows getting PHC time via different APIs (syscall, ioctl).
 
-It also provides means to calculate offset between sys clock and PHC.
+It also provides means to calculate offset between sys clock and PHC,
+and Monitor which detects stuck or non-monotonic PHCs and notifies its users via callback.
 */
 package phc
@@ -0,0 +1,296 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HealthState is a state of PHC as seen by Monitor
+type HealthState int
+
+// PHC health states
+const (
+	// HealthUnknown means PHC wasn't read enough times yet
+	HealthUnknown HealthState = iota
+	// HealthOK means PHC advances along with system clock
+	HealthOK
+	// HealthStuck means PHC doesn't advance, like when NIC firmware hangs
+	HealthStuck
+	// HealthNonMonotonic means PHC went backwards while nobody stepped it
+	HealthNonMonotonic
+	// HealthUnreadable means PHC can't be read
+	HealthUnreadable
+)
+
+var healthStateToString = map[HealthState]string{
+	HealthUnknown:      "UNKNOWN",
+	HealthOK:           "OK",
+	HealthStuck:        "STUCK",
+	HealthNonMonotonic: "NON_MONOTONIC",
+	HealthUnreadable:   "UNREADABLE",
+}
+
+func (s HealthState) String() string {
+	return healthStateToString[s]
+}
+
+// MarshalText encodes state as its name
+func (s HealthState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Healthy returns true unless PHC is known to be broken
+func (s HealthState) Healthy() bool {
+	return s == HealthOK || s == HealthUnknown
+}
+
+// Default health monitoring settings
+const (
+	DefaultHealthInterval   = time.Second
+	DefaultHealthThreshold  = 3
+	DefaultHealthStuckRatio = 0.5
+)
+
+// HealthConfig is a config of PHC health monitoring
+type HealthConfig struct {
+	// Interval is how often PHC is read
+	Interval time.Duration
+	// Threshold is how many bad readings in a row it takes to change the state, so a single glitch is not reported
+	Threshold int
+	// StuckRatio is a share of elapsed system time PHC has to advance by not to be considered stuck
+	StuckRatio float64
+}
+
+// DefaultHealthConfig returns health monitoring config with default settings
+func DefaultHealthConfig() HealthConfig {
+	return HealthConfig{
+		Interval:   DefaultHealthInterval,
+		Threshold:  DefaultHealthThreshold,
+		StuckRatio: DefaultHealthStuckRatio,
+	}
+}
+
+// Validate checks health monitoring config
+func (c *HealthConfig) Validate() error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %v", c.Interval)
+	}
+	if c.Threshold < 1 {
+		return fmt.Errorf("threshold must be at least 1, got %d", c.Threshold)
+	}
+	if c.StuckRatio <= 0 || c.StuckRatio >= 1 {
+		return fmt.Errorf("stuck ratio must be between 0 and 1, got %v", c.StuckRatio)
+	}
+	return nil
+}
+
+// HealthStatus is the last known health of PHC
+type HealthStatus struct {
+	Device string      `json:"device"`
+	State  HealthState `json:"state"`
+	// PHCTime is the last PHC reading
+	PHCTime time.Time `json:"phc_time"`
+	// Checked is when PHC was read last time
+	Checked time.Time `json:"checked"`
+	// Elapsed is how much PHC advanced between the last two readings, while SysElapsed is how much system clock did
+	Elapsed    time.Duration `json:"elapsed_ns"`
+	SysElapsed time.Duration `json:"sys_elapsed_ns"`
+	// BadReadings is how many bad readings in a row there were
+	BadReadings int `json:"bad_readings"`
+	// Error is the last read error, if any
+	Error string `json:"error,omitempty"`
+}
+
+// deviceHealth is what Monitor tracks for every PHC
+type deviceHealth struct {
+	status HealthStatus
+	// sys is the system time of the last successful PHC reading, with monotonic clock reading
+	sys time.Time
+	// verdict of the bad readings in a row
+	pending HealthState
+	// stepped is set by Stepped, so the next backward move is expected
+	stepped bool
+}
+
+// Monitor periodically reads PHCs and detects stuck and non-monotonic ones.
+// PHC elapsed time is compared with monotonic system clock, so system clock steps don't confuse it
+type Monitor struct {
+	config   HealthConfig
+	onChange func(HealthStatus)
+	// read returns PHC time, replaced in tests
+	read func(device string) (time.Time, error)
+	// now returns system time with monotonic clock reading, replaced in tests
+	now func() time.Time
+
+	sync.Mutex
+	devices []string
+	health  map[string]*deviceHealth
+}
+
+// NewMonitor returns monitor of the PHC devices. onChange, if not nil, is called every time health state of PHC changes,
+// so users of PHC can stop trusting its timestamps
+func NewMonitor(cfg HealthConfig, devices []string, onChange func(HealthStatus)) (*Monitor, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	m := &Monitor{
+		config:   cfg,
+		onChange: onChange,
+		read:     TimeFromDevice,
+		now:      time.Now,
+		devices:  devices,
+		health:   map[string]*deviceHealth{},
+	}
+	for _, d := range devices {
+		m.health[d] = &deviceHealth{status: HealthStatus{Device: d}}
+	}
+	return m, nil
+}
+
+// Stepped tells monitor PHC was stepped on purpose, so its next backward move isn't reported
+func (m *Monitor) Stepped(device string) {
+	m.Lock()
+	defer m.Unlock()
+	if h, ok := m.health[device]; ok {
+		h.stepped = true
+	}
+}
+
+// Status returns the last known health of every PHC
+func (m *Monitor) Status() []HealthStatus {
+	m.Lock()
+	defer m.Unlock()
+	res := make([]HealthStatus, 0, len(m.devices))
+	for _, d := range m.devices {
+		res = append(res, m.health[d].status)
+	}
+	return res
+}
+
+// Healthy returns true unless PHC is known to be broken
+func (m *Monitor) Healthy(device string) bool {
+	m.Lock()
+	defer m.Unlock()
+	h, ok := m.health[device]
+	return ok && h.status.State.Healthy()
+}
+
+// Check reads every PHC once and returns their health
+func (m *Monitor) Check() []HealthStatus {
+	var changed []HealthStatus
+	for _, d := range m.devices {
+		phcTime, err := m.read(d)
+		now := m.now()
+		m.Lock()
+		if m.health[d].update(phcTime, now, err, &m.config) {
+			changed = append(changed, m.health[d].status)
+		}
+		m.Unlock()
+	}
+	// outside of the lock, so callback may query the monitor
+	if m.onChange != nil {
+		for _, st := range changed {
+			m.onChange(st)
+		}
+	}
+	return m.Status()
+}
+
+// Run checks PHCs every interval until context is cancelled
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+	for {
+		m.Check()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// verdict tells what the reading says about PHC
+func (h *deviceHealth) verdict(err error, c *HealthConfig) HealthState {
+	if err != nil {
+		return HealthUnreadable
+	}
+	// first reading, nothing to compare with
+	if h.sys.IsZero() {
+		return HealthUnknown
+	}
+	if h.status.Elapsed < 0 {
+		if h.stepped {
+			return HealthOK
+		}
+		return HealthNonMonotonic
+	}
+	if float64(h.status.Elapsed) < c.StuckRatio*float64(h.status.SysElapsed) {
+		return HealthStuck
+	}
+	return HealthOK
+}
+
+// update records PHC reading and returns true if health state changed
+func (h *deviceHealth) update(phcTime, now time.Time, err error, c *HealthConfig) bool {
+	h.status.Checked = now
+	h.status.Error = ""
+	if err != nil {
+		h.status.Error = err.Error()
+	} else if !h.sys.IsZero() {
+		h.status.Elapsed = phcTime.Sub(h.status.PHCTime)
+		h.status.SysElapsed = now.Sub(h.sys)
+	}
+	v := h.verdict(err, c)
+	if err == nil {
+		h.status.PHCTime = phcTime
+		h.sys = now
+		h.stepped = false
+	}
+
+	prev := h.status.State
+	switch v {
+	case HealthUnknown:
+		return false
+	case HealthOK:
+		h.status.BadReadings = 0
+		h.status.State = HealthOK
+	default:
+		if v != h.pending {
+			h.status.BadReadings = 0
+		}
+		h.pending = v
+		h.status.BadReadings++
+		if h.status.BadReadings >= c.Threshold {
+			h.status.State = v
+		}
+	}
+	return h.status.State != prev
+}
+
+// String returns human readable health status
+func (s HealthStatus) String() string {
+	res := fmt.Sprintf("%s: %s, PHC advanced %v in %v", s.Device, s.State, s.Elapsed, s.SysElapsed)
+	if s.Error != "" {
+		res += fmt.Sprintf(", error: %s", s.Error)
+	}
+	return res
+}
@@ -0,0 +1,154 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakePHC is PHC and system clock advanced by tests
+type fakePHC struct {
+	phc time.Time
+	sys time.Time
+	err error
+}
+
+func (f *fakePHC) tick(sys, phc time.Duration) {
+	f.sys = f.sys.Add(sys)
+	f.phc = f.phc.Add(phc)
+}
+
+func newTestMonitor(t *testing.T, f *fakePHC, onChange func(HealthStatus)) *Monitor {
+	m, err := NewMonitor(DefaultHealthConfig(), []string{"/dev/ptp0"}, onChange)
+	require.NoError(t, err)
+	m.read = func(string) (time.Time, error) { return f.phc, f.err }
+	m.now = func() time.Time { return f.sys }
+	return m
+}
+
+func TestHealthConfigValidate(t *testing.T) {
+	c := DefaultHealthConfig()
+	require.NoError(t, c.Validate())
+	c.Threshold = 0
+	require.Error(t, c.Validate())
+	c = DefaultHealthConfig()
+	c.StuckRatio = 1
+	require.Error(t, c.Validate())
+	c = DefaultHealthConfig()
+	c.Interval = 0
+	require.Error(t, c.Validate())
+	_, err := NewMonitor(c, nil, nil)
+	require.Error(t, err)
+}
+
+func TestHealthStateString(t *testing.T) {
+	require.Equal(t, "STUCK", HealthStuck.String())
+	b, err := json.Marshal(HealthStatus{Device: "/dev/ptp0", State: HealthNonMonotonic})
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"state":"NON_MONOTONIC"`)
+	require.True(t, HealthUnknown.Healthy())
+	require.False(t, HealthUnreadable.Healthy())
+}
+
+func TestMonitorStuck(t *testing.T) {
+	f := &fakePHC{phc: time.Unix(1000, 0), sys: time.Unix(2000, 0)}
+	var changes []HealthStatus
+	m := newTestMonitor(t, f, func(s HealthStatus) { changes = append(changes, s) })
+
+	require.Equal(t, HealthUnknown, m.Check()[0].State)
+	f.tick(time.Second, time.Second)
+	require.Equal(t, HealthOK, m.Check()[0].State)
+	require.Len(t, changes, 1)
+
+	// firmware hangs, single bad reading isn't enough
+	f.tick(time.Second, 0)
+	st := m.Check()[0]
+	require.Equal(t, HealthOK, st.State)
+	require.Equal(t, 1, st.BadReadings)
+	f.tick(time.Second, time.Millisecond)
+	m.Check()
+	f.tick(time.Second, 0)
+	st = m.Check()[0]
+	require.Equal(t, HealthStuck, st.State)
+	require.Equal(t, time.Duration(0), st.Elapsed)
+	require.Equal(t, time.Second, st.SysElapsed)
+	require.False(t, m.Healthy("/dev/ptp0"))
+	require.Len(t, changes, 2)
+	require.Equal(t, HealthStuck, changes[1].State)
+
+	// and recovers
+	f.tick(time.Second, time.Second)
+	require.Equal(t, HealthOK, m.Check()[0].State)
+	require.True(t, m.Healthy("/dev/ptp0"))
+	require.Len(t, changes, 3)
+}
+
+func TestMonitorNonMonotonic(t *testing.T) {
+	f := &fakePHC{phc: time.Unix(1000, 0), sys: time.Unix(2000, 0)}
+	m := newTestMonitor(t, f, nil)
+	m.Check()
+	for i := 0; i < DefaultHealthThreshold; i++ {
+		f.tick(time.Second, -time.Millisecond)
+		m.Check()
+	}
+	require.Equal(t, HealthNonMonotonic, m.Status()[0].State)
+
+	// stepped on purpose
+	f.tick(time.Second, time.Second)
+	m.Check()
+	m.Stepped("/dev/ptp0")
+	f.tick(time.Second, -time.Hour)
+	st := m.Check()[0]
+	require.Equal(t, HealthOK, st.State)
+	require.Equal(t, 0, st.BadReadings)
+	// only once
+	f.tick(time.Second, -time.Hour)
+	require.Equal(t, 1, m.Check()[0].BadReadings)
+}
+
+func TestMonitorUnreadable(t *testing.T) {
+	f := &fakePHC{phc: time.Unix(1000, 0), sys: time.Unix(2000, 0)}
+	m := newTestMonitor(t, f, nil)
+	f.err = errors.New("no such device")
+	for i := 0; i < DefaultHealthThreshold; i++ {
+		f.tick(time.Second, time.Second)
+		m.Check()
+	}
+	st := m.Status()[0]
+	require.Equal(t, HealthUnreadable, st.State)
+	require.Equal(t, "no such device", st.Error)
+	require.Contains(t, st.String(), "/dev/ptp0: UNREADABLE")
+
+	// bad readings of different kind don't add up
+	f.err = nil
+	m.Check()
+	f.tick(time.Second, 0)
+	st = m.Check()[0]
+	require.Equal(t, HealthUnreadable, st.State)
+	require.Equal(t, 1, st.BadReadings)
+}
+
+func TestMonitorUnknownDevice(t *testing.T) {
+	m := newTestMonitor(t, &fakePHC{}, nil)
+	require.False(t, m.Healthy("/dev/ptp9"))
+	m.Stepped("/dev/ptp9")
+}
@@ -22,6 +22,7 @@ import (
 	"time"
 	"unsafe"
 
+	"github.com/facebook/time/timestamp"
 	"golang.org/x/sys/unix"
 )
 
@@ -65,9 +66,16 @@ func ifaceInfoToPHCDevice(info *EthtoolTSinfo) (string, error) {
 	return fmt.Sprintf("/dev/ptp%d", info.PHCIndex), nil
 }
 
-// IfaceToPHCDevice returns path to PHC device associated with given network card iface
+// IfaceToPHCDevice returns path to PHC device associated with given network card iface.
+// For virtual interfaces like vlan, macvlan or bond it's PHC of the physical interface underneath
 func IfaceToPHCDevice(iface string) (string, error) {
 	info, err := IfaceInfo(iface)
+	if err == nil && info.PHCIndex >= 0 {
+		return ifaceInfoToPHCDevice(info)
+	}
+	if phys, perr := timestamp.PhysicalInterface(iface); perr == nil && phys != iface {
+		return IfaceToPHCDevice(phys)
+	}
 	if err != nil {
 		return "", fmt.Errorf("getting interface %s info: %w", iface, err)
 	}
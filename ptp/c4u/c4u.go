@@ -17,6 +17,7 @@ limitations under the License.
 package c4u
 
 import (
+	"reflect"
 	"time"
 
 	"github.com/facebook/time/ptp/c4u/clock"
@@ -138,12 +139,14 @@ func Run(config *Config, rb *clock.RingBuffer, st stats.Stats) error {
 	st.SetClockAccuracy(int64(pending.ClockAccuracy))
 	st.SetUTCOffsetSec(int64(pending.UTCOffset.Seconds()))
 
-	if *current != *pending {
+	// dynamic config has lists, so it can't be compared with !=
+	if !reflect.DeepEqual(current, pending) {
 		log.Infof("Current: %+v", current)
 		log.Infof("Pending: %+v", pending)
 
 		if config.Apply {
-			log.Infof("Saving a pending config to %s", config.Path)
+			pending.Version = current.Version + 1
+			log.Infof("Saving a pending config version %d to %s", pending.Version, config.Path)
 			err := pending.Write(config.Path)
 			if err != nil {
 				log.Errorf("Failed save the ptp4u config: %v", err)
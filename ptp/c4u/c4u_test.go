@@ -41,6 +41,7 @@ func TestRun(t *testing.T) {
 		MetricInterval: 1 * time.Minute,
 		MinSubInterval: 1 * time.Second,
 		UTCOffset:      utcoffset,
+		Version:        1,
 	}
 
 	cfg, err := os.CreateTemp("", "c4u")
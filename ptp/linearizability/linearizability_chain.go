@@ -0,0 +1,207 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linearizability
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// ChainHop is what boundary clock reports about itself and its parent via management messages
+type ChainHop struct {
+	Address             string
+	ClockIdentity       ptp.ClockIdentity
+	Parent              ptp.PortIdentity
+	GrandmasterIdentity ptp.ClockIdentity
+	StepsRemoved        uint16
+}
+
+// ChainTestResult is what we get after querying boundary clocks along the path
+type ChainTestResult struct {
+	Server     string
+	ExpectedGM ptp.ClockIdentity
+	Hops       []ChainHop
+	Error      error
+}
+
+// Target returns value of server
+func (tr ChainTestResult) Target() string {
+	return tr.Server
+}
+
+// brokenLink returns why boundary clocks don't form a chain to the expected GM, empty string if they do
+func (tr ChainTestResult) brokenLink() string {
+	parent := tr.ExpectedGM
+	for i, hop := range tr.Hops {
+		if hop.GrandmasterIdentity != tr.ExpectedGM {
+			return fmt.Sprintf("%q follows GM %s", hop.Address, hop.GrandmasterIdentity)
+		}
+		if hop.Parent.ClockIdentity != parent {
+			return fmt.Sprintf("%q has parent %s instead of %s", hop.Address, hop.Parent.ClockIdentity, parent)
+		}
+		if int(hop.StepsRemoved) != i+1 {
+			return fmt.Sprintf("%q is %d steps removed from GM instead of %d", hop.Address, hop.StepsRemoved, i+1)
+		}
+		parent = hop.ClockIdentity
+	}
+	return ""
+}
+
+// Good check if the test passed
+func (tr ChainTestResult) Good() (bool, error) {
+	if tr.Error != nil {
+		return false, tr.Error
+	}
+	return tr.brokenLink() == "", nil
+}
+
+// Explain provides plain text explanation of linearizability test result
+func (tr ChainTestResult) Explain() string {
+	msg := fmt.Sprintf("boundary clock chain test against %q", tr.Server)
+	good, err := tr.Good()
+	if good {
+		return fmt.Sprintf("%s passed", msg)
+	}
+	if err != nil {
+		return fmt.Sprintf("%s couldn't be completed because of error: %v", msg, tr.Error)
+	}
+	return fmt.Sprintf("%s failed because %s, while GM %s is expected", msg, tr.brokenLink(), tr.ExpectedGM)
+}
+
+// Err returns an error value of the ChainTestResult
+func (tr ChainTestResult) Err() error {
+	return tr.Error
+}
+
+// ChainTestConfig is a configuration for Tester
+type ChainTestConfig struct {
+	Timeout time.Duration
+	// GM is clock identity of the GM every boundary clock must lead to
+	GM ptp.ClockIdentity
+	// Path is management addresses of boundary clocks, from the one next to the GM downstream
+	Path []string
+}
+
+// mgmtClient is what we query boundary clocks with
+type mgmtClient interface {
+	DefaultDataSet() (*ptp.DefaultDataSetTLV, error)
+	ParentDataSet() (*ptp.ParentDataSetTLV, error)
+	CurrentDataSet() (*ptp.CurrentDataSetTLV, error)
+	Close() error
+}
+
+// ChainTester validates that boundary clocks along the path form a chain to the expected GM
+type ChainTester struct {
+	cfg  *ChainTestConfig
+	dial func(address string, timeout time.Duration) (mgmtClient, error)
+
+	// measurement result
+	result *ChainTestResult
+}
+
+// NewChainTester initializes a Tester. Boundary clocks are queried over UDP on their general port unless address has another one
+func NewChainTester(gm ptp.ClockIdentity, path []string) (*ChainTester, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no boundary clocks to test")
+	}
+	cfg := &ChainTestConfig{
+		Timeout: time.Second,
+		GM:      gm,
+		Path:    path,
+	}
+	t := &ChainTester{
+		cfg: cfg,
+		dial: func(address string, timeout time.Duration) (mgmtClient, error) {
+			return ptp.DialMgmtUDP(address, timeout)
+		},
+	}
+	return t, nil
+}
+
+// Close the connection
+func (lt *ChainTester) Close() error {
+	return nil
+}
+
+// mgmtAddress adds general port to the address if it has none
+func mgmtAddress(address string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(address, strconv.Itoa(ptp.PortGeneral))
+}
+
+// queryHop fetches datasets of the boundary clock
+func (lt *ChainTester) queryHop(address string) (ChainHop, error) {
+	hop := ChainHop{Address: address}
+	c, err := lt.dial(mgmtAddress(address), lt.cfg.Timeout)
+	if err != nil {
+		return hop, err
+	}
+	defer c.Close()
+
+	dds, err := c.DefaultDataSet()
+	if err != nil {
+		return hop, fmt.Errorf("getting DEFAULT_DATA_SET: %w", err)
+	}
+	pds, err := c.ParentDataSet()
+	if err != nil {
+		return hop, fmt.Errorf("getting PARENT_DATA_SET: %w", err)
+	}
+	cds, err := c.CurrentDataSet()
+	if err != nil {
+		return hop, fmt.Errorf("getting CURRENT_DATA_SET: %w", err)
+	}
+	hop.ClockIdentity = dds.ClockIdentity
+	hop.Parent = pds.ParentPortIdentity
+	hop.GrandmasterIdentity = pds.GrandmasterIdentity
+	hop.StepsRemoved = cds.StepsRemoved
+	return hop, nil
+}
+
+// RunTest performs one Tester run and will exit on completion.
+// The result of the test will be returned, including any error arising during the test.
+func (lt *ChainTester) RunTest(ctx context.Context) TestResult {
+	result := ChainTestResult{
+		Server:     lt.cfg.Path[len(lt.cfg.Path)-1],
+		ExpectedGM: lt.cfg.GM,
+	}
+
+	log.Debugf("test starting %s", result.Server)
+	for _, address := range lt.cfg.Path {
+		if err := ctx.Err(); err != nil {
+			result.Error = err
+			break
+		}
+		hop, err := lt.queryHop(address)
+		if err != nil {
+			result.Error = fmt.Errorf("querying boundary clock %q: %w", address, err)
+			break
+		}
+		result.Hops = append(result.Hops, hop)
+	}
+	lt.result = &result
+
+	log.Debugf("test done %s", result.Server)
+	return result
+}
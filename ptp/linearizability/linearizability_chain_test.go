@@ -0,0 +1,140 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linearizability
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testGM  ptp.ClockIdentity = 0x1
+	testBC1 ptp.ClockIdentity = 0x2
+	testBC2 ptp.ClockIdentity = 0x3
+)
+
+type fakeMgmtClient struct {
+	hop ChainHop
+	err error
+}
+
+func (c *fakeMgmtClient) DefaultDataSet() (*ptp.DefaultDataSetTLV, error) {
+	return &ptp.DefaultDataSetTLV{ClockIdentity: c.hop.ClockIdentity}, c.err
+}
+
+func (c *fakeMgmtClient) ParentDataSet() (*ptp.ParentDataSetTLV, error) {
+	return &ptp.ParentDataSetTLV{ParentPortIdentity: c.hop.Parent, GrandmasterIdentity: c.hop.GrandmasterIdentity}, nil
+}
+
+func (c *fakeMgmtClient) CurrentDataSet() (*ptp.CurrentDataSetTLV, error) {
+	return &ptp.CurrentDataSetTLV{StepsRemoved: c.hop.StepsRemoved}, nil
+}
+
+func (c *fakeMgmtClient) Close() error {
+	return nil
+}
+
+func chainHops() []ChainHop {
+	return []ChainHop{
+		{Address: "bc01", ClockIdentity: testBC1, Parent: ptp.PortIdentity{ClockIdentity: testGM, PortNumber: 1}, GrandmasterIdentity: testGM, StepsRemoved: 1},
+		{Address: "bc02", ClockIdentity: testBC2, Parent: ptp.PortIdentity{ClockIdentity: testBC1, PortNumber: 3}, GrandmasterIdentity: testGM, StepsRemoved: 2},
+	}
+}
+
+func TestChainTestResultGood(t *testing.T) {
+	tr := ChainTestResult{Server: "bc02", ExpectedGM: testGM, Hops: chainHops()}
+	good, err := tr.Good()
+	require.NoError(t, err)
+	require.True(t, good)
+	require.Equal(t, `boundary clock chain test against "bc02" passed`, tr.Explain())
+
+	// different time island
+	tr.Hops = chainHops()
+	tr.Hops[1].GrandmasterIdentity = 0x42
+	good, err = tr.Good()
+	require.NoError(t, err)
+	require.False(t, good)
+	require.Contains(t, tr.Explain(), `"bc02" follows GM 000000.0000.000042`)
+
+	// skips a boundary clock
+	tr.Hops = chainHops()
+	tr.Hops[1].Parent.ClockIdentity = testGM
+	good, _ = tr.Good()
+	require.False(t, good)
+	require.Contains(t, tr.Explain(), `"bc02" has parent 000000.0000.000001 instead of 000000.0000.000002`)
+
+	tr.Hops = chainHops()
+	tr.Hops[0].StepsRemoved = 2
+	good, _ = tr.Good()
+	require.False(t, good)
+	require.Contains(t, tr.Explain(), `"bc01" is 2 steps removed from GM instead of 1`)
+
+	tr.Error = fmt.Errorf("timeout")
+	good, err = tr.Good()
+	require.Error(t, err)
+	require.False(t, good)
+	require.Contains(t, tr.Explain(), "couldn't be completed because of error: timeout")
+}
+
+func TestChainTesterRunTest(t *testing.T) {
+	_, err := NewChainTester(testGM, nil)
+	require.Error(t, err)
+
+	lt, err := NewChainTester(testGM, []string{"bc01", "bc02:1320"})
+	require.NoError(t, err)
+	hops := map[string]ChainHop{}
+	for _, h := range chainHops() {
+		hops[h.Address] = h
+	}
+	dialed := []string{}
+	lt.dial = func(address string, _ time.Duration) (mgmtClient, error) {
+		dialed = append(dialed, address)
+		switch address {
+		case "bc01:320":
+			return &fakeMgmtClient{hop: hops["bc01"]}, nil
+		case "bc02:1320":
+			return &fakeMgmtClient{hop: hops["bc02"]}, nil
+		}
+		return nil, fmt.Errorf("unknown address %s", address)
+	}
+
+	tr := lt.RunTest(context.Background())
+	require.NoError(t, tr.Err())
+	require.Equal(t, "bc02:1320", tr.Target())
+	require.Equal(t, []string{"bc01:320", "bc02:1320"}, dialed)
+	good, err := tr.Good()
+	require.NoError(t, err)
+	require.True(t, good)
+	require.Equal(t, testBC2, lt.result.Hops[1].ClockIdentity)
+
+	lt.dial = func(_ string, _ time.Duration) (mgmtClient, error) {
+		return &fakeMgmtClient{err: fmt.Errorf("no reply")}, nil
+	}
+	tr = lt.RunTest(context.Background())
+	require.Error(t, tr.Err())
+	require.Contains(t, tr.Err().Error(), `querying boundary clock "bc01": getting DEFAULT_DATA_SET: no reply`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tr = lt.RunTest(ctx)
+	require.ErrorIs(t, tr.Err(), context.Canceled)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pcapng
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// ptpTimestamp formats PTP timestamp so it's easy to compare with capture timestamps
+func ptpTimestamp(t ptp.Timestamp) string {
+	if t.Empty() {
+		return "empty"
+	}
+	return t.Time().UTC().Format(time.RFC3339Nano)
+}
+
+// Summary describes decoded PTP message in one line
+func Summary(p ptp.Packet) string {
+	var header *ptp.Header
+	var body string
+	switch v := p.(type) {
+	case *ptp.SyncDelayReq:
+		header = &v.Header
+		body = fmt.Sprintf("origin=%s", ptpTimestamp(v.OriginTimestamp))
+	case *ptp.FollowUp:
+		header = &v.Header
+		body = fmt.Sprintf("precise_origin=%s", ptpTimestamp(v.PreciseOriginTimestamp))
+	case *ptp.DelayResp:
+		header = &v.Header
+		body = fmt.Sprintf("receive=%s requesting=%s", ptpTimestamp(v.ReceiveTimestamp), v.RequestingPortIdentity)
+	case *ptp.Announce:
+		header = &v.Header
+		body = fmt.Sprintf(
+			"origin=%s gm=%s prio1=%d class=%d accuracy=%d prio2=%d steps=%d utc_offset=%d",
+			ptpTimestamp(v.OriginTimestamp), v.GrandmasterIdentity, v.GrandmasterPriority1,
+			v.GrandmasterClockQuality.ClockClass, v.GrandmasterClockQuality.ClockAccuracy,
+			v.GrandmasterPriority2, v.StepsRemoved, v.CurrentUTCOffset,
+		)
+	case *ptp.Signaling:
+		header = &v.Header
+		body = fmt.Sprintf("target=%s tlvs=%d", v.TargetPortIdentity, len(v.TLVs))
+	case *ptp.PDelayReq:
+		header = &v.Header
+	case *ptp.PDelayResp:
+		header = &v.Header
+	case *ptp.PDelayRespFollowUp:
+		header = &v.Header
+	default:
+		return fmt.Sprintf("type=%s", p.MessageType())
+	}
+	summary := fmt.Sprintf(
+		"type=%s seq=%d domain=%d src=%s cf=%.3fns",
+		header.MessageType(), header.SequenceID, header.DomainNumber, header.SourcePortIdentity, header.CorrectionField.Nanoseconds(),
+	)
+	if body != "" {
+		summary = fmt.Sprintf("%s %s", summary, body)
+	}
+	return summary
+}
+
+// Comment builds packet comment naming timestamp source and direction, so timestamping details and decoded message are visible in wireshark
+func Comment(tsSource string, outgoing bool, payload []byte) string {
+	dir := "in"
+	if outgoing {
+		dir = "out"
+	}
+	parts := []string{fmt.Sprintf("ts=%s", tsSource), fmt.Sprintf("dir=%s", dir)}
+	p, err := ptp.DecodePacket(payload)
+	if err != nil {
+		parts = append(parts, fmt.Sprintf("decode_error=%q", err.Error()))
+	} else {
+		parts = append(parts, Summary(p))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,77 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pcapng
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+func testSync(t *testing.T) []byte {
+	sync := &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSync, 0),
+			Version:         ptp.Version,
+			MessageLength:   44,
+			DomainNumber:    1,
+			SourcePortIdentity: ptp.PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: 36138748164966842,
+			},
+			SequenceID: 116,
+		},
+		SyncDelayReqBody: ptp.SyncDelayReqBody{
+			OriginTimestamp: ptp.NewTimestamp(time.Unix(1621600325, 123456789)),
+		},
+	}
+	b, err := ptp.Bytes(sync)
+	require.NoError(t, err)
+	return b
+}
+
+func TestCaptureComment(t *testing.T) {
+	require.Equal(t,
+		"ts=hardware dir=in type=SYNC seq=116 domain=1 src=008063.ffff.0009ba-1 cf=0.000ns origin=2021-05-21T12:32:05.123456789Z",
+		Comment("hardware", false, testSync(t)),
+	)
+	require.Contains(t, Comment("userspace", true, []byte{0x10}), "ts=userspace dir=out decode_error=")
+
+	announce := &ptp.Announce{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageAnnounce, 0),
+			SequenceID:      42,
+		},
+		AnnounceBody: ptp.AnnounceBody{
+			CurrentUTCOffset:     37,
+			GrandmasterPriority1: 128,
+			GrandmasterClockQuality: ptp.ClockQuality{
+				ClockClass:    6,
+				ClockAccuracy: 33,
+			},
+			GrandmasterPriority2: 128,
+			GrandmasterIdentity:  36138748164966842,
+		},
+	}
+	require.Equal(t,
+		"type=ANNOUNCE seq=42 domain=0 src=000000.0000.000000-0 cf=0.000ns origin=empty gm=008063.ffff.0009ba prio1=128 class=6 accuracy=33 prio2=128 steps=0 utc_offset=37",
+		Summary(announce),
+	)
+}
@@ -0,0 +1,135 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package pcapng implements minimal pcapng writer, as one in gopacket/pcapgo can't write packet comments.
+See https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-00.html
+*/
+package pcapng
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	pcapngBlockSectionHeader   uint32 = 0x0A0D0D0A
+	pcapngBlockInterfaceDesc   uint32 = 0x00000001
+	pcapngBlockEnhancedPacket  uint32 = 0x00000006
+	pcapngByteOrderMagic       uint32 = 0x1A2B3C4D
+	pcapngOptionEndOfOpt       uint16 = 0
+	pcapngOptionComment        uint16 = 1
+	pcapngOptionIfName         uint16 = 2
+	pcapngOptionIfTSResol      uint16 = 9
+	pcapngOptionShbUserAppl    uint16 = 4
+	pcapngTSResolNanoseconds   uint8  = 9
+	pcapngSectionLengthUnknown uint64 = 0xFFFFFFFFFFFFFFFF
+)
+
+type pcapngOption struct {
+	code  uint16
+	value []byte
+}
+
+// Writer writes packets captured on single interface with nanosecond timestamps and optional comments
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter writes section header naming the application, and description of the interface packets are captured on
+func NewWriter(w io.Writer, application, iface string, linkType layers.LinkType, snapLen uint32) (*Writer, error) {
+	p := &Writer{w: bufio.NewWriter(w)}
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:], 1) // major version
+	binary.LittleEndian.PutUint16(shb[6:], 0) // minor version
+	binary.LittleEndian.PutUint64(shb[8:], pcapngSectionLengthUnknown)
+	if err := p.writeBlock(pcapngBlockSectionHeader, shb, []pcapngOption{
+		{code: pcapngOptionShbUserAppl, value: []byte(application)},
+	}); err != nil {
+		return nil, err
+	}
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:], uint16(linkType))
+	binary.LittleEndian.PutUint32(idb[4:], snapLen)
+	if err := p.writeBlock(pcapngBlockInterfaceDesc, idb, []pcapngOption{
+		{code: pcapngOptionIfName, value: []byte(iface)},
+		{code: pcapngOptionIfTSResol, value: []byte{pcapngTSResolNanoseconds}},
+	}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// WritePacket writes packet captured at ts, with comment if it's not empty
+func (p *Writer) WritePacket(ts time.Time, data []byte, origLen int, comment string) error {
+	body := make([]byte, 20+len(data)+padding(len(data)))
+	nanos := uint64(ts.UnixNano())
+	// interface id is 0, we only have one
+	binary.LittleEndian.PutUint32(body[4:], uint32(nanos>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(nanos))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:], uint32(origLen))
+	copy(body[20:], data)
+	var options []pcapngOption
+	if comment != "" {
+		options = append(options, pcapngOption{code: pcapngOptionComment, value: []byte(comment)})
+	}
+	return p.writeBlock(pcapngBlockEnhancedPacket, body, options)
+}
+
+// Flush writes buffered data to the underlying writer
+func (p *Writer) Flush() error {
+	return p.w.Flush()
+}
+
+// padding returns how many bytes are needed to align l to 32 bits
+func padding(l int) int {
+	return (4 - l%4) % 4
+}
+
+// writeBlock writes block of given type, with already padded body followed by options
+func (p *Writer) writeBlock(blockType uint32, body []byte, options []pcapngOption) error {
+	optLen := 0
+	if len(options) > 0 {
+		for _, o := range options {
+			optLen += 4 + len(o.value) + padding(len(o.value))
+		}
+		// opt_endofopt
+		optLen += 4
+	}
+	total := 12 + len(body) + optLen
+	b := make([]byte, total)
+	binary.LittleEndian.PutUint32(b[0:], blockType)
+	binary.LittleEndian.PutUint32(b[4:], uint32(total))
+	pos := 8 + copy(b[8:], body)
+	if len(options) > 0 {
+		for _, o := range options {
+			binary.LittleEndian.PutUint16(b[pos:], o.code)
+			binary.LittleEndian.PutUint16(b[pos+2:], uint16(len(o.value)))
+			pos += 4 + copy(b[pos+4:], o.value) + padding(len(o.value))
+		}
+		// opt_endofopt is all zeroes
+		pos += 4
+	}
+	binary.LittleEndian.PutUint32(b[pos:], uint32(total))
+	_, err := p.w.Write(b)
+	return err
+}
@@ -0,0 +1,74 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pcapng
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/require"
+)
+
+// ptpFrame returns Sync carried directly over Ethernet
+func ptpFrame(t *testing.T) []byte {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x0c, 0x42, 0xa1, 0x6d, 0x7c, 0xa6},
+		DstMAC:       net.HardwareAddr{0x01, 0x1b, 0x19, 0x00, 0x00, 0x00},
+		EthernetType: layers.EthernetType(0x88F7),
+	}
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, eth, gopacket.Payload(testSync(t))))
+	return buf.Bytes()
+}
+
+func TestPcapngWriter(t *testing.T) {
+	frame := ptpFrame(t)
+	ts := time.Unix(1621600325, 123456789)
+	comment := Comment("hardware", false, testSync(t))
+
+	var out bytes.Buffer
+	w, err := NewWriter(&out, "test", "eth0", layers.LinkTypeEthernet, 65535)
+	require.NoError(t, err)
+	require.NoError(t, w.WritePacket(ts, frame, len(frame), comment))
+	require.NoError(t, w.WritePacket(ts.Add(time.Millisecond), frame[:len(frame)-1], len(frame), ""))
+	require.NoError(t, w.Flush())
+	require.True(t, bytes.Contains(out.Bytes(), []byte(comment)))
+
+	r, err := pcapgo.NewNgReader(bytes.NewReader(out.Bytes()), pcapgo.DefaultNgReaderOptions)
+	require.NoError(t, err)
+	require.Equal(t, layers.LinkTypeEthernet, r.LinkType())
+	iface, err := r.Interface(0)
+	require.NoError(t, err)
+	require.Equal(t, "eth0", iface.Name)
+
+	data, ci, err := r.ReadPacketData()
+	require.NoError(t, err)
+	require.Equal(t, frame, data)
+	require.Equal(t, ts.UnixNano(), ci.Timestamp.UnixNano())
+	require.Equal(t, len(frame), ci.Length)
+
+	data, ci, err = r.ReadPacketData()
+	require.NoError(t, err)
+	require.Equal(t, frame[:len(frame)-1], data)
+	require.Equal(t, ts.Add(time.Millisecond).UnixNano(), ci.Timestamp.UnixNano())
+	require.Equal(t, len(frame), ci.Length)
+}
@@ -0,0 +1,183 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrOverflow is returned when result of PTP time arithmetic doesn't fit into its type
+var ErrOverflow = errors.New("overflow")
+
+// largest values of TimeInterval, out of range intervals are encoded as them
+const (
+	timeIntervalMax = TimeInterval(math.MaxInt64)
+	timeIntervalMin = TimeInterval(math.MinInt64)
+)
+
+// maxTimeIntervalDuration is the largest duration which fits into TimeInterval
+const maxTimeIntervalDuration = time.Duration(math.MaxInt64 / twoPow16)
+
+// maxPTPSeconds is the largest number of seconds uint48 holds
+const maxPTPSeconds = 1<<48 - 1
+
+const nanosecondsInSecond = uint32(time.Second)
+
+// addInt64 returns a+b, reporting signed overflow
+func addInt64(a, b int64) (int64, bool) {
+	s := a + b
+	// signed overflow happens when both operands have the same sign and the result has a different one
+	if (a >= 0) == (b >= 0) && (s >= 0) != (a >= 0) {
+		return 0, false
+	}
+	return s, true
+}
+
+// saturate returns the largest TimeInterval of the sign
+func saturate(positive bool) TimeInterval {
+	if positive {
+		return timeIntervalMax
+	}
+	return timeIntervalMin
+}
+
+// NewTimeIntervalFromDuration returns TimeInterval built from time.Duration, saturating durations that don't fit
+func NewTimeIntervalFromDuration(d time.Duration) TimeInterval {
+	if d > maxTimeIntervalDuration || d < -maxTimeIntervalDuration {
+		return saturate(d > 0)
+	}
+	return TimeInterval(d * twoPow16)
+}
+
+// Saturated reports if TimeInterval is out of range of the type and holds one of its largest values
+func (t TimeInterval) Saturated() bool {
+	return t == timeIntervalMax || t == timeIntervalMin
+}
+
+// Duration converts TimeInterval to time.Duration, dropping sub-nanosecond part.
+// Saturated TimeInterval is out of range, so ErrOverflow is returned for it
+func (t TimeInterval) Duration() (time.Duration, error) {
+	if t.Saturated() {
+		return 0, fmt.Errorf("converting %v: %w", t, ErrOverflow)
+	}
+	return time.Duration(t / twoPow16), nil
+}
+
+// Add returns t+o. On overflow, or if any of the operands is saturated,
+// the result saturates in the direction of the overflow and ErrOverflow is returned
+func (t TimeInterval) Add(o TimeInterval) (TimeInterval, error) {
+	if t.Saturated() || o.Saturated() {
+		if t.Saturated() && o.Saturated() && t != o {
+			// infinities of different signs, there is no meaningful result
+			return 0, fmt.Errorf("adding %v to %v: %w", o, t, ErrOverflow)
+		}
+		if t.Saturated() {
+			return t, fmt.Errorf("adding %v to %v: %w", o, t, ErrOverflow)
+		}
+		return o, fmt.Errorf("adding %v to %v: %w", o, t, ErrOverflow)
+	}
+	s, ok := addInt64(int64(t), int64(o))
+	if !ok || TimeInterval(s).Saturated() {
+		return saturate(t > 0), fmt.Errorf("adding %v to %v: %w", o, t, ErrOverflow)
+	}
+	return TimeInterval(s), nil
+}
+
+// Sub returns t-o, see Add
+func (t TimeInterval) Sub(o TimeInterval) (TimeInterval, error) {
+	switch o {
+	case timeIntervalMax:
+		return t.Add(timeIntervalMin)
+	case timeIntervalMin:
+		return t.Add(timeIntervalMax)
+	}
+	return t.Add(-o)
+}
+
+// Compare returns -1, 0 or 1 if t is less, equal or greater than o
+func (t TimeInterval) Compare(o TimeInterval) int {
+	switch {
+	case t < o:
+		return -1
+	case t > o:
+		return 1
+	}
+	return 0
+}
+
+// Valid reports if Timestamp is well-formed: nanoseconds are always less than a second
+func (t Timestamp) Valid() bool {
+	return t.Nanoseconds < nanosecondsInSecond
+}
+
+// Compare returns -1, 0 or 1 if t is before, equal or after o
+func (t Timestamp) Compare(o Timestamp) int {
+	ts, os := t.Seconds.Seconds(), o.Seconds.Seconds()
+	switch {
+	case ts < os:
+		return -1
+	case ts > os:
+		return 1
+	case t.Nanoseconds < o.Nanoseconds:
+		return -1
+	case t.Nanoseconds > o.Nanoseconds:
+		return 1
+	}
+	return 0
+}
+
+// Add returns Timestamp moved by d. ErrOverflow is returned if the result is before the epoch or past uint48 seconds
+func (t Timestamp) Add(d time.Duration) (Timestamp, error) {
+	if !t.Valid() {
+		return Timestamp{}, fmt.Errorf("invalid %v: nanoseconds %d out of range", t, t.Nanoseconds)
+	}
+	secs := int64(t.Seconds.Seconds()) + int64(d/time.Second)
+	nanos := int64(t.Nanoseconds) + int64(d%time.Second)
+	if nanos < 0 {
+		secs--
+		nanos += int64(time.Second)
+	} else if nanos >= int64(time.Second) {
+		secs++
+		nanos -= int64(time.Second)
+	}
+	if secs < 0 || secs > maxPTPSeconds {
+		return Timestamp{}, fmt.Errorf("adding %v to %v: %w", d, t, ErrOverflow)
+	}
+	return Timestamp{Seconds: newPTPSecondsFromUint(uint64(secs)), Nanoseconds: uint32(nanos)}, nil
+}
+
+// Sub returns t-o. ErrOverflow is returned if the difference doesn't fit into time.Duration
+func (t Timestamp) Sub(o Timestamp) (time.Duration, error) {
+	if !t.Valid() || !o.Valid() {
+		return 0, fmt.Errorf("subtracting %v from %v: invalid timestamp", o, t)
+	}
+	// both fit into int64 as they are uint48
+	secs := int64(t.Seconds.Seconds()) - int64(o.Seconds.Seconds())
+	nanos := int64(t.Nanoseconds) - int64(o.Nanoseconds)
+	const maxSeconds = int64(math.MaxInt64 / time.Second)
+	if secs > maxSeconds || secs < -maxSeconds {
+		return 0, fmt.Errorf("subtracting %v from %v: %w", o, t, ErrOverflow)
+	}
+	d, ok := addInt64(secs*int64(time.Second), nanos)
+	if !ok {
+		return 0, fmt.Errorf("subtracting %v from %v: %w", o, t, ErrOverflow)
+	}
+	return time.Duration(d), nil
+}
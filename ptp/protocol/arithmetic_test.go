@@ -0,0 +1,164 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTimeIntervalFromDuration(t *testing.T) {
+	require.Equal(t, TimeInterval(0x28000*1000), NewTimeIntervalFromDuration(2500*time.Nanosecond))
+	require.Equal(t, TimeInterval(-65536), NewTimeIntervalFromDuration(-time.Nanosecond))
+	require.Equal(t, timeIntervalMax, NewTimeIntervalFromDuration(maxTimeIntervalDuration+1))
+	require.Equal(t, timeIntervalMin, NewTimeIntervalFromDuration(-maxTimeIntervalDuration-1))
+	require.False(t, NewTimeIntervalFromDuration(maxTimeIntervalDuration).Saturated())
+}
+
+func TestNewTimeIntervalSaturates(t *testing.T) {
+	require.Equal(t, TimeInterval(0x28000), NewTimeInterval(2.5))
+	require.Equal(t, timeIntervalMax, NewTimeInterval(math.MaxInt64))
+	require.Equal(t, timeIntervalMin, NewTimeInterval(-math.MaxInt64))
+	require.True(t, NewTimeInterval(math.Inf(1)).Saturated())
+}
+
+func TestTimeIntervalDuration(t *testing.T) {
+	d, err := NewTimeInterval(2.5).Duration()
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Nanosecond, d)
+	d, err = NewTimeIntervalFromDuration(-time.Second).Duration()
+	require.NoError(t, err)
+	require.Equal(t, -time.Second, d)
+
+	_, err = timeIntervalMax.Duration()
+	require.True(t, errors.Is(err, ErrOverflow))
+	_, err = timeIntervalMin.Duration()
+	require.True(t, errors.Is(err, ErrOverflow))
+}
+
+func TestTimeIntervalAddSub(t *testing.T) {
+	a := NewTimeIntervalFromDuration(3 * time.Microsecond)
+	b := NewTimeIntervalFromDuration(time.Microsecond)
+	s, err := a.Add(b)
+	require.NoError(t, err)
+	require.Equal(t, NewTimeIntervalFromDuration(4*time.Microsecond), s)
+	s, err = a.Sub(b)
+	require.NoError(t, err)
+	require.Equal(t, NewTimeIntervalFromDuration(2*time.Microsecond), s)
+	s, err = b.Sub(a)
+	require.NoError(t, err)
+	require.Equal(t, NewTimeIntervalFromDuration(-2*time.Microsecond), s)
+
+	// overflow saturates
+	s, err = (timeIntervalMax - 1).Add(2)
+	require.True(t, errors.Is(err, ErrOverflow))
+	require.Equal(t, timeIntervalMax, s)
+	s, err = (timeIntervalMin + 1).Sub(2)
+	require.True(t, errors.Is(err, ErrOverflow))
+	require.Equal(t, timeIntervalMin, s)
+	// landing exactly on the largest value is out of range too
+	s, err = (timeIntervalMax - 1).Add(1)
+	require.True(t, errors.Is(err, ErrOverflow))
+	require.Equal(t, timeIntervalMax, s)
+
+	// saturated stays saturated
+	s, err = timeIntervalMax.Sub(b)
+	require.True(t, errors.Is(err, ErrOverflow))
+	require.Equal(t, timeIntervalMax, s)
+	s, err = a.Sub(timeIntervalMax)
+	require.True(t, errors.Is(err, ErrOverflow))
+	require.Equal(t, timeIntervalMin, s)
+	_, err = timeIntervalMax.Add(timeIntervalMin)
+	require.True(t, errors.Is(err, ErrOverflow))
+}
+
+func TestTimeIntervalCompare(t *testing.T) {
+	require.Equal(t, -1, TimeInterval(1).Compare(2))
+	require.Equal(t, 0, TimeInterval(2).Compare(2))
+	require.Equal(t, 1, TimeInterval(2).Compare(-2))
+}
+
+func TestPTPSecondsRoundTrip(t *testing.T) {
+	for _, secs := range []uint64{0, 1, 1700000000, maxPTPSeconds} {
+		require.Equal(t, secs, newPTPSecondsFromUint(secs).Seconds())
+	}
+	// only lower 48 bits are kept
+	require.Equal(t, uint64(5), newPTPSecondsFromUint(1<<48+5).Seconds())
+	require.Equal(t, PTPSeconds{0, 0, 0x65, 0x53, 0xf1, 0x00}, NewPTPSeconds(time.Unix(1700000000, 0)))
+}
+
+func TestTimestampCompare(t *testing.T) {
+	a := NewTimestamp(time.Unix(1700000000, 10))
+	b := NewTimestamp(time.Unix(1700000000, 20))
+	c := NewTimestamp(time.Unix(1700000001, 0))
+	require.Equal(t, -1, a.Compare(b))
+	require.Equal(t, 1, b.Compare(a))
+	require.Equal(t, -1, b.Compare(c))
+	require.Equal(t, 1, c.Compare(a))
+	require.Equal(t, 0, a.Compare(a))
+}
+
+func TestTimestampAdd(t *testing.T) {
+	ts := NewTimestamp(time.Unix(1700000000, 999999999))
+	got, err := ts.Add(time.Nanosecond)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1700000001, 0), got.Time())
+
+	got, err = ts.Add(-time.Second - 999999999)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1699999999, 0), got.Time())
+
+	got, err = ts.Add(-1500 * time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1699999999, 499999999), got.Time())
+
+	_, err = NewTimestamp(time.Unix(1, 0)).Add(-2 * time.Second)
+	require.True(t, errors.Is(err, ErrOverflow))
+
+	last := Timestamp{Seconds: newPTPSecondsFromUint(maxPTPSeconds), Nanoseconds: 999999999}
+	_, err = last.Add(time.Nanosecond)
+	require.True(t, errors.Is(err, ErrOverflow))
+
+	_, err = Timestamp{Nanoseconds: nanosecondsInSecond}.Add(0)
+	require.Error(t, err)
+}
+
+func TestTimestampSub(t *testing.T) {
+	a := NewTimestamp(time.Unix(1700000000, 100))
+	b := NewTimestamp(time.Unix(1699999999, 999999900))
+	d, err := a.Sub(b)
+	require.NoError(t, err)
+	require.Equal(t, 200*time.Nanosecond, d)
+	d, err = b.Sub(a)
+	require.NoError(t, err)
+	require.Equal(t, -200*time.Nanosecond, d)
+
+	// more than 292 years apart doesn't fit
+	last := Timestamp{Seconds: newPTPSecondsFromUint(maxPTPSeconds)}
+	_, err = last.Sub(a)
+	require.True(t, errors.Is(err, ErrOverflow))
+	_, err = a.Sub(last)
+	require.True(t, errors.Is(err, ErrOverflow))
+
+	require.True(t, a.Valid())
+	_, err = a.Sub(Timestamp{Nanoseconds: nanosecondsInSecond})
+	require.Error(t, err)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrAuthentication is returned when message fails AUTHENTICATION TLV verification
+var ErrAuthentication = errors.New("authentication failed")
+
+// AuthICVLength is the length of HMAC-SHA256-128 ICV, the only integrity algorithm we support
+const AuthICVLength = 16
+
+// AuthenticationTLVSize is the size of AUTHENTICATION TLV with HMAC-SHA256-128 ICV
+const AuthenticationTLVSize = tlvHeadSize + 6 + AuthICVLength
+
+// AuthenticationTLV Table 131 AUTHENTICATION TLV format.
+// Only immediate security processing is supported, so optional disclosedKey, sequenceNo and RES fields are never present.
+type AuthenticationTLV struct {
+	TLVHead
+	SPP               uint8 // Security Parameters Pointer
+	SecParamIndicator uint8
+	KeyID             uint32
+	ICV               []byte
+}
+
+// MarshalBinaryTo marshals bytes to AuthenticationTLV
+func (t *AuthenticationTLV) MarshalBinaryTo(b []byte) (int, error) {
+	size := tlvHeadSize + 6 + len(t.ICV)
+	if len(b) < size {
+		return 0, fmt.Errorf("not enough buffer to write AuthenticationTLV")
+	}
+	tlvHeadMarshalBinaryTo(&t.TLVHead, b)
+	b[tlvHeadSize] = t.SPP
+	b[tlvHeadSize+1] = t.SecParamIndicator
+	binary.BigEndian.PutUint32(b[tlvHeadSize+2:], t.KeyID)
+	copy(b[tlvHeadSize+6:], t.ICV)
+	return size, nil
+}
+
+// UnmarshalBinary parses []byte and populates struct fields
+func (t *AuthenticationTLV) UnmarshalBinary(b []byte) error {
+	r := reader{b: b}
+	v := r.tlvHead(&t.TLVHead, 6, false)
+	if r.err != nil {
+		return r.err
+	}
+	t.SPP = v.uint8("SPP")
+	t.SecParamIndicator = v.uint8("SecParamIndicator")
+	t.KeyID = v.uint32("KeyID")
+	if v.err == nil && t.SecParamIndicator != 0 {
+		return fmt.Errorf("delayed security processing is not supported, secParamIndicator %#x", t.SecParamIndicator)
+	}
+	t.ICV = v.bytes("ICV", v.len())
+	return v.err
+}
+
+// authICV calculates HMAC-SHA256-128 over the message up to ICV.
+// correctionField is modified by transparent clocks on the path, so it's treated as zero.
+func authICV(b []byte, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b[:8])
+	mac.Write(make([]byte, 8))
+	mac.Write(b[16:])
+	return mac.Sum(nil)[:AuthICVLength]
+}
+
+// SignMessage returns copy of PTP message with AUTHENTICATION TLV appended after TLVs it already has, and messageLength updated accordingly.
+// Any trailing bytes after messageLength are preserved.
+func SignMessage(b []byte, spp uint8, keyID uint32, key []byte) ([]byte, error) {
+	if len(b) < headerSize {
+		return nil, fmt.Errorf("not enough data to sign PTP message")
+	}
+	n := int(binary.BigEndian.Uint16(b[2:]))
+	if n < headerSize || n > len(b) {
+		return nil, fmt.Errorf("invalid messageLength %d for %d bytes", n, len(b))
+	}
+	if n+AuthenticationTLVSize > 0xffff {
+		return nil, fmt.Errorf("message is too long to sign")
+	}
+	out := make([]byte, len(b)+AuthenticationTLVSize)
+	copy(out, b[:n])
+	copy(out[n+AuthenticationTLVSize:], b[n:])
+	binary.BigEndian.PutUint16(out[2:], uint16(n+AuthenticationTLVSize))
+	tlv := &AuthenticationTLV{
+		TLVHead: TLVHead{TLVType: TLVAuthentication, LengthField: AuthenticationTLVSize - tlvHeadSize},
+		SPP:     spp,
+		KeyID:   keyID,
+		ICV:     make([]byte, AuthICVLength),
+	}
+	if _, err := tlv.MarshalBinaryTo(out[n:]); err != nil {
+		return nil, err
+	}
+	icvAt := n + AuthenticationTLVSize - AuthICVLength
+	copy(out[icvAt:], authICV(out[:icvAt], key))
+	return out, nil
+}
+
+// VerifyMessage checks PTP message ends with AUTHENTICATION TLV for given SPP and key ID, with valid ICV
+func VerifyMessage(b []byte, spp uint8, keyID uint32, key []byte) error {
+	if len(b) < headerSize+AuthenticationTLVSize {
+		return fmt.Errorf("%w: message is too short to carry AUTHENTICATION TLV", ErrAuthentication)
+	}
+	n := int(binary.BigEndian.Uint16(b[2:]))
+	if n < headerSize+AuthenticationTLVSize || n > len(b) {
+		return fmt.Errorf("%w: invalid messageLength %d", ErrAuthentication, n)
+	}
+	// AUTHENTICATION TLV must be the last one
+	tlv := &AuthenticationTLV{}
+	if err := tlv.UnmarshalBinary(b[n-AuthenticationTLVSize : n]); err != nil || tlv.TLVType != TLVAuthentication {
+		return fmt.Errorf("%w: no AUTHENTICATION TLV", ErrAuthentication)
+	}
+	if tlv.SPP != spp || tlv.KeyID != keyID {
+		return fmt.Errorf("%w: unexpected SPP %d key ID %d", ErrAuthentication, tlv.SPP, tlv.KeyID)
+	}
+	if !hmac.Equal(tlv.ICV, authICV(b[:n-AuthICVLength], key)) {
+		return fmt.Errorf("%w: ICV mismatch", ErrAuthentication)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testAuthKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestAuthenticationTLV(t *testing.T) {
+	tlv := &AuthenticationTLV{
+		TLVHead: TLVHead{TLVType: TLVAuthentication, LengthField: AuthenticationTLVSize - tlvHeadSize},
+		SPP:     3,
+		KeyID:   0x01020304,
+		ICV:     []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+	}
+	b := make([]byte, AuthenticationTLVSize)
+	n, err := tlv.MarshalBinaryTo(b)
+	require.NoError(t, err)
+	require.Equal(t, AuthenticationTLVSize, n)
+	require.Equal(t, []byte{0x80, 0x09, 0x00, 0x16, 0x03, 0x00, 0x01, 0x02, 0x03, 0x04}, b[:10])
+
+	got := &AuthenticationTLV{}
+	require.NoError(t, got.UnmarshalBinary(b))
+	require.Equal(t, tlv, got)
+
+	_, err = tlv.MarshalBinaryTo(b[:10])
+	require.Error(t, err)
+	require.Error(t, got.UnmarshalBinary(b[:10]))
+	// delayed processing is not supported
+	b[5] = 1
+	require.Error(t, got.UnmarshalBinary(b))
+}
+
+func TestSignVerifyMessage(t *testing.T) {
+	delayReq := &SyncDelayReq{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageDelayReq, 0),
+			Version:         Version,
+			MessageLength:   44,
+			FlagField:       FlagUnicast | FlagProfileSpecific1,
+			SequenceID:      42,
+		},
+	}
+	b, err := Bytes(delayReq)
+	require.NoError(t, err)
+	signed, err := SignMessage(b, 1, 2, testAuthKey)
+	require.NoError(t, err)
+	require.Equal(t, len(b)+AuthenticationTLVSize, len(signed))
+	require.Equal(t, uint16(44+AuthenticationTLVSize), binary.BigEndian.Uint16(signed[2:]))
+	// trailing bytes are preserved
+	require.Equal(t, []byte{0, 0}, signed[len(signed)-2:])
+	require.NoError(t, VerifyMessage(signed, 1, 2, testAuthKey))
+
+	// signed message still decodes
+	got := &SyncDelayReq{}
+	require.NoError(t, FromBytes(signed, got))
+	require.Equal(t, uint16(42), got.SequenceID)
+
+	// transparent clocks update correctionField
+	binary.BigEndian.PutUint64(signed[8:], uint64(NewCorrection(1234)))
+	require.NoError(t, VerifyMessage(signed, 1, 2, testAuthKey))
+
+	require.ErrorIs(t, VerifyMessage(signed, 1, 2, []byte("wrong key")), ErrAuthentication)
+	require.ErrorIs(t, VerifyMessage(signed, 0, 2, testAuthKey), ErrAuthentication)
+	require.ErrorIs(t, VerifyMessage(signed, 1, 3, testAuthKey), ErrAuthentication)
+	require.ErrorIs(t, VerifyMessage(b, 1, 2, testAuthKey), ErrAuthentication)
+
+	// any other modification is detected
+	signed[34]++
+	require.ErrorIs(t, VerifyMessage(signed, 1, 2, testAuthKey), ErrAuthentication)
+
+	_, err = SignMessage(b[:10], 1, 2, testAuthKey)
+	require.Error(t, err)
+}
+
+func TestSignedAnnounce(t *testing.T) {
+	announce := &Announce{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageAnnounce, 0),
+			Version:         Version,
+			MessageLength:   uint16(headerSize + 30 + tlvHeadSize + 8),
+			SequenceID:      7,
+		},
+		AnnounceBody: AnnounceBody{CurrentUTCOffset: 37},
+		TLVs: []TLV{
+			&PathTraceTLV{
+				TLVHead:      TLVHead{TLVType: TLVPathTrace, LengthField: 8},
+				PathSequence: []ClockIdentity{36138748164966842},
+			},
+		},
+	}
+	b, err := Bytes(announce)
+	require.NoError(t, err)
+	signed, err := SignMessage(b, 0, 7, testAuthKey)
+	require.NoError(t, err)
+	require.NoError(t, VerifyMessage(signed, 0, 7, testAuthKey))
+
+	p, err := DecodePacket(signed)
+	require.NoError(t, err)
+	got := p.(*Announce)
+	require.Len(t, got.TLVs, 2)
+	require.Equal(t, announce.TLVs[0], got.TLVs[0])
+	auth, ok := got.TLVs[1].(*AuthenticationTLV)
+	require.True(t, ok)
+	require.Equal(t, uint32(7), auth.KeyID)
+	require.Equal(t, AuthICVLength, len(auth.ICV))
+}
@@ -0,0 +1,157 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package conformance generates edge-case PTP packets to test third-party devices and our own parsers against.
+
+Vectors are grouped in presets:
+
+	tlv-chain      messages filled up to MaxMessageLength with TLVs, and TLV chains with broken framing
+	timestamps     boundary values of timestamps and correction field
+	reserved-bits  permutations of reserved and unused header and body bits
+
+All vectors except Malformed ones are valid PTP messages as far as framing goes, so a conforming parser must decode them,
+and encoding decoded message back must produce exactly the same bytes. Malformed vectors must be rejected.
+*/
+package conformance
+
+import (
+	"encoding"
+	"fmt"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// MaxMessageLength is the length of the largest PTP message which fits into unfragmented UDP over IPv4 on 1500 bytes MTU,
+// leaving room for the two trailing bytes of PTP over UDPv6
+const MaxMessageLength = 1500 - 20 - 8 - 2
+
+// Vector is a single test vector
+type Vector struct {
+	// Name is unique within the preset
+	Name string
+	// Description says what's special about the packet
+	Description string
+	// Malformed is true if message or TLV framing is broken and parser must reject the packet
+	Malformed bool
+	// Packet is the PTP message as sent over the wire, without transport headers
+	Packet []byte
+}
+
+// Preset is a named family of test vectors
+type Preset struct {
+	Name        string
+	Description string
+	generate    func() ([]Vector, error)
+}
+
+// Vectors generates test vectors of the preset
+func (p Preset) Vectors() ([]Vector, error) {
+	return p.generate()
+}
+
+// Presets returns all presets
+func Presets() []Preset {
+	return []Preset{
+		{
+			Name:        "tlv-chain",
+			Description: "messages filled up to the max length with TLVs, and TLV chains with broken framing",
+			generate:    tlvChainVectors,
+		},
+		{
+			Name:        "timestamps",
+			Description: "boundary values of timestamps and correction field",
+			generate:    timestampVectors,
+		},
+		{
+			Name:        "reserved-bits",
+			Description: "permutations of reserved and unused header and body bits",
+			generate:    reservedBitsVectors,
+		},
+	}
+}
+
+// Generate returns vectors of presets with given names, or of all presets if no names are given.
+// Vector names are prefixed with the preset name
+func Generate(names ...string) ([]Vector, error) {
+	presets := map[string]Preset{}
+	all := Presets()
+	for _, p := range all {
+		presets[p.Name] = p
+	}
+	selected := all
+	if len(names) > 0 {
+		selected = make([]Preset, 0, len(names))
+		for _, name := range names {
+			p, found := presets[name]
+			if !found {
+				return nil, fmt.Errorf("unknown preset %q", name)
+			}
+			selected = append(selected, p)
+		}
+	}
+	var res []Vector
+	for _, p := range selected {
+		vectors, err := p.Vectors()
+		if err != nil {
+			return nil, fmt.Errorf("generating %s: %w", p.Name, err)
+		}
+		for _, v := range vectors {
+			v.Name = p.Name + "/" + v.Name
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// packet is a PTP message we can marshal
+type packet interface {
+	encoding.BinaryMarshaler
+	ptp.Packet
+}
+
+// marshal marshals packet with header h, setting its MessageLength to the resulting size
+func marshal(p packet, h *ptp.Header) ([]byte, error) {
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("marshalling %s: %w", p.MessageType(), err)
+	}
+	h.MessageLength = uint16(len(b))
+	return p.MarshalBinary()
+}
+
+// ptpSeconds converts seconds to uint48 PTP seconds, dropping bits which don't fit
+func ptpSeconds(secs uint64) ptp.PTPSeconds {
+	var s ptp.PTPSeconds
+	for i := range s {
+		s[len(s)-1-i] = byte(secs >> (8 * i))
+	}
+	return s
+}
+
+// header returns header of a unicast message of msgType
+func header(msgType ptp.MessageType) ptp.Header {
+	return ptp.Header{
+		SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(msgType, 0),
+		Version:         ptp.Version,
+		FlagField:       ptp.FlagUnicast,
+		SourcePortIdentity: ptp.PortIdentity{
+			ClockIdentity: 0x000000fffe000001,
+			PortNumber:    1,
+		},
+		SequenceID: 42,
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conformance
+
+import (
+	"encoding"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+func TestGenerate(t *testing.T) {
+	all, err := Generate()
+	require.NoError(t, err)
+	names := map[string]bool{}
+	for _, v := range all {
+		require.False(t, names[v.Name], "duplicate vector %s", v.Name)
+		names[v.Name] = true
+		require.NotEmpty(t, v.Description, v.Name)
+		require.LessOrEqual(t, len(v.Packet), MaxMessageLength, v.Name)
+	}
+	var total int
+	for _, p := range Presets() {
+		vectors, err := Generate(p.Name)
+		require.NoError(t, err)
+		require.NotEmpty(t, vectors, p.Name)
+		require.Contains(t, vectors[0].Name, p.Name+"/")
+		total += len(vectors)
+	}
+	require.Equal(t, len(all), total)
+
+	_, err = Generate("timestamps", "nope")
+	require.Error(t, err)
+}
+
+// TestVectorsDecode checks our own decoder against all vectors: valid ones are decoded and encoded back
+// to exactly the same bytes, malformed ones are rejected
+func TestVectorsDecode(t *testing.T) {
+	vectors, err := Generate()
+	require.NoError(t, err)
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			p, err := ptp.DecodePacket(v.Packet)
+			if v.Malformed {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, len(v.Packet), int(binary.BigEndian.Uint16(v.Packet[2:])), "messageLength")
+			b, err := p.(encoding.BinaryMarshaler).MarshalBinary()
+			require.NoError(t, err)
+			require.Equal(t, v.Packet, b)
+		})
+	}
+}
+
+func TestTLVChainVectors(t *testing.T) {
+	vectors, err := tlvChainVectors()
+	require.NoError(t, err)
+	byName := map[string]Vector{}
+	for _, v := range vectors {
+		byName[v.Name] = v
+	}
+
+	p, err := ptp.DecodePacket(byName["announce-path-trace-max"].Packet)
+	require.NoError(t, err)
+	a := p.(*ptp.Announce)
+	require.Len(t, a.TLVs, 1)
+	require.Len(t, a.TLVs[0].(*ptp.PathTraceTLV).PathSequence, 175)
+
+	p, err = ptp.DecodePacket(byName["signaling-request-unicast-max"].Packet)
+	require.NoError(t, err)
+	require.Len(t, p.(*ptp.Signaling).TLVs, 142)
+
+	p, err = ptp.DecodePacket(byName["signaling-empty-pad-max"].Packet)
+	require.NoError(t, err)
+	require.Len(t, p.(*ptp.Signaling).TLVs, 356)
+
+	p, err = ptp.DecodePacket(byName["signaling-experimental-tlv-max"].Packet)
+	require.NoError(t, err)
+	require.Equal(t, MaxMessageLength, int(p.(*ptp.Signaling).MessageLength))
+}
+
+func TestTimestampVectors(t *testing.T) {
+	vectors, err := timestampVectors()
+	require.NoError(t, err)
+	byName := map[string]Vector{}
+	for _, v := range vectors {
+		byName[v.Name] = v
+	}
+
+	p, err := ptp.DecodePacket(byName["follow-up-sec-max"].Packet)
+	require.NoError(t, err)
+	ts := p.(*ptp.FollowUp).PreciseOriginTimestamp
+	require.Equal(t, uint64(1<<48-1), ts.Seconds.Seconds())
+	require.Equal(t, uint32(999999999), ts.Nanoseconds)
+
+	p, err = ptp.DecodePacket(byName["follow-up-correction-too-big"].Packet)
+	require.NoError(t, err)
+	require.True(t, p.(*ptp.FollowUp).CorrectionField.TooBig())
+}
+
+func TestReservedBitsVectors(t *testing.T) {
+	vectors, err := reservedBitsVectors()
+	require.NoError(t, err)
+	byName := map[string]Vector{}
+	for _, v := range vectors {
+		byName[v.Name] = v
+	}
+	// 15 combinations of reserved flags, 15 values of each nibble, 5 messageTypeSpecific, 3 more header fields and all at once, for both messages
+	require.Len(t, vectors, 2*(15+15+15+5+3)+1)
+
+	p, err := ptp.DecodePacket(byName["sync-all-reserved-set"].Packet)
+	require.NoError(t, err)
+	sync := p.(*ptp.SyncDelayReq)
+	require.Equal(t, ptp.MessageSync, sync.MessageType())
+	require.Equal(t, ptp.MajorVersion, sync.MajorVersionPTP())
+	require.Equal(t, ptp.FlagUnicast|0x9880, sync.FlagField)
+
+	p, err = ptp.DecodePacket(byName["announce-all-reserved-set"].Packet)
+	require.NoError(t, err)
+	require.Equal(t, uint8(0xff), p.(*ptp.Announce).Reserved)
+}
+
+func TestPTPSeconds(t *testing.T) {
+	require.Equal(t, ptp.PTPSeconds{0, 0, 0, 0, 0, 1}, ptpSeconds(1))
+	require.Equal(t, ptp.PTPSeconds{0, 1, 0, 0, 0, 0}, ptpSeconds(1<<32))
+	require.Equal(t, uint64(1<<48-1), ptpSeconds(1<<48-1).Seconds())
+}
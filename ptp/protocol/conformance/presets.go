@@ -0,0 +1,407 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conformance
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// sizes of message parts we build vectors from
+const (
+	headerSize    = 34
+	announceSize  = headerSize + 30
+	signalingSize = headerSize + 10
+	tlvHeadSize   = 4
+)
+
+// tlvTypeExperimental is the first TLV type reserved for experimental TLVs, which nobody is supposed to understand
+const tlvTypeExperimental ptp.TLVType = 0x2004
+
+// announce returns Announce with sane values in every field
+func announce() *ptp.Announce {
+	return &ptp.Announce{
+		Header: header(ptp.MessageAnnounce),
+		AnnounceBody: ptp.AnnounceBody{
+			CurrentUTCOffset:     37,
+			GrandmasterPriority1: 128,
+			GrandmasterClockQuality: ptp.ClockQuality{
+				ClockClass:              ptp.ClockClass6,
+				ClockAccuracy:           ptp.ClockAccuracyNanosecond100,
+				OffsetScaledLogVariance: 0x4e5d,
+			},
+			GrandmasterPriority2: 128,
+			GrandmasterIdentity:  0x000000fffe000001,
+			TimeSource:           ptp.TimeSourceGNSS,
+		},
+	}
+}
+
+// signaling returns Signaling with no TLVs
+func signaling() *ptp.Signaling {
+	return &ptp.Signaling{
+		Header:             header(ptp.MessageSignaling),
+		TargetPortIdentity: ptp.DefaultTargetPortIdentity,
+	}
+}
+
+// requestUnicast returns REQUEST_UNICAST_TRANSMISSION TLV asking for msgType every second for a minute
+func requestUnicast(msgType ptp.MessageType) *ptp.RequestUnicastTransmissionTLV {
+	return &ptp.RequestUnicastTransmissionTLV{
+		TLVHead:            ptp.TLVHead{TLVType: ptp.TLVRequestUnicastTransmission, LengthField: 6},
+		MsgTypeAndReserved: ptp.NewUnicastMsgTypeAndFlags(msgType, 0),
+		DurationField:      60,
+	}
+}
+
+// tlvChainVectors returns messages with as many TLVs as fit into MaxMessageLength, and TLV chains with broken framing
+func tlvChainVectors() ([]Vector, error) {
+	var res []Vector
+	add := func(name, description string, b []byte, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		res = append(res, Vector{Name: name, Description: description, Packet: b})
+		return nil
+	}
+
+	a := announce()
+	n := (MaxMessageLength - announceSize - tlvHeadSize) / 8
+	pathTrace := &ptp.PathTraceTLV{
+		TLVHead:      ptp.TLVHead{TLVType: ptp.TLVPathTrace, LengthField: uint16(8 * n)},
+		PathSequence: make([]ptp.ClockIdentity, n),
+	}
+	for i := range pathTrace.PathSequence {
+		pathTrace.PathSequence[i] = ptp.ClockIdentity(0x000000fffe000000 + uint64(i))
+	}
+	a.TLVs = []ptp.TLV{pathTrace}
+	b, err := marshal(a, &a.Header)
+	if err := add("announce-path-trace-max", fmt.Sprintf("Announce with PATH_TRACE of %d clocks", n), b, err); err != nil {
+		return nil, err
+	}
+
+	s := signaling()
+	n = (MaxMessageLength - signalingSize) / (tlvHeadSize + 6)
+	msgTypes := []ptp.MessageType{ptp.MessageAnnounce, ptp.MessageSync, ptp.MessageDelayResp}
+	for i := 0; i < n; i++ {
+		s.TLVs = append(s.TLVs, requestUnicast(msgTypes[i%len(msgTypes)]))
+	}
+	b, err = marshal(s, &s.Header)
+	if err := add("signaling-request-unicast-max", fmt.Sprintf("Signaling with %d REQUEST_UNICAST_TRANSMISSION TLVs", n), b, err); err != nil {
+		return nil, err
+	}
+
+	s = signaling()
+	n = (MaxMessageLength - signalingSize) / tlvHeadSize
+	for i := 0; i < n; i++ {
+		s.TLVs = append(s.TLVs, &ptp.PadTLV{TLVHead: ptp.TLVHead{TLVType: ptp.TLVPad}})
+	}
+	b, err = marshal(s, &s.Header)
+	if err := add("signaling-empty-pad-max", fmt.Sprintf("Signaling with %d PAD TLVs of zero length", n), b, err); err != nil {
+		return nil, err
+	}
+
+	s = signaling()
+	l := MaxMessageLength - signalingSize - tlvHeadSize
+	l -= l % 2
+	value := make([]byte, l)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	s.TLVs = []ptp.TLV{&ptp.UnknownTLV{TLVHead: ptp.TLVHead{TLVType: tlvTypeExperimental, LengthField: uint16(l)}, Value: value}}
+	b, err = marshal(s, &s.Header)
+	if err := add("signaling-experimental-tlv-max", fmt.Sprintf("Signaling with a single experimental TLV of %d bytes", l), b, err); err != nil {
+		return nil, err
+	}
+
+	s = signaling()
+	s.TLVs = []ptp.TLV{
+		requestUnicast(ptp.MessageSync),
+		&ptp.GrantUnicastTransmissionTLV{
+			TLVHead:            ptp.TLVHead{TLVType: ptp.TLVGrantUnicastTransmission, LengthField: 8},
+			MsgTypeAndReserved: ptp.NewUnicastMsgTypeAndFlags(ptp.MessageAnnounce, 0),
+			DurationField:      60,
+			Renewal:            1,
+		},
+		&ptp.CancelUnicastTransmissionTLV{
+			TLVHead:         ptp.TLVHead{TLVType: ptp.TLVCancelUnicastTransmission, LengthField: 2},
+			MsgTypeAndFlags: ptp.NewUnicastMsgTypeAndFlags(ptp.MessageDelayResp, 0),
+		},
+		&ptp.AcknowledgeCancelUnicastTransmissionTLV{
+			TLVHead:         ptp.TLVHead{TLVType: ptp.TLVAcknowledgeCancelUnicastTransmission, LengthField: 2},
+			MsgTypeAndFlags: ptp.NewUnicastMsgTypeAndFlags(ptp.MessageSync, 0),
+		},
+		&ptp.OrganizationExtensionTLV{
+			TLVHead:             ptp.TLVHead{TLVType: ptp.TLVOrganizationExtensionDoNotPropagate, LengthField: 6 + 4},
+			OrganizationID:      [3]uint8{0xff, 0xff, 0xff},
+			OrganizationSubType: [3]uint8{0x00, 0x00, 0x01},
+			DataField:           []byte{0xde, 0xad, 0xbe, 0xef},
+		},
+		&ptp.UnknownTLV{TLVHead: ptp.TLVHead{TLVType: tlvTypeExperimental, LengthField: 2}, Value: []byte{0xff, 0xff}},
+		&ptp.PadTLV{TLVHead: ptp.TLVHead{TLVType: ptp.TLVPad, LengthField: 2}, Pad: []byte{0, 0}},
+	}
+	b, err = marshal(s, &s.Header)
+	if err := add("signaling-mixed-chain", "Signaling with unicast negotiation, organization extension, experimental and PAD TLVs", b, err); err != nil {
+		return nil, err
+	}
+
+	// malformed ones are built from a valid message with a single REQUEST_UNICAST_TRANSMISSION TLV
+	s = signaling()
+	s.TLVs = []ptp.TLV{requestUnicast(ptp.MessageSync)}
+	valid, err := marshal(s, &s.Header)
+	if err != nil {
+		return nil, err
+	}
+	malformed := func(name, description string, corrupt func(b []byte) []byte) {
+		b := corrupt(append([]byte(nil), valid...))
+		res = append(res, Vector{Name: name, Description: description, Malformed: true, Packet: b})
+	}
+	malformed("signaling-tlv-overrun", "TLV length runs past the end of the message", func(b []byte) []byte {
+		binary.BigEndian.PutUint16(b[signalingSize+2:], 8)
+		return b
+	})
+	malformed("signaling-tlv-too-short", "REQUEST_UNICAST_TRANSMISSION TLV of zero length", func(b []byte) []byte {
+		binary.BigEndian.PutUint16(b[signalingSize+2:], 0)
+		return b[:signalingSize+tlvHeadSize]
+	})
+	malformed("signaling-length-overrun", "messageLength claims more bytes than there are", func(b []byte) []byte {
+		binary.BigEndian.PutUint16(b[2:], uint16(len(b)+2))
+		return b
+	})
+	malformed("signaling-truncated-header", "message shorter than the common header", func(b []byte) []byte {
+		return b[:headerSize-1]
+	})
+	return res, nil
+}
+
+// timestampCase is a timestamp value to test
+type timestampCase struct {
+	name        string
+	description string
+	seconds     uint64
+	nanoseconds uint32
+}
+
+var timestampCases = []timestampCase{
+	{name: "zero", description: "PTP epoch", seconds: 0, nanoseconds: 0},
+	{name: "ns-max", description: "last nanosecond of the first second", seconds: 0, nanoseconds: 999999999},
+	{name: "sec-uint32-max", description: "last second fitting into uint32", seconds: math.MaxUint32, nanoseconds: 999999999},
+	{name: "sec-uint32-wrap", description: "first second not fitting into uint32", seconds: math.MaxUint32 + 1, nanoseconds: 0},
+	{name: "sec-max", description: "last nanosecond of uint48 seconds", seconds: 1<<48 - 1, nanoseconds: 999999999},
+	{name: "ns-out-of-range", description: "nanoseconds equal to a full second, out of range", seconds: 1, nanoseconds: 1000000000},
+	{name: "ns-all-ones", description: "nanoseconds with all bits set, out of range", seconds: 1, nanoseconds: math.MaxUint32},
+}
+
+// correctionCase is a correctionField value to test
+type correctionCase struct {
+	name        string
+	description string
+	correction  ptp.Correction
+}
+
+var correctionCases = []correctionCase{
+	{name: "correction-subns", description: "smallest positive correction, 2^-16 ns", correction: 1},
+	{name: "correction-negative-subns", description: "smallest negative correction, -2^-16 ns", correction: -1},
+	{name: "correction-negative-ns", description: "negative correction of 1ns", correction: -1 << 16},
+	{name: "correction-max", description: "largest correction which is not too big to be represented", correction: math.MaxInt64 - 1},
+	{name: "correction-too-big", description: "correction too big to be represented", correction: math.MaxInt64},
+	{name: "correction-min", description: "most negative correction", correction: math.MinInt64},
+}
+
+// timestampVectors returns event messages and their follow ups with boundary timestamps and corrections
+func timestampVectors() ([]Vector, error) {
+	var res []Vector
+	for _, c := range timestampCases {
+		ts := ptp.Timestamp{Seconds: ptpSeconds(c.seconds), Nanoseconds: c.nanoseconds}
+
+		sync := &ptp.SyncDelayReq{Header: header(ptp.MessageSync)}
+		sync.OriginTimestamp = ts
+		followUp := &ptp.FollowUp{Header: header(ptp.MessageFollowUp)}
+		followUp.PreciseOriginTimestamp = ts
+		delayResp := &ptp.DelayResp{Header: header(ptp.MessageDelayResp)}
+		delayResp.ReceiveTimestamp = ts
+		delayResp.RequestingPortIdentity = ptp.PortIdentity{ClockIdentity: 0x000000fffe000002, PortNumber: 1}
+		a := announce()
+		a.OriginTimestamp = ts
+
+		for _, m := range []struct {
+			name string
+			p    packet
+			h    *ptp.Header
+		}{
+			{"sync", sync, &sync.Header},
+			{"follow-up", followUp, &followUp.Header},
+			{"delay-resp", delayResp, &delayResp.Header},
+			{"announce", a, &a.Header},
+		} {
+			b, err := marshal(m.p, m.h)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, Vector{
+				Name:        m.name + "-" + c.name,
+				Description: fmt.Sprintf("%s with %s timestamp", m.p.MessageType(), c.description),
+				Packet:      b,
+			})
+		}
+	}
+	for _, c := range correctionCases {
+		followUp := &ptp.FollowUp{Header: header(ptp.MessageFollowUp)}
+		followUp.CorrectionField = c.correction
+		followUp.PreciseOriginTimestamp = ptp.NewTimestamp(time.Unix(1700000000, 0))
+		b, err := marshal(followUp, &followUp.Header)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, Vector{
+			Name:        "follow-up-" + c.name,
+			Description: fmt.Sprintf("%s with %s", ptp.MessageFollowUp, c.description),
+			Packet:      b,
+		})
+	}
+	for _, offset := range []int16{math.MinInt16, -1, math.MaxInt16} {
+		a := announce()
+		a.CurrentUTCOffset = offset
+		b, err := marshal(a, &a.Header)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, Vector{
+			Name:        fmt.Sprintf("announce-utc-offset-%d", offset),
+			Description: fmt.Sprintf("%s with currentUtcOffset of %ds", ptp.MessageAnnounce, offset),
+			Packet:      b,
+		})
+	}
+	return res, nil
+}
+
+// reservedFlags are flagField bits which are reserved in IEEE 1588-2019 Table 37
+var reservedFlags = []uint16{1 << (8 + 3), 1 << (8 + 4), 1 << (8 + 7), 1 << 7}
+
+// reservedBitsVectors returns Sync and Announce with reserved and unused bits set in every combination.
+// Parsers must ignore these bits, and pass them through unchanged.
+func reservedBitsVectors() ([]Vector, error) {
+	var res []Vector
+	add := func(name, description string, mutate func(h *ptp.Header, a *ptp.AnnounceBody)) error {
+		sync := &ptp.SyncDelayReq{Header: header(ptp.MessageSync)}
+		sync.OriginTimestamp = ptp.NewTimestamp(time.Unix(1700000000, 0))
+		mutate(&sync.Header, nil)
+		b, err := marshal(sync, &sync.Header)
+		if err != nil {
+			return err
+		}
+		res = append(res, Vector{Name: "sync-" + name, Description: fmt.Sprintf("%s with %s", ptp.MessageSync, description), Packet: b})
+
+		a := announce()
+		mutate(&a.Header, &a.AnnounceBody)
+		b, err = marshal(a, &a.Header)
+		if err != nil {
+			return err
+		}
+		res = append(res, Vector{Name: "announce-" + name, Description: fmt.Sprintf("%s with %s", ptp.MessageAnnounce, description), Packet: b})
+		return nil
+	}
+
+	// every combination of reserved flags
+	for mask := 1; mask < 1<<len(reservedFlags); mask++ {
+		var flags uint16
+		for i, f := range reservedFlags {
+			if mask&(1<<i) != 0 {
+				flags |= f
+			}
+		}
+		err := add(fmt.Sprintf("reserved-flags-%04x", flags), fmt.Sprintf("reserved flags %#04x set", flags), func(h *ptp.Header, _ *ptp.AnnounceBody) {
+			h.FlagField |= flags
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// every value of majorSdoId and minorVersionPTP nibbles
+	for v := uint8(1); v < 16; v++ {
+		v := v
+		err := add(fmt.Sprintf("major-sdoid-%x", v), fmt.Sprintf("majorSdoId %#x", v), func(h *ptp.Header, _ *ptp.AnnounceBody) {
+			h.SdoIDAndMsgType = ptp.NewSdoIDAndMsgType(h.MessageType(), v)
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = add(fmt.Sprintf("minor-version-%x", v), fmt.Sprintf("minorVersionPTP %#x", v), func(h *ptp.Header, _ *ptp.AnnounceBody) {
+			h.Version = v<<4 | ptp.MajorVersion
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// every byte of messageTypeSpecific, and all of them at once
+	for i := 0; i < 4; i++ {
+		v := uint32(0xff) << (8 * i)
+		err := add(fmt.Sprintf("message-type-specific-%08x", v), fmt.Sprintf("messageTypeSpecific %#08x", v), func(h *ptp.Header, _ *ptp.AnnounceBody) {
+			h.MessageTypeSpecific = v
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := add("message-type-specific-ffffffff", "messageTypeSpecific with all bits set", func(h *ptp.Header, _ *ptp.AnnounceBody) {
+		h.MessageTypeSpecific = math.MaxUint32
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = add("minor-sdoid-ff", "minorSdoId with all bits set", func(h *ptp.Header, _ *ptp.AnnounceBody) {
+		h.MinorSdoID = 0xff
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = add("control-field-ff", "obsolete controlField with all bits set", func(h *ptp.Header, _ *ptp.AnnounceBody) {
+		h.ControlField = 0xff
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = add("all-reserved-set", "every reserved bit set", func(h *ptp.Header, a *ptp.AnnounceBody) {
+		h.SdoIDAndMsgType = ptp.NewSdoIDAndMsgType(h.MessageType(), 0xf)
+		h.Version = 0xf0 | ptp.MajorVersion
+		h.MinorSdoID = 0xff
+		for _, f := range reservedFlags {
+			h.FlagField |= f
+		}
+		h.MessageTypeSpecific = math.MaxUint32
+		h.ControlField = 0xff
+		if a != nil {
+			a.Reserved = 0xff
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Announce has a reserved byte of its own
+	a := announce()
+	a.Reserved = 0xff
+	b, err := marshal(a, &a.Header)
+	if err != nil {
+		return nil, err
+	}
+	res = append(res, Vector{Name: "announce-reserved-ff", Description: fmt.Sprintf("%s with reserved byte set", ptp.MessageAnnounce), Packet: b})
+	return res, nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// correctionTooBig is the value of the correctionField which can't be represented
+const correctionTooBig = Correction(math.MaxInt64)
+
+// maxCorrectionDuration is the largest duration which fits into correctionField
+const maxCorrectionDuration = time.Duration(math.MaxInt64 / twoPow16)
+
+// NewCorrectionFromDuration returns Correction built from time.Duration.
+// Durations that don't fit are reported as too big, as the standard requires
+func NewCorrectionFromDuration(d time.Duration) Correction {
+	if d > maxCorrectionDuration || d < -maxCorrectionDuration {
+		return correctionTooBig
+	}
+	return Correction(d * twoPow16)
+}
+
+// Duration converts Correction to time.Duration, dropping sub-nanosecond part.
+// Correction that is too big can't be applied, so it is converted to 0
+func (t Correction) Duration() time.Duration {
+	if t.TooBig() {
+		return 0
+	}
+	return time.Duration(t / twoPow16)
+}
+
+// Sum returns t+c, saturating to too big on overflow. Too big stays too big
+func (t Correction) Sum(c Correction) Correction {
+	if t.TooBig() || c.TooBig() {
+		return correctionTooBig
+	}
+	s, ok := addInt64(int64(t), int64(c))
+	// the most negative value isn't allowed either, as its negation overflows
+	if !ok || s == math.MinInt64 {
+		return correctionTooBig
+	}
+	return Correction(s)
+}
+
+// Add returns Correction increased by d, see Sum
+func (t Correction) Add(d time.Duration) Correction {
+	return t.Sum(NewCorrectionFromDuration(d))
+}
+
+// Sub returns Correction decreased by d, see Sum
+func (t Correction) Sub(d time.Duration) Correction {
+	return t.Sum(NewCorrectionFromDuration(-d))
+}
+
+// TransparentClockHop describes how a transparent clock delayed an event message
+type TransparentClockHop struct {
+	Ingress time.Time // when the event message was received by transparent clock
+	Egress  time.Time // when the event message left transparent clock
+	// LinkDelay is the mean delay of the link the message arrived on, only added by peer-to-peer transparent clocks
+	LinkDelay time.Duration
+	// Asymmetry is the delay asymmetry of the link the message arrived on, added to messages from master and subtracted from messages to master
+	Asymmetry time.Duration
+}
+
+// Residence returns residence time of the event message in the transparent clock
+func (h *TransparentClockHop) Residence() time.Duration {
+	return h.Egress.Sub(h.Ingress)
+}
+
+// AccumulateCorrection returns correction c after transparent clocks on the way added residence times to it.
+// toMaster tells that the message goes to master, like Delay_Req, so asymmetry is subtracted rather than added
+func AccumulateCorrection(c Correction, toMaster bool, hops ...TransparentClockHop) Correction {
+	for _, h := range hops {
+		c = c.Add(h.Residence()).Add(h.LinkDelay)
+		if toMaster {
+			c = c.Sub(h.Asymmetry)
+		} else {
+			c = c.Add(h.Asymmetry)
+		}
+	}
+	return c
+}
+
+// AccumulateTransparentClock adds residence time of the event message in transparent clocks where it belongs.
+// When followUp is given, which is Follow_Up for Sync and Delay_Resp for Delay_Req, corrections go there:
+// that's what two-step transparent clocks do, and what any transparent clock does with two-step Sync.
+// Otherwise correctionField of the event message itself is updated, like one-step transparent clocks do.
+func AccumulateTransparentClock(event, followUp *Header, toMaster bool, hops ...TransparentClockHop) error {
+	if followUp != nil {
+		if followUp.SequenceID != event.SequenceID {
+			return fmt.Errorf("sequence ID mismatch: event message %d, follow up %d", event.SequenceID, followUp.SequenceID)
+		}
+		followUp.CorrectionField = AccumulateCorrection(followUp.CorrectionField, toMaster, hops...)
+		return nil
+	}
+	if event.FlagField&FlagTwoStep != 0 {
+		return fmt.Errorf("two-step event message %d needs follow up to accumulate correction", event.SequenceID)
+	}
+	event.CorrectionField = AccumulateCorrection(event.CorrectionField, toMaster, hops...)
+	return nil
+}
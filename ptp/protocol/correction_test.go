@@ -0,0 +1,105 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCorrectionFromDuration(t *testing.T) {
+	require.Equal(t, NewCorrection(float64(time.Millisecond)), NewCorrectionFromDuration(time.Millisecond))
+	require.Equal(t, NewCorrection(-1500), NewCorrectionFromDuration(-1500*time.Nanosecond))
+	require.True(t, NewCorrectionFromDuration(50*time.Hour).TooBig())
+	require.True(t, NewCorrectionFromDuration(-50*time.Hour).TooBig())
+	require.False(t, NewCorrectionFromDuration(maxCorrectionDuration).TooBig())
+	require.True(t, NewCorrection(-1e19*twoPow16).TooBig())
+}
+
+func TestCorrectionDuration(t *testing.T) {
+	require.Equal(t, 2*time.Nanosecond, NewCorrection(2.5).Duration())
+	require.Equal(t, -2*time.Nanosecond, NewCorrection(-2.5).Duration())
+	require.Equal(t, time.Millisecond, NewCorrectionFromDuration(time.Millisecond).Duration())
+	require.Equal(t, time.Duration(0), correctionTooBig.Duration())
+}
+
+func TestCorrectionArithmetic(t *testing.T) {
+	c := NewCorrection(2.5)
+	require.Equal(t, NewCorrection(102.5), c.Add(100*time.Nanosecond))
+	require.Equal(t, NewCorrection(-97.5), c.Sub(100*time.Nanosecond))
+	require.Equal(t, NewCorrection(5), c.Sum(c))
+
+	// saturation
+	require.True(t, Correction(math.MaxInt64-1).Sum(2).TooBig())
+	require.True(t, Correction(math.MinInt64+1).Sum(-2).TooBig())
+	require.True(t, Correction(math.MinInt64+1).Sum(-1).TooBig())
+	require.True(t, c.Add(50*time.Hour).TooBig())
+	require.True(t, c.Sub(50*time.Hour).TooBig())
+	require.Equal(t, Correction(math.MaxInt64-1), Correction(math.MaxInt64-2).Sum(1))
+
+	// too big is sticky
+	require.True(t, correctionTooBig.Sub(time.Second).TooBig())
+	require.True(t, c.Sum(correctionTooBig).TooBig())
+}
+
+func TestAccumulateCorrection(t *testing.T) {
+	now := time.Now()
+	hops := []TransparentClockHop{
+		{Ingress: now, Egress: now.Add(10 * time.Microsecond)},
+		{Ingress: now, Egress: now.Add(5 * time.Microsecond), LinkDelay: 100 * time.Nanosecond, Asymmetry: 20 * time.Nanosecond},
+	}
+	require.Equal(t, 10*time.Microsecond, hops[0].Residence())
+
+	c := NewCorrection(2.5)
+	require.Equal(t, c, AccumulateCorrection(c, false))
+	require.Equal(t, NewCorrection(2.5+15120), AccumulateCorrection(c, false, hops...))
+	require.Equal(t, NewCorrection(2.5+15080), AccumulateCorrection(c, true, hops...))
+}
+
+func TestAccumulateTransparentClock(t *testing.T) {
+	now := time.Now()
+	hop := TransparentClockHop{Ingress: now, Egress: now.Add(time.Microsecond)}
+
+	// one-step
+	sync := &Header{SequenceID: 42, CorrectionField: NewCorrection(10)}
+	require.NoError(t, AccumulateTransparentClock(sync, nil, false, hop))
+	require.Equal(t, NewCorrection(1010), sync.CorrectionField)
+
+	// two-step Sync needs Follow_Up
+	sync = &Header{SequenceID: 42, FlagField: FlagTwoStep, CorrectionField: NewCorrection(10)}
+	require.Error(t, AccumulateTransparentClock(sync, nil, false, hop))
+	followUp := &Header{SequenceID: 42}
+	require.NoError(t, AccumulateTransparentClock(sync, followUp, false, hop))
+	require.Equal(t, NewCorrection(10), sync.CorrectionField)
+	require.Equal(t, NewCorrection(1000), followUp.CorrectionField)
+
+	// two-step transparent clock puts Delay_Req residence into Delay_Resp
+	delayReq := &Header{SequenceID: 7}
+	delayResp := &Header{SequenceID: 7}
+	require.NoError(t, AccumulateTransparentClock(delayReq, delayResp, true, hop))
+	require.Equal(t, Correction(0), delayReq.CorrectionField)
+	require.Equal(t, NewCorrection(1000), delayResp.CorrectionField)
+
+	// messages must match
+	delayResp = &Header{SequenceID: 8}
+	err := AccumulateTransparentClock(delayReq, delayResp, true, hop)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "sequence ID mismatch")
+}
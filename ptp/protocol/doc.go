@@ -20,7 +20,7 @@ Package protocol implements a subset of the PTPv2.1 protocol (IEEE 1588-2019).
 Implementation is focused on unicast communications over IPv6 and is sufficient to build unicast PTP server or client.
 
 This package also contains basic management client that can be used to exchange Management Packets
-with ptp server.
+with ptp server over unix socket or UDP.
 
 All references throughout the code relate to the IEEE 1588-2019 Standard.
 
@@ -39,6 +39,18 @@ Marshalling and unmarshalling of defined PTP messages
 	Signaling
 	Management
 
+Hot message types (Sync, Delay_Req, Follow_Up, Delay_Resp and Announce) are marshalled into caller provided buffer with BytesTo,
+and decoded in place either with UnmarshalBinary of reused packet or with Decoder, without allocations.
+
+All decoders are safe to use with untrusted packets: malformed or truncated data results in an error, never in a panic or a read past the packet.
+Fixed size headers and bodies are checked for length once and then read directly, variable length TLVs are read through a bounds-checked reader.
+Decoders are covered by fuzz targets with seed corpus in testdata/fuzz, run them with
+
+	go test -run XXX -fuzz FuzzDecodePacket ./ptp/protocol
+
+Edge-case packets for testing third-party devices and parsers (TLV chains of max length, boundary timestamps,
+reserved bits permutations) are generated by the conformance sub-package, also available as 'ptpcheck genpkt'.
+
 TLVs
 
 	MANAGEMENT
@@ -49,12 +61,44 @@ TLVs
 	ACKNOWLEDGE_CANCEL_UNICAST_TRANSMISSION
 	PATH_TRACE
 	ALTERNATE_TIME_OFFSET_INDICATOR
+	ORGANIZATION_EXTENSION, ORGANIZATION_EXTENSION_PROPAGATE, ORGANIZATION_EXTENSION_DO_NOT_PROPAGATE
+	PAD
+	AUTHENTICATION
+
+Decoders for organization extension TLVs of particular organizations can be plugged in with RegisterTLVDecoder.
+Other TLVs are decoded as UnknownTLV, keeping their value as is, so packets are encoded back without losing them.
+PATH_TRACE of Announces is maintained with AppendPathTrace, and Announces which went through a timing loop are dropped with DropPathTraceLoops.
 
 Management TLVs
 
+	NULL_PTP_MANAGEMENT
+	CLOCK_DESCRIPTION
+	USER_DESCRIPTION
+	SAVE_IN_NON_VOLATILE_STORAGE
+	RESET_NON_VOLATILE_STORAGE
+	FAULT_LOG_RESET
 	DEFAULT_DATA_SET
 	CURRENT_DATA_SET
 	PARENT_DATA_SET
+	TIME_PROPERTIES_DATA_SET
+	PORT_DATA_SET
+	PRIORITY1
+	PRIORITY2
+	DOMAIN
+	SLAVE_ONLY
+	LOG_ANNOUNCE_INTERVAL
+	ANNOUNCE_RECEIPT_TIMEOUT
+	LOG_SYNC_INTERVAL
+	VERSION_NUMBER
+	ENABLE_PORT
+	DISABLE_PORT
+	TIME
+	CLOCK_ACCURACY
+	UTC_PROPERTIES
+	TRACEABILITY_PROPERTIES
+	TIMESCALE_PROPERTIES
+	DELAY_MECHANISM
+	LOG_MIN_PDELAY_REQ_INTERVAL
 
 Non-portable ptp4l-specific Management TLVs
 
@@ -63,5 +107,11 @@ Non-portable ptp4l-specific Management TLVs
 	PORT_STATS_NP
 	PORT_SERVICE_STATS_NP
 	UNICAST_MASTER_TABLE_NP
+
+Helpers to carry PTP messages over tunnels
+
+	GRE (RFC 2784, RFC 2890)
+	GRE-in-UDP (RFC 8086)
+	PPP (RFC 1661)
 */
 package protocol
@@ -0,0 +1,253 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// dumpNode is a decoded field prepared for rendering.
+// It is either a scalar value, or a list of fields (struct), or a list of items (slice)
+type dumpNode struct {
+	name   string
+	value  interface{}
+	fields []dumpNode
+	items  []dumpNode
+	list   bool
+	// tlv is a TLV type of the node
+	tlv string
+}
+
+var (
+	stringerType   = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	headerType     = reflect.TypeOf(Header{})
+	correctionType = reflect.TypeOf(Correction(0))
+	intervalType   = reflect.TypeOf(TimeInterval(0))
+	timestampType  = reflect.TypeOf(Timestamp{})
+	secondsType    = reflect.TypeOf(PTPSeconds{})
+	sdoIDType      = reflect.TypeOf(SdoIDAndMsgType(0))
+)
+
+// dumpTime formats time in RFC3339 with nanoseconds, empty if time is not set
+func dumpTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// dumpValue turns any value of a decoded packet into dumpNode
+func dumpValue(name string, v reflect.Value) dumpNode {
+	n := dumpNode{name: name}
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return n
+		}
+		// name TLVs after their type
+		if tlv, ok := v.Interface().(TLV); ok && n.tlv == "" {
+			n.tlv = tlv.Type().String()
+			if n.name == "" {
+				n.name = n.tlv
+			}
+		}
+		v = v.Elem()
+	}
+
+	switch v.Type() {
+	case headerType:
+		n.fields = dumpFields(v)
+		// major and minor versions share the field
+		h := v.Interface().(Header)
+		for i := range n.fields {
+			if n.fields[i].name == "Version" {
+				n.fields[i].value = fmt.Sprintf("%d.%d", h.MajorVersionPTP(), h.MinorVersionPTP())
+			}
+		}
+		return n
+	case correctionType:
+		c := Correction(v.Int())
+		if c.TooBig() {
+			n.value = "too big"
+		} else {
+			n.value = c.Nanoseconds()
+		}
+		return n
+	case intervalType:
+		n.value = TimeInterval(v.Int()).Nanoseconds()
+		return n
+	case timestampType:
+		n.value = dumpTime(v.Interface().(Timestamp).Time())
+		return n
+	case secondsType:
+		n.value = dumpTime(v.Interface().(PTPSeconds).Time())
+		return n
+	case sdoIDType:
+		n.value = SdoIDAndMsgType(v.Uint()).MsgType().String()
+		return n
+	}
+
+	// structs like PortIdentity are easier to read as one line
+	if v.Type().Implements(stringerType) {
+		n.value = v.Interface().(fmt.Stringer).String()
+		return n
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		n.fields = dumpFields(v)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			n.value = hex.EncodeToString(b)
+			return n
+		}
+		n.list = true
+		for i := 0; i < v.Len(); i++ {
+			n.items = append(n.items, dumpValue("", v.Index(i)))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n.value = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n.value = v.Uint()
+	case reflect.Float32, reflect.Float64:
+		n.value = v.Float()
+	case reflect.Bool:
+		n.value = v.Bool()
+	case reflect.String:
+		n.value = v.String()
+	default:
+		n.value = fmt.Sprintf("%v", v.Interface())
+	}
+	return n
+}
+
+// dumpFields dumps exported struct fields. Embedded structs are flattened, except for Header which gets its own section
+func dumpFields(v reflect.Value) []dumpNode {
+	fields := []dumpNode{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Type != headerType && !f.Type.Implements(stringerType) {
+			fields = append(fields, dumpFields(fv)...)
+			continue
+		}
+		fields = append(fields, dumpValue(f.Name, fv))
+	}
+	return fields
+}
+
+// scalar formats scalar value for human consumption
+func (n dumpNode) scalar() string {
+	switch v := n.value.(type) {
+	case nil:
+		return "<nil>"
+	case float64:
+		return fmt.Sprintf("%.3f ns", v)
+	case string:
+		if v == "" {
+			return "<empty>"
+		}
+		return v
+	}
+	if n.name == "FlagField" {
+		return fmt.Sprintf("0x%04x", n.value)
+	}
+	return fmt.Sprintf("%v", n.value)
+}
+
+func (n dumpNode) write(b *strings.Builder, indent string) {
+	name := n.name
+	if name == "" {
+		name = "-"
+	}
+	switch {
+	case n.fields != nil:
+		fmt.Fprintf(b, "%s%s:\n", indent, name)
+		for _, f := range n.fields {
+			f.write(b, indent+"  ")
+		}
+	case n.list:
+		fmt.Fprintf(b, "%s%s: [%d]\n", indent, name, len(n.items))
+		for _, item := range n.items {
+			item.write(b, indent+"  ")
+		}
+	default:
+		fmt.Fprintf(b, "%s%s: %s\n", indent, name, n.scalar())
+	}
+}
+
+// MarshalJSON renders node keeping the field order of the packet
+func (n dumpNode) MarshalJSON() ([]byte, error) {
+	switch {
+	case n.fields != nil:
+		var b bytes.Buffer
+		b.WriteByte('{')
+		if n.tlv != "" {
+			k, _ := json.Marshal(n.tlv)
+			b.WriteString(`"TLV":`)
+			b.Write(k)
+		}
+		for i, f := range n.fields {
+			if i > 0 || n.tlv != "" {
+				b.WriteByte(',')
+			}
+			k, _ := json.Marshal(f.name)
+			b.Write(k)
+			b.WriteByte(':')
+			v, err := f.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			b.Write(v)
+		}
+		b.WriteByte('}')
+		return b.Bytes(), nil
+	case n.list:
+		if n.items == nil {
+			return []byte("[]"), nil
+		}
+		return json.Marshal(n.items)
+	default:
+		return json.Marshal(n.value)
+	}
+}
+
+// Dump renders decoded packet in a readable multi-line format:
+// correction fields are in nanoseconds, timestamps in RFC3339 and TLVs are listed with their fields
+func Dump(p Packet) string {
+	var b strings.Builder
+	n := dumpValue(p.MessageType().String(), reflect.ValueOf(p))
+	n.write(&b, "")
+	return b.String()
+}
+
+// DumpJSON renders decoded packet as JSON, with the same field formatting as Dump
+func DumpJSON(p Packet) ([]byte, error) {
+	n := dumpValue("", reflect.ValueOf(p))
+	return n.MarshalJSON()
+}
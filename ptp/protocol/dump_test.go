@@ -0,0 +1,112 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func dumpTestFollowUp() *FollowUp {
+	return &FollowUp{
+		Header: Header{
+			SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageFollowUp, 0),
+			Version:            Version,
+			MessageLength:      44,
+			FlagField:          FlagUnicast,
+			CorrectionField:    NewCorrection(2.5),
+			SourcePortIdentity: PortIdentity{ClockIdentity: 0x001122fffe334455, PortNumber: 1},
+			SequenceID:         42,
+			ControlField:       2,
+			LogMessageInterval: -3,
+		},
+		FollowUpBody: FollowUpBody{
+			PreciseOriginTimestamp: NewTimestamp(time.Unix(1653574589, 806070046)),
+		},
+	}
+}
+
+func TestDump(t *testing.T) {
+	want := `FOLLOW_UP:
+  Header:
+    SdoIDAndMsgType: FOLLOW_UP
+    Version: 2.1
+    MessageLength: 44
+    DomainNumber: 0
+    MinorSdoID: 0
+    FlagField: 0x0400
+    CorrectionField: 2.500 ns
+    MessageTypeSpecific: 0
+    SourcePortIdentity: 001122.fffe.334455-1
+    SequenceID: 42
+    ControlField: 2
+    LogMessageInterval: -3
+  PreciseOriginTimestamp: 2022-05-26T14:16:29.806070046Z
+`
+	require.Equal(t, want, Dump(dumpTestFollowUp()))
+}
+
+func TestDumpTLVs(t *testing.T) {
+	p := &Signaling{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageSignaling, 0),
+		},
+		TLVs: []TLV{
+			&RequestUnicastTransmissionTLV{
+				TLVHead:               TLVHead{TLVType: TLVRequestUnicastTransmission, LengthField: 6},
+				MsgTypeAndReserved:    NewUnicastMsgTypeAndFlags(MessageSync, 0),
+				LogInterMessagePeriod: 1,
+				DurationField:         60,
+			},
+		},
+	}
+	out := Dump(p)
+	require.Contains(t, out, "  TLVs: [1]\n    REQUEST_UNICAST_TRANSMISSION:\n      TLVType: REQUEST_UNICAST_TRANSMISSION\n      LengthField: 6\n")
+	require.Contains(t, out, "      DurationField: 60\n")
+
+	b, err := DumpJSON(p)
+	require.NoError(t, err)
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &got))
+	tlvs := got["TLVs"].([]interface{})
+	require.Len(t, tlvs, 1)
+	tlv := tlvs[0].(map[string]interface{})
+	require.Equal(t, "REQUEST_UNICAST_TRANSMISSION", tlv["TLV"])
+	require.Equal(t, float64(60), tlv["DurationField"])
+}
+
+func TestDumpJSON(t *testing.T) {
+	b, err := DumpJSON(dumpTestFollowUp())
+	require.NoError(t, err)
+	want := `{"Header":{"SdoIDAndMsgType":"FOLLOW_UP","Version":"2.1","MessageLength":44,"DomainNumber":0,"MinorSdoID":0,"FlagField":1024,"CorrectionField":2.5,"MessageTypeSpecific":0,"SourcePortIdentity":"001122.fffe.334455-1","SequenceID":42,"ControlField":2,"LogMessageInterval":-3},"PreciseOriginTimestamp":"2022-05-26T14:16:29.806070046Z"}`
+	require.Equal(t, want, string(b))
+}
+
+func TestDumpDecoded(t *testing.T) {
+	raw, err := Bytes(dumpTestFollowUp())
+	require.NoError(t, err)
+	p, err := DecodePacket(raw)
+	require.NoError(t, err)
+	require.Equal(t, Dump(dumpTestFollowUp()), Dump(p))
+
+	p = &Announce{AnnounceBody: AnnounceBody{GrandmasterClockQuality: ClockQuality{ClockClass: ClockClass6}}}
+	require.Contains(t, Dump(p), "  GrandmasterClockQuality:\n    ClockClass: 6\n")
+	require.Contains(t, Dump(p), "  OriginTimestamp: <empty>\n")
+}
@@ -0,0 +1,165 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Foreign master qualification parameters as defined in IEEE 1588-2019, 9.3.2.4.4 and 9.3.2.5
+const (
+	// ForeignMasterThreshold is how many Announce messages from a foreign master we need within ForeignMasterTimeWindow to qualify it
+	ForeignMasterThreshold = 2
+	// ForeignMasterTimeWindow is the qualification window, in announce intervals
+	ForeignMasterTimeWindow = 4
+)
+
+// defaultAnnounceInterval is used when Announce doesn't carry meaningful logMessageInterval
+const defaultAnnounceInterval = time.Second
+
+// foreignMaster is a record of foreign master dataset
+type foreignMaster struct {
+	announce *Announce
+	interval time.Duration
+	// receive times of announces within qualification window, oldest first
+	received []time.Time
+}
+
+func (f *foreignMaster) window() time.Duration {
+	return ForeignMasterTimeWindow * f.interval
+}
+
+// prune drops announces which fell out of qualification window
+func (f *foreignMaster) prune(now time.Time) {
+	cutoff := now.Add(-f.window())
+	i := 0
+	for i < len(f.received) && !f.received[i].After(cutoff) {
+		i++
+	}
+	f.received = f.received[i:]
+}
+
+func (f *foreignMaster) qualified(now time.Time) bool {
+	f.prune(now)
+	return len(f.received) >= ForeignMasterThreshold
+}
+
+// ForeignMasterDS tracks Announce messages per foreign master (identified by sourcePortIdentity),
+// so only qualified foreign masters are passed to BMCA instead of acting on any single Announce.
+// It is safe for concurrent use.
+type ForeignMasterDS struct {
+	// Interval, if set, overrides announce interval of all foreign masters.
+	// Useful when Announces are requested by us (unicast or SPTP) rather than sent on master's own schedule.
+	Interval time.Duration
+
+	mu      sync.Mutex
+	records map[PortIdentity]*foreignMaster
+}
+
+// NewForeignMasterDS returns empty foreign master dataset. Zero interval means interval is taken from each Announce.
+func NewForeignMasterDS(interval time.Duration) *ForeignMasterDS {
+	return &ForeignMasterDS{
+		Interval: interval,
+		records:  map[PortIdentity]*foreignMaster{},
+	}
+}
+
+func (ds *ForeignMasterDS) announceInterval(a *Announce) time.Duration {
+	if ds.Interval > 0 {
+		return ds.Interval
+	}
+	// 0x7F means interval is not specified
+	if a.LogMessageInterval == 0x7f {
+		return defaultAnnounceInterval
+	}
+	return a.LogMessageInterval.Duration()
+}
+
+// Add records Announce received at given time.
+// Announces with stepsRemoved of 255 or more, and repeated announces with the same sequenceId are not counted.
+func (ds *ForeignMasterDS) Add(a *Announce, received time.Time) {
+	if a.StepsRemoved >= 255 {
+		return
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	source := a.SourcePortIdentity
+	f, found := ds.records[source]
+	if !found {
+		f = &foreignMaster{}
+		ds.records[source] = f
+	} else if f.announce.SequenceID == a.SequenceID && len(f.received) > 0 {
+		return
+	}
+	f.announce = a
+	f.interval = ds.announceInterval(a)
+	f.received = append(f.received, received)
+	f.prune(received)
+}
+
+// IsQualified returns whether foreign master with given source port identity is qualified at the moment
+func (ds *ForeignMasterDS) IsQualified(source PortIdentity, now time.Time) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	f, found := ds.records[source]
+	if !found {
+		return false
+	}
+	return f.qualified(now)
+}
+
+// Qualified returns latest Announce of every qualified foreign master, sorted by source port identity.
+// Records without any announces within qualification window are expired.
+func (ds *ForeignMasterDS) Qualified(now time.Time) []*Announce {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	res := []*Announce{}
+	for source, f := range ds.records {
+		if f.qualified(now) {
+			res = append(res, f.announce)
+			continue
+		}
+		if len(f.received) == 0 {
+			delete(ds.records, source)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].SourcePortIdentity.Less(res[j].SourcePortIdentity)
+	})
+	return res
+}
+
+// Expire removes foreign masters we haven't heard from within qualification window
+func (ds *ForeignMasterDS) Expire(now time.Time) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for source, f := range ds.records {
+		f.prune(now)
+		if len(f.received) == 0 {
+			delete(ds.records, source)
+		}
+	}
+}
+
+// Len returns number of tracked foreign masters, qualified or not
+func (ds *ForeignMasterDS) Len() int {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return len(ds.records)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testForeignAnnounce(clockID ClockIdentity, seq uint16, logInterval LogInterval) *Announce {
+	return &Announce{
+		Header: Header{
+			SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageAnnounce, 0),
+			SequenceID:         seq,
+			LogMessageInterval: logInterval,
+			SourcePortIdentity: PortIdentity{ClockIdentity: clockID, PortNumber: 1},
+		},
+		AnnounceBody: AnnounceBody{
+			GrandmasterIdentity: clockID,
+		},
+	}
+}
+
+func TestForeignMasterDSQualification(t *testing.T) {
+	ds := NewForeignMasterDS(0)
+	now := time.Now()
+	source := PortIdentity{ClockIdentity: 1, PortNumber: 1}
+
+	ds.Add(testForeignAnnounce(1, 1, 0), now)
+	require.Equal(t, 1, ds.Len())
+	require.False(t, ds.IsQualified(source, now))
+	require.Empty(t, ds.Qualified(now))
+
+	// same sequence doesn't count
+	ds.Add(testForeignAnnounce(1, 1, 0), now.Add(time.Second))
+	require.False(t, ds.IsQualified(source, now.Add(time.Second)))
+
+	ds.Add(testForeignAnnounce(1, 2, 0), now.Add(time.Second))
+	require.True(t, ds.IsQualified(source, now.Add(time.Second)))
+	q := ds.Qualified(now.Add(time.Second))
+	require.Len(t, q, 1)
+	require.Equal(t, uint16(2), q[0].SequenceID)
+
+	// first announce falls out of 4s window
+	require.False(t, ds.IsQualified(source, now.Add(4*time.Second)))
+	require.Empty(t, ds.Qualified(now.Add(4*time.Second)))
+	require.Equal(t, 1, ds.Len())
+
+	// nothing within the window, record expires
+	ds.Expire(now.Add(5 * time.Second))
+	require.Equal(t, 0, ds.Len())
+	require.False(t, ds.IsQualified(source, now.Add(5*time.Second)))
+}
+
+func TestForeignMasterDSInterval(t *testing.T) {
+	now := time.Now()
+	source := PortIdentity{ClockIdentity: 1, PortNumber: 1}
+
+	// interval from announce, 2^2 = 4s, so window is 16s
+	ds := NewForeignMasterDS(0)
+	ds.Add(testForeignAnnounce(1, 1, 2), now)
+	ds.Add(testForeignAnnounce(1, 2, 2), now.Add(10*time.Second))
+	require.True(t, ds.IsQualified(source, now.Add(10*time.Second)))
+	require.False(t, ds.IsQualified(source, now.Add(16*time.Second)))
+
+	// unspecified interval means 1s
+	ds = NewForeignMasterDS(0)
+	ds.Add(testForeignAnnounce(1, 1, 0x7f), now)
+	ds.Add(testForeignAnnounce(1, 2, 0x7f), now.Add(3*time.Second))
+	require.True(t, ds.IsQualified(source, now.Add(3*time.Second)))
+	require.False(t, ds.IsQualified(source, now.Add(4*time.Second)))
+
+	// override wins over announce
+	ds = NewForeignMasterDS(10 * time.Second)
+	ds.Add(testForeignAnnounce(1, 1, 0), now)
+	ds.Add(testForeignAnnounce(1, 2, 0), now.Add(30*time.Second))
+	require.True(t, ds.IsQualified(source, now.Add(39*time.Second)))
+	require.False(t, ds.IsQualified(source, now.Add(40*time.Second)))
+}
+
+func TestForeignMasterDSStepsRemoved(t *testing.T) {
+	ds := NewForeignMasterDS(0)
+	now := time.Now()
+	a := testForeignAnnounce(1, 1, 0)
+	a.StepsRemoved = 255
+	ds.Add(a, now)
+	require.Equal(t, 0, ds.Len())
+}
+
+func TestForeignMasterDSQualifiedSorted(t *testing.T) {
+	ds := NewForeignMasterDS(time.Second)
+	now := time.Now()
+	for _, id := range []ClockIdentity{3, 1, 2} {
+		ds.Add(testForeignAnnounce(id, 1, 0), now)
+		ds.Add(testForeignAnnounce(id, 2, 0), now.Add(time.Second))
+	}
+	// only one announce from 4, not qualified
+	ds.Add(testForeignAnnounce(4, 1, 0), now)
+	q := ds.Qualified(now.Add(time.Second))
+	require.Len(t, q, 3)
+	for i, id := range []ClockIdentity{1, 2, 3} {
+		require.Equal(t, id, q[i].GrandmasterIdentity)
+	}
+	require.Equal(t, 4, ds.Len())
+}
@@ -0,0 +1,475 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding"
+	"encoding/binary"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fixed seed so property-based tests are reproducible
+const propertySeed = 20120
+
+var propertyConfig = &quick.Config{
+	MaxCount: 1000,
+	Rand:     rand.New(rand.NewSource(propertySeed)),
+}
+
+var fuzzHeader = Header{
+	Version:         Version,
+	DomainNumber:    0,
+	FlagField:       FlagUnicast | FlagTwoStep,
+	CorrectionField: NewCorrection(100500),
+	SourcePortIdentity: PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: 36138748164966842,
+	},
+	SequenceID:         116,
+	LogMessageInterval: 0x7f,
+}
+
+func fuzzSeed(t testing.TB, p encoding.BinaryMarshaler) []byte {
+	b, err := p.MarshalBinary()
+	require.NoError(t, err)
+	return b
+}
+
+func seedSync(t testing.TB) []byte {
+	h := fuzzHeader
+	h.SdoIDAndMsgType = NewSdoIDAndMsgType(MessageSync, 0)
+	h.MessageLength = headerSize + 10
+	return fuzzSeed(t, &SyncDelayReq{
+		Header: h,
+		SyncDelayReqBody: SyncDelayReqBody{
+			OriginTimestamp: Timestamp{
+				Seconds:     [6]byte{0x0, 0x00, 0x45, 0xb1, 0x11, 0x5a},
+				Nanoseconds: 174389936,
+			},
+		},
+	})
+}
+
+func seedFollowUp(t testing.TB) []byte {
+	h := fuzzHeader
+	h.SdoIDAndMsgType = NewSdoIDAndMsgType(MessageFollowUp, 0)
+	h.MessageLength = headerSize + 10
+	return fuzzSeed(t, &FollowUp{
+		Header: h,
+		FollowUpBody: FollowUpBody{
+			PreciseOriginTimestamp: Timestamp{
+				Seconds:     [6]byte{0x0, 0x00, 0x45, 0xb1, 0x11, 0x5e},
+				Nanoseconds: 73257582,
+			},
+		},
+	})
+}
+
+func seedDelayResp(t testing.TB) []byte {
+	h := fuzzHeader
+	h.SdoIDAndMsgType = NewSdoIDAndMsgType(MessageDelayResp, 0)
+	h.MessageLength = headerSize + 20
+	return fuzzSeed(t, &DelayResp{
+		Header: h,
+		DelayRespBody: DelayRespBody{
+			ReceiveTimestamp: Timestamp{
+				Seconds:     [6]byte{0x0, 0x00, 0x45, 0xb1, 0x11, 0x5e},
+				Nanoseconds: 73257582,
+			},
+			RequestingPortIdentity: PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: 36138748164966842,
+			},
+		},
+	})
+}
+
+func seedAnnounce(t testing.TB) []byte {
+	h := fuzzHeader
+	h.SdoIDAndMsgType = NewSdoIDAndMsgType(MessageAnnounce, 0)
+	h.MessageLength = headerSize + 30 + tlvHeadSize + 8
+	return fuzzSeed(t, &Announce{
+		Header: h,
+		AnnounceBody: AnnounceBody{
+			CurrentUTCOffset:     37,
+			GrandmasterPriority1: 128,
+			GrandmasterClockQuality: ClockQuality{
+				ClockClass:              ClockClass6,
+				ClockAccuracy:           ClockAccuracyNanosecond100,
+				OffsetScaledLogVariance: 23008,
+			},
+			GrandmasterPriority2: 128,
+			GrandmasterIdentity:  36138748164966842,
+			StepsRemoved:         1,
+			TimeSource:           TimeSourceGNSS,
+		},
+		TLVs: []TLV{
+			&PathTraceTLV{
+				TLVHead:      TLVHead{TLVType: TLVPathTrace, LengthField: 8},
+				PathSequence: []ClockIdentity{36138748164966842},
+			},
+		},
+	})
+}
+
+func seedSignaling(t testing.TB) []byte {
+	h := fuzzHeader
+	h.SdoIDAndMsgType = NewSdoIDAndMsgType(MessageSignaling, 0)
+	h.MessageLength = headerSize + 10 + tlvHeadSize + 6 + tlvHeadSize + 8
+	return fuzzSeed(t, &Signaling{
+		Header:             h,
+		TargetPortIdentity: DefaultTargetPortIdentity,
+		TLVs: []TLV{
+			&RequestUnicastTransmissionTLV{
+				TLVHead:               TLVHead{TLVType: TLVRequestUnicastTransmission, LengthField: 6},
+				MsgTypeAndReserved:    NewUnicastMsgTypeAndFlags(MessageSync, 0),
+				LogInterMessagePeriod: 1,
+				DurationField:         60,
+			},
+			&GrantUnicastTransmissionTLV{
+				TLVHead:               TLVHead{TLVType: TLVGrantUnicastTransmission, LengthField: 8},
+				MsgTypeAndReserved:    NewUnicastMsgTypeAndFlags(MessageAnnounce, 0),
+				LogInterMessagePeriod: 1,
+				DurationField:         60,
+				Renewal:               1,
+			},
+		},
+	})
+}
+
+func seedManagement(t testing.TB) []byte {
+	return fuzzSeed(t, ClockAccuracyRequest())
+}
+
+// seedDescriptions returns CLOCK_DESCRIPTION and USER_DESCRIPTION responses, which carry variable length texts
+func seedDescriptions(t testing.TB) [][]byte {
+	cd := &ClockDescriptionTLV{}
+	require.NoError(t, cd.UnmarshalBinary(clockDescriptionRaw))
+	seeds := [][]byte{}
+	for _, r := range []struct {
+		id  ManagementID
+		tlv ManagementTLV
+	}{
+		{IDClockDescription, cd},
+		{IDUserDescription, &UserDescriptionTLV{UserDescription: "gm1"}},
+	} {
+		p, err := NewManagementRequest(RESPONSE, r.id, r.tlv)
+		require.NoError(t, err)
+		seeds = append(seeds, fuzzSeed(t, p))
+	}
+	return seeds
+}
+
+func seedManagementErrorStatus(t testing.TB) []byte {
+	headerSize := uint16(binary.Size(ManagementMsgHead{}))
+	return fuzzSeed(t, &ManagementMsgErrorStatus{
+		ManagementMsgHead: ManagementMsgHead{
+			Header: Header{
+				SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageManagement, 0),
+				Version:            Version,
+				MessageLength:      headerSize + 12 + 4,
+				SourcePortIdentity: fuzzHeader.SourcePortIdentity,
+				LogMessageInterval: MgmtLogMessageInterval,
+			},
+			TargetPortIdentity: DefaultTargetPortIdentity,
+			ActionField:        RESPONSE,
+		},
+		ManagementErrorStatusTLV: ManagementErrorStatusTLV{
+			TLVHead:           TLVHead{TLVType: TLVManagementErrorStatus, LengthField: 8 + 4},
+			ManagementErrorID: ErrorNotSupported,
+			ManagementID:      IDPortStatsNP,
+			DisplayData:       "err",
+		},
+	})
+}
+
+// fuzzUnmarshal makes sure decoding arbitrary data never panics, and that any
+// successfully decoded packet can be encoded again
+func fuzzUnmarshal(f *testing.F, newPacket func() Packet, seeds ...[]byte) {
+	for _, seed := range append([][]byte{{}, {0}, make([]byte, headerSize)}, seeds...) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		p := newPacket()
+		if err := FromBytes(b, p); err != nil {
+			return
+		}
+		_, err := Bytes(p)
+		require.NoError(t, err)
+	})
+}
+
+// fuzzRoundTrip is fuzzUnmarshal for fixed-size packets, where we can also assert
+// that Marshal(Unmarshal(x)) == x
+func fuzzRoundTrip(f *testing.F, newPacket func() Packet, seeds ...[]byte) {
+	for _, seed := range append([][]byte{{}, {0}, make([]byte, headerSize)}, seeds...) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		p := newPacket()
+		if err := FromBytes(b, p); err != nil {
+			return
+		}
+		bb, err := Bytes(p)
+		require.NoError(t, err)
+		// ignore last 2 bytes as they are only for ipv6 checksums
+		l := len(bb) - 2
+		require.Equal(t, b[:l], bb[:l], "we expect binary form of packet %v %+v to be equal to original", p.MessageType(), p)
+	})
+}
+
+func FuzzSyncDelayReqUnmarshal(f *testing.F) {
+	fuzzRoundTrip(f, func() Packet { return &SyncDelayReq{} }, seedSync(f))
+}
+
+func FuzzFollowUpUnmarshal(f *testing.F) {
+	fuzzRoundTrip(f, func() Packet { return &FollowUp{} }, seedFollowUp(f))
+}
+
+func FuzzDelayRespUnmarshal(f *testing.F) {
+	fuzzRoundTrip(f, func() Packet { return &DelayResp{} }, seedDelayResp(f))
+}
+
+func FuzzAnnounceUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, func() Packet { return &Announce{} }, seedAnnounce(f))
+}
+
+func FuzzSignalingUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, func() Packet { return &Signaling{} }, seedSignaling(f))
+}
+
+func FuzzManagementUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, func() Packet { return &Management{} }, append(seedDescriptions(f), seedManagement(f))...)
+}
+
+func FuzzManagementMsgErrorStatusUnmarshal(f *testing.F) {
+	fuzzUnmarshal(f, func() Packet { return &ManagementMsgErrorStatus{} }, seedManagementErrorStatus(f))
+}
+
+func FuzzReadTLVs(f *testing.F) {
+	signaling := seedSignaling(f)
+	announce := seedAnnounce(f)
+	for _, seed := range [][]byte{{}, {0}, signaling[headerSize+10:], announce[headerSize+30:]} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		tlvs, err := readTLVs(nil, len(b), reader{b: b})
+		if err != nil {
+			return
+		}
+		buf := make([]byte, len(b)+tlvHeadSize*len(tlvs)+256)
+		_, err = writeTLVs(tlvs, buf)
+		require.NoError(t, err)
+	})
+}
+
+func FuzzPTPTextUnmarshal(f *testing.F) {
+	for _, seed := range [][]byte{{}, {0}, {1}, {3, 'P', 'T', 'P', 0}} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var text PTPText
+		if err := text.UnmarshalBinary(b); err != nil {
+			return
+		}
+		bb, err := text.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, b[:len(text)+1], bb[:len(text)+1])
+	})
+}
+
+func FuzzPortAddressUnmarshal(f *testing.F) {
+	for _, seed := range [][]byte{{}, {0}, {0, 1, 0, 4, 192, 168, 0, 1}} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		addr := &PortAddress{}
+		if err := addr.UnmarshalBinary(b); err != nil {
+			return
+		}
+		bb, err := addr.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, b[:len(bb)], bb)
+	})
+}
+
+func FuzzUnicastMasterEntryUnmarshal(f *testing.F) {
+	for _, seed := range [][]byte{{}, {0}, make([]byte, 22)} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		e := &UnicastMasterEntry{}
+		if err := e.UnmarshalBinary(b); err != nil {
+			return
+		}
+		_, err := e.MarshalBinary()
+		require.NoError(t, err)
+	})
+}
+
+// roundTrip checks Unmarshal(Marshal(p)) == p, and Marshal(Unmarshal(Marshal(p))) == Marshal(p)
+func roundTrip(t *testing.T, p Packet, newPacket func() Packet) bool {
+	b, err := Bytes(p)
+	if err != nil {
+		t.Logf("marshal %+v: %v", p, err)
+		return false
+	}
+	got := newPacket()
+	if err := FromBytes(b, got); err != nil {
+		t.Logf("unmarshal %v: %v", b, err)
+		return false
+	}
+	if !reflect.DeepEqual(p, got) {
+		t.Logf("want %+v, got %+v", p, got)
+		return false
+	}
+	bb, err := Bytes(got)
+	if err != nil {
+		t.Logf("marshal %+v: %v", got, err)
+		return false
+	}
+	return reflect.DeepEqual(b, bb)
+}
+
+func TestSyncDelayReqRoundTripProperty(t *testing.T) {
+	f := func(h Header, body SyncDelayReqBody) bool {
+		h.MessageLength = headerSize + 10
+		return roundTrip(t, &SyncDelayReq{Header: h, SyncDelayReqBody: body}, func() Packet { return &SyncDelayReq{} })
+	}
+	require.NoError(t, quick.Check(f, propertyConfig))
+}
+
+func TestFollowUpRoundTripProperty(t *testing.T) {
+	f := func(h Header, body FollowUpBody) bool {
+		h.MessageLength = headerSize + 10
+		return roundTrip(t, &FollowUp{Header: h, FollowUpBody: body}, func() Packet { return &FollowUp{} })
+	}
+	require.NoError(t, quick.Check(f, propertyConfig))
+}
+
+func TestDelayRespRoundTripProperty(t *testing.T) {
+	f := func(h Header, body DelayRespBody) bool {
+		h.MessageLength = headerSize + 20
+		return roundTrip(t, &DelayResp{Header: h, DelayRespBody: body}, func() Packet { return &DelayResp{} })
+	}
+	require.NoError(t, quick.Check(f, propertyConfig))
+}
+
+func TestAnnounceRoundTripProperty(t *testing.T) {
+	f := func(h Header, body AnnounceBody, path []ClockIdentity) bool {
+		p := &Announce{Header: h, AnnounceBody: body}
+		if len(path) > 0 {
+			if len(path) > 16 {
+				path = path[:16]
+			}
+			p.TLVs = []TLV{
+				&PathTraceTLV{
+					TLVHead:      TLVHead{TLVType: TLVPathTrace, LengthField: uint16(8 * len(path))},
+					PathSequence: path,
+				},
+			}
+		}
+		p.MessageLength = uint16(headerSize + 30 + tlvHeadSize*len(p.TLVs) + 8*len(path))
+		return roundTrip(t, p, func() Packet { return &Announce{} })
+	}
+	require.NoError(t, quick.Check(f, propertyConfig))
+}
+
+func TestSignalingRoundTripProperty(t *testing.T) {
+	f := func(h Header, target PortIdentity, req RequestUnicastTransmissionTLV, grant GrantUnicastTransmissionTLV, cancel CancelUnicastTransmissionTLV, ack AcknowledgeCancelUnicastTransmissionTLV) bool {
+		req.TLVHead = TLVHead{TLVType: TLVRequestUnicastTransmission, LengthField: 6}
+		grant.TLVHead = TLVHead{TLVType: TLVGrantUnicastTransmission, LengthField: 8}
+		cancel.TLVHead = TLVHead{TLVType: TLVCancelUnicastTransmission, LengthField: 2}
+		ack.TLVHead = TLVHead{TLVType: TLVAcknowledgeCancelUnicastTransmission, LengthField: 2}
+		h.SdoIDAndMsgType = NewSdoIDAndMsgType(MessageSignaling, uint8(h.SdoIDAndMsgType)>>4)
+		h.MessageLength = headerSize + 10 + 4*tlvHeadSize + 6 + 8 + 2 + 2
+		p := &Signaling{
+			Header:             h,
+			TargetPortIdentity: target,
+			TLVs:               []TLV{&req, &grant, &cancel, &ack},
+		}
+		return roundTrip(t, p, func() Packet { return &Signaling{} })
+	}
+	require.NoError(t, quick.Check(f, propertyConfig))
+}
+
+func TestManagementRoundTripProperty(t *testing.T) {
+	f := func(head ManagementMsgHead, tlv CurrentDataSetTLV) bool {
+		tlv.ManagementTLVHead = CurrentDataSetRequest().TLV.(*CurrentDataSetTLV).ManagementTLVHead
+		head.SdoIDAndMsgType = NewSdoIDAndMsgType(MessageManagement, 0)
+		head.MessageLength = CurrentDataSetRequest().MessageLength
+		return roundTrip(t, &Management{ManagementMsgHead: head, TLV: &tlv}, func() Packet { return &Management{} })
+	}
+	require.NoError(t, quick.Check(f, propertyConfig))
+}
+
+func TestPTPTextRoundTripProperty(t *testing.T) {
+	f := func(s string) bool {
+		if len(s) > 255 {
+			s = s[:255]
+		}
+		text := PTPText(s)
+		b, err := text.MarshalBinary()
+		if err != nil {
+			return false
+		}
+		var got PTPText
+		if err := got.UnmarshalBinary(b); err != nil {
+			return false
+		}
+		return got == text
+	}
+	require.NoError(t, quick.Check(f, propertyConfig))
+}
+
+// FuzzDecoderDecode feeds all inputs through the same Decoder, as receive paths do,
+// so state left by a previous packet can't break decoding of the next one
+func FuzzDecoderDecode(f *testing.F) {
+	for _, seed := range [][]byte{{}, make([]byte, headerSize), seedSync(f), seedFollowUp(f), seedDelayResp(f), seedAnnounce(f), seedSignaling(f), seedManagement(f)} {
+		f.Add(seed)
+	}
+	d := &Decoder{}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		p, err := d.Decode(b)
+		if err != nil {
+			return
+		}
+		_, err = Bytes(p)
+		require.NoError(t, err)
+	})
+}
+
+func FuzzGREHeaderUnmarshal(f *testing.F) {
+	for _, seed := range [][]byte{{}, {0}, {0, 0, 0x88, 0xf7}, {0xb0, 0, 0x88, 0xf7, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 2}} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		h := &GREHeader{}
+		if err := h.UnmarshalBinary(b); err != nil {
+			return
+		}
+		bb := make([]byte, h.Len())
+		n, err := h.MarshalBinaryTo(bb)
+		require.NoError(t, err)
+		require.Equal(t, h.Len(), n)
+	})
+}
@@ -0,0 +1,762 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+JSON codec for packets is meant for test fixtures: it is lossless, so a packet decoded from JSON marshals to
+exactly the bytes it was dumped from. Field names are the names of struct fields, embedded structs are flattened
+except for Header, which gets its own object. Values are formatted for humans:
+
+  - CorrectionField and TimeInterval fields are nanoseconds, with as many decimal digits as needed to be exact
+  - Timestamps are RFC3339 with nanoseconds, or an object of Seconds and Nanoseconds if they don't fit RFC3339
+  - ClockIdentity is in the same format as String, FlagField is a hex number, byte fields are hex strings
+  - message and TLV types are names
+
+TLVs which can't be built from their fields (management and organization extension TLVs)
+carry Raw hex bytes of the whole TLV, which take precedence over other fields when decoding.
+*/
+
+var (
+	clockIdentityType = reflect.TypeOf(ClockIdentity(0))
+	tlvTypeType       = reflect.TypeOf(TLVType(0))
+	tlvInterfaceType  = reflect.TypeOf((*TLV)(nil)).Elem()
+	mgmtTLVType       = reflect.TypeOf((*ManagementTLV)(nil)).Elem()
+)
+
+// latest second RFC3339 can represent, 9999-12-31T23:59:59Z
+const maxRFC3339Seconds = 253402300799
+
+// jsonField is a field of jsonObject
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+// jsonObject is a JSON object which keeps the field order of the packet
+type jsonObject []jsonField
+
+// MarshalJSON implements json.Marshaler
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(f.name)
+		b.Write(k)
+		b.WriteByte(':')
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling %s: %w", f.name, err)
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// scaledNanosJSON formats nanoseconds multiplied by 2**16 as exact decimal number
+func scaledNanosJSON(v int64) json.Number {
+	// -v overflows for math.MinInt64, but converting it to uint64 still gives the right magnitude
+	u := uint64(v)
+	if v < 0 {
+		u = uint64(-v)
+	}
+	s := strconv.FormatUint(u>>16, 10)
+	// 2**-16 is 0.0000152587890625, so fraction always fits 16 decimal digits
+	if frac := u & 0xffff; frac != 0 {
+		s += "." + strings.TrimRight(fmt.Sprintf("%016d", frac*152587890625), "0")
+	}
+	if v < 0 {
+		s = "-" + s
+	}
+	return json.Number(s)
+}
+
+// parseScaledNanosJSON is the reverse of scaledNanosJSON
+func parseScaledNanosJSON(raw json.RawMessage) (int64, error) {
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return 0, err
+	}
+	r, ok := new(big.Rat).SetString(n.String())
+	if !ok {
+		return 0, fmt.Errorf("invalid number %q", n)
+	}
+	r.Mul(r, big.NewRat(twoPow16, 1))
+	if !r.IsInt() || !r.Num().IsInt64() {
+		return 0, fmt.Errorf("%s ns can't be represented with 2**-16 ns precision", n)
+	}
+	return r.Num().Int64(), nil
+}
+
+func hexBytes(v reflect.Value) string {
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return hex.EncodeToString(b)
+}
+
+// encodeJSON turns any value of a packet into something json.Marshal renders the way this codec wants
+func encodeJSON(v reflect.Value) (interface{}, error) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Type() {
+	case correctionType, intervalType:
+		return scaledNanosJSON(v.Int()), nil
+	case timestampType:
+		t := v.Interface().(Timestamp)
+		if secs := t.Seconds.Seconds(); t.Valid() && secs <= maxRFC3339Seconds {
+			return time.Unix(int64(secs), int64(t.Nanoseconds)).UTC().Format(time.RFC3339Nano), nil
+		}
+		return encodeFields(v)
+	case secondsType:
+		return v.Interface().(PTPSeconds).Seconds(), nil
+	case sdoIDType:
+		m := SdoIDAndMsgType(v.Uint())
+		return jsonObject{
+			{name: "MessageType", value: enumJSON(m.MsgType().String(), uint64(m.MsgType()))},
+			{name: "SdoID", value: uint8(m) >> 4},
+		}, nil
+	case clockIdentityType:
+		return ClockIdentity(v.Uint()).String(), nil
+	case tlvTypeType:
+		t := TLVType(v.Uint())
+		return enumJSON(t.String(), uint64(t)), nil
+	case tlvInterfaceType, mgmtTLVType:
+		return encodeTLV(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return encodeFields(v)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return hexBytes(v), nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, err := encodeJSON(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// enumJSON uses name of enum value if it has one
+func enumJSON(name string, v uint64) interface{} {
+	if name == "" {
+		return v
+	}
+	return name
+}
+
+// encodeFields encodes exported struct fields, embedded structs are flattened except for Header
+func encodeFields(v reflect.Value) (jsonObject, error) {
+	o := jsonObject{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Type != headerType {
+			fields, err := encodeFields(fv)
+			if err != nil {
+				return nil, err
+			}
+			o = append(o, fields...)
+			continue
+		}
+		if f.Name == "FlagField" {
+			o = append(o, jsonField{name: f.Name, value: fmt.Sprintf("0x%04x", fv.Uint())})
+			continue
+		}
+		value, err := encodeJSON(fv)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		o = append(o, jsonField{name: f.Name, value: value})
+	}
+	return o, nil
+}
+
+// encodeTLV encodes TLV fields, adding Raw bytes if TLV can't be decoded from its fields
+func encodeTLV(v reflect.Value) (interface{}, error) {
+	if v.IsNil() {
+		return nil, nil
+	}
+	fields, err := encodeJSON(v.Elem())
+	if err != nil {
+		return nil, err
+	}
+	o, ok := fields.(jsonObject)
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLV %s", v.Elem().Type())
+	}
+	var raw bytes.Buffer
+	switch tlv := v.Interface().(type) {
+	case ManagementTLV:
+		if err := writeManagementTLV(&raw, tlv); err != nil {
+			return nil, err
+		}
+	case TLV:
+		if empty := newTLV(tlv.Type()); empty != nil && reflect.TypeOf(empty) == reflect.TypeOf(tlv) {
+			return o, nil
+		}
+		// TLV length is uint16, so any TLV fits
+		b := make([]byte, tlvHeadSize+1<<16)
+		n, err := writeTLVs([]TLV{tlv}, b)
+		if err != nil {
+			return nil, err
+		}
+		raw.Write(b[:n])
+	}
+	return append(o, jsonField{name: "Raw", value: hex.EncodeToString(raw.Bytes())}), nil
+}
+
+// decodeJSON is the reverse of encodeJSON, v must be settable
+func decodeJSON(raw json.RawMessage, v reflect.Value) error {
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Type() {
+	case correctionType, intervalType:
+		n, err := parseScaledNanosJSON(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+		return nil
+	case timestampType:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return decodeObject(raw, v)
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		if t.Unix() < 0 || t.Unix() > maxRFC3339Seconds {
+			return fmt.Errorf("timestamp %q is out of range", s)
+		}
+		v.Set(reflect.ValueOf(Timestamp{Seconds: newPTPSecondsFromUint(uint64(t.Unix())), Nanoseconds: uint32(t.Nanosecond())}))
+		return nil
+	case secondsType:
+		var secs uint64
+		if err := json.Unmarshal(raw, &secs); err != nil {
+			return err
+		}
+		if secs > maxPTPSeconds {
+			return fmt.Errorf("%d seconds don't fit uint48", secs)
+		}
+		v.Set(reflect.ValueOf(newPTPSecondsFromUint(secs)))
+		return nil
+	case sdoIDType:
+		var m struct {
+			MessageType json.RawMessage
+			SdoID       uint8
+		}
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return err
+		}
+		msgType, err := decodeEnum(m.MessageType, func(name string) (uint64, bool) {
+			for t, s := range MessageTypeToString {
+				if s == name {
+					return uint64(t), true
+				}
+			}
+			return 0, false
+		})
+		if err != nil {
+			return fmt.Errorf("MessageType: %w", err)
+		}
+		if msgType > 0xf || m.SdoID > 0xf {
+			return fmt.Errorf("message type %d or SdoID %d don't fit 4 bits", msgType, m.SdoID)
+		}
+		v.SetUint(uint64(NewSdoIDAndMsgType(MessageType(msgType), m.SdoID)))
+		return nil
+	case clockIdentityType:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		c, err := ParseClockIdentity(s)
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(c))
+		return nil
+	case tlvTypeType:
+		t, err := decodeEnum(raw, func(name string) (uint64, bool) {
+			for t, s := range TLVTypeToString {
+				if s == name {
+					return uint64(t), true
+				}
+			}
+			return 0, false
+		})
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(t) {
+			return fmt.Errorf("TLV type %d is out of range", t)
+		}
+		v.SetUint(t)
+		return nil
+	case tlvInterfaceType:
+		return decodeTLV(raw, v)
+	case mgmtTLVType:
+		return decodeManagementTLV(raw, v)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return decodeObject(raw, v)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return decodeHexBytes(raw, v)
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return err
+		}
+		if v.Kind() == reflect.Array {
+			if len(items) != v.Len() {
+				return fmt.Errorf("want %d items, got %d", v.Len(), len(items))
+			}
+		} else {
+			v.Set(reflect.MakeSlice(v.Type(), len(items), len(items)))
+		}
+		for i, item := range items {
+			if err := decodeJSON(item, v.Index(i)); err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return err
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("%d is out of range of %s", n, v.Type())
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return err
+		}
+		if v.OverflowUint(n) {
+			return fmt.Errorf("%d is out of range of %s", n, v.Type())
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Bool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.String:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		v.SetString(s)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// decodeEnum decodes either a name of enum value or a number
+func decodeEnum(raw json.RawMessage, lookup func(name string) (uint64, bool)) (uint64, error) {
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		var n uint64
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return 0, fmt.Errorf("want name or number, got %s", raw)
+		}
+		return n, nil
+	}
+	n, ok := lookup(name)
+	if !ok {
+		return 0, fmt.Errorf("unknown name %q", name)
+	}
+	return n, nil
+}
+
+func decodeHexBytes(raw json.RawMessage, v reflect.Value) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Array {
+		if len(b) != v.Len() {
+			return fmt.Errorf("want %d bytes, got %d", v.Len(), len(b))
+		}
+	} else {
+		v.Set(reflect.MakeSlice(v.Type(), len(b), len(b)))
+	}
+	reflect.Copy(v, reflect.ValueOf(b))
+	return nil
+}
+
+// decodeObject decodes JSON object into struct, rejecting fields the struct doesn't have
+func decodeObject(raw json.RawMessage, v reflect.Value) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return err
+	}
+	return decodeFields(obj, v)
+}
+
+func decodeFields(obj map[string]json.RawMessage, v reflect.Value) error {
+	used := map[string]bool{}
+	if err := decodeFieldsUsed(obj, v, used); err != nil {
+		return err
+	}
+	for name := range obj {
+		if !used[name] {
+			return fmt.Errorf("unknown field %q of %s", name, v.Type())
+		}
+	}
+	return nil
+}
+
+func decodeFieldsUsed(obj map[string]json.RawMessage, v reflect.Value, used map[string]bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Type != headerType {
+			if err := decodeFieldsUsed(obj, fv, used); err != nil {
+				return err
+			}
+			continue
+		}
+		raw, found := obj[f.Name]
+		if !found {
+			continue
+		}
+		used[f.Name] = true
+		if f.Name == "FlagField" {
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				n, err := strconv.ParseUint(s, 0, 16)
+				if err != nil {
+					return fmt.Errorf("%s: %w", f.Name, err)
+				}
+				fv.SetUint(n)
+				continue
+			}
+		}
+		if err := decodeJSON(raw, fv); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// rawTLV returns bytes of Raw field of TLV object, if it has one
+func rawTLV(obj map[string]json.RawMessage) ([]byte, bool, error) {
+	raw, found := obj["Raw"]
+	if !found {
+		return nil, false, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, true, fmt.Errorf("Raw: %w", err)
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, true, fmt.Errorf("Raw: %w", err)
+	}
+	return b, true, nil
+}
+
+// decodeTLV decodes TLV either from its Raw bytes or from fields of the type it names
+func decodeTLV(raw json.RawMessage, v reflect.Value) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return err
+	}
+	b, found, err := rawTLV(obj)
+	if err != nil {
+		return err
+	}
+	if found {
+		tlvs, err := readTLVs(nil, len(b), reader{b: b})
+		if err != nil {
+			return err
+		}
+		if len(tlvs) != 1 {
+			return fmt.Errorf("want 1 TLV in Raw, got %d", len(tlvs))
+		}
+		v.Set(reflect.ValueOf(tlvs[0]))
+		return nil
+	}
+	head := TLVHead{}
+	if err := decodeJSON(obj["TLVType"], reflect.ValueOf(&head.TLVType).Elem()); err != nil {
+		return fmt.Errorf("TLVType: %w", err)
+	}
+	tlv := newTLV(head.TLVType)
+	if tlv == nil {
+		return fmt.Errorf("TLV %s can only be decoded from Raw", head.TLVType)
+	}
+	if err := decodeFields(obj, reflect.ValueOf(tlv).Elem()); err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(tlv))
+	return nil
+}
+
+// decodeManagementTLV decodes management TLV from its Raw bytes
+func decodeManagementTLV(raw json.RawMessage, v reflect.Value) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return err
+	}
+	b, found, err := rawTLV(obj)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("management TLV can only be decoded from Raw")
+	}
+	if len(b) < tlvHeadSize+2 {
+		return fmt.Errorf("not enough data to decode management TLV")
+	}
+	id := ManagementID(binary.BigEndian.Uint16(b[tlvHeadSize:]))
+	decoder, found := mgmtTLVDecoder[id]
+	if !found {
+		return fmt.Errorf("unsupported management TLV 0x%x", id)
+	}
+	tlv, err := decoder(b)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(tlv))
+	return nil
+}
+
+func marshalJSONPacket(p Packet) ([]byte, error) {
+	v, err := encodeJSON(reflect.ValueOf(p))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func unmarshalJSONPacket(b []byte, p Packet) error {
+	return decodeJSON(b, reflect.ValueOf(p).Elem())
+}
+
+// DecodePacketJSON decodes packet of any type from JSON produced by its MarshalJSON
+func DecodePacketJSON(b []byte) (Packet, error) {
+	var probe struct {
+		Header struct {
+			SdoIDAndMsgType json.RawMessage
+		}
+		ManagementErrorID json.RawMessage
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return nil, err
+	}
+	if probe.Header.SdoIDAndMsgType == nil {
+		return nil, fmt.Errorf("no SdoIDAndMsgType in Header")
+	}
+	var sdoID SdoIDAndMsgType
+	if err := decodeJSON(probe.Header.SdoIDAndMsgType, reflect.ValueOf(&sdoID).Elem()); err != nil {
+		return nil, fmt.Errorf("SdoIDAndMsgType: %w", err)
+	}
+	var p json.Unmarshaler
+	switch msgType := sdoID.MsgType(); msgType {
+	case MessageSync, MessageDelayReq:
+		p = &SyncDelayReq{}
+	case MessagePDelayReq:
+		p = &PDelayReq{}
+	case MessagePDelayResp:
+		p = &PDelayResp{}
+	case MessageFollowUp:
+		p = &FollowUp{}
+	case MessageDelayResp:
+		p = &DelayResp{}
+	case MessagePDelayRespFollowUp:
+		p = &PDelayRespFollowUp{}
+	case MessageAnnounce:
+		p = &Announce{}
+	case MessageSignaling:
+		p = &Signaling{}
+	case MessageManagement:
+		if probe.ManagementErrorID != nil {
+			p = &ManagementMsgErrorStatus{}
+		} else {
+			p = &Management{}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %s", msgType)
+	}
+	if err := p.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return p.(Packet), nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *Announce) MarshalJSON() ([]byte, error) {
+	return marshalJSONPacket(p)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *Announce) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONPacket(b, p)
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *SyncDelayReq) MarshalJSON() ([]byte, error) {
+	return marshalJSONPacket(p)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *SyncDelayReq) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONPacket(b, p)
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *FollowUp) MarshalJSON() ([]byte, error) {
+	return marshalJSONPacket(p)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *FollowUp) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONPacket(b, p)
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *DelayResp) MarshalJSON() ([]byte, error) {
+	return marshalJSONPacket(p)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *DelayResp) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONPacket(b, p)
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *PDelayReq) MarshalJSON() ([]byte, error) {
+	return marshalJSONPacket(p)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *PDelayReq) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONPacket(b, p)
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *PDelayResp) MarshalJSON() ([]byte, error) {
+	return marshalJSONPacket(p)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *PDelayResp) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONPacket(b, p)
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *PDelayRespFollowUp) MarshalJSON() ([]byte, error) {
+	return marshalJSONPacket(p)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *PDelayRespFollowUp) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONPacket(b, p)
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *Signaling) MarshalJSON() ([]byte, error) {
+	return marshalJSONPacket(p)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *Signaling) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONPacket(b, p)
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *Management) MarshalJSON() ([]byte, error) {
+	return marshalJSONPacket(p)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *Management) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONPacket(b, p)
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *ManagementMsgErrorStatus) MarshalJSON() ([]byte, error) {
+	return marshalJSONPacket(p)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *ManagementMsgErrorStatus) UnmarshalJSON(b []byte) error {
+	return unmarshalJSONPacket(b, p)
+}
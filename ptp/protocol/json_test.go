@@ -0,0 +1,206 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketJSON(t *testing.T) {
+	b, err := json.Marshal(dumpTestFollowUp())
+	require.NoError(t, err)
+	want := `{"Header":{"SdoIDAndMsgType":{"MessageType":"FOLLOW_UP","SdoID":0},"Version":18,"MessageLength":44,"DomainNumber":0,"MinorSdoID":0,"FlagField":"0x0400","CorrectionField":2.5,"MessageTypeSpecific":0,"SourcePortIdentity":{"ClockIdentity":"001122.fffe.334455","PortNumber":1},"SequenceID":42,"ControlField":2,"LogMessageInterval":-3},"PreciseOriginTimestamp":"2022-05-26T14:16:29.806070046Z"}`
+	require.Equal(t, want, string(b))
+
+	got := &FollowUp{}
+	require.NoError(t, json.Unmarshal(b, got))
+	require.Equal(t, dumpTestFollowUp(), got)
+}
+
+func TestPacketJSONTLVs(t *testing.T) {
+	p := &Signaling{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageSignaling, 0),
+		},
+		TLVs: []TLV{
+			&CancelUnicastTransmissionTLV{
+				TLVHead:         TLVHead{TLVType: TLVCancelUnicastTransmission, LengthField: 2},
+				MsgTypeAndFlags: NewUnicastMsgTypeAndFlags(MessageSync, 0),
+			},
+			&OrganizationExtensionTLV{
+				TLVHead:             TLVHead{TLVType: TLVOrganizationExtension, LengthField: 8},
+				OrganizationID:      [3]uint8{0xaa, 0xbb, 0xcc},
+				OrganizationSubType: [3]uint8{0, 0, 1},
+				DataField:           []byte{0x12, 0x34},
+			},
+		},
+	}
+	b, err := json.Marshal(p)
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"TLVs":[{"TLVType":"CANCEL_UNICAST_TRANSMISSION","LengthField":2,"MsgTypeAndFlags":0,"Reserved":0},`)
+	require.Contains(t, string(b), `{"TLVType":"ORGANIZATION_EXTENSION","LengthField":8,"OrganizationID":"aabbcc","OrganizationSubType":"000001","DataField":"1234","Raw":"00030008aabbcc0000011234"}`)
+
+	got := &Signaling{}
+	require.NoError(t, json.Unmarshal(b, got))
+	require.Equal(t, p, got)
+}
+
+func packetBytes(t *testing.T, p Packet) []byte {
+	b, err := Bytes(p)
+	require.NoError(t, err)
+	return b
+}
+
+func TestPacketJSONRoundTrip(t *testing.T) {
+	pdelayHeader := fuzzHeader
+	pdelayHeader.MessageLength = headerSize + 20
+	pdelayReq := pdelayHeader
+	pdelayReq.SdoIDAndMsgType = NewSdoIDAndMsgType(MessagePDelayReq, 0)
+	pdelayResp := pdelayHeader
+	pdelayResp.SdoIDAndMsgType = NewSdoIDAndMsgType(MessagePDelayResp, 0)
+	pdelayRespFollowUp := pdelayHeader
+	pdelayRespFollowUp.SdoIDAndMsgType = NewSdoIDAndMsgType(MessagePDelayRespFollowUp, 0)
+	ts := NewTimestamp(time.Unix(1653574589, 806070046))
+	packets := map[string][]byte{
+		"sync":                  seedSync(t),
+		"followup":              seedFollowUp(t),
+		"delayresp":             seedDelayResp(t),
+		"announce":              seedAnnounce(t),
+		"signaling":             seedSignaling(t),
+		"management":            seedManagement(t),
+		"management error":      seedManagementErrorStatus(t),
+		"pdelay req":            packetBytes(t, &PDelayReq{Header: pdelayReq, PDelayReqBody: PDelayReqBody{OriginTimestamp: ts}}),
+		"pdelay resp":           packetBytes(t, &PDelayResp{Header: pdelayResp, PDelayRespBody: PDelayRespBody{RequestReceiptTimestamp: ts, RequestingPortIdentity: fuzzHeader.SourcePortIdentity}}),
+		"pdelay resp follow up": packetBytes(t, &PDelayRespFollowUp{Header: pdelayRespFollowUp, PDelayRespFollowUpBody: PDelayRespFollowUpBody{ResponseOriginTimestamp: ts, RequestingPortIdentity: fuzzHeader.SourcePortIdentity}}),
+	}
+	for name, raw := range packets {
+		t.Run(name, func(t *testing.T) {
+			p, err := DecodePacket(raw)
+			require.NoError(t, err)
+			b, err := json.Marshal(p)
+			require.NoError(t, err)
+
+			got, err := DecodePacketJSON(b)
+			require.NoError(t, err)
+			require.Equal(t, p, got)
+			require.Equal(t, packetBytes(t, p), packetBytes(t, got))
+		})
+	}
+}
+
+func TestPacketJSONValues(t *testing.T) {
+	p := &Announce{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageAnnounce, 1),
+			CorrectionField: Correction(-0x18001),
+		},
+		AnnounceBody: AnnounceBody{
+			// not representable as RFC3339
+			OriginTimestamp: Timestamp{Seconds: PTPSeconds{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, Nanoseconds: 5},
+		},
+		TLVs: []TLV{
+			&AlternateTimeOffsetIndicatorTLV{
+				TLVHead:        TLVHead{TLVType: TLVAlternateTimeOffsetIndicator, LengthField: 19},
+				KeyField:       1,
+				CurrentOffset:  -37,
+				TimeOfNextJump: NewPTPSeconds(time.Unix(1658000000, 0)),
+				DisplayName:    "TAI",
+			},
+			&UnknownTLV{
+				TLVHead: TLVHead{TLVType: 0x1234, LengthField: 2},
+				Value:   []byte{0xbe, 0xef},
+			},
+		},
+	}
+	b, err := json.Marshal(p)
+	require.NoError(t, err)
+	s := string(b)
+	require.Contains(t, s, `"SdoIDAndMsgType":{"MessageType":"ANNOUNCE","SdoID":1}`)
+	require.Contains(t, s, `"CorrectionField":-1.5000152587890625`)
+	require.Contains(t, s, `"OriginTimestamp":{"Seconds":281474976710655,"Nanoseconds":5}`)
+	require.Contains(t, s, `"TimeOfNextJump":1658000000,"DisplayName":"TAI"`)
+	require.Contains(t, s, `{"TLVType":4660,"LengthField":2,"Value":"beef"}`)
+
+	got := &Announce{}
+	require.NoError(t, json.Unmarshal(b, got))
+	require.Equal(t, p, got)
+}
+
+func TestPacketJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "unknown field",
+			in:   `{"Header":{"Foo":1}}`,
+			want: `unknown field "Foo"`,
+		},
+		{
+			name: "overflow",
+			in:   `{"Header":{"SequenceID":65536}}`,
+			want: "65536 is out of range of uint16",
+		},
+		{
+			name: "inexact correction",
+			in:   `{"Header":{"CorrectionField":0.00001}}`,
+			want: "can't be represented",
+		},
+		{
+			name: "bad clock identity",
+			in:   `{"Header":{"SourcePortIdentity":{"ClockIdentity":"001122.fffe"}}}`,
+			want: `invalid clock identity "001122.fffe"`,
+		},
+		{
+			name: "unknown message type",
+			in:   `{"Header":{"SdoIDAndMsgType":{"MessageType":"FOO"}}}`,
+			want: `unknown name "FOO"`,
+		},
+		{
+			name: "organization extension without raw",
+			in:   `{"TLVs":[{"TLVType":"ORGANIZATION_EXTENSION"}]}`,
+			want: "can only be decoded from Raw",
+		},
+	}
+	_, err := DecodePacketJSON([]byte(`{"Header":{}}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no SdoIDAndMsgType in Header")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := json.Unmarshal([]byte(tt.in), &Announce{})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestParseClockIdentity(t *testing.T) {
+	c, err := ParseClockIdentity("001122.fffe.334455")
+	require.NoError(t, err)
+	require.Equal(t, ClockIdentity(0x001122fffe334455), c)
+	c, err = ParseClockIdentity("001122fffe334455")
+	require.NoError(t, err)
+	require.Equal(t, ClockIdentity(0x001122fffe334455), c)
+	_, err = ParseClockIdentity("001122.fffe.33445z")
+	require.Error(t, err)
+}
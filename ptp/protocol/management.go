@@ -84,15 +84,14 @@ type Management struct {
 
 // UnmarshalBinary parses []byte and populates struct fields
 func (p *Management) UnmarshalBinary(rawBytes []byte) error {
-	var err error
 	head := ManagementMsgHead{}
 	tlvHead := ManagementTLVHead{}
-	r := bytes.NewReader(rawBytes)
-	if err = binary.Read(r, binary.BigEndian, &head); err != nil {
-		return err
-	}
-	if err = binary.Read(r, binary.BigEndian, &tlvHead.TLVHead); err != nil {
-		return err
+	r := reader{b: rawBytes}
+	r.read("ManagementMsgHead", &head)
+	tlvStart := r.pos
+	r.read("TLVHead", &tlvHead.TLVHead)
+	if r.err != nil {
+		return r.err
 	}
 	if tlvHead.TLVType == TLVManagementErrorStatus {
 		return ErrManagementMsgErrorStatus
@@ -100,24 +99,16 @@ func (p *Management) UnmarshalBinary(rawBytes []byte) error {
 	if tlvHead.TLVType != TLVManagement {
 		return fmt.Errorf("got TLV type %q (0x%02X) instead of %q (0x%02X)", tlvHead.TLVType.String(), int(tlvHead.TLVType), TLVManagement.String(), int(TLVManagement))
 	}
-
-	if err = binary.Read(r, binary.BigEndian, &tlvHead.ManagementID); err != nil {
-		return err
-	}
-	headSize := binary.Size(tlvHead)
-	// seek back so we can read whole TLV
-	if _, err := r.Seek(-int64(headSize), io.SeekCurrent); err != nil {
-		return err
+	r.read("ManagementID", &tlvHead.ManagementID)
+	if r.err != nil {
+		return r.err
 	}
 	decoder, found := mgmtTLVDecoder[tlvHead.ManagementID]
 	if !found {
 		return fmt.Errorf("unsupported management TLV 0x%x", tlvHead.ManagementID)
 	}
-	tlvData, err := io.ReadAll(r)
-	if err != nil {
-		return err
-	}
-	tlv, err := decoder(tlvData)
+	// decoder gets whole TLV
+	tlv, err := decoder(rawBytes[tlvStart:])
 	if err != nil {
 		return err
 	}
@@ -131,15 +122,20 @@ func (p *Management) MarshalBinaryToBuf(bytes io.Writer) error {
 	if err := binary.Write(bytes, binary.BigEndian, p.ManagementMsgHead); err != nil {
 		return err
 	}
+	return writeManagementTLV(bytes, p.TLV)
+}
+
+// writeManagementTLV writes management TLV, header included
+func writeManagementTLV(w io.Writer, tlv ManagementTLV) error {
 	// interface smuggling
-	if pp, ok := p.TLV.(encoding.BinaryMarshaler); ok {
+	if pp, ok := tlv.(encoding.BinaryMarshaler); ok {
 		b, err := pp.MarshalBinary()
 		if err != nil {
 			return err
 		}
-		return binary.Write(bytes, binary.BigEndian, b)
+		return binary.Write(w, binary.BigEndian, b)
 	}
-	return binary.Write(bytes, binary.BigEndian, p.TLV)
+	return binary.Write(w, binary.BigEndian, tlv)
 }
 
 // MarshalBinary converts packet to []bytes
@@ -167,40 +163,21 @@ type ManagementMsgErrorStatus struct {
 
 // UnmarshalBinary parses []byte and populates struct fields
 func (p *ManagementMsgErrorStatus) UnmarshalBinary(rawBytes []byte) error {
-	reader := bytes.NewReader(rawBytes)
-	be := binary.BigEndian
-	if err := binary.Read(reader, be, &p.ManagementMsgHead); err != nil {
-		return fmt.Errorf("reading ManagementMsgErrorStatus ManagementMsgHead: %w", err)
-	}
-	if err := binary.Read(reader, be, &p.ManagementErrorStatusTLV.TLVHead); err != nil {
-		return fmt.Errorf("reading ManagementMsgErrorStatus TLVHead: %w", err)
-	}
-	if err := binary.Read(reader, be, &p.ManagementErrorStatusTLV.ManagementErrorID); err != nil {
-		return fmt.Errorf("reading ManagementMsgErrorStatus ManagementErrorID: %w", err)
-	}
-	if err := binary.Read(reader, be, &p.ManagementErrorStatusTLV.ManagementID); err != nil {
-		return fmt.Errorf("reading ManagementMsgErrorStatus ManagementID: %w", err)
-	}
-	if err := binary.Read(reader, be, &p.ManagementErrorStatusTLV.Reserved); err != nil {
-		return fmt.Errorf("reading ManagementMsgErrorStatus Reserved: %w", err)
+	r := reader{b: rawBytes}
+	r.read("ManagementMsgErrorStatus ManagementMsgHead", &p.ManagementMsgHead)
+	r.read("ManagementMsgErrorStatus TLVHead", &p.ManagementErrorStatusTLV.TLVHead)
+	r.read("ManagementMsgErrorStatus ManagementErrorID", &p.ManagementErrorStatusTLV.ManagementErrorID)
+	r.read("ManagementMsgErrorStatus ManagementID", &p.ManagementErrorStatusTLV.ManagementID)
+	r.read("ManagementMsgErrorStatus Reserved", &p.ManagementErrorStatusTLV.Reserved)
+	if r.err != nil {
+		return r.err
 	}
 	// packet can have trailing bytes, let's make sure we don't try to read past given length
-	toRead := int(p.ManagementMsgHead.Header.MessageLength)
-	toRead -= binary.Size(p.ManagementMsgHead)
-	toRead -= binary.Size(p.ManagementErrorStatusTLV.TLVHead)
-	toRead -= binary.Size(p.ManagementErrorStatusTLV.ManagementErrorID)
-	toRead -= binary.Size(p.ManagementErrorStatusTLV.ManagementID)
-	toRead -= binary.Size(p.ManagementErrorStatusTLV.Reserved)
-
-	if reader.Len() == 0 || toRead <= 0 {
+	if r.len() == 0 || int(p.ManagementMsgHead.Header.MessageLength) <= r.pos {
 		// DisplayData is completely optional
 		return nil
 	}
-	data := make([]byte, reader.Len())
-	if _, err := io.ReadFull(reader, data); err != nil {
-		return err
-	}
-	if err := p.DisplayData.UnmarshalBinary(data); err != nil {
+	if err := p.DisplayData.UnmarshalBinary(r.rest()); err != nil {
 		return fmt.Errorf("reading ManagementMsgErrorStatus DisplayData: %w", err)
 	}
 	return nil
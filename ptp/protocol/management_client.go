@@ -19,15 +19,71 @@ package protocol
 // management client is used to talk to (presumably local) PTP server using Management packets
 
 import (
+	"encoding"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 )
 
 // MgmtClient talks to ptp server over unix socket
 type MgmtClient struct {
 	Connection io.ReadWriter
 	Sequence   uint16
+	// if set, and Connection supports deadlines, every response is waited for at most that long
+	Timeout time.Duration
+
+	// local unix socket we have to remove on Close
+	localSocket string
+}
+
+// counts local unix sockets, so clients in the same process don't clash
+var mgmtSockets uint32
+
+// DialMgmtUDS connects to management unix socket of PTP server, like /var/run/ptp4l.
+// Local socket is created next to it, so server can reply, and is removed by Close
+func DialMgmtUDS(address string, timeout time.Duration) (*MgmtClient, error) {
+	local := filepath.Join(filepath.Dir(address), fmt.Sprintf("mgmt.%d.%d.sock", os.Getpid(), atomic.AddUint32(&mgmtSockets, 1)))
+	localAddr := &net.UnixAddr{Name: local, Net: "unixgram"}
+	conn, err := net.DialUnix("unixgram", localAddr, &net.UnixAddr{Name: address, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	c := &MgmtClient{Connection: conn, Timeout: timeout, localSocket: local}
+	// server may run as different user
+	if err := os.Chmod(local, 0666); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// DialMgmtUDP connects to PTP server over UDP. Address is host:port of its general port, which is 320 by default,
+// and server has to reply to the address request came from
+func DialMgmtUDP(address string, timeout time.Duration) (*MgmtClient, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &MgmtClient{Connection: conn, Timeout: timeout}, nil
+}
+
+// Close closes connection if it can be closed, and removes local unix socket created by DialMgmtUDS
+func (c *MgmtClient) Close() error {
+	var err error
+	if closer, ok := c.Connection.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if c.localSocket != "" {
+		if rerr := os.Remove(c.localSocket); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+			err = rerr
+		}
+	}
+	return err
 }
 
 // SendPacket sends packet, incrementing sequence counter
@@ -48,6 +104,11 @@ func (c *MgmtClient) Communicate(packet *Management) (*Management, error) {
 	if err := c.SendPacket(packet); err != nil {
 		return nil, err
 	}
+	if d, ok := c.Connection.(interface{ SetReadDeadline(time.Time) error }); ok && c.Timeout > 0 {
+		if err := d.SetReadDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return nil, err
+		}
+	}
 	response := make([]uint8, 1024)
 	n, err := c.Connection.Read(response)
 	if err != nil {
@@ -123,3 +184,135 @@ func (c *MgmtClient) ClockAccuracy() (*ClockAccuracyTLV, error) {
 	}
 	return tlv, nil
 }
+
+// mgmtTLVHeader is implemented by management TLVs which embed ManagementTLVHead
+type mgmtTLVHeader interface {
+	mgmtTLVHead() *ManagementTLVHead
+}
+
+func (p *ManagementTLVHead) mgmtTLVHead() *ManagementTLVHead {
+	return p
+}
+
+// NewManagementRequest prepares management message with action on TLV with id, filling in all the lengths.
+// TLV carries the data to SET. For GET and COMMAND it can be nil, then request carries no data, just like pmc does
+func NewManagementRequest(action Action, id ManagementID, tlv ManagementTLV) (*Management, error) {
+	if tlv == nil {
+		tlv = &ManagementTLVHead{}
+	}
+	h, ok := tlv.(mgmtTLVHeader)
+	if !ok {
+		return nil, fmt.Errorf("management TLV %T doesn't embed ManagementTLVHead", tlv)
+	}
+	head := h.mgmtTLVHead()
+	head.TLVType = TLVManagement
+	head.ManagementID = id
+	if _, ok := tlv.(encoding.BinaryMarshaler); !ok {
+		// fixed size TLV, variable size ones calculate LengthField themselves
+		head.LengthField = uint16(binary.Size(tlv) - binary.Size(TLVHead{}))
+	}
+	p := &Management{
+		ManagementMsgHead: ManagementMsgHead{
+			Header: Header{
+				SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageManagement, 0),
+				Version:            Version,
+				SourcePortIdentity: identity,
+				LogMessageInterval: MgmtLogMessageInterval,
+			},
+			TargetPortIdentity:   DefaultTargetPortIdentity,
+			StartingBoundaryHops: 0,
+			BoundaryHops:         0,
+			ActionField:          action,
+		},
+		TLV: tlv,
+	}
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	p.MessageLength = uint16(len(b))
+	return p, nil
+}
+
+// request sends management request and returns TLV from the response, making sure it's the one we asked for
+func (c *MgmtClient) request(action Action, id ManagementID, tlv ManagementTLV) (ManagementTLV, error) {
+	req, err := NewManagementRequest(action, id, tlv)
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.Communicate(req)
+	if err != nil {
+		return nil, err
+	}
+	if p.TLV.MgmtID() != id {
+		return nil, fmt.Errorf("got response for %s, wanted %s", p.TLV.MgmtID(), id)
+	}
+	return p.TLV, nil
+}
+
+// Get sends GET request for management TLV with id and returns response
+func (c *MgmtClient) Get(id ManagementID) (ManagementTLV, error) {
+	return c.request(GET, id, nil)
+}
+
+// Set sends SET request with TLV and returns response, which carries values server actually applied
+func (c *MgmtClient) Set(id ManagementID, tlv ManagementTLV) (ManagementTLV, error) {
+	return c.request(SET, id, tlv)
+}
+
+// Command sends COMMAND request for management TLV with id, like ENABLE_PORT, and returns acknowledgement
+func (c *MgmtClient) Command(id ManagementID) (ManagementTLV, error) {
+	return c.request(COMMAND, id, nil)
+}
+
+// TimePropertiesDataSet sends TIME_PROPERTIES_DATA_SET request and returns response
+func (c *MgmtClient) TimePropertiesDataSet() (*TimePropertiesDataSetTLV, error) {
+	p, err := c.Get(IDTimePropertiesDataSet)
+	if err != nil {
+		return nil, err
+	}
+	tlv, ok := p.(*TimePropertiesDataSetTLV)
+	if !ok {
+		return nil, fmt.Errorf("got unexpected management TLV %T, wanted %T", p, tlv)
+	}
+	return tlv, nil
+}
+
+// PortDataSet sends PORT_DATA_SET request and returns response
+func (c *MgmtClient) PortDataSet() (*PortDataSetTLV, error) {
+	p, err := c.Get(IDPortDataSet)
+	if err != nil {
+		return nil, err
+	}
+	tlv, ok := p.(*PortDataSetTLV)
+	if !ok {
+		return nil, fmt.Errorf("got unexpected management TLV %T, wanted %T", p, tlv)
+	}
+	return tlv, nil
+}
+
+// ClockDescription sends CLOCK_DESCRIPTION request and returns response
+func (c *MgmtClient) ClockDescription() (*ClockDescriptionTLV, error) {
+	p, err := c.Get(IDClockDescription)
+	if err != nil {
+		return nil, err
+	}
+	tlv, ok := p.(*ClockDescriptionTLV)
+	if !ok {
+		return nil, fmt.Errorf("got unexpected management TLV %T, wanted %T", p, tlv)
+	}
+	return tlv, nil
+}
+
+// UserDescription sends USER_DESCRIPTION request and returns response
+func (c *MgmtClient) UserDescription() (*UserDescriptionTLV, error) {
+	p, err := c.Get(IDUserDescription)
+	if err != nil {
+		return nil, err
+	}
+	tlv, ok := p.(*UserDescriptionTLV)
+	if !ok {
+		return nil, fmt.Errorf("got unexpected management TLV %T, wanted %T", p, tlv)
+	}
+	return tlv, nil
+}
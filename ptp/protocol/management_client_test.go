@@ -20,8 +20,13 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -722,3 +727,122 @@ func TestMgmtClientUnicastMasterTableNP(t *testing.T) {
 	require.Equal(t, 1, len(conn.inputs))
 	require.Equal(t, conn.inputs[0], b)
 }
+
+func mgmtResponse(t *testing.T, id ManagementID, tlv ManagementTLV) *Management {
+	p, err := NewManagementRequest(RESPONSE, id, tlv)
+	require.NoError(t, err)
+	return p
+}
+
+func TestMgmtClientGetSet(t *testing.T) {
+	want := mgmtResponse(t, IDPriority1, &Priority1TLV{Priority1: 42})
+	conn, client := prepareTestClient(t, want)
+	got, err := client.Set(IDPriority1, &Priority1TLV{Priority1: 42})
+	require.NoError(t, err)
+	require.Equal(t, want.TLV, got)
+	require.Equal(t, 1, len(conn.inputs))
+	req := &Management{}
+	require.NoError(t, req.UnmarshalBinary(conn.inputs[0]))
+	require.Equal(t, SET, req.Action())
+	require.Equal(t, want.TLV, req.TLV)
+
+	// response for something else
+	_, client = prepareTestClient(t, want)
+	_, err = client.Get(IDPriority2)
+	require.EqualError(t, err, "got response for PRIORITY1, wanted PRIORITY2")
+}
+
+func TestMgmtClientTypedGetters(t *testing.T) {
+	tp := mgmtResponse(t, IDTimePropertiesDataSet, &TimePropertiesDataSetTLV{CurrentUTCOffset: 37, TimeSource: TimeSourceGNSS})
+	_, client := prepareTestClient(t, tp)
+	tpGot, err := client.TimePropertiesDataSet()
+	require.NoError(t, err)
+	require.Equal(t, tp.TLV, tpGot)
+
+	pds := mgmtResponse(t, IDPortDataSet, &PortDataSetTLV{PortState: PortStateSlave, DelayMechanism: DelayMechanismE2E})
+	_, client = prepareTestClient(t, pds)
+	pdsGot, err := client.PortDataSet()
+	require.NoError(t, err)
+	require.Equal(t, pds.TLV, pdsGot)
+
+	cd := &ClockDescriptionTLV{}
+	require.NoError(t, cd.UnmarshalBinary(clockDescriptionRaw))
+	_, client = prepareTestClient(t, mgmtResponse(t, IDClockDescription, cd))
+	cdGot, err := client.ClockDescription()
+	require.NoError(t, err)
+	require.Equal(t, cd, cdGot)
+
+	ud := &UserDescriptionTLV{UserDescription: "gm1"}
+	_, client = prepareTestClient(t, mgmtResponse(t, IDUserDescription, ud))
+	udGot, err := client.UserDescription()
+	require.NoError(t, err)
+	require.Equal(t, PTPText("gm1"), udGot.UserDescription)
+}
+
+// serveMgmt replies to single management GET request on conn with Priority1 response
+func serveMgmt(t *testing.T, conn net.PacketConn) {
+	buf := make([]byte, 1024)
+	n, addr, err := conn.ReadFrom(buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// GET carries no data, so only heads can be read
+	var head ManagementMsgHead
+	var tlvHead ManagementTLVHead
+	r := bytes.NewReader(buf[:n])
+	assert.NoError(t, binary.Read(r, binary.BigEndian, &head))
+	assert.NoError(t, binary.Read(r, binary.BigEndian, &tlvHead))
+	assert.Equal(t, GET, head.Action())
+	assert.Equal(t, IDPriority1, tlvHead.MgmtID())
+	resp := mgmtResponse(t, IDPriority1, &Priority1TLV{Priority1: 128})
+	resp.SetSequence(head.SequenceID)
+	b, err := resp.MarshalBinary()
+	assert.NoError(t, err)
+	_, err = conn.WriteTo(b, addr)
+	assert.NoError(t, err)
+}
+
+func TestDialMgmtUDS(t *testing.T) {
+	dir := t.TempDir()
+	server := filepath.Join(dir, "ptp4l")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: server, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveMgmt(t, conn)
+
+	c, err := DialMgmtUDS(server, time.Second)
+	require.NoError(t, err)
+	tlv, err := c.Get(IDPriority1)
+	require.NoError(t, err)
+	require.Equal(t, uint8(128), tlv.(*Priority1TLV).Priority1)
+
+	local := c.localSocket
+	require.Equal(t, dir, filepath.Dir(local))
+	fi, err := os.Stat(local)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0666), fi.Mode().Perm())
+	require.NoError(t, c.Close())
+	_, err = os.Stat(local)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestDialMgmtUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveMgmt(t, conn)
+
+	c, err := DialMgmtUDP(conn.LocalAddr().String(), time.Second)
+	require.NoError(t, err)
+	defer c.Close()
+	tlv, err := c.Get(IDPriority1)
+	require.NoError(t, err)
+	require.Equal(t, uint8(128), tlv.(*Priority1TLV).Priority1)
+
+	// nobody answers second time
+	start := time.Now()
+	c.Timeout = 50 * time.Millisecond
+	_, err = c.Get(IDPriority1)
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,184 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// ClockType is a bit mask describing kind of PTP instance in CLOCK_DESCRIPTION
+type ClockType uint16
+
+// clockType bits
+const (
+	ClockTypeOrdinary       ClockType = 1 << 15
+	ClockTypeBoundary       ClockType = 1 << 14
+	ClockTypeP2PTransparent ClockType = 1 << 13
+	ClockTypeE2ETransparent ClockType = 1 << 12
+	ClockTypeManagement     ClockType = 1 << 11
+)
+
+// ClockDescriptionTLV is CLOCK_DESCRIPTION management TLV data field
+type ClockDescriptionTLV struct {
+	ManagementTLVHead
+
+	ClockType             ClockType
+	PhysicalLayerProtocol PTPText
+	PhysicalAddress       []byte
+	ProtocolAddress       PortAddress
+	ManufacturerIdentity  [3]byte
+	Reserved              uint8
+	ProductDescription    PTPText
+	RevisionData          PTPText
+	UserDescription       PTPText
+	ProfileIdentity       [6]byte
+}
+
+// mgmtTLVWriter writes variable length fields of management TLV one after another
+type mgmtTLVWriter struct {
+	bytes.Buffer
+	err error
+}
+
+// write writes fixed size value
+func (w *mgmtTLVWriter) write(v interface{}) {
+	if w.err != nil {
+		return
+	}
+	w.err = binary.Write(&w.Buffer, binary.BigEndian, v)
+}
+
+// text writes PTPText with no padding
+func (w *mgmtTLVWriter) text(t PTPText) {
+	if len(t) > 255 {
+		w.err = fmt.Errorf("text %q is too long", t)
+		return
+	}
+	w.write(uint8(len(t)))
+	w.write([]byte(t))
+}
+
+// finish pads TLV to even length and fills in its LengthField
+func (w *mgmtTLVWriter) finish() ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	if w.Len()%2 != 0 {
+		w.WriteByte(0)
+	}
+	b := w.Bytes()
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)-binary.Size(TLVHead{})))
+	return b, nil
+}
+
+// mgmtTLVValue reads head of management TLV and returns reader over the rest of its value, as LengthField tells.
+// want is the length of value fields when all of them are empty
+func mgmtTLVValue(r *reader, p *ManagementTLVHead, want int) reader {
+	v := r.tlvHead(&p.TLVHead, 2+want, false)
+	p.ManagementID = ManagementID(v.uint16("ManagementID"))
+	return v
+}
+
+// mgmtTLVEnd checks that value fields are followed by nothing but padding to even length, as MarshalBinary writes it
+func mgmtTLVEnd(v *reader) error {
+	if v.err != nil {
+		return v.err
+	}
+	pad := v.pos % 2
+	if rest := v.rest(); len(rest) != pad || (pad == 1 && rest[0] != 0) {
+		return fmt.Errorf("TLV of length %d has %d bytes after fields of %d bytes, expected %d byte of zero padding", len(v.b), len(rest), v.pos, pad)
+	}
+	return nil
+}
+
+// UnmarshalBinary parses []byte and populates struct fields
+func (p *ClockDescriptionTLV) UnmarshalBinary(b []byte) error {
+	r := &reader{b: b}
+	v := mgmtTLVValue(r, &p.ManagementTLVHead, 22)
+	if r.err != nil {
+		return fmt.Errorf("reading CLOCK_DESCRIPTION: %w", r.err)
+	}
+	v.read("ClockType", &p.ClockType)
+	v.text("PhysicalLayerProtocol", &p.PhysicalLayerProtocol)
+	var physicalAddressLength uint16
+	v.read("PhysicalAddressLength", &physicalAddressLength)
+	p.PhysicalAddress = v.bytes("PhysicalAddress", int(physicalAddressLength))
+	v.read("ProtocolAddress.NetworkProtocol", &p.ProtocolAddress.NetworkProtocol)
+	v.read("ProtocolAddress.AddressLength", &p.ProtocolAddress.AddressLength)
+	p.ProtocolAddress.AddressField = v.bytes("ProtocolAddress.AddressField", int(p.ProtocolAddress.AddressLength))
+	v.read("ManufacturerIdentity", &p.ManufacturerIdentity)
+	v.read("Reserved", &p.Reserved)
+	v.text("ProductDescription", &p.ProductDescription)
+	v.text("RevisionData", &p.RevisionData)
+	v.text("UserDescription", &p.UserDescription)
+	v.read("ProfileIdentity", &p.ProfileIdentity)
+	if err := mgmtTLVEnd(&v); err != nil {
+		return fmt.Errorf("reading CLOCK_DESCRIPTION: %w", err)
+	}
+	return nil
+}
+
+// MarshalBinary converts TLV to []bytes, LengthField is calculated
+func (p *ClockDescriptionTLV) MarshalBinary() ([]byte, error) {
+	w := &mgmtTLVWriter{}
+	w.write(p.ManagementTLVHead)
+	w.write(p.ClockType)
+	w.text(p.PhysicalLayerProtocol)
+	w.write(uint16(len(p.PhysicalAddress)))
+	w.write(p.PhysicalAddress)
+	w.write(p.ProtocolAddress.NetworkProtocol)
+	w.write(uint16(len(p.ProtocolAddress.AddressField)))
+	w.write(p.ProtocolAddress.AddressField)
+	w.write(p.ManufacturerIdentity)
+	w.write(p.Reserved)
+	w.text(p.ProductDescription)
+	w.text(p.RevisionData)
+	w.text(p.UserDescription)
+	w.write(p.ProfileIdentity)
+	return w.finish()
+}
+
+// UserDescriptionTLV is USER_DESCRIPTION management TLV data field
+type UserDescriptionTLV struct {
+	ManagementTLVHead
+
+	UserDescription PTPText
+}
+
+// UnmarshalBinary parses []byte and populates struct fields
+func (p *UserDescriptionTLV) UnmarshalBinary(b []byte) error {
+	r := &reader{b: b}
+	v := mgmtTLVValue(r, &p.ManagementTLVHead, 1)
+	if r.err != nil {
+		return fmt.Errorf("reading USER_DESCRIPTION: %w", r.err)
+	}
+	v.text("UserDescription", &p.UserDescription)
+	if err := mgmtTLVEnd(&v); err != nil {
+		return fmt.Errorf("reading USER_DESCRIPTION: %w", err)
+	}
+	return nil
+}
+
+// MarshalBinary converts TLV to []bytes, LengthField is calculated
+func (p *UserDescriptionTLV) MarshalBinary() ([]byte, error) {
+	w := &mgmtTLVWriter{}
+	w.write(p.ManagementTLVHead)
+	w.text(p.UserDescription)
+	return w.finish()
+}
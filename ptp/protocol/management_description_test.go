@@ -0,0 +1,126 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// CLOCK_DESCRIPTION as ptp4l sends it, texts are not padded
+var clockDescriptionRaw = []byte{
+	0x00, 0x01, 0x00, 0x34, 0x00, 0x01, // TLV head
+	0x80, 0x00, // clockType
+	0x0a, 'I', 'E', 'E', 'E', ' ', '8', '0', '2', '.', '3', // physicalLayerProtocol
+	0x00, 0x06, 0x0c, 0x42, 0xa1, 0x6d, 0x7c, 0xa6, // physicalAddress
+	0x00, 0x01, 0x00, 0x04, 0xc0, 0xa8, 0x00, 0x0a, // protocolAddress
+	0x00, 0x00, 0x00, 0x00, // manufacturerIdentity, reserved
+	0x05, 'p', 't', 'p', '4', 'l', // productDescription
+	0x03, '4', '.', '0', // revisionData
+	0x00,                               // userDescription
+	0x00, 0x1b, 0x19, 0x00, 0x01, 0x00, // profileIdentity
+}
+
+func TestClockDescriptionTLV(t *testing.T) {
+	tlv := &ClockDescriptionTLV{}
+	require.NoError(t, tlv.UnmarshalBinary(clockDescriptionRaw))
+	want := &ClockDescriptionTLV{
+		ManagementTLVHead: ManagementTLVHead{
+			TLVHead: TLVHead{
+				TLVType:     TLVManagement,
+				LengthField: 52,
+			},
+			ManagementID: IDClockDescription,
+		},
+		ClockType:             ClockTypeOrdinary,
+		PhysicalLayerProtocol: "IEEE 802.3",
+		PhysicalAddress:       []byte{0x0c, 0x42, 0xa1, 0x6d, 0x7c, 0xa6},
+		ProtocolAddress: PortAddress{
+			NetworkProtocol: TransportTypeUDPIPV4,
+			AddressLength:   4,
+			AddressField:    []byte{192, 168, 0, 10},
+		},
+		ProductDescription: "ptp4l",
+		RevisionData:       "4.0",
+		ProfileIdentity:    [6]byte{0x00, 0x1b, 0x19, 0x00, 0x01, 0x00},
+	}
+	require.Equal(t, want, tlv)
+
+	b, err := tlv.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, clockDescriptionRaw, b)
+}
+
+func TestClockDescriptionTLVTruncated(t *testing.T) {
+	for _, n := range []int{3, 8, 20, 40, len(clockDescriptionRaw) - 3} {
+		tlv := &ClockDescriptionTLV{}
+		require.Error(t, tlv.UnmarshalBinary(clockDescriptionRaw[:n]), n)
+	}
+}
+
+func TestClockDescriptionTLVLength(t *testing.T) {
+	// LengthField covering bytes past the last field
+	b := append(append([]byte{}, clockDescriptionRaw...), 0x00, 0x00)
+	b[3] += 2
+	require.Error(t, (&ClockDescriptionTLV{}).UnmarshalBinary(b))
+	// LengthField cutting the last field
+	b = append([]byte{}, clockDescriptionRaw...)
+	b[3] -= 2
+	require.Error(t, (&ClockDescriptionTLV{}).UnmarshalBinary(b))
+}
+
+func TestUserDescriptionTLV(t *testing.T) {
+	for _, text := range []PTPText{"", "gm1", "gm1;rack2"} {
+		tlv := &UserDescriptionTLV{
+			ManagementTLVHead: ManagementTLVHead{
+				TLVHead:      TLVHead{TLVType: TLVManagement},
+				ManagementID: IDUserDescription,
+			},
+			UserDescription: text,
+		}
+		b, err := tlv.MarshalBinary()
+		require.NoError(t, err)
+		require.Zero(t, len(b)%2, "TLV must be of even length")
+		got := &UserDescriptionTLV{}
+		require.NoError(t, got.UnmarshalBinary(b))
+		require.Equal(t, text, got.UserDescription)
+		require.Equal(t, uint16(len(b)-4), got.LengthField)
+	}
+
+	tlv := &UserDescriptionTLV{UserDescription: PTPText(make([]byte, 256))}
+	_, err := tlv.MarshalBinary()
+	require.Error(t, err)
+}
+
+func TestUserDescriptionTLVLength(t *testing.T) {
+	// "gm1" padded to even length
+	b := []byte{0x00, 0x01, 0x00, 0x06, 0x00, 0x07, 0x03, 'g', 'm', '1'}
+	tlv := &UserDescriptionTLV{}
+	require.NoError(t, tlv.UnmarshalBinary(b))
+	require.Equal(t, PTPText("gm1"), tlv.UserDescription)
+
+	for name, b := range map[string][]byte{
+		"too long":        {0x00, 0x01, 0x30, 0x30, 0x00, 0x07, 0x03, 'g', 'm', '1'},
+		"trailing bytes":  {0x00, 0x01, 0x00, 0x08, 0x00, 0x07, 0x03, 'g', 'm', '1', 0x00, 0x00},
+		"no padding":      {0x00, 0x01, 0x00, 0x05, 0x00, 0x07, 0x03, 'g', 'm', '1'},
+		"cuts text":       {0x00, 0x01, 0x00, 0x04, 0x00, 0x07, 0x03, 'g', 'm', '1'},
+		"nonzero padding": {0x00, 0x01, 0x00, 0x06, 0x00, 0x07, 0x02, 'g', 'm', '1'},
+	} {
+		require.Error(t, (&UserDescriptionTLV{}).UnmarshalBinary(b), name)
+	}
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package protocol
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 
@@ -27,7 +26,7 @@ import (
 // ManagementID is type for Management IDs
 type ManagementID uint16
 
-// Management IDs we support, from Table 59 managementId values
+// Management IDs, from Table 59 managementId values
 const (
 	IDNullPTPManagement        ManagementID = 0x0000
 	IDClockDescription         ManagementID = 0x0001
@@ -38,15 +37,120 @@ const (
 	IDFaultLog                 ManagementID = 0x0006
 	IDFaultLogReset            ManagementID = 0x0007
 
-	IDDefaultDataSet        ManagementID = 0x2000
-	IDCurrentDataSet        ManagementID = 0x2001
-	IDParentDataSet         ManagementID = 0x2002
-	IDTimePropertiesDataSet ManagementID = 0x2003
-	IDPortDataSet           ManagementID = 0x2004
-	IDClockAccuracy         ManagementID = 0x2010
-	// rest of Management IDs that we don't implement yet
+	IDDefaultDataSet                  ManagementID = 0x2000
+	IDCurrentDataSet                  ManagementID = 0x2001
+	IDParentDataSet                   ManagementID = 0x2002
+	IDTimePropertiesDataSet           ManagementID = 0x2003
+	IDPortDataSet                     ManagementID = 0x2004
+	IDPriority1                       ManagementID = 0x2005
+	IDPriority2                       ManagementID = 0x2006
+	IDDomain                          ManagementID = 0x2007
+	IDSlaveOnly                       ManagementID = 0x2008
+	IDLogAnnounceInterval             ManagementID = 0x2009
+	IDAnnounceReceiptTimeout          ManagementID = 0x200A
+	IDLogSyncInterval                 ManagementID = 0x200B
+	IDVersionNumber                   ManagementID = 0x200C
+	IDEnablePort                      ManagementID = 0x200D
+	IDDisablePort                     ManagementID = 0x200E
+	IDTime                            ManagementID = 0x200F
+	IDClockAccuracy                   ManagementID = 0x2010
+	IDUTCProperties                   ManagementID = 0x2011
+	IDTraceabilityProperties          ManagementID = 0x2012
+	IDTimescaleProperties             ManagementID = 0x2013
+	IDUnicastNegotiationEnable        ManagementID = 0x2014
+	IDPathTraceList                   ManagementID = 0x2015
+	IDPathTraceEnable                 ManagementID = 0x2016
+	IDGrandmasterClusterTable         ManagementID = 0x2017
+	IDUnicastMasterTable              ManagementID = 0x2018
+	IDUnicastMasterMaxTableSize       ManagementID = 0x2019
+	IDAcceptableMasterTable           ManagementID = 0x201A
+	IDAcceptableMasterTableEnabled    ManagementID = 0x201B
+	IDAcceptableMasterMaxTableSize    ManagementID = 0x201C
+	IDAlternateMaster                 ManagementID = 0x201D
+	IDAlternateTimeOffsetEnable       ManagementID = 0x201E
+	IDAlternateTimeOffsetName         ManagementID = 0x201F
+	IDAlternateTimeOffsetMaxKey       ManagementID = 0x2020
+	IDAlternateTimeOffsetProperties   ManagementID = 0x2021
+	IDExternalPortConfigurationEnable ManagementID = 0x3000
+	IDMasterOnly                      ManagementID = 0x3001
+	IDHoldoverUpgradeEnable           ManagementID = 0x3002
+	IDExtPortConfigPortDataSet        ManagementID = 0x3003
+
+	IDTransparentClockDefaultDataSet ManagementID = 0x4000
+	IDTransparentClockPortDataSet    ManagementID = 0x4001
+	IDPrimaryDomain                  ManagementID = 0x4002
+
+	IDDelayMechanism          ManagementID = 0x6000
+	IDLogMinPdelayReqInterval ManagementID = 0x6001
 )
 
+// ManagementIDToString is a map from ManagementID to string
+var ManagementIDToString = map[ManagementID]string{
+	IDNullPTPManagement:               "NULL_PTP_MANAGEMENT",
+	IDClockDescription:                "CLOCK_DESCRIPTION",
+	IDUserDescription:                 "USER_DESCRIPTION",
+	IDSaveInNonVolatileStorage:        "SAVE_IN_NON_VOLATILE_STORAGE",
+	IDResetNonVolatileStorage:         "RESET_NON_VOLATILE_STORAGE",
+	IDInitialize:                      "INITIALIZE",
+	IDFaultLog:                        "FAULT_LOG",
+	IDFaultLogReset:                   "FAULT_LOG_RESET",
+	IDDefaultDataSet:                  "DEFAULT_DATA_SET",
+	IDCurrentDataSet:                  "CURRENT_DATA_SET",
+	IDParentDataSet:                   "PARENT_DATA_SET",
+	IDTimePropertiesDataSet:           "TIME_PROPERTIES_DATA_SET",
+	IDPortDataSet:                     "PORT_DATA_SET",
+	IDPriority1:                       "PRIORITY1",
+	IDPriority2:                       "PRIORITY2",
+	IDDomain:                          "DOMAIN",
+	IDSlaveOnly:                       "SLAVE_ONLY",
+	IDLogAnnounceInterval:             "LOG_ANNOUNCE_INTERVAL",
+	IDAnnounceReceiptTimeout:          "ANNOUNCE_RECEIPT_TIMEOUT",
+	IDLogSyncInterval:                 "LOG_SYNC_INTERVAL",
+	IDVersionNumber:                   "VERSION_NUMBER",
+	IDEnablePort:                      "ENABLE_PORT",
+	IDDisablePort:                     "DISABLE_PORT",
+	IDTime:                            "TIME",
+	IDClockAccuracy:                   "CLOCK_ACCURACY",
+	IDUTCProperties:                   "UTC_PROPERTIES",
+	IDTraceabilityProperties:          "TRACEABILITY_PROPERTIES",
+	IDTimescaleProperties:             "TIMESCALE_PROPERTIES",
+	IDUnicastNegotiationEnable:        "UNICAST_NEGOTIATION_ENABLE",
+	IDPathTraceList:                   "PATH_TRACE_LIST",
+	IDPathTraceEnable:                 "PATH_TRACE_ENABLE",
+	IDGrandmasterClusterTable:         "GRANDMASTER_CLUSTER_TABLE",
+	IDUnicastMasterTable:              "UNICAST_MASTER_TABLE",
+	IDUnicastMasterMaxTableSize:       "UNICAST_MASTER_MAX_TABLE_SIZE",
+	IDAcceptableMasterTable:           "ACCEPTABLE_MASTER_TABLE",
+	IDAcceptableMasterTableEnabled:    "ACCEPTABLE_MASTER_TABLE_ENABLED",
+	IDAcceptableMasterMaxTableSize:    "ACCEPTABLE_MASTER_MAX_TABLE_SIZE",
+	IDAlternateMaster:                 "ALTERNATE_MASTER",
+	IDAlternateTimeOffsetEnable:       "ALTERNATE_TIME_OFFSET_ENABLE",
+	IDAlternateTimeOffsetName:         "ALTERNATE_TIME_OFFSET_NAME",
+	IDAlternateTimeOffsetMaxKey:       "ALTERNATE_TIME_OFFSET_MAX_KEY",
+	IDAlternateTimeOffsetProperties:   "ALTERNATE_TIME_OFFSET_PROPERTIES",
+	IDExternalPortConfigurationEnable: "EXTERNAL_PORT_CONFIGURATION_ENABLED",
+	IDMasterOnly:                      "MASTER_ONLY",
+	IDHoldoverUpgradeEnable:           "HOLDOVER_UPGRADE_ENABLE",
+	IDExtPortConfigPortDataSet:        "EXT_PORT_CONFIG_PORT_DATA_SET",
+	IDTransparentClockDefaultDataSet:  "TRANSPARENT_CLOCK_DEFAULT_DATA_SET",
+	IDTransparentClockPortDataSet:     "TRANSPARENT_CLOCK_PORT_DATA_SET",
+	IDPrimaryDomain:                   "PRIMARY_DOMAIN",
+	IDDelayMechanism:                  "DELAY_MECHANISM",
+	IDLogMinPdelayReqInterval:         "LOG_MIN_PDELAY_REQ_INTERVAL",
+	IDTimeStatusNP:                    "TIME_STATUS_NP",
+	IDPortPropertiesNP:                "PORT_PROPERTIES_NP",
+	IDPortStatsNP:                     "PORT_STATS_NP",
+	IDPortServiceStatsNP:              "PORT_SERVICE_STATS_NP",
+	IDUnicastMasterTableNP:            "UNICAST_MASTER_TABLE_NP",
+}
+
+func (m ManagementID) String() string {
+	if s, found := ManagementIDToString[m]; found {
+		return s
+	}
+	return fmt.Sprintf("0x%04X", uint16(m))
+}
+
 // ManagementTLV abstracts away any ManagementTLV
 type ManagementTLV interface {
 	TLV
@@ -56,128 +160,160 @@ type ManagementTLV interface {
 // MgmtTLVDecoderFunc is the function we use to decode management TLV from bytes
 type MgmtTLVDecoderFunc func(data []byte) (ManagementTLV, error)
 
+// fixedTLVDecoder returns decoder for management TLVs of fixed size, which are read as is
+func fixedTLVDecoder(newTLV func() ManagementTLV) MgmtTLVDecoderFunc {
+	return func(data []byte) (ManagementTLV, error) {
+		tlv := newTLV()
+		r := reader{b: data}
+		r.read("management TLV", tlv)
+		if r.err != nil {
+			return nil, r.err
+		}
+		return tlv, nil
+	}
+}
+
 // default decoders for TLVs we implemented ourselves
 var mgmtTLVDecoder = map[ManagementID]MgmtTLVDecoderFunc{
+	IDClockDescription: func(data []byte) (ManagementTLV, error) {
+		tlv := &ClockDescriptionTLV{}
+		if err := tlv.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return tlv, nil
+	},
+	IDUserDescription: func(data []byte) (ManagementTLV, error) {
+		tlv := &UserDescriptionTLV{}
+		if err := tlv.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return tlv, nil
+	},
+	// these carry no data, and are only acknowledged
+	IDNullPTPManagement:        fixedTLVDecoder(func() ManagementTLV { return &ManagementTLVHead{} }),
+	IDSaveInNonVolatileStorage: fixedTLVDecoder(func() ManagementTLV { return &ManagementTLVHead{} }),
+	IDResetNonVolatileStorage:  fixedTLVDecoder(func() ManagementTLV { return &ManagementTLVHead{} }),
+	IDFaultLogReset:            fixedTLVDecoder(func() ManagementTLV { return &ManagementTLVHead{} }),
+	IDEnablePort:               fixedTLVDecoder(func() ManagementTLV { return &ManagementTLVHead{} }),
+	IDDisablePort:              fixedTLVDecoder(func() ManagementTLV { return &ManagementTLVHead{} }),
+	IDTimePropertiesDataSet:    fixedTLVDecoder(func() ManagementTLV { return &TimePropertiesDataSetTLV{} }),
+	IDPortDataSet:              fixedTLVDecoder(func() ManagementTLV { return &PortDataSetTLV{} }),
+	IDPriority1:                fixedTLVDecoder(func() ManagementTLV { return &Priority1TLV{} }),
+	IDPriority2:                fixedTLVDecoder(func() ManagementTLV { return &Priority2TLV{} }),
+	IDDomain:                   fixedTLVDecoder(func() ManagementTLV { return &DomainTLV{} }),
+	IDSlaveOnly:                fixedTLVDecoder(func() ManagementTLV { return &SlaveOnlyTLV{} }),
+	IDLogAnnounceInterval:      fixedTLVDecoder(func() ManagementTLV { return &LogAnnounceIntervalTLV{} }),
+	IDAnnounceReceiptTimeout:   fixedTLVDecoder(func() ManagementTLV { return &AnnounceReceiptTimeoutTLV{} }),
+	IDLogSyncInterval:          fixedTLVDecoder(func() ManagementTLV { return &LogSyncIntervalTLV{} }),
+	IDVersionNumber:            fixedTLVDecoder(func() ManagementTLV { return &VersionNumberTLV{} }),
+	IDTime:                     fixedTLVDecoder(func() ManagementTLV { return &TimeTLV{} }),
+	IDUTCProperties:            fixedTLVDecoder(func() ManagementTLV { return &UTCPropertiesTLV{} }),
+	IDTraceabilityProperties:   fixedTLVDecoder(func() ManagementTLV { return &TraceabilityPropertiesTLV{} }),
+	IDTimescaleProperties:      fixedTLVDecoder(func() ManagementTLV { return &TimescalePropertiesTLV{} }),
+	IDDelayMechanism:           fixedTLVDecoder(func() ManagementTLV { return &DelayMechanismTLV{} }),
+	IDLogMinPdelayReqInterval:  fixedTLVDecoder(func() ManagementTLV { return &LogMinPdelayReqIntervalTLV{} }),
 	IDDefaultDataSet: func(data []byte) (ManagementTLV, error) {
-		r := bytes.NewReader(data)
+		r := reader{b: data}
 		tlv := &DefaultDataSetTLV{}
-		if err := binary.Read(r, binary.BigEndian, tlv); err != nil {
-			return nil, err
+		r.read("DefaultDataSet", tlv)
+		if r.err != nil {
+			return nil, r.err
 		}
 		return tlv, nil
 	},
 	IDCurrentDataSet: func(data []byte) (ManagementTLV, error) {
-		r := bytes.NewReader(data)
+		r := reader{b: data}
 		tlv := &CurrentDataSetTLV{}
-		if err := binary.Read(r, binary.BigEndian, tlv); err != nil {
-			return nil, err
+		r.read("CurrentDataSet", tlv)
+		if r.err != nil {
+			return nil, r.err
 		}
 		return tlv, nil
 	},
 	IDParentDataSet: func(data []byte) (ManagementTLV, error) {
-		r := bytes.NewReader(data)
+		r := reader{b: data}
 		tlv := &ParentDataSetTLV{}
-		if err := binary.Read(r, binary.BigEndian, tlv); err != nil {
-			return nil, err
+		r.read("ParentDataSet", tlv)
+		if r.err != nil {
+			return nil, r.err
 		}
 		return tlv, nil
 	},
 	IDPortStatsNP: func(data []byte) (ManagementTLV, error) {
-		r := bytes.NewReader(data)
+		r := reader{b: data}
 		tlv := &PortStatsNPTLV{}
-		if err := binary.Read(r, binary.BigEndian, &tlv.ManagementTLVHead); err != nil {
-			return nil, err
-		}
-		if err := binary.Read(r, binary.BigEndian, &tlv.PortIdentity); err != nil {
-			return nil, err
-		}
+		r.read("PortStatsNP ManagementTLVHead", &tlv.ManagementTLVHead)
+		r.read("PortStatsNP PortIdentity", &tlv.PortIdentity)
 		// fun part that cost me few hours, this is sent over wire as host endian (which typically is LittlEndian), while EVERYTHING ELSE is BigEndian.
-		if err := binary.Read(r, hostendian.Order, &tlv.PortStats); err != nil {
-			return nil, err
+		r.readOrder("PortStatsNP PortStats", hostendian.Order, &tlv.PortStats)
+		if r.err != nil {
+			return nil, r.err
 		}
 		return tlv, nil
 	},
 	IDTimeStatusNP: func(data []byte) (ManagementTLV, error) {
-		r := bytes.NewReader(data)
+		r := reader{b: data}
 		tlv := &TimeStatusNPTLV{}
-		if err := binary.Read(r, binary.BigEndian, tlv); err != nil {
-			return nil, err
+		r.read("TimeStatusNP", tlv)
+		if r.err != nil {
+			return nil, r.err
 		}
 		return tlv, nil
 	},
 	IDPortServiceStatsNP: func(data []byte) (ManagementTLV, error) {
-		r := bytes.NewReader(data)
+		r := reader{b: data}
 		tlv := &PortServiceStatsNPTLV{}
-		if err := binary.Read(r, binary.BigEndian, &tlv.ManagementTLVHead); err != nil {
-			return nil, err
-		}
-		if err := binary.Read(r, binary.BigEndian, &tlv.PortIdentity); err != nil {
-			return nil, err
-		}
+		r.read("PortServiceStatsNP ManagementTLVHead", &tlv.ManagementTLVHead)
+		r.read("PortServiceStatsNP PortIdentity", &tlv.PortIdentity)
 		// host endian, just like with PortStatsNP
-		if err := binary.Read(r, hostendian.Order, &tlv.PortServiceStats); err != nil {
-			return nil, err
+		r.readOrder("PortServiceStatsNP PortServiceStats", hostendian.Order, &tlv.PortServiceStats)
+		if r.err != nil {
+			return nil, r.err
 		}
 		return tlv, nil
 	},
 	IDPortPropertiesNP: func(data []byte) (ManagementTLV, error) {
-		r := bytes.NewReader(data)
+		r := reader{b: data}
 		tlv := &PortPropertiesNPTLV{}
-		if err := binary.Read(r, binary.BigEndian, &tlv.ManagementTLVHead); err != nil {
-			return nil, err
-		}
-		if err := binary.Read(r, binary.BigEndian, &tlv.PortIdentity); err != nil {
-			return nil, err
-		}
-		if err := binary.Read(r, binary.BigEndian, &tlv.PortState); err != nil {
-			return nil, err
-		}
-		if err := binary.Read(r, binary.BigEndian, &tlv.Timestamping); err != nil {
-			return nil, err
-		}
-		if r.Len() == 0 {
-			return nil, fmt.Errorf("not enough data to read PortPropertiesNP Interface")
-		}
-		if err := tlv.Interface.UnmarshalBinary(data[len(data)-r.Len():]); err != nil {
-			return nil, fmt.Errorf("reading PortPropertiesNP Interface: %w", err)
+		r.read("PortPropertiesNP ManagementTLVHead", &tlv.ManagementTLVHead)
+		r.read("PortPropertiesNP PortIdentity", &tlv.PortIdentity)
+		r.read("PortPropertiesNP PortState", &tlv.PortState)
+		r.read("PortPropertiesNP Timestamping", &tlv.Timestamping)
+		r.text("PortPropertiesNP Interface", &tlv.Interface)
+		if r.err != nil {
+			return nil, r.err
 		}
 		return tlv, nil
 	},
 	IDUnicastMasterTableNP: func(data []byte) (ManagementTLV, error) {
-		r := bytes.NewReader(data)
+		r := reader{b: data}
 		tlv := &UnicastMasterTableNPTLV{}
-
-		if err := binary.Read(r, binary.BigEndian, &tlv.ManagementTLVHead); err != nil {
-			return nil, err
+		r.read("UnicastMasterTableNP ManagementTLVHead", &tlv.ManagementTLVHead)
+		r.read("UnicastMasterTableNP ActualTableSize", &tlv.UnicastMasterTable.ActualTableSize)
+		if r.err != nil {
+			return nil, r.err
 		}
-		if err := binary.Read(r, binary.BigEndian, &tlv.UnicastMasterTable.ActualTableSize); err != nil {
-			return nil, err
+		// every entry takes at least 22 bytes, don't trust table size to preallocate
+		size := int(tlv.UnicastMasterTable.ActualTableSize)
+		if size*22 > r.len() {
+			return nil, fmt.Errorf("not enough data to read %d UnicastMasterTableNP entries from %d bytes", size, r.len())
 		}
-		tlv.UnicastMasterTable.UnicastMasters = make([]UnicastMasterEntry, int(tlv.UnicastMasterTable.ActualTableSize))
-		n := binary.Size(tlv.ManagementTLVHead) + binary.Size(tlv.UnicastMasterTable.ActualTableSize)
-		for i := 0; i < int(tlv.UnicastMasterTable.ActualTableSize); i++ {
-			entry := UnicastMasterEntry{}
-			if err := entry.UnmarshalBinary(data[n:]); err != nil {
+		tlv.UnicastMasterTable.UnicastMasters = make([]UnicastMasterEntry, size)
+		for i := range tlv.UnicastMasterTable.UnicastMasters {
+			if err := tlv.UnicastMasterTable.UnicastMasters[i].read(&r); err != nil {
 				return nil, err
 			}
-			tlv.UnicastMasterTable.UnicastMasters[i] = entry
-			n += 22 + len(entry.Address)
 		}
-
 		return tlv, nil
 	},
 	IDClockAccuracy: func(data []byte) (ManagementTLV, error) {
-		r := bytes.NewReader(data)
+		r := reader{b: data}
 		tlv := &ClockAccuracyTLV{}
-
-		if err := binary.Read(r, binary.BigEndian, &tlv.ManagementTLVHead); err != nil {
-			return nil, err
-		}
-		if err := binary.Read(r, binary.BigEndian, &tlv.ClockAccuracy); err != nil {
-			return nil, err
-		}
-		if err := binary.Read(r, binary.BigEndian, &tlv.Reserved); err != nil {
-			return nil, err
+		r.read("ClockAccuracy ManagementTLVHead", &tlv.ManagementTLVHead)
+		r.read("ClockAccuracy ClockAccuracy", &tlv.ClockAccuracy)
+		r.read("ClockAccuracy Reserved", &tlv.Reserved)
+		if r.err != nil {
+			return nil, r.err
 		}
 		return tlv, nil
 	},
@@ -229,6 +365,181 @@ type ParentDataSetTLV struct {
 	GrandmasterIdentity                   ClockIdentity
 }
 
+// flags of TIME_PROPERTIES_DATA_SET, UTC_PROPERTIES, TRACEABILITY_PROPERTIES and TIMESCALE_PROPERTIES management TLVs
+const (
+	TimeFlagLeap61 uint8 = 1 << iota
+	TimeFlagLeap59
+	TimeFlagCurrentUTCOffsetValid
+	TimeFlagPTPTimescale
+	TimeFlagTimeTraceable
+	TimeFlagFrequencyTraceable
+)
+
+// TimePropertiesDataSetTLV is TIME_PROPERTIES_DATA_SET management TLV data field
+type TimePropertiesDataSetTLV struct {
+	ManagementTLVHead
+
+	CurrentUTCOffset int16
+	Flags            uint8
+	TimeSource       TimeSource
+}
+
+// DelayMechanism is a enum describing how port measures path delay
+type DelayMechanism uint8
+
+// Table 21 delayMechanism enumeration
+const (
+	DelayMechanismE2E         DelayMechanism = 0x01
+	DelayMechanismP2P         DelayMechanism = 0x02
+	DelayMechanismCommonP2P   DelayMechanism = 0x03
+	DelayMechanismSpecial     DelayMechanism = 0x04
+	DelayMechanismNoMechanism DelayMechanism = 0xFE
+)
+
+// DelayMechanismToString is a map from DelayMechanism to string
+var DelayMechanismToString = map[DelayMechanism]string{
+	DelayMechanismE2E:         "E2E",
+	DelayMechanismP2P:         "P2P",
+	DelayMechanismCommonP2P:   "COMMON_P2P",
+	DelayMechanismSpecial:     "SPECIAL",
+	DelayMechanismNoMechanism: "NO_MECHANISM",
+}
+
+func (d DelayMechanism) String() string {
+	return DelayMechanismToString[d]
+}
+
+// PortDataSetTLV is PORT_DATA_SET management TLV data field
+type PortDataSetTLV struct {
+	ManagementTLVHead
+
+	PortIdentity            PortIdentity
+	PortState               PortState
+	LogMinDelayReqInterval  LogInterval
+	PeerMeanPathDelay       TimeInterval
+	LogAnnounceInterval     LogInterval
+	AnnounceReceiptTimeout  uint8
+	LogSyncInterval         LogInterval
+	DelayMechanism          DelayMechanism
+	LogMinPdelayReqInterval LogInterval
+	// lower 4 bits are versionNumber
+	VersionNumber uint8
+}
+
+// Priority1TLV is PRIORITY1 management TLV data field
+type Priority1TLV struct {
+	ManagementTLVHead
+
+	Priority1 uint8
+	Reserved  uint8
+}
+
+// Priority2TLV is PRIORITY2 management TLV data field
+type Priority2TLV struct {
+	ManagementTLVHead
+
+	Priority2 uint8
+	Reserved  uint8
+}
+
+// DomainTLV is DOMAIN management TLV data field
+type DomainTLV struct {
+	ManagementTLVHead
+
+	DomainNumber uint8
+	Reserved     uint8
+}
+
+// SlaveOnlyTLV is SLAVE_ONLY management TLV data field
+type SlaveOnlyTLV struct {
+	ManagementTLVHead
+
+	// bit 0 is slaveOnly
+	SO       uint8
+	Reserved uint8
+}
+
+// LogAnnounceIntervalTLV is LOG_ANNOUNCE_INTERVAL management TLV data field
+type LogAnnounceIntervalTLV struct {
+	ManagementTLVHead
+
+	LogAnnounceInterval LogInterval
+	Reserved            uint8
+}
+
+// AnnounceReceiptTimeoutTLV is ANNOUNCE_RECEIPT_TIMEOUT management TLV data field
+type AnnounceReceiptTimeoutTLV struct {
+	ManagementTLVHead
+
+	AnnounceReceiptTimeout uint8
+	Reserved               uint8
+}
+
+// LogSyncIntervalTLV is LOG_SYNC_INTERVAL management TLV data field
+type LogSyncIntervalTLV struct {
+	ManagementTLVHead
+
+	LogSyncInterval LogInterval
+	Reserved        uint8
+}
+
+// VersionNumberTLV is VERSION_NUMBER management TLV data field
+type VersionNumberTLV struct {
+	ManagementTLVHead
+
+	// lower 4 bits are versionNumber
+	VersionNumber uint8
+	Reserved      uint8
+}
+
+// TimeTLV is TIME management TLV data field
+type TimeTLV struct {
+	ManagementTLVHead
+
+	CurrentTime Timestamp
+}
+
+// UTCPropertiesTLV is UTC_PROPERTIES management TLV data field, only leap and currentUtcOffsetValid flags are used
+type UTCPropertiesTLV struct {
+	ManagementTLVHead
+
+	CurrentUTCOffset int16
+	Flags            uint8
+	Reserved         uint8
+}
+
+// TraceabilityPropertiesTLV is TRACEABILITY_PROPERTIES management TLV data field, only traceability flags are used
+type TraceabilityPropertiesTLV struct {
+	ManagementTLVHead
+
+	Flags    uint8
+	Reserved uint8
+}
+
+// TimescalePropertiesTLV is TIMESCALE_PROPERTIES management TLV data field, only ptpTimescale flag is used
+type TimescalePropertiesTLV struct {
+	ManagementTLVHead
+
+	Flags      uint8
+	TimeSource TimeSource
+}
+
+// DelayMechanismTLV is DELAY_MECHANISM management TLV data field
+type DelayMechanismTLV struct {
+	ManagementTLVHead
+
+	DelayMechanism DelayMechanism
+	Reserved       uint8
+}
+
+// LogMinPdelayReqIntervalTLV is LOG_MIN_PDELAY_REQ_INTERVAL management TLV data field
+type LogMinPdelayReqIntervalTLV struct {
+	ManagementTLVHead
+
+	LogMinPdelayReqInterval LogInterval
+	Reserved                uint8
+}
+
 // ClockAccuracyTLV is a TLV containing Clock Accuracy
 type ClockAccuracyTLV struct {
 	ManagementTLVHead
@@ -17,7 +17,9 @@ limitations under the License.
 package protocol
 
 import (
+	"encoding/binary"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -243,3 +245,112 @@ func TestParseClockAccuracy(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, raw, b)
 }
+
+func TestManagementIDString(t *testing.T) {
+	require.Equal(t, "TIME_PROPERTIES_DATA_SET", IDTimePropertiesDataSet.String())
+	require.Equal(t, "PORT_STATS_NP", IDPortStatsNP.String())
+	require.Equal(t, "0xDFFF", ManagementID(0xDFFF).String())
+}
+
+func TestParseTimePropertiesDataSet(t *testing.T) {
+	req, err := NewManagementRequest(RESPONSE, IDTimePropertiesDataSet, &TimePropertiesDataSetTLV{})
+	require.NoError(t, err)
+	head, err := Bytes(&Management{ManagementMsgHead: req.ManagementMsgHead, TLV: &ManagementTLVHead{}})
+	require.NoError(t, err)
+	raw := append(head[:binary.Size(ManagementMsgHead{})],
+		0x00, 0x01, 0x00, 0x06, 0x20, 0x03, // TLV head
+		0x00, 0x25, // currentUtcOffset
+		0x3c, // flags
+		0x20, // timeSource
+	)
+	packet := new(Management)
+	require.NoError(t, FromBytes(raw, packet))
+	want := &TimePropertiesDataSetTLV{
+		ManagementTLVHead: ManagementTLVHead{
+			TLVHead: TLVHead{
+				TLVType:     TLVManagement,
+				LengthField: 6,
+			},
+			ManagementID: IDTimePropertiesDataSet,
+		},
+		CurrentUTCOffset: 37,
+		Flags:            TimeFlagCurrentUTCOffsetValid | TimeFlagPTPTimescale | TimeFlagTimeTraceable | TimeFlagFrequencyTraceable,
+		TimeSource:       TimeSourceGNSS,
+	}
+	require.Equal(t, want, packet.TLV)
+	require.Equal(t, uint16(len(raw)), req.MessageLength)
+	b, err := packet.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, raw, b)
+}
+
+func TestManagementTLVsRoundTrip(t *testing.T) {
+	testCases := []struct {
+		id     ManagementID
+		tlv    ManagementTLV
+		length uint16
+	}{
+		{IDPortDataSet, &PortDataSetTLV{
+			PortIdentity:            PortIdentity{ClockIdentity: 5212879185253000328, PortNumber: 1},
+			PortState:               PortStateSlave,
+			LogMinDelayReqInterval:  -4,
+			PeerMeanPathDelay:       NewTimeInterval(1234.5),
+			LogAnnounceInterval:     1,
+			AnnounceReceiptTimeout:  3,
+			LogSyncInterval:         -4,
+			DelayMechanism:          DelayMechanismE2E,
+			LogMinPdelayReqInterval: 0,
+			VersionNumber:           2,
+		}, 28},
+		{IDPriority1, &Priority1TLV{Priority1: 128}, 4},
+		{IDPriority2, &Priority2TLV{Priority2: 127}, 4},
+		{IDDomain, &DomainTLV{DomainNumber: 24}, 4},
+		{IDSlaveOnly, &SlaveOnlyTLV{SO: 1}, 4},
+		{IDLogAnnounceInterval, &LogAnnounceIntervalTLV{LogAnnounceInterval: -3}, 4},
+		{IDAnnounceReceiptTimeout, &AnnounceReceiptTimeoutTLV{AnnounceReceiptTimeout: 3}, 4},
+		{IDLogSyncInterval, &LogSyncIntervalTLV{LogSyncInterval: -7}, 4},
+		{IDVersionNumber, &VersionNumberTLV{VersionNumber: 2}, 4},
+		{IDTime, &TimeTLV{CurrentTime: NewTimestamp(time.Unix(1700000000, 42))}, 12},
+		{IDUTCProperties, &UTCPropertiesTLV{CurrentUTCOffset: 37, Flags: TimeFlagCurrentUTCOffsetValid | TimeFlagLeap61}, 6},
+		{IDTraceabilityProperties, &TraceabilityPropertiesTLV{Flags: TimeFlagTimeTraceable}, 4},
+		{IDTimescaleProperties, &TimescalePropertiesTLV{Flags: TimeFlagPTPTimescale, TimeSource: TimeSourceGNSS}, 4},
+		{IDDelayMechanism, &DelayMechanismTLV{DelayMechanism: DelayMechanismP2P}, 4},
+		{IDLogMinPdelayReqInterval, &LogMinPdelayReqIntervalTLV{LogMinPdelayReqInterval: -2}, 4},
+		{IDEnablePort, nil, 2},
+		{IDClockDescription, &ClockDescriptionTLV{ClockType: ClockTypeOrdinary, PhysicalLayerProtocol: "IEEE 802.3"}, 34},
+		{IDUserDescription, &UserDescriptionTLV{UserDescription: "gm1;rack2"}, 12},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.id.String(), func(t *testing.T) {
+			req, err := NewManagementRequest(SET, tc.id, tc.tlv)
+			require.NoError(t, err)
+			b, err := req.MarshalBinary()
+			require.NoError(t, err)
+			require.Equal(t, int(req.MessageLength), len(b))
+			// raw LengthField
+			require.Equal(t, tc.length, binary.BigEndian.Uint16(b[binary.Size(ManagementMsgHead{})+2:]))
+
+			packet := new(Management)
+			require.NoError(t, FromBytes(b, packet))
+			require.Equal(t, SET, packet.Action())
+			require.Equal(t, tc.id, packet.TLV.MgmtID())
+			if tc.tlv != nil {
+				if _, variable := tc.tlv.(interface{ MarshalBinary() ([]byte, error) }); !variable {
+					require.Equal(t, tc.tlv, packet.TLV)
+				}
+			}
+			got, err := packet.MarshalBinary()
+			require.NoError(t, err)
+			require.Equal(t, b, got)
+		})
+	}
+}
+
+func TestNewManagementRequestGet(t *testing.T) {
+	req, err := NewManagementRequest(GET, IDPortDataSet, nil)
+	require.NoError(t, err)
+	require.Equal(t, GET, req.Action())
+	require.Equal(t, IDPortDataSet, req.TLV.MgmtID())
+	require.Equal(t, uint16(binary.Size(ManagementMsgHead{})+binary.Size(ManagementTLVHead{})), req.MessageLength)
+	require.Equal(t, DefaultTargetPortIdentity, req.TargetPortIdentity)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+// Path trace mechanism as defined in IEEE 1588-2019, 16.2.
+// Each boundary clock appends its clockIdentity to the PATH_TRACE TLV of Announces it sends,
+// so a clock can tell that an Announce went through itself and drop it instead of forming a timing loop.
+
+// NewPathTraceTLV returns PATH_TRACE TLV with the path sequence and matching length
+func NewPathTraceTLV(path []ClockIdentity) *PathTraceTLV {
+	return &PathTraceTLV{
+		TLVHead:      TLVHead{TLVType: TLVPathTrace, LengthField: uint16(8 * len(path))},
+		PathSequence: path,
+	}
+}
+
+// pathTraceTLV returns PATH_TRACE TLV of the Announce, nil if there is none
+func (p *Announce) pathTraceTLV() *PathTraceTLV {
+	for _, tlv := range p.TLVs {
+		if t, ok := tlv.(*PathTraceTLV); ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// PathTrace returns path sequence Announce went through, nil if Announce has no PATH_TRACE TLV
+func (p *Announce) PathTrace() []ClockIdentity {
+	t := p.pathTraceTLV()
+	if t == nil {
+		return nil
+	}
+	return t.PathSequence
+}
+
+// AppendPathTrace adds clock identity to the path sequence of the Announce, adding PATH_TRACE TLV if needed.
+// Message length is updated to account for the extra bytes
+func (p *Announce) AppendPathTrace(id ClockIdentity) {
+	t := p.pathTraceTLV()
+	if t == nil {
+		t = NewPathTraceTLV(nil)
+		p.TLVs = append(p.TLVs, t)
+		p.MessageLength += tlvHeadSize
+	}
+	t.PathSequence = append(t.PathSequence, id)
+	t.LengthField += 8
+	p.MessageLength += 8
+}
+
+// PathTraceLoop checks the path sequence for a loop: our own clock identity,
+// or any clock identity which appears more than once. It returns the identity forming the loop
+func PathTraceLoop(self ClockIdentity, path []ClockIdentity) (ClockIdentity, bool) {
+	seen := make(map[ClockIdentity]bool, len(path))
+	for _, id := range path {
+		if id == self || seen[id] {
+			return id, true
+		}
+		seen[id] = true
+	}
+	return 0, false
+}
+
+// DropPathTraceLoops returns Announces whose path trace doesn't form a loop, in the same order.
+// Announces without PATH_TRACE TLV are kept
+func DropPathTraceLoops(self ClockIdentity, announces []*Announce) []*Announce {
+	kept := make([]*Announce, 0, len(announces))
+	for _, a := range announces {
+		if _, loop := PathTraceLoop(self, a.PathTrace()); loop {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
@@ -0,0 +1,79 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPathTraceTLV(t *testing.T) {
+	tlv := NewPathTraceTLV([]ClockIdentity{1, 2})
+	require.Equal(t, TLVPathTrace, tlv.TLVType)
+	require.Equal(t, uint16(16), tlv.LengthField)
+}
+
+func TestAnnounceAppendPathTrace(t *testing.T) {
+	a := testForeignAnnounce(1, 1, 0)
+	a.MessageLength = headerSize + 30
+	a.Version = Version
+	require.Nil(t, a.PathTrace())
+
+	a.AppendPathTrace(0x42)
+	a.AppendPathTrace(0x43)
+	require.Equal(t, []ClockIdentity{0x42, 0x43}, a.PathTrace())
+	require.Len(t, a.TLVs, 1)
+	require.Equal(t, uint16(headerSize+30+tlvHeadSize+16), a.MessageLength)
+
+	b, err := a.MarshalBinary()
+	require.NoError(t, err)
+	require.Len(t, b, int(a.MessageLength))
+	got := &Announce{}
+	require.NoError(t, got.UnmarshalBinary(b))
+	require.Equal(t, a, got)
+}
+
+func TestPathTraceLoop(t *testing.T) {
+	_, loop := PathTraceLoop(1, nil)
+	require.False(t, loop)
+	_, loop = PathTraceLoop(1, []ClockIdentity{2, 3})
+	require.False(t, loop)
+	id, loop := PathTraceLoop(1, []ClockIdentity{2, 1, 3})
+	require.True(t, loop)
+	require.Equal(t, ClockIdentity(1), id)
+	id, loop = PathTraceLoop(1, []ClockIdentity{2, 3, 2})
+	require.True(t, loop)
+	require.Equal(t, ClockIdentity(2), id)
+}
+
+func TestDropPathTraceLoops(t *testing.T) {
+	noTrace := testForeignAnnounce(2, 1, 0)
+	clean := testForeignAnnounce(3, 1, 0)
+	clean.AppendPathTrace(3)
+	clean.AppendPathTrace(4)
+	throughUs := testForeignAnnounce(5, 1, 0)
+	throughUs.AppendPathTrace(5)
+	throughUs.AppendPathTrace(1)
+	repeated := testForeignAnnounce(6, 1, 0)
+	repeated.AppendPathTrace(6)
+	repeated.AppendPathTrace(7)
+	repeated.AppendPathTrace(6)
+
+	kept := DropPathTraceLoops(1, []*Announce{noTrace, throughUs, clean, repeated})
+	require.Equal(t, []*Announce{noTrace, clean}, kept)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile is a PTP profile: a set of attribute values and options selected for particular application
+type Profile uint8
+
+// Supported profiles
+const (
+	// ProfileDefault is IEEE 1588-2019 default delay request-response profile, Annex I.3
+	ProfileDefault Profile = iota
+	// ProfileG8275_1 is ITU-T G.8275.1 telecom profile with full timing support from the network
+	ProfileG8275_1
+	// ProfileG8275_2 is ITU-T G.8275.2 telecom profile with partial timing support from the network, over unicast IP
+	ProfileG8275_2
+	// ProfileSMPTE is SMPTE ST 2059-2 profile for professional broadcast
+	ProfileSMPTE
+)
+
+// ProfileToString is a map from Profile to string
+var ProfileToString = map[Profile]string{
+	ProfileDefault: "default",
+	ProfileG8275_1: "g8275.1",
+	ProfileG8275_2: "g8275.2",
+	ProfileSMPTE:   "smpte2059",
+}
+
+func (p Profile) String() string {
+	return ProfileToString[p]
+}
+
+// ProfileFromString returns Profile from its name, case insensitive
+func ProfileFromString(name string) (Profile, error) {
+	for p, s := range ProfileToString {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	return ProfileDefault, fmt.Errorf("unknown PTP profile %q", name)
+}
+
+// ProfilePreset holds defaults and ranges of attributes the profile mandates
+type ProfilePreset struct {
+	// domain numbers allowed by the profile, inclusive
+	DefaultDomain uint8
+	MinDomain     uint8
+	MaxDomain     uint8
+	// default message rates
+	LogAnnounceInterval    LogInterval
+	LogSyncInterval        LogInterval
+	LogMinDelayReqInterval LogInterval
+	// how many announce intervals pass before announce receipt timeout
+	AnnounceReceiptTimeout uint8
+	// Priority1 is ignored by BMCA and clocks use localPriority instead
+	LocalPriority bool
+}
+
+// profilePresets are taken from the profile specifications
+var profilePresets = map[Profile]ProfilePreset{
+	ProfileDefault: {
+		DefaultDomain:          0,
+		MinDomain:              0,
+		MaxDomain:              127,
+		LogAnnounceInterval:    1,
+		LogSyncInterval:        0,
+		LogMinDelayReqInterval: 0,
+		AnnounceReceiptTimeout: 3,
+	},
+	ProfileG8275_1: {
+		DefaultDomain:          24,
+		MinDomain:              24,
+		MaxDomain:              43,
+		LogAnnounceInterval:    -3,
+		LogSyncInterval:        -4,
+		LogMinDelayReqInterval: -4,
+		AnnounceReceiptTimeout: 3,
+		LocalPriority:          true,
+	},
+	ProfileG8275_2: {
+		DefaultDomain:          44,
+		MinDomain:              44,
+		MaxDomain:              63,
+		LogAnnounceInterval:    0,
+		LogSyncInterval:        -4,
+		LogMinDelayReqInterval: -4,
+		AnnounceReceiptTimeout: 3,
+		LocalPriority:          true,
+	},
+	ProfileSMPTE: {
+		DefaultDomain:          127,
+		MinDomain:              0,
+		MaxDomain:              127,
+		LogAnnounceInterval:    -2,
+		LogSyncInterval:        -3,
+		LogMinDelayReqInterval: -3,
+		AnnounceReceiptTimeout: 3,
+	},
+}
+
+// Preset returns defaults and ranges of attributes of the profile
+func (p Profile) Preset() ProfilePreset {
+	return profilePresets[p]
+}
+
+// DomainAllowed reports if domain number is within the range of the profile
+func (p ProfilePreset) DomainAllowed(domain uint8) bool {
+	return domain >= p.MinDomain && domain <= p.MaxDomain
+}
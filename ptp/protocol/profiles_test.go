@@ -0,0 +1,54 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileFromString(t *testing.T) {
+	for p, name := range ProfileToString {
+		got, err := ProfileFromString(name)
+		require.NoError(t, err)
+		require.Equal(t, p, got)
+		require.Equal(t, name, p.String())
+	}
+	p, err := ProfileFromString("G8275.2")
+	require.NoError(t, err)
+	require.Equal(t, ProfileG8275_2, p)
+	_, err = ProfileFromString("enterprise")
+	require.Error(t, err)
+}
+
+func TestProfilePreset(t *testing.T) {
+	for p := range ProfileToString {
+		preset := p.Preset()
+		require.True(t, preset.DomainAllowed(preset.DefaultDomain), "default domain of %s is within its range", p)
+		require.NotZero(t, preset.AnnounceReceiptTimeout)
+	}
+	g8275 := ProfileG8275_1.Preset()
+	require.True(t, g8275.LocalPriority)
+	require.Equal(t, uint8(24), g8275.DefaultDomain)
+	require.False(t, g8275.DomainAllowed(0))
+	require.False(t, g8275.DomainAllowed(44))
+	require.Equal(t, time.Second/16, g8275.LogSyncInterval.Duration())
+	require.False(t, ProfileDefault.Preset().LocalPriority)
+	require.Equal(t, 2*time.Second, ProfileDefault.Preset().LogAnnounceInterval.Duration())
+}
@@ -74,8 +74,10 @@ type Header struct {
 const headerSize = 34 // bytes
 
 // unmarshalHeader is not a Header.UnmarshalBinary to prevent all packets
-// from having default (and incomplete) UnmarshalBinary implementation through embedding
+// from having default (and incomplete) UnmarshalBinary implementation through embedding.
+// It's on the hot path, so it indexes b directly and callers must make sure b holds at least headerSize bytes
 func unmarshalHeader(p *Header, b []byte) {
+	_ = b[headerSize-1]
 	p.SdoIDAndMsgType = SdoIDAndMsgType(b[0])
 	p.Version = b[1]
 	p.MessageLength = binary.BigEndian.Uint16(b[2:])
@@ -91,6 +93,16 @@ func unmarshalHeader(p *Header, b []byte) {
 	p.LogMessageInterval = LogInterval(b[33])
 }
 
+// MajorVersionPTP returns versionPTP, which is lower 4 bits of version field
+func (p *Header) MajorVersionPTP() uint8 {
+	return p.Version & MajorVersionMask
+}
+
+// MinorVersionPTP returns minorVersionPTP, which is upper 4 bits of version field. It's 1 for PTPv2.1 and 0 for PTPv2.0
+func (p *Header) MinorVersionPTP() uint8 {
+	return p.Version >> 4
+}
+
 // MessageType returns MessageType
 func (p *Header) MessageType() MessageType {
 	return p.SdoIDAndMsgType.MsgType()
@@ -196,6 +208,7 @@ func (p *Announce) MarshalBinaryTo(b []byte) (int, error) {
 
 // UnmarshalBinary unmarshals bytes to Announce
 func (p *Announce) UnmarshalBinary(b []byte) error {
+	// fixed part is checked once and read directly, only TLVs go through reader
 	if len(b) < headerSize+30 {
 		return fmt.Errorf("not enough data to decode Announce")
 	}
@@ -217,18 +230,15 @@ func (p *Announce) UnmarshalBinary(b []byte) error {
 	p.StepsRemoved = binary.BigEndian.Uint16(b[n+27:])
 	p.TimeSource = TimeSource(b[n+29])
 	pos := n + 30
-	// unmarshal TLVs if present
+	// unmarshal TLVs if present, reusing TLVs slice of previously decoded packet
 	var err error
-	p.TLVs, err = readTLVs(p.TLVs, int(p.MessageLength)-pos, b[pos:])
-	if err != nil {
-		return err
-	}
-	return nil
+	p.TLVs, err = readTLVs(p.TLVs[:0], int(p.MessageLength)-pos, reader{b: b[pos:]})
+	return err
 }
 
 // MarshalBinary converts packet to []bytes
 func (p *Announce) MarshalBinary() ([]byte, error) {
-	buf := make([]byte, 508)
+	buf := make([]byte, marshalBufferSize(headerSize+30, p.TLVs))
 	n, err := p.MarshalBinaryTo(buf)
 	return buf[:n], err
 }
@@ -462,12 +472,10 @@ func FromBytes(rawBytes []byte, p Packet) error {
 // It can be used for easy integration with anything that provides UDP packet payload as bytes.
 // Resulting Packet user can then either switch based on MessageType(), or just with type switch.
 func DecodePacket(b []byte) (Packet, error) {
-	r := bytes.NewReader(b)
-	head := &Header{}
-	if err := binary.Read(r, binary.BigEndian, head); err != nil {
-		return nil, err
+	if len(b) < headerSize {
+		return nil, fmt.Errorf("not enough data to decode Header")
 	}
-	msgType := head.MessageType()
+	msgType := SdoIDAndMsgType(b[0]).MsgType()
 	var p Packet
 	switch msgType {
 	case MessageSync, MessageDelayReq:
@@ -497,3 +505,48 @@ func DecodePacket(b []byte) (Packet, error) {
 	}
 	return p, nil
 }
+
+// Decoder decodes packets of hot message types (Sync, DelayReq, FollowUp, DelayResp, Announce and Signaling)
+// into packets it owns, so that high rate receive paths don't allocate per packet.
+// Returned Packet is only valid until the next Decode call, and Decoder must not be used concurrently.
+// Other message types are decoded with DecodePacket.
+type Decoder struct {
+	syncDelayReq SyncDelayReq
+	followUp     FollowUp
+	delayResp    DelayResp
+	announce     Announce
+	signaling    Signaling
+}
+
+// Decode decodes []byte into one of Decoder's packets
+func (d *Decoder) Decode(b []byte) (Packet, error) {
+	msgType, err := ProbeMsgType(b)
+	if err != nil {
+		return nil, err
+	}
+	var p unmarshalerPacket
+	switch msgType {
+	case MessageSync, MessageDelayReq:
+		p = &d.syncDelayReq
+	case MessageFollowUp:
+		p = &d.followUp
+	case MessageDelayResp:
+		p = &d.delayResp
+	case MessageAnnounce:
+		p = &d.announce
+	case MessageSignaling:
+		p = &d.signaling
+	default:
+		return DecodePacket(b)
+	}
+	if err := p.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// unmarshalerPacket is a Packet which can unmarshal itself from []byte in place
+type unmarshalerPacket interface {
+	Packet
+	UnmarshalBinary([]byte) error
+}
@@ -18,6 +18,7 @@ package protocol
 
 import (
 	"encoding/binary"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -321,6 +322,129 @@ func TestParseDelayResp(t *testing.T) {
 	assert.Equal(t, &want, pp)
 }
 
+// raw packets shared by zero-allocation tests and benchmarks
+var (
+	rawSync = []uint8{
+		0x10, 0x02, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x80, 0x63, 0xff,
+		0xff, 0x00, 0x09, 0xba, 0x00, 0x01, 0x00, 0x74,
+		0x00, 0x00, 0x00, 0x00, 0x45, 0xb1, 0x11, 0x5a,
+		0x0a, 0x64, 0xfa, 0xb0, 0x00, 0x00,
+	}
+	rawDelayReq = []uint8{
+		0x11, 0x02, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x80, 0x63, 0xff,
+		0xff, 0x00, 0x09, 0xba, 0x00, 0x01, 0x00, 0x74,
+		0x01, 0x7f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	rawAnnouncePathTrace = []uint8("\x0b\x12\x00\x4c\x00\x00\x04\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x08\xc0\xeb\xff\xfe\x63\x7a\x4e\x00\x01\x00\x00\x05\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x25\x00\x80\xf8\xfe\xff\xff\x80\x08\xc0\xeb\xff\xfe\x63\x7a\x4e\x00\x00\xa0\x00\x08\x00\x08\x08\xc0\xeb\xff\xfe\x63\x7a\x4e\x00\x00")
+)
+
+func TestZeroAllocs(t *testing.T) {
+	sync := &SyncDelayReq{}
+	require.NoError(t, sync.UnmarshalBinary(rawSync))
+	announce := &Announce{}
+	require.NoError(t, announce.UnmarshalBinary(rawAnnouncePathTrace))
+	announce.TLVs = nil
+	buf := make([]byte, 508)
+
+	tests := []struct {
+		name string
+		f    func()
+	}{
+		{name: "read sync", f: func() { _ = sync.UnmarshalBinary(rawSync) }},
+		{name: "read delay req", f: func() { _ = sync.UnmarshalBinary(rawDelayReq) }},
+		{name: "write sync", f: func() { _, _ = BytesTo(sync, buf) }},
+		{name: "write announce", f: func() { _, _ = BytesTo(announce, buf) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, float64(0), testing.AllocsPerRun(100, tt.f))
+		})
+	}
+}
+
+func TestUnmarshalShort(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet unmarshalerPacket
+		seed   []byte
+	}{
+		{name: "sync", packet: &SyncDelayReq{}, seed: seedSync(t)},
+		{name: "follow up", packet: &FollowUp{}, seed: seedFollowUp(t)},
+		{name: "delay resp", packet: &DelayResp{}, seed: seedDelayResp(t)},
+		{name: "announce", packet: &Announce{}, seed: seedAnnounce(t)},
+		{name: "signaling", packet: &Signaling{}, seed: seedSignaling(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.packet.UnmarshalBinary(tt.seed))
+			for n := 0; n < len(tt.seed); n++ {
+				require.Error(t, tt.packet.UnmarshalBinary(tt.seed[:n]), n)
+			}
+			// messageLength past the data
+			b := append([]byte{}, tt.seed...)
+			binary.BigEndian.PutUint16(b[2:], uint16(len(b)+1))
+			require.EqualError(t, tt.packet.UnmarshalBinary(b), fmt.Sprintf("cannot decode message of length %d from %d bytes", len(b)+1, len(b)))
+		})
+	}
+}
+
+func TestAnnounceUnmarshalReusesTLVs(t *testing.T) {
+	p := &Announce{}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.UnmarshalBinary(rawAnnouncePathTrace))
+		require.Len(t, p.TLVs, 1)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	d := &Decoder{}
+	p, err := d.Decode(rawSync)
+	require.NoError(t, err)
+	sync, ok := p.(*SyncDelayReq)
+	require.True(t, ok)
+	require.Equal(t, MessageSync, sync.MessageType())
+	require.Equal(t, uint16(116), sync.SequenceID)
+
+	// same packet is reused
+	p, err = d.Decode(rawDelayReq)
+	require.NoError(t, err)
+	require.Same(t, sync, p)
+	require.Equal(t, MessageDelayReq, p.MessageType())
+
+	p, err = d.Decode(rawAnnouncePathTrace)
+	require.NoError(t, err)
+	announce, ok := p.(*Announce)
+	require.True(t, ok)
+	require.Len(t, announce.TLVs, 1)
+
+	want, err := DecodePacket(rawAnnouncePathTrace)
+	require.NoError(t, err)
+	require.Equal(t, want, p)
+
+	// not a hot message type, decoded as usual
+	pdelayReq := &PDelayReq{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessagePDelayReq, 0),
+			MessageLength:   uint16(binary.Size(PDelayReq{})),
+		},
+	}
+	raw, err := Bytes(pdelayReq)
+	require.NoError(t, err)
+	p, err = d.Decode(raw)
+	require.NoError(t, err)
+	require.Equal(t, pdelayReq, p)
+
+	_, err = d.Decode([]byte{})
+	require.Error(t, err)
+	_, err = d.Decode(rawSync[:10])
+	require.Error(t, err)
+}
+
 func BenchmarkReadSyncDelay(b *testing.B) {
 	raw := []uint8{
 		0x12, 0x02, 0x00, 0x36, 0x00, 0x00, 0x00, 0x00,
@@ -460,6 +584,19 @@ func BenchmarkWriteFollowup(b *testing.B) {
 	}
 }
 
+func BenchmarkDecodePacket(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		_, _ = DecodePacket(rawSync)
+	}
+}
+
+func BenchmarkDecoderDecode(b *testing.B) {
+	d := &Decoder{}
+	for n := 0; n < b.N; n++ {
+		_, _ = d.Decode(rawSync)
+	}
+}
+
 func FuzzDecodePacket(f *testing.F) {
 	delayResp := []uint8{
 		0x9, 0x2, 0x0, 0x36, 0x0, 0x0, 0x4, 0x0, 0x0,
@@ -496,7 +633,7 @@ func FuzzDecodePacket(f *testing.F) {
 		0x00, 0x08, 0x00, 0x06, 0x20, 0x01, 0x00, 0x00, 0x00, 0x00,
 		0x00, 0x00,
 	}
-	for _, seed := range [][]byte{{}, {0}, {9}, delayResp, managementDefaultDataSet, signalingGrantUnicast, managementErrorStatus} {
+	for _, seed := range append([][]byte{{}, {0}, {9}, delayResp, managementDefaultDataSet, signalingGrantUnicast, managementErrorStatus}, seedDescriptions(f)...) {
 		f.Add(seed)
 	}
 	f.Fuzz(func(t *testing.T, b []byte) {
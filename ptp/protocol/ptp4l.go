@@ -214,35 +214,36 @@ type UnicastMasterEntry struct {
 
 // UnmarshalBinary implements Unmarshaller interface
 func (e *UnicastMasterEntry) UnmarshalBinary(b []byte) error {
-	var err error
-	if len(b) < 26 { // 22 byte for struct, at least 4 for address)
-		return fmt.Errorf("not enough data to decode UnicastMasterEntry")
-	}
-	e.PortIdentity.ClockIdentity = ClockIdentity(binary.BigEndian.Uint64(b[0:]))
-	e.PortIdentity.PortNumber = binary.BigEndian.Uint16(b[8:])
-	e.ClockQuality.ClockClass = ClockClass(b[10])
-	e.ClockQuality.ClockAccuracy = ClockAccuracy(b[11])
-	e.ClockQuality.OffsetScaledLogVariance = binary.BigEndian.Uint16(b[12:])
-	if b[14] == 0 {
-		e.Selected = false
-	} else if b[14] == 1 {
-		e.Selected = true
-	} else {
-		return fmt.Errorf("unexpected 'selected' value %d", b[14])
-	}
-	e.PortState = UnicastMasterState(b[15])
-	e.Priority1 = b[16]
-	e.Priority2 = b[17]
+	r := reader{b: b}
+	return e.read(&r)
+}
 
+// read decodes UnicastMasterEntry, leaving reader right after it
+func (e *UnicastMasterEntry) read(r *reader) error {
+	r.portIdentity("UnicastMasterEntry PortIdentity", &e.PortIdentity)
+	r.clockQuality("UnicastMasterEntry ClockQuality", &e.ClockQuality)
+	selected := r.uint8("UnicastMasterEntry Selected")
+	e.PortState = UnicastMasterState(r.uint8("UnicastMasterEntry PortState"))
+	e.Priority1 = r.uint8("UnicastMasterEntry Priority1")
+	e.Priority2 = r.uint8("UnicastMasterEntry Priority2")
 	pa := &PortAddress{}
-	if err := pa.UnmarshalBinary(b[18:]); err != nil {
-		return err
+	pa.NetworkProtocol = TransportType(r.uint16("UnicastMasterEntry NetworkProtocol"))
+	pa.AddressLength = r.uint16("UnicastMasterEntry AddressLength")
+	pa.AddressField = r.bytes("UnicastMasterEntry AddressField", int(pa.AddressLength))
+	if r.err != nil {
+		return r.err
+	}
+	switch selected {
+	case 0:
+		e.Selected = false
+	case 1:
+		e.Selected = true
+	default:
+		return fmt.Errorf("unexpected 'selected' value %d", selected)
 	}
+	var err error
 	e.Address, err = pa.IP()
-	if err != nil {
-		return err
-	}
-	return nil
+	return err
 }
 
 // MarshalBinary converts UnicastMasterEntry to []bytes
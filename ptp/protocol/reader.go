@@ -0,0 +1,186 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// reader decodes variable length data, such as TLVs, field after field.
+// It never reads past the end of data it was given: once a read doesn't fit,
+// reader remembers the error and all following reads return zero values,
+// so decoders only need to check err once they are done.
+type reader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+// fits checks that n more bytes can be read, recording the error otherwise
+func (r *reader) fits(name string, n int) bool {
+	if r.err == nil && n >= 0 && len(r.b)-r.pos >= n {
+		return true
+	}
+	r.short(name, n)
+	return false
+}
+
+// short records that n bytes can't be read. It's kept out of fits so the latter is inlined
+func (r *reader) short(name string, n int) {
+	if r.err == nil {
+		r.err = fmt.Errorf("not enough data to read %s: need %d bytes, have %d", name, n, len(r.b)-r.pos)
+	}
+}
+
+// len returns how many bytes are left
+func (r *reader) len() int {
+	return len(r.b) - r.pos
+}
+
+// rest returns all bytes which are left, without consuming them
+func (r *reader) rest() []byte {
+	return r.b[r.pos:]
+}
+
+func (r *reader) uint8(name string) uint8 {
+	if !r.fits(name, 1) {
+		return 0
+	}
+	v := r.b[r.pos]
+	r.pos++
+	return v
+}
+
+func (r *reader) uint16(name string) uint16 {
+	if !r.fits(name, 2) {
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.b[r.pos:])
+	r.pos += 2
+	return v
+}
+
+func (r *reader) uint32(name string) uint32 {
+	if !r.fits(name, 4) {
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b[r.pos:])
+	r.pos += 4
+	return v
+}
+
+func (r *reader) uint64(name string) uint64 {
+	if !r.fits(name, 8) {
+		return 0
+	}
+	v := binary.BigEndian.Uint64(r.b[r.pos:])
+	r.pos += 8
+	return v
+}
+
+// copy fills dst
+func (r *reader) copy(name string, dst []byte) {
+	if !r.fits(name, len(dst)) {
+		return
+	}
+	r.pos += copy(dst, r.b[r.pos:])
+}
+
+// slice returns next n bytes without copying them
+func (r *reader) slice(name string, n int) []byte {
+	if !r.fits(name, n) {
+		return nil
+	}
+	v := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return v
+}
+
+// bytes returns copy of next n bytes
+func (r *reader) bytes(name string, n int) []byte {
+	v := r.slice(name, n)
+	if r.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, v)
+	return b
+}
+
+// sub returns reader limited to next n bytes and skips them
+func (r *reader) sub(name string, n int) reader {
+	return reader{b: r.slice(name, n)}
+}
+
+// read reads fixed size value with reflection, for types that are not on hot path
+func (r *reader) read(name string, v interface{}) {
+	r.readOrder(name, binary.BigEndian, v)
+}
+
+// readOrder is read with non-default byte order
+func (r *reader) readOrder(name string, order binary.ByteOrder, v interface{}) {
+	size := binary.Size(v)
+	if size < 0 {
+		if r.err == nil {
+			r.err = fmt.Errorf("reading %s: unsupported type %T", name, v)
+		}
+		return
+	}
+	b := r.slice(name, size)
+	if r.err != nil {
+		return
+	}
+	if err := binary.Read(bytes.NewReader(b), order, v); err != nil {
+		r.err = fmt.Errorf("reading %s: %w", name, err)
+	}
+}
+
+// text reads PTPText, which is not padded when followed by other fields
+func (r *reader) text(name string, t *PTPText) {
+	length := r.uint8(name)
+	text := r.slice(name, int(length))
+	if r.err == nil {
+		*t = PTPText(text)
+	}
+}
+
+func (r *reader) portIdentity(name string, p *PortIdentity) {
+	p.ClockIdentity = ClockIdentity(r.uint64(name))
+	p.PortNumber = r.uint16(name)
+}
+
+func (r *reader) clockQuality(name string, q *ClockQuality) {
+	q.ClockClass = ClockClass(r.uint8(name))
+	q.ClockAccuracy = ClockAccuracy(r.uint8(name))
+	q.OffsetScaledLogVariance = r.uint16(name)
+}
+
+// tlvHead reads TLV header and returns reader over its value, which must be at least of want length, or exactly of it if strict
+func (r *reader) tlvHead(t *TLVHead, want int, strict bool) reader {
+	t.TLVType = TLVType(r.uint16("TLVType"))
+	t.LengthField = r.uint16("LengthField")
+	if r.err != nil {
+		return reader{}
+	}
+	if err := checkTLVLength(t, tlvHeadSize+r.len(), want, strict); err != nil {
+		r.err = err
+		return reader{}
+	}
+	return r.sub("TLV value", int(t.LengthField))
+}
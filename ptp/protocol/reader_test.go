@@ -0,0 +1,77 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	r := reader{b: []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}}
+	require.Equal(t, uint8(0x01), r.uint8("a"))
+	require.Equal(t, uint16(0x0203), r.uint16("b"))
+	require.Equal(t, uint32(0x04050607), r.uint32("c"))
+	require.Equal(t, uint64(0x08090a0b0c0d0e0f), r.uint64("d"))
+	require.Equal(t, 0, r.len())
+	require.NoError(t, r.err)
+}
+
+func TestReaderShort(t *testing.T) {
+	r := reader{b: []byte{0x01, 0x02, 0x03}}
+	require.Equal(t, uint16(0x0102), r.uint16("a"))
+	require.Equal(t, uint16(0), r.uint16("b"))
+	require.EqualError(t, r.err, "not enough data to read b: need 2 bytes, have 1")
+	// error is sticky, even if data is there
+	require.Equal(t, uint8(0), r.uint8("c"))
+	require.EqualError(t, r.err, "not enough data to read b: need 2 bytes, have 1")
+	require.Nil(t, r.bytes("d", 0))
+}
+
+func TestReaderNegativeLength(t *testing.T) {
+	r := reader{b: []byte{0x01, 0x02}}
+	require.Nil(t, r.slice("a", -1))
+	require.Error(t, r.err)
+}
+
+func TestReaderSub(t *testing.T) {
+	r := reader{b: []byte{0x01, 0x02, 0x03, 0x04}}
+	v := r.sub("a", 2)
+	require.Equal(t, uint16(0x0102), v.uint16("b"))
+	// sub reader can't read past its limit
+	require.Equal(t, uint8(0), v.uint8("c"))
+	require.Error(t, v.err)
+	require.NoError(t, r.err)
+	require.Equal(t, uint16(0x0304), r.uint16("d"))
+}
+
+func TestReaderTLVHead(t *testing.T) {
+	r := reader{b: []byte{0x00, 0x08, 0x00, 0x04, 0x01, 0x02, 0x03, 0x04, 0xff}}
+	head := TLVHead{}
+	v := r.tlvHead(&head, 4, true)
+	require.NoError(t, r.err)
+	require.Equal(t, TLVHead{TLVType: TLVPathTrace, LengthField: 4}, head)
+	require.Equal(t, []byte{0x01, 0x02, 0x03, 0x04}, v.rest())
+	require.Equal(t, 1, r.len())
+
+	// length field pointing past the data
+	r = reader{b: []byte{0x00, 0x08, 0x00, 0x08, 0x01, 0x02}}
+	v = r.tlvHead(&head, 0, false)
+	require.EqualError(t, r.err, "cannot decode TLV of length 12 from 6 bytes")
+	require.Equal(t, 0, v.len())
+}
@@ -0,0 +1,237 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"sync"
+)
+
+// sequenceWindow is how many latest sequence IDs SequenceTracker remembers for each stream of messages
+const sequenceWindow = 64
+
+// SequenceStatus is how message sequence ID relates to messages seen before
+type SequenceStatus uint8
+
+// Possible values of SequenceStatus
+const (
+	// SequenceOK is the next message in the stream, or a response matching the request
+	SequenceOK SequenceStatus = iota
+	// SequenceGap is like SequenceOK, but some messages before it were lost or are late
+	SequenceGap
+	// SequenceDuplicate is a message with sequence ID already seen
+	SequenceDuplicate
+	// SequenceReordered is a message late within the window, after messages with later sequence IDs
+	SequenceReordered
+	// SequenceStale is a message too old to be tracked, or a response to a request we forgot about
+	SequenceStale
+	// SequenceUnmatched is a response, like FollowUp or DelayResp, without matching Sync or DelayReq
+	SequenceUnmatched
+)
+
+// SequenceStatusToString is a map from SequenceStatus to string
+var SequenceStatusToString = map[SequenceStatus]string{
+	SequenceOK:        "ok",
+	SequenceGap:       "gap",
+	SequenceDuplicate: "duplicate",
+	SequenceReordered: "reordered",
+	SequenceStale:     "stale",
+	SequenceUnmatched: "unmatched",
+}
+
+func (s SequenceStatus) String() string {
+	return SequenceStatusToString[s]
+}
+
+// Accept tells if the message carries data worth using: duplicates and stale messages are not
+func (s SequenceStatus) Accept() bool {
+	return s != SequenceDuplicate && s != SequenceStale
+}
+
+// SequenceStats are counters of messages SequenceTracker has seen
+type SequenceStats struct {
+	OK         uint64
+	Gaps       uint64
+	Lost       uint64 // sequence IDs skipped, minus the ones which arrived late
+	Duplicates uint64
+	Reordered  uint64
+	Stale      uint64
+	Unmatched  uint64
+}
+
+// sequenceKey identifies a stream of messages
+type sequenceKey struct {
+	port    PortIdentity
+	msgType MessageType
+}
+
+// seqWindow remembers the latest sequence ID of a stream and which of the preceding ones were seen
+type seqWindow struct {
+	last uint16
+	// bit N is set if sequence ID last-N was seen
+	seen uint64
+}
+
+// back returns how far seq is behind the latest sequence ID, negative if it's ahead
+func (w *seqWindow) back(seq uint16) int {
+	return -int(int16(seq - w.last))
+}
+
+// has checks if seq was seen
+func (w *seqWindow) has(seq uint16) bool {
+	b := w.back(seq)
+	return b >= 0 && b < sequenceWindow && w.seen&(1<<b) != 0
+}
+
+// add records seq and returns its status along with how many sequence IDs it skipped
+func (w *seqWindow) add(seq uint16) (SequenceStatus, int) {
+	b := w.back(seq)
+	switch {
+	case b < 0:
+		ahead := -b
+		if ahead >= sequenceWindow {
+			w.seen = 1
+		} else {
+			w.seen = w.seen<<ahead | 1
+		}
+		w.last = seq
+		if ahead > 1 {
+			return SequenceGap, ahead - 1
+		}
+		return SequenceOK, 0
+	case b >= sequenceWindow:
+		return SequenceStale, 0
+	case w.seen&(1<<b) != 0:
+		return SequenceDuplicate, 0
+	default:
+		w.seen |= 1 << b
+		// it was counted as lost when we skipped it
+		return SequenceReordered, -1
+	}
+}
+
+// sequencePartners lists responses and the messages they complete: FollowUp goes after Sync from the same port,
+// while DelayResp answers DelayReq we sent
+var sequencePartners = map[MessageType]MessageType{
+	MessageFollowUp:  MessageSync,
+	MessageDelayResp: MessageDelayReq,
+}
+
+// SequenceTracker matches messages by source port identity and sequence ID.
+// It detects duplicates, reordering and losses within every stream of messages of the same type from the same port,
+// and checks that responses match messages they complete.
+// Only the latest 64 sequence IDs of each stream are tracked, older ones are stale.
+type SequenceTracker struct {
+	sync.Mutex
+	streams map[sequenceKey]*seqWindow
+	stats   SequenceStats
+}
+
+// NewSequenceTracker returns empty SequenceTracker
+func NewSequenceTracker() *SequenceTracker {
+	return &SequenceTracker{streams: map[sequenceKey]*seqWindow{}}
+}
+
+// Sent records sequence ID of a request we sent, like DelayReq, so responses to it can be matched
+func (t *SequenceTracker) Sent(msgType MessageType, seq uint16) {
+	t.Lock()
+	defer t.Unlock()
+	t.add(sequenceKey{msgType: msgType}, seq)
+}
+
+// Observe classifies message of msgType received from port by its sequence ID.
+// FollowUp is matched against Sync from the same port, and DelayResp against DelayReq we Sent
+func (t *SequenceTracker) Observe(port PortIdentity, msgType MessageType, seq uint16) SequenceStatus {
+	t.Lock()
+	defer t.Unlock()
+	var partner *sequenceKey
+	if p, found := sequencePartners[msgType]; found {
+		partner = &sequenceKey{port: port, msgType: p}
+		if p == MessageDelayReq {
+			partner.port = PortIdentity{}
+		}
+	}
+	return t.observe(sequenceKey{port: port, msgType: msgType}, partner, seq)
+}
+
+// ObserveResponse classifies message of msgType received from port as a response to request of reqType we Sent,
+// like Sync and Announce carrying timestamps of our DelayReq in SPTP
+func (t *SequenceTracker) ObserveResponse(port PortIdentity, msgType, reqType MessageType, seq uint16) SequenceStatus {
+	t.Lock()
+	defer t.Unlock()
+	return t.observe(sequenceKey{port: port, msgType: msgType}, &sequenceKey{msgType: reqType}, seq)
+}
+
+// Stats returns copy of the counters
+func (t *SequenceTracker) Stats() SequenceStats {
+	t.Lock()
+	defer t.Unlock()
+	return t.stats
+}
+
+// Reset forgets all streams and zeroes the counters
+func (t *SequenceTracker) Reset() {
+	t.Lock()
+	defer t.Unlock()
+	t.streams = map[sequenceKey]*seqWindow{}
+	t.stats = SequenceStats{}
+}
+
+// add records seq in the stream, creating it if needed
+func (t *SequenceTracker) add(key sequenceKey, seq uint16) (SequenceStatus, int) {
+	w, found := t.streams[key]
+	if !found {
+		t.streams[key] = &seqWindow{last: seq, seen: 1}
+		return SequenceOK, 0
+	}
+	return w.add(seq)
+}
+
+func (t *SequenceTracker) observe(key sequenceKey, partner *sequenceKey, seq uint16) SequenceStatus {
+	status, lost := t.add(key, seq)
+	switch {
+	case lost > 0:
+		t.stats.Lost += uint64(lost)
+	case lost < 0 && t.stats.Lost > 0:
+		t.stats.Lost--
+	}
+	if status.Accept() && partner != nil {
+		if w, found := t.streams[*partner]; !found {
+			status = SequenceUnmatched
+		} else if !w.has(seq) {
+			if w.back(seq) >= sequenceWindow {
+				status = SequenceStale
+			} else {
+				status = SequenceUnmatched
+			}
+		}
+	}
+	switch status {
+	case SequenceOK:
+		t.stats.OK++
+	case SequenceGap:
+		t.stats.Gaps++
+	case SequenceDuplicate:
+		t.stats.Duplicates++
+	case SequenceReordered:
+		t.stats.Reordered++
+	case SequenceStale:
+		t.stats.Stale++
+	case SequenceUnmatched:
+		t.stats.Unmatched++
+	}
+	return status
+}
@@ -0,0 +1,113 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequenceTrackerStream(t *testing.T) {
+	tr := NewSequenceTracker()
+	port := PortIdentity{ClockIdentity: 1, PortNumber: 1}
+	other := PortIdentity{ClockIdentity: 2, PortNumber: 1}
+
+	require.Equal(t, SequenceOK, tr.Observe(port, MessageSync, 10))
+	require.Equal(t, SequenceOK, tr.Observe(port, MessageSync, 11))
+	require.Equal(t, SequenceDuplicate, tr.Observe(port, MessageSync, 11))
+	// streams are independent
+	require.Equal(t, SequenceOK, tr.Observe(other, MessageSync, 11))
+	require.Equal(t, SequenceOK, tr.Observe(port, MessageAnnounce, 11))
+	// skip 12 and 13
+	require.Equal(t, SequenceGap, tr.Observe(port, MessageSync, 14))
+	require.Equal(t, SequenceReordered, tr.Observe(port, MessageSync, 12))
+	require.Equal(t, SequenceDuplicate, tr.Observe(port, MessageSync, 12))
+	// out of the window
+	require.Equal(t, SequenceStale, tr.Observe(port, MessageSync, 65536+14-sequenceWindow))
+	// far ahead
+	require.Equal(t, SequenceGap, tr.Observe(port, MessageSync, 1000))
+	require.Equal(t, SequenceStale, tr.Observe(port, MessageSync, 14))
+
+	require.Equal(t, SequenceStats{
+		OK:         4,
+		Gaps:       2,
+		Lost:       1 + 985,
+		Duplicates: 2,
+		Reordered:  1,
+		Stale:      2,
+	}, tr.Stats())
+
+	tr.Reset()
+	require.Equal(t, SequenceStats{}, tr.Stats())
+	require.Equal(t, SequenceOK, tr.Observe(port, MessageSync, 14))
+}
+
+func TestSequenceTrackerWraparound(t *testing.T) {
+	tr := NewSequenceTracker()
+	port := PortIdentity{ClockIdentity: 1, PortNumber: 1}
+	require.Equal(t, SequenceOK, tr.Observe(port, MessageSync, 65535))
+	require.Equal(t, SequenceOK, tr.Observe(port, MessageSync, 0))
+	require.Equal(t, SequenceGap, tr.Observe(port, MessageSync, 2))
+	require.Equal(t, SequenceReordered, tr.Observe(port, MessageSync, 1))
+	require.Equal(t, SequenceDuplicate, tr.Observe(port, MessageSync, 65535))
+	require.Equal(t, uint64(0), tr.Stats().Lost)
+}
+
+func TestSequenceTrackerFollowUp(t *testing.T) {
+	tr := NewSequenceTracker()
+	port := PortIdentity{ClockIdentity: 1, PortNumber: 1}
+	other := PortIdentity{ClockIdentity: 2, PortNumber: 1}
+
+	require.Equal(t, SequenceUnmatched, tr.Observe(port, MessageFollowUp, 1))
+	require.Equal(t, SequenceOK, tr.Observe(port, MessageSync, 2))
+	require.Equal(t, SequenceOK, tr.Observe(port, MessageFollowUp, 2))
+	require.Equal(t, SequenceDuplicate, tr.Observe(port, MessageFollowUp, 2))
+	// Sync from the other port doesn't count
+	require.Equal(t, SequenceOK, tr.Observe(other, MessageSync, 3))
+	require.Equal(t, SequenceUnmatched, tr.Observe(port, MessageFollowUp, 3))
+	require.Equal(t, SequenceGap, tr.Observe(port, MessageSync, 100))
+	require.Equal(t, SequenceStale, tr.Observe(port, MessageFollowUp, 4))
+}
+
+func TestSequenceTrackerDelayResp(t *testing.T) {
+	tr := NewSequenceTracker()
+	gm := PortIdentity{ClockIdentity: 1, PortNumber: 1}
+
+	tr.Sent(MessageDelayReq, 5)
+	tr.Sent(MessageDelayReq, 6)
+	require.Equal(t, SequenceOK, tr.Observe(gm, MessageDelayResp, 5))
+	require.Equal(t, SequenceUnmatched, tr.Observe(gm, MessageDelayResp, 7))
+	require.Equal(t, SequenceReordered, tr.Observe(gm, MessageDelayResp, 6))
+
+	// SPTP Sync carries T4 of our DelayReq
+	require.Equal(t, SequenceOK, tr.ObserveResponse(gm, MessageSync, MessageDelayReq, 6))
+	require.Equal(t, SequenceDuplicate, tr.ObserveResponse(gm, MessageSync, MessageDelayReq, 6))
+	require.Equal(t, SequenceUnmatched, tr.ObserveResponse(gm, MessageSync, MessageDelayReq, 8))
+	for seq := uint16(7); seq < 100; seq++ {
+		tr.Sent(MessageDelayReq, seq)
+	}
+	require.Equal(t, SequenceStale, tr.ObserveResponse(gm, MessageAnnounce, MessageDelayReq, 6))
+}
+
+func TestSequenceStatus(t *testing.T) {
+	require.Equal(t, "reordered", SequenceReordered.String())
+	require.True(t, SequenceGap.Accept())
+	require.True(t, SequenceUnmatched.Accept())
+	require.False(t, SequenceDuplicate.Accept())
+	require.False(t, SequenceStale.Accept())
+}
@@ -0,0 +1,202 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// sizes of unicast negotiation TLVs, without TLVHead
+const (
+	requestUnicastLength = 6
+	grantUnicastLength   = 8
+	cancelUnicastLength  = 2
+)
+
+// NewLogIntervalFromRate returns LogInterval for sending perSecond messages every second
+func NewLogIntervalFromRate(perSecond float64) (LogInterval, error) {
+	if perSecond <= 0 || math.IsInf(perSecond, 0) || math.IsNaN(perSecond) {
+		return 0, fmt.Errorf("rate must be positive, got %v", perSecond)
+	}
+	return NewLogInterval(time.Duration(float64(time.Second) / perSecond))
+}
+
+// unicastDuration converts duration of unicast transmission to seconds
+func unicastDuration(d time.Duration) (uint32, error) {
+	if d < 0 || d.Seconds() > math.MaxUint32 {
+		return 0, fmt.Errorf("duration must be between 0 and %ds, got %v", uint32(math.MaxUint32), d)
+	}
+	return uint32(d.Seconds()), nil
+}
+
+// SignalingBuilder builds Signaling messages for unicast negotiation.
+// Errors are remembered and reported by Build, so TLVs can be chained
+type SignalingBuilder struct {
+	msg Signaling
+	err error
+}
+
+// NewSignalingBuilder starts Signaling from source port to target port in domain
+func NewSignalingBuilder(source, target PortIdentity, domain uint8) *SignalingBuilder {
+	return &SignalingBuilder{
+		msg: Signaling{
+			Header: Header{
+				SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageSignaling, 0),
+				Version:            Version,
+				DomainNumber:       domain,
+				FlagField:          FlagUnicast,
+				SourcePortIdentity: source,
+				LogMessageInterval: MgmtLogMessageInterval,
+			},
+			TargetPortIdentity: target,
+		},
+	}
+}
+
+// Sequence sets SequenceID of the message
+func (b *SignalingBuilder) Sequence(seq uint16) *SignalingBuilder {
+	b.msg.SequenceID = seq
+	return b
+}
+
+// RequestUnicast adds REQUEST_UNICAST_TRANSMISSION TLV asking for msgType every interval for duration
+func (b *SignalingBuilder) RequestUnicast(msgType MessageType, interval LogInterval, duration time.Duration) *SignalingBuilder {
+	d, err := unicastDuration(duration)
+	if err != nil {
+		return b.fail(fmt.Errorf("requesting %s: %w", msgType, err))
+	}
+	b.msg.TLVs = append(b.msg.TLVs, &RequestUnicastTransmissionTLV{
+		TLVHead:               TLVHead{TLVType: TLVRequestUnicastTransmission, LengthField: requestUnicastLength},
+		MsgTypeAndReserved:    NewUnicastMsgTypeAndFlags(msgType, 0),
+		LogInterMessagePeriod: interval,
+		DurationField:         d,
+	})
+	return b
+}
+
+// RequestUnicastRate is RequestUnicast with interval derived from the rate of messages per second
+func (b *SignalingBuilder) RequestUnicastRate(msgType MessageType, perSecond float64, duration time.Duration) *SignalingBuilder {
+	interval, err := NewLogIntervalFromRate(perSecond)
+	if err != nil {
+		return b.fail(fmt.Errorf("requesting %s: %w", msgType, err))
+	}
+	return b.RequestUnicast(msgType, interval, duration)
+}
+
+// GrantUnicast adds GRANT_UNICAST_TRANSMISSION TLV. Zero duration denies the request
+func (b *SignalingBuilder) GrantUnicast(msgType MessageType, interval LogInterval, duration time.Duration, renewal bool) *SignalingBuilder {
+	d, err := unicastDuration(duration)
+	if err != nil {
+		return b.fail(fmt.Errorf("granting %s: %w", msgType, err))
+	}
+	var r uint8
+	if renewal {
+		r = 1
+	}
+	b.msg.TLVs = append(b.msg.TLVs, &GrantUnicastTransmissionTLV{
+		TLVHead:               TLVHead{TLVType: TLVGrantUnicastTransmission, LengthField: grantUnicastLength},
+		MsgTypeAndReserved:    NewUnicastMsgTypeAndFlags(msgType, 0),
+		LogInterMessagePeriod: interval,
+		DurationField:         d,
+		Renewal:               r,
+	})
+	return b
+}
+
+// CancelUnicast adds CANCEL_UNICAST_TRANSMISSION TLV for msgType
+func (b *SignalingBuilder) CancelUnicast(msgType MessageType) *SignalingBuilder {
+	b.msg.TLVs = append(b.msg.TLVs, &CancelUnicastTransmissionTLV{
+		TLVHead:         TLVHead{TLVType: TLVCancelUnicastTransmission, LengthField: cancelUnicastLength},
+		MsgTypeAndFlags: NewUnicastMsgTypeAndFlags(msgType, 0),
+	})
+	return b
+}
+
+// AcknowledgeCancelUnicast adds ACKNOWLEDGE_CANCEL_UNICAST_TRANSMISSION TLV for msgType
+func (b *SignalingBuilder) AcknowledgeCancelUnicast(msgType MessageType) *SignalingBuilder {
+	b.msg.TLVs = append(b.msg.TLVs, &AcknowledgeCancelUnicastTransmissionTLV{
+		TLVHead:         TLVHead{TLVType: TLVAcknowledgeCancelUnicastTransmission, LengthField: cancelUnicastLength},
+		MsgTypeAndFlags: NewUnicastMsgTypeAndFlags(msgType, 0),
+	})
+	return b
+}
+
+func (b *SignalingBuilder) fail(err error) *SignalingBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// Build returns Signaling with all TLVs added so far and MessageLength set, or the first error
+func (b *SignalingBuilder) Build() (*Signaling, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.msg.TLVs) == 0 {
+		return nil, fmt.Errorf("no TLVs in Signaling message, at least one required")
+	}
+	msg := b.msg
+	msg.TLVs = make([]TLV, len(b.msg.TLVs))
+	copy(msg.TLVs, b.msg.TLVs)
+	length := headerSize + 10
+	for _, tlv := range msg.TLVs {
+		if t, ok := tlv.(interface{ size() int }); ok {
+			length += t.size()
+		}
+	}
+	msg.MessageLength = uint16(length)
+	return &msg, nil
+}
+
+// UnicastGrant is what GRANT_UNICAST_TRANSMISSION TLV tells
+type UnicastGrant struct {
+	MessageType MessageType
+	Interval    LogInterval
+	Duration    time.Duration
+	Renewal     bool
+}
+
+// Denied reports if the request was denied, which is signalled by zero duration
+func (g UnicastGrant) Denied() bool {
+	return g.Duration == 0
+}
+
+// Rate returns how many messages per second were granted
+func (g UnicastGrant) Rate() float64 {
+	return 1 / g.Interval.Duration().Seconds()
+}
+
+// UnicastGrants returns all grants in Signaling message, in the order of TLVs
+func UnicastGrants(s *Signaling) []UnicastGrant {
+	grants := []UnicastGrant{}
+	for _, tlv := range s.TLVs {
+		g, ok := tlv.(*GrantUnicastTransmissionTLV)
+		if !ok {
+			continue
+		}
+		grants = append(grants, UnicastGrant{
+			MessageType: g.MsgTypeAndReserved.MsgType(),
+			Interval:    g.LogInterMessagePeriod,
+			Duration:    time.Duration(g.DurationField) * time.Second,
+			Renewal:     g.Renewal&1 != 0,
+		})
+	}
+	return grants
+}
@@ -0,0 +1,158 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	signalingSource = PortIdentity{ClockIdentity: 0x1122334455667788, PortNumber: 1}
+	signalingTarget = PortIdentity{ClockIdentity: 0x8877665544332211, PortNumber: 2}
+)
+
+func TestNewLogIntervalFromRate(t *testing.T) {
+	i, err := NewLogIntervalFromRate(1)
+	require.NoError(t, err)
+	require.Equal(t, LogInterval(0), i)
+	i, err = NewLogIntervalFromRate(8)
+	require.NoError(t, err)
+	require.Equal(t, LogInterval(-3), i)
+	i, err = NewLogIntervalFromRate(0.25)
+	require.NoError(t, err)
+	require.Equal(t, LogInterval(2), i)
+	_, err = NewLogIntervalFromRate(0)
+	require.Error(t, err)
+}
+
+func TestSignalingBuilderRequest(t *testing.T) {
+	s, err := NewSignalingBuilder(signalingSource, DefaultTargetPortIdentity, 24).
+		Sequence(42).
+		RequestUnicast(MessageSync, -1, time.Minute).
+		RequestUnicastRate(MessageAnnounce, 0.5, time.Minute).
+		Build()
+	require.NoError(t, err)
+	want := &Signaling{
+		Header: Header{
+			SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageSignaling, 0),
+			Version:            Version,
+			MessageLength:      uint16(binary.Size(Header{}) + binary.Size(PortIdentity{}) + 2*binary.Size(RequestUnicastTransmissionTLV{})),
+			DomainNumber:       24,
+			FlagField:          FlagUnicast,
+			SequenceID:         42,
+			SourcePortIdentity: signalingSource,
+			LogMessageInterval: MgmtLogMessageInterval,
+		},
+		TargetPortIdentity: DefaultTargetPortIdentity,
+		TLVs: []TLV{
+			&RequestUnicastTransmissionTLV{
+				TLVHead:               TLVHead{TLVType: TLVRequestUnicastTransmission, LengthField: uint16(binary.Size(RequestUnicastTransmissionTLV{}) - binary.Size(TLVHead{}))},
+				MsgTypeAndReserved:    NewUnicastMsgTypeAndFlags(MessageSync, 0),
+				LogInterMessagePeriod: -1,
+				DurationField:         60,
+			},
+			&RequestUnicastTransmissionTLV{
+				TLVHead:               TLVHead{TLVType: TLVRequestUnicastTransmission, LengthField: uint16(binary.Size(RequestUnicastTransmissionTLV{}) - binary.Size(TLVHead{}))},
+				MsgTypeAndReserved:    NewUnicastMsgTypeAndFlags(MessageAnnounce, 0),
+				LogInterMessagePeriod: 1,
+				DurationField:         60,
+			},
+		},
+	}
+	require.Equal(t, want, s)
+
+	b, err := s.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, int(s.MessageLength), len(b))
+	got := &Signaling{}
+	require.NoError(t, got.UnmarshalBinary(b))
+	require.Equal(t, want, got)
+}
+
+func TestSignalingBuilderGrantAndCancel(t *testing.T) {
+	s, err := NewSignalingBuilder(signalingSource, signalingTarget, 0).
+		GrantUnicast(MessageSync, -3, time.Minute, true).
+		GrantUnicast(MessageDelayResp, 0, 0, false).
+		CancelUnicast(MessageAnnounce).
+		AcknowledgeCancelUnicast(MessageAnnounce).
+		Build()
+	require.NoError(t, err)
+
+	b, err := s.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, int(s.MessageLength), len(b))
+	got := &Signaling{}
+	require.NoError(t, got.UnmarshalBinary(b))
+	require.Equal(t, s, got)
+	require.Equal(t, signalingTarget, got.TargetPortIdentity)
+	require.Equal(t, TLVCancelUnicastTransmission, got.TLVs[2].Type())
+	require.Equal(t, TLVAcknowledgeCancelUnicastTransmission, got.TLVs[3].Type())
+
+	grants := UnicastGrants(got)
+	require.Equal(t, []UnicastGrant{
+		{MessageType: MessageSync, Interval: -3, Duration: time.Minute, Renewal: true},
+		{MessageType: MessageDelayResp, Interval: 0, Duration: 0},
+	}, grants)
+	require.False(t, grants[0].Denied())
+	require.Equal(t, 8.0, grants[0].Rate())
+	require.True(t, grants[1].Denied())
+	require.Equal(t, 1.0, grants[1].Rate())
+}
+
+func TestSignalingBuilderErrors(t *testing.T) {
+	_, err := NewSignalingBuilder(signalingSource, signalingTarget, 0).Build()
+	require.Error(t, err)
+
+	_, err = NewSignalingBuilder(signalingSource, signalingTarget, 0).
+		RequestUnicast(MessageSync, 0, -time.Second).
+		CancelUnicast(MessageSync).
+		Build()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "requesting SYNC")
+
+	_, err = NewSignalingBuilder(signalingSource, signalingTarget, 0).
+		GrantUnicast(MessageSync, 0, 200*365*24*time.Hour, false).
+		Build()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "granting SYNC")
+
+	_, err = NewSignalingBuilder(signalingSource, signalingTarget, 0).
+		RequestUnicastRate(MessageSync, -1, time.Minute).
+		Build()
+	require.Error(t, err)
+}
+
+func TestSignalingBuilderReuse(t *testing.T) {
+	b := NewSignalingBuilder(signalingSource, signalingTarget, 0).CancelUnicast(MessageSync)
+	first, err := b.Build()
+	require.NoError(t, err)
+	second, err := b.CancelUnicast(MessageAnnounce).Build()
+	require.NoError(t, err)
+	require.Len(t, first.TLVs, 1)
+	require.Len(t, second.TLVs, 2)
+	require.Greater(t, second.MessageLength, first.MessageLength)
+}
+
+func TestUnicastGrantsNone(t *testing.T) {
+	s, err := NewSignalingBuilder(signalingSource, signalingTarget, 0).CancelUnicast(MessageSync).Build()
+	require.NoError(t, err)
+	require.Empty(t, UnicastGrants(s))
+}
@@ -0,0 +1,188 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"fmt"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// ClientState is the state of client side of SPTP exchange
+type ClientState int
+
+// Client states
+const (
+	// ClientIdle means no exchange was started
+	ClientIdle ClientState = iota
+	// ClientWaiting means DelayReq is out, and its TX timestamp, Sync or Announce are awaited
+	ClientWaiting
+	// ClientComplete means every timestamp of the exchange is known
+	ClientComplete
+)
+
+var clientStateToString = map[ClientState]string{
+	ClientIdle:     "IDLE",
+	ClientWaiting:  "WAITING",
+	ClientComplete: "COMPLETE",
+}
+
+func (s ClientState) String() string {
+	return clientStateToString[s]
+}
+
+// Result is the outcome of complete SPTP exchange
+type Result struct {
+	// T1 is when server sent Sync
+	T1 time.Time
+	// T2 is when client received Sync
+	T2 time.Time
+	// T3 is when client sent DelayReq
+	T3 time.Time
+	// T4 is when server received DelayReq
+	T4 time.Time
+	// CF1 is correctionField of Sync
+	CF1 time.Duration
+	// CF2 is correctionField of DelayReq, returned in Announce
+	CF2 time.Duration
+	// Announce is the Announce which completed the exchange
+	Announce ptp.Announce
+}
+
+// serverToClient returns Sync transit time
+func (r *Result) serverToClient() time.Duration {
+	return r.T2.Sub(r.T1) - r.CF1
+}
+
+// clientToServer returns DelayReq transit time
+func (r *Result) clientToServer() time.Duration {
+	return r.T4.Sub(r.T3) - r.CF2
+}
+
+// Offset returns how far client clock is ahead of the server one
+func (r *Result) Offset() time.Duration {
+	return (r.serverToClient() - r.clientToServer()) / 2
+}
+
+// Delay returns mean path delay
+func (r *Result) Delay() time.Duration {
+	return (r.serverToClient() + r.clientToServer()) / 2
+}
+
+// Client is client side of SPTP exchanges with a single server, one exchange at a time.
+// Client is not safe for concurrent use
+type Client struct {
+	port   ptp.PortIdentity
+	domain uint8
+	// sequence ID of the next DelayReq
+	nextSeq uint16
+
+	state ClientState
+	seq   uint16
+	res   Result
+	// what the exchange has got so far
+	sent     bool
+	sync     bool
+	announce bool
+}
+
+// NewClient returns Client talking from the port in the domain
+func NewClient(port ptp.PortIdentity, domain uint8) *Client {
+	return &Client{port: port, domain: domain}
+}
+
+// State returns state of the current exchange
+func (c *Client) State() ClientState {
+	return c.state
+}
+
+// DelayReq starts new exchange, abandoning the current one, and returns DelayReq to send to event port of the server
+func (c *Client) DelayReq() *ptp.SyncDelayReq {
+	c.seq = c.nextSeq
+	c.nextSeq++
+	c.res = Result{}
+	c.sent, c.sync, c.announce = false, false, false
+	c.state = ClientWaiting
+	return NewDelayReq(c.port, c.domain, c.seq)
+}
+
+// Sent records when DelayReq was sent, which is T3
+func (c *Client) Sent(t3 time.Time) error {
+	if c.state != ClientWaiting || c.sent {
+		return fmt.Errorf("DelayReq TX timestamp in state %s: %w", c.state, ErrUnexpected)
+	}
+	c.res.T3 = t3
+	c.sent = true
+	c.checkComplete()
+	return nil
+}
+
+// check verifies message with the header belongs to the current exchange
+func (c *Client) check(h *ptp.Header, seen bool) error {
+	if c.state != ClientWaiting || seen {
+		return fmt.Errorf("%s in state %s: %w", h.MessageType(), c.state, ErrUnexpected)
+	}
+	if h.DomainNumber != c.domain {
+		return fmt.Errorf("%s in domain %d, expected %d: %w", h.MessageType(), h.DomainNumber, c.domain, ErrDomain)
+	}
+	if h.SequenceID != c.seq {
+		return fmt.Errorf("%s seq=%d, expected %d: %w", h.MessageType(), h.SequenceID, c.seq, ErrSequence)
+	}
+	return nil
+}
+
+// HandleSync records Sync received at rx, which is T2. Sync carries T4 and CF1
+func (c *Client) HandleSync(s *ptp.SyncDelayReq, rx time.Time) error {
+	if err := c.check(&s.Header, c.sync); err != nil {
+		return err
+	}
+	c.res.T2 = rx
+	c.res.T4 = s.OriginTimestamp.Time()
+	c.res.CF1 = s.CorrectionField.Duration()
+	c.sync = true
+	c.checkComplete()
+	return nil
+}
+
+// HandleAnnounce records Announce, which carries T1 and CF2
+func (c *Client) HandleAnnounce(a *ptp.Announce) error {
+	if err := c.check(&a.Header, c.announce); err != nil {
+		return err
+	}
+	c.res.T1 = a.OriginTimestamp.Time()
+	c.res.CF2 = a.CorrectionField.Duration()
+	c.res.Announce = *a
+	c.announce = true
+	c.checkComplete()
+	return nil
+}
+
+func (c *Client) checkComplete() {
+	if c.sent && c.sync && c.announce {
+		c.state = ClientComplete
+	}
+}
+
+// Result returns the outcome of the current exchange once it's complete
+func (c *Client) Result() (*Result, error) {
+	if c.state != ClientComplete {
+		return nil, ErrIncomplete
+	}
+	res := c.res
+	return &res, nil
+}
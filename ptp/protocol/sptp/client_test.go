@@ -0,0 +1,119 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientStateString(t *testing.T) {
+	require.Equal(t, "IDLE", ClientIdle.String())
+	require.Equal(t, "WAITING", ClientWaiting.String())
+	require.Equal(t, "COMPLETE", ClientComplete.String())
+}
+
+func TestClientIdle(t *testing.T) {
+	c := NewClient(testClientPort, 0)
+	require.Equal(t, ClientIdle, c.State())
+	_, err := c.Result()
+	require.ErrorIs(t, err, ErrIncomplete)
+	require.ErrorIs(t, c.Sent(testTX), ErrUnexpected)
+	require.ErrorIs(t, c.HandleSync(NewSync(testServerPort, &NewDelayReq(testClientPort, 0, 0).Header, testRX), testTX), ErrUnexpected)
+}
+
+func TestClientDelayReq(t *testing.T) {
+	c := NewClient(testClientPort, 24)
+	req := c.DelayReq()
+	require.Equal(t, ClientWaiting, c.State())
+	require.Equal(t, NewDelayReq(testClientPort, 24, 0), req)
+	require.Equal(t, uint16(1), c.DelayReq().SequenceID)
+}
+
+func TestClientRejects(t *testing.T) {
+	c := NewClient(testClientPort, 0)
+	req := c.DelayReq()
+	s := testServer()
+
+	// answer to the previous DelayReq
+	stale := *req
+	stale.SequenceID--
+	resp, err := s.Respond(&stale, testRX)
+	require.NoError(t, err)
+	sync, err := resp.Sync()
+	require.NoError(t, err)
+	require.ErrorIs(t, c.HandleSync(sync, testTX), ErrSequence)
+
+	// answer from another domain
+	other := *req
+	other.DomainNumber = 1
+	resp, err = s.Respond(&other, testRX)
+	require.NoError(t, err)
+	require.NoError(t, resp.Sent(testTX))
+	announce, err := resp.Announce()
+	require.NoError(t, err)
+	require.ErrorIs(t, c.HandleAnnounce(announce), ErrDomain)
+
+	// duplicates
+	resp, err = s.Respond(req, testRX)
+	require.NoError(t, err)
+	sync, err = resp.Sync()
+	require.NoError(t, err)
+	require.NoError(t, c.HandleSync(sync, testTX))
+	require.ErrorIs(t, c.HandleSync(sync, testTX), ErrUnexpected)
+	require.NoError(t, c.Sent(testTX))
+	require.ErrorIs(t, c.Sent(testTX), ErrUnexpected)
+	require.Equal(t, ClientWaiting, c.State())
+	_, err = c.Result()
+	require.ErrorIs(t, err, ErrIncomplete)
+}
+
+func TestClientNewExchange(t *testing.T) {
+	c := NewClient(testClientPort, 0)
+	req := c.DelayReq()
+	require.NoError(t, c.Sent(testTX))
+	sync := NewSync(testServerPort, &req.Header, testRX)
+	require.NoError(t, c.HandleSync(sync, testTX))
+
+	// new DelayReq abandons the exchange
+	c.DelayReq()
+	a := NewAnnounce(testServerPort, &req.Header, 0, ptp.AnnounceBody{})
+	err := c.HandleAnnounce(a)
+	require.True(t, errors.Is(err, ErrSequence))
+	require.Equal(t, ClientWaiting, c.State())
+	_, err = c.Result()
+	require.ErrorIs(t, err, ErrIncomplete)
+}
+
+func TestResult(t *testing.T) {
+	start := time.Unix(1653574589, 0)
+	r := &Result{
+		T1:  start,
+		T2:  start.Add(200 * time.Nanosecond),
+		T3:  start.Add(time.Millisecond),
+		T4:  start.Add(time.Millisecond + 100*time.Nanosecond),
+		CF1: 40 * time.Nanosecond,
+		CF2: 20 * time.Nanosecond,
+	}
+	// 160ns from server to client, 80ns back
+	require.Equal(t, 40*time.Nanosecond, r.Offset())
+	require.Equal(t, 120*time.Nanosecond, r.Delay())
+}
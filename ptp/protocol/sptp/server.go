@@ -0,0 +1,108 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"fmt"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// ServerState is the state of server side of SPTP exchange
+type ServerState int
+
+// Server states
+const (
+	// ServerSyncPending means DelayReq was received and Sync is to be sent
+	ServerSyncPending ServerState = iota
+	// ServerAnnouncePending means Sync was sent and Announce carrying its TX timestamp is to be sent
+	ServerAnnouncePending
+	// ServerDone means both Sync and Announce were sent
+	ServerDone
+)
+
+var serverStateToString = map[ServerState]string{
+	ServerSyncPending:     "SYNC_PENDING",
+	ServerAnnouncePending: "ANNOUNCE_PENDING",
+	ServerDone:            "DONE",
+}
+
+func (s ServerState) String() string {
+	return serverStateToString[s]
+}
+
+// Server is server side of SPTP, answering DelayReqs on behalf of a grandmaster port.
+// It keeps no state of its own, so it's safe for concurrent use as long as its fields are not changed
+type Server struct {
+	// Port is the port answering DelayReqs
+	Port ptp.PortIdentity
+	// AnnounceFlags are set in Announce on top of unicast flag, like ptp.FlagPTPTimescale and leap flags
+	AnnounceFlags uint16
+	// Announce describes the grandmaster
+	Announce ptp.AnnounceBody
+}
+
+// Respond starts answering DelayReq received at rx
+func (s *Server) Respond(req *ptp.SyncDelayReq, rx time.Time) (*Response, error) {
+	if !IsDelayReq(&req.Header) {
+		return nil, fmt.Errorf("%s with flags %#04x: %w", req.MessageType(), req.FlagField, ErrNotSPTP)
+	}
+	return &Response{
+		sync:     NewSync(s.Port, &req.Header, rx),
+		announce: NewAnnounce(s.Port, &req.Header, s.AnnounceFlags, s.Announce),
+	}, nil
+}
+
+// Response is server side of a single SPTP exchange. Response is not safe for concurrent use
+type Response struct {
+	state    ServerState
+	sync     *ptp.SyncDelayReq
+	announce *ptp.Announce
+}
+
+// State returns state of the exchange
+func (r *Response) State() ServerState {
+	return r.state
+}
+
+// Sync returns Sync to send to event port of the client
+func (r *Response) Sync() (*ptp.SyncDelayReq, error) {
+	if r.state != ServerSyncPending {
+		return nil, fmt.Errorf("Sync in state %s: %w", r.state, ErrUnexpected)
+	}
+	return r.sync, nil
+}
+
+// Sent records when Sync was sent, which is T1
+func (r *Response) Sent(t1 time.Time) error {
+	if r.state != ServerSyncPending {
+		return fmt.Errorf("Sync TX timestamp in state %s: %w", r.state, ErrUnexpected)
+	}
+	SetAnnounceOrigin(r.announce, t1)
+	r.state = ServerAnnouncePending
+	return nil
+}
+
+// Announce returns Announce to send to general port of the client, which completes the exchange
+func (r *Response) Announce() (*ptp.Announce, error) {
+	if r.state != ServerAnnouncePending {
+		return nil, fmt.Errorf("Announce in state %s: %w", r.state, ErrUnexpected)
+	}
+	r.state = ServerDone
+	return r.announce, nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"testing"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerStateString(t *testing.T) {
+	require.Equal(t, "SYNC_PENDING", ServerSyncPending.String())
+	require.Equal(t, "ANNOUNCE_PENDING", ServerAnnouncePending.String())
+	require.Equal(t, "DONE", ServerDone.String())
+}
+
+func TestServerRespond(t *testing.T) {
+	req := &ptp.SyncDelayReq{}
+	require.NoError(t, ptp.FromBytes(goldenDelayReq, req))
+	resp, err := testServer().Respond(req, testRX)
+	require.NoError(t, err)
+	require.Equal(t, ServerSyncPending, resp.State())
+
+	// Announce needs Sync TX timestamp
+	_, err = resp.Announce()
+	require.ErrorIs(t, err, ErrUnexpected)
+
+	sync, err := resp.Sync()
+	require.NoError(t, err)
+	b, err := ptp.Bytes(sync)
+	require.NoError(t, err)
+	require.Equal(t, goldenSync, b)
+
+	require.NoError(t, resp.Sent(testTX))
+	require.Equal(t, ServerAnnouncePending, resp.State())
+	require.ErrorIs(t, resp.Sent(testTX), ErrUnexpected)
+	_, err = resp.Sync()
+	require.ErrorIs(t, err, ErrUnexpected)
+
+	announce, err := resp.Announce()
+	require.NoError(t, err)
+	b, err = ptp.Bytes(announce)
+	require.NoError(t, err)
+	require.Equal(t, goldenAnnounce, b)
+	require.Equal(t, ServerDone, resp.State())
+	_, err = resp.Announce()
+	require.ErrorIs(t, err, ErrUnexpected)
+}
+
+func TestServerRespondNotSPTP(t *testing.T) {
+	req := NewDelayReq(testClientPort, 0, 1)
+	req.FlagField = ptp.FlagUnicast
+	_, err := testServer().Respond(req, testRX)
+	require.ErrorIs(t, err, ErrNotSPTP)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package sptp implements Simple PTP exchange spoken by sptp client and ptp4u server, so compatible endpoints
+can be built against a stable API rather than after sptp client internals.
+
+SPTP is unicast PTP without negotiation. Client starts every exchange with DelayReq carrying unicast and profile specific 1 flags,
+and server answers with Sync to the event port and Announce to the general port, both with the sequence ID of the DelayReq:
+
+	client                                      server
+	  |--- DelayReq seq=N ------------------------>|  T3 sent, T4 received
+	  |<-- Sync seq=N originTimestamp=T4 ----------|  T1 sent, T2 received
+	  |<-- Announce seq=N originTimestamp=T1 ------|
+	  |         correctionField=CF2                |
+
+Sync carries T4 rather than its own origin, so it always has two-step flag set. Announce plays the role of Follow Up:
+it carries T1, TX timestamp of the Sync, and correctionField of the DelayReq as it reached the server (CF2).
+correctionField of the Sync as it reached the client is CF1. Sync and Announce may arrive in any order.
+Offset and mean path delay are the ones of IEEE 1588 delay request-response mechanism:
+
+	offset = ((T2 - T1 - CF1) - (T4 - T3 - CF2)) / 2
+	delay  = ((T2 - T1 - CF1) + (T4 - T3 - CF2)) / 2
+
+Client and Server are state machines of both sides, while NewDelayReq, NewSync, NewAnnounce and the setters
+build the messages themselves for implementations which keep their own state.
+*/
+package sptp
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// DelayReqFlags are flags of DelayReq which asks for SPTP exchange rather than Delay_Resp
+const DelayReqFlags = ptp.FlagUnicast | ptp.FlagProfileSpecific1
+
+// SyncFlags are flags of Sync answering DelayReq
+const SyncFlags = ptp.FlagUnicast | ptp.FlagTwoStep
+
+// Errors reported by state machines
+var (
+	// ErrNotSPTP means DelayReq doesn't ask for SPTP exchange
+	ErrNotSPTP = errors.New("not an SPTP DelayReq")
+	// ErrUnexpected means message or action doesn't fit current state of the exchange
+	ErrUnexpected = errors.New("unexpected in current state")
+	// ErrSequence means message answers DelayReq other than the current one
+	ErrSequence = errors.New("sequence ID doesn't match DelayReq")
+	// ErrDomain means message comes from domain other than the one of the exchange
+	ErrDomain = errors.New("domain doesn't match DelayReq")
+	// ErrIncomplete means exchange hasn't produced every timestamp yet
+	ErrIncomplete = errors.New("exchange is not complete")
+)
+
+// IsDelayReq reports if message with the header is DelayReq asking for SPTP exchange
+func IsDelayReq(h *ptp.Header) bool {
+	return h.MessageType() == ptp.MessageDelayReq && h.FlagField == DelayReqFlags
+}
+
+// NewDelayReq returns DelayReq starting SPTP exchange from the port in the domain
+func NewDelayReq(port ptp.PortIdentity, domain uint8, seq uint16) *ptp.SyncDelayReq {
+	return &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageDelayReq, 0),
+			Version:            ptp.Version,
+			MessageLength:      uint16(binary.Size(ptp.SyncDelayReq{})),
+			DomainNumber:       domain,
+			FlagField:          DelayReqFlags,
+			SequenceID:         seq,
+			SourcePortIdentity: port,
+			LogMessageInterval: 0x7f,
+		},
+	}
+}
+
+// NewSync returns Sync from the port answering DelayReq with the header, received at rx
+func NewSync(port ptp.PortIdentity, req *ptp.Header, rx time.Time) *ptp.SyncDelayReq {
+	s := &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageSync, 0),
+			Version:            ptp.Version,
+			MessageLength:      uint16(binary.Size(ptp.SyncDelayReq{})),
+			DomainNumber:       req.DomainNumber,
+			FlagField:          SyncFlags,
+			SourcePortIdentity: port,
+			LogMessageInterval: 0x7f,
+		},
+	}
+	SetSync(s, req.SequenceID, rx)
+	return s
+}
+
+// SetSync makes Sync answer DelayReq with the sequence ID received at rx, which is T4
+func SetSync(s *ptp.SyncDelayReq, seq uint16, rx time.Time) {
+	s.SequenceID = seq
+	s.OriginTimestamp = ptp.NewTimestamp(rx)
+}
+
+// NewAnnounce returns Announce from the port answering DelayReq with the header. flags are set on top of unicast flag,
+// and body describes the grandmaster. T1 is set with SetAnnounceOrigin once Sync is sent
+func NewAnnounce(port ptp.PortIdentity, req *ptp.Header, flags uint16, body ptp.AnnounceBody) *ptp.Announce {
+	a := &ptp.Announce{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageAnnounce, 0),
+			Version:            ptp.Version,
+			MessageLength:      uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.AnnounceBody{})),
+			DomainNumber:       req.DomainNumber,
+			FlagField:          ptp.FlagUnicast | flags,
+			SourcePortIdentity: port,
+			ControlField:       5,
+		},
+		AnnounceBody: body,
+	}
+	SetAnnounce(a, req.SequenceID, req.CorrectionField)
+	return a
+}
+
+// SetAnnounce makes Announce answer DelayReq with the sequence ID and correctionField, which is CF2
+func SetAnnounce(a *ptp.Announce, seq uint16, cf ptp.Correction) {
+	a.SequenceID = seq
+	a.CorrectionField = cf
+}
+
+// SetAnnounceOrigin sets TX timestamp of the Sync, which is T1
+func SetAnnounceOrigin(a *ptp.Announce, t1 time.Time) {
+	a.OriginTimestamp = ptp.NewTimestamp(t1)
+}
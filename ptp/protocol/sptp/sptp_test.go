@@ -0,0 +1,190 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sptp
+
+import (
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testClientPort = ptp.PortIdentity{PortNumber: 1, ClockIdentity: 0x001122fffe334455}
+	testServerPort = ptp.PortIdentity{PortNumber: 1, ClockIdentity: 0xaabbccfffeddeeff}
+	testAnnounce   = ptp.AnnounceBody{
+		CurrentUTCOffset:     37,
+		GrandmasterPriority1: 128,
+		GrandmasterClockQuality: ptp.ClockQuality{
+			ClockClass:              6,
+			ClockAccuracy:           0x21,
+			OffsetScaledLogVariance: 23008,
+		},
+		GrandmasterPriority2: 128,
+		GrandmasterIdentity:  0xaabbccfffeddeeff,
+		TimeSource:           ptp.TimeSourceGNSS,
+	}
+	// T4 and T1 of golden packets
+	testRX = time.Unix(1653574589, 806552)
+	testTX = time.Unix(1653574589, 806572)
+)
+
+// golden DelayReq with sequence 42 and correctionField of 1500ns
+var goldenDelayReq = []uint8{
+	0x01, 0x12, 0x00, 0x2c, 0x00, 0x00, 0x24, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x05, 0xdc, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x11, 0x22, 0xff,
+	0xfe, 0x33, 0x44, 0x55, 0x00, 0x01, 0x00, 0x2a,
+	0x00, 0x7f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// golden Sync answering goldenDelayReq, carrying testRX
+var goldenSync = []uint8{
+	0x00, 0x12, 0x00, 0x2c, 0x00, 0x00, 0x06, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0xaa, 0xbb, 0xcc, 0xff,
+	0xfe, 0xdd, 0xee, 0xff, 0x00, 0x01, 0x00, 0x2a,
+	0x00, 0x7f, 0x00, 0x00, 0x62, 0x8f, 0x8b, 0xbd,
+	0x00, 0x0c, 0x4e, 0x98, 0x00, 0x00,
+}
+
+// golden Announce answering goldenDelayReq, carrying testTX and correctionField of the DelayReq
+var goldenAnnounce = []uint8{
+	0x0b, 0x12, 0x00, 0x40, 0x00, 0x00, 0x04, 0x08,
+	0x00, 0x00, 0x00, 0x00, 0x05, 0xdc, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0xaa, 0xbb, 0xcc, 0xff,
+	0xfe, 0xdd, 0xee, 0xff, 0x00, 0x01, 0x00, 0x2a,
+	0x05, 0x00, 0x00, 0x00, 0x62, 0x8f, 0x8b, 0xbd,
+	0x00, 0x0c, 0x4e, 0xac, 0x00, 0x25, 0x00, 0x80,
+	0x06, 0x21, 0x59, 0xe0, 0x80, 0xaa, 0xbb, 0xcc,
+	0xff, 0xfe, 0xdd, 0xee, 0xff, 0x00, 0x00, 0x20,
+	0x00, 0x00,
+}
+
+func testServer() *Server {
+	return &Server{Port: testServerPort, AnnounceFlags: ptp.FlagPTPTimescale, Announce: testAnnounce}
+}
+
+func TestNewDelayReqGolden(t *testing.T) {
+	req := NewDelayReq(testClientPort, 0, 42)
+	req.CorrectionField = ptp.NewCorrection(1500)
+	b, err := ptp.Bytes(req)
+	require.NoError(t, err)
+	require.Equal(t, goldenDelayReq, b)
+	require.True(t, IsDelayReq(&req.Header))
+}
+
+func TestNewSyncGolden(t *testing.T) {
+	req := &ptp.SyncDelayReq{}
+	require.NoError(t, ptp.FromBytes(goldenDelayReq, req))
+	b, err := ptp.Bytes(NewSync(testServerPort, &req.Header, testRX))
+	require.NoError(t, err)
+	require.Equal(t, goldenSync, b)
+}
+
+func TestNewAnnounceGolden(t *testing.T) {
+	req := &ptp.SyncDelayReq{}
+	require.NoError(t, ptp.FromBytes(goldenDelayReq, req))
+	a := NewAnnounce(testServerPort, &req.Header, ptp.FlagPTPTimescale, testAnnounce)
+	SetAnnounceOrigin(a, testTX)
+	b, err := ptp.Bytes(a)
+	require.NoError(t, err)
+	require.Equal(t, goldenAnnounce, b)
+}
+
+func TestIsDelayReq(t *testing.T) {
+	req := NewDelayReq(testClientPort, 0, 1)
+	require.True(t, IsDelayReq(&req.Header))
+	// regular DelayReq expects Delay_Resp
+	req.FlagField = ptp.FlagUnicast
+	require.False(t, IsDelayReq(&req.Header))
+	// Sync with SPTP flags is not a DelayReq
+	req.FlagField = DelayReqFlags
+	req.SdoIDAndMsgType = ptp.NewSdoIDAndMsgType(ptp.MessageSync, 0)
+	require.False(t, IsDelayReq(&req.Header))
+}
+
+func TestExchange(t *testing.T) {
+	const (
+		offset = 150 * time.Microsecond
+		delay  = 20 * time.Microsecond
+		cf1    = 3 * time.Microsecond
+		cf2    = 5 * time.Microsecond
+	)
+	// client clock is offset ahead of server clock
+	serverTime := func(clientTime time.Time) time.Time { return clientTime.Add(-offset) }
+	t3 := time.Unix(1653574589, 0)
+
+	c := NewClient(testClientPort, 0)
+	s := testServer()
+	for i := 0; i < 3; i++ {
+		req := c.DelayReq()
+		require.Equal(t, uint16(i), req.SequenceID)
+		require.NoError(t, c.Sent(t3))
+
+		// on the wire to the server
+		reqB, err := ptp.Bytes(req)
+		require.NoError(t, err)
+		got := &ptp.SyncDelayReq{}
+		require.NoError(t, ptp.FromBytes(reqB, got))
+		got.CorrectionField = ptp.NewCorrection(float64(cf2))
+		t4 := serverTime(t3.Add(delay + cf2))
+
+		resp, err := s.Respond(got, t4)
+		require.NoError(t, err)
+		sync, err := resp.Sync()
+		require.NoError(t, err)
+		t1 := t4.Add(time.Microsecond)
+		require.NoError(t, resp.Sent(t1))
+		announce, err := resp.Announce()
+		require.NoError(t, err)
+
+		// on the wire to the client, Announce overtakes Sync
+		announceB, err := ptp.Bytes(announce)
+		require.NoError(t, err)
+		gotAnnounce := &ptp.Announce{}
+		require.NoError(t, ptp.FromBytes(announceB, gotAnnounce))
+		require.NoError(t, c.HandleAnnounce(gotAnnounce))
+		require.Equal(t, ClientWaiting, c.State())
+
+		syncB, err := ptp.Bytes(sync)
+		require.NoError(t, err)
+		gotSync := &ptp.SyncDelayReq{}
+		require.NoError(t, ptp.FromBytes(syncB, gotSync))
+		gotSync.CorrectionField = ptp.NewCorrection(float64(cf1))
+		t2 := t1.Add(offset + delay + cf1)
+		require.NoError(t, c.HandleSync(gotSync, t2))
+		require.Equal(t, ClientComplete, c.State())
+
+		res, err := c.Result()
+		require.NoError(t, err)
+		require.Equal(t, t1, res.T1)
+		require.Equal(t, t2, res.T2)
+		require.Equal(t, t3, res.T3)
+		require.Equal(t, t4, res.T4)
+		require.Equal(t, cf1, res.CF1)
+		require.Equal(t, cf2, res.CF2)
+		require.Equal(t, testAnnounce.GrandmasterIdentity, res.Announce.GrandmasterIdentity)
+		require.Equal(t, testAnnounce.CurrentUTCOffset, res.Announce.CurrentUTCOffset)
+		require.Equal(t, offset, res.Offset())
+		require.Equal(t, delay, res.Delay())
+
+		t3 = t3.Add(time.Second)
+	}
+}
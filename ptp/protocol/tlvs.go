@@ -40,16 +40,38 @@ func (t TLVHead) Type() TLVType {
 	return t.TLVType
 }
 
+// size returns full size of TLV as claimed by its header
+func (t TLVHead) size() int {
+	return tlvHeadSize + int(t.LengthField)
+}
+
+// marshalBufferSize returns buffer size enough to marshal message with TLVs.
+// It's never less than 508 bytes, which is enough for any message we build ourselves,
+// but decoded messages can carry more.
+func marshalBufferSize(bodySize int, tlvs []TLV) int {
+	size := bodySize
+	for _, tlv := range tlvs {
+		if t, ok := tlv.(interface{ size() int }); ok {
+			size += t.size()
+		}
+	}
+	if size < 508 {
+		return 508
+	}
+	return size
+}
+
 func tlvHeadMarshalBinaryTo(t *TLVHead, b []byte) {
 	binary.BigEndian.PutUint16(b, uint16(t.TLVType))
 	binary.BigEndian.PutUint16(b[2:], t.LengthField)
 }
 
+// unmarshalTLVHeader reads TLV header for fixed size TLVs, which then index b directly after checkTLVLength
 func unmarshalTLVHeader(p *TLVHead, b []byte) error {
 	if len(b) < tlvHeadSize {
-		return fmt.Errorf("not enough data to decode PTP header")
+		return fmt.Errorf("not enough data to read TLV header: need %d bytes, have %d", tlvHeadSize, len(b))
 	}
-	p.TLVType = TLVType(binary.BigEndian.Uint16(b[0:]))
+	p.TLVType = TLVType(binary.BigEndian.Uint16(b))
 	p.LengthField = binary.BigEndian.Uint16(b[2:])
 	return nil
 }
@@ -91,64 +113,66 @@ func writeTLVs(tlvs []TLV, b []byte) (int, error) {
 	return pos, nil
 }
 
-func readTLVs(tlvs []TLV, maxLength int, b []byte) ([]TLV, error) {
-	pos := 0
-	var tlvType TLVType
-	for {
-		// packet can have trailing bytes, let's make sure we don't try to read past given length
-		if pos+tlvHeadSize > maxLength {
-			break
-		}
-		tlvType = TLVType(binary.BigEndian.Uint16(b[pos:]))
-
-		switch tlvType {
-		case TLVAcknowledgeCancelUnicastTransmission:
-			tlv := &AcknowledgeCancelUnicastTransmissionTLV{}
-			if err := tlv.UnmarshalBinary(b[pos:]); err != nil {
-				return tlvs, err
-			}
-			tlvs = append(tlvs, tlv)
-			pos += tlvHeadSize + int(tlv.LengthField)
+// tlvUnmarshaler is a TLV which can decode itself from []byte starting with TLV header
+type tlvUnmarshaler interface {
+	TLV
+	UnmarshalBinary([]byte) error
+}
 
-		case TLVGrantUnicastTransmission:
-			tlv := &GrantUnicastTransmissionTLV{}
-			if err := tlv.UnmarshalBinary(b[pos:]); err != nil {
-				return tlvs, err
-			}
-			tlvs = append(tlvs, tlv)
-			pos += tlvHeadSize + int(tlv.LengthField)
+// newTLV returns empty TLV of the given type to decode into.
+// Organization extension TLVs are looked up by their organization, so nil is returned for them
+func newTLV(t TLVType) tlvUnmarshaler {
+	switch t {
+	case TLVAcknowledgeCancelUnicastTransmission:
+		return &AcknowledgeCancelUnicastTransmissionTLV{}
+	case TLVGrantUnicastTransmission:
+		return &GrantUnicastTransmissionTLV{}
+	case TLVRequestUnicastTransmission:
+		return &RequestUnicastTransmissionTLV{}
+	case TLVCancelUnicastTransmission:
+		return &CancelUnicastTransmissionTLV{}
+	case TLVPathTrace:
+		return &PathTraceTLV{}
+	case TLVAlternateTimeOffsetIndicator:
+		return &AlternateTimeOffsetIndicatorTLV{}
+	case TLVAuthentication:
+		return &AuthenticationTLV{}
+	case TLVPad:
+		return &PadTLV{}
+	case TLVOrganizationExtension, TLVOrganizationExtensionPropagate, TLVOrganizationExtensionDoNotPropagate:
+		return nil
+	default:
+		// TLVs we don't understand are kept as is, so they can be ignored or forwarded
+		return &UnknownTLV{}
+	}
+}
 
-		case TLVRequestUnicastTransmission:
-			tlv := &RequestUnicastTransmissionTLV{}
-			if err := tlv.UnmarshalBinary(b[pos:]); err != nil {
-				return tlvs, err
-			}
-			tlvs = append(tlvs, tlv)
-			pos += tlvHeadSize + int(tlv.LengthField)
-		case TLVCancelUnicastTransmission:
-			tlv := &CancelUnicastTransmissionTLV{}
-			if err := tlv.UnmarshalBinary(b[pos:]); err != nil {
-				return tlvs, err
-			}
-			tlvs = append(tlvs, tlv)
-			pos += tlvHeadSize + int(tlv.LengthField)
-		case TLVPathTrace:
-			tlv := &PathTraceTLV{}
-			if err := tlv.UnmarshalBinary(b[pos:]); err != nil {
-				return tlvs, err
-			}
-			tlvs = append(tlvs, tlv)
-			pos += tlvHeadSize + int(tlv.LengthField)
-		case TLVAlternateTimeOffsetIndicator:
-			tlv := &AlternateTimeOffsetIndicatorTLV{}
-			if err := tlv.UnmarshalBinary(b[pos:]); err != nil {
+// readTLVs decodes all TLVs from the reader, which starts right after message body.
+// Packet can have trailing bytes, so TLVs are only read if they start within maxLength.
+// Some implementations don't count TLVs in messageLength though, so TLV can extend past maxLength.
+func readTLVs(tlvs []TLV, maxLength int, r reader) ([]TLV, error) {
+	for r.pos+tlvHeadSize <= maxLength && r.len() >= tlvHeadSize {
+		start := r.pos
+		head := TLVHead{}
+		r.tlvHead(&head, 0, false)
+		if r.err != nil {
+			return tlvs, r.err
+		}
+		// every TLV decoder gets exactly the bytes of its TLV, header included
+		b := r.b[start:r.pos]
+		tlv := newTLV(head.TLVType)
+		if tlv == nil {
+			otlv, err := readOrganizationExtensionTLV(b)
+			if err != nil {
 				return tlvs, err
 			}
-			tlvs = append(tlvs, tlv)
-			pos += tlvHeadSize + int(tlv.LengthField)
-		default:
-			return tlvs, fmt.Errorf("reading TLV %s (%d) is not yet implemented", tlvType, tlvType)
+			tlvs = append(tlvs, otlv)
+			continue
+		}
+		if err := tlv.UnmarshalBinary(b); err != nil {
+			return tlvs, err
 		}
+		tlvs = append(tlvs, tlv)
 	}
 	return tlvs, nil
 }
@@ -301,22 +325,16 @@ func (t *PathTraceTLV) MarshalBinaryTo(b []byte) (int, error) {
 
 // UnmarshalBinary parses []byte and populates struct fields
 func (t *PathTraceTLV) UnmarshalBinary(b []byte) error {
-	if err := unmarshalTLVHeader(&t.TLVHead, b); err != nil {
-		return err
-	}
-	if err := checkTLVLength(&t.TLVHead, len(b), 8, false); err != nil {
-		return err
+	r := reader{b: b}
+	v := r.tlvHead(&t.TLVHead, 8, false)
+	if r.err != nil {
+		return r.err
 	}
 	t.PathSequence = []ClockIdentity{}
-	for i := 0; i*8 <= int(t.TLVHead.LengthField); i++ {
-		pos := tlvHeadSize + i*8
-		if pos+8 >= len(b) {
-			break
-		}
-		identity := ClockIdentity(binary.BigEndian.Uint64(b[pos:]))
-		t.PathSequence = append(t.PathSequence, identity)
+	for v.len() >= 8 {
+		t.PathSequence = append(t.PathSequence, ClockIdentity(v.uint64("PathSequence")))
 	}
-	return nil
+	return v.err
 }
 
 // AlternateTimeOffsetIndicatorTLV is a Table 116 ALTERNATE_TIME_OFFSET_INDICATOR TLV format
@@ -336,32 +354,166 @@ func (t *AlternateTimeOffsetIndicatorTLV) MarshalBinaryTo(b []byte) (int, error)
 	binary.BigEndian.PutUint32(b[tlvHeadSize+1:], uint32(t.CurrentOffset))
 	binary.BigEndian.PutUint32(b[tlvHeadSize+5:], uint32(t.JumpSeconds))
 	copy(b[tlvHeadSize+9:], t.TimeOfNextJump[:]) //uint48
-	size := tlvHeadSize + 15
-	if t.DisplayName != "" {
-		dd, err := t.DisplayName.MarshalBinary()
+	// displayName is always present, even if empty
+	dd, err := t.DisplayName.MarshalBinary()
+	if err != nil {
+		return 0, fmt.Errorf("writing AlternateTimeOffsetIndicatorTLV DisplayName: %w", err)
+	}
+	copy(b[tlvHeadSize+15:], dd)
+	size := 15 + len(dd)
+	// keep padding the TLV was received with
+	for ; size < int(t.LengthField); size++ {
+		b[tlvHeadSize+size] = 0
+	}
+	return tlvHeadSize + size, nil
+}
+
+// UnmarshalBinary parses []byte and populates struct fields
+func (t *AlternateTimeOffsetIndicatorTLV) UnmarshalBinary(b []byte) error {
+	r := reader{b: b}
+	v := r.tlvHead(&t.TLVHead, 16, false)
+	if r.err != nil {
+		return r.err
+	}
+	t.KeyField = v.uint8("KeyField")
+	t.CurrentOffset = int32(v.uint32("CurrentOffset"))
+	t.JumpSeconds = int32(v.uint32("JumpSeconds"))
+	v.copy("TimeOfNextJump", t.TimeOfNextJump[:]) // uint48
+	if err := t.DisplayName.UnmarshalBinary(v.rest()); err != nil {
+		return fmt.Errorf("reading AlternateTimeOffsetIndicatorTLV DisplayName: %w", err)
+	}
+	return v.err
+}
+
+// PadTLV is a PAD TLV. It carries no information and is used to increase message size
+type PadTLV struct {
+	TLVHead
+	Pad []byte
+}
+
+// MarshalBinaryTo marshals bytes to PadTLV
+func (t *PadTLV) MarshalBinaryTo(b []byte) (int, error) {
+	if len(b) < tlvHeadSize+len(t.Pad) {
+		return 0, fmt.Errorf("not enough buffer to write PadTLV")
+	}
+	tlvHeadMarshalBinaryTo(&t.TLVHead, b)
+	copy(b[tlvHeadSize:], t.Pad)
+	return tlvHeadSize + len(t.Pad), nil
+}
+
+// UnmarshalBinary parses []byte and populates struct fields
+func (t *PadTLV) UnmarshalBinary(b []byte) error {
+	r := reader{b: b}
+	v := r.tlvHead(&t.TLVHead, 0, false)
+	if r.err != nil {
+		return r.err
+	}
+	t.Pad = append(t.Pad[:0], v.rest()...)
+	return v.err
+}
+
+// TLVDecoderFunc is the function we use to decode organization extension TLV from bytes, starting with TLV header.
+// Decoded TLV should implement BinaryMarshalerTo, so it can be encoded back.
+type TLVDecoderFunc func(data []byte) (TLV, error)
+
+// orgTLVKey identifies organization extension TLV
+type orgTLVKey struct {
+	tlvType        TLVType
+	organizationID [3]uint8
+}
+
+// decoders for organization extension TLVs registered by applications
+var orgTLVDecoder = map[orgTLVKey]TLVDecoderFunc{}
+
+// RegisterTLVDecoder registers function we'll use to decode ORGANIZATION_EXTENSION, ORGANIZATION_EXTENSION_PROPAGATE
+// or ORGANIZATION_EXTENSION_DO_NOT_PROPAGATE TLV of particular organization, identified by its OUI or CID.
+// Such TLVs without registered decoder are decoded as OrganizationExtensionTLV.
+// It's not safe to call while packets are decoded, so decoders should be registered during initialization.
+func RegisterTLVDecoder(tlvType TLVType, organizationID [3]uint8, decoder TLVDecoderFunc) {
+	orgTLVDecoder[orgTLVKey{tlvType: tlvType, organizationID: organizationID}] = decoder
+}
+
+// readOrganizationExtensionTLV decodes organization extension TLV with registered decoder, or as OrganizationExtensionTLV otherwise
+func readOrganizationExtensionTLV(b []byte) (TLV, error) {
+	r := reader{b: b}
+	head := TLVHead{}
+	v := r.tlvHead(&head, 6, false)
+	key := orgTLVKey{tlvType: head.TLVType}
+	v.copy("OrganizationID", key.organizationID[:])
+	if r.err != nil {
+		return nil, r.err
+	}
+	if decoder, found := orgTLVDecoder[key]; found {
+		tlv, err := decoder(b[:r.pos])
 		if err != nil {
-			return 0, fmt.Errorf("writing AlternateTimeOffsetIndicatorTLV DisplayName: %w", err)
+			return nil, fmt.Errorf("decoding TLV %s (%d) of organization %X: %w", head.TLVType, head.TLVType, key.organizationID, err)
 		}
-		copy(b[tlvHeadSize+15:], dd)
-		size += len(dd)
+		return tlv, nil
 	}
-	return size, nil
+	tlv := &OrganizationExtensionTLV{}
+	if err := tlv.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return tlv, nil
+}
+
+// OrganizationExtensionTLV is an ORGANIZATION_EXTENSION, ORGANIZATION_EXTENSION_PROPAGATE
+// and ORGANIZATION_EXTENSION_DO_NOT_PROPAGATE TLV format
+type OrganizationExtensionTLV struct {
+	TLVHead
+	OrganizationID      [3]uint8
+	OrganizationSubType [3]uint8
+	DataField           []byte
+}
+
+// MarshalBinaryTo marshals bytes to OrganizationExtensionTLV
+func (t *OrganizationExtensionTLV) MarshalBinaryTo(b []byte) (int, error) {
+	if len(b) < tlvHeadSize+6+len(t.DataField) {
+		return 0, fmt.Errorf("not enough buffer to write OrganizationExtensionTLV")
+	}
+	tlvHeadMarshalBinaryTo(&t.TLVHead, b)
+	copy(b[tlvHeadSize:], t.OrganizationID[:])
+	copy(b[tlvHeadSize+3:], t.OrganizationSubType[:])
+	copy(b[tlvHeadSize+6:], t.DataField)
+	return tlvHeadSize + 6 + len(t.DataField), nil
 }
 
 // UnmarshalBinary parses []byte and populates struct fields
-func (t *AlternateTimeOffsetIndicatorTLV) UnmarshalBinary(b []byte) error {
-	if err := unmarshalTLVHeader(&t.TLVHead, b); err != nil {
-		return err
+func (t *OrganizationExtensionTLV) UnmarshalBinary(b []byte) error {
+	r := reader{b: b}
+	v := r.tlvHead(&t.TLVHead, 6, false)
+	if r.err != nil {
+		return r.err
 	}
-	if err := checkTLVLength(&t.TLVHead, len(b), 20, false); err != nil {
-		return err
+	v.copy("OrganizationID", t.OrganizationID[:])
+	v.copy("OrganizationSubType", t.OrganizationSubType[:])
+	t.DataField = append(t.DataField[:0], v.rest()...)
+	return v.err
+}
+
+// UnknownTLV holds TLV we don't decode, such as TLVs of types we don't implement, with its value as is
+type UnknownTLV struct {
+	TLVHead
+	Value []byte
+}
+
+// MarshalBinaryTo marshals bytes to UnknownTLV
+func (t *UnknownTLV) MarshalBinaryTo(b []byte) (int, error) {
+	if len(b) < tlvHeadSize+len(t.Value) {
+		return 0, fmt.Errorf("not enough buffer to write TLV %s (%d)", t.TLVType, t.TLVType)
 	}
-	t.KeyField = b[tlvHeadSize]
-	t.CurrentOffset = int32(binary.BigEndian.Uint32(b[tlvHeadSize+1:]))
-	t.JumpSeconds = int32(binary.BigEndian.Uint32(b[tlvHeadSize+5:]))
-	copy(t.TimeOfNextJump[:], b[tlvHeadSize+9:]) // uint48
-	if err := t.DisplayName.UnmarshalBinary(b[tlvHeadSize+15:]); err != nil {
-		return fmt.Errorf("reading AlternateTimeOffsetIndicatorTLV DisplayName: %w", err)
+	tlvHeadMarshalBinaryTo(&t.TLVHead, b)
+	copy(b[tlvHeadSize:], t.Value)
+	return tlvHeadSize + len(t.Value), nil
+}
+
+// UnmarshalBinary parses []byte and populates struct fields
+func (t *UnknownTLV) UnmarshalBinary(b []byte) error {
+	r := reader{b: b}
+	v := r.tlvHead(&t.TLVHead, 0, false)
+	if r.err != nil {
+		return r.err
 	}
-	return nil
+	t.Value = append(t.Value[:0], v.rest()...)
+	return v.err
 }
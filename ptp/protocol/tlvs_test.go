@@ -17,6 +17,8 @@ limitations under the License.
 package protocol
 
 import (
+	"encoding/binary"
+	"fmt"
 	"testing"
 	"time"
 
@@ -140,7 +142,8 @@ func TestParseAnnounceWithAlternateTimeOffsetIndicator(t *testing.T) {
 		},
 	}
 	require.Equal(t, want, *packet)
-	b, err := Bytes(packet)
+	// padding of TLV is kept
+	b, err := packet.MarshalBinary()
 	require.Nil(t, err)
 	assert.Equal(t, raw, b)
 
@@ -149,3 +152,160 @@ func TestParseAnnounceWithAlternateTimeOffsetIndicator(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, &want, pp)
 }
+
+func TestParseAnnounceV21WithPadAndPathTrace(t *testing.T) {
+	// PTPv2.1 Announce padded before PATH_TRACE, which ends the packet without any trailing bytes
+	raw := []uint8("\x0b\x12\x00\x54\x00\x00\x04\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x08\xc0\xeb\xff\xfe\x63\x7a\x4e\x00\x01\x00\x00\x05\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x25\x00\x80\xf8\xfe\xff\xff\x80\x08\xc0\xeb\xff\xfe\x63\x7a\x4e\x00\x00\xa0\x80\x08\x00\x04\x00\x00\x00\x00\x00\x08\x00\x08\x08\xc0\xeb\xff\xfe\x63\x7a\x4e")
+	packet := new(Announce)
+	err := FromBytes(raw, packet)
+	require.Nil(t, err)
+	require.Equal(t, uint8(2), packet.MajorVersionPTP())
+	require.Equal(t, uint8(1), packet.MinorVersionPTP())
+	want := []TLV{
+		&PadTLV{
+			TLVHead: TLVHead{TLVType: TLVPad, LengthField: 4},
+			Pad:     []byte{0, 0, 0, 0},
+		},
+		&PathTraceTLV{
+			TLVHead:      TLVHead{TLVType: TLVPathTrace, LengthField: 8},
+			PathSequence: []ClockIdentity{630763432548989518},
+		},
+	}
+	require.Equal(t, want, packet.TLVs)
+	b, err := packet.MarshalBinary()
+	require.Nil(t, err)
+	assert.Equal(t, raw, b)
+}
+
+func TestParseSignalingWithOrganizationExtensionAndUnknownTLV(t *testing.T) {
+	raw := []uint8("\x0c\x12\x00\x40\x00\x00\x04\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x08\xc0\xeb\xff\xfe\x63\x7a\x4e\x00\x01\x00\x07\x05\x7f\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\x80\x00\x00\x0a\x00\x80\xc2\x00\x00\x01\x01\x02\x03\x04\x80\x01\x00\x02\x01\x00")
+	packet := new(Signaling)
+	err := FromBytes(raw, packet)
+	require.Nil(t, err)
+	want := []TLV{
+		&OrganizationExtensionTLV{
+			TLVHead:             TLVHead{TLVType: TLVOrganizationExtensionDoNotPropagate, LengthField: 10},
+			OrganizationID:      [3]uint8{0x00, 0x80, 0xc2},
+			OrganizationSubType: [3]uint8{0x00, 0x00, 0x01},
+			DataField:           []byte{1, 2, 3, 4},
+		},
+		// L1_SYNC is not decoded, but kept
+		&UnknownTLV{
+			TLVHead: TLVHead{TLVType: TLVL1Sync, LengthField: 2},
+			Value:   []byte{1, 0},
+		},
+	}
+	require.Equal(t, want, packet.TLVs)
+	b, err := packet.MarshalBinary()
+	require.Nil(t, err)
+	assert.Equal(t, raw, b)
+
+	// test generic DecodePacket as well
+	pp, err := DecodePacket(raw)
+	require.Nil(t, err)
+	assert.Equal(t, packet, pp)
+}
+
+func TestAlternateTimeOffsetIndicatorTLVEmptyDisplayName(t *testing.T) {
+	tlv := &AlternateTimeOffsetIndicatorTLV{
+		TLVHead:        TLVHead{TLVType: TLVAlternateTimeOffsetIndicator, LengthField: 16},
+		KeyField:       0x01,
+		CurrentOffset:  37,
+		JumpSeconds:    1,
+		TimeOfNextJump: NewPTPSeconds(time.Unix(1656946102, 0)),
+	}
+	b := make([]byte, 32)
+	n, err := tlv.MarshalBinaryTo(b)
+	require.Nil(t, err)
+	require.Equal(t, tlvHeadSize+16, n)
+
+	got := &AlternateTimeOffsetIndicatorTLV{}
+	require.Nil(t, got.UnmarshalBinary(b[:n]))
+	require.Equal(t, tlv, got)
+}
+
+// testVendorTLV is organization extension TLV of imaginary vendor
+type testVendorTLV struct {
+	TLVHead
+	OrganizationID [3]uint8
+	SubType        [3]uint8
+	Value          uint16
+}
+
+func (t *testVendorTLV) MarshalBinaryTo(b []byte) (int, error) {
+	tlvHeadMarshalBinaryTo(&t.TLVHead, b)
+	copy(b[tlvHeadSize:], t.OrganizationID[:])
+	copy(b[tlvHeadSize+3:], t.SubType[:])
+	binary.BigEndian.PutUint16(b[tlvHeadSize+6:], t.Value)
+	return tlvHeadSize + 8, nil
+}
+
+func TestRegisterTLVDecoder(t *testing.T) {
+	orgID := [3]uint8{0xaa, 0xbb, 0xcc}
+	RegisterTLVDecoder(TLVOrganizationExtensionPropagate, orgID, func(data []byte) (TLV, error) {
+		if len(data) != tlvHeadSize+8 {
+			return nil, fmt.Errorf("unexpected length %d", len(data))
+		}
+		tlv := &testVendorTLV{}
+		require.NoError(t, unmarshalTLVHeader(&tlv.TLVHead, data))
+		copy(tlv.OrganizationID[:], data[tlvHeadSize:])
+		copy(tlv.SubType[:], data[tlvHeadSize+3:])
+		tlv.Value = binary.BigEndian.Uint16(data[tlvHeadSize+6:])
+		return tlv, nil
+	})
+	defer delete(orgTLVDecoder, orgTLVKey{tlvType: TLVOrganizationExtensionPropagate, organizationID: orgID})
+
+	raw := []byte{
+		// registered decoder
+		0x40, 0x00, 0x00, 0x08, 0xaa, 0xbb, 0xcc, 0x00, 0x00, 0x01, 0x12, 0x34,
+		// same organization, but type without registered decoder
+		0x80, 0x00, 0x00, 0x08, 0xaa, 0xbb, 0xcc, 0x00, 0x00, 0x01, 0x12, 0x34,
+	}
+	tlvs, err := readTLVs(nil, len(raw), reader{b: raw})
+	require.NoError(t, err)
+	want := []TLV{
+		&testVendorTLV{
+			TLVHead:        TLVHead{TLVType: TLVOrganizationExtensionPropagate, LengthField: 8},
+			OrganizationID: orgID,
+			SubType:        [3]uint8{0, 0, 1},
+			Value:          0x1234,
+		},
+		&OrganizationExtensionTLV{
+			TLVHead:             TLVHead{TLVType: TLVOrganizationExtensionDoNotPropagate, LengthField: 8},
+			OrganizationID:      orgID,
+			OrganizationSubType: [3]uint8{0, 0, 1},
+			DataField:           []byte{0x12, 0x34},
+		},
+	}
+	require.Equal(t, want, tlvs)
+	b := make([]byte, len(raw))
+	n, err := writeTLVs(tlvs, b)
+	require.NoError(t, err)
+	require.Equal(t, raw, b[:n])
+
+	// decoder errors are reported
+	raw = []byte{0x40, 0x00, 0x00, 0x06, 0xaa, 0xbb, 0xcc, 0x00, 0x00, 0x01}
+	_, err = readTLVs(nil, len(raw), reader{b: raw})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "of organization AABBCC: unexpected length 10")
+}
+
+func TestReadWriteTLVsLossless(t *testing.T) {
+	raw := []byte{
+		// ALTERNATE_TIME_OFFSET_INDICATOR with extra padding
+		0x00, 0x09, 0x00, 0x14, 0x01, 0x00, 0x00, 0x00, 0x25, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x62, 0xc2, 0xfd, 0xb6, 0x01, 0x41, 0x00, 0x00, 0x00,
+		// ENHANCED_ACCURACY_METRICS we don't decode
+		0x40, 0x01, 0x00, 0x04, 0xde, 0xad, 0xbe, 0xef,
+		// PAD
+		0x80, 0x08, 0x00, 0x02, 0x00, 0x00,
+	}
+	tlvs, err := readTLVs(nil, len(raw), reader{b: raw})
+	require.NoError(t, err)
+	require.Len(t, tlvs, 3)
+	require.Equal(t, PTPText("A"), tlvs[0].(*AlternateTimeOffsetIndicatorTLV).DisplayName)
+	require.Equal(t, TLVEnhancedAccuracyMetrics, tlvs[1].Type())
+	b := make([]byte, len(raw))
+	n, err := writeTLVs(tlvs, b)
+	require.NoError(t, err)
+	require.Equal(t, raw, b[:n])
+}
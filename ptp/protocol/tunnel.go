@@ -0,0 +1,297 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Helpers to carry PTP messages over simple tunnels, like GRE (RFC 2784, RFC 2890), GRE-in-UDP (RFC 8086) or PPP (RFC 1661), often found in test labs
+
+// Protocol types of tunnel payloads, as EtherType
+const (
+	EtherTypeIPv4                uint16 = 0x0800
+	EtherTypeIPv6                uint16 = 0x86DD
+	EtherTypePTP                 uint16 = 0x88F7
+	EtherTypeTransparentEthernet uint16 = 0x6558
+	EtherTypeVLAN                uint16 = 0x8100
+)
+
+// PPP protocol numbers
+const (
+	PPPProtoIPv4 uint16 = 0x0021
+	PPPProtoIPv6 uint16 = 0x0057
+)
+
+// PortGREInUDP is the UDP destination port for GRE-in-UDP encapsulation
+const PortGREInUDP = 4754
+
+const (
+	greFlagChecksum = 1 << 15
+	greFlagKey      = 1 << 13
+	greFlagSeq      = 1 << 12
+	greBaseSize     = 4
+	pppAddress      = 0xff
+	pppControl      = 0x03
+	ethHeaderSize   = 14
+	udpHeaderSize   = 8
+	ipv6HeaderSize  = 40
+	ipProtoUDP      = 17
+)
+
+// GREHeader is a GRE header with optional checksum, key and sequence number fields
+type GREHeader struct {
+	ChecksumPresent bool
+	KeyPresent      bool
+	SeqPresent      bool
+	Protocol        uint16
+	Checksum        uint16
+	Key             uint32
+	Seq             uint32
+}
+
+// Len returns size of the header on the wire
+func (h *GREHeader) Len() int {
+	l := greBaseSize
+	if h.ChecksumPresent {
+		// checksum is followed by reserved field
+		l += 4
+	}
+	if h.KeyPresent {
+		l += 4
+	}
+	if h.SeqPresent {
+		l += 4
+	}
+	return l
+}
+
+// MarshalBinaryTo marshals bytes to GREHeader
+func (h *GREHeader) MarshalBinaryTo(b []byte) (int, error) {
+	if len(b) < h.Len() {
+		return 0, fmt.Errorf("not enough buffer to write GREHeader")
+	}
+	var flags uint16
+	if h.ChecksumPresent {
+		flags |= greFlagChecksum
+	}
+	if h.KeyPresent {
+		flags |= greFlagKey
+	}
+	if h.SeqPresent {
+		flags |= greFlagSeq
+	}
+	binary.BigEndian.PutUint16(b, flags)
+	binary.BigEndian.PutUint16(b[2:], h.Protocol)
+	n := greBaseSize
+	if h.ChecksumPresent {
+		binary.BigEndian.PutUint16(b[n:], h.Checksum)
+		binary.BigEndian.PutUint16(b[n+2:], 0)
+		n += 4
+	}
+	if h.KeyPresent {
+		binary.BigEndian.PutUint32(b[n:], h.Key)
+		n += 4
+	}
+	if h.SeqPresent {
+		binary.BigEndian.PutUint32(b[n:], h.Seq)
+		n += 4
+	}
+	return n, nil
+}
+
+// UnmarshalBinary parses []byte and populates struct fields
+func (h *GREHeader) UnmarshalBinary(b []byte) error {
+	r := reader{b: b}
+	flags := r.uint16("GREHeader flags")
+	h.Protocol = r.uint16("GREHeader Protocol")
+	if r.err != nil {
+		return r.err
+	}
+	if version := flags & 0x7; version != 0 {
+		return fmt.Errorf("unsupported GRE version %d", version)
+	}
+	h.ChecksumPresent = flags&greFlagChecksum != 0
+	h.KeyPresent = flags&greFlagKey != 0
+	h.SeqPresent = flags&greFlagSeq != 0
+	if h.ChecksumPresent {
+		h.Checksum = r.uint16("GREHeader Checksum")
+		r.uint16("GREHeader Reserved1")
+	}
+	if h.KeyPresent {
+		h.Key = r.uint32("GREHeader Key")
+	}
+	if h.SeqPresent {
+		h.Seq = r.uint32("GREHeader Seq")
+	}
+	return r.err
+}
+
+// internetChecksum computes one's complement checksum as defined in RFC 1071
+func internetChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// EncapsulateGRE prepends GRE header to the payload, calculating checksum if it's present
+func EncapsulateGRE(h *GREHeader, payload []byte) ([]byte, error) {
+	b := make([]byte, h.Len()+len(payload))
+	h.Checksum = 0
+	if _, err := h.MarshalBinaryTo(b); err != nil {
+		return nil, err
+	}
+	copy(b[h.Len():], payload)
+	if h.ChecksumPresent {
+		h.Checksum = internetChecksum(b)
+		binary.BigEndian.PutUint16(b[greBaseSize:], h.Checksum)
+	}
+	return b, nil
+}
+
+// DecapsulateGRE parses GRE header and returns it together with the payload, verifying checksum if it's present
+func DecapsulateGRE(b []byte) (*GREHeader, []byte, error) {
+	h := &GREHeader{}
+	if err := h.UnmarshalBinary(b); err != nil {
+		return nil, nil, err
+	}
+	if h.ChecksumPresent && internetChecksum(b) != 0 {
+		return nil, nil, fmt.Errorf("bad GRE checksum 0x%04x", h.Checksum)
+	}
+	return h, b[h.Len():], nil
+}
+
+// EncapsulatePPP prepends PPP header with address and control fields to the payload
+func EncapsulatePPP(proto uint16, payload []byte) []byte {
+	b := make([]byte, 4+len(payload))
+	b[0] = pppAddress
+	b[1] = pppControl
+	binary.BigEndian.PutUint16(b[2:], proto)
+	copy(b[4:], payload)
+	return b
+}
+
+// DecapsulatePPP parses PPP header and returns protocol number and the payload.
+// Both address and control field compression and protocol field compression are supported.
+func DecapsulatePPP(b []byte) (uint16, []byte, error) {
+	if len(b) >= 2 && b[0] == pppAddress && b[1] == pppControl {
+		b = b[2:]
+	}
+	if len(b) < 1 {
+		return 0, nil, fmt.Errorf("not enough data to decode PPP header")
+	}
+	// compressed protocol field is a single odd byte
+	if b[0]&1 == 1 {
+		return uint16(b[0]), b[1:], nil
+	}
+	if len(b) < 2 {
+		return 0, nil, fmt.Errorf("not enough data to decode PPP protocol")
+	}
+	return binary.BigEndian.Uint16(b), b[2:], nil
+}
+
+// PTPFromTunnelPayload returns PTP message carried in tunnel payload of given protocol (as EtherType).
+// Payload can be IPv4 or IPv6 packet with UDP datagram to PTP port, or Ethernet frame with either of them or PTP over IEEE 802.3.
+func PTPFromTunnelPayload(proto uint16, b []byte) ([]byte, error) {
+	switch proto {
+	case EtherTypePTP:
+		return b, nil
+	case EtherTypeTransparentEthernet:
+		if len(b) < ethHeaderSize {
+			return nil, fmt.Errorf("not enough data to decode Ethernet header")
+		}
+		etherType := binary.BigEndian.Uint16(b[12:])
+		b = b[ethHeaderSize:]
+		for etherType == EtherTypeVLAN {
+			if len(b) < 4 {
+				return nil, fmt.Errorf("not enough data to decode 802.1Q tag")
+			}
+			etherType = binary.BigEndian.Uint16(b[2:])
+			b = b[4:]
+		}
+		if etherType == EtherTypeTransparentEthernet {
+			return nil, fmt.Errorf("nested Ethernet frames are not supported")
+		}
+		return PTPFromTunnelPayload(etherType, b)
+	case EtherTypeIPv4:
+		if len(b) < 20 || b[0]>>4 != 4 {
+			return nil, fmt.Errorf("not an IPv4 packet")
+		}
+		ihl := int(b[0]&0xf) * 4
+		if ihl < 20 || len(b) < ihl {
+			return nil, fmt.Errorf("bad IPv4 header length %d", ihl)
+		}
+		if b[9] != ipProtoUDP {
+			return nil, fmt.Errorf("IPv4 packet doesn't carry UDP but protocol %d", b[9])
+		}
+		return ptpFromUDP(b[ihl:])
+	case EtherTypeIPv6:
+		if len(b) < ipv6HeaderSize || b[0]>>4 != 6 {
+			return nil, fmt.Errorf("not an IPv6 packet")
+		}
+		if b[6] != ipProtoUDP {
+			return nil, fmt.Errorf("IPv6 packet doesn't carry UDP but next header %d", b[6])
+		}
+		return ptpFromUDP(b[ipv6HeaderSize:])
+	}
+	return nil, fmt.Errorf("unsupported tunnel payload protocol 0x%04x", proto)
+}
+
+// ptpFromUDP returns PTP message from UDP datagram sent to PTP port
+func ptpFromUDP(b []byte) ([]byte, error) {
+	if len(b) < udpHeaderSize {
+		return nil, fmt.Errorf("not enough data to decode UDP header")
+	}
+	dstPort := int(binary.BigEndian.Uint16(b[2:]))
+	if dstPort != PortEvent && dstPort != PortGeneral {
+		return nil, fmt.Errorf("UDP datagram is sent to port %d, not PTP", dstPort)
+	}
+	length := int(binary.BigEndian.Uint16(b[4:]))
+	if length < udpHeaderSize || length > len(b) {
+		return nil, fmt.Errorf("bad UDP length %d", length)
+	}
+	return b[udpHeaderSize:length], nil
+}
+
+// TunnelCorrection returns how much serializing overhead bytes of tunnel headers delays PTP message on a link of given speed.
+// When tunnel is only traversed in one direction it's a path asymmetry, which can be compensated by adding it to correctionField with AddCorrection.
+func TunnelCorrection(overhead int, bitsPerSecond uint64) Correction {
+	if bitsPerSecond == 0 {
+		return 0
+	}
+	return NewCorrection(float64(overhead) * 8 * float64(time.Second) / float64(bitsPerSecond))
+}
+
+// AddCorrection adds c to correctionField of marshaled PTP message in place, saturating to too big on overflow
+func AddCorrection(b []byte, c Correction) error {
+	if len(b) < headerSize {
+		return fmt.Errorf("not enough data to decode PTP header")
+	}
+	cf := Correction(binary.BigEndian.Uint64(b[8:]))
+	binary.BigEndian.PutUint64(b[8:], uint64(cf.Sum(c)))
+	return nil
+}
@@ -0,0 +1,206 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func tunnelTestPTP(t *testing.T) []byte {
+	packet := &SyncDelayReq{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageDelayReq, 0),
+			Version:         Version,
+			MessageLength:   44,
+			FlagField:       FlagUnicast,
+			SourcePortIdentity: PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: 36138748164966842,
+			},
+			SequenceID: 116,
+		},
+	}
+	b, err := Bytes(packet)
+	require.NoError(t, err)
+	return b[:44]
+}
+
+func tunnelTestUDP(ptp []byte, dstPort int) []byte {
+	b := make([]byte, udpHeaderSize+len(ptp))
+	binary.BigEndian.PutUint16(b, 12345)
+	binary.BigEndian.PutUint16(b[2:], uint16(dstPort))
+	binary.BigEndian.PutUint16(b[4:], uint16(len(b)))
+	copy(b[udpHeaderSize:], ptp)
+	return b
+}
+
+func tunnelTestIPv4(udp []byte) []byte {
+	b := make([]byte, 20+len(udp))
+	b[0] = 0x45
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+	b[8] = 64
+	b[9] = ipProtoUDP
+	copy(b[12:], []byte{192, 168, 0, 1, 192, 168, 0, 2})
+	binary.BigEndian.PutUint16(b[10:], internetChecksum(b[:20]))
+	copy(b[20:], udp)
+	return b
+}
+
+func tunnelTestIPv6(udp []byte) []byte {
+	b := make([]byte, ipv6HeaderSize+len(udp))
+	b[0] = 0x60
+	binary.BigEndian.PutUint16(b[4:], uint16(len(udp)))
+	b[6] = ipProtoUDP
+	b[7] = 64
+	copy(b[ipv6HeaderSize:], udp)
+	return b
+}
+
+func TestGREHeader(t *testing.T) {
+	for _, h := range []GREHeader{
+		{Protocol: EtherTypeIPv4},
+		{Protocol: EtherTypeIPv6, KeyPresent: true, Key: 42},
+		{Protocol: EtherTypeTransparentEthernet, ChecksumPresent: true, Checksum: 0x1234, KeyPresent: true, Key: 42, SeqPresent: true, Seq: 7},
+	} {
+		h := h
+		b := make([]byte, h.Len())
+		n, err := h.MarshalBinaryTo(b)
+		require.NoError(t, err)
+		require.Equal(t, h.Len(), n)
+		got := GREHeader{}
+		require.NoError(t, got.UnmarshalBinary(b))
+		require.Equal(t, h, got)
+		require.Error(t, got.UnmarshalBinary(b[:n-1]))
+		_, err = h.MarshalBinaryTo(b[:n-1])
+		require.Error(t, err)
+	}
+	require.Equal(t, 16, (&GREHeader{ChecksumPresent: true, KeyPresent: true, SeqPresent: true}).Len())
+
+	// enhanced GRE used by PPTP
+	got := GREHeader{}
+	require.Error(t, got.UnmarshalBinary([]byte{0x30, 0x01, 0x88, 0x0b, 0, 0, 0, 0}))
+}
+
+func TestGRERoundTrip(t *testing.T) {
+	ptp := tunnelTestPTP(t)
+	for _, inner := range []struct {
+		name  string
+		proto uint16
+		data  []byte
+	}{
+		{name: "IPv4", proto: EtherTypeIPv4, data: tunnelTestIPv4(tunnelTestUDP(ptp, PortEvent))},
+		{name: "IPv6", proto: EtherTypeIPv6, data: tunnelTestIPv6(tunnelTestUDP(ptp, PortGeneral))},
+	} {
+		t.Run(inner.name, func(t *testing.T) {
+			h := &GREHeader{Protocol: inner.proto, ChecksumPresent: true, KeyPresent: true, Key: 1}
+			b, err := EncapsulateGRE(h, inner.data)
+			require.NoError(t, err)
+			require.Len(t, b, h.Len()+len(inner.data))
+
+			got, payload, err := DecapsulateGRE(b)
+			require.NoError(t, err)
+			require.Equal(t, h, got)
+			msg, err := PTPFromTunnelPayload(got.Protocol, payload)
+			require.NoError(t, err)
+			require.Equal(t, ptp, msg)
+			_, err = DecodePacket(msg)
+			require.NoError(t, err)
+
+			// corrupted packet fails checksum verification
+			b[len(b)-1]++
+			_, _, err = DecapsulateGRE(b)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPTPFromTunnelPayloadEthernet(t *testing.T) {
+	ptp := tunnelTestPTP(t)
+	frame := make([]byte, ethHeaderSize+4)
+	binary.BigEndian.PutUint16(frame[12:], EtherTypeVLAN)
+	binary.BigEndian.PutUint16(frame[14:], 100)
+	binary.BigEndian.PutUint16(frame[16:], EtherTypePTP)
+	frame = append(frame, ptp...)
+	msg, err := PTPFromTunnelPayload(EtherTypeTransparentEthernet, frame)
+	require.NoError(t, err)
+	require.Equal(t, ptp, msg)
+
+	frame = make([]byte, ethHeaderSize)
+	binary.BigEndian.PutUint16(frame[12:], EtherTypeIPv6)
+	frame = append(frame, tunnelTestIPv6(tunnelTestUDP(ptp, PortEvent))...)
+	msg, err = PTPFromTunnelPayload(EtherTypeTransparentEthernet, frame)
+	require.NoError(t, err)
+	require.Equal(t, ptp, msg)
+
+	_, err = PTPFromTunnelPayload(EtherTypeTransparentEthernet, frame[:10])
+	require.Error(t, err)
+	_, err = PTPFromTunnelPayload(EtherTypeIPv6, tunnelTestIPv6(tunnelTestUDP(ptp, 123)))
+	require.Error(t, err)
+	_, err = PTPFromTunnelPayload(EtherTypeIPv4, tunnelTestIPv6(tunnelTestUDP(ptp, PortEvent)))
+	require.Error(t, err)
+	_, err = PTPFromTunnelPayload(0x1234, ptp)
+	require.Error(t, err)
+}
+
+func TestPPP(t *testing.T) {
+	ptp := tunnelTestPTP(t)
+	ip := tunnelTestIPv4(tunnelTestUDP(ptp, PortEvent))
+	b := EncapsulatePPP(PPPProtoIPv4, ip)
+	proto, payload, err := DecapsulatePPP(b)
+	require.NoError(t, err)
+	require.Equal(t, PPPProtoIPv4, proto)
+	require.Equal(t, ip, payload)
+
+	// address, control and protocol fields compressed
+	ip = tunnelTestIPv6(tunnelTestUDP(ptp, PortEvent))
+	proto, payload, err = DecapsulatePPP(append([]byte{0x57}, ip...))
+	require.NoError(t, err)
+	require.Equal(t, PPPProtoIPv6, proto)
+	require.Equal(t, ip, payload)
+
+	_, _, err = DecapsulatePPP([]byte{0xff, 0x03})
+	require.Error(t, err)
+	_, _, err = DecapsulatePPP([]byte{0x00})
+	require.Error(t, err)
+}
+
+func TestTunnelCorrection(t *testing.T) {
+	// 50 bytes of IPv4 + GRE + Ethernet headers at 1Gbit/s
+	c := TunnelCorrection(50, 1000000000)
+	require.Equal(t, 400.0, c.Nanoseconds())
+	require.Equal(t, Correction(0), TunnelCorrection(50, 0))
+
+	ptp := tunnelTestPTP(t)
+	require.NoError(t, AddCorrection(ptp, c))
+	require.NoError(t, AddCorrection(ptp, NewCorrection(float64(100*time.Nanosecond))))
+	p, err := DecodePacket(ptp)
+	require.NoError(t, err)
+	require.Equal(t, 500.0, p.(*SyncDelayReq).CorrectionField.Nanoseconds())
+	require.Error(t, AddCorrection(ptp[:10], c))
+}
+
+func TestAddCorrectionSaturates(t *testing.T) {
+	ptp := tunnelTestPTP(t)
+	binary.BigEndian.PutUint64(ptp[8:], uint64(math.MaxInt64-1))
+	require.NoError(t, AddCorrection(ptp, NewCorrection(1)))
+	require.True(t, Correction(binary.BigEndian.Uint64(ptp[8:])).TooBig())
+}
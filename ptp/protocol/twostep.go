@@ -0,0 +1,154 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"time"
+)
+
+// SyncOrigin is what Sync, together with FollowUp from two-step master, tells about the time it was sent
+type SyncOrigin struct {
+	Port       PortIdentity
+	SequenceID uint16
+	// T1 is the precise origin timestamp: originTimestamp of one-step Sync or preciseOriginTimestamp of FollowUp
+	T1 time.Time
+	// T2 is when Sync was received
+	T2 time.Time
+	// Correction is correctionField of Sync, plus correctionField of FollowUp for two-step master
+	Correction time.Duration
+	// TwoStep is set when T1 came from FollowUp
+	TwoStep bool
+}
+
+// syncStream is the state of Syncs from a single master port
+type syncStream struct {
+	// Sync waiting for FollowUp
+	pending    *SyncDelayReq
+	pendingRX  time.Time
+	hasPending bool
+	// FollowUp which arrived before its Sync
+	early    *FollowUp
+	hasEarly bool
+	// the latest origin we reported for one-step Sync, in case FollowUp proves it wrong
+	last    SyncOrigin
+	hasLast bool
+	// master was seen sending FollowUp, so Syncs without two-step flag need it too
+	twoStep bool
+	// master sets two-step flag, but never sends FollowUp
+	oneStep bool
+}
+
+// SyncMatcher yields precise origin timestamp of Syncs from both one-step and two-step masters,
+// pairing two-step Syncs with their FollowUps regardless of the order they arrive in.
+// It copes with masters setting two-step flag inconsistently: master which has been seen sending FollowUp
+// is waited for even if it forgets the flag, and master that sets the flag but never follows up is trusted with originTimestamp.
+// Only the latest Sync from each port is waited for. SyncMatcher is not safe for concurrent use
+type SyncMatcher struct {
+	streams map[PortIdentity]*syncStream
+}
+
+// NewSyncMatcher returns empty SyncMatcher
+func NewSyncMatcher() *SyncMatcher {
+	return &SyncMatcher{streams: map[PortIdentity]*syncStream{}}
+}
+
+func (m *SyncMatcher) stream(port PortIdentity) *syncStream {
+	s, found := m.streams[port]
+	if !found {
+		s = &syncStream{}
+		m.streams[port] = s
+	}
+	return s
+}
+
+// combine builds two-step origin from Sync and its FollowUp
+func combine(sync *SyncDelayReq, rx time.Time, followUp *FollowUp) *SyncOrigin {
+	return &SyncOrigin{
+		Port:       sync.SourcePortIdentity,
+		SequenceID: sync.SequenceID,
+		T1:         followUp.PreciseOriginTimestamp.Time(),
+		T2:         rx,
+		Correction: sync.CorrectionField.Sum(followUp.CorrectionField).Duration(),
+		TwoStep:    true,
+	}
+}
+
+// Sync processes Sync received at rx. It returns origin of the Sync, or nil if it has to wait for FollowUp
+func (m *SyncMatcher) Sync(sync *SyncDelayReq, rx time.Time) *SyncOrigin {
+	s := m.stream(sync.SourcePortIdentity)
+	if s.hasPending && s.pending.SequenceID != sync.SequenceID && !s.pending.OriginTimestamp.Empty() {
+		// previous Sync had origin timestamp and was never followed up
+		s.oneStep = true
+	}
+	s.hasPending = false
+
+	if s.hasEarly && s.early.SequenceID == sync.SequenceID {
+		s.hasEarly = false
+		s.twoStep = true
+		s.oneStep = false
+		return combine(sync, rx, s.early)
+	}
+
+	hasOrigin := !sync.OriginTimestamp.Empty()
+	wait := sync.FlagField&FlagTwoStep != 0 || s.twoStep || !hasOrigin
+	if s.oneStep && hasOrigin {
+		wait = false
+	}
+	if wait {
+		// keep a copy, as callers reuse their packets
+		p := *sync
+		s.pending = &p
+		s.pendingRX = rx
+		s.hasPending = true
+		return nil
+	}
+	s.last = SyncOrigin{
+		Port:       sync.SourcePortIdentity,
+		SequenceID: sync.SequenceID,
+		T1:         sync.OriginTimestamp.Time(),
+		T2:         rx,
+		Correction: sync.CorrectionField.Duration(),
+	}
+	s.hasLast = true
+	o := s.last
+	return &o
+}
+
+// FollowUp processes FollowUp. It returns origin of the Sync it follows, or nil if that Sync hasn't arrived yet.
+// FollowUp to Sync already reported as one-step yields corrected origin of that Sync
+func (m *SyncMatcher) FollowUp(followUp *FollowUp) *SyncOrigin {
+	s := m.stream(followUp.SourcePortIdentity)
+	s.twoStep = true
+	s.oneStep = false
+	if s.hasPending && s.pending.SequenceID == followUp.SequenceID {
+		s.hasPending = false
+		return combine(s.pending, s.pendingRX, followUp)
+	}
+	if s.hasLast && s.last.SequenceID == followUp.SequenceID {
+		// master is two-step, but didn't set the flag and filled in originTimestamp
+		s.hasLast = false
+		o := s.last
+		o.T1 = followUp.PreciseOriginTimestamp.Time()
+		o.Correction = NewCorrectionFromDuration(o.Correction).Sum(followUp.CorrectionField).Duration()
+		o.TwoStep = true
+		return &o
+	}
+	p := *followUp
+	s.early = &p
+	s.hasEarly = true
+	return nil
+}
@@ -0,0 +1,155 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	twoStepPort = PortIdentity{ClockIdentity: 1, PortNumber: 1}
+	twoStepT1   = time.Unix(1700000000, 100)
+	twoStepT1F  = time.Unix(1700000000, 150)
+	twoStepRX   = time.Unix(1700000000, 500)
+)
+
+func twoStepSync(seq uint16, flags uint16, origin time.Time) *SyncDelayReq {
+	s := &SyncDelayReq{
+		Header: Header{
+			SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageSync, 0),
+			FlagField:          flags,
+			SequenceID:         seq,
+			SourcePortIdentity: twoStepPort,
+			CorrectionField:    NewCorrection(10),
+		},
+	}
+	if !origin.IsZero() {
+		s.OriginTimestamp = NewTimestamp(origin)
+	}
+	return s
+}
+
+func twoStepFollowUp(seq uint16) *FollowUp {
+	return &FollowUp{
+		Header: Header{
+			SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageFollowUp, 0),
+			SequenceID:         seq,
+			SourcePortIdentity: twoStepPort,
+			CorrectionField:    NewCorrection(5),
+		},
+		FollowUpBody: FollowUpBody{
+			PreciseOriginTimestamp: NewTimestamp(twoStepT1F),
+		},
+	}
+}
+
+func TestSyncMatcherOneStep(t *testing.T) {
+	m := NewSyncMatcher()
+	o := m.Sync(twoStepSync(1, 0, twoStepT1), twoStepRX)
+	require.NotNil(t, o)
+	require.Equal(t, SyncOrigin{Port: twoStepPort, SequenceID: 1, T1: twoStepT1, T2: twoStepRX, Correction: 10}, *o)
+}
+
+func TestSyncMatcherTwoStep(t *testing.T) {
+	m := NewSyncMatcher()
+	require.Nil(t, m.Sync(twoStepSync(1, FlagTwoStep, time.Time{}), twoStepRX))
+	// FollowUp for another Sync is not matched
+	require.Nil(t, m.FollowUp(twoStepFollowUp(0)))
+	o := m.FollowUp(twoStepFollowUp(1))
+	require.NotNil(t, o)
+	require.Equal(t, SyncOrigin{Port: twoStepPort, SequenceID: 1, T1: twoStepT1F, T2: twoStepRX, Correction: 15, TwoStep: true}, *o)
+	// Sync is only matched once
+	require.Nil(t, m.FollowUp(twoStepFollowUp(1)))
+}
+
+func TestSyncMatcherFollowUpFirst(t *testing.T) {
+	m := NewSyncMatcher()
+	require.Nil(t, m.FollowUp(twoStepFollowUp(7)))
+	o := m.Sync(twoStepSync(7, FlagTwoStep, time.Time{}), twoStepRX)
+	require.NotNil(t, o)
+	require.Equal(t, twoStepT1F, o.T1)
+	require.Equal(t, twoStepRX, o.T2)
+	require.Equal(t, 15*time.Nanosecond, o.Correction)
+	require.True(t, o.TwoStep)
+}
+
+func TestSyncMatcherMissingFlag(t *testing.T) {
+	m := NewSyncMatcher()
+	// no two-step flag, but zero origin timestamp: has to be two-step
+	require.Nil(t, m.Sync(twoStepSync(1, 0, time.Time{}), twoStepRX))
+	require.NotNil(t, m.FollowUp(twoStepFollowUp(1)))
+
+	// once master sent FollowUp, its Syncs without the flag are waited for
+	require.Nil(t, m.Sync(twoStepSync(2, 0, twoStepT1), twoStepRX))
+	o := m.FollowUp(twoStepFollowUp(2))
+	require.NotNil(t, o)
+	require.Equal(t, twoStepT1F, o.T1)
+}
+
+func TestSyncMatcherLateFollowUp(t *testing.T) {
+	m := NewSyncMatcher()
+	// looks like one-step
+	o := m.Sync(twoStepSync(1, 0, twoStepT1), twoStepRX)
+	require.NotNil(t, o)
+	require.False(t, o.TwoStep)
+	// but FollowUp corrects it
+	o = m.FollowUp(twoStepFollowUp(1))
+	require.NotNil(t, o)
+	require.Equal(t, SyncOrigin{Port: twoStepPort, SequenceID: 1, T1: twoStepT1F, T2: twoStepRX, Correction: 15, TwoStep: true}, *o)
+}
+
+func TestSyncMatcherFlagWithoutFollowUp(t *testing.T) {
+	m := NewSyncMatcher()
+	// two-step flag is set, so we wait
+	require.Nil(t, m.Sync(twoStepSync(1, FlagTwoStep, twoStepT1), twoStepRX))
+	// FollowUp never came, but origin timestamp was there: trust it from now on
+	o := m.Sync(twoStepSync(2, FlagTwoStep, twoStepT1), twoStepRX)
+	require.NotNil(t, o)
+	require.Equal(t, twoStepT1, o.T1)
+	require.False(t, o.TwoStep)
+
+	// until master sends FollowUp after all
+	o = m.FollowUp(twoStepFollowUp(2))
+	require.NotNil(t, o)
+	require.True(t, o.TwoStep)
+	require.Nil(t, m.Sync(twoStepSync(3, FlagTwoStep, twoStepT1), twoStepRX))
+}
+
+func TestSyncMatcherPorts(t *testing.T) {
+	m := NewSyncMatcher()
+	require.Nil(t, m.Sync(twoStepSync(1, FlagTwoStep, time.Time{}), twoStepRX))
+	f := twoStepFollowUp(1)
+	f.SourcePortIdentity.PortNumber = 2
+	require.Nil(t, m.FollowUp(f))
+	require.NotNil(t, m.FollowUp(twoStepFollowUp(1)))
+}
+
+func TestSyncMatcherCopiesSync(t *testing.T) {
+	m := NewSyncMatcher()
+	s := twoStepSync(1, FlagTwoStep, time.Time{})
+	require.Nil(t, m.Sync(s, twoStepRX))
+	// packet is reused by the caller
+	s.SequenceID = 5
+	s.CorrectionField = NewCorrection(100)
+	o := m.FollowUp(twoStepFollowUp(1))
+	require.NotNil(t, o)
+	require.Equal(t, uint16(1), o.SequenceID)
+	require.Equal(t, 15*time.Nanosecond, o.Correction)
+}
@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -98,7 +100,18 @@ const (
 	TLVAcknowledgeCancelUnicastTransmission TLVType = 0x0007
 	TLVPathTrace                            TLVType = 0x0008
 	TLVAlternateTimeOffsetIndicator         TLVType = 0x0009
-	// Remaining 52 tlvType TLVs not implemented
+	TLVOrganizationExtensionPropagate       TLVType = 0x4000
+	TLVEnhancedAccuracyMetrics              TLVType = 0x4001
+	TLVOrganizationExtensionDoNotPropagate  TLVType = 0x8000
+	TLVL1Sync                               TLVType = 0x8001
+	TLVPortCommunicationAvailability        TLVType = 0x8002
+	TLVProtocolAddress                      TLVType = 0x8003
+	TLVSlaveRxSyncTimingData                TLVType = 0x8004
+	TLVSlaveRxSyncComputedData              TLVType = 0x8005
+	TLVSlaveTxEventTimestamps               TLVType = 0x8006
+	TLVCumulativeRateRatio                  TLVType = 0x8007
+	TLVPad                                  TLVType = 0x8008
+	TLVAuthentication                       TLVType = 0x8009
 )
 
 // TLVTypeToString is a map from TLVType to string
@@ -112,6 +125,18 @@ var TLVTypeToString = map[TLVType]string{
 	TLVAcknowledgeCancelUnicastTransmission: "ACKNOWLEDGE_CANCEL_UNICAST_TRANSMISSION",
 	TLVPathTrace:                            "PATH_TRACE",
 	TLVAlternateTimeOffsetIndicator:         "ALTERNATE_TIME_OFFSET_INDICATOR",
+	TLVOrganizationExtensionPropagate:       "ORGANIZATION_EXTENSION_PROPAGATE",
+	TLVEnhancedAccuracyMetrics:              "ENHANCED_ACCURACY_METRICS",
+	TLVOrganizationExtensionDoNotPropagate:  "ORGANIZATION_EXTENSION_DO_NOT_PROPAGATE",
+	TLVL1Sync:                               "L1_SYNC",
+	TLVPortCommunicationAvailability:        "PORT_COMMUNICATION_AVAILABILITY",
+	TLVProtocolAddress:                      "PROTOCOL_ADDRESS",
+	TLVSlaveRxSyncTimingData:                "SLAVE_RX_SYNC_TIMING_DATA",
+	TLVSlaveRxSyncComputedData:              "SLAVE_RX_SYNC_COMPUTED_DATA",
+	TLVSlaveTxEventTimestamps:               "SLAVE_TX_EVENT_TIMESTAMPS",
+	TLVCumulativeRateRatio:                  "CUMULATIVE_RATE_RATIO",
+	TLVPad:                                  "PAD",
+	TLVAuthentication:                       "AUTHENTICATION",
 }
 
 func (t TLVType) String() string {
@@ -143,9 +168,13 @@ func (t TimeInterval) String() string {
 	return fmt.Sprintf("TimeInterval(%.3fns)", t.Nanoseconds())
 }
 
-// NewTimeInterval returns TimeInterval built from Nanoseconds
+// NewTimeInterval returns TimeInterval built from Nanoseconds, saturating values that don't fit
 func NewTimeInterval(ns float64) TimeInterval {
-	return TimeInterval(ns * twoPow16)
+	t := ns * twoPow16
+	if t >= math.MaxInt64 || t <= math.MinInt64 {
+		return saturate(t > 0)
+	}
+	return TimeInterval(t)
 }
 
 /*
@@ -172,16 +201,17 @@ func (t Correction) String() string {
 
 // TooBig means correction is too big to be represented.
 func (t Correction) TooBig() bool {
-	return t == 0x7fffffffffffffff // one in all bits, except the most significant
+	return t == correctionTooBig // one in all bits, except the most significant
 }
 
-// NewCorrection returns Correction built from Nanoseconds
+// NewCorrection returns Correction built from Nanoseconds.
+// Values that don't fit are reported as too big, as the standard requires
 func NewCorrection(ns float64) Correction {
 	t := ns * twoPow16
-	if t > 0x7fffffffffffffff {
-		return Correction(0x7fffffffffffffff)
+	if t >= math.MaxInt64 || t <= math.MinInt64 {
+		return correctionTooBig
 	}
-	return Correction(ns * twoPow16)
+	return Correction(t)
 }
 
 // The ClockIdentity type identifies unique entities within a PTP Network, e.g. a PTP Instance or an entity of a common service.
@@ -197,6 +227,19 @@ func (c ClockIdentity) String() string {
 	)
 }
 
+// ParseClockIdentity parses ClockIdentity in the format produced by String, dots are optional
+func ParseClockIdentity(s string) (ClockIdentity, error) {
+	digits := strings.ReplaceAll(s, ".", "")
+	if len(digits) != 16 {
+		return 0, fmt.Errorf("invalid clock identity %q", s)
+	}
+	v, err := strconv.ParseUint(digits, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clock identity %q: %w", s, err)
+	}
+	return ClockIdentity(v), nil
+}
+
 // MAC turns ClockIdentity into the MAC address it was based upon. EUI-48 is assumed.
 func (c ClockIdentity) MAC() net.HardwareAddr {
 	asBytes := [8]byte{}
@@ -278,8 +321,7 @@ func (s PTPSeconds) Empty() bool {
 
 // Seconds returns number of seconds as uint64
 func (s PTPSeconds) Seconds() uint64 {
-	b := append([]byte{0x0, 0x0}, s[:]...)
-	return binary.BigEndian.Uint64(b)
+	return uint64(s[0])<<40 | uint64(s[1])<<32 | uint64(s[2])<<24 | uint64(s[3])<<16 | uint64(s[4])<<8 | uint64(s[5])
 }
 
 // Time returns number of seconds in as Time
@@ -303,12 +345,12 @@ func NewPTPSeconds(t time.Time) PTPSeconds {
 	if t.IsZero() {
 		return PTPSeconds{}
 	}
-	b := [8]byte{}
-	s := PTPSeconds{}
-	binary.BigEndian.PutUint64(b[:], uint64(t.Unix()))
-	// take last 6 bytes from 8 bytes of int64
-	copy(s[:], b[2:])
-	return s
+	return newPTPSecondsFromUint(uint64(t.Unix()))
+}
+
+// newPTPSecondsFromUint takes lower 48 bits of secs
+func newPTPSecondsFromUint(secs uint64) PTPSeconds {
+	return PTPSeconds{byte(secs >> 40), byte(secs >> 32), byte(secs >> 24), byte(secs >> 16), byte(secs >> 8), byte(secs)}
 }
 
 /*
@@ -350,14 +392,10 @@ func NewTimestamp(t time.Time) Timestamp {
 	if t.IsZero() {
 		return Timestamp{}
 	}
-	ts := Timestamp{
+	return Timestamp{
+		Seconds:     newPTPSecondsFromUint(uint64(t.Unix())),
 		Nanoseconds: uint32(t.Nanosecond()),
 	}
-	b := [8]byte{}
-	binary.BigEndian.PutUint64(b[:], uint64(t.Unix()))
-	// take last 6 bytes from 8 bytes of int64
-	copy(ts.Seconds[:], b[2:])
-	return ts
 }
 
 // ClockClass represents a PTP clock class
@@ -568,25 +606,9 @@ type PTPText string
 
 // UnmarshalBinary populates ptptext from bytes
 func (p *PTPText) UnmarshalBinary(rawBytes []byte) error {
-	var length uint8
-	reader := bytes.NewReader(rawBytes)
-	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
-		return fmt.Errorf("reading PTPText LengthField: %w", err)
-	}
-	if length == 0 {
-		// can be zero len, just empty string
-		return nil
-	}
-
-	if len(rawBytes) < int(length+1) {
-		return fmt.Errorf("text field is too short, need %d got %d", len(rawBytes), length+1)
-	}
-	text := make([]byte, length)
-	if err := binary.Read(reader, binary.BigEndian, text); err != nil {
-		return fmt.Errorf("reading PTPText TextField of len=%d: %w", length, err)
-	}
-	*p = PTPText(text)
-	return nil
+	r := reader{b: rawBytes}
+	r.text("PTPText", p)
+	return r.err
 }
 
 // MarshalBinary converts ptptext to []bytes
@@ -686,17 +708,11 @@ type PortAddress struct {
 
 // UnmarshalBinary converts bytes to PortAddress
 func (p *PortAddress) UnmarshalBinary(b []byte) error {
-	if len(b) < 8 {
-		return fmt.Errorf("not enough data to decode PortAddress")
-	}
-	p.NetworkProtocol = TransportType(binary.BigEndian.Uint16(b[0:]))
-	p.AddressLength = binary.BigEndian.Uint16(b[2:])
-	if len(b) < 4+int(p.AddressLength) {
-		return fmt.Errorf("not enough data to decode PortAddress address")
-	}
-	p.AddressField = make([]byte, p.AddressLength)
-	copy(p.AddressField, b[4:4+p.AddressLength])
-	return nil
+	r := reader{b: b}
+	p.NetworkProtocol = TransportType(r.uint16("PortAddress NetworkProtocol"))
+	p.AddressLength = r.uint16("PortAddress AddressLength")
+	p.AddressField = r.bytes("PortAddress AddressField", int(p.AddressLength))
+	return r.err
 }
 
 // IP converts PortAddress to IP
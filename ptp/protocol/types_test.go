@@ -91,6 +91,10 @@ func TestTLVTypeString(t *testing.T) {
 	require.Equal(t, "ACKNOWLEDGE_CANCEL_UNICAST_TRANSMISSION", TLVAcknowledgeCancelUnicastTransmission.String())
 	require.Equal(t, "PATH_TRACE", TLVPathTrace.String())
 	require.Equal(t, "ALTERNATE_TIME_OFFSET_INDICATOR", TLVAlternateTimeOffsetIndicator.String())
+	require.Equal(t, "ORGANIZATION_EXTENSION_DO_NOT_PROPAGATE", TLVOrganizationExtensionDoNotPropagate.String())
+	require.Equal(t, "L1_SYNC", TLVL1Sync.String())
+	require.Equal(t, "PAD", TLVPad.String())
+	require.Equal(t, "AUTHENTICATION", TLVAuthentication.String())
 }
 
 func TestTimeSourceString(t *testing.T) {
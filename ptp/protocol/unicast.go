@@ -56,32 +56,29 @@ func (p *Signaling) MarshalBinaryTo(b []byte) (int, error) {
 
 // MarshalBinary converts packet to []bytes
 func (p *Signaling) MarshalBinary() ([]byte, error) {
-	buf := make([]byte, 508)
+	buf := make([]byte, marshalBufferSize(headerSize+10, p.TLVs))
 	n, err := p.MarshalBinaryTo(buf)
 	return buf[:n], err
 }
 
 // UnmarshalBinary parses []byte and populates struct fields
 func (p *Signaling) UnmarshalBinary(b []byte) error {
-	if len(b) < headerSize+10+tlvHeadSize {
+	if len(b) < headerSize+10 {
 		return fmt.Errorf("not enough data to decode Signaling")
 	}
-
 	unmarshalHeader(&p.Header, b)
 	if err := checkPacketLength(&p.Header, len(b)); err != nil {
 		return err
 	}
-
 	if p.SdoIDAndMsgType.MsgType() != MessageSignaling {
 		return fmt.Errorf("not a signaling message %v", b)
 	}
-
 	p.TargetPortIdentity.ClockIdentity = ClockIdentity(binary.BigEndian.Uint64(b[headerSize:]))
 	p.TargetPortIdentity.PortNumber = binary.BigEndian.Uint16(b[headerSize+8:])
 
 	pos := headerSize + 10
 	var err error
-	p.TLVs, err = readTLVs(p.TLVs, int(p.MessageLength)-pos, b[pos:])
+	p.TLVs, err = readTLVs(p.TLVs[:0], int(p.MessageLength)-pos, reader{b: b[pos:]})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,424 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadgen
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// clockIdentityBase is "load" in upper bytes of clock identities of simulated clients
+	clockIdentityBase = 0x6c6f616400000000
+	// followUpTimeout is how long Follow Up may come after its Sync, Syncs without one by then count as TX timestamp failures
+	followUpTimeout = time.Second
+	// readTimeout bounds blocking reads, so clients notice the test is over
+	readTimeout = 100 * time.Millisecond
+	// pruneEvery is how many Syncs pass between looking for lost Follow Ups
+	pruneEvery = 256
+)
+
+// grantTypes are messages every client asks grants for
+var grantTypes = []ptp.MessageType{ptp.MessageAnnounce, ptp.MessageSync, ptp.MessageDelayResp}
+
+// clientResult is what a single client measured
+type clientResult struct {
+	granted          int
+	grantsDenied     int
+	grantsMissing    int
+	announces        int
+	syncs            int
+	twoStepSyncs     int
+	followUps        int
+	missingFollowUps int
+	delayReqs        int
+	delayResps       int
+	grantLatency     []time.Duration
+	syncJitter       []time.Duration
+}
+
+// subscribed returns true if client was granted everything it asked for
+func (r *clientResult) subscribed() bool {
+	return r.granted == len(grantTypes)
+}
+
+// client is a simulated unicast PTP client with its own address
+type client struct {
+	cfg       *Config
+	source    net.IP
+	identity  ptp.PortIdentity
+	eventAddr *net.UDPAddr
+	genAddr   *net.UDPAddr
+	eventConn *net.UDPConn
+	genConn   *net.UDPConn
+	eFd       int
+	// sequence IDs of sent messages, used by sending goroutine only
+	genSeq   uint16
+	eventSeq uint16
+
+	mux sync.Mutex
+	res clientResult
+	// requested is when grant of every message type was asked for, until it's answered
+	requested map[ptp.MessageType]time.Time
+	// interval is granted interval of every message type
+	interval map[ptp.MessageType]time.Duration
+	// arrival and sequence ID of the last Sync
+	lastSync    time.Time
+	lastSyncSeq uint16
+	haveSync    bool
+	// two-step Syncs waiting for Follow Up and Follow Ups which overtook their Syncs, by sequence ID
+	pending map[uint16]time.Time
+	early   map[uint16]time.Time
+}
+
+// newClient opens sockets of client number i on source address
+func newClient(cfg *Config, i int, source net.IP) (*client, error) {
+	c := &client{
+		cfg:       cfg,
+		source:    source,
+		identity:  ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(clockIdentityBase | uint64(i)), PortNumber: 1},
+		requested: map[ptp.MessageType]time.Time{},
+		interval:  map[ptp.MessageType]time.Duration{},
+		pending:   map[uint16]time.Time{},
+		early:     map[uint16]time.Time{},
+	}
+	var err error
+	if c.eventAddr, err = net.ResolveUDPAddr("udp", net.JoinHostPort(cfg.Server, strconv.Itoa(ptp.PortEvent))); err != nil {
+		return nil, err
+	}
+	if c.genAddr, err = net.ResolveUDPAddr("udp", net.JoinHostPort(cfg.Server, strconv.Itoa(ptp.PortGeneral))); err != nil {
+		return nil, err
+	}
+	// server sends Syncs to event port of the subscriber
+	if c.eventConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: source, Port: ptp.PortEvent}); err != nil {
+		return nil, err
+	}
+	// the rest goes wherever signaling came from
+	if c.genConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: source}); err != nil {
+		c.eventConn.Close()
+		return nil, err
+	}
+	if err = c.setupEventSocket(); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// setupEventSocket enables RX timestamps on event socket and makes its reads block for readTimeout at most
+func (c *client) setupEventSocket() error {
+	var err error
+	if c.eFd, err = timestamp.ConnFd(c.eventConn); err != nil {
+		return err
+	}
+	if err = timestamp.EnableSWTimestampsRx(c.eFd); err != nil {
+		return fmt.Errorf("enabling RX timestamps: %w", err)
+	}
+	if err = unix.SetNonblock(c.eFd, false); err != nil {
+		return fmt.Errorf("setting socket to blocking: %w", err)
+	}
+	tv := unix.NsecToTimeval(readTimeout.Nanoseconds())
+	return unix.SetsockoptTimeval(c.eFd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv)
+}
+
+func (c *client) close() {
+	c.eventConn.Close()
+	c.genConn.Close()
+}
+
+// run subscribes and keeps the subscription until ctx is cancelled, then cancels it
+func (c *client) run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.readEvent(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		c.readGeneral(ctx)
+	}()
+	err := c.send(ctx)
+	wg.Wait()
+	return err
+}
+
+// send asks for grants, renews them, and sends Delay_Req at granted rate
+func (c *client) send(ctx context.Context) error {
+	if err := c.requestGrants(time.Now()); err != nil {
+		return err
+	}
+	renew := time.NewTicker(c.cfg.GrantDuration * 3 / 4)
+	defer renew.Stop()
+	delayReq := time.NewTicker(c.cfg.DelayReqInterval.Duration())
+	defer delayReq.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return c.cancelGrants()
+		case <-renew.C:
+			if err := c.requestGrants(time.Now()); err != nil {
+				return err
+			}
+		case <-delayReq.C:
+			if !c.granted(ptp.MessageDelayResp) {
+				continue
+			}
+			if err := c.sendDelayReq(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// granted returns true if message type is currently granted
+func (c *client) granted(t ptp.MessageType) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	_, ok := c.interval[t]
+	return ok
+}
+
+// sendGeneral sends signaling to general port of the server
+func (c *client) sendGeneral(b *ptp.SignalingBuilder) error {
+	msg, err := b.Sequence(c.genSeq).Build()
+	if err != nil {
+		return err
+	}
+	data, err := ptp.Bytes(msg)
+	if err != nil {
+		return err
+	}
+	c.genSeq++
+	_, err = c.genConn.WriteTo(data, c.genAddr)
+	return err
+}
+
+// requestGrants asks for all grants at once
+func (c *client) requestGrants(now time.Time) error {
+	c.mux.Lock()
+	for _, t := range grantTypes {
+		if _, ok := c.requested[t]; ok {
+			// previous request was never answered
+			c.res.grantsMissing++
+		}
+		c.requested[t] = now
+	}
+	c.mux.Unlock()
+	return c.sendGeneral(ptp.NewSignalingBuilder(c.identity, ptp.DefaultTargetPortIdentity, c.cfg.Domain).
+		RequestUnicast(ptp.MessageAnnounce, c.cfg.AnnounceInterval, c.cfg.GrantDuration).
+		RequestUnicast(ptp.MessageSync, c.cfg.SyncInterval, c.cfg.GrantDuration).
+		RequestUnicast(ptp.MessageDelayResp, c.cfg.DelayReqInterval, c.cfg.GrantDuration))
+}
+
+// cancelGrants tells server the client is gone
+func (c *client) cancelGrants() error {
+	b := ptp.NewSignalingBuilder(c.identity, ptp.DefaultTargetPortIdentity, c.cfg.Domain)
+	for _, t := range grantTypes {
+		b.CancelUnicast(t)
+	}
+	return c.sendGeneral(b)
+}
+
+// sendDelayReq sends Delay_Req to event port of the server
+func (c *client) sendDelayReq() error {
+	msg := &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageDelayReq, 0),
+			Version:            ptp.Version,
+			MessageLength:      uint16(binary.Size(ptp.SyncDelayReq{})),
+			DomainNumber:       c.cfg.Domain,
+			FlagField:          ptp.FlagUnicast,
+			SequenceID:         c.eventSeq,
+			SourcePortIdentity: c.identity,
+			LogMessageInterval: 0x7f,
+		},
+	}
+	data, err := ptp.Bytes(msg)
+	if err != nil {
+		return err
+	}
+	c.eventSeq++
+	if _, err = c.eventConn.WriteTo(data, c.eventAddr); err != nil {
+		return err
+	}
+	c.mux.Lock()
+	c.res.delayReqs++
+	c.mux.Unlock()
+	return nil
+}
+
+// readEvent reads Syncs with their RX timestamps until ctx is cancelled
+func (c *client) readEvent(ctx context.Context) {
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	for ctx.Err() == nil {
+		n, _, rxTS, err := timestamp.ReadPacketWithRXTimestampBuf(c.eFd, buf, oob)
+		if err != nil {
+			if !errors.Is(err, unix.EAGAIN) && !errors.Is(err, unix.EINTR) {
+				log.Debugf("Client on %s failed to read event message: %v", c.source, err)
+			}
+			continue
+		}
+		c.handleEvent(buf[:n], rxTS)
+	}
+}
+
+// readGeneral reads general messages until ctx is cancelled
+func (c *client) readGeneral(ctx context.Context) {
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	for ctx.Err() == nil {
+		if err := c.genConn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+			log.Debugf("Client on %s failed to set read deadline: %v", c.source, err)
+			return
+		}
+		n, _, err := c.genConn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Debugf("Client on %s failed to read general message: %v", c.source, err)
+			}
+			continue
+		}
+		c.handleGeneral(buf[:n], time.Now())
+	}
+}
+
+// handleEvent accounts Sync which arrived at rxTS
+func (c *client) handleEvent(b []byte, rxTS time.Time) {
+	p, err := ptp.DecodePacket(b)
+	if err != nil {
+		log.Debugf("Client on %s got bad event message: %v", c.source, err)
+		return
+	}
+	msg, ok := p.(*ptp.SyncDelayReq)
+	if !ok || msg.MessageType() != ptp.MessageSync {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.res.syncs++
+	seq := msg.SequenceID
+	if interval, ok := c.interval[ptp.MessageSync]; ok && c.haveSync && seq == c.lastSyncSeq+1 {
+		jitter := rxTS.Sub(c.lastSync) - interval
+		if jitter < 0 {
+			jitter = -jitter
+		}
+		c.res.syncJitter = append(c.res.syncJitter, jitter)
+	}
+	c.lastSync, c.lastSyncSeq, c.haveSync = rxTS, seq, true
+
+	if msg.FlagField&ptp.FlagTwoStep == 0 {
+		return
+	}
+	c.res.twoStepSyncs++
+	if _, ok := c.early[seq]; ok {
+		delete(c.early, seq)
+		c.res.followUps++
+	} else {
+		c.pending[seq] = rxTS
+	}
+	if c.res.syncs%pruneEvery == 0 {
+		c.prune(rxTS)
+	}
+}
+
+// prune counts Syncs whose Follow Up didn't come in time as TX timestamp failures, and forgets stale Follow Ups.
+// Sequence IDs wrap around, so they can't be kept forever
+func (c *client) prune(now time.Time) {
+	for seq, ts := range c.pending {
+		if now.Sub(ts) > followUpTimeout {
+			delete(c.pending, seq)
+			c.res.missingFollowUps++
+		}
+	}
+	for seq, ts := range c.early {
+		if now.Sub(ts) > followUpTimeout {
+			delete(c.early, seq)
+		}
+	}
+}
+
+// handleGeneral accounts general message which arrived at now
+func (c *client) handleGeneral(b []byte, now time.Time) {
+	p, err := ptp.DecodePacket(b)
+	if err != nil {
+		log.Debugf("Client on %s got bad general message: %v", c.source, err)
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	switch v := p.(type) {
+	case *ptp.Signaling:
+		for _, tlv := range v.TLVs {
+			switch t := tlv.(type) {
+			case *ptp.GrantUnicastTransmissionTLV:
+				c.handleGrant(t, now)
+			case *ptp.CancelUnicastTransmissionTLV:
+				delete(c.interval, t.MsgTypeAndFlags.MsgType())
+			}
+		}
+	case *ptp.FollowUp:
+		if _, ok := c.pending[v.SequenceID]; ok {
+			delete(c.pending, v.SequenceID)
+			c.res.followUps++
+		} else {
+			c.early[v.SequenceID] = now
+		}
+	case *ptp.Announce:
+		c.res.announces++
+	case *ptp.DelayResp:
+		c.res.delayResps++
+	}
+}
+
+// handleGrant records grant latency and granted interval, or denial
+func (c *client) handleGrant(t *ptp.GrantUnicastTransmissionTLV, now time.Time) {
+	msgType := t.MsgTypeAndReserved.MsgType()
+	if requested, ok := c.requested[msgType]; ok {
+		c.res.grantLatency = append(c.res.grantLatency, now.Sub(requested))
+		delete(c.requested, msgType)
+	}
+	if t.DurationField == 0 {
+		c.res.grantsDenied++
+		delete(c.interval, msgType)
+		return
+	}
+	c.interval[msgType] = t.LogInterMessagePeriod.Duration()
+}
+
+// result returns what client measured by now
+func (c *client) result(now time.Time) *clientResult {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.prune(now)
+	res := c.res
+	res.granted = len(c.interval)
+	res.grantsMissing += len(c.requested)
+	return &res
+}
@@ -0,0 +1,223 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadgen
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+var serverIdentity = ptp.PortIdentity{ClockIdentity: 1, PortNumber: 1}
+
+func newTestClient() *client {
+	return &client{
+		cfg:       &Config{},
+		requested: map[ptp.MessageType]time.Time{},
+		interval:  map[ptp.MessageType]time.Duration{},
+		pending:   map[uint16]time.Time{},
+		early:     map[uint16]time.Time{},
+	}
+}
+
+func grantBytes(t *testing.T, msgType ptp.MessageType, interval ptp.LogInterval, duration time.Duration) []byte {
+	msg, err := ptp.NewSignalingBuilder(serverIdentity, ptp.DefaultTargetPortIdentity, 0).GrantUnicast(msgType, interval, duration, false).Build()
+	require.NoError(t, err)
+	b, err := ptp.Bytes(msg)
+	require.NoError(t, err)
+	return b
+}
+
+func syncBytes(t *testing.T, seq uint16, twoStep bool) []byte {
+	flags := ptp.FlagUnicast
+	if twoStep {
+		flags |= ptp.FlagTwoStep
+	}
+	b, err := ptp.Bytes(&ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageSync, 0),
+			Version:            ptp.Version,
+			MessageLength:      uint16(binary.Size(ptp.SyncDelayReq{})),
+			FlagField:          flags,
+			SequenceID:         seq,
+			SourcePortIdentity: serverIdentity,
+		},
+	})
+	require.NoError(t, err)
+	return b
+}
+
+func followUpBytes(t *testing.T, seq uint16) []byte {
+	b, err := ptp.Bytes(&ptp.FollowUp{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageFollowUp, 0),
+			Version:            ptp.Version,
+			MessageLength:      uint16(binary.Size(ptp.FollowUp{})),
+			FlagField:          ptp.FlagUnicast,
+			SequenceID:         seq,
+			SourcePortIdentity: serverIdentity,
+		},
+	})
+	require.NoError(t, err)
+	return b
+}
+
+func TestClientGrants(t *testing.T) {
+	c := newTestClient()
+	start := time.Now()
+	for _, mt := range grantTypes {
+		c.requested[mt] = start
+	}
+
+	c.handleGeneral(grantBytes(t, ptp.MessageAnnounce, 1, time.Minute), start.Add(time.Millisecond))
+	c.handleGeneral(grantBytes(t, ptp.MessageSync, -4, time.Minute), start.Add(2*time.Millisecond))
+	c.handleGeneral(grantBytes(t, ptp.MessageDelayResp, -4, 0), start.Add(3*time.Millisecond))
+
+	res := c.result(start)
+	require.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond}, res.grantLatency)
+	require.Equal(t, 1, res.grantsDenied)
+	require.Equal(t, 0, res.grantsMissing)
+	require.Equal(t, 2, res.granted)
+	require.False(t, res.subscribed())
+	require.True(t, c.granted(ptp.MessageSync))
+	require.False(t, c.granted(ptp.MessageDelayResp))
+	require.Equal(t, 62500*time.Microsecond, c.interval[ptp.MessageSync])
+}
+
+func TestClientSyncs(t *testing.T) {
+	c := newTestClient()
+	c.interval[ptp.MessageSync] = 100 * time.Millisecond
+	start := time.Now()
+
+	c.handleEvent(syncBytes(t, 0, true), start)
+	c.handleGeneral(followUpBytes(t, 0), start)
+	c.handleEvent(syncBytes(t, 1, true), start.Add(110*time.Millisecond))
+	// Follow Up overtaking its Sync still counts
+	c.handleGeneral(followUpBytes(t, 2), start.Add(190*time.Millisecond))
+	c.handleEvent(syncBytes(t, 2, true), start.Add(195*time.Millisecond))
+	// lost Sync doesn't count towards jitter
+	c.handleEvent(syncBytes(t, 4, false), start.Add(400*time.Millisecond))
+
+	res := c.result(start.Add(200 * time.Millisecond))
+	require.Equal(t, 4, res.syncs)
+	require.Equal(t, 3, res.twoStepSyncs)
+	require.Equal(t, 2, res.followUps)
+	require.Equal(t, 0, res.missingFollowUps, "Follow Up of Sync 1 may still come")
+	require.Equal(t, []time.Duration{10 * time.Millisecond, 15 * time.Millisecond}, res.syncJitter)
+
+	res = c.result(start.Add(2 * time.Second))
+	require.Equal(t, 1, res.missingFollowUps)
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	// fake server on 127.0.0.1 talks to client on 127.0.0.2, both on the same ports
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer server.Close()
+	event, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer event.Close()
+	origGeneral, origEvent := ptp.PortGeneral, ptp.PortEvent
+	defer func() { ptp.PortGeneral, ptp.PortEvent = origGeneral, origEvent }()
+	ptp.PortGeneral = server.LocalAddr().(*net.UDPAddr).Port
+	ptp.PortEvent = event.LocalAddr().(*net.UDPAddr).Port
+
+	cfg := &Config{
+		Server:           "127.0.0.1",
+		AnnounceInterval: 1,
+		SyncInterval:     -4,
+		DelayReqInterval: -4,
+		GrantDuration:    time.Minute,
+		Duration:         time.Minute,
+	}
+	c, err := newClient(cfg, 1, net.ParseIP("127.0.0.2"))
+	require.NoError(t, err)
+	defer c.close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.run(ctx)
+	}()
+
+	// grant request
+	buf := make([]byte, 1500)
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(time.Second)))
+	n, from, err := server.ReadFromUDP(buf)
+	require.NoError(t, err)
+	req := &ptp.Signaling{}
+	require.NoError(t, ptp.FromBytes(buf[:n], req))
+	require.Len(t, req.TLVs, 3)
+	require.Equal(t, ptp.ClockIdentity(clockIdentityBase|1), req.SourcePortIdentity.ClockIdentity)
+	for _, mt := range grantTypes {
+		_, err = server.WriteToUDP(grantBytes(t, mt, -4, time.Minute), from)
+		require.NoError(t, err)
+	}
+
+	// Delay_Req once DelayResp is granted
+	require.NoError(t, event.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err = event.ReadFromUDP(buf)
+	require.NoError(t, err)
+	dreq := &ptp.SyncDelayReq{}
+	require.NoError(t, ptp.FromBytes(buf[:n], dreq))
+	require.Equal(t, ptp.MessageDelayReq, dreq.MessageType())
+
+	// Syncs go to event port of the client
+	clientEvent := &net.UDPAddr{IP: net.ParseIP("127.0.0.2"), Port: ptp.PortEvent}
+	for seq := uint16(0); seq < 3; seq++ {
+		_, err = event.WriteToUDP(syncBytes(t, seq, true), clientEvent)
+		require.NoError(t, err)
+		if seq < 2 {
+			_, err = server.WriteToUDP(followUpBytes(t, seq), from)
+			require.NoError(t, err)
+		}
+	}
+	require.Eventually(t, func() bool {
+		return c.result(time.Now()).followUps == 2
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+	// cancel of every grant
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(time.Second)))
+	cancelled := map[ptp.MessageType]bool{}
+	for len(cancelled) == 0 {
+		n, _, err = server.ReadFromUDP(buf)
+		require.NoError(t, err)
+		msg := &ptp.Signaling{}
+		require.NoError(t, ptp.FromBytes(buf[:n], msg))
+		for _, tlv := range msg.TLVs {
+			if v, ok := tlv.(*ptp.CancelUnicastTransmissionTLV); ok {
+				cancelled[v.MsgTypeAndFlags.MsgType()] = true
+			}
+		}
+	}
+	require.Len(t, cancelled, len(grantTypes))
+
+	res := c.result(time.Now().Add(2 * time.Second))
+	require.True(t, res.subscribed())
+	require.Equal(t, 3, res.syncs)
+	require.Equal(t, 2, res.followUps)
+	require.Equal(t, 1, res.missingFollowUps)
+	require.Len(t, res.grantLatency, 3)
+	require.Len(t, res.syncJitter, 2)
+	require.GreaterOrEqual(t, res.delayReqs, 1)
+}
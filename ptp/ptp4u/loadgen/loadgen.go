@@ -0,0 +1,247 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package loadgen simulates many unicast PTP clients subscribing to a running ptp4u,
+so its capacity can be measured without a fleet of real hosts.
+Every client negotiates Announce, Sync and DelayResp grants, sends Delay_Req at granted rate
+and records grant latency, Sync arrival jitter and Syncs whose Follow Up never came.
+*/
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errNoSources   = errors.New("at least one source address is required")
+	errNoServer    = errors.New("server address is required")
+	errNoDuration  = errors.New("test duration must be positive")
+	errNoGrantTime = errors.New("grant duration must be at least a second")
+)
+
+// Config of the load test
+type Config struct {
+	// Server is address of ptp4u to load
+	Server string
+	// Sources are local addresses simulated clients bind to, one client per address.
+	// Unicast Syncs are sent to event port of the subscriber, so clients can't share an address
+	Sources []net.IP
+	// Domain to subscribe in
+	Domain uint8
+	// AnnounceInterval, SyncInterval and DelayReqInterval are intervals requested in grants.
+	// Delay_Req is sent every DelayReqInterval
+	AnnounceInterval ptp.LogInterval
+	SyncInterval     ptp.LogInterval
+	DelayReqInterval ptp.LogInterval
+	// GrantDuration is requested grant duration, grants are renewed once 3/4 of it passed
+	GrantDuration time.Duration
+	// Duration of the test after all clients started
+	Duration time.Duration
+	// RampUp is time to spread subscription of clients over
+	RampUp time.Duration
+}
+
+// Validate checks the config is usable
+func (c *Config) Validate() error {
+	if c.Server == "" {
+		return errNoServer
+	}
+	if len(c.Sources) == 0 {
+		return errNoSources
+	}
+	if c.Duration <= 0 {
+		return errNoDuration
+	}
+	if c.GrantDuration < time.Second {
+		return errNoGrantTime
+	}
+	if c.RampUp < 0 {
+		return fmt.Errorf("ramp up must be 0 or positive")
+	}
+	return nil
+}
+
+// Sources returns n consecutive addresses of the prefix, starting with its first host address
+func Sources(prefix string, n int) ([]net.IP, error) {
+	ip, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() != nil {
+		ip = ip.To4()
+	}
+	ones, bits := ipnet.Mask.Size()
+	if bits-ones < 63 && n >= 1<<(bits-ones) {
+		return nil, fmt.Errorf("prefix %s doesn't have %d host addresses", prefix, n)
+	}
+	first := new(big.Int).SetBytes(ipnet.IP.Mask(ipnet.Mask))
+	res := make([]net.IP, 0, n)
+	for i := 1; i <= n; i++ {
+		b := new(big.Int).Add(first, big.NewInt(int64(i))).Bytes()
+		addr := make(net.IP, len(ip))
+		copy(addr[len(addr)-len(b):], b)
+		res = append(res, addr)
+	}
+	return res, nil
+}
+
+// Summary describes distribution of durations
+type Summary struct {
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"mean_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+// summarize returns distribution of values, which get sorted
+func summarize(values []time.Duration) Summary {
+	if len(values) == 0 {
+		return Summary{}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	var sum time.Duration
+	for _, v := range values {
+		sum += v
+	}
+	return Summary{
+		Count: len(values),
+		Mean:  sum / time.Duration(len(values)),
+		P50:   values[(len(values)-1)*50/100],
+		P99:   values[(len(values)-1)*99/100],
+		Max:   values[len(values)-1],
+	}
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("mean %v, p50 %v, p99 %v, max %v (%d samples)", s.Mean, s.P50, s.P99, s.Max, s.Count)
+}
+
+// Report is the outcome of the load test
+type Report struct {
+	Clients int `json:"clients"`
+	// Subscribed is how many clients got all grants they asked for
+	Subscribed       int `json:"subscribed"`
+	GrantsDenied     int `json:"grants_denied"`
+	GrantsMissing    int `json:"grants_missing"`
+	Announces        int `json:"announces"`
+	Syncs            int `json:"syncs"`
+	FollowUps        int `json:"follow_ups"`
+	DelayReqs        int `json:"delay_reqs"`
+	DelayResps       int `json:"delay_resps"`
+	MissingFollowUps int `json:"missing_follow_ups"`
+	// TXTSFailureRate is share of two-step Syncs which never got Follow Up, as server sends none if it can't read TX timestamp
+	TXTSFailureRate float64 `json:"txts_failure_rate"`
+	GrantLatency    Summary `json:"grant_latency"`
+	// SyncJitter is deviation of time between consecutive Syncs from the granted interval
+	SyncJitter Summary `json:"sync_jitter"`
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "clients:          %d, subscribed %d\n", r.Clients, r.Subscribed)
+	fmt.Fprintf(&b, "grants:           %d denied, %d not answered\n", r.GrantsDenied, r.GrantsMissing)
+	fmt.Fprintf(&b, "grant latency:    %s\n", r.GrantLatency)
+	fmt.Fprintf(&b, "sync jitter:      %s\n", r.SyncJitter)
+	fmt.Fprintf(&b, "messages:         %d announce, %d sync, %d follow up, %d delay req, %d delay resp\n", r.Announces, r.Syncs, r.FollowUps, r.DelayReqs, r.DelayResps)
+	fmt.Fprintf(&b, "txts failures:    %d (%.4f%%)\n", r.MissingFollowUps, r.TXTSFailureRate*100)
+	return b.String()
+}
+
+// add accounts results of a single client
+func (r *Report) add(res *clientResult) {
+	r.Clients++
+	if res.subscribed() {
+		r.Subscribed++
+	}
+	r.GrantsDenied += res.grantsDenied
+	r.GrantsMissing += res.grantsMissing
+	r.Announces += res.announces
+	r.Syncs += res.syncs
+	r.FollowUps += res.followUps
+	r.DelayReqs += res.delayReqs
+	r.DelayResps += res.delayResps
+	r.MissingFollowUps += res.missingFollowUps
+}
+
+// Run runs the load test until it's over or ctx is cancelled and reports the outcome
+func Run(ctx context.Context, cfg *Config) (*Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	clients := make([]*client, 0, len(cfg.Sources))
+	for i, src := range cfg.Sources {
+		c, err := newClient(cfg, i, src)
+		if err != nil {
+			for _, c := range clients {
+				c.close()
+			}
+			return nil, fmt.Errorf("starting client on %s: %w", src, err)
+		}
+		clients = append(clients, c)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.RampUp+cfg.Duration)
+	defer cancel()
+	log.Infof("Starting %d clients over %v", len(clients), cfg.RampUp)
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *client) {
+			defer wg.Done()
+			defer c.close()
+			delay := cfg.RampUp * time.Duration(i) / time.Duration(len(clients))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			if err := c.run(ctx); err != nil {
+				log.Errorf("Client on %s failed: %v", c.source, err)
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	r := &Report{}
+	var grantLatency, syncJitter []time.Duration
+	twoStep := 0
+	for _, c := range clients {
+		res := c.result(time.Now())
+		r.add(res)
+		twoStep += res.twoStepSyncs
+		grantLatency = append(grantLatency, res.grantLatency...)
+		syncJitter = append(syncJitter, res.syncJitter...)
+	}
+	if twoStep > 0 {
+		r.TXTSFailureRate = float64(r.MissingFollowUps) / float64(twoStep)
+	}
+	r.GrantLatency = summarize(grantLatency)
+	r.SyncJitter = summarize(syncJitter)
+	return r, nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadgen
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSources(t *testing.T) {
+	ips, err := Sources("127.0.1.0/24", 3)
+	require.NoError(t, err)
+	require.Equal(t, []net.IP{net.ParseIP("127.0.1.1").To4(), net.ParseIP("127.0.1.2").To4(), net.ParseIP("127.0.1.3").To4()}, ips)
+
+	ips, err = Sources("2001:db8::/64", 2)
+	require.NoError(t, err)
+	require.Equal(t, []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")}, ips)
+
+	_, err = Sources("127.0.1.0/30", 4)
+	require.EqualError(t, err, "prefix 127.0.1.0/30 doesn't have 4 host addresses")
+	_, err = Sources("127.0.1.0", 1)
+	require.Error(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	c := &Config{
+		Server:        "::1",
+		Sources:       []net.IP{net.ParseIP("::1")},
+		GrantDuration: time.Minute,
+		Duration:      time.Minute,
+	}
+	require.NoError(t, c.Validate())
+
+	bad := *c
+	bad.Server = ""
+	require.ErrorIs(t, bad.Validate(), errNoServer)
+	bad = *c
+	bad.Sources = nil
+	require.ErrorIs(t, bad.Validate(), errNoSources)
+	bad = *c
+	bad.Duration = 0
+	require.ErrorIs(t, bad.Validate(), errNoDuration)
+	bad = *c
+	bad.GrantDuration = time.Millisecond
+	require.ErrorIs(t, bad.Validate(), errNoGrantTime)
+	bad = *c
+	bad.RampUp = -time.Second
+	require.Error(t, bad.Validate())
+}
+
+func TestSummarize(t *testing.T) {
+	require.Equal(t, Summary{}, summarize(nil))
+
+	values := []time.Duration{}
+	for i := 100; i > 0; i-- {
+		values = append(values, time.Duration(i)*time.Millisecond)
+	}
+	s := summarize(values)
+	require.Equal(t, 100, s.Count)
+	require.Equal(t, 50500*time.Microsecond, s.Mean)
+	require.Equal(t, 50*time.Millisecond, s.P50)
+	require.Equal(t, 99*time.Millisecond, s.P99)
+	require.Equal(t, 100*time.Millisecond, s.Max)
+}
+
+func TestReportAdd(t *testing.T) {
+	r := &Report{}
+	r.add(&clientResult{granted: len(grantTypes), syncs: 10, followUps: 9, missingFollowUps: 1, grantsDenied: 0})
+	r.add(&clientResult{granted: 1, grantsDenied: 2, grantsMissing: 1})
+	require.Equal(t, 2, r.Clients)
+	require.Equal(t, 1, r.Subscribed)
+	require.Equal(t, 2, r.GrantsDenied)
+	require.Equal(t, 1, r.GrantsMissing)
+	require.Equal(t, 10, r.Syncs)
+	require.Equal(t, 9, r.FollowUps)
+	require.Equal(t, 1, r.MissingFollowUps)
+	require.Contains(t, r.String(), "clients:          2, subscribed 1")
+}
@@ -0,0 +1,130 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// ACLConfig is a list of IPs or subnets of subscribers allowed to be served and of ones denied.
+// The longest matching prefix decides, deny wins over allow of the same length.
+// Subscribers not matching any prefix are allowed only if there is no allow list
+type ACLConfig struct {
+	Allow []string `yaml:"allow,omitempty"`
+	Deny  []string `yaml:"deny,omitempty"`
+}
+
+// acl is ACLConfig parsed once, as it's checked for every packet
+type acl struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// parsePrefixes parses IPs or subnets, skipping invalid ones and returning the first error
+func parsePrefixes(prefixes []string) ([]*net.IPNet, error) {
+	var firstErr error
+	nets := make([]*net.IPNet, 0, len(prefixes))
+	for _, p := range prefixes {
+		n, err := parseClientPrefix(p)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets, firstErr
+}
+
+// newACL parses ACL config. If some prefixes are invalid, it returns error along with ACL of the valid ones
+func newACL(c *ACLConfig) (*acl, error) {
+	allow, allowErr := parsePrefixes(c.Allow)
+	deny, denyErr := parsePrefixes(c.Deny)
+	a := &acl{allow: allow, deny: deny}
+	if allowErr != nil {
+		return a, fmt.Errorf("invalid allowed prefix: %w", allowErr)
+	}
+	if denyErr != nil {
+		return a, fmt.Errorf("invalid denied prefix: %w", denyErr)
+	}
+	return a, nil
+}
+
+// ACLSanity checks if all ACL prefixes are valid IPs or subnets
+func (dc *DynamicConfig) ACLSanity() error {
+	_, err := newACL(&dc.ACL)
+	return err
+}
+
+// longestMatch returns length of the longest prefix containing ip, -1 if none does
+func longestMatch(nets []*net.IPNet, ip net.IP) int {
+	best := -1
+	for _, n := range nets {
+		if !n.Contains(ip) {
+			continue
+		}
+		if l, _ := n.Mask.Size(); l > best {
+			best = l
+		}
+	}
+	return best
+}
+
+// allowed checks if ACL allows subscriber to be served
+func (a *acl) allowed(ip net.IP) bool {
+	if len(a.allow) == 0 && len(a.deny) == 0 {
+		return true
+	}
+	allow := longestMatch(a.allow, ip)
+	deny := longestMatch(a.deny, ip)
+	if deny >= 0 && deny >= allow {
+		return false
+	}
+	return allow >= 0 || len(a.allow) == 0
+}
+
+// resetACL parses ACL and publishes it for packet handlers.
+// Must be called under dcMux whenever ACL changes once server is running
+func (c *Config) resetACL() *acl {
+	// ACL is validated when config is read, so invalid prefixes can only come from config built in code
+	a, _ := newACL(&c.ACL)
+	c.acl.Store(a)
+	return a
+}
+
+// Allowed checks if ACL allows subscriber to be served
+func (c *Config) Allowed(ip net.IP) bool {
+	a, _ := c.acl.Load().(*acl)
+	// Server.Start publishes ACL, config used on its own parses it on first use
+	if a == nil {
+		a = c.resetACL()
+	}
+	return a.allowed(ip)
+}
+
+// allowed checks if ACL allows subscriber to be served and counts message of type t from it otherwise
+func (s *Server) allowed(ip net.IP, t ptp.MessageType) bool {
+	if s.Config.Allowed(ip) {
+		return true
+	}
+	s.Stats.IncACLDenied(t)
+	return false
+}
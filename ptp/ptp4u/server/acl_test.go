@@ -0,0 +1,131 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// aclStats records requests denied by ACL, rest of stats.Stats is not used
+type aclStats struct {
+	stats.Stats
+	denied map[ptp.MessageType]int
+}
+
+func (s *aclStats) IncRX(_ ptp.MessageType) {}
+
+func (s *aclStats) IncACLDenied(t ptp.MessageType) {
+	s.denied[t]++
+}
+
+func TestACLSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.ACLSanity())
+
+	dc.ACL = ACLConfig{Allow: []string{"10.0.0.0/8", "2401:db00::1"}, Deny: []string{"10.1.0.0/16"}}
+	require.NoError(t, dc.ACLSanity())
+
+	dc.ACL = ACLConfig{Allow: []string{"nope"}}
+	require.EqualError(t, dc.ACLSanity(), `invalid allowed prefix: invalid IP address "nope"`)
+	dc.ACL = ACLConfig{Deny: []string{"10.0.0.0/33"}}
+	require.EqualError(t, dc.ACLSanity(), "invalid denied prefix: invalid CIDR address: 10.0.0.0/33")
+}
+
+func TestConfigAllowed(t *testing.T) {
+	c := &Config{}
+	// everyone is allowed without ACL
+	require.True(t, c.Allowed(net.ParseIP("192.168.0.1")))
+
+	c.ACL.Deny = []string{"10.0.0.0/8"}
+	// ACL is parsed once, changes are picked up only when it's reset
+	require.True(t, c.Allowed(net.ParseIP("10.1.0.1")))
+	c.resetACL()
+	require.False(t, c.Allowed(net.ParseIP("10.1.0.1")))
+	require.True(t, c.Allowed(net.ParseIP("192.168.0.1")))
+
+	// more specific allow wins
+	c.ACL.Allow = []string{"10.1.0.0/16", "2401:db00::/32"}
+	c.resetACL()
+	require.True(t, c.Allowed(net.ParseIP("10.1.0.1")))
+	require.False(t, c.Allowed(net.ParseIP("10.2.0.1")))
+	require.True(t, c.Allowed(net.ParseIP("2401:db00::1")))
+	// not in the allow list
+	require.False(t, c.Allowed(net.ParseIP("192.168.0.1")))
+
+	// deny wins over allow of the same length
+	c.ACL.Deny = append(c.ACL.Deny, "2401:db00::/32")
+	c.resetACL()
+	require.False(t, c.Allowed(net.ParseIP("2401:db00::1")))
+}
+
+func TestConfigAllowedZeroAllocs(t *testing.T) {
+	c := &Config{}
+	c.ACL = ACLConfig{Allow: []string{"10.0.0.0/8", "2401:db00::/32"}, Deny: []string{"10.1.0.0/16"}}
+	c.resetACL()
+	ip := net.ParseIP("2401:db00::1")
+	require.Equal(t, float64(0), testing.AllocsPerRun(100, func() { c.Allowed(ip) }))
+}
+
+func TestServerAllowed(t *testing.T) {
+	st := &aclStats{denied: map[ptp.MessageType]int{}}
+	c := &Config{}
+	c.ACL.Allow = []string{"2401:db00::/32"}
+	s := &Server{Config: c, Stats: st}
+
+	require.True(t, s.allowed(net.ParseIP("2401:db00::1"), ptp.MessageSync))
+	require.False(t, s.allowed(net.ParseIP("2401:db01::1"), ptp.MessageSync))
+	require.False(t, s.allowed(net.ParseIP("2401:db01::1"), ptp.MessageDelayReq))
+	require.Equal(t, map[ptp.MessageType]int{ptp.MessageSync: 1, ptp.MessageDelayReq: 1}, st.denied)
+}
+
+func TestReloadConfigACL(t *testing.T) {
+	cfg := filepath.Join(t.TempDir(), "ptp4u.yaml")
+	c := &Config{
+		StaticConfig:  StaticConfig{ConfigFile: cfg, LogLevel: log.GetLevel().String()},
+		DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second},
+	}
+	s := Server{Config: c, Stats: &reloadStats{}}
+	require.True(t, c.Allowed(net.ParseIP("10.1.0.1")))
+
+	config := `utcoffset: "37s"
+acl:
+  deny:
+    - "10.0.0.0/8"
+`
+	require.NoError(t, os.WriteFile(cfg, []byte(config), 0644))
+	require.NoError(t, s.reloadConfig())
+	require.False(t, c.Allowed(net.ParseIP("10.1.0.1")))
+
+	// invalid ACL is rejected, the current one stays in effect
+	config = `utcoffset: "37s"
+acl:
+  deny:
+    - "nope"
+`
+	require.NoError(t, os.WriteFile(cfg, []byte(config), 0644))
+	require.Error(t, s.reloadConfig())
+	require.False(t, c.Allowed(net.ParseIP("10.1.0.1")))
+}
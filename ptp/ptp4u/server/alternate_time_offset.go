@@ -0,0 +1,138 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// maxAlternateTimeOffsets limits how many ALTERNATE_TIME_OFFSET_INDICATOR TLVs Announce carries
+const maxAlternateTimeOffsets = 8
+
+// maxAlternateTimeOffsetName is the longest display name IEEE 1588-2019 allows
+const maxAlternateTimeOffsetName = 10
+
+// AlternateTimeOffsetConfig is an alternate timescale, like a local time zone or smeared time, announced with ALTERNATE_TIME_OFFSET_INDICATOR TLV
+type AlternateTimeOffsetConfig struct {
+	// Key identifies the alternate timescale, unique across them
+	Key uint8 `yaml:"key"`
+	// Name to display, like time zone abbreviation. Up to 10 characters
+	Name string `yaml:"name"`
+	// Offset of alternate time from UTC, whole seconds. TLV carries offset from PTP time, so UTC offset is taken into account when announced
+	Offset time.Duration `yaml:"offset"`
+	// Jump is the next discontinuity of alternate time, like 1h when daylight saving time starts. 0 - none
+	Jump time.Duration `yaml:"jump,omitempty"`
+	// NextJump is when Jump happens. Once it's passed Offset is announced with Jump applied
+	NextJump time.Time `yaml:"nextjump,omitempty"`
+}
+
+// tlv returns ALTERNATE_TIME_OFFSET_INDICATOR TLV announcing alternate timescale at t
+func (a *AlternateTimeOffsetConfig) tlv(utcOffset time.Duration, t time.Time) *ptp.AlternateTimeOffsetIndicatorTLV {
+	offset, jump, next := a.Offset, a.Jump, a.NextJump
+	if !next.IsZero() && !t.Before(next) {
+		offset += jump
+		jump = 0
+		next = time.Time{}
+	}
+	// keyField, currentOffset, jumpSeconds, timeOfNextJump and displayName, padded to even length
+	length := 1 + 4 + 4 + 6 + 1 + len(a.Name)
+	length += length % 2
+	tlv := &ptp.AlternateTimeOffsetIndicatorTLV{
+		TLVHead: ptp.TLVHead{
+			TLVType:     ptp.TLVAlternateTimeOffsetIndicator,
+			LengthField: uint16(length),
+		},
+		KeyField:      a.Key,
+		CurrentOffset: int32((offset - utcOffset) / time.Second),
+		JumpSeconds:   int32(jump / time.Second),
+		DisplayName:   ptp.PTPText(a.Name),
+	}
+	if !next.IsZero() {
+		tlv.TimeOfNextJump = ptp.NewPTPSeconds(next.Add(utcOffset))
+	}
+	return tlv
+}
+
+// AlternateTimeOffsetsSanity checks alternate timescales can be announced
+func (dc *DynamicConfig) AlternateTimeOffsetsSanity() error {
+	if len(dc.AlternateTimeOffsets) > maxAlternateTimeOffsets {
+		return fmt.Errorf("at most %d alternate time offsets can be announced, got %d", maxAlternateTimeOffsets, len(dc.AlternateTimeOffsets))
+	}
+	seen := map[uint8]bool{}
+	for _, a := range dc.AlternateTimeOffsets {
+		if seen[a.Key] {
+			return fmt.Errorf("alternate time offset key %d is configured more than once", a.Key)
+		}
+		seen[a.Key] = true
+		if len(a.Name) > maxAlternateTimeOffsetName {
+			return fmt.Errorf("alternate time offset %d name %q is longer than %d characters", a.Key, a.Name, maxAlternateTimeOffsetName)
+		}
+		if a.Offset%time.Second != 0 || a.Jump%time.Second != 0 {
+			return fmt.Errorf("alternate time offset %d offset and jump must be whole seconds", a.Key)
+		}
+		if a.Jump != 0 && a.NextJump.IsZero() {
+			return fmt.Errorf("alternate time offset %d jump requires nextjump", a.Key)
+		}
+	}
+	return nil
+}
+
+// alternateTimeOffsets is ALTERNATE_TIME_OFFSET_INDICATOR TLVs built from config
+type alternateTimeOffsets struct {
+	tlvs []ptp.TLV
+	// length is size of all TLVs together
+	length int
+	// validUntil is when the earliest jump happens and TLVs have to be rebuilt, zero if never
+	validUntil time.Time
+	// gen is config generation TLVs were built from
+	gen uint32
+}
+
+func newAlternateTimeOffsets(alts []AlternateTimeOffsetConfig, utcOffset time.Duration, t time.Time, gen uint32) *alternateTimeOffsets {
+	a := &alternateTimeOffsets{tlvs: make([]ptp.TLV, 0, len(alts)), gen: gen}
+	for i := range alts {
+		tlv := alts[i].tlv(utcOffset, t)
+		a.tlvs = append(a.tlvs, tlv)
+		a.length += 4 + int(tlv.LengthField)
+		if next := alts[i].NextJump; next.After(t) && (a.validUntil.IsZero() || next.Before(a.validUntil)) {
+			a.validUntil = next
+		}
+	}
+	return a
+}
+
+// alternateTimeOffsetTLVs returns TLVs to append to Announce at t along with their size, building them if config changed or a jump has passed.
+// TLVs are shared by all subscriptions and must not be modified
+func (c *Config) alternateTimeOffsetTLVs(t time.Time) ([]ptp.TLV, int) {
+	gen := atomic.LoadUint32(&c.altTimeOffsetsGen)
+	a, _ := c.altTimeOffsets.Load().(*alternateTimeOffsets)
+	if a == nil || a.gen != gen || (!a.validUntil.IsZero() && !t.Before(a.validUntil)) {
+		a = newAlternateTimeOffsets(c.AlternateTimeOffsets, c.UTCOffset, t, gen)
+		c.altTimeOffsets.Store(a)
+	}
+	return a.tlvs, a.length
+}
+
+// resetAlternateTimeOffsets makes TLVs rebuilt from config next time they are needed.
+// Must be called under dcMux whenever alternate time offsets or UTC offset change
+func (c *Config) resetAlternateTimeOffsets() {
+	atomic.AddUint32(&c.altTimeOffsetsGen, 1)
+}
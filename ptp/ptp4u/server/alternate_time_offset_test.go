@@ -0,0 +1,201 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlternateTimeOffsetTLV(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	dst := time.Date(2026, 3, 8, 10, 0, 0, 0, time.UTC)
+	a := &AlternateTimeOffsetConfig{Key: 1, Name: "PST", Offset: -8 * time.Hour, Jump: time.Hour, NextJump: dst}
+
+	tlv := a.tlv(37*time.Second, now)
+	require.Equal(t, &ptp.AlternateTimeOffsetIndicatorTLV{
+		TLVHead:        ptp.TLVHead{TLVType: ptp.TLVAlternateTimeOffsetIndicator, LengthField: 20},
+		KeyField:       1,
+		CurrentOffset:  -8*3600 - 37,
+		JumpSeconds:    3600,
+		TimeOfNextJump: ptp.NewPTPSeconds(dst.Add(37 * time.Second)),
+		DisplayName:    "PST",
+	}, tlv)
+
+	// jump has happened
+	tlv = a.tlv(37*time.Second, dst)
+	require.Equal(t, int32(-7*3600-37), tlv.CurrentOffset)
+	require.Equal(t, int32(0), tlv.JumpSeconds)
+	require.True(t, tlv.TimeOfNextJump.Empty())
+
+	// odd length is padded
+	tlv = (&AlternateTimeOffsetConfig{Key: 2, Name: "SMEAR"}).tlv(37*time.Second, now)
+	require.Equal(t, uint16(22), tlv.LengthField)
+	require.Equal(t, int32(-37), tlv.CurrentOffset)
+
+	// what we send can be parsed back
+	b := make([]byte, 64)
+	n, err := tlv.MarshalBinaryTo(b)
+	require.NoError(t, err)
+	require.Equal(t, 4+22, n)
+	parsed := &ptp.AlternateTimeOffsetIndicatorTLV{}
+	require.NoError(t, parsed.UnmarshalBinary(b[:n]))
+	require.Equal(t, tlv, parsed)
+}
+
+func TestAlternateTimeOffsetsSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.AlternateTimeOffsetsSanity())
+
+	dc.AlternateTimeOffsets = []AlternateTimeOffsetConfig{
+		{Key: 1, Name: "PST", Offset: -8 * time.Hour, Jump: time.Hour, NextJump: time.Now()},
+		{Key: 2, Name: "SMEAR"},
+	}
+	require.NoError(t, dc.AlternateTimeOffsetsSanity())
+
+	dc.AlternateTimeOffsets[1].Key = 1
+	require.EqualError(t, dc.AlternateTimeOffsetsSanity(), "alternate time offset key 1 is configured more than once")
+	dc.AlternateTimeOffsets[1].Key = 2
+
+	dc.AlternateTimeOffsets[1].Name = "SMEARED UTC"
+	require.EqualError(t, dc.AlternateTimeOffsetsSanity(), `alternate time offset 2 name "SMEARED UTC" is longer than 10 characters`)
+	dc.AlternateTimeOffsets[1].Name = "SMEAR"
+
+	dc.AlternateTimeOffsets[1].Offset = time.Millisecond
+	require.EqualError(t, dc.AlternateTimeOffsetsSanity(), "alternate time offset 2 offset and jump must be whole seconds")
+	dc.AlternateTimeOffsets[1].Offset = 0
+
+	dc.AlternateTimeOffsets[1].Jump = time.Second
+	require.EqualError(t, dc.AlternateTimeOffsetsSanity(), "alternate time offset 2 jump requires nextjump")
+	dc.AlternateTimeOffsets[1].Jump = 0
+
+	dc.AlternateTimeOffsets = make([]AlternateTimeOffsetConfig, maxAlternateTimeOffsets+1)
+	require.EqualError(t, dc.AlternateTimeOffsetsSanity(), "at most 8 alternate time offsets can be announced, got 9")
+}
+
+func TestAlternateTimeOffsetTLVsRebuild(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	dst := time.Date(2026, 3, 8, 10, 0, 0, 0, time.UTC)
+	c := &Config{DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second}}
+
+	tlvs, length := c.alternateTimeOffsetTLVs(now)
+	require.Empty(t, tlvs)
+	require.Equal(t, 0, length)
+
+	// config change is only picked up once reset
+	c.AlternateTimeOffsets = []AlternateTimeOffsetConfig{
+		{Key: 1, Name: "PST", Offset: -8 * time.Hour, Jump: time.Hour, NextJump: dst},
+		{Key: 2, Name: "SMEAR"},
+	}
+	tlvs, _ = c.alternateTimeOffsetTLVs(now)
+	require.Empty(t, tlvs)
+	c.resetAlternateTimeOffsets()
+	tlvs, length = c.alternateTimeOffsetTLVs(now)
+	require.Len(t, tlvs, 2)
+	require.Equal(t, 4+20+4+22, length)
+	require.Equal(t, int32(-8*3600-37), tlvs[0].(*ptp.AlternateTimeOffsetIndicatorTLV).CurrentOffset)
+
+	// built once and shared
+	again, _ := c.alternateTimeOffsetTLVs(now.Add(time.Hour))
+	require.Same(t, tlvs[0], again[0])
+
+	// rebuilt once jump has passed
+	tlvs, _ = c.alternateTimeOffsetTLVs(dst)
+	require.Equal(t, int32(-7*3600-37), tlvs[0].(*ptp.AlternateTimeOffsetIndicatorTLV).CurrentOffset)
+}
+
+func TestAnnounceAlternateTimeOffsets(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		DynamicConfig: DynamicConfig{
+			UTCOffset: 37 * time.Second,
+			AlternateTimeOffsets: []AlternateTimeOffsetConfig{
+				{Key: 1, Name: "CET", Offset: time.Hour},
+			},
+		},
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+	sc.initAnnounce()
+	sc.UpdateAnnounce()
+	require.Equal(t, uint16(64+4+20), sc.Announce().MessageLength)
+
+	b := make([]byte, timestamp.PayloadSizeBytes)
+	n, err := ptp.BytesTo(sc.Announce(), b)
+	require.NoError(t, err)
+	// with two trailing bytes for UDPv6
+	require.Equal(t, int(sc.Announce().MessageLength)+2, n)
+	parsed := &ptp.Announce{}
+	require.NoError(t, parsed.UnmarshalBinary(b[:n-2]))
+	require.Len(t, parsed.TLVs, 1)
+	tlv := parsed.TLVs[0].(*ptp.AlternateTimeOffsetIndicatorTLV)
+	require.Equal(t, int32(3600-37), tlv.CurrentOffset)
+	require.Equal(t, ptp.PTPText("CET"), tlv.DisplayName)
+
+	// removed on reload
+	c.AlternateTimeOffsets = nil
+	c.resetAlternateTimeOffsets()
+	sc.UpdateAnnounceDelayReq(0, 1)
+	require.Equal(t, uint16(64), sc.Announce().MessageLength)
+	require.Empty(t, sc.Announce().TLVs)
+}
+
+func TestReloadConfigAlternateTimeOffsets(t *testing.T) {
+	cfg := filepath.Join(t.TempDir(), "ptp4u.yaml")
+	c := &Config{
+		StaticConfig:  StaticConfig{ConfigFile: cfg, LogLevel: log.GetLevel().String()},
+		DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second},
+	}
+	s := Server{Config: c, Stats: &reloadStats{}}
+	tlvs, _ := c.alternateTimeOffsetTLVs(time.Now())
+	require.Empty(t, tlvs)
+
+	config := `utcoffset: "37s"
+alternatetimeoffsets:
+  - key: 1
+    name: "PST"
+    offset: "-8h"
+    jump: "1h"
+    nextjump: 2026-03-08T10:00:00Z
+`
+	require.NoError(t, os.WriteFile(cfg, []byte(config), 0644))
+	require.NoError(t, s.reloadConfig())
+	tlvs, _ = c.alternateTimeOffsetTLVs(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.Len(t, tlvs, 1)
+	tlv := tlvs[0].(*ptp.AlternateTimeOffsetIndicatorTLV)
+	require.Equal(t, int32(-8*3600-37), tlv.CurrentOffset)
+	require.Equal(t, int32(3600), tlv.JumpSeconds)
+
+	// invalid ones are rejected
+	config = `utcoffset: "37s"
+alternatetimeoffsets:
+  - key: 1
+    name: "PACIFIC TIME"
+`
+	require.NoError(t, os.WriteFile(cfg, []byte(config), 0644))
+	require.Error(t, s.reloadConfig())
+	require.Len(t, c.AlternateTimeOffsets, 1)
+}
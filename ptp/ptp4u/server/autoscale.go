@@ -0,0 +1,136 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// how often workers are scaled
+	autoscaleInterval = time.Second
+	// worker has to be quiet for this many ticks in a row before a sender is removed
+	autoscaleQuietTicks = 30
+)
+
+// txtsLatencyHigh is TX timestamp read latency which is halfway to the timeout
+func txtsLatencyHigh() time.Duration {
+	return time.Duration(timestamp.AttemptsTXTS) * timestamp.TimeoutTXTS / 2
+}
+
+// atomicMax atomically raises v to n, if n is bigger
+func atomicMax(v *int64, n int64) {
+	for {
+		cur := atomic.LoadInt64(v)
+		if n <= cur || atomic.CompareAndSwapInt64(v, cur, n) {
+			return
+		}
+	}
+}
+
+// observeQueue records queue length for autoscaling
+func (s *sendWorker) observeQueue(n int) {
+	atomicMax(&s.maxQueue, int64(n))
+}
+
+// observeTXTSLatency records how long it took to read TX timestamp for autoscaling
+func (s *sendWorker) observeTXTSLatency(d time.Duration) {
+	atomicMax(&s.maxTXTSLatency, int64(d))
+	s.stats.SetMaxTXTSLatency(s.id, d.Nanoseconds())
+}
+
+// senders returns how many senders pull from the queue
+func (s *sendWorker) senders() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return 1 + len(s.extraSenders)
+}
+
+// addSender starts one more sender on the queues
+func (s *sendWorker) addSender() {
+	stop := make(chan struct{})
+	s.mux.Lock()
+	s.extraSenders = append(s.extraSenders, stop)
+	s.mux.Unlock()
+	go s.run(stop)
+}
+
+// removeSender stops the last sender added, the first one is never stopped
+func (s *sendWorker) removeSender() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if len(s.extraSenders) == 0 {
+		return
+	}
+	last := len(s.extraSenders) - 1
+	close(s.extraSenders[last])
+	s.extraSenders = s.extraSenders[:last]
+}
+
+// scaleDecision tells whether to add (1) or remove (-1) a sender, or leave it as is (0), by queue backlog and TX timestamp latency since the last tick
+func (s *sendWorker) scaleDecision(maxSenders int) int {
+	queue := atomic.SwapInt64(&s.maxQueue, 0)
+	latency := time.Duration(atomic.SwapInt64(&s.maxTXTSLatency, 0))
+	size := int64(cap(s.queue))
+	// unbuffered queue can't back up, so only TX timestamp latency tells the load
+	backlogged := size > 0 && queue*2 >= size
+	quiet := (size == 0 || queue*10 < size) && latency < txtsLatencyHigh()/4
+
+	senders := s.senders()
+	// limit was lowered by config reload
+	if senders > maxSenders {
+		s.quietTicks = 0
+		return -1
+	}
+	if backlogged || latency >= txtsLatencyHigh() {
+		s.quietTicks = 0
+		if senders < maxSenders {
+			return 1
+		}
+		return 0
+	}
+	if !quiet {
+		s.quietTicks = 0
+		return 0
+	}
+	s.quietTicks++
+	if s.quietTicks >= autoscaleQuietTicks && senders > 1 {
+		s.quietTicks = 0
+		return -1
+	}
+	return 0
+}
+
+// autoscale adds senders to workers which can't keep up and removes them from quiet ones
+func (s *Server) autoscale() {
+	for _, w := range s.sw {
+		switch w.scaleDecision(s.Config.maxSenders()) {
+		case 1:
+			w.addSender()
+			s.Stats.IncWorkerScaleUp()
+			log.Infof("Worker %d can't keep up, scaled up to %d senders", w.id, w.senders())
+		case -1:
+			w.removeSender()
+			s.Stats.IncWorkerScaleDown()
+			log.Infof("Worker %d is quiet or over the limit, scaled down to %d senders", w.id, w.senders())
+		}
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+// scaleStats records scale events, rest of stats.Stats is not used
+type scaleStats struct {
+	stats.Stats
+	up   int
+	down int
+}
+
+func (s *scaleStats) SetMaxTXTSLatency(_ int, _ int64) {}
+
+func (s *scaleStats) IncWorkerScaleUp() {
+	s.up++
+}
+
+func (s *scaleStats) IncWorkerScaleDown() {
+	s.down++
+}
+
+func newScaleTestWorker(queueSize int) *sendWorker {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			QueueSize:     queueSize,
+			TimestampType: timestamp.SWTIMESTAMP,
+		},
+	}
+	return newSendWorker(0, c, &scaleStats{})
+}
+
+func TestSendWorkerScaleDecisionBacklog(t *testing.T) {
+	w := newScaleTestWorker(10)
+	require.Equal(t, 0, w.scaleDecision(3))
+
+	w.observeQueue(5)
+	require.Equal(t, 1, w.scaleDecision(3))
+	// max is reset every tick
+	require.Equal(t, 0, w.scaleDecision(3))
+
+	w.extraSenders = append(w.extraSenders, make(chan struct{}), make(chan struct{}))
+	w.observeQueue(10)
+	require.Equal(t, 0, w.scaleDecision(3), "already at max senders")
+}
+
+func TestSendWorkerScaleDecisionTXTSLatency(t *testing.T) {
+	// unbuffered queue can't back up
+	w := newScaleTestWorker(0)
+	w.observeQueue(1)
+	require.Equal(t, 0, w.scaleDecision(2))
+
+	w.observeTXTSLatency(txtsLatencyHigh() / 2)
+	require.Equal(t, 0, w.scaleDecision(2))
+	w.observeTXTSLatency(txtsLatencyHigh())
+	w.observeTXTSLatency(time.Microsecond)
+	require.Equal(t, 1, w.scaleDecision(2))
+}
+
+func TestSendWorkerScaleDecisionQuiet(t *testing.T) {
+	w := newScaleTestWorker(10)
+	w.extraSenders = append(w.extraSenders, make(chan struct{}))
+
+	for i := 0; i < autoscaleQuietTicks-1; i++ {
+		require.Equal(t, 0, w.scaleDecision(2))
+	}
+	// moderate load restarts the count
+	w.observeQueue(3)
+	require.Equal(t, 0, w.scaleDecision(2))
+	for i := 0; i < autoscaleQuietTicks-1; i++ {
+		require.Equal(t, 0, w.scaleDecision(2))
+	}
+	require.Equal(t, -1, w.scaleDecision(2))
+
+	// first sender is never removed
+	w.extraSenders = nil
+	for i := 0; i < 2*autoscaleQuietTicks; i++ {
+		require.Equal(t, 0, w.scaleDecision(2))
+	}
+}
+
+func TestSendWorkerAddRemoveSender(t *testing.T) {
+	w := newScaleTestWorker(0)
+	w.stats = stats.NewJSONStats()
+	w.addSender()
+	w.addSender()
+	require.Equal(t, 3, w.senders())
+
+	// added senders serve the queue
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, w.config, time.Second, time.Now().Add(time.Second))
+	for i := 0; i < 10; i++ {
+		w.queue <- sc
+	}
+
+	w.removeSender()
+	require.Equal(t, 2, w.senders())
+	w.removeSender()
+	w.removeSender()
+	require.Equal(t, 1, w.senders())
+}
+
+func TestServerAutoscale(t *testing.T) {
+	st := &scaleStats{}
+	w := newScaleTestWorker(10)
+	w.stats = st
+	s := &Server{
+		Config: &Config{StaticConfig: StaticConfig{MaxSenders: 2}},
+		Stats:  st,
+		sw:     []*sendWorker{w},
+	}
+	w.observeQueue(10)
+	s.autoscale()
+	require.Equal(t, 2, w.senders())
+	require.Equal(t, 1, st.up)
+
+	for i := 0; i < autoscaleQuietTicks; i++ {
+		s.autoscale()
+	}
+	require.Equal(t, 1, w.senders())
+	require.Equal(t, 1, st.down)
+}
+
+func TestServerAutoscaleLimitReloaded(t *testing.T) {
+	st := &scaleStats{}
+	w := newScaleTestWorker(10)
+	w.stats = st
+	s := &Server{
+		Config: &Config{StaticConfig: StaticConfig{MaxSenders: 1}},
+		Stats:  st,
+		sw:     []*sendWorker{w},
+	}
+	w.observeQueue(10)
+	s.autoscale()
+	require.Equal(t, 1, w.senders())
+
+	// limit raised by reload
+	s.Config.MaxWorkerSenders = 3
+	w.observeQueue(10)
+	s.autoscale()
+	w.observeQueue(10)
+	s.autoscale()
+	require.Equal(t, 3, w.senders())
+
+	// and lowered, busy worker is scaled down right away
+	s.Config.MaxWorkerSenders = 2
+	w.observeQueue(10)
+	s.autoscale()
+	require.Equal(t, 2, w.senders())
+	require.Equal(t, 2, st.up)
+	require.Equal(t, 1, st.down)
+}
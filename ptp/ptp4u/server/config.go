@@ -20,68 +20,211 @@ Package server implements simple Unicast PTP UDP server.
 package server
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 	yaml "gopkg.in/yaml.v2"
 )
 
 var errInsaneUTCoffset = errors.New("UTC offset is outside of sane range")
+var errUnknownLivenessAction = errors.New("unknown DelayReq liveness action")
+var errConfigChecksum = errors.New("config checksum mismatch, file is damaged or partially written")
+var errNegativeGrantLatencySLO = errors.New("grant latency SLO must be 0 or positive")
+var errNoMulticastInterval = errors.New("multicast sync and announce intervals must be positive")
+var errUnknownPHCCheck = errors.New("unknown PHC check action")
+var errNegativeMaxWorkerSenders = errors.New("max worker senders must be 0 or positive")
+var errListenFamily = errors.New("at most one IPv4 and one IPv6 address may be listened on")
+var errUnknownLeapSecondClock = errors.New("unknown leap second clock")
+
+// OneStepHint is set by subscriber in reserved flags of Sync REQUEST_UNICAST_TRANSMISSION TLV to tell it accepts one-step Sync
+const OneStepHint uint8 = 0x01
+
+// Actions taken on Sync subscription of a subscriber which stopped sending DelayReqs
+const (
+	// LivenessActionCancel cancels the subscription
+	LivenessActionCancel = "cancel"
+	// LivenessActionPause stops sending Sync until subscriber sends DelayReq again
+	LivenessActionPause = "pause"
+)
+
+// Actions taken at startup when PHC of the interface doesn't look disciplined
+const (
+	// PHCCheckOff skips the check
+	PHCCheckOff = "off"
+	// PHCCheckRefuse refuses to serve
+	PHCCheckRefuse = "refuse"
+	// PHCCheckDegrade serves announcing degraded clock class
+	PHCCheckDegrade = "degrade"
+)
+
+// Clocks leap second transitions follow
+const (
+	// LeapSecondClockSystem is system clock running UTC
+	LeapSecondClockSystem = "system"
+	// LeapSecondClockPHC is PTP time of PHC running TAI, which doesn't depend on how system clock handles leap seconds
+	LeapSecondClockPHC = "phc"
+)
 
 // dcMux is a dynamic config mutex
 var dcMux = sync.Mutex{}
 
 // StaticConfig is a set of static options which require a server restart
 type StaticConfig struct {
-	ConfigFile      string
-	DebugAddr       string
-	DomainNumber    uint
-	DrainFileName   string
-	DSCP            int
-	Interface       string
-	IP              net.IP
-	LogLevel        string
-	MonitoringPort  int
-	PidFile         string
-	QueueSize       int
-	RecvWorkers     int
-	SendWorkers     int
-	TimestampType   string
+	ConfigFile string
+	// ControlAddr is host:port or a unix socket path to serve drain control API on, disabled if empty
+	ControlAddr   string
+	DebugAddr     string
+	DomainNumber  uint
+	DrainFileName string
+	DSCP          int
+	// ExtraIPs are more addresses to serve unicast on besides IP. Each one is served over IPv4 or IPv6
+	// depending on its family, so IPv4 and IPv6 subscribers can be served at once
+	ExtraIPs  []net.IP
+	Interface string
+	// IP is the primary address to serve unicast on, management and multicast follow its family
+	IP net.IP
+	// LeapAnnounceWindow is how long before a leap second leap flags are set, up to the whole UTC day it ends. 0 means the whole day
+	LeapAnnounceWindow time.Duration
+	// LeapSecondClock is the clock leap second transitions follow: system or phc
+	LeapSecondClock string
+	// LeapSecondFile is tzdata file with leap seconds, like /usr/share/zoneinfo/right/UTC.
+	// UTC offset and leap flags follow it rather than dynamic config. Disabled if empty
+	LeapSecondFile string
+	// LeapSecondInterval is how often LeapSecondFile is re-read
+	LeapSecondInterval time.Duration
+	LogLevel           string
+	// MaxSenders is how many senders autoscaling may run per worker, 1 disables autoscaling
+	MaxSenders int
+	// MgmtSocket is a unix socket path to answer management requests on, like ptp4l does for pmc. Disabled if empty
+	MgmtSocket     string
+	MonitoringPort int
+	// Multicast is a list of interfaces to multicast Sync and Announce on, as iface or iface=group
+	Multicast                 []string
+	MulticastAnnounceInterval time.Duration
+	MulticastSyncInterval     time.Duration
+	OneStep                   bool
+	// OneStepP2P makes NIC use P2P one-step mode, which inserts TX timestamps into Pdelay_Resp besides Sync
+	OneStepP2P bool
+	// PHCCheck is what to do if PHC isn't disciplined at startup: off, refuse or degrade
+	PHCCheck string
+	// PHCDevice is PHC to validate at startup, PHC of the Interface if empty
+	PHCDevice string
+	// PHCMaxOffset is max offset of PHC from system clock, taking UTC offset into account. 0 disables offset check
+	PHCMaxOffset time.Duration
+	PidFile      string
+	// Profile is PTP profile the server follows, empty if none
+	Profile       string
+	QueueSize     int
+	RecvWorkers   int
+	SendWorkers   int
+	TimestampType string
+	// TXTSBatch makes senders read TX timestamps in batches and send Follow Ups once they are there, instead of waiting for each one
+	TXTSBatch       bool
 	UndrainFileName string
 }
 
 // DynamicConfig is a set of dynamic options which don't need a server restart
 type DynamicConfig struct {
+	// ACL lists subscribers allowed or denied to be served
+	ACL ACLConfig `yaml:"acl,omitempty"`
+	// AlternateTimeOffsets are alternate timescales, like local time zones, announced with ALTERNATE_TIME_OFFSET_INDICATOR TLVs
+	AlternateTimeOffsets []AlternateTimeOffsetConfig `yaml:"alternatetimeoffsets,omitempty"`
 	// ClockAccuracy to report via announce messages. Time Accurate within 100ns
 	ClockAccuracy ptp.ClockAccuracy
 	// ClockClass to report via announce messages. 6 - Locked with Primary Reference Clock
 	ClockClass ptp.ClockClass
+	// ClientQuota limits subscriptions of every single subscriber IP
+	ClientQuota QuotaConfig `yaml:"clientquota,omitempty"`
+	// Domains is a list of PTP domains served besides DomainNumber, each with its own advertised clock quality.
+	// Entry for DomainNumber overrides its clock quality
+	Domains []DomainConfig `yaml:"domains,omitempty"`
+	// DelayReqLiveness is how many sync intervals subscriber may not send DelayReqs before Sync grant is reclaimed. 0 - disabled
+	DelayReqLiveness int `yaml:"delayreqliveness,omitempty"`
+	// DelayReqLivenessAction is how Sync grant is reclaimed. cancel (default) or pause
+	DelayReqLivenessAction string `yaml:"delayreqlivenessaction,omitempty"`
+	// FloodControl throttles subscribers sending DelayReqs faster than they were granted
+	FloodControl FloodControlConfig `yaml:"floodcontrol,omitempty"`
+	// GlobalQuota limits subscriptions of all subscribers together
+	GlobalQuota QuotaConfig `yaml:"globalquota,omitempty"`
+	// GrantLatencySLO is a maximum time from the grant request receipt to the grant transmission. 0 - disabled
+	GrantLatencySLO time.Duration `yaml:"grantlatencyslo,omitempty"`
+	// LogLevel overrides log level set on the command line. debug, info, warning or error
+	LogLevel string `yaml:"loglevel,omitempty"`
 	// DrainInterval is an interval for drain checks
 	DrainInterval time.Duration
+	// MaxWorkerSenders overrides -maxsenders, how many senders autoscaling may run per worker. 0 - use -maxsenders
+	MaxWorkerSenders int `yaml:"maxworkersenders,omitempty"`
 	// MaxSubDuration is a maximum sync/announce/delay_resp subscription duration
 	MaxSubDuration time.Duration
 	// MetricInterval is an interval of resetting metrics
 	MetricInterval time.Duration
 	// MinSubInterval is a minimum interval of the sync/announce subscription messages
 	MinSubInterval time.Duration
+	// OneStepClients is a list of IPs or subnets of subscribers known to accept one-step Sync. Only used with OneStep
+	OneStepClients []string `yaml:"onestepclients,omitempty"`
+	// QuotaAction is what happens to grant requests over quota. deny (default) or downgrade
+	QuotaAction string `yaml:"quotaaction,omitempty"`
+	// Tenants is a list of subscriber groups with their own subscription and packet rate quotas
+	Tenants []TenantConfig `yaml:"tenants,omitempty"`
 	// UTCOffset is a current UTC offset.
 	UTCOffset time.Duration
+	// Version is bumped by c4u on every write, so it's clear which config ptp4u runs with
+	Version uint64 `yaml:"version,omitempty"`
+}
+
+// DomainConfig is a PTP domain with clock quality and priorities announced in it
+type DomainConfig struct {
+	Domain        uint8             `yaml:"domain"`
+	ClockAccuracy ptp.ClockAccuracy `yaml:"clockaccuracy"`
+	ClockClass    ptp.ClockClass    `yaml:"clockclass"`
+	// Priority1 and Priority2 to report via announce messages. 128 if not set
+	Priority1 uint8 `yaml:"priority1,omitempty"`
+	Priority2 uint8 `yaml:"priority2,omitempty"`
+}
+
+// logLevels are log levels ptp4u can be run with
+var logLevels = map[string]log.Level{
+	"debug":   log.DebugLevel,
+	"info":    log.InfoLevel,
+	"warning": log.WarnLevel,
+	"error":   log.ErrorLevel,
 }
 
+// checksumPrefix starts the first line of dynamic config written by Write, followed by hex sha256 of the rest of the file
+const checksumPrefix = "# checksum: sha256:"
+
+// defaultPriority is announced as Priority1 and Priority2 unless domain config sets them
+const defaultPriority uint8 = 128
+
 // Config is a server config structure
 type Config struct {
 	StaticConfig
 	DynamicConfig
 
 	clockIdentity ptp.ClockIdentity
+	// leapFlagField is Announce flags following leap second file
+	leapFlagField uint32
+	// altTimeOffsets is *alternateTimeOffsets built from AlternateTimeOffsets of generation altTimeOffsetsGen
+	altTimeOffsets    atomic.Value
+	altTimeOffsetsGen uint32
+	// acl is *acl parsed from ACL by resetACL
+	acl atomic.Value
 }
 
 // UTCOffsetSanity checks if UTC offset value has an adequate value
@@ -93,6 +236,260 @@ func (dc *DynamicConfig) UTCOffsetSanity() error {
 	return nil
 }
 
+// LivenessSanity checks if DelayReq liveness policy is valid
+func (dc *DynamicConfig) LivenessSanity() error {
+	if dc.DelayReqLiveness < 0 {
+		return fmt.Errorf("DelayReq liveness must be 0 or positive")
+	}
+	switch dc.DelayReqLivenessAction {
+	case "", LivenessActionCancel, LivenessActionPause:
+		return nil
+	default:
+		return errUnknownLivenessAction
+	}
+}
+
+// GrantLatencySLOSanity checks if grant latency SLO is valid
+func (dc *DynamicConfig) GrantLatencySLOSanity() error {
+	if dc.GrantLatencySLO < 0 {
+		return errNegativeGrantLatencySLO
+	}
+	return nil
+}
+
+// MaxWorkerSendersSanity checks if max worker senders is valid
+func (dc *DynamicConfig) MaxWorkerSendersSanity() error {
+	if dc.MaxWorkerSenders < 0 {
+		return errNegativeMaxWorkerSenders
+	}
+	return nil
+}
+
+// maxSenders returns how many senders autoscaling may run per worker, dynamic config overrides the command line
+func (c *Config) maxSenders() int {
+	if c.MaxWorkerSenders > 0 {
+		return c.MaxWorkerSenders
+	}
+	return c.MaxSenders
+}
+
+// LogLevelSanity checks if log level is known
+func (dc *DynamicConfig) LogLevelSanity() error {
+	if _, ok := logLevels[dc.LogLevel]; dc.LogLevel != "" && !ok {
+		return fmt.Errorf("unrecognized log level: %v", dc.LogLevel)
+	}
+	return nil
+}
+
+// ApplyLogLevel sets log level of dynamic config, or the one set on the command line if dynamic config has none
+func (c *Config) ApplyLogLevel() error {
+	level := c.DynamicConfig.LogLevel
+	if level == "" {
+		level = c.StaticConfig.LogLevel
+	}
+	l, ok := logLevels[level]
+	if !ok {
+		return fmt.Errorf("unrecognized log level: %v", level)
+	}
+	log.SetLevel(l)
+	return nil
+}
+
+// Changed returns names of dynamic config sections which differ in other
+func (dc *DynamicConfig) Changed(other *DynamicConfig) []string {
+	var changed []string
+	v, ov := reflect.ValueOf(*dc), reflect.ValueOf(*other)
+	for i := 0; i < v.NumField(); i++ {
+		if reflect.DeepEqual(v.Field(i).Interface(), ov.Field(i).Interface()) {
+			continue
+		}
+		f := v.Type().Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		changed = append(changed, name)
+	}
+	return changed
+}
+
+// parseClientPrefix parses IP or subnet in CIDR notation
+func parseClientPrefix(c string) (*net.IPNet, error) {
+	if strings.Contains(c, "/") {
+		_, n, err := net.ParseCIDR(c)
+		return n, err
+	}
+	ip := net.ParseIP(c)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", c)
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// OneStepClientsSanity checks if all one-step clients are valid IPs or subnets
+func (dc *DynamicConfig) OneStepClientsSanity() error {
+	for _, c := range dc.OneStepClients {
+		if _, err := parseClientPrefix(c); err != nil {
+			return fmt.Errorf("invalid one-step client: %w", err)
+		}
+	}
+	return nil
+}
+
+// OneStepCapable checks if subscriber is known to accept one-step Sync
+func (dc *DynamicConfig) OneStepCapable(ip net.IP) bool {
+	for _, c := range dc.OneStepClients {
+		n, err := parseClientPrefix(c)
+		if err != nil {
+			continue
+		}
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// PTP primary multicast groups (IEEE 1588-2019 Annex C and D)
+var (
+	multicastGroupIPv4 = net.ParseIP("224.0.1.129")
+	multicastGroupIPv6 = net.ParseIP("ff0e::181")
+)
+
+// parseMulticast parses multicast entry as iface or iface=group.
+// Without a group the primary group of the server IP family is used
+func parseMulticast(m string, ip net.IP) (string, net.IP, error) {
+	iface, g, found := strings.Cut(m, "=")
+	if iface == "" {
+		return "", nil, fmt.Errorf("no interface in multicast entry %q", m)
+	}
+	if !found {
+		if ip.To4() != nil {
+			return iface, multicastGroupIPv4, nil
+		}
+		return iface, multicastGroupIPv6, nil
+	}
+	group := net.ParseIP(g)
+	if group == nil || !group.IsMulticast() {
+		return "", nil, fmt.Errorf("invalid multicast group %q", g)
+	}
+	return iface, group, nil
+}
+
+// MulticastSanity checks if multicast interfaces, groups and intervals are valid
+func (c *StaticConfig) MulticastSanity() error {
+	if len(c.Multicast) == 0 {
+		return nil
+	}
+	if c.MulticastSyncInterval <= 0 || c.MulticastAnnounceInterval <= 0 {
+		return errNoMulticastInterval
+	}
+	for _, m := range c.Multicast {
+		if _, _, err := parseMulticast(m, c.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PHCCheckSanity checks if PHC check action is known and max offset is not negative
+func (c *StaticConfig) PHCCheckSanity() error {
+	if c.PHCMaxOffset < 0 {
+		return fmt.Errorf("PHC max offset must be 0 or positive")
+	}
+	switch c.PHCCheck {
+	case "", PHCCheckOff, PHCCheckRefuse, PHCCheckDegrade:
+		return nil
+	default:
+		return errUnknownPHCCheck
+	}
+}
+
+// LeapSecondSanity checks if leap announce window fits into a UTC day and leap second clock is known
+func (c *StaticConfig) LeapSecondSanity() error {
+	if c.LeapAnnounceWindow < 0 || c.LeapAnnounceWindow > maxLeapAnnounceWindow {
+		return fmt.Errorf("leap announce window must be within 0 and %v", maxLeapAnnounceWindow)
+	}
+	switch c.LeapSecondClock {
+	case "", LeapSecondClockSystem:
+		return nil
+	case LeapSecondClockPHC:
+		if c.TimestampType != timestamp.HWTIMESTAMP {
+			return fmt.Errorf("leap second clock %s needs %s timestamps", LeapSecondClockPHC, timestamp.HWTIMESTAMP)
+		}
+		return nil
+	default:
+		return errUnknownLeapSecondClock
+	}
+}
+
+// PTPProfile returns PTP profile the server follows, ptp.ProfileDefault if it's not set
+func (c *StaticConfig) PTPProfile() (ptp.Profile, error) {
+	if c.Profile == "" {
+		return ptp.ProfileDefault, nil
+	}
+	return ptp.ProfileFromString(c.Profile)
+}
+
+// ProfileSanity checks if profile is known and domain is within its range
+func (c *StaticConfig) ProfileSanity() error {
+	if c.Profile == "" {
+		return nil
+	}
+	p, err := c.PTPProfile()
+	if err != nil {
+		return err
+	}
+	if preset := p.Preset(); c.DomainNumber > 255 || !preset.DomainAllowed(uint8(c.DomainNumber)) {
+		return fmt.Errorf("domain number must be between %d and %d for %s profile, got %d", preset.MinDomain, preset.MaxDomain, p, c.DomainNumber)
+	}
+	return nil
+}
+
+// DomainsSanity checks if every domain is configured once
+func (dc *DynamicConfig) DomainsSanity() error {
+	seen := map[uint8]bool{}
+	for _, d := range dc.Domains {
+		if seen[d.Domain] {
+			return fmt.Errorf("domain %d is configured more than once", d.Domain)
+		}
+		seen[d.Domain] = true
+	}
+	return nil
+}
+
+// Domain returns config of the domain and whether server serves it.
+// DomainNumber without its own entry in Domains gets top level clock quality
+func (c *Config) Domain(domain uint8) (DomainConfig, bool) {
+	for _, d := range c.Domains {
+		if d.Domain != domain {
+			continue
+		}
+		if d.Priority1 == 0 {
+			d.Priority1 = defaultPriority
+		}
+		if d.Priority2 == 0 {
+			d.Priority2 = defaultPriority
+		}
+		return d, true
+	}
+	if uint(domain) != c.DomainNumber {
+		return DomainConfig{}, false
+	}
+	return DomainConfig{
+		Domain:        domain,
+		ClockAccuracy: c.ClockAccuracy,
+		ClockClass:    c.ClockClass,
+		Priority1:     defaultPriority,
+		Priority2:     defaultPriority,
+	}, true
+}
+
 // ReadDynamicConfig reads dynamic config from the file
 func ReadDynamicConfig(path string) (*DynamicConfig, error) {
 	dc := &DynamicConfig{}
@@ -101,6 +498,11 @@ func ReadDynamicConfig(path string) (*DynamicConfig, error) {
 		return nil, err
 	}
 
+	cData, err = verifyChecksum(cData)
+	if err != nil {
+		return nil, err
+	}
+
 	err = yaml.Unmarshal(cData, &dc)
 	if err != nil {
 		return nil, err
@@ -110,33 +512,125 @@ func ReadDynamicConfig(path string) (*DynamicConfig, error) {
 		return nil, err
 	}
 
+	if err := dc.LivenessSanity(); err != nil {
+		return nil, err
+	}
+
+	if err := dc.GrantLatencySLOSanity(); err != nil {
+		return nil, err
+	}
+
+	if err := dc.LogLevelSanity(); err != nil {
+		return nil, err
+	}
+
+	if err := dc.MaxWorkerSendersSanity(); err != nil {
+		return nil, err
+	}
+
+	if err := dc.OneStepClientsSanity(); err != nil {
+		return nil, err
+	}
+
+	if err := dc.TenantsSanity(); err != nil {
+		return nil, err
+	}
+
+	if err := dc.QuotasSanity(); err != nil {
+		return nil, err
+	}
+
+	if err := dc.DomainsSanity(); err != nil {
+		return nil, err
+	}
+
+	if err := dc.ACLSanity(); err != nil {
+		return nil, err
+	}
+
+	if err := dc.FloodControlSanity(); err != nil {
+		return nil, err
+	}
+
+	if err := dc.AlternateTimeOffsetsSanity(); err != nil {
+		return nil, err
+	}
+
 	return dc, nil
 }
 
-// Write dynamic config to a file
+// verifyChecksum checks the checksum line if config has one, and returns config without it.
+// Config without checksum line is written by hand and is returned as is
+func verifyChecksum(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(checksumPrefix)) {
+		return data, nil
+	}
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return nil, errConfigChecksum
+	}
+	want := string(data[len(checksumPrefix):i])
+	data = data[i+1:]
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != want {
+		return nil, errConfigChecksum
+	}
+	return data, nil
+}
+
+// Write dynamic config to a file with a checksum line on top.
+// File is replaced atomically, so ptp4u never reads it partially written
 func (dc *DynamicConfig) Write(path string) error {
 	d, err := yaml.Marshal(&dc)
 	if err != nil {
 		return err
 	}
+	sum := sha256.Sum256(d)
+	d = append([]byte(fmt.Sprintf("%s%x\n", checksumPrefix, sum)), d...)
 
-	return os.WriteFile(path, d, 0644)
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(d); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
 }
 
-// IfaceHasIP checks if selected IP is on interface
+// IfaceHasIP checks if every listen IP is on interface
 func (c *Config) IfaceHasIP() (bool, error) {
 	ips, err := ifaceIPs(c.Interface)
 	if err != nil {
 		return false, err
 	}
 
-	for _, ip := range ips {
-		if c.IP.Equal(ip) {
-			return true, nil
+	for _, lip := range c.ListenIPs() {
+		found := false
+		for _, ip := range ips {
+			if lip.Equal(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
 		}
 	}
 
-	return false, nil
+	return true, nil
 }
 
 // CreatePidFile creates a pid file in a defined location
@@ -17,11 +17,16 @@ limitations under the License.
 package server
 
 import (
+	"bytes"
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sys/unix"
 )
@@ -134,7 +139,8 @@ func TestReadDynamicConfigDamaged(t *testing.T) {
 }
 
 func TestWriteDynamicConfig(t *testing.T) {
-	expected := `clockaccuracy: 0
+	expected := `# checksum: sha256:9ba7b0d15dd773e20426a616299e1aabcbebb73a4108914662a5b0dab13751c5
+clockaccuracy: 0
 clockclass: 1
 draininterval: 2s
 maxsubduration: 3h0m0s
@@ -164,6 +170,36 @@ utcoffset: 37s
 	rl, err := os.ReadFile(cfg.Name())
 	require.NoError(t, err)
 	require.Equal(t, expected, string(rl))
+
+	read, err := ReadDynamicConfig(cfg.Name())
+	require.NoError(t, err)
+	require.Equal(t, dc, read)
+}
+
+func TestReadDynamicConfigChecksum(t *testing.T) {
+	dc := &DynamicConfig{ClockClass: 6, UTCOffset: 37 * time.Second, Version: 3}
+	cfg := filepath.Join(t.TempDir(), "ptp4u.yaml")
+	require.NoError(t, dc.Write(cfg))
+	read, err := ReadDynamicConfig(cfg)
+	require.NoError(t, err)
+	require.Equal(t, dc, read)
+
+	// partially written file
+	data, err := os.ReadFile(cfg)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cfg, data[:len(data)-5], 0644))
+	_, err = ReadDynamicConfig(cfg)
+	require.ErrorIs(t, err, errConfigChecksum)
+
+	// no checksum line at all
+	require.NoError(t, os.WriteFile(cfg, data[:bytes.IndexByte(data, '\n')], 0644))
+	_, err = ReadDynamicConfig(cfg)
+	require.ErrorIs(t, err, errConfigChecksum)
+
+	// bad value in checksummed file
+	require.NoError(t, os.WriteFile(cfg, bytes.Replace(data, []byte("clockclass: 6"), []byte("clockclass: 7"), 1), 0644))
+	_, err = ReadDynamicConfig(cfg)
+	require.ErrorIs(t, err, errConfigChecksum)
 }
 
 func TestUTCOffsetSanity(t *testing.T) {
@@ -176,6 +212,261 @@ func TestUTCOffsetSanity(t *testing.T) {
 	require.NoError(t, dc.UTCOffsetSanity())
 }
 
+func TestLivenessSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.LivenessSanity())
+	dc.DelayReqLiveness = 10
+	dc.DelayReqLivenessAction = LivenessActionPause
+	require.NoError(t, dc.LivenessSanity())
+	dc.DelayReqLivenessAction = LivenessActionCancel
+	require.NoError(t, dc.LivenessSanity())
+	dc.DelayReqLivenessAction = "ignore"
+	require.ErrorIs(t, dc.LivenessSanity(), errUnknownLivenessAction)
+	dc.DelayReqLivenessAction = ""
+	dc.DelayReqLiveness = -1
+	require.Error(t, dc.LivenessSanity())
+}
+
+func TestGrantLatencySLOSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.GrantLatencySLOSanity())
+	dc.GrantLatencySLO = 10 * time.Millisecond
+	require.NoError(t, dc.GrantLatencySLOSanity())
+	dc.GrantLatencySLO = -time.Millisecond
+	require.ErrorIs(t, dc.GrantLatencySLOSanity(), errNegativeGrantLatencySLO)
+}
+
+func TestMaxWorkerSendersSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.MaxWorkerSendersSanity())
+	dc.MaxWorkerSenders = 4
+	require.NoError(t, dc.MaxWorkerSendersSanity())
+	dc.MaxWorkerSenders = -1
+	require.ErrorIs(t, dc.MaxWorkerSendersSanity(), errNegativeMaxWorkerSenders)
+}
+
+func TestConfigMaxSenders(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{MaxSenders: 2}}
+	require.Equal(t, 2, c.maxSenders())
+	c.MaxWorkerSenders = 1
+	require.Equal(t, 1, c.maxSenders())
+}
+
+func TestOneStepClientsSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.OneStepClientsSanity())
+	dc.OneStepClients = []string{"192.168.0.1", "10.0.0.0/8", "2401:db00::/32", "::1"}
+	require.NoError(t, dc.OneStepClientsSanity())
+	dc.OneStepClients = []string{"10.0.0.0/8", "nope"}
+	require.EqualError(t, dc.OneStepClientsSanity(), `invalid one-step client: invalid IP address "nope"`)
+	dc.OneStepClients = []string{"10.0.0.0/33"}
+	require.Error(t, dc.OneStepClientsSanity())
+}
+
+func TestParseMulticast(t *testing.T) {
+	iface, group, err := parseMulticast("eth0", net.ParseIP("::"))
+	require.NoError(t, err)
+	require.Equal(t, "eth0", iface)
+	require.Equal(t, multicastGroupIPv6, group)
+
+	iface, group, err = parseMulticast("eth1", net.ParseIP("192.168.0.1"))
+	require.NoError(t, err)
+	require.Equal(t, "eth1", iface)
+	require.Equal(t, multicastGroupIPv4, group)
+
+	iface, group, err = parseMulticast("eth2=ff02::181", net.ParseIP("192.168.0.1"))
+	require.NoError(t, err)
+	require.Equal(t, "eth2", iface)
+	require.Equal(t, net.ParseIP("ff02::181"), group)
+
+	_, _, err = parseMulticast("eth0=10.0.0.1", net.ParseIP("::"))
+	require.EqualError(t, err, `invalid multicast group "10.0.0.1"`)
+	_, _, err = parseMulticast("=ff02::181", net.ParseIP("::"))
+	require.EqualError(t, err, `no interface in multicast entry "=ff02::181"`)
+}
+
+func TestMulticastSanity(t *testing.T) {
+	c := &StaticConfig{IP: net.ParseIP("::")}
+	require.NoError(t, c.MulticastSanity())
+
+	c.Multicast = []string{"eth0", "eth1=224.0.1.129"}
+	require.ErrorIs(t, c.MulticastSanity(), errNoMulticastInterval)
+
+	c.MulticastSyncInterval = time.Second
+	c.MulticastAnnounceInterval = 2 * time.Second
+	require.NoError(t, c.MulticastSanity())
+
+	c.Multicast = []string{"eth0=nope"}
+	require.Error(t, c.MulticastSanity())
+}
+
+func TestPHCCheckSanity(t *testing.T) {
+	c := &StaticConfig{}
+	require.NoError(t, c.PHCCheckSanity())
+
+	c.PHCCheck = PHCCheckDegrade
+	c.PHCMaxOffset = time.Millisecond
+	require.NoError(t, c.PHCCheckSanity())
+
+	c.PHCMaxOffset = -time.Millisecond
+	require.Error(t, c.PHCCheckSanity())
+
+	c.PHCMaxOffset = 0
+	c.PHCCheck = "panic"
+	require.ErrorIs(t, c.PHCCheckSanity(), errUnknownPHCCheck)
+}
+
+func TestLeapSecondSanity(t *testing.T) {
+	c := &StaticConfig{}
+	require.NoError(t, c.LeapSecondSanity())
+
+	c.LeapAnnounceWindow = time.Hour
+	c.LeapSecondClock = LeapSecondClockSystem
+	require.NoError(t, c.LeapSecondSanity())
+
+	c.LeapAnnounceWindow = 25 * time.Hour
+	require.Error(t, c.LeapSecondSanity())
+	c.LeapAnnounceWindow = -time.Hour
+	require.Error(t, c.LeapSecondSanity())
+
+	c.LeapAnnounceWindow = 0
+	c.LeapSecondClock = LeapSecondClockPHC
+	c.TimestampType = timestamp.SWTIMESTAMP
+	require.Error(t, c.LeapSecondSanity())
+	c.TimestampType = timestamp.HWTIMESTAMP
+	require.NoError(t, c.LeapSecondSanity())
+
+	c.LeapSecondClock = "sundial"
+	require.ErrorIs(t, c.LeapSecondSanity(), errUnknownLeapSecondClock)
+}
+
+func TestProfileSanity(t *testing.T) {
+	c := &StaticConfig{}
+	require.NoError(t, c.ProfileSanity())
+	p, err := c.PTPProfile()
+	require.NoError(t, err)
+	require.Equal(t, ptp.ProfileDefault, p)
+
+	c.Profile = "g8275.2"
+	require.Error(t, c.ProfileSanity())
+	c.DomainNumber = 44
+	require.NoError(t, c.ProfileSanity())
+	p, err = c.PTPProfile()
+	require.NoError(t, err)
+	require.Equal(t, ptp.ProfileG8275_2, p)
+
+	c.Profile = "enterprise"
+	require.Error(t, c.ProfileSanity())
+}
+
+func TestDynamicConfigOneStepCapable(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.False(t, dc.OneStepCapable(net.ParseIP("192.168.0.1")))
+
+	dc.OneStepClients = []string{"192.168.0.1", "10.0.0.0/8", "2401:db00::/32"}
+	require.True(t, dc.OneStepCapable(net.ParseIP("192.168.0.1")))
+	require.False(t, dc.OneStepCapable(net.ParseIP("192.168.0.2")))
+	require.True(t, dc.OneStepCapable(net.ParseIP("10.1.2.3")))
+	require.True(t, dc.OneStepCapable(net.ParseIP("2401:db00::1")))
+	require.False(t, dc.OneStepCapable(net.ParseIP("2401:db01::1")))
+}
+
+func TestReadDynamicConfigDomains(t *testing.T) {
+	config := `clockclass: 6
+utcoffset: "37s"
+domains:
+- domain: 24
+  clockclass: 7
+  clockaccuracy: 34
+  priority1: 200
+`
+	cfg, err := os.CreateTemp("", "ptp4u")
+	require.NoError(t, err)
+	defer os.Remove(cfg.Name())
+
+	_, err = cfg.WriteString(config)
+	require.NoError(t, err)
+
+	dc, err := ReadDynamicConfig(cfg.Name())
+	require.NoError(t, err)
+	require.Equal(t, []DomainConfig{{Domain: 24, ClockClass: 7, ClockAccuracy: 34, Priority1: 200}}, dc.Domains)
+}
+
+func TestDomainsSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.DomainsSanity())
+
+	dc.Domains = []DomainConfig{{Domain: 0}, {Domain: 24}}
+	require.NoError(t, dc.DomainsSanity())
+
+	dc.Domains = append(dc.Domains, DomainConfig{Domain: 24})
+	require.EqualError(t, dc.DomainsSanity(), "domain 24 is configured more than once")
+}
+
+func TestConfigDomain(t *testing.T) {
+	c := &Config{
+		StaticConfig:  StaticConfig{DomainNumber: 4},
+		DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6, ClockAccuracy: ptp.ClockAccuracyNanosecond100},
+	}
+
+	d, ok := c.Domain(4)
+	require.True(t, ok)
+	require.Equal(t, DomainConfig{Domain: 4, ClockClass: ptp.ClockClass6, ClockAccuracy: ptp.ClockAccuracyNanosecond100, Priority1: 128, Priority2: 128}, d)
+
+	_, ok = c.Domain(24)
+	require.False(t, ok)
+
+	c.Domains = []DomainConfig{
+		{Domain: 24, ClockClass: ptp.ClockClass7, ClockAccuracy: ptp.ClockAccuracyMicrosecond1, Priority2: 10},
+		{Domain: 4, ClockClass: ptp.ClockClass52, Priority1: 1, Priority2: 2},
+	}
+	d, ok = c.Domain(24)
+	require.True(t, ok)
+	require.Equal(t, DomainConfig{Domain: 24, ClockClass: ptp.ClockClass7, ClockAccuracy: ptp.ClockAccuracyMicrosecond1, Priority1: 128, Priority2: 10}, d)
+
+	// own entry overrides top level clock quality
+	d, ok = c.Domain(4)
+	require.True(t, ok)
+	require.Equal(t, DomainConfig{Domain: 4, ClockClass: ptp.ClockClass52, Priority1: 1, Priority2: 2}, d)
+}
+
+func TestLogLevelSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.LogLevelSanity())
+	dc.LogLevel = "debug"
+	require.NoError(t, dc.LogLevelSanity())
+	dc.LogLevel = "verbose"
+	require.EqualError(t, dc.LogLevelSanity(), "unrecognized log level: verbose")
+}
+
+func TestApplyLogLevel(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	c := &Config{StaticConfig: StaticConfig{LogLevel: "warning"}}
+	require.NoError(t, c.ApplyLogLevel())
+	require.Equal(t, log.WarnLevel, log.GetLevel())
+
+	// dynamic config overrides command line
+	c.DynamicConfig.LogLevel = "debug"
+	require.NoError(t, c.ApplyLogLevel())
+	require.Equal(t, log.DebugLevel, log.GetLevel())
+
+	c.DynamicConfig.LogLevel = ""
+	c.StaticConfig.LogLevel = "verbose"
+	require.EqualError(t, c.ApplyLogLevel(), "unrecognized log level: verbose")
+	require.Equal(t, log.DebugLevel, log.GetLevel())
+}
+
+func TestDynamicConfigChanged(t *testing.T) {
+	dc := &DynamicConfig{ClockClass: 6, UTCOffset: 37 * time.Second}
+	other := *dc
+	require.Empty(t, dc.Changed(&other))
+
+	other.ClockClass = 7
+	other.ACL = ACLConfig{Deny: []string{"10.0.0.0/8"}}
+	other.LogLevel = "debug"
+	require.Equal(t, []string{"acl", "clockclass", "loglevel"}, dc.Changed(&other))
+}
+
 func TestPidFile(t *testing.T) {
 	cfg, err := os.CreateTemp("", "ptp4u")
 	require.NoError(t, err)
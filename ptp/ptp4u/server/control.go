@@ -0,0 +1,305 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/drain"
+	log "github.com/sirupsen/logrus"
+)
+
+// Drain states reported by control API
+const (
+	// DrainStateServing means server accepts new grants
+	DrainStateServing = "serving"
+	// DrainStateDraining means server refuses new grants and waits for current ones to expire
+	DrainStateDraining = "draining"
+	// DrainStateDrained means server serves nothing
+	DrainStateDrained = "drained"
+)
+
+// drainRequest is a drain requested via control API
+type drainRequest int
+
+const (
+	// only drain checks apply
+	drainRequestNone drainRequest = iota
+	// drain right away
+	drainRequestNow
+	// refuse new grants and drain once current ones expire
+	drainRequestGraceful
+)
+
+var drainRequestToString = map[drainRequest]string{
+	drainRequestNone:     "none",
+	drainRequestNow:      "drain",
+	drainRequestGraceful: "graceful",
+}
+
+func (r drainRequest) String() string {
+	return drainRequestToString[r]
+}
+
+// DrainStatus is a drain status reported by control API
+type DrainStatus struct {
+	// State is serving, draining or drained
+	State string `json:"state"`
+	// Requested is a drain requested via control API: none, drain or graceful
+	Requested string `json:"requested"`
+	// Checks is true if any of the drain checks is engaged
+	Checks bool `json:"checks"`
+	// Subscriptions is a number of subscriptions still served
+	Subscriptions int `json:"subscriptions"`
+	// ExpiresInSec is how long until the last of them expires
+	ExpiresInSec int64 `json:"expires_in_sec"`
+}
+
+// SubscriptionState is a subscription reported by control API
+type SubscriptionState struct {
+	// Address is the subscriber IP address
+	Address string `json:"address"`
+	// PortIdentity is the subscriber clock identity and port number
+	PortIdentity string `json:"port_identity"`
+	// Type is the message type served, DELAY_REQ for SPTP
+	Type string `json:"type"`
+	// Domain is the PTP domain the subscription is served in
+	Domain uint8 `json:"domain"`
+	// IntervalSec is the granted interval between messages
+	IntervalSec float64 `json:"interval_sec"`
+	// Expire is when the grant expires
+	Expire time.Time `json:"expire"`
+	// Sent is how many messages were sent to the subscriber
+	Sent uint64 `json:"sent"`
+	// LastDelayReq is when the subscriber sent DelayReq last time, if ever
+	LastDelayReq *time.Time `json:"last_delay_req,omitempty"`
+	// Paused is true if the subscription is paused for lack of DelayReqs
+	Paused bool `json:"paused"`
+	// Multicast is true if messages are sent to a multicast group
+	Multicast bool `json:"multicast"`
+}
+
+// acceptingGrants returns false while server waits for current grants to expire
+func (s *Server) acceptingGrants() bool {
+	return atomic.LoadInt32(&s.refuseGrants) == 0
+}
+
+// engagedCheck returns the first drain check which wants server drained, nil if none does
+func (s *Server) engagedCheck() drain.Drain {
+	for _, check := range s.Checks {
+		if check.Check() {
+			return check
+		}
+	}
+	return nil
+}
+
+// remainingSubscriptions returns how many subscriptions are still running and when the last of them expires
+func (s *Server) remainingSubscriptions() (int, time.Time) {
+	var n int
+	var last time.Time
+	for _, w := range s.sw {
+		wn, wlast := w.remainingClients()
+		n += wn
+		if wlast.After(last) {
+			last = wlast
+		}
+	}
+	return n, last
+}
+
+// checkDrain drains or undrains the server according to drain checks, force undrain file and drain requested via control API
+func (s *Server) checkDrain() {
+	s.drainMux.Lock()
+	defer s.drainMux.Unlock()
+
+	var shouldDrain bool
+	if check := s.engagedCheck(); check != nil {
+		shouldDrain = true
+		log.Warningf("%T engaged", check)
+	}
+	refuseGrants := false
+	switch s.drainRequest {
+	case drainRequestNow:
+		shouldDrain = true
+	case drainRequestGraceful:
+		refuseGrants = true
+		// drain for real once the last grant is over
+		if n, _ := s.remainingSubscriptions(); n == 0 {
+			shouldDrain = true
+		}
+	}
+
+	if drain.Undrain(s.Config.UndrainFileName) {
+		log.Warningf("Force undrain file %s is planted, undraining!", s.Config.UndrainFileName)
+		shouldDrain = false
+		refuseGrants = false
+	}
+
+	if refuseGrants {
+		atomic.StoreInt32(&s.refuseGrants, 1)
+	} else {
+		atomic.StoreInt32(&s.refuseGrants, 0)
+	}
+
+	if shouldDrain {
+		log.Warningf("shifting traffic")
+		s.Drain()
+		s.Stats.SetDrain(1)
+	} else {
+		s.Undrain()
+		s.Stats.SetDrain(0)
+	}
+}
+
+// requestDrain records drain requested via control API and applies it right away
+func (s *Server) requestDrain(r drainRequest) {
+	s.drainMux.Lock()
+	if s.drainRequest != r {
+		log.Warningf("Drain request changed from %s to %s via control API", s.drainRequest, r)
+	}
+	s.drainRequest = r
+	s.drainMux.Unlock()
+	s.checkDrain()
+}
+
+// drainStatus returns current drain status
+func (s *Server) drainStatus() DrainStatus {
+	s.drainMux.Lock()
+	defer s.drainMux.Unlock()
+
+	st := DrainStatus{
+		State:     DrainStateServing,
+		Requested: s.drainRequest.String(),
+		Checks:    s.engagedCheck() != nil,
+	}
+	switch {
+	case s.ctx.Err() != nil:
+		st.State = DrainStateDrained
+	case !s.acceptingGrants():
+		st.State = DrainStateDraining
+	}
+	var last time.Time
+	st.Subscriptions, last = s.remainingSubscriptions()
+	if left := time.Until(last); left > 0 {
+		st.ExpiresInSec = int64(left.Round(time.Second).Seconds())
+	}
+	return st
+}
+
+// subscriptions returns state of every running subscription, ordered by address and type
+func (s *Server) subscriptions() []SubscriptionState {
+	res := []SubscriptionState{}
+	for _, w := range s.sw {
+		res = append(res, w.subscriptions()...)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Address != res[j].Address {
+			return res[i].Address < res[j].Address
+		}
+		if res[i].PortIdentity != res[j].PortIdentity {
+			return res[i].PortIdentity < res[j].PortIdentity
+		}
+		return res[i].Type < res[j].Type
+	})
+	return res
+}
+
+// controlHandler returns handler of the control API
+func (s *Server) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleControlRequest(nil))
+	mux.HandleFunc("/drain", s.handleControlRequest(func() { s.requestDrain(drainRequestNow) }))
+	mux.HandleFunc("/drain/graceful", s.handleControlRequest(func() { s.requestDrain(drainRequestGraceful) }))
+	mux.HandleFunc("/undrain", s.handleControlRequest(func() { s.requestDrain(drainRequestNone) }))
+	mux.HandleFunc("/subscriptions", s.handleSubscriptions)
+	mux.HandleFunc("/offenders", s.handleOffenders)
+	return mux
+}
+
+// handleControlRequest runs action on POST and replies with drain status. Without action it's a read-only GET
+func (s *Server) handleControlRequest(action func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		want := http.MethodPost
+		if action == nil {
+			want = http.MethodGet
+		}
+		if r.Method != want {
+			w.Header().Set("Allow", want)
+			http.Error(w, fmt.Sprintf("%s is not allowed, use %s", r.Method, want), http.StatusMethodNotAllowed)
+			return
+		}
+		if action != nil {
+			action()
+		}
+		writeControlReply(w, s.drainStatus())
+	}
+}
+
+// handleSubscriptions replies with state of every running subscription
+func (s *Server) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, fmt.Sprintf("%s is not allowed, use %s", r.Method, http.MethodGet), http.StatusMethodNotAllowed)
+		return
+	}
+	writeControlReply(w, s.subscriptions())
+}
+
+// handleOffenders replies with subscribers which exceeded their granted DelayReq rate lately
+func (s *Server) handleOffenders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, fmt.Sprintf("%s is not allowed, use %s", r.Method, http.MethodGet), http.StatusMethodNotAllowed)
+		return
+	}
+	writeControlReply(w, s.flood.offenders(&s.Config.FloodControl, time.Now()))
+}
+
+// writeControlReply writes v as JSON reply to control request
+func writeControlReply(w http.ResponseWriter, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(js); err != nil {
+		log.Errorf("Failed to reply to control request: %v", err)
+	}
+}
+
+// listenControl listens on the control API address, which is a path to a unix socket if it contains a slash
+func (s *Server) listenControl() (net.Listener, error) {
+	addr := s.Config.ControlAddr
+	if !strings.Contains(addr, "/") {
+		return net.Listen("tcp", addr)
+	}
+	// remove socket left by previous run
+	if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("removing stale control socket: %w", err)
+	}
+	return net.Listen("unix", addr)
+}
@@ -0,0 +1,210 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/drain"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func newControlTestServer(t *testing.T) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Config{StaticConfig: StaticConfig{SendWorkers: 1, UndrainFileName: filepath.Join(t.TempDir(), "undrain")}}
+	s := &Server{
+		Config: c,
+		Stats:  stats.NewJSONStats(),
+		ctx:    ctx,
+		cancel: cancel,
+		flood:  newFloodControl(),
+	}
+	s.sw = []*sendWorker{newSendWorker(0, c, s.Stats)}
+	return s
+}
+
+// subscribe starts sptp subscription which expires in d
+func subscribe(s *Server, d time.Duration) *SubscriptionClient {
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	w := s.sw[0]
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageDelayReq, s.Config, time.Second, time.Now().Add(d))
+	w.RegisterSubscription(ptp.PortIdentity{PortNumber: 1}, ptp.MessageDelayReq, sc)
+	go sc.Start(s.ctx)
+	return sc
+}
+
+func controlRequest(t *testing.T, h http.Handler, method, path string) (int, DrainStatus) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	st := DrainStatus{}
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &st))
+	}
+	return rec.Code, st
+}
+
+func TestControlDrainUndrain(t *testing.T) {
+	s := newControlTestServer(t)
+	h := s.controlHandler()
+
+	code, st := controlRequest(t, h, http.MethodGet, "/status")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, DrainStatus{State: DrainStateServing, Requested: "none"}, st)
+
+	code, st = controlRequest(t, h, http.MethodPost, "/drain")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, DrainStatus{State: DrainStateDrained, Requested: "drain"}, st)
+	require.Error(t, s.ctx.Err())
+
+	// drain checks don't undrain what was drained via API
+	s.checkDrain()
+	require.Error(t, s.ctx.Err())
+
+	code, st = controlRequest(t, h, http.MethodPost, "/undrain")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, DrainStatus{State: DrainStateServing, Requested: "none"}, st)
+	require.NoError(t, s.ctx.Err())
+}
+
+func TestControlUndrainKeepsChecks(t *testing.T) {
+	s := newControlTestServer(t)
+	file, err := os.CreateTemp(t.TempDir(), "drain")
+	require.NoError(t, err)
+	s.Checks = []drain.Drain{&drain.FileDrain{FileName: file.Name()}}
+	h := s.controlHandler()
+
+	// undrain via API only withdraws API request, drain file still holds
+	code, st := controlRequest(t, h, http.MethodPost, "/undrain")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, DrainStatus{State: DrainStateDrained, Requested: "none", Checks: true}, st)
+
+	// force undrain file wins
+	require.NoError(t, os.WriteFile(s.Config.UndrainFileName, nil, 0644))
+	s.checkDrain()
+	_, st = controlRequest(t, h, http.MethodGet, "/status")
+	require.Equal(t, DrainStatus{State: DrainStateServing, Requested: "none", Checks: true}, st)
+}
+
+func TestControlDrainGraceful(t *testing.T) {
+	s := newControlTestServer(t)
+	h := s.controlHandler()
+	sc := subscribe(s, time.Minute)
+	require.Eventually(t, sc.Running, time.Second, 10*time.Millisecond)
+
+	code, st := controlRequest(t, h, http.MethodPost, "/drain/graceful")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, DrainStateDraining, st.State)
+	require.Equal(t, "graceful", st.Requested)
+	require.Equal(t, 1, st.Subscriptions)
+	require.InDelta(t, 60, st.ExpiresInSec, 1)
+	require.False(t, s.acceptingGrants())
+	// current subscription is still served
+	require.NoError(t, s.ctx.Err())
+
+	// drained for real once the last grant is over
+	sc.Stop()
+	require.Eventually(t, func() bool { return !sc.Running() }, time.Second, 10*time.Millisecond)
+	s.checkDrain()
+	_, st = controlRequest(t, h, http.MethodGet, "/status")
+	require.Equal(t, DrainStatus{State: DrainStateDrained, Requested: "graceful"}, st)
+
+	_, st = controlRequest(t, h, http.MethodPost, "/undrain")
+	require.Equal(t, DrainStatus{State: DrainStateServing, Requested: "none"}, st)
+	require.True(t, s.acceptingGrants())
+}
+
+func TestControlMethods(t *testing.T) {
+	s := newControlTestServer(t)
+	h := s.controlHandler()
+
+	code, _ := controlRequest(t, h, http.MethodGet, "/drain")
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+	code, _ = controlRequest(t, h, http.MethodPost, "/status")
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+	require.NoError(t, s.ctx.Err())
+}
+
+func TestControlSubscriptions(t *testing.T) {
+	s := newControlTestServer(t)
+	h := s.controlHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/subscriptions", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, "[]", rec.Body.String())
+
+	sc := subscribe(s, time.Minute)
+	require.Eventually(t, sc.Running, time.Second, 10*time.Millisecond)
+	sc.incSent()
+	sc.incSent()
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/subscriptions", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	subs := []SubscriptionState{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &subs))
+	require.Len(t, subs, 1)
+	require.Equal(t, "127.0.0.1", subs[0].Address)
+	require.Equal(t, ptp.PortIdentity{PortNumber: 1}.String(), subs[0].PortIdentity)
+	require.Equal(t, ptp.MessageDelayReq.String(), subs[0].Type)
+	require.Equal(t, 1.0, subs[0].IntervalSec)
+	require.Equal(t, uint64(2), subs[0].Sent)
+	require.NotNil(t, subs[0].LastDelayReq)
+	require.WithinDuration(t, time.Now().Add(time.Minute), subs[0].Expire, time.Second)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/subscriptions", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	sc.Stop()
+	require.Eventually(t, func() bool { return len(s.subscriptions()) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestListenControl(t *testing.T) {
+	s := newControlTestServer(t)
+	s.Config.ControlAddr = filepath.Join(t.TempDir(), "ptp4u.sock")
+	// stale socket is replaced
+	require.NoError(t, os.WriteFile(s.Config.ControlAddr, nil, 0644))
+
+	ln, err := s.listenControl()
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() { _ = http.Serve(ln, s.controlHandler()) }()
+
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", s.Config.ControlAddr)
+		},
+	}}
+	resp, err := client.Get("http://ptp4u/status")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	st := DrainStatus{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&st))
+	require.Equal(t, DrainStateServing, st.State)
+}
@@ -0,0 +1,286 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// defaults of flood control
+const (
+	defaultFloodSPTPRate     = 1.0
+	defaultFloodMaxBlacklist = time.Hour
+)
+
+// FloodControlConfig throttles subscribers sending DelayReqs faster than they were granted
+type FloodControlConfig struct {
+	// Factor is how many times the granted rate subscriber may send DelayReqs at before it's throttled. 0 - disabled
+	Factor float64 `yaml:"factor,omitempty"`
+	// SPTPRate is how many DelayReqs per second SPTP subscribers are granted, as they don't negotiate it. 1 if not set
+	SPTPRate float64 `yaml:"sptprate,omitempty"`
+	// Blacklist is for how long all DelayReqs of the offender are dropped, doubled with every repeated offense. 0 - only throttle
+	Blacklist time.Duration `yaml:"blacklist,omitempty"`
+	// MaxBlacklist caps blacklist duration. Offenses are forgiven once subscriber behaves for that long. 1h if not set
+	MaxBlacklist time.Duration `yaml:"maxblacklist,omitempty"`
+}
+
+// FloodControlSanity checks if flood control settings are 0 or positive and blacklist fits into the max
+func (dc *DynamicConfig) FloodControlSanity() error {
+	c := dc.FloodControl
+	if c.Factor < 0 || c.SPTPRate < 0 || c.Blacklist < 0 || c.MaxBlacklist < 0 {
+		return fmt.Errorf("flood control settings must be 0 or positive")
+	}
+	if c.Factor > 0 && c.Factor < 1 {
+		return fmt.Errorf("flood control factor must be at least 1, got %v", c.Factor)
+	}
+	if c.Blacklist > c.maxBlacklist() {
+		return fmt.Errorf("flood control blacklist %v is longer than max blacklist %v", c.Blacklist, c.maxBlacklist())
+	}
+	return nil
+}
+
+// sptpRate returns DelayReq rate granted to SPTP subscribers
+func (c *FloodControlConfig) sptpRate() float64 {
+	if c.SPTPRate == 0 {
+		return defaultFloodSPTPRate
+	}
+	return c.SPTPRate
+}
+
+// maxBlacklist returns the longest blacklist duration
+func (c *FloodControlConfig) maxBlacklist() time.Duration {
+	if c.MaxBlacklist == 0 {
+		return defaultFloodMaxBlacklist
+	}
+	return c.MaxBlacklist
+}
+
+// blacklist returns blacklist duration for the nth offense
+func (c *FloodControlConfig) blacklist(offenses int) time.Duration {
+	d := c.Blacklist
+	for i := 1; i < offenses && d < c.maxBlacklist(); i++ {
+		d *= 2
+	}
+	if d > c.maxBlacklist() {
+		return c.maxBlacklist()
+	}
+	return d
+}
+
+// floodVerdict is what happens to DelayReq from a subscriber
+type floodVerdict int
+
+const (
+	// serve it
+	floodAllowed floodVerdict = iota
+	// drop it, subscriber is still throttled or blacklisted
+	floodDropped
+	// drop it, subscriber just exceeded the limit and is throttled
+	floodThrottled
+	// drop it, subscriber just exceeded the limit and is blacklisted
+	floodBlacklisted
+)
+
+// FloodOffender is a subscriber reported by control API for exceeding its granted DelayReq rate
+type FloodOffender struct {
+	// Address is the subscriber IP address
+	Address string `json:"address"`
+	// Offenses is how many times subscriber exceeded the limit lately
+	Offenses int `json:"offenses"`
+	// Dropped is how many DelayReqs of the subscriber were dropped
+	Dropped uint64 `json:"dropped"`
+	// Throttled is true while subscriber sends DelayReqs over the limit
+	Throttled bool `json:"throttled"`
+	// BlacklistedUntil is when subscriber will be served again, if it's blacklisted
+	BlacklistedUntil *time.Time `json:"blacklisted_until,omitempty"`
+}
+
+// floodClient is a token bucket of a single subscriber, one token per DelayReq
+type floodClient struct {
+	tokens float64
+	// last time bucket was refilled
+	refilled         time.Time
+	lastSeen         time.Time
+	throttled        bool
+	offenses         int
+	lastOffense      time.Time
+	blacklistedUntil time.Time
+	dropped          uint64
+}
+
+// floodKey is a subscriber IP address in 16 bytes form
+type floodKey [16]byte
+
+// sockaddrFloodKey returns key of the subscriber without allocating
+func sockaddrFloodKey(sa unix.Sockaddr) floodKey {
+	var k floodKey
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		// IPv4-mapped IPv6 address, same as net.IP uses
+		k[10], k[11] = 0xff, 0xff
+		copy(k[12:], sa.Addr[:])
+	case *unix.SockaddrInet6:
+		k = sa.Addr
+	}
+	return k
+}
+
+// floodControl tracks DelayReq rates of all subscribers
+type floodControl struct {
+	sync.Mutex
+	clients map[floodKey]*floodClient
+}
+
+func newFloodControl() *floodControl {
+	return &floodControl{clients: map[floodKey]*floodClient{}}
+}
+
+// check accounts DelayReq received at now from subscriber granted rate DelayReqs per second, and decides what to do with it.
+// Subscriber may send up to cfg.Factor times the granted rate, with bursts of up to a second worth of DelayReqs.
+// Exceeding the limit is an offense, and it lasts until subscriber slows down enough to fill the bucket up again
+func (f *floodControl) check(key floodKey, rate float64, cfg *FloodControlConfig, now time.Time) floodVerdict {
+	limit := rate * cfg.Factor
+	burst := math.Max(limit, 1)
+
+	f.Lock()
+	defer f.Unlock()
+	c, found := f.clients[key]
+	if !found {
+		c = &floodClient{tokens: burst, refilled: now}
+		f.clients[key] = c
+	}
+	c.lastSeen = now
+	if now.Before(c.blacklistedUntil) {
+		c.dropped++
+		return floodDropped
+	}
+	c.tokens = math.Min(burst, c.tokens+now.Sub(c.refilled).Seconds()*limit)
+	c.refilled = now
+	if c.throttled && c.tokens >= burst {
+		c.throttled = false
+	}
+	if c.tokens >= 1 {
+		c.tokens--
+		return floodAllowed
+	}
+	c.dropped++
+	if c.throttled {
+		return floodDropped
+	}
+	c.throttled = true
+	if now.Sub(c.lastOffense) > cfg.maxBlacklist() {
+		c.offenses = 0
+	}
+	c.offenses++
+	c.lastOffense = now
+	if cfg.Blacklist == 0 {
+		return floodThrottled
+	}
+	c.blacklistedUntil = now.Add(cfg.blacklist(c.offenses))
+	return floodBlacklisted
+}
+
+// blacklistedUntil returns when subscriber is served again
+func (f *floodControl) blacklistedUntil(key floodKey) time.Time {
+	f.Lock()
+	defer f.Unlock()
+	if c, found := f.clients[key]; found {
+		return c.blacklistedUntil
+	}
+	return time.Time{}
+}
+
+// prune forgets subscribers not seen for longer than offenses are remembered, and returns how many are currently offending
+func (f *floodControl) prune(cfg *FloodControlConfig, now time.Time) int {
+	f.Lock()
+	defer f.Unlock()
+	offenders := 0
+	for k, c := range f.clients {
+		blacklisted := now.Before(c.blacklistedUntil)
+		if !blacklisted && now.Sub(c.lastSeen) > cfg.maxBlacklist() {
+			delete(f.clients, k)
+			continue
+		}
+		if blacklisted || c.throttled {
+			offenders++
+		}
+	}
+	return offenders
+}
+
+// offenders returns subscribers which exceeded the limit lately, ordered by address
+func (f *floodControl) offenders(cfg *FloodControlConfig, now time.Time) []FloodOffender {
+	f.Lock()
+	defer f.Unlock()
+	res := []FloodOffender{}
+	for k, c := range f.clients {
+		if c.offenses == 0 || now.Sub(c.lastOffense) > cfg.maxBlacklist() {
+			continue
+		}
+		o := FloodOffender{
+			Address:   net.IP(k[:]).String(),
+			Offenses:  c.offenses,
+			Dropped:   c.dropped,
+			Throttled: c.throttled,
+		}
+		if now.Before(c.blacklistedUntil) {
+			t := c.blacklistedUntil
+			o.BlacklistedUntil = &t
+		}
+		res = append(res, o)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Address < res[j].Address })
+	return res
+}
+
+// floodAllowed checks if DelayReq from the subscriber granted rate DelayReqs per second should be served,
+// and logs and counts it otherwise
+func (s *Server) floodAllowed(sa unix.Sockaddr, rate float64) bool {
+	cfg := &s.Config.FloodControl
+	// multicast subscriptions have no grant to compare with
+	if cfg.Factor == 0 || rate <= 0 || math.IsInf(rate, 0) {
+		return true
+	}
+	key := sockaddrFloodKey(sa)
+	verdict := s.flood.check(key, rate, cfg, time.Now())
+	if verdict == floodAllowed {
+		return true
+	}
+	s.Stats.IncFloodThrottled()
+	switch verdict {
+	case floodThrottled:
+		log.Warningf("%s sends DelayReqs over %.1f times the granted rate of %.2f/s, throttling", timestamp.SockaddrToIP(sa), cfg.Factor, rate)
+	case floodBlacklisted:
+		log.Warningf("%s sends DelayReqs over %.1f times the granted rate of %.2f/s, blacklisting until %v", timestamp.SockaddrToIP(sa), cfg.Factor, rate, s.flood.blacklistedUntil(key))
+		s.Stats.IncFloodBlacklisted()
+	}
+	return false
+}
+
+// reportFlood forgets subscribers which behave and exports the number of current offenders
+func (s *Server) reportFlood() {
+	s.Stats.SetFloodOffenders(int64(s.flood.prune(&s.Config.FloodControl, time.Now())))
+}
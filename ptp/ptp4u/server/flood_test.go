@@ -0,0 +1,226 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// floodStats records flood control stats, rest of stats.Stats is not used
+type floodStats struct {
+	stats.Stats
+	throttled   int
+	blacklisted int
+	offenders   int64
+}
+
+func (s *floodStats) IncFloodThrottled() {
+	s.throttled++
+}
+
+func (s *floodStats) IncFloodBlacklisted() {
+	s.blacklisted++
+}
+
+func (s *floodStats) SetFloodOffenders(offenders int64) {
+	s.offenders = offenders
+}
+
+func TestFloodControlSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.FloodControlSanity())
+
+	dc.FloodControl = FloodControlConfig{Factor: 10, SPTPRate: 2, Blacklist: time.Minute, MaxBlacklist: time.Hour}
+	require.NoError(t, dc.FloodControlSanity())
+
+	dc.FloodControl = FloodControlConfig{Factor: -1}
+	require.Error(t, dc.FloodControlSanity())
+	dc.FloodControl = FloodControlConfig{Factor: 0.5}
+	require.Error(t, dc.FloodControlSanity())
+	dc.FloodControl = FloodControlConfig{Factor: 10, Blacklist: -time.Second}
+	require.Error(t, dc.FloodControlSanity())
+	// default max blacklist is an hour
+	dc.FloodControl = FloodControlConfig{Factor: 10, Blacklist: 2 * time.Hour}
+	require.Error(t, dc.FloodControlSanity())
+	dc.FloodControl = FloodControlConfig{Factor: 10, Blacklist: time.Minute, MaxBlacklist: time.Second}
+	require.Error(t, dc.FloodControlSanity())
+}
+
+func TestFloodControlConfigBlacklist(t *testing.T) {
+	c := &FloodControlConfig{Blacklist: time.Minute, MaxBlacklist: 5 * time.Minute}
+	require.Equal(t, time.Minute, c.blacklist(1))
+	require.Equal(t, 2*time.Minute, c.blacklist(2))
+	require.Equal(t, 4*time.Minute, c.blacklist(3))
+	require.Equal(t, 5*time.Minute, c.blacklist(4))
+	require.Equal(t, 5*time.Minute, c.blacklist(100))
+
+	require.Equal(t, defaultFloodSPTPRate, c.sptpRate())
+	c.SPTPRate = 4
+	require.Equal(t, 4.0, c.sptpRate())
+}
+
+func TestSockaddrFloodKey(t *testing.T) {
+	for _, ip := range []string{"192.168.0.1", "2401:db00::1"} {
+		k := sockaddrFloodKey(timestamp.IPToSockaddr(net.ParseIP(ip), 319))
+		require.Equal(t, ip, net.IP(k[:]).String())
+	}
+}
+
+func TestFloodControlThrottle(t *testing.T) {
+	f := newFloodControl()
+	cfg := &FloodControlConfig{Factor: 2}
+	key := sockaddrFloodKey(timestamp.IPToSockaddr(net.ParseIP("192.168.0.1"), 319))
+	now := time.Now()
+
+	// granted 1/s, so 2 DelayReqs a second are fine
+	for i := 0; i < 10; i++ {
+		require.Equal(t, floodAllowed, f.check(key, 1, cfg, now))
+		require.Equal(t, floodAllowed, f.check(key, 1, cfg, now.Add(100*time.Millisecond)))
+		now = now.Add(time.Second)
+	}
+	require.Empty(t, f.offenders(cfg, now))
+
+	// 100/s is too much
+	var allowed int
+	for i := 0; i < 100; i++ {
+		now = now.Add(10 * time.Millisecond)
+		switch v := f.check(key, 1, cfg, now); v {
+		case floodAllowed:
+			allowed++
+		case floodThrottled:
+			require.Equal(t, 1, f.clients[key].offenses, "only the first drop is an offense")
+		default:
+			require.Equal(t, floodDropped, v)
+		}
+	}
+	require.InDelta(t, 2+2, allowed, 1)
+	require.Equal(t, 1, f.prune(cfg, now))
+	offenders := f.offenders(cfg, now)
+	require.Len(t, offenders, 1)
+	require.Equal(t, "192.168.0.1", offenders[0].Address)
+	require.True(t, offenders[0].Throttled)
+	require.Nil(t, offenders[0].BlacklistedUntil)
+
+	// slowing down ends the offense
+	now = now.Add(time.Second)
+	require.Equal(t, floodAllowed, f.check(key, 1, cfg, now))
+	require.Equal(t, 0, f.prune(cfg, now))
+	require.False(t, f.offenders(cfg, now)[0].Throttled)
+
+	// offense is remembered for max blacklist, and then subscriber is forgotten
+	require.Equal(t, 0, f.prune(cfg, now.Add(2*time.Hour)))
+	require.Empty(t, f.clients)
+}
+
+func TestFloodControlBlacklist(t *testing.T) {
+	f := newFloodControl()
+	cfg := &FloodControlConfig{Factor: 1, Blacklist: time.Minute, MaxBlacklist: 10 * time.Minute}
+	key := sockaddrFloodKey(timestamp.IPToSockaddr(net.ParseIP("2401:db00::1"), 319))
+	now := time.Now()
+
+	flood := func() {
+		require.Equal(t, floodAllowed, f.check(key, 1, cfg, now))
+		require.Equal(t, floodBlacklisted, f.check(key, 1, cfg, now))
+	}
+	flood()
+	require.Equal(t, now.Add(time.Minute), f.blacklistedUntil(key))
+	require.Equal(t, floodDropped, f.check(key, 1, cfg, now.Add(59*time.Second)))
+	require.Equal(t, 1, f.prune(cfg, now.Add(59*time.Second)))
+
+	// repeated offense doubles the blacklist
+	now = now.Add(2 * time.Minute)
+	flood()
+	require.Equal(t, now.Add(2*time.Minute), f.blacklistedUntil(key))
+	offenders := f.offenders(cfg, now)
+	require.Len(t, offenders, 1)
+	require.Equal(t, 2, offenders[0].Offenses)
+	require.Equal(t, uint64(3), offenders[0].Dropped)
+	require.NotNil(t, offenders[0].BlacklistedUntil)
+
+	// offenses are forgiven after max blacklist of good behavior
+	now = now.Add(11 * time.Minute)
+	flood()
+	require.Equal(t, now.Add(time.Minute), f.blacklistedUntil(key))
+}
+
+func TestServerFloodAllowed(t *testing.T) {
+	st := &floodStats{}
+	s := &Server{
+		Config: &Config{},
+		Stats:  st,
+		flood:  newFloodControl(),
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("192.168.0.1"), 319)
+
+	// disabled
+	for i := 0; i < 100; i++ {
+		require.True(t, s.floodAllowed(sa, 1))
+	}
+	require.Empty(t, s.flood.clients)
+
+	s.Config.FloodControl = FloodControlConfig{Factor: 1, Blacklist: time.Minute}
+	require.True(t, s.floodAllowed(sa, 1))
+	require.False(t, s.floodAllowed(sa, 1))
+	require.False(t, s.floodAllowed(sa, 1))
+	require.Equal(t, 2, st.throttled)
+	require.Equal(t, 1, st.blacklisted)
+	s.reportFlood()
+	require.Equal(t, int64(1), st.offenders)
+
+	// no grant to compare with
+	other := timestamp.IPToSockaddr(net.ParseIP("192.168.0.2"), 319)
+	for i := 0; i < 10; i++ {
+		require.True(t, s.floodAllowed(other, 1/time.Duration(0).Seconds()))
+	}
+	require.True(t, s.floodAllowed(&unix.SockaddrInet4{}, 0))
+}
+
+func TestControlOffenders(t *testing.T) {
+	s := newControlTestServer(t)
+	s.Config.FloodControl = FloodControlConfig{Factor: 1}
+	h := s.controlHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/offenders", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, "[]", rec.Body.String())
+
+	sa := timestamp.IPToSockaddr(net.ParseIP("192.168.0.1"), 319)
+	require.True(t, s.floodAllowed(sa, 1))
+	require.False(t, s.floodAllowed(sa, 1))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/offenders", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	offenders := []FloodOffender{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &offenders))
+	require.Equal(t, []FloodOffender{{Address: "192.168.0.1", Offenses: 1, Dropped: 1, Throttled: true}}, offenders)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/offenders", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/leapsectz"
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// utcOffsetBeforeLeaps is TAI UTC offset before leap seconds were introduced in 1972
+const utcOffsetBeforeLeaps = 10 * time.Second
+
+// maxLeapAnnounceWindow is the longest a leap second can be announced before it happens, and the default.
+// Leap flags say the last minute of the current UTC day has 61 or 59 seconds, and leap seconds happen at the end of UTC day
+const maxLeapAnnounceWindow = 24 * time.Hour
+
+// leapFlagsMask is Announce flags which follow leap second file
+const leapFlagsMask = ptp.FlagLeap61 | ptp.FlagLeap59 | ptp.FlagCurrentUtcOffsetValid
+
+// leapState is UTC offset and upcoming leap second at some moment
+type leapState struct {
+	// utcOffset is UTC offset in effect
+	utcOffset time.Duration
+	// next is when the next leap second transition is, zero if none is known
+	next time.Time
+	// nextLeap is 1 if the next leap second is inserted, -1 if deleted
+	nextLeap int
+}
+
+// leapStateAt returns UTC offset and upcoming leap second at t according to list of leap seconds
+func leapStateAt(leaps []leapsectz.LeapSecond, t time.Time) leapState {
+	sorted := make([]leapsectz.LeapSecond, len(leaps))
+	copy(sorted, leaps)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Tleap < sorted[j].Tleap })
+
+	st := leapState{utcOffset: utcOffsetBeforeLeaps}
+	var nleap int32
+	for _, l := range sorted {
+		if !l.Time().After(t) {
+			st.utcOffset = utcOffsetBeforeLeaps + time.Duration(l.Nleap)*time.Second
+			nleap = l.Nleap
+			continue
+		}
+		st.next = l.Time().UTC()
+		st.nextLeap = 1
+		if l.Nleap < nleap {
+			st.nextLeap = -1
+		}
+		break
+	}
+	return st
+}
+
+// leapStateAtTAI returns UTC offset and upcoming leap second at TAI time t according to list of leap seconds.
+// Leap second is over once TAI reaches the start of the next UTC day, so the inserted second still belongs to the day it ends
+func leapStateAtTAI(leaps []leapsectz.LeapSecond, t time.Time) leapState {
+	sorted := make([]leapsectz.LeapSecond, len(leaps))
+	copy(sorted, leaps)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Tleap < sorted[j].Tleap })
+
+	st := leapState{utcOffset: utcOffsetBeforeLeaps}
+	var nleap int32
+	for _, l := range sorted {
+		after := utcOffsetBeforeLeaps + time.Duration(l.Nleap)*time.Second
+		if !l.Time().Add(after).After(t) {
+			st.utcOffset = after
+			nleap = l.Nleap
+			continue
+		}
+		st.next = l.Time().UTC()
+		st.nextLeap = 1
+		if l.Nleap < nleap {
+			st.nextLeap = -1
+		}
+		break
+	}
+	return st
+}
+
+// utc converts TAI time t to UTC. Inserted leap second has no UTC time of its own,
+// it's reported as the last moment of the day it ends
+func (st leapState) utc(t time.Time) time.Time {
+	utc := t.Add(-st.utcOffset).UTC()
+	if !st.next.IsZero() && !utc.Before(st.next) {
+		return st.next.Add(-time.Nanosecond)
+	}
+	return utc
+}
+
+// tai converts change returned by nextChange to TAI. Leap second transition happens
+// once TAI reaches the start of the next UTC day, which is after the inserted second
+func (st leapState) tai(change time.Time) time.Time {
+	if change.Equal(st.next) {
+		return change.Add(st.utcOffset + time.Duration(st.nextLeap)*time.Second)
+	}
+	return change.Add(st.utcOffset)
+}
+
+// flags returns Announce flags at t with leap second announced window before it happens
+func (st leapState) flags(t time.Time, window time.Duration) uint16 {
+	flags := ptp.FlagCurrentUtcOffsetValid
+	if st.next.IsZero() || st.next.Sub(t) > window {
+		return flags
+	}
+	if st.nextLeap > 0 {
+		return flags | ptp.FlagLeap61
+	}
+	return flags | ptp.FlagLeap59
+}
+
+// nextChange returns when flags or UTC offset change after t, zero if never
+func (st leapState) nextChange(t time.Time, window time.Duration) time.Time {
+	if st.next.IsZero() {
+		return st.next
+	}
+	if announce := st.next.Add(-window); t.Before(announce) {
+		return announce
+	}
+	return st.next
+}
+
+// untilChange returns how long after t flags or UTC offset change, 0 if never. t is TAI if tai is set, UTC otherwise
+func (st leapState) untilChange(t time.Time, tai bool, window time.Duration) time.Duration {
+	utc := t
+	if tai {
+		utc = st.utc(t)
+	}
+	next := st.nextChange(utc, window)
+	if next.IsZero() {
+		return 0
+	}
+	if tai {
+		next = st.tai(next)
+	}
+	return next.Sub(t)
+}
+
+// leapAnnounceWindow returns how long before a leap second it's announced
+func (c *StaticConfig) leapAnnounceWindow() time.Duration {
+	if c.LeapAnnounceWindow == 0 {
+		return maxLeapAnnounceWindow
+	}
+	return c.LeapAnnounceWindow
+}
+
+// leapClock returns current time leap state is evaluated at, which is TAI if tai is set, UTC otherwise
+type leapClock func() (t time.Time, tai bool, err error)
+
+// systemLeapClock is system clock running UTC
+func systemLeapClock() (time.Time, bool, error) {
+	return time.Now(), false, nil
+}
+
+// leapClock returns clock leap state follows according to LeapSecondClock
+func (s *Server) leapClock() (leapClock, error) {
+	if s.Config.LeapSecondClock != LeapSecondClockPHC {
+		return systemLeapClock, nil
+	}
+	device, err := s.phcDevice()
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Leap seconds follow PTP time of PHC %s", device)
+	return func() (time.Time, bool, error) {
+		t, err := device.Time()
+		return t, true, err
+	}, nil
+}
+
+// leapFlags returns Announce flags following leap second file, none if it's not used
+func (c *Config) leapFlags() uint16 {
+	return uint16(atomic.LoadUint32(&c.leapFlagField))
+}
+
+// setLeapFlags atomically sets Announce flags following leap second file
+func (c *Config) setLeapFlags(flags uint16) {
+	atomic.StoreUint32(&c.leapFlagField, uint32(flags))
+}
+
+// updateLeap reads leap second file and applies UTC offset and leap flags at t, which is TAI if tai is set, UTC otherwise.
+// It returns the state applied
+func (s *Server) updateLeap(t time.Time, tai bool) (leapState, error) {
+	leaps, err := leapsectz.Parse(s.Config.LeapSecondFile)
+	if err != nil {
+		return leapState{}, err
+	}
+	st := leapStateAt(leaps, t)
+	utc := t
+	if tai {
+		st = leapStateAtTAI(leaps, t)
+		utc = st.utc(t)
+	}
+
+	dcMux.Lock()
+	defer dcMux.Unlock()
+	if s.leap == nil || *s.leap != st {
+		log.Infof("Leap second file %s: UTC offset %v, next leap second %+d at %v", s.Config.LeapSecondFile, st.utcOffset, st.nextLeap, st.next)
+	}
+	s.leap = &st
+	s.overrideUTCOffset()
+	s.Config.resetAlternateTimeOffsets()
+	s.Config.setLeapFlags(st.flags(utc, s.Config.leapAnnounceWindow()))
+	return st, nil
+}
+
+// overrideUTCOffset replaces UTC offset of dynamic config with the one from leap second file, if it's used.
+// Must be called under dcMux once server is running
+func (s *Server) overrideUTCOffset() {
+	if s.leap == nil || s.Config.UTCOffset == s.leap.utcOffset {
+		return
+	}
+	log.Warningf("UTC offset %v of the config is overridden by %v from leap second file", s.Config.UTCOffset, s.leap.utcOffset)
+	s.Config.UTCOffset = s.leap.utcOffset
+}
+
+// trackLeapSeconds keeps UTC offset and leap flags in line with leap second file.
+// File is re-read every LeapSecondInterval, and at the moments flags or UTC offset change according to clock
+func (s *Server) trackLeapSeconds(clock leapClock) {
+	for {
+		wait := s.Config.LeapSecondInterval
+		now, tai, err := clock()
+		if err != nil {
+			log.Errorf("Failed to read PTP time, following system clock for leap seconds: %v", err)
+			now, tai, _ = systemLeapClock()
+		}
+		st, err := s.updateLeap(now, tai)
+		if err != nil {
+			log.Errorf("Failed to read leap second file, keeping UTC offset %v: %v", s.Config.UTCOffset, err)
+		} else if left := st.untilChange(now, tai, s.Config.leapAnnounceWindow()); left > 0 && left < wait {
+			wait = left
+		}
+		time.Sleep(wait)
+	}
+}
+
+// reportLeap reports upcoming leap second
+func (s *Server) reportLeap() {
+	dcMux.Lock()
+	defer dcMux.Unlock()
+	if s.leap == nil || s.leap.next.IsZero() {
+		return
+	}
+	s.Stats.SetLeapNext(int64(s.leap.nextLeap))
+	s.Stats.SetLeapNextUnix(s.leap.next.Unix())
+}
@@ -0,0 +1,268 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/leapsectz"
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+// leapAt returns leap second which makes it n leap seconds total at t
+func leapAt(t time.Time, n int32) leapsectz.LeapSecond {
+	return leapsectz.LeapSecond{Tleap: uint64(t.Unix() + int64(n) - 1), Nleap: n}
+}
+
+var (
+	leap2015 = time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	leap2017 = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	leap2027 = time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func testLeaps() []leapsectz.LeapSecond {
+	return []leapsectz.LeapSecond{leapAt(leap2017, 27), leapAt(leap2015, 26)}
+}
+
+func TestLeapStateAt(t *testing.T) {
+	st := leapStateAt(testLeaps(), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.Equal(t, leapState{utcOffset: 37 * time.Second}, st)
+
+	st = leapStateAt(testLeaps(), leap2017.Add(-time.Second))
+	require.Equal(t, leapState{utcOffset: 36 * time.Second, next: leap2017, nextLeap: 1}, st)
+
+	// offset changes at the transition
+	st = leapStateAt(testLeaps(), leap2017)
+	require.Equal(t, 37*time.Second, st.utcOffset)
+	require.True(t, st.next.IsZero())
+
+	st = leapStateAt(nil, leap2017)
+	require.Equal(t, utcOffsetBeforeLeaps, st.utcOffset)
+
+	// deleted leap second
+	leaps := append(testLeaps(), leapAt(leap2027, 26))
+	st = leapStateAt(leaps, leap2027.Add(-time.Hour))
+	require.Equal(t, leapState{utcOffset: 37 * time.Second, next: leap2027, nextLeap: -1}, st)
+	require.Equal(t, 36*time.Second, leapStateAt(leaps, leap2027).utcOffset)
+}
+
+func TestLeapStateAtTAI(t *testing.T) {
+	// inserted second is over once TAI reaches the start of the next UTC day
+	st := leapStateAtTAI(testLeaps(), leap2017.Add(36*time.Second))
+	require.Equal(t, leapState{utcOffset: 36 * time.Second, next: leap2017, nextLeap: 1}, st)
+	st = leapStateAtTAI(testLeaps(), leap2017.Add(37*time.Second-time.Nanosecond))
+	require.Equal(t, 36*time.Second, st.utcOffset)
+	st = leapStateAtTAI(testLeaps(), leap2017.Add(37*time.Second))
+	require.Equal(t, leapState{utcOffset: 37 * time.Second}, st)
+
+	// deleted second is over a second earlier in TAI
+	leaps := append(testLeaps(), leapAt(leap2027, 26))
+	st = leapStateAtTAI(leaps, leap2027.Add(36*time.Second-time.Nanosecond))
+	require.Equal(t, leapState{utcOffset: 37 * time.Second, next: leap2027, nextLeap: -1}, st)
+	st = leapStateAtTAI(leaps, leap2027.Add(36*time.Second))
+	require.Equal(t, leapState{utcOffset: 36 * time.Second}, st)
+
+	require.Equal(t, utcOffsetBeforeLeaps, leapStateAtTAI(nil, leap2017).utcOffset)
+}
+
+func TestLeapStateUTC(t *testing.T) {
+	st := leapState{utcOffset: 36 * time.Second, next: leap2017, nextLeap: 1}
+	require.Equal(t, leap2017.Add(-time.Second), st.utc(leap2017.Add(35*time.Second)))
+	// 23:59:60 is reported as the end of the day
+	require.Equal(t, leap2017.Add(-time.Nanosecond), st.utc(leap2017.Add(36*time.Second)))
+	require.Equal(t, leap2017.Add(-time.Nanosecond), st.utc(leap2017.Add(36500*time.Millisecond)))
+
+	require.Equal(t, leap2017.Add(-time.Hour+36*time.Second), st.tai(leap2017.Add(-time.Hour)))
+	require.Equal(t, leap2017.Add(37*time.Second), st.tai(leap2017))
+	st.nextLeap = -1
+	require.Equal(t, leap2017.Add(35*time.Second), st.tai(leap2017))
+}
+
+func TestLeapStateFlags(t *testing.T) {
+	st := leapState{utcOffset: 36 * time.Second, next: leap2017, nextLeap: 1}
+	dayBefore := leap2017.Add(-maxLeapAnnounceWindow)
+
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid, st.flags(dayBefore.Add(-time.Second), maxLeapAnnounceWindow))
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid|ptp.FlagLeap61, st.flags(dayBefore, maxLeapAnnounceWindow))
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid|ptp.FlagLeap61, st.flags(leap2017.Add(-time.Second), maxLeapAnnounceWindow))
+
+	// shorter window
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid, st.flags(dayBefore, time.Hour))
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid|ptp.FlagLeap61, st.flags(leap2017.Add(-time.Hour), time.Hour))
+
+	st.nextLeap = -1
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid|ptp.FlagLeap59, st.flags(dayBefore, maxLeapAnnounceWindow))
+
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid, leapState{utcOffset: 37 * time.Second}.flags(leap2017, maxLeapAnnounceWindow))
+}
+
+func TestLeapStateNextChange(t *testing.T) {
+	st := leapState{utcOffset: 36 * time.Second, next: leap2017, nextLeap: 1}
+	dayBefore := leap2017.Add(-maxLeapAnnounceWindow)
+	require.Equal(t, dayBefore, st.nextChange(dayBefore.Add(-time.Hour), maxLeapAnnounceWindow))
+	require.Equal(t, leap2017, st.nextChange(dayBefore, maxLeapAnnounceWindow))
+	require.Equal(t, leap2017.Add(-time.Hour), st.nextChange(dayBefore, time.Hour))
+	require.True(t, leapState{}.nextChange(leap2017, maxLeapAnnounceWindow).IsZero())
+}
+
+func TestLeapStateUntilChange(t *testing.T) {
+	st := leapState{utcOffset: 36 * time.Second, next: leap2017, nextLeap: 1}
+	require.Equal(t, time.Hour, st.untilChange(leap2017.Add(-25*time.Hour), false, maxLeapAnnounceWindow))
+	require.Equal(t, time.Second, st.untilChange(leap2017.Add(-time.Second), false, maxLeapAnnounceWindow))
+	// in TAI the inserted second has to pass too
+	require.Equal(t, 2*time.Second, st.untilChange(leap2017.Add(35*time.Second), true, maxLeapAnnounceWindow))
+	require.Equal(t, time.Hour, st.untilChange(leap2017.Add(-25*time.Hour+36*time.Second), true, maxLeapAnnounceWindow))
+	require.Equal(t, time.Duration(0), leapState{}.untilChange(leap2017, true, maxLeapAnnounceWindow))
+}
+
+func writeLeapFile(t *testing.T, leaps []leapsectz.LeapSecond) string {
+	path := filepath.Join(t.TempDir(), "UTC")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, leapsectz.Write(f, '2', leaps, ""))
+	return path
+}
+
+func TestUpdateLeap(t *testing.T) {
+	cfg := filepath.Join(t.TempDir(), "ptp4u.yaml")
+	c := &Config{
+		StaticConfig: StaticConfig{
+			ConfigFile:     cfg,
+			LeapSecondFile: writeLeapFile(t, testLeaps()),
+			LogLevel:       "info",
+		},
+		DynamicConfig: DynamicConfig{UTCOffset: 35 * time.Second},
+	}
+	s := &Server{Config: c, Stats: &reloadStats{}}
+
+	st, err := s.updateLeap(leap2017.Add(-time.Hour), false)
+	require.NoError(t, err)
+	require.Equal(t, leap2017, st.next)
+	require.Equal(t, 36*time.Second, c.UTCOffset)
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid|ptp.FlagLeap61, c.leapFlags())
+
+	// reload doesn't bring hand-set offset back
+	require.NoError(t, os.WriteFile(cfg, []byte("utcoffset: 40s\n"), 0644))
+	require.NoError(t, s.reloadConfig())
+	require.Equal(t, 36*time.Second, c.UTCOffset)
+
+	_, err = s.updateLeap(leap2017, false)
+	require.NoError(t, err)
+	require.Equal(t, 37*time.Second, c.UTCOffset)
+	require.Equal(t, ptp.FlagCurrentUtcOffsetValid, c.leapFlags())
+
+	c.LeapSecondFile = filepath.Join(t.TempDir(), "missing")
+	_, err = s.updateLeap(leap2017, false)
+	require.Error(t, err)
+	require.Equal(t, 37*time.Second, c.UTCOffset)
+}
+
+// TestLeapTransitions walks through the day before and the day of leap seconds
+// following system clock in UTC and PTP time in TAI
+func TestLeapTransitions(t *testing.T) {
+	leaps := append(testLeaps(), leapAt(leap2027, 26))
+	c := &Config{StaticConfig: StaticConfig{LeapSecondFile: writeLeapFile(t, leaps)}}
+	s := &Server{Config: c, Stats: &reloadStats{}}
+
+	valid := ptp.FlagCurrentUtcOffsetValid
+	leap61 := ptp.FlagCurrentUtcOffsetValid | ptp.FlagLeap61
+	leap59 := ptp.FlagCurrentUtcOffsetValid | ptp.FlagLeap59
+	day := 24 * time.Hour
+	// after the leap second of 2017 the next change is announcement of the deleted one
+	untilDeleted := leap2027.Add(-day).Sub(leap2017)
+	tests := []struct {
+		name   string
+		now    time.Time
+		tai    bool
+		window time.Duration
+		flags  uint16
+		offset time.Duration
+		until  time.Duration
+	}{
+		// inserted leap second, UTC
+		{"UTC day before", leap2017.Add(-day - time.Second), false, 0, valid, 36 * time.Second, time.Second},
+		{"UTC day of", leap2017.Add(-day), false, 0, leap61, 36 * time.Second, day},
+		{"UTC last second", leap2017.Add(-time.Second), false, 0, leap61, 36 * time.Second, time.Second},
+		{"UTC after", leap2017, false, 0, valid, 37 * time.Second, untilDeleted},
+		{"UTC window not open", leap2017.Add(-time.Hour - time.Second), false, time.Hour, valid, 36 * time.Second, time.Second},
+		{"UTC window open", leap2017.Add(-time.Hour), false, time.Hour, leap61, 36 * time.Second, time.Hour},
+		// inserted leap second, TAI
+		{"TAI day before", leap2017.Add(-day + 35*time.Second), true, 0, valid, 36 * time.Second, time.Second},
+		{"TAI day of", leap2017.Add(-day + 36*time.Second), true, 0, leap61, 36 * time.Second, day + time.Second},
+		{"TAI 23:59:59", leap2017.Add(35 * time.Second), true, 0, leap61, 36 * time.Second, 2 * time.Second},
+		{"TAI 23:59:60", leap2017.Add(36500 * time.Millisecond), true, 0, leap61, 36 * time.Second, 500 * time.Millisecond},
+		{"TAI after", leap2017.Add(37 * time.Second), true, 0, valid, 37 * time.Second, untilDeleted},
+		{"TAI window open", leap2017.Add(-time.Hour + 36*time.Second), true, time.Hour, leap61, 36 * time.Second, time.Hour + time.Second},
+		// deleted leap second, UTC
+		{"UTC deleted day before", leap2027.Add(-day - time.Second), false, 0, valid, 37 * time.Second, time.Second},
+		{"UTC deleted day of", leap2027.Add(-day), false, 0, leap59, 37 * time.Second, day},
+		{"UTC deleted 23:59:58", leap2027.Add(-2 * time.Second), false, 0, leap59, 37 * time.Second, 2 * time.Second},
+		{"UTC deleted after", leap2027, false, 0, valid, 36 * time.Second, 0},
+		// deleted leap second, TAI
+		{"TAI deleted day before", leap2027.Add(-day + 36*time.Second), true, 0, valid, 37 * time.Second, time.Second},
+		{"TAI deleted day of", leap2027.Add(-day + 37*time.Second), true, 0, leap59, 37 * time.Second, day - time.Second},
+		{"TAI deleted 23:59:58", leap2027.Add(35 * time.Second), true, 0, leap59, 37 * time.Second, time.Second},
+		{"TAI deleted after", leap2027.Add(36 * time.Second), true, 0, valid, 36 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.LeapAnnounceWindow = tt.window
+			st, err := s.updateLeap(tt.now, tt.tai)
+			require.NoError(t, err)
+			require.Equal(t, tt.flags, c.leapFlags())
+			require.Equal(t, tt.offset, c.UTCOffset)
+			require.Equal(t, tt.until, st.untilChange(tt.now, tt.tai, c.leapAnnounceWindow()))
+		})
+	}
+}
+
+func TestAnnounceLeapFlags(t *testing.T) {
+	c := &Config{DynamicConfig: DynamicConfig{UTCOffset: 36 * time.Second}}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Now().Add(time.Minute))
+
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.FlagUnicast|ptp.FlagPTPTimescale, sc.Announce().FlagField)
+
+	c.setLeapFlags(ptp.FlagCurrentUtcOffsetValid | ptp.FlagLeap61)
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.FlagUnicast|ptp.FlagPTPTimescale|ptp.FlagCurrentUtcOffsetValid|ptp.FlagLeap61, sc.Announce().FlagField)
+	require.Equal(t, int16(36), sc.Announce().CurrentUTCOffset)
+
+	// leap second is over
+	c.setLeapFlags(ptp.FlagCurrentUtcOffsetValid)
+	sc.UpdateAnnounceDelayReq(0, 1)
+	require.Equal(t, ptp.FlagUnicast|ptp.FlagPTPTimescale|ptp.FlagCurrentUtcOffsetValid, sc.Announce().FlagField)
+}
+
+func TestManagementLeapFlags(t *testing.T) {
+	s := mgmtTestServer()
+	s.Config.setLeapFlags(ptp.FlagCurrentUtcOffsetValid | ptp.FlagLeap59)
+	reply, err := s.managementReply(mgmtGet(t, ptp.IDTimePropertiesDataSet))
+	require.NoError(t, err)
+	resp := &ptp.Management{}
+	require.NoError(t, resp.UnmarshalBinary(reply))
+	tp := resp.TLV.(*ptp.TimePropertiesDataSetTLV)
+	require.Equal(t, ptp.TimeFlagCurrentUTCOffsetValid|ptp.TimeFlagPTPTimescale|ptp.TimeFlagLeap59, tp.Flags)
+}
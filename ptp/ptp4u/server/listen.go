@@ -0,0 +1,83 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// ListenIPs returns all addresses server serves unicast on, primary IP first
+func (c *StaticConfig) ListenIPs() []net.IP {
+	return append([]net.IP{c.IP}, c.ExtraIPs...)
+}
+
+// ListenSanity checks server listens on valid addresses, at most one of each IP family.
+// Senders send to subscribers of each family from sockets bound to its address, so there can't be more of them
+func (c *StaticConfig) ListenSanity() error {
+	var v4, v6 int
+	for _, ip := range c.ListenIPs() {
+		if ip == nil {
+			return fmt.Errorf("invalid listen IP")
+		}
+		if ip.To4() != nil {
+			v4++
+		} else {
+			v6++
+		}
+	}
+	if v4 > 1 || v6 > 1 {
+		return errListenFamily
+	}
+	return nil
+}
+
+// listensIPv4 returns true if server listens on IPv4 address
+func (c *StaticConfig) listensIPv4() bool {
+	for _, ip := range c.ListenIPs() {
+		if ip.To4() != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// listenNetwork returns network to listen on ip with. IPv6 listener is dual-stack unless IPv4 address is listened on separately
+func (c *StaticConfig) listenNetwork(ip net.IP) string {
+	if ip.To4() != nil {
+		return "udp4"
+	}
+	if c.listensIPv4() {
+		return "udp6"
+	}
+	return "udp"
+}
+
+// clientSockaddr returns address of the subscriber in the family of sockets it's served from.
+// IPv4 subscribers are served over IPv4 if server listens on IPv4 address, and as IPv4-mapped IPv6 ones by dual-stack sockets otherwise
+func (c *StaticConfig) clientSockaddr(ip net.IP, port int) unix.Sockaddr {
+	if ip4 := ip.To4(); ip4 != nil && c.listensIPv4() {
+		sa := &unix.SockaddrInet4{Port: port}
+		copy(sa.Addr[:], ip4)
+		return sa
+	}
+	sa := &unix.SockaddrInet6{Port: port}
+	copy(sa.Addr[:], ip.To16())
+	return sa
+}
@@ -0,0 +1,125 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestListenIPs(t *testing.T) {
+	c := &StaticConfig{IP: net.ParseIP("::")}
+	require.Equal(t, []net.IP{net.ParseIP("::")}, c.ListenIPs())
+	require.False(t, c.listensIPv4())
+
+	c.ExtraIPs = []net.IP{net.ParseIP("192.168.0.1")}
+	require.Equal(t, []net.IP{net.ParseIP("::"), net.ParseIP("192.168.0.1")}, c.ListenIPs())
+	require.True(t, c.listensIPv4())
+}
+
+func TestListenSanity(t *testing.T) {
+	c := &StaticConfig{IP: net.ParseIP("::")}
+	require.NoError(t, c.ListenSanity())
+	c.ExtraIPs = []net.IP{net.ParseIP("0.0.0.0")}
+	require.NoError(t, c.ListenSanity())
+
+	c.ExtraIPs = []net.IP{net.ParseIP("0.0.0.0"), net.ParseIP("192.168.0.1")}
+	require.ErrorIs(t, c.ListenSanity(), errListenFamily)
+	c.ExtraIPs = []net.IP{net.ParseIP("2001:db8::1")}
+	require.ErrorIs(t, c.ListenSanity(), errListenFamily)
+
+	c.ExtraIPs = []net.IP{nil}
+	require.EqualError(t, c.ListenSanity(), "invalid listen IP")
+}
+
+func TestListenNetwork(t *testing.T) {
+	c := &StaticConfig{IP: net.ParseIP("::")}
+	require.Equal(t, "udp", c.listenNetwork(c.IP), "IPv6 only listener is dual-stack")
+
+	c.ExtraIPs = []net.IP{net.ParseIP("0.0.0.0")}
+	require.Equal(t, "udp6", c.listenNetwork(c.IP))
+	require.Equal(t, "udp4", c.listenNetwork(c.ExtraIPs[0]))
+}
+
+func TestClientSockaddr(t *testing.T) {
+	c := &StaticConfig{IP: net.ParseIP("::")}
+	// dual-stack sockets serve IPv4 subscribers at IPv4-mapped addresses
+	sa := c.clientSockaddr(net.ParseIP("192.168.0.2"), ptp.PortGeneral)
+	require.IsType(t, &unix.SockaddrInet6{}, sa)
+	require.Equal(t, net.ParseIP("192.168.0.2").To16(), timestamp.SockaddrToIP(sa))
+	require.Equal(t, ptp.PortGeneral, sa.(*unix.SockaddrInet6).Port)
+
+	c.ExtraIPs = []net.IP{net.ParseIP("0.0.0.0")}
+	sa = c.clientSockaddr(net.ParseIP("192.168.0.2"), ptp.PortGeneral)
+	require.Equal(t, &unix.SockaddrInet4{Port: ptp.PortGeneral, Addr: [4]byte{192, 168, 0, 2}}, sa)
+	sa = c.clientSockaddr(net.ParseIP("2001:db8::2"), ptp.PortEvent)
+	require.IsType(t, &unix.SockaddrInet6{}, sa)
+}
+
+func TestSocketsFor(t *testing.T) {
+	v4 := &senderSockets{eFd: 4}
+	v6 := &senderSockets{eFd: 6}
+	sa4 := timestamp.IPToSockaddr(net.ParseIP("192.168.0.2"), 319)
+	sa6 := timestamp.IPToSockaddr(net.ParseIP("2001:db8::2"), 319)
+
+	require.Same(t, v4, socketsFor(sa4, v4, v6))
+	require.Same(t, v6, socketsFor(sa6, v4, v6))
+	require.Same(t, v6, socketsFor(sa4, nil, v6))
+	require.Same(t, v4, socketsFor(sa6, v4, nil))
+}
+
+func TestWorkerServesBothFamilies(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			IP:            net.ParseIP("::1"),
+			ExtraIPs:      []net.IP{net.ParseIP("127.0.0.1")},
+			TimestampType: timestamp.SWTIMESTAMP,
+			QueueSize:     10,
+		},
+		DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	stop := make(chan struct{})
+	defer close(stop)
+	go w.run(stop)
+
+	for _, ip := range []string{"127.0.0.1", "::1"} {
+		subscriber, err := net.ListenUDP(c.listenNetwork(net.ParseIP(ip)), &net.UDPAddr{IP: net.ParseIP(ip)})
+		require.NoError(t, err)
+		defer subscriber.Close()
+		sa := c.clientSockaddr(net.ParseIP(ip), subscriber.LocalAddr().(*net.UDPAddr).Port)
+		sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Now().Add(time.Minute))
+		w.queue <- sc
+
+		require.NoError(t, subscriber.SetReadDeadline(time.Now().Add(time.Second)))
+		buf := make([]byte, timestamp.PayloadSizeBytes)
+		n, from, err := subscriber.ReadFromUDP(buf)
+		require.NoError(t, err, ip)
+		require.True(t, from.IP.Equal(net.ParseIP(ip)), "announce to %s is sent from %s", ip, from.IP)
+		p, err := ptp.DecodePacket(buf[:n])
+		require.NoError(t, err)
+		require.IsType(t, &ptp.Announce{}, p)
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// management control field, Table 42
+const mgmtControlField = 4
+
+// two-step flag of DEFAULT_DATA_SET SoTSC field
+const defaultDataSetTwoStep = 0x01
+
+// default delay request-response profile identity, Annex I.3
+var defaultProfileIdentity = [6]byte{0x00, 0x1B, 0x19, 0x00, 0x01, 0x00}
+
+// portIdentity is identity of the only port server has
+func (s *Server) portIdentity() ptp.PortIdentity {
+	return ptp.PortIdentity{PortNumber: 1, ClockIdentity: s.Config.clockIdentity}
+}
+
+// mgmtForUs checks if management message targets all clocks or this one
+func (s *Server) mgmtForUs(target ptp.PortIdentity) bool {
+	all := ptp.DefaultTargetPortIdentity
+	own := s.portIdentity()
+	return (target.ClockIdentity == all.ClockIdentity || target.ClockIdentity == own.ClockIdentity) &&
+		(target.PortNumber == all.PortNumber || target.PortNumber == own.PortNumber)
+}
+
+// mgmtTLV returns data of management TLV with id, false if server doesn't have it
+func (s *Server) mgmtTLV(id ptp.ManagementID) (ptp.ManagementTLV, bool) {
+	dcMux.Lock()
+	// management is answered in DomainNumber only
+	d, _ := s.Config.Domain(uint8(s.Config.DomainNumber))
+	quality := ptp.ClockQuality{
+		ClockClass:              d.ClockClass,
+		ClockAccuracy:           d.ClockAccuracy,
+		OffsetScaledLogVariance: 23008,
+	}
+	utcOffset := int16(s.Config.UTCOffset.Seconds())
+	timeFlags := ptp.TimeFlagCurrentUTCOffsetValid | ptp.TimeFlagPTPTimescale
+	switch leap := s.Config.leapFlags(); {
+	case leap&ptp.FlagLeap61 != 0:
+		timeFlags |= ptp.TimeFlagLeap61
+	case leap&ptp.FlagLeap59 != 0:
+		timeFlags |= ptp.TimeFlagLeap59
+	}
+	dcMux.Unlock()
+
+	switch id {
+	case ptp.IDDefaultDataSet:
+		return &ptp.DefaultDataSetTLV{
+			SoTSC:         defaultDataSetTwoStep,
+			NumberPorts:   1,
+			Priority1:     d.Priority1,
+			ClockQuality:  quality,
+			Priority2:     d.Priority2,
+			ClockIdentity: s.Config.clockIdentity,
+			DomainNumber:  uint8(s.Config.DomainNumber),
+		}, true
+	case ptp.IDCurrentDataSet:
+		// we are the GM
+		return &ptp.CurrentDataSetTLV{}, true
+	case ptp.IDParentDataSet:
+		return &ptp.ParentDataSetTLV{
+			ParentPortIdentity:                    ptp.PortIdentity{ClockIdentity: s.Config.clockIdentity},
+			ObservedParentOffsetScaledLogVariance: 0xffff,
+			ObservedParentClockPhaseChangeRate:    0x7fffffff,
+			GrandmasterPriority1:                  d.Priority1,
+			GrandmasterClockQuality:               quality,
+			GrandmasterPriority2:                  d.Priority2,
+			GrandmasterIdentity:                   s.Config.clockIdentity,
+		}, true
+	case ptp.IDTimePropertiesDataSet:
+		return &ptp.TimePropertiesDataSetTLV{
+			CurrentUTCOffset: utcOffset,
+			Flags:            timeFlags,
+			TimeSource:       ptp.TimeSourceGNSS,
+		}, true
+	case ptp.IDClockDescription:
+		return s.clockDescription(), true
+	}
+	return nil, false
+}
+
+// clockDescription describes server the way ptp4l does
+func (s *Server) clockDescription() *ptp.ClockDescriptionTLV {
+	cd := &ptp.ClockDescriptionTLV{
+		ClockType:             ptp.ClockTypeOrdinary,
+		PhysicalLayerProtocol: "IEEE 802.3",
+		PhysicalAddress:       s.Config.clockIdentity.MAC(),
+		ProductDescription:    ";ptp4u;",
+		RevisionData:          ";;",
+		ProfileIdentity:       defaultProfileIdentity,
+	}
+	cd.ProtocolAddress.NetworkProtocol = ptp.TransportTypeUDPIPV6
+	ip := []byte(s.Config.IP.To16())
+	if ip4 := s.Config.IP.To4(); ip4 != nil {
+		cd.ProtocolAddress.NetworkProtocol = ptp.TransportTypeUDPIPV4
+		ip = ip4
+	}
+	cd.ProtocolAddress.AddressField = ip
+	cd.ProtocolAddress.AddressLength = uint16(len(ip))
+	return cd
+}
+
+// mgmtResponseHead returns head of the response to the management request
+func (s *Server) mgmtResponseHead(req *ptp.ManagementMsgHead, action ptp.Action) ptp.ManagementMsgHead {
+	return ptp.ManagementMsgHead{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageManagement, 0),
+			Version:            ptp.Version,
+			DomainNumber:       uint8(s.Config.DomainNumber),
+			SequenceID:         req.SequenceID,
+			SourcePortIdentity: s.portIdentity(),
+			ControlField:       mgmtControlField,
+			LogMessageInterval: ptp.MgmtLogMessageInterval,
+		},
+		TargetPortIdentity:   req.SourcePortIdentity,
+		StartingBoundaryHops: req.StartingBoundaryHops - req.BoundaryHops,
+		BoundaryHops:         req.StartingBoundaryHops - req.BoundaryHops,
+		ActionField:          action,
+	}
+}
+
+// mgmtError returns MANAGEMENT_ERROR_STATUS response to the management request
+func (s *Server) mgmtError(req *ptp.ManagementMsgHead, id ptp.ManagementID, errID ptp.ManagementErrorID) ([]byte, error) {
+	p := &ptp.ManagementMsgErrorStatus{
+		ManagementMsgHead: s.mgmtResponseHead(req, ptp.RESPONSE),
+		ManagementErrorStatusTLV: ptp.ManagementErrorStatusTLV{
+			TLVHead: ptp.TLVHead{
+				TLVType: ptp.TLVManagementErrorStatus,
+				// managementErrorId, managementId and reserved
+				LengthField: 8,
+			},
+			ManagementErrorID: errID,
+			ManagementID:      id,
+		},
+	}
+	p.MessageLength = uint16(binary.Size(ptp.ManagementMsgHead{}) + binary.Size(ptp.TLVHead{}) + 8)
+	return p.MarshalBinary()
+}
+
+// managementReply answers management request. Reply is nil if the message is not a request to this server
+func (s *Server) managementReply(b []byte) ([]byte, error) {
+	// GET carries no data, so only heads can be read
+	var head ptp.ManagementMsgHead
+	var tlvHead ptp.ManagementTLVHead
+	r := bytes.NewReader(b)
+	if err := binary.Read(r, binary.BigEndian, &head); err != nil {
+		return nil, fmt.Errorf("reading management message head: %w", err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &tlvHead); err != nil {
+		return nil, fmt.Errorf("reading management TLV head: %w", err)
+	}
+	if !s.mgmtForUs(head.TargetPortIdentity) {
+		return nil, nil
+	}
+	switch head.Action() {
+	case ptp.GET:
+	case ptp.SET, ptp.COMMAND:
+		log.Debugf("Refusing management %d of %s", head.Action(), tlvHead.MgmtID())
+		return s.mgmtError(&head, tlvHead.MgmtID(), ptp.ErrorNotSupported)
+	default:
+		// responses and acknowledgements of someone else
+		return nil, nil
+	}
+	if tlvHead.TLVType != ptp.TLVManagement {
+		return nil, fmt.Errorf("got TLV %s in management request", tlvHead.TLVType)
+	}
+	log.Debugf("Got management GET of %s", tlvHead.MgmtID())
+	tlv, ok := s.mgmtTLV(tlvHead.MgmtID())
+	if !ok {
+		return s.mgmtError(&head, tlvHead.MgmtID(), ptp.ErrorNoSuchID)
+	}
+	p, err := ptp.NewManagementRequest(ptp.RESPONSE, tlvHead.MgmtID(), tlv)
+	if err != nil {
+		return nil, err
+	}
+	resp := s.mgmtResponseHead(&head, ptp.RESPONSE)
+	resp.MessageLength = p.MessageLength
+	p.ManagementMsgHead = resp
+	return p.MarshalBinary()
+}
+
+// listenManagement listens for management requests on the unix socket, replacing socket left by previous run
+func (s *Server) listenManagement() (*net.UnixConn, error) {
+	addr := s.Config.MgmtSocket
+	if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("removing stale management socket: %w", err)
+	}
+	return net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+}
+
+// serveManagement answers management requests coming over the unix socket, just like ptp4l answers pmc
+func (s *Server) serveManagement(conn *net.UnixConn) error {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFromUnix(buf)
+		if err != nil {
+			return err
+		}
+		reply, err := s.managementReply(buf[:n])
+		if err != nil {
+			log.Errorf("Failed to handle management message: %v", err)
+			continue
+		}
+		// unbound client can't get a reply
+		if reply == nil || addr == nil {
+			continue
+		}
+		if _, err := conn.WriteToUnix(reply, addr); err != nil {
+			log.Errorf("Failed to reply to management message: %v", err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func mgmtTestServer() *Server {
+	c := &Config{
+		StaticConfig: StaticConfig{
+			DomainNumber: 7,
+			IP:           net.ParseIP("192.168.0.1"),
+		},
+		DynamicConfig: DynamicConfig{
+			ClockAccuracy: 0x21,
+			ClockClass:    ptp.ClockClass6,
+			UTCOffset:     37 * time.Second,
+		},
+		clockIdentity: ptp.ClockIdentity(0xc42a1fffe6d7ca6),
+	}
+	return &Server{Config: c}
+}
+
+func mgmtGet(t *testing.T, id ptp.ManagementID) []byte {
+	req, err := ptp.NewManagementRequest(ptp.GET, id, nil)
+	require.NoError(t, err)
+	req.SetSequence(42)
+	b, err := req.MarshalBinary()
+	require.NoError(t, err)
+	return b
+}
+
+func TestManagementReply(t *testing.T) {
+	s := mgmtTestServer()
+	reply, err := s.managementReply(mgmtGet(t, ptp.IDDefaultDataSet))
+	require.NoError(t, err)
+	resp := &ptp.Management{}
+	require.NoError(t, resp.UnmarshalBinary(reply))
+	require.Equal(t, ptp.RESPONSE, resp.Action())
+	require.Equal(t, uint16(42), resp.SequenceID)
+	require.Equal(t, uint8(7), resp.DomainNumber)
+	require.Equal(t, s.portIdentity(), resp.SourcePortIdentity)
+	require.Equal(t, uint16(len(reply)), resp.MessageLength)
+	dds := resp.TLV.(*ptp.DefaultDataSetTLV)
+	require.Equal(t, s.Config.clockIdentity, dds.ClockIdentity)
+	require.Equal(t, ptp.ClockClass6, dds.ClockQuality.ClockClass)
+	require.Equal(t, uint8(7), dds.DomainNumber)
+
+	reply, err = s.managementReply(mgmtGet(t, ptp.IDTimePropertiesDataSet))
+	require.NoError(t, err)
+	require.NoError(t, resp.UnmarshalBinary(reply))
+	require.Equal(t, int16(37), resp.TLV.(*ptp.TimePropertiesDataSetTLV).CurrentUTCOffset)
+
+	reply, err = s.managementReply(mgmtGet(t, ptp.IDClockDescription))
+	require.NoError(t, err)
+	require.NoError(t, resp.UnmarshalBinary(reply))
+	cd := resp.TLV.(*ptp.ClockDescriptionTLV)
+	require.Equal(t, ptp.TransportTypeUDPIPV4, cd.ProtocolAddress.NetworkProtocol)
+	require.Equal(t, []byte{192, 168, 0, 1}, cd.ProtocolAddress.AddressField)
+	require.Equal(t, []byte(s.Config.clockIdentity.MAC()), cd.PhysicalAddress)
+
+	// someone else's response
+	p, err := ptp.NewManagementRequest(ptp.RESPONSE, ptp.IDCurrentDataSet, &ptp.CurrentDataSetTLV{})
+	require.NoError(t, err)
+	b, err := p.MarshalBinary()
+	require.NoError(t, err)
+	reply, err = s.managementReply(b)
+	require.NoError(t, err)
+	require.Nil(t, reply)
+
+	// request to another clock
+	p, err = ptp.NewManagementRequest(ptp.GET, ptp.IDCurrentDataSet, nil)
+	require.NoError(t, err)
+	p.TargetPortIdentity = ptp.PortIdentity{ClockIdentity: 0x42, PortNumber: 1}
+	b, err = p.MarshalBinary()
+	require.NoError(t, err)
+	reply, err = s.managementReply(b)
+	require.NoError(t, err)
+	require.Nil(t, reply)
+
+	_, err = s.managementReply([]byte{1, 2, 3})
+	require.Error(t, err)
+}
+
+func TestServeManagement(t *testing.T) {
+	s := mgmtTestServer()
+	s.Config.MgmtSocket = filepath.Join(t.TempDir(), "ptp4u")
+	conn, err := s.listenManagement()
+	require.NoError(t, err)
+	defer conn.Close()
+	go func() {
+		_ = s.serveManagement(conn)
+	}()
+
+	c, err := ptp.DialMgmtUDS(s.Config.MgmtSocket, time.Second)
+	require.NoError(t, err)
+	defer c.Close()
+
+	dds, err := c.DefaultDataSet()
+	require.NoError(t, err)
+	require.Equal(t, s.Config.clockIdentity, dds.ClockIdentity)
+
+	cds, err := c.CurrentDataSet()
+	require.NoError(t, err)
+	require.Equal(t, uint16(0), cds.StepsRemoved)
+
+	pds, err := c.ParentDataSet()
+	require.NoError(t, err)
+	require.Equal(t, s.Config.clockIdentity, pds.GrandmasterIdentity)
+	require.Equal(t, s.Config.clockIdentity, pds.ParentPortIdentity.ClockIdentity)
+	require.Equal(t, ptp.ClockClass6, pds.GrandmasterClockQuality.ClockClass)
+
+	tp, err := c.TimePropertiesDataSet()
+	require.NoError(t, err)
+	require.Equal(t, ptp.TimeSourceGNSS, tp.TimeSource)
+
+	cd, err := c.ClockDescription()
+	require.NoError(t, err)
+	require.Equal(t, ptp.ClockTypeOrdinary, cd.ClockType)
+	require.Equal(t, ptp.PTPText(";ptp4u;"), cd.ProductDescription)
+
+	_, err = c.Get(ptp.IDPriority1)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "NO_SUCH_ID")
+
+	_, err = c.Set(ptp.IDPriority1, &ptp.Priority1TLV{Priority1: 1})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "NOT_SUPPORTED")
+}
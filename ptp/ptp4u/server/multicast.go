@@ -0,0 +1,370 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package server implements simple Unicast PTP UDP server.
+*/
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// multicastSender periodically multicasts Sync and Announce on a single interface,
+// serving enterprise-profile LAN clients alongside unicast subscriptions
+type multicastSender struct {
+	iface  *net.Interface
+	group  net.IP
+	config *Config
+	stats  stats.Stats
+
+	// packets are built by subscriptions which are never started
+	sync      *SubscriptionClient
+	announce  *SubscriptionClient
+	delayResp *SubscriptionClient
+}
+
+func newMulticastSender(iface *net.Interface, group net.IP, c *Config, st stats.Stats) *multicastSender {
+	eclisa := timestamp.IPToSockaddr(group, ptp.PortEvent)
+	gclisa := timestamp.IPToSockaddr(group, ptp.PortGeneral)
+	// link-local and interface-local groups need the scope
+	if sa, ok := eclisa.(*unix.SockaddrInet6); ok {
+		sa.ZoneId = uint32(iface.Index)
+		gclisa.(*unix.SockaddrInet6).ZoneId = uint32(iface.Index)
+	}
+
+	m := &multicastSender{
+		iface:     iface,
+		group:     group,
+		config:    c,
+		stats:     st,
+		sync:      NewSubscriptionClient(nil, nil, eclisa, gclisa, ptp.MessageSync, c, c.MulticastSyncInterval, time.Time{}),
+		announce:  NewSubscriptionClient(nil, nil, eclisa, gclisa, ptp.MessageAnnounce, c, c.MulticastAnnounceInterval, time.Time{}),
+		delayResp: NewSubscriptionClient(nil, nil, eclisa, gclisa, ptp.MessageDelayResp, c, 0, time.Time{}),
+	}
+	m.sync.SetMulticast()
+	m.announce.SetMulticast()
+	m.delayResp.SetMulticast()
+	// all sockets on the interface share the NIC timestamping mode
+	m.sync.SetOneStep(c.OneStep && iface.Name == c.Interface)
+	return m
+}
+
+// multicastSenders creates senders for all configured multicast interfaces
+func (s *Server) multicastSenders() ([]*multicastSender, error) {
+	senders := []*multicastSender{}
+	for _, e := range s.Config.Multicast {
+		name, group, err := parseMulticast(e, s.Config.IP)
+		if err != nil {
+			return nil, err
+		}
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find multicast interface: %w", err)
+		}
+		senders = append(senders, newMulticastSender(iface, group, s.Config, s.Stats))
+	}
+	return senders, nil
+}
+
+// socket creates a socket sending to the multicast group via the interface
+func (m *multicastSender) socket() (int, error) {
+	domain := unix.AF_INET6
+	if m.group.To4() != nil {
+		domain = unix.AF_INET
+	}
+	fd, err := unix.Socket(domain, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	if err != nil {
+		return -1, fmt.Errorf("creating multicast socket error: %w", err)
+	}
+	if domain == unix.AF_INET {
+		err = unix.SetsockoptIPMreqn(fd, unix.IPPROTO_IP, unix.IP_MULTICAST_IF, &unix.IPMreqn{Ifindex: int32(m.iface.Index)})
+	} else {
+		err = unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_IF, m.iface.Index)
+	}
+	if err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("setting multicast interface %s: %w", m.iface.Name, err)
+	}
+	if err = enableDSCP(fd, m.group, m.config.DSCP); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("setting DSCP on multicast socket: %w", err)
+	}
+	return fd, nil
+}
+
+// enableTimestamps enables timestamps of the configured type on the socket
+func (m *multicastSender) enableTimestamps(fd int) error {
+	switch m.config.TimestampType {
+	case timestamp.HWTIMESTAMP:
+		if err := enableIfaceHWTimestamps(fd, m.iface.Name, m.sync.OneStep(), m.config.OneStepP2P); err != nil {
+			return fmt.Errorf("failed to enable hardware timestamps on %s: %w", m.iface.Name, err)
+		}
+	case timestamp.SWTIMESTAMP:
+		if err := timestamp.EnableSWTimestamps(fd); err != nil {
+			return fmt.Errorf("unable to enable software timestamps: %w", err)
+		}
+	default:
+		return fmt.Errorf("unrecognized timestamp type: %s", m.config.TimestampType)
+	}
+	return nil
+}
+
+// listen sets up event and general sockets, with TX timestamps enabled on the event one
+func (m *multicastSender) listen() (eventFD, generalFD int, err error) {
+	eventFD, err = m.socket()
+	if err != nil {
+		return -1, -1, err
+	}
+	if err = m.enableTimestamps(eventFD); err != nil {
+		unix.Close(eventFD)
+		return -1, -1, err
+	}
+
+	generalFD, err = m.socket()
+	if err != nil {
+		unix.Close(eventFD)
+		return -1, -1, err
+	}
+	log.Infof("Started multicasting to %s on %s", m.group, m.iface.Name)
+	return eventFD, generalFD, nil
+}
+
+// listenDelayReq sets up a socket receiving Delay_Req sent to the group via the interface, with RX timestamps enabled
+func (m *multicastSender) listenDelayReq() (int, error) {
+	domain := unix.AF_INET6
+	if m.group.To4() != nil {
+		domain = unix.AF_INET
+	}
+	fd, err := unix.Socket(domain, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	if err != nil {
+		return -1, fmt.Errorf("creating multicast delay request socket error: %w", err)
+	}
+	// every interface multicasting to the same group binds to it
+	if err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("setting SO_REUSEADDR on multicast delay request socket: %w", err)
+	}
+	// so only Delay_Req arriving via this interface is answered on it
+	if err = unix.BindToDevice(fd, m.iface.Name); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("binding multicast delay request socket to %s: %w", m.iface.Name, err)
+	}
+	if err = unix.Bind(fd, m.delayResp.eclisa); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("binding multicast delay request socket to %s: %w", m.group, err)
+	}
+	if domain == unix.AF_INET {
+		mreq := &unix.IPMreqn{Ifindex: int32(m.iface.Index)}
+		copy(mreq.Multiaddr[:], m.group.To4())
+		err = unix.SetsockoptIPMreqn(fd, unix.IPPROTO_IP, unix.IP_ADD_MEMBERSHIP, mreq)
+	} else {
+		mreq := &unix.IPv6Mreq{Interface: uint32(m.iface.Index)}
+		copy(mreq.Multiaddr[:], m.group.To16())
+		err = unix.SetsockoptIPv6Mreq(fd, unix.IPPROTO_IPV6, unix.IPV6_JOIN_GROUP, mreq)
+	}
+	if err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("joining %s on %s: %w", m.group, m.iface.Name, err)
+	}
+	if err = m.enableTimestamps(fd); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	if err = unix.SetNonblock(fd, false); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("failed to set multicast delay request socket to blocking: %w", err)
+	}
+	return fd, nil
+}
+
+// serveDelayReq answers Delay_Req sent to the group with Delay_Resp sent to the group. Nothing is answered while server is drained
+func (m *multicastSender) serveDelayReq(ctx func() context.Context, fd, gFd int) {
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	out := make([]byte, timestamp.PayloadSizeBytes)
+	dReq := &ptp.SyncDelayReq{}
+
+	for {
+		n, sa, rxTS, err := timestamp.ReadPacketWithRXTimestampBuf(fd, buf, oob)
+		if err != nil {
+			log.Errorf("Failed to read multicast packet on %s: %v", m.iface.Name, err)
+			continue
+		}
+		if ctx().Err() != nil {
+			continue
+		}
+		if m.config.TimestampType != timestamp.HWTIMESTAMP {
+			rxTS = rxTS.Add(m.config.UTCOffset)
+		}
+		if err := m.respondDelayReq(gFd, buf[:n], timestamp.SockaddrToIP(sa), rxTS, dReq, out); err != nil {
+			log.Errorf("Failed to answer multicast delay request on %s: %v", m.iface.Name, err)
+		}
+	}
+}
+
+// respondDelayReq sends Delay_Resp to the Delay_Req received from src at rxTS, unless ACL denies src.
+// Other messages sent to the group are ignored
+func (m *multicastSender) respondDelayReq(gFd int, b []byte, src net.IP, rxTS time.Time, dReq *ptp.SyncDelayReq, buf []byte) error {
+	msgType, err := ptp.ProbeMsgType(b)
+	if err != nil {
+		return fmt.Errorf("probing the ptp message type: %w", err)
+	}
+	if msgType != ptp.MessageDelayReq {
+		return nil
+	}
+	m.stats.IncRX(msgType)
+	if !m.config.Allowed(src) {
+		m.stats.IncACLDenied(msgType)
+		return nil
+	}
+	if err := ptp.FromBytes(b, dReq); err != nil {
+		return fmt.Errorf("reading the delay request: %w", err)
+	}
+
+	c := m.delayResp
+	c.UpdateDelayResp(&dReq.Header, rxTS)
+	n, err := ptp.BytesTo(c.DelayResp(), buf)
+	if err != nil {
+		return fmt.Errorf("generating the delay response packet: %w", err)
+	}
+	if err = unix.Sendto(gFd, buf[:n], 0, c.gclisa); err != nil {
+		return fmt.Errorf("sending the delay response packet: %w", err)
+	}
+	m.stats.IncTX(ptp.MessageDelayResp)
+	return nil
+}
+
+// hybridDelayResp returns a one-off Delay_Resp subscription answering Delay_Req of a hybrid client,
+// which gets Sync and Announce via multicast, but sends Delay_Req unicast without negotiating a grant.
+// Returns nil if server doesn't multicast
+func (s *Server) hybridDelayResp(worker *sendWorker, eclisa unix.Sockaddr) *SubscriptionClient {
+	if len(s.Config.Multicast) == 0 {
+		return nil
+	}
+	gclisa := s.Config.clientSockaddr(timestamp.SockaddrToIP(eclisa), ptp.PortGeneral)
+	return NewSubscriptionClient(worker.queue, worker.signalingQueue, eclisa, gclisa, ptp.MessageDelayResp, s.Config, 0, time.Time{})
+}
+
+// Start multicasting Sync and Announce at configured rates and answering Delay_Req sent to the group.
+// Nothing is sent while server is drained
+func (m *multicastSender) Start(ctx func() context.Context) {
+	eFd, gFd, err := m.listen()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer unix.Close(eFd)
+	defer unix.Close(gFd)
+
+	dFd, err := m.listenDelayReq()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer unix.Close(dFd)
+	go m.serveDelayReq(ctx, dFd, gFd)
+
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+
+	syncTicker := time.NewTicker(m.config.MulticastSyncInterval)
+	defer syncTicker.Stop()
+	announceTicker := time.NewTicker(m.config.MulticastAnnounceInterval)
+	defer announceTicker.Stop()
+
+	for {
+		select {
+		case <-syncTicker.C:
+			if ctx().Err() != nil {
+				continue
+			}
+			if err := m.sendSync(eFd, gFd, buf, oob, toob); err != nil {
+				log.Errorf("Failed to multicast sync on %s: %v", m.iface.Name, err)
+			}
+			m.sync.IncSequenceID()
+		case <-announceTicker.C:
+			if ctx().Err() != nil {
+				continue
+			}
+			if err := m.sendAnnounce(gFd, buf); err != nil {
+				log.Errorf("Failed to multicast announce on %s: %v", m.iface.Name, err)
+			}
+			m.announce.IncSequenceID()
+		}
+	}
+}
+
+// sendSync multicasts Sync followed by Follow Up unless Sync is one-step
+func (m *multicastSender) sendSync(eFd, gFd int, buf, oob, toob []byte) error {
+	c := m.sync
+	c.UpdateSync()
+	n, err := ptp.BytesTo(c.Sync(), buf)
+	if err != nil {
+		return fmt.Errorf("generating the sync packet: %w", err)
+	}
+	if err = unix.Sendto(eFd, buf[:n], 0, c.eclisa); err != nil {
+		return fmt.Errorf("sending the sync packet: %w", err)
+	}
+	m.stats.IncTX(ptp.MessageSync)
+	if c.OneStep() {
+		m.stats.IncTXOneStep(ptp.MessageSync)
+		return nil
+	}
+
+	txTS, _, err := timestamp.ReadTXtimestampBuf(eFd, oob, toob)
+	if err != nil {
+		m.stats.IncTXTSFailure(timestamp.Classify(err))
+		return fmt.Errorf("reading TX timestamp: %w", err)
+	}
+	if m.config.TimestampType != timestamp.HWTIMESTAMP {
+		txTS = txTS.Add(m.config.UTCOffset)
+	}
+
+	c.UpdateFollowup(txTS)
+	n, err = ptp.BytesTo(c.Followup(), buf)
+	if err != nil {
+		return fmt.Errorf("generating the followup packet: %w", err)
+	}
+	if err = unix.Sendto(gFd, buf[:n], 0, c.gclisa); err != nil {
+		return fmt.Errorf("sending the followup packet: %w", err)
+	}
+	m.stats.IncTX(ptp.MessageFollowUp)
+	return nil
+}
+
+// sendAnnounce multicasts Announce
+func (m *multicastSender) sendAnnounce(gFd int, buf []byte) error {
+	c := m.announce
+	c.UpdateAnnounce()
+	n, err := ptp.BytesTo(c.Announce(), buf)
+	if err != nil {
+		return fmt.Errorf("generating the announce packet: %w", err)
+	}
+	if err = unix.Sendto(gFd, buf[:n], 0, c.gclisa); err != nil {
+		return fmt.Errorf("sending the announce packet: %w", err)
+	}
+	m.stats.IncTX(ptp.MessageAnnounce)
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestMulticastRespondDelayReq(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	require.NoError(t, err)
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234), StaticConfig: StaticConfig{DomainNumber: 7}}
+	m := newMulticastSender(lo, multicastGroupIPv4, c, stats.NewJSONStats())
+
+	// receive Delay_Resp locally instead of on the group
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+	m.delayResp.SetGclisa(timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), conn.LocalAddr().(*net.UDPAddr).Port))
+
+	gFd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	require.NoError(t, err)
+	defer unix.Close(gFd)
+
+	clientID := ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(42), PortNumber: 1}
+	req, err := ptp.Bytes(&ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageDelayReq, 0),
+			Version:            ptp.Version,
+			SequenceID:         13,
+			SourcePortIdentity: clientID,
+		},
+	})
+	require.NoError(t, err)
+
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	rxTS := time.Unix(1653574589, 806255169)
+	err = m.respondDelayReq(gFd, req, net.ParseIP("192.168.0.2"), rxTS, &ptp.SyncDelayReq{}, buf)
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	resp := &ptp.DelayResp{}
+	require.NoError(t, ptp.FromBytes(buf[:n], resp))
+	require.Equal(t, ptp.MessageDelayResp, resp.Header.MessageType())
+	require.Equal(t, uint16(0), resp.Header.FlagField)
+	require.Equal(t, uint8(7), resp.Header.DomainNumber)
+	require.Equal(t, uint16(13), resp.Header.SequenceID)
+	require.Equal(t, clientID, resp.DelayRespBody.RequestingPortIdentity)
+	require.Equal(t, rxTS, resp.DelayRespBody.ReceiveTimestamp.Time())
+}
+
+func TestMulticastRespondDelayReqIgnoresOthers(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	require.NoError(t, err)
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	m := newMulticastSender(lo, multicastGroupIPv4, c, stats.NewJSONStats())
+
+	sync, err := ptp.Bytes(&ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSync, 0),
+			Version:         ptp.Version,
+		},
+	})
+	require.NoError(t, err)
+	// nothing is sent, so the socket is never used
+	err = m.respondDelayReq(-1, sync, net.ParseIP("192.168.0.2"), time.Now(), &ptp.SyncDelayReq{}, make([]byte, timestamp.PayloadSizeBytes))
+	require.NoError(t, err)
+
+	err = m.respondDelayReq(-1, []byte{}, net.ParseIP("192.168.0.2"), time.Now(), &ptp.SyncDelayReq{}, make([]byte, timestamp.PayloadSizeBytes))
+	require.Error(t, err)
+}
+
+func TestMulticastRespondDelayReqACL(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	require.NoError(t, err)
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	c.ACL.Deny = []string{"192.168.0.0/24"}
+	st := &aclStats{denied: map[ptp.MessageType]int{}}
+	m := newMulticastSender(lo, multicastGroupIPv4, c, st)
+
+	req, err := ptp.Bytes(&ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageDelayReq, 0),
+			Version:         ptp.Version,
+		},
+	})
+	require.NoError(t, err)
+	// nothing is sent to denied subscriber, so the socket is never used
+	err = m.respondDelayReq(-1, req, net.ParseIP("192.168.0.2"), time.Now(), &ptp.SyncDelayReq{}, make([]byte, timestamp.PayloadSizeBytes))
+	require.NoError(t, err)
+	require.Equal(t, 1, st.denied[ptp.MessageDelayReq])
+}
+
+func TestHybridDelayResp(t *testing.T) {
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	s := &Server{Config: c, Stats: stats.NewJSONStats()}
+	w := newSendWorker(0, c, s.Stats)
+	eclisa := timestamp.IPToSockaddr(net.ParseIP("2401:db00::1"), 12345)
+
+	require.Nil(t, s.hybridDelayResp(w, eclisa))
+
+	c.Multicast = []string{"eth0"}
+	sc := s.hybridDelayResp(w, eclisa)
+	require.NotNil(t, sc)
+	require.Equal(t, ptp.MessageDelayResp, sc.subscriptionType)
+	require.Equal(t, timestamp.IPToSockaddr(net.ParseIP("2401:db00::1"), ptp.PortGeneral), sc.gclisa)
+	require.Equal(t, ptp.FlagUnicast, sc.DelayResp().Header.FlagField)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"github.com/facebook/time/phc"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+// oneStepMode picks one-step timestamping the NIC supports given tx_types it reports, preferring P2P mode if asked to.
+// P2P mode inserts TX timestamps into Sync as well, so it covers for NIC which can only do it alongside Pdelay_Resp
+func oneStepMode(txTypes uint32, p2p bool) (oneStep, useP2P bool) {
+	hasSync := txTypes&timestamp.TXTypeOneStepSync != 0
+	hasP2P := txTypes&timestamp.TXTypeOneStepP2P != 0
+	switch {
+	case p2p && hasP2P:
+		return true, true
+	case hasSync:
+		return true, false
+	case hasP2P:
+		return true, true
+	}
+	return false, false
+}
+
+// detectOneStep checks if NIC supports one-step timestamps and falls back to what it can do, two-step at worst
+func (s *Server) detectOneStep() {
+	if !s.Config.OneStep {
+		return
+	}
+	info, err := phc.IfaceInfo(s.Config.Interface)
+	if err != nil {
+		log.Warningf("Unable to find out if %s supports one-step timestamps, falling back to two-step: %v", s.Config.Interface, err)
+		s.Config.OneStep = false
+		s.Config.OneStepP2P = false
+		return
+	}
+	oneStep, p2p := oneStepMode(info.TXTypes, s.Config.OneStepP2P)
+	switch {
+	case !oneStep:
+		log.Warningf("%s doesn't support one-step timestamps, falling back to two-step", s.Config.Interface)
+	case p2p != s.Config.OneStepP2P:
+		log.Warningf("%s doesn't support requested one-step mode, using P2P mode %v", s.Config.Interface, p2p)
+	default:
+		log.Infof("Using one-step timestamps on %s, P2P mode %v", s.Config.Interface, p2p)
+	}
+	s.Config.OneStep = oneStep
+	s.Config.OneStepP2P = p2p
+}
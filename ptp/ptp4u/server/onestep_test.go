@@ -0,0 +1,62 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOneStepMode(t *testing.T) {
+	testCases := []struct {
+		name    string
+		txTypes uint32
+		p2p     bool
+		wantOne bool
+		wantP2P bool
+	}{
+		{name: "two-step only", txTypes: 0x3},
+		{name: "two-step only p2p", txTypes: 0x3, p2p: true},
+		{name: "sync", txTypes: timestamp.TXTypeOneStepSync, wantOne: true},
+		{name: "sync when p2p requested", txTypes: timestamp.TXTypeOneStepSync, p2p: true, wantOne: true},
+		{name: "p2p covers sync", txTypes: timestamp.TXTypeOneStepP2P, wantOne: true, wantP2P: true},
+		{name: "prefer sync", txTypes: timestamp.TXTypeOneStepSync | timestamp.TXTypeOneStepP2P, wantOne: true},
+		{name: "p2p", txTypes: timestamp.TXTypeOneStepSync | timestamp.TXTypeOneStepP2P, p2p: true, wantOne: true, wantP2P: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oneStep, p2p := oneStepMode(tc.txTypes, tc.p2p)
+			require.Equal(t, tc.wantOne, oneStep)
+			require.Equal(t, tc.wantP2P, p2p)
+		})
+	}
+}
+
+func TestDetectOneStepDisabled(t *testing.T) {
+	s := Server{Config: &Config{StaticConfig: StaticConfig{Interface: "lo"}}}
+	s.detectOneStep()
+	require.False(t, s.Config.OneStep)
+}
+
+func TestDetectOneStepUnknownInterface(t *testing.T) {
+	s := Server{Config: &Config{StaticConfig: StaticConfig{Interface: "nosuchiface0", OneStep: true, OneStepP2P: true}}}
+	s.detectOneStep()
+	require.False(t, s.Config.OneStep)
+	require.False(t, s.Config.OneStepP2P)
+}
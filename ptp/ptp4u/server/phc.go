@@ -0,0 +1,153 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/facebook/time/phc"
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+// phcDegradedClockClass is announced when PHC didn't pass the startup check
+const phcDegradedClockClass ptp.ClockClass = 248
+
+// phcCheckWindow is how long PHC frequency is watched for adjustments
+const phcCheckWindow = 3 * time.Second
+
+// phcClock is a PHC validated at startup
+type phcClock interface {
+	FrequencyPPB() (float64, error)
+	// Offset returns PHC time minus system time
+	Offset() (time.Duration, error)
+}
+
+// phcDevice is a PHC device like /dev/ptp0
+type phcDevice string
+
+// FrequencyPPB returns current frequency adjustment of the PHC
+func (d phcDevice) FrequencyPPB() (float64, error) {
+	return phc.FrequencyPPBFromDevice(string(d))
+}
+
+// Offset returns PHC time minus system time
+func (d phcDevice) Offset() (time.Duration, error) {
+	res, err := phc.TimeAndOffsetFromDevice(string(d), phc.MethodIoctlSysOffsetExtended)
+	if err != nil {
+		return 0, err
+	}
+	return res.PHCTime.Sub(res.SysTime), nil
+}
+
+// Time returns PHC time, which is PTP time running TAI
+func (d phcDevice) Time() (time.Time, error) {
+	res, err := phc.TimeAndOffsetFromDevice(string(d), phc.MethodIoctlSysOffsetExtended)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return res.PHCTime, nil
+}
+
+// checkPHC verifies PHC is disciplined: its frequency gets adjusted within the window
+// and it's within maxOffset from system clock shifted by UTC offset
+func checkPHC(clock phcClock, window, utcOffset, maxOffset time.Duration) error {
+	before, err := clock.FrequencyPPB()
+	if err != nil {
+		return fmt.Errorf("reading PHC frequency: %w", err)
+	}
+	time.Sleep(window)
+	after, err := clock.FrequencyPPB()
+	if err != nil {
+		return fmt.Errorf("reading PHC frequency: %w", err)
+	}
+	if before == after {
+		return fmt.Errorf("PHC frequency stayed at %.3f PPB for %v, nothing disciplines it", after, window)
+	}
+
+	if maxOffset == 0 {
+		return nil
+	}
+	offset, err := clock.Offset()
+	if err != nil {
+		return fmt.Errorf("reading PHC offset: %w", err)
+	}
+	// PHC runs TAI while system clock runs UTC
+	offset -= utcOffset
+	if offset > maxOffset || offset < -maxOffset {
+		return fmt.Errorf("PHC is %v away from system clock, more than %v", offset, maxOffset)
+	}
+	return nil
+}
+
+// validatePHC checks PHC at startup and either refuses to serve or degrades announced clock class if it isn't disciplined
+func (s *Server) validatePHC(clock phcClock, window time.Duration) error {
+	err := checkPHC(clock, window, s.Config.UTCOffset, s.Config.PHCMaxOffset)
+	if err == nil {
+		log.Infof("PHC is disciplined")
+		return nil
+	}
+	if s.Config.PHCCheck == PHCCheckRefuse {
+		return fmt.Errorf("refusing to serve: %w", err)
+	}
+	log.Errorf("PHC check failed, announcing clock class %d: %v", phcDegradedClockClass, err)
+	s.phcDegraded = true
+	s.degradeClockClass()
+	return nil
+}
+
+// checkPHCAtStart runs PHC validation if it's enabled
+func (s *Server) checkPHCAtStart() error {
+	if s.Config.PHCCheck == "" || s.Config.PHCCheck == PHCCheckOff {
+		return nil
+	}
+	if s.Config.TimestampType != timestamp.HWTIMESTAMP {
+		log.Warningf("Skipping PHC check with %s timestamps", s.Config.TimestampType)
+		return nil
+	}
+	device, err := s.phcDevice()
+	if err != nil {
+		return err
+	}
+	log.Infof("Checking PHC %s is disciplined", device)
+	return s.validatePHC(device, phcCheckWindow)
+}
+
+// phcDevice returns PHCDevice, or PHC of the Interface if it's not set
+func (s *Server) phcDevice() (phcDevice, error) {
+	if s.Config.PHCDevice != "" {
+		return phcDevice(s.Config.PHCDevice), nil
+	}
+	device, err := phc.IfaceToPHCDevice(s.Config.Interface)
+	if err != nil {
+		return "", fmt.Errorf("unable to find PHC of the interface: %w", err)
+	}
+	return phcDevice(device), nil
+}
+
+// degradeClockClass overrides announced clock class if PHC didn't pass the startup check.
+// Must be called under dcMux once server is running
+func (s *Server) degradeClockClass() {
+	if s.phcDegraded {
+		s.Config.ClockClass = phcDegradedClockClass
+		for i := range s.Config.Domains {
+			s.Config.Domains[i].ClockClass = phcDegradedClockClass
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePHC struct {
+	freqs  []float64
+	offset time.Duration
+	err    error
+}
+
+func (f *fakePHC) FrequencyPPB() (float64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	freq := f.freqs[0]
+	if len(f.freqs) > 1 {
+		f.freqs = f.freqs[1:]
+	}
+	return freq, nil
+}
+
+func (f *fakePHC) Offset() (time.Duration, error) {
+	return f.offset, f.err
+}
+
+func TestCheckPHC(t *testing.T) {
+	utcOffset := 37 * time.Second
+	clock := &fakePHC{freqs: []float64{12.5, 13.1}, offset: utcOffset + 100*time.Microsecond}
+	require.NoError(t, checkPHC(clock, time.Millisecond, utcOffset, time.Millisecond))
+
+	// frequency is not adjusted
+	clock = &fakePHC{freqs: []float64{12.5}, offset: utcOffset}
+	err := checkPHC(clock, time.Millisecond, utcOffset, time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nothing disciplines it")
+
+	// PHC runs UTC instead of TAI
+	clock = &fakePHC{freqs: []float64{12.5, 13.1}, offset: 0}
+	err = checkPHC(clock, time.Millisecond, utcOffset, time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "away from system clock")
+
+	// offset check is disabled
+	clock = &fakePHC{freqs: []float64{12.5, 13.1}, offset: 0}
+	require.NoError(t, checkPHC(clock, time.Millisecond, utcOffset, 0))
+
+	clock = &fakePHC{err: errors.New("no such device")}
+	require.Error(t, checkPHC(clock, time.Millisecond, utcOffset, time.Millisecond))
+}
+
+func TestValidatePHC(t *testing.T) {
+	c := &Config{
+		StaticConfig:  StaticConfig{PHCCheck: PHCCheckRefuse, PHCMaxOffset: time.Millisecond},
+		DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6, UTCOffset: 37 * time.Second},
+	}
+	s := Server{Config: c}
+
+	require.NoError(t, s.validatePHC(&fakePHC{freqs: []float64{1, 2}, offset: 37 * time.Second}, time.Millisecond))
+	require.False(t, s.phcDegraded)
+	require.Equal(t, ptp.ClockClass6, c.ClockClass)
+
+	require.Error(t, s.validatePHC(&fakePHC{freqs: []float64{1}, offset: 37 * time.Second}, time.Millisecond))
+	require.False(t, s.phcDegraded)
+
+	c.PHCCheck = PHCCheckDegrade
+	require.NoError(t, s.validatePHC(&fakePHC{freqs: []float64{1}, offset: 37 * time.Second}, time.Millisecond))
+	require.True(t, s.phcDegraded)
+	require.Equal(t, phcDegradedClockClass, c.ClockClass)
+
+	// survives config reload
+	c.DynamicConfig = DynamicConfig{ClockClass: ptp.ClockClass6, Domains: []DomainConfig{{Domain: 24, ClockClass: ptp.ClockClass7}}}
+	s.degradeClockClass()
+	require.Equal(t, phcDegradedClockClass, c.ClockClass)
+	require.Equal(t, phcDegradedClockClass, c.Domains[0].ClockClass)
+}
+
+func TestCheckPHCAtStartSkipped(t *testing.T) {
+	s := Server{Config: &Config{}}
+	require.NoError(t, s.checkPHCAtStart())
+
+	s.Config.PHCCheck = PHCCheckRefuse
+	s.Config.TimestampType = timestamp.SWTIMESTAMP
+	require.NoError(t, s.checkPHCAtStart())
+	require.False(t, s.phcDegraded)
+}
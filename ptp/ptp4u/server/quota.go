@@ -0,0 +1,162 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// Actions taken on grant requests over quota
+const (
+	// QuotaActionDeny denies the grant
+	QuotaActionDeny = "deny"
+	// QuotaActionDowngrade grants Sync or Announce at a lower rate which fits the quota, denies otherwise
+	QuotaActionDowngrade = "downgrade"
+)
+
+// maxDowngradeSteps is how many times the interval of a grant over quota can be doubled
+const maxDowngradeSteps = 4
+
+// Scopes of subscription quotas
+const (
+	quotaScopeTenant = "tenant"
+	quotaScopeClient = "client"
+	quotaScopeGlobal = "global"
+)
+
+// QuotaConfig limits subscriptions of a subscriber, or of all subscribers together
+type QuotaConfig struct {
+	// MaxSubscriptions is how many subscriptions may be held at once. 0 - unlimited
+	MaxSubscriptions int `yaml:"maxsubscriptions,omitempty"`
+	// MaxPacketRate is how many packets per second unicast grants may add up to. 0 - unlimited
+	MaxPacketRate float64 `yaml:"maxpacketrate,omitempty"`
+}
+
+// limits returns quota as limits of a group named name
+func (q QuotaConfig) limits(name string) *TenantConfig {
+	return &TenantConfig{Name: name, MaxSubscriptions: q.MaxSubscriptions, MaxPacketRate: q.MaxPacketRate}
+}
+
+// QuotasSanity checks if client and global quotas are 0 or positive and the action is known
+func (dc *DynamicConfig) QuotasSanity() error {
+	for scope, q := range map[string]QuotaConfig{quotaScopeClient: dc.ClientQuota, quotaScopeGlobal: dc.GlobalQuota} {
+		if q.MaxSubscriptions < 0 || q.MaxPacketRate < 0 {
+			return fmt.Errorf("%s quota must be 0 or positive", scope)
+		}
+	}
+	switch dc.QuotaAction {
+	case "", QuotaActionDeny, QuotaActionDowngrade:
+		return nil
+	default:
+		return fmt.Errorf("unknown quota action %q", dc.QuotaAction)
+	}
+}
+
+// quotaLevel is one of the quotas subscription has to fit into
+type quotaLevel struct {
+	scope  string
+	quotas *tenantQuotas
+	limits *TenantConfig
+}
+
+// quotaLevels returns all quotas subscriber with the ip is subject to
+func (s *Server) quotaLevels(ip net.IP) []quotaLevel {
+	levels := []quotaLevel{
+		{scope: quotaScopeClient, quotas: s.clientQuotas, limits: s.Config.ClientQuota.limits(ip.String())},
+		{scope: quotaScopeGlobal, quotas: s.globalQuotas, limits: s.Config.GlobalQuota.limits("")},
+	}
+	if t := s.Config.Tenant(ip); t != nil {
+		levels = append(levels, quotaLevel{scope: quotaScopeTenant, quotas: s.quotas, limits: t})
+	}
+	return levels
+}
+
+// tryAdmit checks if subscription fits into all quotas of the subscriber at given packet rate and accounts it if so.
+// Otherwise it returns the quota it doesn't fit into
+func (s *Server) tryAdmit(ip net.IP, sc *SubscriptionClient, rate float64) *quotaLevel {
+	s.quotaMux.Lock()
+	defer s.quotaMux.Unlock()
+	levels := s.quotaLevels(ip)
+	for i, l := range levels {
+		if !l.quotas.fits(l.limits, sc, rate) {
+			return &levels[i]
+		}
+	}
+	for _, l := range levels {
+		l.quotas.admit(l.limits, sc, rate)
+	}
+	sc.setReleaseQuota(func() {
+		for _, l := range levels {
+			l.quotas.release(sc)
+		}
+	})
+	return nil
+}
+
+// denied logs and counts subscription denied over quota
+func (s *Server) denied(ip net.IP, sc *SubscriptionClient, l *quotaLevel) {
+	if l.scope == quotaScopeTenant {
+		log.Debugf("Tenant %q of %s is over quota, denying %s subscription", l.limits.Name, ip, sc.subscriptionType)
+		s.Stats.IncTenantDenied(l.limits.Name)
+		return
+	}
+	log.Debugf("%s is over %s quota, denying %s subscription", ip, l.scope, sc.subscriptionType)
+	s.Stats.IncQuotaDenied(l.scope)
+}
+
+// admit checks if subscriber can hold one more subscription, or renew it, at given packet rate
+func (s *Server) admit(ip net.IP, sc *SubscriptionClient, rate float64) bool {
+	if l := s.tryAdmit(ip, sc, rate); l != nil {
+		s.denied(ip, sc, l)
+		return false
+	}
+	return true
+}
+
+// admitGrant admits unicast grant at the requested interval. With QuotaActionDowngrade Sync and Announce grants over quota
+// are admitted at up to maxDowngradeSteps times doubled interval instead. It returns the interval admitted
+func (s *Server) admitGrant(ip net.IP, sc *SubscriptionClient, interval ptp.LogInterval) (ptp.LogInterval, bool) {
+	steps := 0
+	if s.Config.QuotaAction == QuotaActionDowngrade && (sc.subscriptionType == ptp.MessageSync || sc.subscriptionType == ptp.MessageAnnounce) {
+		steps = maxDowngradeSteps
+	}
+	var l *quotaLevel
+	for i := 0; i <= steps && int(interval)+i <= 127; i++ {
+		li := interval + ptp.LogInterval(i)
+		if l = s.tryAdmit(ip, sc, packetRate(sc.subscriptionType, li.Duration(), sc.OneStep())); l == nil {
+			if i > 0 {
+				log.Debugf("%s is over quota, downgrading %s subscription to %v", ip, sc.subscriptionType, li.Duration())
+				s.Stats.IncQuotaDowngraded(sc.subscriptionType)
+			}
+			return li, true
+		}
+	}
+	s.denied(ip, sc, l)
+	return interval, false
+}
+
+// reportQuotas exports usage of tenant and global quotas
+func (s *Server) reportQuotas() {
+	s.quotas.report(s.Config.Tenants, s.Stats)
+	subs, rate := s.globalQuotas.used("")
+	s.Stats.SetGlobalSubscriptions(int64(subs))
+	s.Stats.SetGlobalPacketRate(int64(rate))
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+// quotaStats records quota stats
+type quotaStats struct {
+	stats.Stats
+	denied     map[string]int
+	downgraded map[ptp.MessageType]int
+	globalSubs int64
+	globalRate int64
+}
+
+func (s *quotaStats) IncQuotaDenied(scope string)          { s.denied[scope]++ }
+func (s *quotaStats) IncTenantDenied(tenant string)        { s.denied["tenant "+tenant]++ }
+func (s *quotaStats) IncQuotaDowngraded(t ptp.MessageType) { s.downgraded[t]++ }
+func (s *quotaStats) SetGlobalSubscriptions(subs int64)    { s.globalSubs = subs }
+func (s *quotaStats) SetGlobalPacketRate(rate int64)       { s.globalRate = rate }
+
+func newQuotaTestServer(dc DynamicConfig) (*Server, *quotaStats) {
+	st := &quotaStats{Stats: stats.NewJSONStats(), denied: map[string]int{}, downgraded: map[ptp.MessageType]int{}}
+	s := &Server{
+		Config:       &Config{DynamicConfig: dc},
+		Stats:        st,
+		quotas:       newTenantQuotas(),
+		clientQuotas: newTenantQuotas(),
+		globalQuotas: newTenantQuotas(),
+	}
+	return s, st
+}
+
+func TestQuotasSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.QuotasSanity())
+	dc.ClientQuota = QuotaConfig{MaxSubscriptions: 3, MaxPacketRate: 10}
+	dc.QuotaAction = QuotaActionDowngrade
+	require.NoError(t, dc.QuotasSanity())
+
+	dc.ClientQuota.MaxSubscriptions = -1
+	require.EqualError(t, dc.QuotasSanity(), "client quota must be 0 or positive")
+	dc.ClientQuota.MaxSubscriptions = 0
+	dc.GlobalQuota.MaxPacketRate = -1
+	require.EqualError(t, dc.QuotasSanity(), "global quota must be 0 or positive")
+	dc.GlobalQuota.MaxPacketRate = 0
+	dc.QuotaAction = "ignore"
+	require.EqualError(t, dc.QuotasSanity(), `unknown quota action "ignore"`)
+}
+
+func TestReadDynamicConfigQuotas(t *testing.T) {
+	cfg, err := os.CreateTemp("", "ptp4u")
+	require.NoError(t, err)
+	defer os.Remove(cfg.Name())
+	_, err = cfg.WriteString(`utcoffset: "37s"
+clientquota:
+  maxsubscriptions: 3
+  maxpacketrate: 8
+globalquota:
+  maxpacketrate: 100000
+quotaaction: downgrade
+`)
+	require.NoError(t, err)
+
+	dc, err := ReadDynamicConfig(cfg.Name())
+	require.NoError(t, err)
+	require.Equal(t, &DynamicConfig{
+		UTCOffset:   37 * time.Second,
+		ClientQuota: QuotaConfig{MaxSubscriptions: 3, MaxPacketRate: 8},
+		GlobalQuota: QuotaConfig{MaxPacketRate: 100000},
+		QuotaAction: QuotaActionDowngrade,
+	}, dc)
+}
+
+func TestServerAdmitClientQuota(t *testing.T) {
+	s, st := newQuotaTestServer(DynamicConfig{ClientQuota: QuotaConfig{MaxSubscriptions: 1}})
+	sc1 := &SubscriptionClient{subscriptionType: ptp.MessageSync}
+	sc2 := &SubscriptionClient{subscriptionType: ptp.MessageAnnounce}
+	sc3 := &SubscriptionClient{subscriptionType: ptp.MessageAnnounce}
+
+	require.True(t, s.admit(net.ParseIP("10.0.0.1"), sc1, 1))
+	require.False(t, s.admit(net.ParseIP("10.0.0.1"), sc2, 1))
+	// other subscribers have their own quota
+	require.True(t, s.admit(net.ParseIP("10.0.0.2"), sc3, 1))
+	require.Equal(t, 1, st.denied[quotaScopeClient])
+
+	// quota is freed once the subscription is over, and subscriber is forgotten
+	sc1.release()
+	require.NotContains(t, s.clientQuotas.usage, "10.0.0.1")
+	require.True(t, s.admit(net.ParseIP("10.0.0.1"), sc2, 1))
+}
+
+func TestServerAdmitGlobalQuota(t *testing.T) {
+	s, st := newQuotaTestServer(DynamicConfig{
+		GlobalQuota: QuotaConfig{MaxPacketRate: 10},
+		Tenants:     []TenantConfig{{Name: "a", Prefixes: []string{"10.0.0.0/8"}, MaxSubscriptions: 1}},
+	})
+	sc1 := &SubscriptionClient{subscriptionType: ptp.MessageSync}
+	sc2 := &SubscriptionClient{subscriptionType: ptp.MessageSync}
+	sc3 := &SubscriptionClient{subscriptionType: ptp.MessageSync}
+
+	require.True(t, s.admit(net.ParseIP("192.168.0.1"), sc1, 8))
+	require.False(t, s.admit(net.ParseIP("192.168.0.2"), sc2, 4))
+	require.Equal(t, 1, st.denied[quotaScopeGlobal])
+
+	// denied subscription doesn't hold any quota
+	require.True(t, s.admit(net.ParseIP("10.0.0.1"), sc2, 1))
+	require.False(t, s.admit(net.ParseIP("10.0.0.2"), sc3, 1))
+	require.Equal(t, 1, st.denied["tenant a"])
+	subs, rate := s.globalQuotas.used("")
+	require.Equal(t, 2, subs)
+	require.Equal(t, 9.0, rate)
+
+	s.reportQuotas()
+	require.Equal(t, int64(2), st.globalSubs)
+	require.Equal(t, int64(9), st.globalRate)
+}
+
+func TestServerAdmitGrant(t *testing.T) {
+	s, st := newQuotaTestServer(DynamicConfig{ClientQuota: QuotaConfig{MaxPacketRate: 5}})
+	ip := net.ParseIP("10.0.0.1")
+	sync := &SubscriptionClient{subscriptionType: ptp.MessageSync}
+	announce := &SubscriptionClient{subscriptionType: ptp.MessageAnnounce}
+
+	// 16 two-step Syncs per second don't fit
+	_, ok := s.admitGrant(ip, sync, -4)
+	require.False(t, ok)
+	require.Equal(t, 1, st.denied[quotaScopeClient])
+
+	s.Config.QuotaAction = QuotaActionDowngrade
+	li, ok := s.admitGrant(ip, sync, -4)
+	require.True(t, ok)
+	require.Equal(t, ptp.LogInterval(-1), li)
+	require.Equal(t, 1, st.downgraded[ptp.MessageSync])
+
+	// what's left fits requested Announce rate as is
+	li, ok = s.admitGrant(ip, announce, 0)
+	require.True(t, ok)
+	require.Equal(t, ptp.LogInterval(0), li)
+
+	// DelayResp rate is driven by the subscriber, so it's never downgraded
+	delayResp := &SubscriptionClient{subscriptionType: ptp.MessageDelayResp}
+	_, ok = s.admitGrant(ip, delayResp, -7)
+	require.False(t, ok)
+}
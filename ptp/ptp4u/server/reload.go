@@ -0,0 +1,68 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+// reconcileSubscriptions applies reloaded config to running subscriptions instead of dropping them.
+// Subscriptions of subscribers denied by ACL now are cancelled and grants longer than MaxSubDuration are shortened to it.
+// Intervals granted before are honored until subscriber renews the grant and gets one within the new limits
+func (s *Server) reconcileSubscriptions(now time.Time) (kept, cancelled, shortened int) {
+	for _, w := range s.sw {
+		k, c, sh := w.reconcileSubscriptions(s.Config, now)
+		kept += k
+		cancelled += c
+		shortened += sh
+	}
+	return kept, cancelled, shortened
+}
+
+// reconcileSubscriptions applies config to running subscriptions of the worker
+func (s *sendWorker) reconcileSubscriptions(c *Config, now time.Time) (kept, cancelled, shortened int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for st, subs := range s.clients {
+		for _, sc := range subs {
+			// stopped ones are on their way out
+			if !sc.Running() || sc.Expired() {
+				continue
+			}
+			// multicast subscriptions are served to a group rather than a subscriber
+			if !sc.Multicast() {
+				if ip := timestamp.SockaddrToIP(sc.eclisa); !c.Allowed(ip) {
+					log.Infof("%s is denied by ACL now, cancelling %s subscription", ip, st)
+					sc.Stop()
+					cancelled++
+					continue
+				}
+			}
+			if c.MaxSubDuration > 0 {
+				if limit := now.Add(c.MaxSubDuration); sc.Expire().After(limit) {
+					sc.SetExpire(limit)
+					shortened++
+				}
+			}
+			kept++
+		}
+	}
+	return kept, cancelled, shortened
+}
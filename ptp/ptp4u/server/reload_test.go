@@ -0,0 +1,69 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileSubscriptions(t *testing.T) {
+	s := newControlTestServer(t)
+	sc := subscribe(s, time.Hour)
+	require.Eventually(t, sc.Running, time.Second, 10*time.Millisecond)
+
+	// nothing to apply
+	kept, cancelled, shortened := s.reconcileSubscriptions(time.Now())
+	require.Equal(t, []int{1, 0, 0}, []int{kept, cancelled, shortened})
+
+	// grant longer than max subscription duration is shortened, not dropped
+	s.Config.MaxSubDuration = time.Minute
+	now := time.Now()
+	kept, cancelled, shortened = s.reconcileSubscriptions(now)
+	require.Equal(t, []int{1, 0, 1}, []int{kept, cancelled, shortened})
+	require.Equal(t, now.Add(time.Minute), sc.Expire())
+	require.True(t, sc.Running())
+
+	// subscriber denied by ACL is cancelled
+	s.Config.ACL.Deny = []string{"127.0.0.0/8"}
+	s.Config.resetACL()
+	kept, cancelled, shortened = s.reconcileSubscriptions(time.Now())
+	require.Equal(t, []int{0, 1, 0}, []int{kept, cancelled, shortened})
+	require.Eventually(t, func() bool { return !sc.Running() }, time.Second, 10*time.Millisecond)
+}
+
+func TestReconcileSubscriptionsMulticast(t *testing.T) {
+	s := newControlTestServer(t)
+	s.Config.ACL.Allow = []string{"10.0.0.0/8"}
+	s.Config.resetACL()
+	w := s.sw[0]
+	sa := timestamp.IPToSockaddr(net.ParseIP("ff0e::181"), 319)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, s.Config, time.Hour, time.Now().Add(time.Hour))
+	sc.SetMulticast()
+	w.RegisterSubscription(ptp.PortIdentity{PortNumber: 1}, ptp.MessageAnnounce, sc)
+	sc.setRunning(true)
+
+	// ACL is for subscribers, multicast group isn't one
+	kept, cancelled, _ := s.reconcileSubscriptions(time.Now())
+	require.Equal(t, 1, kept)
+	require.Equal(t, 0, cancelled)
+}
@@ -24,11 +24,14 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/protocol/sptp"
 	"github.com/facebook/time/ptp/ptp4u/drain"
 	"github.com/facebook/time/ptp/ptp4u/stats"
 	"github.com/facebook/time/timestamp"
@@ -43,13 +46,29 @@ type Server struct {
 	Checks []drain.Drain
 	sw     []*sendWorker
 
-	// server source fds
-	eFd int
-	gFd int
+	// subscriptions held by tenants, single subscribers and all of them
+	quotas       *tenantQuotas
+	clientQuotas *tenantQuotas
+	globalQuotas *tenantQuotas
+	// quotaMux makes admission into all quotas atomic
+	quotaMux sync.Mutex
+	// DelayReq rates of subscribers
+	flood *floodControl
 
 	// drain logic
 	cancel context.CancelFunc
 	ctx    context.Context
+	// drainMux serializes drain decisions of drain checks and control API
+	drainMux     sync.Mutex
+	drainRequest drainRequest
+	// refuseGrants is set while server waits for current grants to expire
+	refuseGrants int32
+
+	// phcDegraded is set if PHC didn't pass the startup check
+	phcDegraded bool
+
+	// leap is UTC offset and upcoming leap second from leap second file, nil if it's not used
+	leap *leapState
 }
 
 // fixed subscription duration for sptp clients
@@ -70,9 +89,38 @@ func (s *Server) Start() error {
 	if err != nil {
 		return fmt.Errorf("unable to get the Clock Identity (EUI-64 address) of the interface: %w", err)
 	}
+	s.Config.resetACL()
+
+	// UTC offset from leap second file is used by PHC check already
+	if s.Config.LeapSecondFile != "" {
+		clock, err := s.leapClock()
+		if err != nil {
+			return fmt.Errorf("leap second clock: %w", err)
+		}
+		now, tai, err := clock()
+		if err != nil {
+			return fmt.Errorf("reading leap second clock: %w", err)
+		}
+		if _, err := s.updateLeap(now, tai); err != nil {
+			return fmt.Errorf("reading leap second file: %w", err)
+		}
+		go s.trackLeapSeconds(clock)
+	}
+
+	// Make sure we are not about to confidently serve wrong time
+	if err := s.checkPHCAtStart(); err != nil {
+		return err
+	}
+
+	// NIC may not be able to do one-step timestamps we are asked for
+	s.detectOneStep()
 
 	// initialize the context for the subscriptions
 	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.quotas = newTenantQuotas()
+	s.clientQuotas = newTenantQuotas()
+	s.globalQuotas = newTenantQuotas()
+	s.flood = newFloodControl()
 
 	// Done channel signals the graceful shutdown
 	done := make(chan bool)
@@ -90,44 +138,71 @@ func (s *Server) Start() error {
 		}(i)
 	}
 
+	// multicast Sync and Announce alongside unicast subscriptions
+	senders, err := s.multicastSenders()
+	if err != nil {
+		return err
+	}
+	for _, m := range senders {
+		go func(m *multicastSender) {
+			m.Start(func() context.Context { return s.ctx })
+			fail <- true
+		}(m)
+	}
+
+	for _, ip := range s.Config.ListenIPs() {
+		go func(ip net.IP) {
+			s.startGeneralListener(ip)
+			fail <- true
+		}(ip)
+		go func(ip net.IP) {
+			s.startEventListener(ip)
+			fail <- true
+		}(ip)
+	}
+
+	// Scale senders of every worker with its load. Limit may be raised by config reload, so it runs even if autoscaling is disabled
 	go func() {
-		s.startGeneralListener()
-		fail <- true
-	}()
-	go func() {
-		s.startEventListener()
+		for ; true; <-time.After(autoscaleInterval) {
+			s.autoscale()
+		}
 		fail <- true
 	}()
 
 	// Drain check
 	go func() {
 		for ; true; <-time.After(s.Config.DrainInterval) {
-			var shouldDrain bool
-			for _, check := range s.Checks {
-				if check.Check() {
-					shouldDrain = true
-					log.Warningf("%T engaged", check)
-					break
-				}
-			}
-
-			if drain.Undrain(s.Config.UndrainFileName) {
-				log.Warningf("Force undrain file %s is planted, undraining!", s.Config.UndrainFileName)
-				shouldDrain = false
-			}
-
-			if shouldDrain {
-				log.Warningf("shifting traffic")
-				s.Drain()
-				s.Stats.SetDrain(1)
-			} else {
-				s.Undrain()
-				s.Stats.SetDrain(0)
-			}
+			s.checkDrain()
 		}
 		fail <- true
 	}()
 
+	// Drain control API
+	if s.Config.ControlAddr != "" {
+		ln, err := s.listenControl()
+		if err != nil {
+			return fmt.Errorf("unable to listen for control API on %s: %w", s.Config.ControlAddr, err)
+		}
+		log.Infof("Serving control API on %s", s.Config.ControlAddr)
+		go func() {
+			log.Errorf("Control API failed: %v", http.Serve(ln, s.controlHandler()))
+			fail <- true
+		}()
+	}
+
+	// Management requests over unix socket. General port answers them too
+	if s.Config.MgmtSocket != "" {
+		conn, err := s.listenManagement()
+		if err != nil {
+			return fmt.Errorf("unable to listen for management requests on %s: %w", s.Config.MgmtSocket, err)
+		}
+		log.Infof("Serving management requests on %s", s.Config.MgmtSocket)
+		go func() {
+			log.Errorf("Management server failed: %v", s.serveManagement(conn))
+			fail <- true
+		}()
+	}
+
 	// Watch for SIGHUP and reload dynamic config
 	go func() {
 		s.handleSighup()
@@ -145,10 +220,20 @@ func (s *Server) Start() error {
 		for ; true; <-time.After(s.Config.MetricInterval) {
 			for _, w := range s.sw {
 				w.inventoryClients()
+				s.Stats.SetWorkerSenders(w.id, int64(w.senders()))
 			}
 			s.Stats.SetUTCOffsetSec(int64(s.Config.UTCOffset.Seconds()))
 			s.Stats.SetClockAccuracy(int64(s.Config.ClockAccuracy))
 			s.Stats.SetClockClass(int64(s.Config.ClockClass))
+			s.Stats.SetConfigVersion(int64(s.Config.Version))
+			for _, d := range s.Config.Domains {
+				s.Stats.SetDomainClockClass(d.Domain, int64(d.ClockClass))
+				s.Stats.SetDomainClockAccuracy(d.Domain, int64(d.ClockAccuracy))
+			}
+			s.reportQuotas()
+			s.reportFlood()
+			s.reportLeap()
+			s.reportTurnaround()
 
 			s.Stats.Snapshot()
 			s.Stats.Reset()
@@ -165,18 +250,18 @@ func (s *Server) Start() error {
 	}
 }
 
-// startEventListener launches the listener which listens to subscription requests
-func (s *Server) startEventListener() {
+// startEventListener launches the listener which listens to subscription requests on ip
+func (s *Server) startEventListener(ip net.IP) {
 	var err error
-	log.Infof("Binding on %s %d", s.Config.IP, ptp.PortEvent)
-	eventConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: s.Config.IP, Port: ptp.PortEvent})
+	log.Infof("Binding on %s %d", ip, ptp.PortEvent)
+	eventConn, err := net.ListenUDP(s.Config.listenNetwork(ip), &net.UDPAddr{IP: ip, Port: ptp.PortEvent})
 	if err != nil {
 		log.Fatalf("Listening error: %s", err)
 	}
 	defer eventConn.Close()
 
 	// get connection file descriptor
-	s.eFd, err = timestamp.ConnFd(eventConn)
+	eFd, err := timestamp.ConnFd(eventConn)
 	if err != nil {
 		log.Fatalf("Getting event connection FD: %s", err)
 	}
@@ -184,18 +269,18 @@ func (s *Server) startEventListener() {
 	// Enable RX timestamps. Delay requests need to be timestamped by ptp4u on receipt
 	switch s.Config.TimestampType {
 	case timestamp.HWTIMESTAMP:
-		if err = timestamp.EnableHWTimestamps(s.eFd, s.Config.Interface); err != nil {
+		if err = enableHWTimestamps(eFd, s.Config); err != nil {
 			log.Fatalf("Cannot enable hardware RX timestamps: %v", err)
 		}
 	case timestamp.SWTIMESTAMP:
-		if err = timestamp.EnableSWTimestamps(s.eFd); err != nil {
+		if err = timestamp.EnableSWTimestamps(eFd); err != nil {
 			log.Fatalf("Cannot enable software RX timestamps: %v", err)
 		}
 	default:
 		log.Fatalf("Unrecognized timestamp type: %s", s.Config.TimestampType)
 	}
 
-	err = unix.SetNonblock(s.eFd, false)
+	err = unix.SetNonblock(eFd, false)
 	if err != nil {
 		log.Fatalf("Failed to set socket to blocking: %s", err)
 	}
@@ -203,30 +288,30 @@ func (s *Server) startEventListener() {
 	fail := make(chan bool)
 	for i := 0; i < s.Config.RecvWorkers; i++ {
 		go func() {
-			s.handleEventMessages(eventConn)
+			s.handleEventMessages(eventConn, eFd)
 			fail <- true
 		}()
 	}
 	<-fail
 }
 
-// startGeneralListener launches the listener which listens to announces
-func (s *Server) startGeneralListener() {
+// startGeneralListener launches the listener which listens to announces on ip
+func (s *Server) startGeneralListener(ip net.IP) {
 	var err error
-	log.Infof("Binding on %s %d", s.Config.IP, ptp.PortGeneral)
-	generalConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: s.Config.IP, Port: ptp.PortGeneral})
+	log.Infof("Binding on %s %d", ip, ptp.PortGeneral)
+	generalConn, err := net.ListenUDP(s.Config.listenNetwork(ip), &net.UDPAddr{IP: ip, Port: ptp.PortGeneral})
 	if err != nil {
 		log.Fatalf("Listening error: %s", err)
 	}
 	defer generalConn.Close()
 
 	// get connection file descriptor
-	s.gFd, err = timestamp.ConnFd(generalConn)
+	gFd, err := timestamp.ConnFd(generalConn)
 	if err != nil {
 		log.Fatalf("Getting general connection FD: %s", err)
 	}
 
-	err = unix.SetNonblock(s.gFd, false)
+	err = unix.SetNonblock(gFd, false)
 	if err != nil {
 		log.Fatalf("Failed to set socket to blocking: %s", err)
 	}
@@ -234,7 +319,7 @@ func (s *Server) startGeneralListener() {
 	fail := make(chan bool)
 	for i := 0; i < s.Config.RecvWorkers; i++ {
 		go func() {
-			s.handleGeneralMessages(generalConn)
+			s.handleGeneralMessages(generalConn, gFd)
 			fail <- true
 		}()
 	}
@@ -250,8 +335,8 @@ func readPacketBuf(connFd int, buf []byte) (int, unix.Sockaddr, error) {
 	return n, saddr, err
 }
 
-// handleEventMessage is a handler which gets called every time Event Message arrives
-func (s *Server) handleEventMessages(eventConn *net.UDPConn) {
+// handleEventMessage is a handler which gets called every time Event Message arrives on eFd
+func (s *Server) handleEventMessages(eventConn *net.UDPConn, eFd int) {
 	buf := make([]byte, timestamp.PayloadSizeBytes)
 	oob := make([]byte, timestamp.ControlSizeBytes)
 	dReq := &ptp.SyncDelayReq{}
@@ -265,11 +350,12 @@ func (s *Server) handleEventMessages(eventConn *net.UDPConn) {
 	var expire time.Time
 
 	for {
-		bbuf, eclisa, rxTS, err := timestamp.ReadPacketWithRXTimestampBuf(s.eFd, buf, oob)
+		bbuf, eclisa, rxTS, err := timestamp.ReadPacketWithRXTimestampBuf(eFd, buf, oob)
 		if err != nil {
 			log.Errorf("Failed to read packet on %s: %v", eventConn.LocalAddr(), err)
 			continue
 		}
+		received := time.Now()
 		if s.Config.TimestampType != timestamp.HWTIMESTAMP {
 			rxTS = rxTS.Add(s.Config.UTCOffset)
 		}
@@ -293,32 +379,58 @@ func (s *Server) handleEventMessages(eventConn *net.UDPConn) {
 				log.Errorf("Failed to read the ptp SyncDelayReq: %v", err)
 				continue
 			}
+			if !s.allowed(timestamp.SockaddrToIP(eclisa), msgType) {
+				continue
+			}
 			log.Debugf("Got delay request")
 			worker = s.findWorker(dReq.Header.SourcePortIdentity, r)
-			if dReq.FlagField == ptp.FlagProfileSpecific1|ptp.FlagUnicast {
+			// keep Sync subscription alive
+			if sc = worker.FindSubscription(dReq.Header.SourcePortIdentity, ptp.MessageSync); sc != nil {
+				sc.UpdateDelayReqActivity(time.Now())
+			}
+			if sptp.IsDelayReq(&dReq.Header) {
 				expire = time.Now().Add(subscriptionDuration)
 				// SYNC DELAY_REQUEST and ANNOUNCE
 				if sc = worker.FindSubscription(dReq.Header.SourcePortIdentity, ptp.MessageDelayReq); sc == nil {
+					// no new subscriptions while waiting for current ones to expire, or in domains we don't serve
+					if !s.acceptingGrants() || !s.servesDomain(dReq.Header.DomainNumber) {
+						continue
+					}
 					ip = timestamp.SockaddrToIP(eclisa)
-					gclisa = timestamp.IPToSockaddr(ip, ptp.PortGeneral)
+					gclisa = s.Config.clientSockaddr(ip, ptp.PortGeneral)
 					// Create a new subscription
 					sc = NewSubscriptionClient(worker.queue, worker.signalingQueue, eclisa, gclisa, ptp.MessageDelayReq, s.Config, subscriptionDuration, expire)
+					sc.SetDomain(dReq.Header.DomainNumber)
+					// packet rate of sptp is driven by the subscriber, so it only counts towards the number of subscriptions
+					if !s.admit(ip, sc, 0) {
+						continue
+					}
 					worker.RegisterSubscription(dReq.Header.SourcePortIdentity, ptp.MessageDelayReq, sc)
 					go sc.Start(s.ctx)
-				} else {
+				} else if s.acceptingGrants() {
 					// bump the subscription
 					sc.SetExpire(expire)
 				}
+				if !s.floodAllowed(eclisa, s.Config.FloodControl.sptpRate()) {
+					continue
+				}
 				sc.UpdateSyncDelayReq(rxTS, dReq.SequenceID)
 				sc.UpdateAnnounceDelayReq(dReq.CorrectionField, dReq.SequenceID)
 			} else {
 				// DELAY_RESPONSE
 				if sc = worker.FindSubscription(dReq.Header.SourcePortIdentity, ptp.MessageDelayResp); sc == nil {
-					log.Infof("Delay request from %s is not in the subscription list", timestamp.SockaddrToIP(eclisa))
+					if sc = s.hybridDelayResp(worker, eclisa); sc == nil || !s.servesDomain(dReq.Header.DomainNumber) {
+						log.Infof("Delay request from %s is not in the subscription list", timestamp.SockaddrToIP(eclisa))
+						continue
+					}
+					sc.SetDomain(dReq.Header.DomainNumber)
+				}
+				if !s.floodAllowed(eclisa, 1/sc.Interval().Seconds()) {
 					continue
 				}
 				sc.UpdateDelayResp(&dReq.Header, rxTS)
 			}
+			sc.SetDelayReqReceived(received)
 			sc.Once()
 		default:
 			log.Errorf("Got unsupported message type %s(%d)", msgType, msgType)
@@ -326,8 +438,8 @@ func (s *Server) handleEventMessages(eventConn *net.UDPConn) {
 	}
 }
 
-// handleGeneralMessage is a handler which gets called every time General Message arrives
-func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
+// handleGeneralMessage is a handler which gets called every time General Message arrives on gFd
+func (s *Server) handleGeneralMessages(generalConn *net.UDPConn, gFd int) {
 	buf := make([]byte, timestamp.PayloadSizeBytes)
 	signaling := &ptp.Signaling{}
 	zerotlv := []ptp.TLV{}
@@ -342,11 +454,12 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 	var sc *SubscriptionClient
 
 	for {
-		bbuf, gclisa, err := readPacketBuf(s.gFd, buf)
+		bbuf, gclisa, err := readPacketBuf(gFd, buf)
 		if err != nil {
 			log.Errorf("Failed to read packet on %s: %v", generalConn.LocalAddr(), err)
 			continue
 		}
+		rxTime := time.Now()
 
 		msgType, err := ptp.ProbeMsgType(buf[:bbuf])
 		if err != nil {
@@ -367,6 +480,9 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 				case *ptp.RequestUnicastTransmissionTLV:
 					signalingType = v.MsgTypeAndReserved.MsgType()
 					s.Stats.IncRXSignalingGrant(signalingType)
+					if !s.allowed(timestamp.SockaddrToIP(gclisa), signalingType) {
+						continue
+					}
 					log.Debugf("Got %s grant request", signalingType)
 					durationt = time.Duration(v.DurationField) * time.Second
 					expire = time.Now().Add(durationt)
@@ -378,10 +494,11 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 						sc = worker.FindSubscription(signaling.SourcePortIdentity, signalingType)
 						if sc == nil || !sc.Running() {
 							ip := timestamp.SockaddrToIP(gclisa)
-							eclisa := timestamp.IPToSockaddr(ip, ptp.PortEvent)
+							eclisa := s.Config.clientSockaddr(ip, ptp.PortEvent)
 							sc = NewSubscriptionClient(worker.queue, worker.signalingQueue, eclisa, gclisa, signalingType, s.Config, intervalt, expire)
+							sc.SetDomain(signaling.Header.DomainNumber)
 							worker.RegisterSubscription(signaling.SourcePortIdentity, signalingType, sc)
-						} else {
+						} else if s.acceptingGrants() {
 							// Update existing subscription data
 							sc.SetExpire(expire)
 							sc.SetInterval(intervalt)
@@ -390,14 +507,28 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 							sc.SetGclisa(gclisa)
 						}
 
-						// Reject queries out of limit
-						if intervalt < s.Config.MinSubInterval || durationt > s.Config.MaxSubDuration || s.ctx.Err() != nil {
-							sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, 0)
+						// Reject queries out of limit or in domains we don't serve
+						if intervalt < s.Config.MinSubInterval || durationt > s.Config.MaxSubDuration || s.ctx.Err() != nil || !s.acceptingGrants() || !s.servesDomain(sc.Domain()) {
+							sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, 0, rxTime)
 							continue
 						}
 
+						if signalingType == ptp.MessageSync {
+							sc.SetOneStep(s.oneStepCapable(timestamp.SockaddrToIP(gclisa), v))
+						}
+
+						// Reject or downgrade queries over the quota
+						logInterval, ok := s.admitGrant(timestamp.SockaddrToIP(gclisa), sc, v.LogInterMessagePeriod)
+						if !ok {
+							sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, 0, rxTime)
+							continue
+						}
+						if logInterval != v.LogInterMessagePeriod {
+							sc.SetInterval(logInterval.Duration())
+						}
+
 						// Send confirmation grant
-						sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, v.DurationField)
+						sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, logInterval, v.DurationField, rxTime)
 
 						if !sc.Running() {
 							go sc.Start(s.ctx)
@@ -420,10 +551,36 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 					log.Errorf("Got unsupported message type %s(%d)", msgType, msgType)
 				}
 			}
+		case ptp.MessageManagement:
+			reply, err := s.managementReply(buf[:bbuf])
+			if err != nil {
+				log.Errorf("Failed to handle management message: %v", err)
+				continue
+			}
+			if reply == nil {
+				continue
+			}
+			if err := unix.Sendto(gFd, reply, 0, gclisa); err != nil {
+				log.Errorf("Failed to reply to management message: %v", err)
+			}
 		}
 	}
 }
 
+// servesDomain checks if server serves the PTP domain
+func (s *Server) servesDomain(domain uint8) bool {
+	_, ok := s.Config.Domain(domain)
+	return ok
+}
+
+// oneStepCapable checks if subscriber can be served one-step Syncs: it's either known to accept them, or tells so itself
+func (s *Server) oneStepCapable(ip net.IP, req *ptp.RequestUnicastTransmissionTLV) bool {
+	if !s.Config.OneStep {
+		return false
+	}
+	return uint8(req.MsgTypeAndReserved)&OneStepHint != 0 || s.Config.OneStepCapable(ip)
+}
+
 func (s *Server) findWorker(clientID ptp.PortIdentity, r *rand.Rand) *sendWorker {
 	// Seeding random with the same value will produce the same number
 	r.Seed(int64(clientID.ClockIdentity) + int64(clientID.PortNumber))
@@ -466,17 +623,43 @@ func (s *Server) handleSighup() {
 	signal.Notify(sigchan, unix.SIGHUP)
 	for range sigchan {
 		log.Info("SIGHUP received, reloading config")
-		dc, err := ReadDynamicConfig(s.Config.ConfigFile)
-		if err != nil {
+		if err := s.reloadConfig(); err != nil {
 			log.Errorf("Failed to reload config: %v. Moving on", err)
-			continue
 		}
-		dcMux.Lock()
-		s.Config.DynamicConfig = *dc
-		dcMux.Unlock()
+	}
+}
+
+// reloadConfig reads and validates dynamic config, and only then swaps it in, keeping running subscriptions.
+// Invalid config is rejected as a whole and the current one stays in effect
+func (s *Server) reloadConfig() error {
+	dc, err := ReadDynamicConfig(s.Config.ConfigFile)
+	if err != nil {
+		s.Stats.IncReloadFailure()
+		return err
+	}
+	dcMux.Lock()
+	changed := s.Config.DynamicConfig.Changed(dc)
+	s.Config.DynamicConfig = *dc
+	s.degradeClockClass()
+	s.overrideUTCOffset()
+	s.Config.resetAlternateTimeOffsets()
+	s.Config.resetACL()
+	err = s.Config.ApplyLogLevel()
+	dcMux.Unlock()
+	if err != nil {
+		// dynamic log level is validated, so it's the command line one
+		log.Errorf("Failed to apply log level: %v", err)
+	}
 
-		s.Stats.IncReload()
+	if len(changed) == 0 {
+		log.Infof("Config version %d reloaded, nothing changed", dc.Version)
+	} else {
+		log.Infof("Config version %d reloaded, changed: %v", dc.Version, changed)
 	}
+	kept, cancelled, shortened := s.reconcileSubscriptions(time.Now())
+	log.Infof("Kept %d subscriptions after reload, cancelled %d denied by ACL, shortened %d to max subscription duration", kept, cancelled, shortened)
+	s.Stats.IncReload()
+	return nil
 }
 
 // handleSigterm watches for SIGTERM and SIGINT and removes the pid file
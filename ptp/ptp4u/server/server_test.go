@@ -21,12 +21,14 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/facebook/time/ptp/ptp4u/stats"
 	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sys/unix"
 )
@@ -74,6 +76,26 @@ func TestFindWorker(t *testing.T) {
 	require.Equal(t, 1, s.findWorker(clipi3, r).id)
 }
 
+func TestServerOneStepCapable(t *testing.T) {
+	c := &Config{
+		DynamicConfig: DynamicConfig{
+			OneStepClients: []string{"10.0.0.0/8"},
+		},
+	}
+	s := Server{Config: c}
+	noHint := &ptp.RequestUnicastTransmissionTLV{MsgTypeAndReserved: ptp.NewUnicastMsgTypeAndFlags(ptp.MessageSync, 0)}
+	hint := &ptp.RequestUnicastTransmissionTLV{MsgTypeAndReserved: ptp.NewUnicastMsgTypeAndFlags(ptp.MessageSync, OneStepHint)}
+
+	// one-step is not available
+	require.False(t, s.oneStepCapable(net.ParseIP("10.0.0.1"), noHint))
+	require.False(t, s.oneStepCapable(net.ParseIP("192.168.0.1"), hint))
+
+	c.OneStep = true
+	require.True(t, s.oneStepCapable(net.ParseIP("10.0.0.1"), noHint))
+	require.False(t, s.oneStepCapable(net.ParseIP("192.168.0.1"), noHint))
+	require.True(t, s.oneStepCapable(net.ParseIP("192.168.0.1"), hint))
+}
+
 func TestStartEventListener(t *testing.T) {
 	ptp.PortEvent = 0
 	c := &Config{
@@ -90,7 +112,7 @@ func TestStartEventListener(t *testing.T) {
 		Stats:  stats.NewJSONStats(),
 		sw:     make([]*sendWorker, c.SendWorkers),
 	}
-	go s.startEventListener()
+	go s.startEventListener(c.IP)
 	time.Sleep(100 * time.Millisecond)
 }
 
@@ -110,7 +132,7 @@ func TestStartGeneralListener(t *testing.T) {
 		Stats:  stats.NewJSONStats(),
 		sw:     make([]*sendWorker, c.SendWorkers),
 	}
-	go s.startGeneralListener()
+	go s.startGeneralListener(c.IP)
 	time.Sleep(100 * time.Millisecond)
 }
 
@@ -217,6 +239,70 @@ utcoffset: "37s"
 	require.Equal(t, 1, len(s.sw[1].queue))
 }
 
+type reloadStats struct {
+	stats.Stats
+	reloads  int
+	failures int
+}
+
+func (s *reloadStats) IncReload() {
+	s.reloads++
+}
+
+func (s *reloadStats) IncReloadFailure() {
+	s.failures++
+}
+
+func TestReloadConfig(t *testing.T) {
+	cfg := filepath.Join(t.TempDir(), "ptp4u.yaml")
+	c := &Config{
+		StaticConfig:  StaticConfig{ConfigFile: cfg, LogLevel: log.GetLevel().String()},
+		DynamicConfig: DynamicConfig{ClockClass: 6, UTCOffset: 37 * time.Second},
+	}
+	st := &reloadStats{}
+	s := Server{Config: c, Stats: st}
+
+	config := `clockclass: 7
+utcoffset: "37s"
+acl:
+  deny: ["10.0.0.0/8"]
+`
+	require.NoError(t, os.WriteFile(cfg, []byte(config), 0644))
+	require.NoError(t, s.reloadConfig())
+	require.Equal(t, ptp.ClockClass(7), c.ClockClass)
+	require.False(t, c.Allowed(net.ParseIP("10.0.0.1")))
+	require.Equal(t, 1, st.reloads)
+	require.Equal(t, 0, st.failures)
+
+	// invalid config is rejected as a whole
+	config = `clockclass: 13
+utcoffset: "37s"
+loglevel: verbose
+`
+	require.NoError(t, os.WriteFile(cfg, []byte(config), 0644))
+	require.EqualError(t, s.reloadConfig(), "unrecognized log level: verbose")
+	require.Equal(t, ptp.ClockClass(7), c.ClockClass)
+	require.False(t, c.Allowed(net.ParseIP("10.0.0.1")))
+	require.Equal(t, 1, st.reloads)
+	require.Equal(t, 1, st.failures)
+
+	// partially written config never gets applied
+	dc := &DynamicConfig{ClockClass: 248, UTCOffset: 37 * time.Second, Version: 2}
+	require.NoError(t, dc.Write(cfg))
+	data, err := os.ReadFile(cfg)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cfg, data[:len(data)-10], 0644))
+	require.ErrorIs(t, s.reloadConfig(), errConfigChecksum)
+	require.Equal(t, ptp.ClockClass(7), c.ClockClass)
+	require.Equal(t, 2, st.failures)
+
+	require.NoError(t, dc.Write(cfg))
+	require.NoError(t, s.reloadConfig())
+	require.Equal(t, ptp.ClockClass(248), c.ClockClass)
+	require.Equal(t, uint64(2), c.Version)
+	require.Equal(t, 2, st.reloads)
+}
+
 func TestHandleSigterm(t *testing.T) {
 	cfg, err := os.CreateTemp("", "ptp4u")
 	require.NoError(t, err)
@@ -243,3 +329,15 @@ func TestHandleSigterm(t *testing.T) {
 	s.handleSigterm()
 	require.NoFileExists(t, cfg.Name())
 }
+
+func TestServesDomain(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{DomainNumber: 4}}
+	s := Server{Config: c}
+	require.True(t, s.servesDomain(4))
+	require.False(t, s.servesDomain(24))
+
+	c.Domains = []DomainConfig{{Domain: 24}}
+	require.True(t, s.servesDomain(4))
+	require.True(t, s.servesDomain(24))
+	require.False(t, s.servesDomain(0))
+}
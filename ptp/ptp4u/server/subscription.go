@@ -27,6 +27,7 @@ import (
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/protocol/sptp"
 	"github.com/facebook/time/timestamp"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
@@ -35,6 +36,8 @@ import (
 // SubscriptionClient is sending subscriptionType messages periodically
 type SubscriptionClient struct {
 	sync.Mutex
+	// sendMux is held while the subscription is being sent
+	sendMux sync.Mutex
 
 	queue            chan *SubscriptionClient
 	signalingQueue   chan *SubscriptionClient
@@ -50,6 +53,31 @@ type SubscriptionClient struct {
 	runningInterval time.Duration
 	intervalTicker  *time.Ticker
 
+	// when the grant request currently being answered was received
+	grantRequested time.Time
+	// when the DelayReq currently being answered was received
+	delayReqReceived time.Time
+
+	// DelayReq liveness
+	lastDelayReq time.Time
+	paused       bool
+	reclaimed    bool
+
+	// subscriber accepts one-step Sync
+	oneStep bool
+
+	// messages are sent to a multicast group rather than a single subscriber
+	multicast bool
+
+	// PTP domain the subscription is served in
+	domain uint8
+
+	// how many messages were sent to the subscriber
+	sent uint64
+
+	// frees tenant quota held by the subscription once it's over
+	releaseQuota func()
+
 	// socket addresses
 	eclisa unix.Sockaddr
 	gclisa unix.Sockaddr
@@ -73,6 +101,7 @@ func NewSubscriptionClient(q chan *SubscriptionClient, gq chan *SubscriptionClie
 		queue:            q,
 		signalingQueue:   gq,
 		serverConfig:     sc,
+		domain:           uint8(sc.DomainNumber),
 		stop:             make(chan bool, 1),
 	}
 	s.initSync()
@@ -96,6 +125,8 @@ func (sc *SubscriptionClient) Start(ctx context.Context) {
 
 	sc.runningInterval = sc.interval
 	sc.intervalTicker = time.NewTicker(sc.runningInterval)
+	// give subscriber a chance to start sending DelayReqs
+	sc.UpdateDelayReqActivity(time.Now())
 
 	defer log.Infof(fmt.Sprintf("Subscription %s is over for %s", sc.subscriptionType, timestamp.SockaddrToIP(sc.eclisa)))
 	if sc.subscriptionType != ptp.MessageDelayReq {
@@ -103,6 +134,7 @@ func (sc *SubscriptionClient) Start(ctx context.Context) {
 	}
 	defer sc.intervalTicker.Stop()
 	defer sc.setRunning(false)
+	defer sc.release()
 
 	for {
 		select {
@@ -120,6 +152,22 @@ func (sc *SubscriptionClient) Start(ctx context.Context) {
 				sc.runningInterval = sc.interval
 				sc.intervalTicker.Reset(sc.runningInterval)
 			}
+			if sc.subscriptionType == ptp.MessageSync && !sc.live(time.Now()) {
+				if sc.serverConfig.DelayReqLivenessAction == LivenessActionPause {
+					if !sc.Paused() {
+						log.Infof("No DelayReq from %s for %d intervals, pausing %s subscription", timestamp.SockaddrToIP(sc.eclisa), sc.serverConfig.DelayReqLiveness, sc.subscriptionType)
+						sc.setPaused(true)
+					}
+					continue
+				}
+				log.Infof("No DelayReq from %s for %d intervals, cancelling %s subscription", timestamp.SockaddrToIP(sc.eclisa), sc.serverConfig.DelayReqLiveness, sc.subscriptionType)
+				sc.setReclaimed()
+				return
+			}
+			if sc.Paused() {
+				log.Infof("Got DelayReq from %s, resuming %s subscription", timestamp.SockaddrToIP(sc.eclisa), sc.subscriptionType)
+				sc.setPaused(false)
+			}
 			if sc.subscriptionType != ptp.MessageDelayResp && sc.subscriptionType != ptp.MessageDelayReq {
 				// Add myself to the worker queue
 				sc.Once()
@@ -128,6 +176,98 @@ func (sc *SubscriptionClient) Start(ctx context.Context) {
 	}
 }
 
+// UpdateDelayReqActivity atomically records when subscriber sent DelayReq last time
+func (sc *SubscriptionClient) UpdateDelayReqActivity(t time.Time) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.lastDelayReq = t
+}
+
+// live checks if subscriber has sent DelayReq recently enough to keep the subscription
+func (sc *SubscriptionClient) live(now time.Time) bool {
+	sc.Lock()
+	defer sc.Unlock()
+	if sc.serverConfig.DelayReqLiveness <= 0 {
+		return true
+	}
+	return now.Sub(sc.lastDelayReq) <= time.Duration(sc.serverConfig.DelayReqLiveness)*sc.interval
+}
+
+// setPaused atomically sets paused
+func (sc *SubscriptionClient) setPaused(paused bool) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.paused = paused
+}
+
+// Paused returns the paused bool
+func (sc *SubscriptionClient) Paused() bool {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.paused
+}
+
+// setReclaimed atomically marks subscription as cancelled due to inactivity
+func (sc *SubscriptionClient) setReclaimed() {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.reclaimed = true
+}
+
+// Reclaimed returns true if subscription was cancelled due to inactivity
+func (sc *SubscriptionClient) Reclaimed() bool {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.reclaimed
+}
+
+// SetOneStep atomically sets whether Syncs are sent one-step
+func (sc *SubscriptionClient) SetOneStep(oneStep bool) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.oneStep = oneStep
+}
+
+// OneStep returns true if Syncs are sent one-step, without Follow Up
+func (sc *SubscriptionClient) OneStep() bool {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.oneStep
+}
+
+// SetMulticast marks subscription as sending to a multicast group, so messages don't carry the unicast flag
+func (sc *SubscriptionClient) SetMulticast() {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.multicast = true
+	// multicast Sync carries the actual interval instead of 0x7f
+	sc.syncP.LogMessageInterval, _ = ptp.NewLogInterval(sc.interval)
+	sc.followupP.FlagField &^= ptp.FlagUnicast
+	sc.announceP.FlagField &^= ptp.FlagUnicast
+	sc.delayRespP.FlagField &^= ptp.FlagUnicast
+}
+
+// SetDomain makes subscription served in the domain. Must be called before the subscription is started
+func (sc *SubscriptionClient) SetDomain(domain uint8) {
+	sc.domain = domain
+	sc.syncP.DomainNumber = domain
+	sc.followupP.DomainNumber = domain
+	sc.announceP.DomainNumber = domain
+	sc.delayRespP.DomainNumber = domain
+}
+
+// Domain returns PTP domain the subscription is served in
+func (sc *SubscriptionClient) Domain() uint8 {
+	return sc.domain
+}
+
+// Multicast returns true if messages are sent to a multicast group
+func (sc *SubscriptionClient) Multicast() bool {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.multicast
+}
+
 // Once adds itself to the worker queue once
 func (sc *SubscriptionClient) Once() {
 	sc.queue <- sc
@@ -171,6 +311,20 @@ func (sc *SubscriptionClient) SetExpire(expire time.Time) {
 	sc.expire = expire
 }
 
+// Expire atomically returns expire
+func (sc *SubscriptionClient) Expire() time.Time {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.expire
+}
+
+// Interval atomically returns interval
+func (sc *SubscriptionClient) Interval() time.Duration {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.interval
+}
+
 // SetInterval atomically sets interval
 func (sc *SubscriptionClient) SetInterval(interval time.Duration) {
 	sc.Lock()
@@ -185,6 +339,53 @@ func (sc *SubscriptionClient) SetGclisa(gclisa unix.Sockaddr) {
 	sc.gclisa = gclisa
 }
 
+// setReleaseQuota atomically sets function freeing tenant quota held by the subscription
+func (sc *SubscriptionClient) setReleaseQuota(f func()) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.releaseQuota = f
+}
+
+// incSent atomically counts message sent to the subscriber
+func (sc *SubscriptionClient) incSent() {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.sent++
+}
+
+// state returns snapshot of the subscription served to the port
+func (sc *SubscriptionClient) state(port ptp.PortIdentity) SubscriptionState {
+	sc.Lock()
+	defer sc.Unlock()
+	st := SubscriptionState{
+		Address:      timestamp.SockaddrToIP(sc.eclisa).String(),
+		PortIdentity: port.String(),
+		Type:         sc.subscriptionType.String(),
+		Domain:       sc.domain,
+		IntervalSec:  sc.interval.Seconds(),
+		Expire:       sc.expire,
+		Sent:         sc.sent,
+		Paused:       sc.paused,
+		Multicast:    sc.multicast,
+	}
+	if !sc.lastDelayReq.IsZero() {
+		t := sc.lastDelayReq
+		st.LastDelayReq = &t
+	}
+	return st
+}
+
+// release frees tenant quota held by the subscription, if any
+func (sc *SubscriptionClient) release() {
+	sc.Lock()
+	f := sc.releaseQuota
+	sc.releaseQuota = nil
+	sc.Unlock()
+	if f != nil {
+		f()
+	}
+}
+
 // Running returns the running bool
 func (sc *SubscriptionClient) Running() bool {
 	sc.Lock()
@@ -219,12 +420,20 @@ func (sc *SubscriptionClient) initSync() {
 // UpdateSync updates ptp Sync packet
 func (sc *SubscriptionClient) UpdateSync() {
 	sc.syncP.SequenceID = sc.sequenceID
+	// NIC inserts TX timestamp into Sync without two-step flag
+	if sc.OneStep() {
+		sc.syncP.FlagField = ptp.FlagUnicast
+	} else {
+		sc.syncP.FlagField = ptp.FlagUnicast | ptp.FlagTwoStep
+	}
+	if sc.Multicast() {
+		sc.syncP.FlagField &^= ptp.FlagUnicast
+	}
 }
 
 // UpdateSyncDelayReq updates ptp SyncDelayReq packet
 func (sc *SubscriptionClient) UpdateSyncDelayReq(received time.Time, seq uint16) {
-	sc.syncP.SequenceID = seq
-	sc.syncP.OriginTimestamp = ptp.NewTimestamp(received)
+	sptp.SetSync(sc.syncP, seq, received)
 }
 
 // Sync returns ptp Sync packet
@@ -256,8 +465,13 @@ func (sc *SubscriptionClient) initFollowup() {
 
 // UpdateFollowup updates ptp Follow Up packet
 func (sc *SubscriptionClient) UpdateFollowup(hwts time.Time) {
+	sc.updateFollowup(hwts, sc.sequenceID)
+}
+
+// updateFollowup updates ptp Follow Up packet following Sync with the sequence ID
+func (sc *SubscriptionClient) updateFollowup(hwts time.Time, seq uint16) {
 	i, _ := ptp.NewLogInterval(sc.interval)
-	sc.followupP.SequenceID = sc.sequenceID
+	sc.followupP.SequenceID = seq
 	sc.followupP.LogMessageInterval = i
 	sc.followupP.PreciseOriginTimestamp = ptp.NewTimestamp(hwts)
 }
@@ -306,22 +520,43 @@ func (sc *SubscriptionClient) UpdateAnnounce() {
 	sc.announceP.SequenceID = sc.sequenceID
 	sc.announceP.LogMessageInterval = i
 	sc.announceP.CurrentUTCOffset = int16(sc.serverConfig.UTCOffset.Seconds())
-	sc.announceP.GrandmasterClockQuality.ClockClass = sc.serverConfig.ClockClass
-	sc.announceP.GrandmasterClockQuality.ClockAccuracy = sc.serverConfig.ClockAccuracy
+	sc.announceP.FlagField = sc.announceP.FlagField&^leapFlagsMask | sc.serverConfig.leapFlags()
+	sc.updateAnnounceQuality()
+	sc.updateAnnounceTLVs()
+}
+
+// updateAnnounceQuality updates clock quality and priorities of the domain in ptp Announce packet.
+// Domain which is no longer served gets the ones of DomainNumber until subscription expires
+func (sc *SubscriptionClient) updateAnnounceQuality() {
+	d, ok := sc.serverConfig.Domain(sc.domain)
+	if !ok {
+		d, _ = sc.serverConfig.Domain(uint8(sc.serverConfig.DomainNumber))
+	}
+	sc.announceP.GrandmasterPriority1 = d.Priority1
+	sc.announceP.GrandmasterPriority2 = d.Priority2
+	sc.announceP.GrandmasterClockQuality.ClockClass = d.ClockClass
+	sc.announceP.GrandmasterClockQuality.ClockAccuracy = d.ClockAccuracy
 }
 
 // UpdateAnnounceDelayReq updates ptp Announce Delay Req payload
 func (sc *SubscriptionClient) UpdateAnnounceDelayReq(cf ptp.Correction, seq uint16) {
-	sc.announceP.SequenceID = seq
+	sptp.SetAnnounce(sc.announceP, seq, cf)
 	sc.announceP.CurrentUTCOffset = int16(sc.serverConfig.UTCOffset.Seconds())
-	sc.announceP.GrandmasterClockQuality.ClockClass = sc.serverConfig.ClockClass
-	sc.announceP.GrandmasterClockQuality.ClockAccuracy = sc.serverConfig.ClockAccuracy
-	sc.announceP.CorrectionField = cf
+	sc.announceP.FlagField = sc.announceP.FlagField&^leapFlagsMask | sc.serverConfig.leapFlags()
+	sc.updateAnnounceQuality()
+	sc.updateAnnounceTLVs()
+}
+
+// updateAnnounceTLVs appends configured ALTERNATE_TIME_OFFSET_INDICATOR TLVs to ptp Announce packet
+func (sc *SubscriptionClient) updateAnnounceTLVs() {
+	tlvs, length := sc.serverConfig.alternateTimeOffsetTLVs(time.Now())
+	sc.announceP.TLVs = tlvs
+	sc.announceP.MessageLength = uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.AnnounceBody{}) + length)
 }
 
 // UpdateAnnounceFollowUp updates ptp Announce Follow Up payload
 func (sc *SubscriptionClient) UpdateAnnounceFollowUp(transmitted time.Time) {
-	sc.announceP.OriginTimestamp = ptp.NewTimestamp(transmitted)
+	sptp.SetAnnounceOrigin(sc.announceP, transmitted)
 }
 
 // Announce returns ptp Announce packet
@@ -424,11 +659,40 @@ func (sc *SubscriptionClient) Signaling() *ptp.Signaling {
 }
 
 // sendSignalingGrant sends a Unicast Grant message
-func (sc *SubscriptionClient) sendSignalingGrant(sg *ptp.Signaling, mt ptp.UnicastMsgTypeAndFlags, interval ptp.LogInterval, duration uint32) {
+func (sc *SubscriptionClient) sendSignalingGrant(sg *ptp.Signaling, mt ptp.UnicastMsgTypeAndFlags, interval ptp.LogInterval, duration uint32, requested time.Time) {
 	sc.UpdateSignalingGrant(sg, mt, interval, duration)
+	sc.setGrantRequested(requested)
 	sc.OnceSignaling()
 }
 
+// setGrantRequested atomically sets when the grant request was received
+func (sc *SubscriptionClient) setGrantRequested(requested time.Time) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.grantRequested = requested
+}
+
+// GrantRequested atomically gets when the grant request was received
+func (sc *SubscriptionClient) GrantRequested() time.Time {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.grantRequested
+}
+
+// SetDelayReqReceived atomically sets when the DelayReq being answered was received
+func (sc *SubscriptionClient) SetDelayReqReceived(received time.Time) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.delayReqReceived = received
+}
+
+// DelayReqReceived atomically gets when the DelayReq being answered was received
+func (sc *SubscriptionClient) DelayReqReceived() time.Time {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.delayReqReceived
+}
+
 // sendSignalingCancel sends a Unicast Cancel message
 func (sc *SubscriptionClient) sendSignalingCancel() {
 	sc.UpdateSignalingCancel()
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/protocol/sptp"
 	"github.com/facebook/time/timestamp"
 
 	"github.com/stretchr/testify/require"
@@ -135,6 +136,71 @@ func TestSubscriptionEnd(t *testing.T) {
 	require.False(t, sc.Running())
 }
 
+func TestSubscriptionLive(t *testing.T) {
+	c := &Config{}
+	sc := &SubscriptionClient{interval: time.Second, serverConfig: c}
+	now := time.Now()
+	sc.UpdateDelayReqActivity(now.Add(-time.Minute))
+	// disabled by default
+	require.True(t, sc.live(now))
+
+	c.DelayReqLiveness = 3
+	require.False(t, sc.live(now))
+	sc.UpdateDelayReqActivity(now.Add(-3 * time.Second))
+	require.True(t, sc.live(now))
+}
+
+func TestSubscriptionLivenessCancel(t *testing.T) {
+	w := &sendWorker{
+		queue:          make(chan *SubscriptionClient, 100),
+		signalingQueue: make(chan *SubscriptionClient, 100),
+	}
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234), DynamicConfig: DynamicConfig{DelayReqLiveness: 2}}
+	interval := 10 * time.Millisecond
+	expire := time.Now().Add(time.Minute)
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, interval, expire)
+
+	go sc.Start(context.Background())
+	time.Sleep(100 * time.Millisecond)
+	require.False(t, sc.Running())
+	require.True(t, sc.Reclaimed())
+	// cancellation is sent to the subscriber
+	require.Equal(t, 1, len(w.signalingQueue))
+}
+
+func TestSubscriptionLivenessPause(t *testing.T) {
+	w := &sendWorker{
+		queue:          make(chan *SubscriptionClient, 100),
+		signalingQueue: make(chan *SubscriptionClient, 100),
+	}
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234), DynamicConfig: DynamicConfig{DelayReqLiveness: 10, DelayReqLivenessAction: LivenessActionPause}}
+	interval := 10 * time.Millisecond
+	expire := time.Now().Add(time.Minute)
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, interval, expire)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sc.Start(ctx)
+	time.Sleep(200 * time.Millisecond)
+	require.True(t, sc.Running())
+	require.True(t, sc.Paused())
+	require.False(t, sc.Reclaimed())
+
+	// no Syncs are sent while paused
+	for len(w.queue) > 0 {
+		<-w.queue
+	}
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 0, len(w.queue))
+
+	sc.UpdateDelayReqActivity(time.Now())
+	time.Sleep(30 * time.Millisecond)
+	require.False(t, sc.Paused())
+	require.Less(t, 0, len(w.queue))
+}
+
 func TestSubscriptionflags(t *testing.T) {
 	w := &sendWorker{}
 	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
@@ -149,6 +215,85 @@ func TestSubscriptionflags(t *testing.T) {
 	require.Equal(t, ptp.FlagUnicast|ptp.FlagPTPTimescale, sc.Announce().Header.FlagField)
 }
 
+func TestSubscriptionOneStepFlags(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Time{})
+	require.False(t, sc.OneStep())
+
+	sc.SetOneStep(true)
+	require.True(t, sc.OneStep())
+	sc.UpdateSync()
+	require.Equal(t, ptp.FlagUnicast, sc.Sync().Header.FlagField)
+
+	sc.SetOneStep(false)
+	sc.UpdateSync()
+	require.Equal(t, ptp.FlagUnicast|ptp.FlagTwoStep, sc.Sync().Header.FlagField)
+}
+
+func TestSubscriptionDomain(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{DomainNumber: 4},
+		DynamicConfig: DynamicConfig{
+			ClockClass:    ptp.ClockClass6,
+			ClockAccuracy: ptp.ClockAccuracyNanosecond100,
+			Domains:       []DomainConfig{{Domain: 24, ClockClass: ptp.ClockClass52, ClockAccuracy: ptp.ClockAccuracyMicrosecond1, Priority1: 200}},
+		},
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+	require.Equal(t, uint8(4), sc.Domain())
+	sc.UpdateAnnounce()
+	require.Equal(t, uint8(4), sc.Announce().Header.DomainNumber)
+	require.Equal(t, ptp.ClockClass6, sc.Announce().GrandmasterClockQuality.ClockClass)
+	require.Equal(t, ptp.ClockAccuracyNanosecond100, sc.Announce().GrandmasterClockQuality.ClockAccuracy)
+	require.Equal(t, uint8(128), sc.Announce().GrandmasterPriority1)
+
+	sc.SetDomain(24)
+	require.Equal(t, uint8(24), sc.Domain())
+	require.Equal(t, uint8(24), sc.Sync().Header.DomainNumber)
+	require.Equal(t, uint8(24), sc.Followup().Header.DomainNumber)
+	require.Equal(t, uint8(24), sc.DelayResp().Header.DomainNumber)
+	sc.UpdateAnnounceDelayReq(0, 1)
+	require.Equal(t, uint8(24), sc.Announce().Header.DomainNumber)
+	require.Equal(t, ptp.ClockClass52, sc.Announce().GrandmasterClockQuality.ClockClass)
+	require.Equal(t, ptp.ClockAccuracyMicrosecond1, sc.Announce().GrandmasterClockQuality.ClockAccuracy)
+	require.Equal(t, uint8(200), sc.Announce().GrandmasterPriority1)
+	require.Equal(t, uint8(128), sc.Announce().GrandmasterPriority2)
+
+	// domain removed on reload announces quality of the main one
+	c.Domains = nil
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.ClockClass6, sc.Announce().GrandmasterClockQuality.ClockClass)
+	require.Equal(t, uint8(128), sc.Announce().GrandmasterPriority1)
+}
+
+func TestSubscriptionMulticastFlags(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	sa := timestamp.IPToSockaddr(net.ParseIP("224.0.1.129"), ptp.PortEvent)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, 250*time.Millisecond, time.Time{})
+	require.False(t, sc.Multicast())
+
+	sc.SetMulticast()
+	require.True(t, sc.Multicast())
+	sc.UpdateSync()
+	sc.UpdateFollowup(time.Now())
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.FlagTwoStep, sc.Sync().Header.FlagField)
+	require.Equal(t, ptp.LogInterval(-2), sc.Sync().Header.LogMessageInterval)
+	require.Equal(t, uint16(0), sc.Followup().Header.FlagField)
+	require.Equal(t, ptp.FlagPTPTimescale, sc.Announce().Header.FlagField)
+	require.Equal(t, uint16(0), sc.DelayResp().Header.FlagField)
+
+	sc.SetOneStep(true)
+	sc.UpdateSync()
+	require.Equal(t, uint16(0), sc.Sync().Header.FlagField)
+}
+
 func TestSyncPacket(t *testing.T) {
 	sequenceID := uint16(42)
 	domainNumber := uint8(13)
@@ -319,6 +464,55 @@ func TestAnnounceDelayReqPacket(t *testing.T) {
 	require.Equal(t, transmit, sc.Announce().AnnounceBody.OriginTimestamp)
 }
 
+func TestSPTPInterop(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		DynamicConfig: DynamicConfig{
+			ClockClass:    ptp.ClockClass6,
+			ClockAccuracy: ptp.ClockAccuracyNanosecond100,
+			UTCOffset:     37 * time.Second,
+		},
+		StaticConfig: StaticConfig{
+			DomainNumber: 13,
+		},
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageDelayReq, c, time.Second, time.Time{})
+	sc.initSync()
+	sc.initAnnounce()
+
+	req := sptp.NewDelayReq(ptp.PortIdentity{PortNumber: 1, ClockIdentity: 42}, 13, 7)
+	req.CorrectionField = ptp.NewCorrection(1500)
+	received := time.Unix(1653574589, 806552)
+	transmitted := received.Add(20 * time.Microsecond)
+
+	sc.UpdateSyncDelayReq(received, req.SequenceID)
+	sc.UpdateAnnounceDelayReq(req.CorrectionField, req.SequenceID)
+	sc.UpdateAnnounceFollowUp(transmitted)
+
+	// reference server of the SPTP package answers the same way
+	ref := &sptp.Server{
+		Port:          sc.Sync().SourcePortIdentity,
+		AnnounceFlags: sc.Announce().FlagField &^ ptp.FlagUnicast,
+		Announce:      sc.Announce().AnnounceBody,
+	}
+	resp, err := ref.Respond(req, received)
+	require.NoError(t, err)
+	sync, err := resp.Sync()
+	require.NoError(t, err)
+	require.NoError(t, resp.Sent(transmitted))
+	announce, err := resp.Announce()
+	require.NoError(t, err)
+
+	for _, pair := range [][2]ptp.Packet{{sync, sc.Sync()}, {announce, sc.Announce()}} {
+		want, err := ptp.Bytes(pair[0])
+		require.NoError(t, err)
+		got, err := ptp.Bytes(pair[1])
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+}
+
 func TestDelayRespPacket(t *testing.T) {
 	sequenceID := uint16(42)
 	now := time.Now()
@@ -423,8 +617,10 @@ func TestSendSignalingGrant(t *testing.T) {
 	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
 
 	require.Equal(t, 0, len(w.signalingQueue))
-	sc.sendSignalingGrant(&ptp.Signaling{}, 0, 0, 0)
+	requested := time.Now()
+	sc.sendSignalingGrant(&ptp.Signaling{}, 0, 0, 0, requested)
 	require.Equal(t, 1, len(w.signalingQueue))
+	require.Equal(t, requested, sc.GrantRequested())
 
 	s := <-w.signalingQueue
 	require.Equal(t, ptp.TLVGrantUnicastTransmission, s.signaling.TLVs[0].(*ptp.GrantUnicastTransmissionTLV).TLVHead.TLVType)
@@ -0,0 +1,198 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+)
+
+// TenantConfig describes a tenant: a group of subscribers sharing a slice of the serving capacity
+type TenantConfig struct {
+	// Name of the tenant, used in stats
+	Name string `yaml:"name"`
+	// Prefixes is a list of IPs or subnets of subscribers belonging to the tenant
+	Prefixes []string `yaml:"prefixes"`
+	// MaxSubscriptions is how many subscriptions the tenant may hold at once. 0 - unlimited
+	MaxSubscriptions int `yaml:"maxsubscriptions,omitempty"`
+	// MaxPacketRate is how many packets per second all unicast grants of the tenant may add up to. 0 - unlimited
+	MaxPacketRate float64 `yaml:"maxpacketrate,omitempty"`
+}
+
+// TenantsSanity checks if tenants have unique names, valid prefixes and sane quotas
+func (dc *DynamicConfig) TenantsSanity() error {
+	names := map[string]bool{}
+	for _, t := range dc.Tenants {
+		if t.Name == "" {
+			return fmt.Errorf("tenant must have a name")
+		}
+		if names[t.Name] {
+			return fmt.Errorf("duplicate tenant %q", t.Name)
+		}
+		names[t.Name] = true
+		if t.MaxSubscriptions < 0 || t.MaxPacketRate < 0 {
+			return fmt.Errorf("quotas of tenant %q must be 0 or positive", t.Name)
+		}
+		for _, p := range t.Prefixes {
+			if _, err := parseClientPrefix(p); err != nil {
+				return fmt.Errorf("invalid prefix of tenant %q: %w", t.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Tenant returns tenant the subscriber belongs to, the one with the longest matching prefix, or nil if none
+func (dc *DynamicConfig) Tenant(ip net.IP) *TenantConfig {
+	var best *TenantConfig
+	bestLen := -1
+	for i, t := range dc.Tenants {
+		for _, p := range t.Prefixes {
+			n, err := parseClientPrefix(p)
+			if err != nil || !n.Contains(ip) {
+				continue
+			}
+			if l, _ := n.Mask.Size(); l > bestLen {
+				best = &dc.Tenants[i]
+				bestLen = l
+			}
+		}
+	}
+	return best
+}
+
+// packetRate returns how many packets per second subscription of type st sends
+func packetRate(st ptp.MessageType, interval time.Duration, oneStep bool) float64 {
+	if interval <= 0 {
+		return 0
+	}
+	rate := float64(time.Second) / float64(interval)
+	// two-step Sync is followed by Follow_Up
+	if st == ptp.MessageSync && !oneStep {
+		rate *= 2
+	}
+	return rate
+}
+
+// tenantQuotas keeps track of subscriptions held by each tenant and their packet rates
+type tenantQuotas struct {
+	sync.Mutex
+	// tenant name -> subscription -> packet rate
+	usage map[string]map[*SubscriptionClient]float64
+	// subscription -> tenant name
+	owners map[*SubscriptionClient]string
+}
+
+func newTenantQuotas() *tenantQuotas {
+	return &tenantQuotas{
+		usage:  map[string]map[*SubscriptionClient]float64{},
+		owners: map[*SubscriptionClient]string{},
+	}
+}
+
+// fits checks if the tenant can hold subscription sc sending rate packets per second, without accounting it
+func (q *tenantQuotas) fits(t *TenantConfig, sc *SubscriptionClient, rate float64) bool {
+	q.Lock()
+	defer q.Unlock()
+	return q.fitsLocked(t, sc, rate)
+}
+
+// fitsLocked is fits for callers holding the lock. Renewing subscription only has its rate replaced
+func (q *tenantQuotas) fitsLocked(t *TenantConfig, sc *SubscriptionClient, rate float64) bool {
+	subs := q.usage[t.Name]
+	prev, held := subs[sc]
+	count, total := len(subs), rate-prev
+	for _, r := range subs {
+		total += r
+	}
+	if !held {
+		count++
+	}
+	if t.MaxSubscriptions > 0 && count > t.MaxSubscriptions {
+		return false
+	}
+	if t.MaxPacketRate > 0 && total > t.MaxPacketRate {
+		return false
+	}
+	return true
+}
+
+// admit checks if the tenant can hold subscription sc sending rate packets per second and accounts it if so.
+// Renewing subscription only has its rate replaced
+func (q *tenantQuotas) admit(t *TenantConfig, sc *SubscriptionClient, rate float64) bool {
+	q.Lock()
+	defer q.Unlock()
+	if !q.fitsLocked(t, sc, rate) {
+		return false
+	}
+	subs := q.usage[t.Name]
+	if subs == nil {
+		subs = map[*SubscriptionClient]float64{}
+		q.usage[t.Name] = subs
+	}
+	// subscriber may have moved to another tenant after config reload
+	if owner, found := q.owners[sc]; found && owner != t.Name {
+		q.forget(owner, sc)
+	}
+	subs[sc] = rate
+	q.owners[sc] = t.Name
+	return true
+}
+
+// release frees the quota held by subscription sc
+func (q *tenantQuotas) release(sc *SubscriptionClient) {
+	q.Lock()
+	defer q.Unlock()
+	if owner, found := q.owners[sc]; found {
+		q.forget(owner, sc)
+		delete(q.owners, sc)
+	}
+}
+
+// forget removes subscription from usage of the owner, dropping owners which hold nothing,
+// as there are as many of them as subscribers when quotas are per subscriber
+func (q *tenantQuotas) forget(owner string, sc *SubscriptionClient) {
+	delete(q.usage[owner], sc)
+	if len(q.usage[owner]) == 0 {
+		delete(q.usage, owner)
+	}
+}
+
+// used returns how many subscriptions the tenant holds and their total packet rate
+func (q *tenantQuotas) used(name string) (int, float64) {
+	q.Lock()
+	defer q.Unlock()
+	var total float64
+	for _, r := range q.usage[name] {
+		total += r
+	}
+	return len(q.usage[name]), total
+}
+
+// report exports usage of every configured tenant
+func (q *tenantQuotas) report(tenants []TenantConfig, st stats.Stats) {
+	for _, t := range tenants {
+		subs, rate := q.used(t.Name)
+		st.SetTenantSubscriptions(t.Name, int64(subs))
+		st.SetTenantPacketRate(t.Name, int64(rate))
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantsSanity(t *testing.T) {
+	dc := &DynamicConfig{}
+	require.NoError(t, dc.TenantsSanity())
+	dc.Tenants = []TenantConfig{
+		{Name: "a", Prefixes: []string{"10.0.0.0/8", "2401:db00::/32"}, MaxSubscriptions: 10, MaxPacketRate: 100},
+		{Name: "b", Prefixes: []string{"192.168.0.1"}},
+	}
+	require.NoError(t, dc.TenantsSanity())
+
+	dc.Tenants = []TenantConfig{{Prefixes: []string{"10.0.0.0/8"}}}
+	require.EqualError(t, dc.TenantsSanity(), "tenant must have a name")
+	dc.Tenants = []TenantConfig{{Name: "a"}, {Name: "a"}}
+	require.EqualError(t, dc.TenantsSanity(), `duplicate tenant "a"`)
+	dc.Tenants = []TenantConfig{{Name: "a", MaxPacketRate: -1}}
+	require.EqualError(t, dc.TenantsSanity(), `quotas of tenant "a" must be 0 or positive`)
+	dc.Tenants = []TenantConfig{{Name: "a", Prefixes: []string{"nope"}}}
+	require.EqualError(t, dc.TenantsSanity(), `invalid prefix of tenant "a": invalid IP address "nope"`)
+}
+
+func TestDynamicConfigTenant(t *testing.T) {
+	dc := &DynamicConfig{
+		Tenants: []TenantConfig{
+			{Name: "wide", Prefixes: []string{"10.0.0.0/8"}},
+			{Name: "narrow", Prefixes: []string{"10.1.0.0/16", "2401:db00::/32"}},
+		},
+	}
+	require.Equal(t, "wide", dc.Tenant(net.ParseIP("10.2.0.1")).Name)
+	require.Equal(t, "narrow", dc.Tenant(net.ParseIP("10.1.0.1")).Name)
+	require.Equal(t, "narrow", dc.Tenant(net.ParseIP("2401:db00::1")).Name)
+	require.Nil(t, dc.Tenant(net.ParseIP("192.168.0.1")))
+}
+
+func TestPacketRate(t *testing.T) {
+	require.Equal(t, 2.0, packetRate(ptp.MessageAnnounce, 500*time.Millisecond, false))
+	require.Equal(t, 4.0, packetRate(ptp.MessageSync, 500*time.Millisecond, false))
+	require.Equal(t, 2.0, packetRate(ptp.MessageSync, 500*time.Millisecond, true))
+	require.Equal(t, 0.0, packetRate(ptp.MessageSync, 0, false))
+}
+
+func TestTenantQuotas(t *testing.T) {
+	q := newTenantQuotas()
+	tenant := &TenantConfig{Name: "a", MaxSubscriptions: 2, MaxPacketRate: 10}
+	sc1 := &SubscriptionClient{}
+	sc2 := &SubscriptionClient{}
+	sc3 := &SubscriptionClient{}
+
+	require.True(t, q.admit(tenant, sc1, 4))
+	require.True(t, q.admit(tenant, sc2, 4))
+	// over subscription count
+	require.False(t, q.admit(tenant, sc3, 1))
+	// renewal at higher rate, over packet rate
+	require.False(t, q.admit(tenant, sc2, 8))
+	// renewal at the rate which fits
+	require.True(t, q.admit(tenant, sc2, 6))
+	subs, rate := q.used("a")
+	require.Equal(t, 2, subs)
+	require.Equal(t, 10.0, rate)
+
+	q.release(sc1)
+	require.True(t, q.admit(tenant, sc3, 4))
+	subs, rate = q.used("a")
+	require.Equal(t, 2, subs)
+	require.Equal(t, 10.0, rate)
+
+	// subscriber moved to another tenant
+	other := &TenantConfig{Name: "b"}
+	require.True(t, q.admit(other, sc3, 4))
+	subs, _ = q.used("a")
+	require.Equal(t, 1, subs)
+	subs, _ = q.used("b")
+	require.Equal(t, 1, subs)
+
+	// releasing twice is fine
+	q.release(sc3)
+	q.release(sc3)
+	subs, _ = q.used("b")
+	require.Equal(t, 0, subs)
+}
+
+func TestServerAdmitTenant(t *testing.T) {
+	c := &Config{DynamicConfig: DynamicConfig{Tenants: []TenantConfig{{Name: "a", Prefixes: []string{"10.0.0.0/8"}, MaxSubscriptions: 1}}}}
+	s := Server{Config: c, Stats: stats.NewJSONStats(), quotas: newTenantQuotas(), clientQuotas: newTenantQuotas(), globalQuotas: newTenantQuotas()}
+	sc1 := &SubscriptionClient{subscriptionType: ptp.MessageSync}
+	sc2 := &SubscriptionClient{subscriptionType: ptp.MessageSync}
+
+	// no tenant, no limits
+	require.True(t, s.admit(net.ParseIP("192.168.0.1"), sc2, 100))
+
+	require.True(t, s.admit(net.ParseIP("10.0.0.1"), sc1, 1))
+	require.False(t, s.admit(net.ParseIP("10.0.0.2"), sc2, 1))
+
+	// quota is freed once the subscription is over
+	sc1.release()
+	require.True(t, s.admit(net.ParseIP("10.0.0.2"), sc2, 1))
+}
@@ -0,0 +1,135 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// turnaroundSubBits is log2 of how many buckets each power of two is split into, so quantiles are off by at most 1/8
+const turnaroundSubBits = 3
+
+// turnaroundBuckets covers any positive int64 duration
+const turnaroundBuckets = (64 - turnaroundSubBits) << turnaroundSubBits
+
+// turnaroundHistogram is a lock-free histogram of DelayReq turnaround:
+// time from receiving a DelayReq till the reply carrying its RX timestamp is sent
+type turnaroundHistogram struct {
+	buckets [turnaroundBuckets]uint64
+	count   uint64
+	max     int64
+}
+
+// turnaroundBucket returns bucket of duration d
+func turnaroundBucket(d time.Duration) int {
+	v := uint64(d)
+	if d <= 0 {
+		v = 0
+	}
+	if v < 1<<turnaroundSubBits {
+		return int(v)
+	}
+	shift := bits.Len64(v) - 1 - turnaroundSubBits
+	return (shift+1)<<turnaroundSubBits + int(v>>shift) - 1<<turnaroundSubBits
+}
+
+// turnaroundBucketMax returns the longest duration which falls into bucket i
+func turnaroundBucketMax(i int) time.Duration {
+	if i < 1<<turnaroundSubBits {
+		return time.Duration(i)
+	}
+	shift := i>>turnaroundSubBits - 1
+	m := uint64(i&(1<<turnaroundSubBits-1) + 1<<turnaroundSubBits)
+	return time.Duration((m+1)<<shift - 1)
+}
+
+// observe records turnaround d
+func (h *turnaroundHistogram) observe(d time.Duration) {
+	atomic.AddUint64(&h.buckets[turnaroundBucket(d)], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomicMax(&h.max, int64(d))
+}
+
+// take moves everything recorded so far to dst, leaving h empty
+func (h *turnaroundHistogram) take(dst *turnaroundHistogram) {
+	for i := range h.buckets {
+		if n := atomic.SwapUint64(&h.buckets[i], 0); n > 0 {
+			dst.buckets[i] += n
+			dst.count += n
+		}
+	}
+	atomic.StoreUint64(&h.count, 0)
+	if m := atomic.SwapInt64(&h.max, 0); m > dst.max {
+		dst.max = m
+	}
+}
+
+// merge adds everything recorded in o, which mustn't be updated concurrently
+func (h *turnaroundHistogram) merge(o *turnaroundHistogram) {
+	for i, n := range o.buckets {
+		h.buckets[i] += n
+	}
+	h.count += o.count
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// quantile returns upper bound of the q quantile, never above the max recorded. 0 if nothing is recorded
+func (h *turnaroundHistogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range h.buckets {
+		seen += n
+		if seen < rank {
+			continue
+		}
+		if b := turnaroundBucketMax(i); b < time.Duration(h.max) {
+			return b
+		}
+		break
+	}
+	return time.Duration(h.max)
+}
+
+// observeTurnaround records DelayReq turnaround of the subscription, if it was answering one
+func (s *sendWorker) observeTurnaround(c *SubscriptionClient) {
+	if received := c.DelayReqReceived(); !received.IsZero() {
+		s.turnaround.observe(time.Since(received))
+	}
+}
+
+// reportTurnaround exports DelayReq turnaround p50, p99 and max since the last report, per worker and overall
+func (s *Server) reportTurnaround() {
+	total := &turnaroundHistogram{}
+	for _, w := range s.sw {
+		h := &turnaroundHistogram{}
+		w.turnaround.take(h)
+		s.Stats.SetWorkerTurnaround(w.id, h.quantile(0.5).Nanoseconds(), h.quantile(0.99).Nanoseconds(), h.max)
+		total.merge(h)
+	}
+	s.Stats.SetTurnaround(total.quantile(0.5).Nanoseconds(), total.quantile(0.99).Nanoseconds(), total.max)
+}
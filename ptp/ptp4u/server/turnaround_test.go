@@ -0,0 +1,134 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTurnaroundBucket(t *testing.T) {
+	for _, d := range []time.Duration{0, 1, 7, 8, 15, 16, 17, 100, time.Microsecond, 12345 * time.Microsecond, time.Second, math.MaxInt64} {
+		i := turnaroundBucket(d)
+		require.Less(t, i, turnaroundBuckets)
+		require.GreaterOrEqual(t, turnaroundBucketMax(i), d, "bucket %d of %v", i, d)
+		if i > 0 {
+			require.Less(t, turnaroundBucketMax(i-1), d, "bucket %d of %v", i, d)
+		}
+	}
+	require.Equal(t, 0, turnaroundBucket(-time.Second))
+	// bucket is at most 1/8 wide
+	i := turnaroundBucket(time.Millisecond)
+	require.LessOrEqual(t, turnaroundBucketMax(i)-turnaroundBucketMax(i-1), time.Millisecond/8)
+}
+
+func TestTurnaroundHistogramQuantile(t *testing.T) {
+	h := &turnaroundHistogram{}
+	require.Equal(t, time.Duration(0), h.quantile(0.5))
+
+	for i := 1; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Microsecond)
+	}
+	p50 := h.quantile(0.5)
+	require.GreaterOrEqual(t, p50, 50*time.Microsecond)
+	require.LessOrEqual(t, p50, 57*time.Microsecond)
+	p99 := h.quantile(0.99)
+	require.GreaterOrEqual(t, p99, 99*time.Microsecond)
+	require.LessOrEqual(t, p99, 100*time.Microsecond)
+	// never above max
+	require.Equal(t, 100*time.Microsecond, h.quantile(1))
+	require.Equal(t, int64(100*time.Microsecond), h.max)
+}
+
+func TestTurnaroundHistogramTakeMerge(t *testing.T) {
+	a := &turnaroundHistogram{}
+	a.observe(time.Millisecond)
+	a.observe(3 * time.Millisecond)
+	b := &turnaroundHistogram{}
+	b.observe(2 * time.Millisecond)
+
+	ha := &turnaroundHistogram{}
+	a.take(ha)
+	require.Equal(t, uint64(2), ha.count)
+	require.Equal(t, int64(3*time.Millisecond), ha.max)
+	require.Equal(t, uint64(0), a.count)
+	require.Equal(t, int64(0), a.max)
+	require.Equal(t, time.Duration(0), a.quantile(0.5))
+
+	hb := &turnaroundHistogram{}
+	b.take(hb)
+	ha.merge(hb)
+	require.Equal(t, uint64(3), ha.count)
+	require.Equal(t, int64(3*time.Millisecond), ha.max)
+	require.Equal(t, 2*time.Millisecond, ha.quantile(0.5).Truncate(time.Millisecond))
+}
+
+func TestSendWorkerObserveTurnaround(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{QueueSize: 10}}
+	w := newSendWorker(0, c, nil)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, nil, nil, ptp.MessageDelayResp, c, time.Second, time.Now().Add(time.Minute))
+
+	// nothing to answer
+	w.observeTurnaround(sc)
+	require.Equal(t, uint64(0), w.turnaround.count)
+
+	sc.SetDelayReqReceived(time.Now().Add(-time.Millisecond))
+	w.observeTurnaround(sc)
+	require.Equal(t, uint64(1), w.turnaround.count)
+	require.GreaterOrEqual(t, w.turnaround.max, int64(time.Millisecond))
+}
+
+// turnaroundStats records reported turnaround, rest of stats.Stats is not used
+type turnaroundStats struct {
+	stats.Stats
+	workers map[int][3]int64
+	total   [3]int64
+}
+
+func (s *turnaroundStats) SetWorkerTurnaround(workerid int, p50, p99, max int64) {
+	s.workers[workerid] = [3]int64{p50, p99, max}
+}
+
+func (s *turnaroundStats) SetTurnaround(p50, p99, max int64) {
+	s.total = [3]int64{p50, p99, max}
+}
+
+func TestReportTurnaround(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{QueueSize: 10}}
+	st := &turnaroundStats{workers: map[int][3]int64{}}
+	s := &Server{Config: c, Stats: st}
+	s.sw = []*sendWorker{newSendWorker(0, c, st), newSendWorker(1, c, st)}
+	s.sw[0].turnaround.observe(100 * time.Microsecond)
+	for i := 0; i < 3; i++ {
+		s.sw[1].turnaround.observe(time.Millisecond)
+	}
+
+	s.reportTurnaround()
+	require.Equal(t, [3]int64{int64(100 * time.Microsecond), int64(100 * time.Microsecond), int64(100 * time.Microsecond)}, st.workers[0])
+	require.Equal(t, [3]int64{int64(time.Millisecond), int64(time.Millisecond), int64(time.Millisecond)}, st.workers[1])
+	require.Equal(t, [3]int64{int64(time.Millisecond), int64(time.Millisecond), int64(time.Millisecond)}, st.total)
+
+	// every report covers turnaround since the previous one
+	s.reportTurnaround()
+	require.Equal(t, [3]int64{}, st.workers[1])
+	require.Equal(t, [3]int64{}, st.total)
+}
@@ -0,0 +1,311 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// txtsBatchSize is how many TX timestamps are read with a single syscall
+const txtsBatchSize = 64
+
+// txtsPollInterval is how long to wait for TX timestamps before checking for timed out ones
+const txtsPollInterval = 10 * time.Millisecond
+
+// syncSize is the size of Sync as sent by ptp4u: without any TLVs, with two zero bytes ptp.BytesTo appends
+var syncSize = binary.Size(ptp.SyncDelayReq{}) + 2
+
+// sizes of headers preceding Sync in the looped back packet, IP ones without options or extension headers
+const (
+	udpHeaderSize  = 8
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+)
+
+// seqOffset is where sequence ID is in PTP header
+const seqOffset = 30
+
+// pendingTXTS is a Sync waiting for its TX timestamp to send the message following it
+type pendingTXTS struct {
+	c *SubscriptionClient
+	// Sync as sent, packet looped back by kernel ends with it
+	packet []byte
+	key    txtsKey
+	seq    uint16
+	sent   time.Time
+	// done is set once Sync is matched or removed, it stays in the send order until expired
+	done bool
+}
+
+// txtsKey identifies Sync by its sequence ID and destination address and port.
+// IPv4 addresses are stored IPv4-mapped
+type txtsKey struct {
+	seq  uint16
+	port uint16
+	ip   [net.IPv6len]byte
+}
+
+// sockaddrKey returns the key of Sync with the sequence ID sent to sa
+func sockaddrKey(sa unix.Sockaddr, seq uint16) txtsKey {
+	k := txtsKey{seq: seq}
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		k.port = uint16(sa.Port)
+		copy(k.ip[:], net.IPv4(sa.Addr[0], sa.Addr[1], sa.Addr[2], sa.Addr[3]))
+	case *unix.SockaddrInet6:
+		k.port = uint16(sa.Port)
+		k.ip = sa.Addr
+	}
+	return k
+}
+
+// loopedKeys returns the keys the looped back Sync may have: one assuming IPv4 header in front of UDP header and one assuming IPv6 header.
+// Destination address is the end of either, directly preceding UDP header
+func loopedKeys(looped []byte) (v4 txtsKey, v4ok bool, v6 txtsKey, v6ok bool) {
+	payload := len(looped) - syncSize
+	udp := payload - udpHeaderSize
+	if udp < 0 || int(binary.BigEndian.Uint16(looped[udp+4:])) != udpHeaderSize+syncSize {
+		return v4, false, v6, false
+	}
+	seq := binary.BigEndian.Uint16(looped[payload+seqOffset:])
+	port := binary.BigEndian.Uint16(looped[udp+2:])
+	if ip := udp - ipv4HeaderSize; ip >= 0 && looped[ip] == 0x45 {
+		v4 = txtsKey{seq: seq, port: port}
+		copy(v4.ip[:], net.IPv4(looped[udp-4], looped[udp-3], looped[udp-2], looped[udp-1]))
+		v4ok = true
+	}
+	if ip := udp - ipv6HeaderSize; ip >= 0 && looped[ip]>>4 == 6 {
+		v6 = txtsKey{seq: seq, port: port}
+		copy(v6.ip[:], looped[udp-net.IPv6len:udp])
+		v6ok = true
+	}
+	return v4, v4ok, v6, v6ok
+}
+
+// txtsQueue keeps Syncs sent from a socket which wait for TX timestamps, indexed by their keys and in the order they were sent
+type txtsQueue struct {
+	sync.Mutex
+	pending []*pendingTXTS
+	byKey   map[txtsKey][]*pendingTXTS
+}
+
+// add registers Sync about to be sent
+func (q *txtsQueue) add(c *SubscriptionClient, packet []byte) *pendingTXTS {
+	seq := c.Sync().SequenceID
+	p := &pendingTXTS{
+		c:      c,
+		packet: append([]byte(nil), packet...),
+		key:    sockaddrKey(c.eclisa, seq),
+		seq:    seq,
+		sent:   time.Now(),
+	}
+	q.Lock()
+	defer q.Unlock()
+	if q.byKey == nil {
+		q.byKey = make(map[txtsKey][]*pendingTXTS)
+	}
+	q.pending = append(q.pending, p)
+	q.byKey[p.key] = append(q.byKey[p.key], p)
+	return p
+}
+
+// unindex removes Sync from the index and marks it done. Must be called under the lock
+func (q *txtsQueue) unindex(p *pendingTXTS) {
+	p.done = true
+	ps := q.byKey[p.key]
+	for i, pp := range ps {
+		if pp == p {
+			ps = append(ps[:i], ps[i+1:]...)
+			break
+		}
+	}
+	if len(ps) == 0 {
+		delete(q.byKey, p.key)
+		return
+	}
+	q.byKey[p.key] = ps
+}
+
+// remove forgets Sync which failed to be sent
+func (q *txtsQueue) remove(p *pendingTXTS) {
+	q.Lock()
+	defer q.Unlock()
+	if !p.done {
+		q.unindex(p)
+	}
+}
+
+// lookup removes and returns the oldest Sync with the key the looped back packet ends with, nil if there is none.
+// Must be called under the lock
+func (q *txtsQueue) lookup(k txtsKey, looped []byte) *pendingTXTS {
+	for _, p := range q.byKey[k] {
+		if bytes.HasSuffix(looped, p.packet) {
+			q.unindex(p)
+			return p
+		}
+	}
+	return nil
+}
+
+// match removes and returns Sync the looped back packet was sent for, nil if there is none.
+// Identical Syncs to the same destination are matched in the order they were sent, as kernel reports their timestamps
+func (q *txtsQueue) match(looped []byte) *pendingTXTS {
+	v4, v4ok, v6, v6ok := loopedKeys(looped)
+	q.Lock()
+	defer q.Unlock()
+	if v4ok {
+		if p := q.lookup(v4, looped); p != nil {
+			return p
+		}
+	}
+	if v6ok {
+		return q.lookup(v6, looped)
+	}
+	return nil
+}
+
+// expire removes and returns Syncs sent before deadline which are still waiting, and drops done ones from the front
+func (q *txtsQueue) expire(deadline time.Time) []*pendingTXTS {
+	q.Lock()
+	defer q.Unlock()
+	var expired []*pendingTXTS
+	i := 0
+	for ; i < len(q.pending); i++ {
+		p := q.pending[i]
+		if p.done {
+			continue
+		}
+		if !p.sent.Before(deadline) {
+			break
+		}
+		q.unindex(p)
+		expired = append(expired, p)
+	}
+	// let go of the popped entries
+	for j := 0; j < i; j++ {
+		q.pending[j] = nil
+	}
+	q.pending = q.pending[i:]
+	return expired
+}
+
+// readTXTimestamps reads TX timestamps of Syncs sent from eFd in batches and sends messages following them, until stop is closed
+func (s *sendWorker) readTXTimestamps(q *txtsQueue, eFd, gFd int, stop <-chan struct{}) {
+	batch := timestamp.NewTXTimestampBatch(txtsBatchSize)
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	timeout := time.Duration(timestamp.AttemptsTXTS) * timestamp.TimeoutTXTS
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		for _, p := range q.expire(time.Now().Add(-timeout)) {
+			s.stats.IncTXTSFailure(timestamp.FailureTXTimestampTimeout)
+			log.Warningf("No TX timestamp of Sync to %s in %v", timestamp.SockaddrToIP(p.c.eclisa), timeout)
+		}
+		ready, err := timestamp.WaitTXtimestamps(eFd, txtsPollInterval)
+		if err != nil {
+			log.Errorf("Failed to wait for TX timestamps: %v", err)
+			time.Sleep(txtsPollInterval)
+			continue
+		}
+		if !ready {
+			continue
+		}
+		n, err := batch.Read(eFd)
+		if err != nil {
+			log.Errorf("Failed to read TX timestamps: %v", err)
+			time.Sleep(txtsPollInterval)
+			continue
+		}
+		for i := 0; i < n; i++ {
+			// packet can't be matched without its end, so its timestamp is lost
+			if batch.Truncated(i) {
+				s.stats.IncTXTSFailure(timestamp.FailureOther)
+				log.Warningf("TX timestamp of truncated packet of %d bytes", len(batch.Packet(i)))
+				continue
+			}
+			p := q.match(batch.Packet(i))
+			if p == nil {
+				log.Debugf("TX timestamp of unknown packet")
+				continue
+			}
+			s.observeTXTSLatency(time.Since(p.sent))
+			txTS, err := batch.Timestamp(i)
+			if err != nil {
+				s.stats.IncTXTSFailure(timestamp.Classify(err))
+				log.Warningf("Failed to read TX timestamp: %v", err)
+				continue
+			}
+			p.c.sendMux.Lock()
+			s.sendTwoStep(p.c, txTS, p.seq, gFd, buf)
+			p.c.sendMux.Unlock()
+		}
+	}
+}
+
+// sendTwoStep sends the message carrying TX timestamp of the Sync with the sequence ID:
+// Follow Up for Sync subscription and Announce for SPTP. Must be called under the subscription send lock
+func (s *sendWorker) sendTwoStep(c *SubscriptionClient, txTS time.Time, seq uint16, gFd int, buf []byte) {
+	if s.config.TimestampType != timestamp.HWTIMESTAMP {
+		txTS = txTS.Add(s.config.UTCOffset)
+	}
+	switch c.subscriptionType {
+	case ptp.MessageSync:
+		c.updateFollowup(txTS, seq)
+		n, err := ptp.BytesTo(c.Followup(), buf)
+		if err != nil {
+			log.Errorf("Failed to generate the followup packet: %v", err)
+			return
+		}
+		log.Debug("Sending followup")
+
+		err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
+		if err != nil {
+			log.Errorf("Failed to send the followup packet: %v", err)
+			return
+		}
+		s.countTX(c, ptp.MessageFollowUp)
+	case ptp.MessageDelayReq:
+		c.UpdateAnnounceFollowUp(txTS)
+		n, err := ptp.BytesTo(c.Announce(), buf)
+		if err != nil {
+			log.Errorf("Failed to prepare the announce packet: %v", err)
+			return
+		}
+		log.Debug("Sending announce")
+
+		err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
+		if err != nil {
+			log.Errorf("Failed to send the announce packet: %v", err)
+			return
+		}
+		s.countTX(c, ptp.MessageAnnounce)
+		// SPTP exchange is over once TX timestamp of Sync is sent
+		s.observeTurnaround(c)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// looped returns packet as kernel loops it back: with link, IP and UDP headers in front
+func looped(sa unix.Sockaddr, packet []byte) []byte {
+	var ip []byte
+	udp := make([]byte, udpHeaderSize)
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		ip = make([]byte, ipv4HeaderSize)
+		ip[0] = 0x45
+		copy(ip[16:], sa.Addr[:])
+		binary.BigEndian.PutUint16(udp[2:], uint16(sa.Port))
+	case *unix.SockaddrInet6:
+		ip = make([]byte, ipv6HeaderSize)
+		ip[0] = 0x60
+		copy(ip[24:], sa.Addr[:])
+		binary.BigEndian.PutUint16(udp[2:], uint16(sa.Port))
+	}
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHeaderSize+len(packet)))
+	b := make([]byte, 14)
+	b = append(b, ip...)
+	b = append(b, udp...)
+	return append(b, packet...)
+}
+
+func TestTXTSQueue(t *testing.T) {
+	c := &Config{}
+	saA := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 319)
+	saB := timestamp.IPToSockaddr(net.ParseIP("127.0.0.2"), 319)
+	saC := timestamp.IPToSockaddr(net.ParseIP("::1"), 319)
+	scA := NewSubscriptionClient(nil, nil, saA, saA, ptp.MessageSync, c, time.Second, time.Now())
+	scB := NewSubscriptionClient(nil, nil, saB, saB, ptp.MessageSync, c, time.Second, time.Now())
+	scC := NewSubscriptionClient(nil, nil, saC, saC, ptp.MessageSync, c, time.Second, time.Now())
+	q := &txtsQueue{}
+
+	// Syncs to all subscribers are identical
+	sync, err := ptp.Bytes(scA.Sync())
+	require.NoError(t, err)
+	require.Len(t, sync, syncSize)
+	pA := q.add(scA, sync)
+	pB := q.add(scB, sync)
+	pC := q.add(scC, sync)
+	require.Nil(t, q.match(looped(timestamp.IPToSockaddr(net.ParseIP("127.0.0.3"), 319), sync)))
+	require.Nil(t, q.match(sync))
+
+	// timestamps are matched by destination, whatever order they come in
+	require.Equal(t, pC, q.match(looped(saC, sync)))
+	require.Equal(t, pB, q.match(looped(saB, sync)))
+	q.remove(pA)
+	require.Nil(t, q.match(looped(saA, sync)))
+	require.Empty(t, q.byKey)
+
+	// identical Syncs to the same destination are matched in the order they were sent
+	pA = q.add(scA, sync)
+	pB = q.add(scA, sync)
+	require.Equal(t, pA, q.match(looped(saA, sync)))
+	require.Equal(t, []*pendingTXTS{pB}, q.expire(time.Now().Add(time.Second)))
+	require.Empty(t, q.pending)
+	require.Empty(t, q.byKey)
+
+	// sequence ID is part of the key
+	pA = q.add(scA, sync)
+	scA.IncSequenceID()
+	scA.UpdateSync()
+	next, err := ptp.Bytes(scA.Sync())
+	require.NoError(t, err)
+	pB = q.add(scA, next)
+	require.Nil(t, q.match(looped(saB, next)))
+	require.Equal(t, pB, q.match(looped(saA, next)))
+
+	require.Empty(t, q.expire(pA.sent))
+	require.Equal(t, []*pendingTXTS{pA}, q.expire(time.Now().Add(time.Second)))
+	require.Empty(t, q.pending)
+	require.Empty(t, q.byKey)
+}
+
+func TestReadTXTimestamps(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "::1"} {
+		t.Run(ip, func(t *testing.T) {
+			testReadTXTimestamps(t, net.ParseIP(ip))
+		})
+	}
+}
+
+func testReadTXTimestamps(t *testing.T, ip net.IP) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			IP:            ip,
+			TimestampType: timestamp.SWTIMESTAMP,
+			TXTSBatch:     true,
+		},
+		DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	eFd, gFd, err := w.listen(c.IP)
+	require.NoError(t, err)
+	defer unix.Close(eFd)
+	defer unix.Close(gFd)
+	require.NoError(t, timestamp.LoopTXPackets(eFd))
+
+	subscriber, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+	require.NoError(t, err)
+	defer subscriber.Close()
+	sa := timestamp.IPToSockaddr(ip, subscriber.LocalAddr().(*net.UDPAddr).Port)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+
+	q := &txtsQueue{}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		w.readTXTimestamps(q, eFd, gFd, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+	sent := time.Now()
+	// Follow Up carries sequence ID of its Sync, although send bumps it right away
+	w.send(sc, q, eFd, gFd, buf, oob, toob)
+
+	require.NoError(t, subscriber.SetReadDeadline(time.Now().Add(time.Second)))
+	rb := make([]byte, timestamp.PayloadSizeBytes)
+	var fu *ptp.FollowUp
+	for fu == nil {
+		n, err := subscriber.Read(rb)
+		require.NoError(t, err)
+		p, err := ptp.DecodePacket(rb[:n])
+		require.NoError(t, err)
+		if f, ok := p.(*ptp.FollowUp); ok {
+			fu = f
+		}
+	}
+	require.Equal(t, uint16(0), fu.SequenceID)
+	require.WithinDuration(t, sent.Add(37*time.Second), fu.PreciseOriginTimestamp.Time(), time.Second)
+	require.Eventually(t, func() bool {
+		q.Lock()
+		defer q.Unlock()
+		return len(q.pending) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -37,6 +37,12 @@ func enableDSCP(fd int, localAddr net.IP, dscp int) error {
 		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, dscp<<2); err != nil {
 			return err
 		}
+		// dual-stack socket sends IPv4 packets to IPv4-mapped addresses, which follow IP_TOS
+		if localAddr.IsUnspecified() {
+			if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, dscp<<2); err != nil {
+				return err
+			}
+		}
 	} else {
 		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, dscp<<2); err != nil {
 			return err
@@ -45,6 +51,23 @@ func enableDSCP(fd int, localAddr net.IP, dscp int) error {
 	return nil
 }
 
+// enableHWTimestamps enables HW timestamps, making NIC insert TX timestamps into one-step Syncs if configured.
+// All sockets on the interface have to agree, otherwise they keep switching the NIC back and forth
+func enableHWTimestamps(fd int, c *Config) error {
+	return enableIfaceHWTimestamps(fd, c.Interface, c.OneStep, c.OneStepP2P)
+}
+
+// enableIfaceHWTimestamps enables HW timestamps on the interface, one-step ones using Sync or P2P mode if asked to
+func enableIfaceHWTimestamps(fd int, iface string, oneStep, p2p bool) error {
+	switch {
+	case oneStep && p2p:
+		return timestamp.EnableHWTimestampsOneStepP2P(fd, iface)
+	case oneStep:
+		return timestamp.EnableHWTimestampsOneStep(fd, iface)
+	}
+	return timestamp.EnableHWTimestamps(fd, iface)
+}
+
 // sendWorker monitors the queue of jobs
 type sendWorker struct {
 	mux            sync.Mutex
@@ -55,6 +78,17 @@ type sendWorker struct {
 	stats          stats.Stats
 
 	clients map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient
+
+	// stop channels of senders added by autoscaling on top of the first one
+	extraSenders []chan struct{}
+	// longest queue and TX timestamp read since the last autoscaling tick
+	maxQueue       int64
+	maxTXTSLatency int64
+	// autoscaling ticks in a row the worker was quiet
+	quietTicks int
+
+	// DelayReq turnaround since the last metric report
+	turnaround turnaroundHistogram
 }
 
 func newSendWorker(i int, c *Config, st stats.Stats) *sendWorker {
@@ -69,10 +103,11 @@ func newSendWorker(i int, c *Config, st stats.Stats) *sendWorker {
 	return s
 }
 
-func (s *sendWorker) listen() (eventFD, generalFD int, err error) {
+// listen opens event and general sockets to send from ip
+func (s *sendWorker) listen(ip net.IP) (eventFD, generalFD int, err error) {
 	// socket domain differs depending whether we are listening on ipv4 or ipv6
 	domain := unix.AF_INET6
-	if s.config.IP.To4() != nil {
+	if ip.To4() != nil {
 		domain = unix.AF_INET
 	}
 	// set up event connection
@@ -80,7 +115,7 @@ func (s *sendWorker) listen() (eventFD, generalFD int, err error) {
 	if err != nil {
 		return -1, -1, fmt.Errorf("creating event socket error: %w", err)
 	}
-	sockAddrAnyPort := timestamp.IPToSockaddr(s.config.IP, 0)
+	sockAddrAnyPort := timestamp.IPToSockaddr(ip, 0)
 
 	// set SO_REUSEPORT so we can potentially trace network path from same source port.
 	// needs to be set before we bind to a port.
@@ -106,14 +141,14 @@ func (s *sendWorker) listen() (eventFD, generalFD int, err error) {
 		log.Errorf("Unexpected local addr type %T", v)
 	}
 
-	if err = enableDSCP(eventFD, s.config.IP, s.config.DSCP); err != nil {
+	if err = enableDSCP(eventFD, ip, s.config.DSCP); err != nil {
 		return -1, -1, fmt.Errorf("setting DSCP on event socket: %w", err)
 	}
 
 	// Syncs sent from event port, so need to turn on timestamping here
 	switch s.config.TimestampType {
 	case timestamp.HWTIMESTAMP:
-		if err = timestamp.EnableHWTimestamps(eventFD, s.config.Interface); err != nil {
+		if err = enableHWTimestamps(eventFD, s.config); err != nil {
 			return -1, -1, fmt.Errorf("failed to enable RX hardware timestamps: %w", err)
 		}
 	case timestamp.SWTIMESTAMP:
@@ -139,7 +174,7 @@ func (s *sendWorker) listen() (eventFD, generalFD int, err error) {
 		return -1, -1, fmt.Errorf("binding event socket connection: %w", err)
 	}
 	// enable DSCP
-	if err = enableDSCP(generalFD, s.config.IP, s.config.DSCP); err != nil {
+	if err = enableDSCP(generalFD, ip, s.config.DSCP); err != nil {
 		return -1, -1, fmt.Errorf("setting DSCP on general socket: %w", err)
 	}
 	return
@@ -147,12 +182,60 @@ func (s *sendWorker) listen() (eventFD, generalFD int, err error) {
 
 // Start a SendWorker which will pull data from the queue and send Sync and Followup packets
 func (s *sendWorker) Start() {
-	eFd, gFd, err := s.listen()
-	if err != nil {
-		log.Fatal(err)
+	s.run(nil)
+}
+
+// senderSockets are sockets sender serves subscribers of one IP family from
+type senderSockets struct {
+	eFd int
+	gFd int
+	// Syncs waiting for TX timestamps read in batches, nil without batching
+	q *txtsQueue
+}
+
+// socketsFor returns sockets to serve the subscriber at sa from.
+// IPv4 subscribers are served from IPv4 sockets if there are any, the rest from IPv6 ones
+func socketsFor(sa unix.Sockaddr, v4, v6 *senderSockets) *senderSockets {
+	if _, ok := sa.(*unix.SockaddrInet4); (ok && v4 != nil) || v6 == nil {
+		return v4
+	}
+	return v6
+}
+
+// run a sender with its own sockets for every listen IP until stop is closed. Senders of the same worker share its queues
+func (s *sendWorker) run(stop <-chan struct{}) {
+	var v4, v6 *senderSockets
+	for _, ip := range s.config.ListenIPs() {
+		eFd, gFd, err := s.listen(ip)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer unix.Close(eFd)
+		defer unix.Close(gFd)
+
+		socks := &senderSockets{eFd: eFd, gFd: gFd}
+		if s.config.TXTSBatch {
+			if err := timestamp.LoopTXPackets(eFd); err != nil {
+				log.Fatalf("Failed to enable TX timestamps batching: %v", err)
+			}
+			socks.q = &txtsQueue{}
+			txtsStop := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.readTXTimestamps(socks.q, eFd, gFd, txtsStop)
+			}()
+			// sockets are closed only once nobody reads from them
+			defer wg.Wait()
+			defer close(txtsStop)
+		}
+		if ip.To4() != nil {
+			v4 = socks
+		} else {
+			v6 = socks
+		}
 	}
-	defer unix.Close(eFd)
-	defer unix.Close(gFd)
 
 	// reusable buffers
 	buf := make([]byte, timestamp.PayloadSizeBytes)
@@ -162,145 +245,27 @@ func (s *sendWorker) Start() {
 	toob := make([]byte, timestamp.ControlSizeBytes)
 
 	var (
-		n        int
-		attempts int
-		txTS     time.Time
-		c        *SubscriptionClient
+		n     int
+		err   error
+		c     *SubscriptionClient
+		socks *senderSockets
 	)
 
 	for {
 		select {
+		case <-stop:
+			return
 		case c = <-s.queue:
-			switch c.subscriptionType {
-			case ptp.MessageSync:
-				// send sync
-				c.UpdateSync()
-				n, err = ptp.BytesTo(c.Sync(), buf)
-				if err != nil {
-					log.Errorf("Failed to generate the sync packet: %v", err)
-					continue
-				}
-				log.Debugf("Sending sync")
-
-				err = unix.Sendto(eFd, buf[:n], 0, c.eclisa)
-				if err != nil {
-					log.Errorf("Failed to send the sync packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(c.subscriptionType)
-
-				txTS, attempts, err = timestamp.ReadTXtimestampBuf(eFd, oob, toob)
-				s.stats.SetMaxTXTSAttempts(s.id, int64(attempts))
-				if err != nil {
-					log.Warningf("Failed to read TX timestamp: %v", err)
-					continue
-				}
-				if s.config.TimestampType != timestamp.HWTIMESTAMP {
-					txTS = txTS.Add(s.config.UTCOffset)
-				}
-
-				// send followup
-				c.UpdateFollowup(txTS)
-				n, err = ptp.BytesTo(c.Followup(), buf)
-				if err != nil {
-					log.Errorf("Failed to generate the followup packet: %v", err)
-					continue
-				}
-				log.Debug("Sending followup")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the followup packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(ptp.MessageFollowUp)
-			case ptp.MessageAnnounce:
-				// send announce
-				c.UpdateAnnounce()
-				n, err = ptp.BytesTo(c.Announce(), buf)
-				if err != nil {
-					log.Errorf("Failed to prepare the announce packet: %v", err)
-					continue
-				}
-				log.Debug("Sending announce")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the announce packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(c.subscriptionType)
-
-			case ptp.MessageDelayResp:
-				// send delay response
-				n, err = ptp.BytesTo(c.DelayResp(), buf)
-				if err != nil {
-					log.Errorf("Failed to prepare the delay response packet: %v", err)
-					continue
-				}
-				log.Debug("Sending delay response")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the delay response: %v", err)
-					continue
-				}
-				s.stats.IncTX(c.subscriptionType)
-
-			case ptp.MessageDelayReq:
-				// send sync
-				n, err = ptp.BytesTo(c.Sync(), buf)
-				if err != nil {
-					log.Errorf("Failed to generate the sync packet: %v", err)
-					continue
-				}
-				log.Debugf("Sending sync")
-
-				err = unix.Sendto(eFd, buf[:n], 0, c.eclisa)
-				if err != nil {
-					log.Errorf("Failed to send the sync packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(ptp.MessageSync)
-
-				txTS, attempts, err = timestamp.ReadTXtimestampBuf(eFd, oob, toob)
-				s.stats.SetMaxTXTSAttempts(s.id, int64(attempts))
-				if err != nil {
-					log.Warningf("Failed to read TX timestamp: %v", err)
-					continue
-				}
-				if s.config.TimestampType != timestamp.HWTIMESTAMP {
-					txTS = txTS.Add(s.config.UTCOffset)
-				}
-
-				// send announce
-				c.UpdateAnnounceFollowUp(txTS)
-				n, err = ptp.BytesTo(c.Announce(), buf)
-				if err != nil {
-					log.Errorf("Failed to prepare the announce packet: %v", err)
-					continue
-				}
-				log.Debug("Sending announce")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the announce packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(ptp.MessageAnnounce)
-			default:
-				log.Errorf("Unknown subscription type: %v", c.subscriptionType)
-				continue
-			}
-			c.IncSequenceID()
-			s.stats.SetMaxWorkerQueue(s.id, int64(len(s.queue)))
+			socks = socketsFor(c.eclisa, v4, v6)
+			s.send(c, socks.q, socks.eFd, socks.gFd, buf, oob, toob)
 		case c = <-s.signalingQueue:
 			n, err = ptp.BytesTo(c.Signaling(), buf)
 			if err != nil {
 				log.Errorf("Failed to prepare the unicast signaling: %v", err)
 				continue
 			}
-			err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
+			socks = socketsFor(c.gclisa, v4, v6)
+			err = unix.Sendto(socks.gFd, buf[:n], 0, c.gclisa)
 			if err != nil {
 				log.Errorf("Failed to send the unicast signaling: %v", err)
 				continue
@@ -310,6 +275,7 @@ func (s *sendWorker) Start() {
 				switch tlv.(type) {
 				case *ptp.GrantUnicastTransmissionTLV:
 					s.stats.IncTXSignalingGrant(c.subscriptionType)
+					s.checkGrantLatency(c, time.Since(c.GrantRequested()))
 				case *ptp.CancelUnicastTransmissionTLV:
 					s.stats.IncTXSignalingCancel(c.subscriptionType)
 				}
@@ -318,6 +284,169 @@ func (s *sendWorker) Start() {
 	}
 }
 
+// send sends queued message of the subscription. Senders of the same worker may pick the same subscription at once,
+// so it's sent under the subscription send lock. With TX timestamps batching q is not nil,
+// and messages following Syncs are sent once their TX timestamps are read
+func (s *sendWorker) send(c *SubscriptionClient, q *txtsQueue, eFd, gFd int, buf, oob, toob []byte) {
+	c.sendMux.Lock()
+	defer c.sendMux.Unlock()
+
+	var (
+		n        int
+		attempts int
+		txTS     time.Time
+		err      error
+	)
+
+	switch c.subscriptionType {
+	case ptp.MessageSync:
+		// send sync
+		c.UpdateSync()
+		n, err = ptp.BytesTo(c.Sync(), buf)
+		if err != nil {
+			log.Errorf("Failed to generate the sync packet: %v", err)
+			return
+		}
+		log.Debugf("Sending sync")
+
+		// register before sending, so TX timestamp can't come first
+		var p *pendingTXTS
+		if q != nil && !c.OneStep() {
+			p = q.add(c, buf[:n])
+		}
+		err = unix.Sendto(eFd, buf[:n], 0, c.eclisa)
+		if err != nil {
+			if p != nil {
+				q.remove(p)
+			}
+			log.Errorf("Failed to send the sync packet: %v", err)
+			return
+		}
+		s.countTX(c, c.subscriptionType)
+		if c.OneStep() {
+			// TX timestamp is in the Sync itself, no Follow Up needed
+			s.stats.IncTXOneStep(c.subscriptionType)
+			break
+		}
+		if p != nil {
+			break
+		}
+
+		txtsStart := time.Now()
+		txTS, attempts, err = timestamp.ReadTXtimestampBuf(eFd, oob, toob)
+		s.observeTXTSLatency(time.Since(txtsStart))
+		s.stats.SetMaxTXTSAttempts(s.id, int64(attempts))
+		if err != nil {
+			s.stats.IncTXTSFailure(timestamp.Classify(err))
+			log.Warningf("Failed to read TX timestamp: %v", err)
+			return
+		}
+		s.sendTwoStep(c, txTS, c.Sync().SequenceID, gFd, buf)
+	case ptp.MessageAnnounce:
+		// send announce
+		c.UpdateAnnounce()
+		n, err = ptp.BytesTo(c.Announce(), buf)
+		if err != nil {
+			log.Errorf("Failed to prepare the announce packet: %v", err)
+			return
+		}
+		log.Debug("Sending announce")
+
+		err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
+		if err != nil {
+			log.Errorf("Failed to send the announce packet: %v", err)
+			return
+		}
+		s.countTX(c, c.subscriptionType)
+
+	case ptp.MessageDelayResp:
+		// send delay response
+		n, err = ptp.BytesTo(c.DelayResp(), buf)
+		if err != nil {
+			log.Errorf("Failed to prepare the delay response packet: %v", err)
+			return
+		}
+		log.Debug("Sending delay response")
+
+		err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
+		if err != nil {
+			log.Errorf("Failed to send the delay response: %v", err)
+			return
+		}
+		s.countTX(c, c.subscriptionType)
+		s.observeTurnaround(c)
+
+	case ptp.MessageDelayReq:
+		// send sync
+		n, err = ptp.BytesTo(c.Sync(), buf)
+		if err != nil {
+			log.Errorf("Failed to generate the sync packet: %v", err)
+			return
+		}
+		log.Debugf("Sending sync")
+
+		var p *pendingTXTS
+		if q != nil {
+			p = q.add(c, buf[:n])
+		}
+		err = unix.Sendto(eFd, buf[:n], 0, c.eclisa)
+		if err != nil {
+			if p != nil {
+				q.remove(p)
+			}
+			log.Errorf("Failed to send the sync packet: %v", err)
+			return
+		}
+		s.countTX(c, ptp.MessageSync)
+		if p != nil {
+			break
+		}
+
+		txtsStart := time.Now()
+		txTS, attempts, err = timestamp.ReadTXtimestampBuf(eFd, oob, toob)
+		s.observeTXTSLatency(time.Since(txtsStart))
+		s.stats.SetMaxTXTSAttempts(s.id, int64(attempts))
+		if err != nil {
+			s.stats.IncTXTSFailure(timestamp.Classify(err))
+			log.Warningf("Failed to read TX timestamp: %v", err)
+			return
+		}
+		s.sendTwoStep(c, txTS, c.Sync().SequenceID, gFd, buf)
+	default:
+		log.Errorf("Unknown subscription type: %v", c.subscriptionType)
+		return
+	}
+	c.IncSequenceID()
+	s.observeQueue(len(s.queue))
+	s.stats.SetMaxWorkerQueue(s.id, int64(len(s.queue)))
+}
+
+// countTX counts message sent for the subscription, overall and in its domain
+func (s *sendWorker) countTX(c *SubscriptionClient, t ptp.MessageType) {
+	s.stats.IncTX(t)
+	s.stats.IncDomainTX(c.Domain(), t)
+	c.incSent()
+}
+
+// checkGrantLatency reports time it took to send the grant since the request was received, and whether it breached the SLO
+func (s *sendWorker) checkGrantLatency(c *SubscriptionClient, latency time.Duration) {
+	s.stats.SetMaxGrantLatency(c.subscriptionType, latency.Nanoseconds())
+	slo := s.config.GrantLatencySLO
+	if slo <= 0 || latency <= slo {
+		return
+	}
+	s.stats.IncGrantLatencySLOBreach(c.subscriptionType)
+	log.WithFields(log.Fields{
+		"event":        "grant_latency_slo_breach",
+		"client":       timestamp.SockaddrToIP(c.gclisa).String(),
+		"type":         c.subscriptionType.String(),
+		"worker":       s.id,
+		"latency":      latency.String(),
+		"slo":          slo.String(),
+		"signal_queue": len(s.signalingQueue),
+	}).Warning("Grant latency SLO breached")
+}
+
 // FindSubscription retrieves an existing client
 func (s *sendWorker) FindSubscription(clientID ptp.PortIdentity, st ptp.MessageType) *SubscriptionClient {
 	s.mux.Lock()
@@ -357,15 +486,57 @@ func (s *sendWorker) RegisterSubscription(clientID ptp.PortIdentity, st ptp.Mess
 	m[clientID] = sc
 }
 
+// remainingClients returns how many subscriptions are still running and when the last of them expires
+func (s *sendWorker) remainingClients() (int, time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var n int
+	var last time.Time
+	for _, subs := range s.clients {
+		for _, sc := range subs {
+			if !sc.Running() {
+				continue
+			}
+			n++
+			if e := sc.Expire(); e.After(last) {
+				last = e
+			}
+		}
+	}
+	return n, last
+}
+
+// subscriptions returns state of every running subscription
+func (s *sendWorker) subscriptions() []SubscriptionState {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var res []SubscriptionState
+	for _, subs := range s.clients {
+		for port, sc := range subs {
+			if !sc.Running() {
+				continue
+			}
+			res = append(res, sc.state(port))
+		}
+	}
+	return res
+}
+
 func (s *sendWorker) inventoryClients() {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 	for st, subs := range s.clients {
 		for k, sc := range subs {
 			if !sc.Running() {
+				if sc.Reclaimed() {
+					s.stats.IncReclaimedGrant(st)
+				}
 				delete(subs, k)
 				continue
 			}
+			if sc.Paused() {
+				s.stats.IncReclaimedGrant(st)
+			}
 			s.stats.IncSubscription(st)
 			s.stats.IncWorkerSubs(s.id)
 		}
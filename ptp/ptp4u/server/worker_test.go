@@ -223,3 +223,52 @@ func TestEnableDSCP(t *testing.T) {
 	err = enableDSCP(fd6, net.ParseIP("::"), 42)
 	require.NoError(t, err)
 }
+
+// grantStats records grant latency stats, rest of stats.Stats is not used
+type grantStats struct {
+	stats.Stats
+	latency  int64
+	breaches int
+}
+
+func (s *grantStats) SetMaxGrantLatency(_ ptp.MessageType, latency int64) {
+	if latency > s.latency {
+		s.latency = latency
+	}
+}
+
+func (s *grantStats) IncGrantLatencySLOBreach(_ ptp.MessageType) {
+	s.breaches++
+}
+
+func TestCheckGrantLatency(t *testing.T) {
+	c := &Config{
+		DynamicConfig: DynamicConfig{
+			GrantLatencySLO: 10 * time.Millisecond,
+		},
+	}
+	st := &grantStats{}
+	w := &sendWorker{
+		id:             0,
+		signalingQueue: make(chan *SubscriptionClient, 1),
+		stats:          st,
+		config:         c,
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Time{})
+
+	w.checkGrantLatency(sc, time.Millisecond)
+	w.checkGrantLatency(sc, 5*time.Millisecond)
+	require.Equal(t, int64(5*time.Millisecond), st.latency)
+	require.Equal(t, 0, st.breaches)
+
+	w.checkGrantLatency(sc, 20*time.Millisecond)
+	require.Equal(t, int64(20*time.Millisecond), st.latency)
+	require.Equal(t, 1, st.breaches)
+
+	// SLO is disabled
+	c.GrantLatencySLO = 0
+	w.checkGrantLatency(sc, time.Second)
+	require.Equal(t, int64(time.Second), st.latency)
+	require.Equal(t, 1, st.breaches)
+}
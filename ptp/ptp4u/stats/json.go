@@ -20,9 +20,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync/atomic"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -67,11 +69,33 @@ func (s *JSONStats) Snapshot() {
 	s.workerQueue.copy(&s.report.workerQueue)
 	s.workerSubs.copy(&s.report.workerSubs)
 	s.txtsattempts.copy(&s.report.txtsattempts)
+	s.reclaimedGrant.copy(&s.report.reclaimedGrant)
+	s.grantLatency.copy(&s.report.grantLatency)
+	s.grantSLOBreach.copy(&s.report.grantSLOBreach)
+	s.txOneStep.copy(&s.report.txOneStep)
+	s.txtsFailures.copy(&s.report.txtsFailures)
+	s.tenantSubs.copy(&s.report.tenantSubs)
+	s.tenantRate.copy(&s.report.tenantRate)
+	s.tenantDenied.copy(&s.report.tenantDenied)
+	s.quotaDenied.copy(&s.report.quotaDenied)
+	s.quotaDowngraded.copy(&s.report.quotaDowngraded)
+	s.quotaUsage.copy(&s.report.quotaUsage)
+	s.txtsLatency.copy(&s.report.txtsLatency)
+	s.workerSenders.copy(&s.report.workerSenders)
+	s.workerScale.copy(&s.report.workerScale)
+	s.domain.copy(&s.report.domain)
+	s.aclDenied.copy(&s.report.aclDenied)
+	s.flood.copy(&s.report.flood)
+	s.turnaround.copy(&s.report.turnaround)
 	s.report.utcoffsetSec = s.utcoffsetSec
 	s.report.clockaccuracy = s.clockaccuracy
 	s.report.clockclass = s.clockclass
+	s.report.configVersion = s.configVersion
+	s.report.leapNext = s.leapNext
+	s.report.leapNextUnix = s.leapNextUnix
 	s.report.drain = s.drain
 	s.report.reload = s.reload
+	s.report.reloadFailed = s.reloadFailed
 }
 
 // handleRequest is a handler used for all http monitoring requests
@@ -132,11 +156,36 @@ func (s *JSONStats) IncWorkerSubs(workerid int) {
 	s.workerSubs.inc(workerid)
 }
 
+// IncReclaimedGrant atomically add 1 to the counter
+func (s *JSONStats) IncReclaimedGrant(t ptp.MessageType) {
+	s.reclaimedGrant.inc(int(t))
+}
+
+// IncGrantLatencySLOBreach atomically add 1 to the counter
+func (s *JSONStats) IncGrantLatencySLOBreach(t ptp.MessageType) {
+	s.grantSLOBreach.inc(int(t))
+}
+
+// IncTXOneStep atomically add 1 to the counter
+func (s *JSONStats) IncTXOneStep(t ptp.MessageType) {
+	s.txOneStep.inc(int(t))
+}
+
+// IncTXTSFailure atomically add 1 to the counter of TX timestamp failures of the class
+func (s *JSONStats) IncTXTSFailure(c timestamp.FailureClass) {
+	s.txtsFailures.inc(int(c))
+}
+
 // IncReload atomically add 1 to the counter
 func (s *JSONStats) IncReload() {
 	atomic.StoreInt64(&s.reload, 1)
 }
 
+// IncReloadFailure atomically add 1 to the counter
+func (s *JSONStats) IncReloadFailure() {
+	atomic.AddInt64(&s.reloadFailed, 1)
+}
+
 // DecSubscription atomically removes 1 from the counter
 func (s *JSONStats) DecSubscription(t ptp.MessageType) {
 	s.subscriptions.dec(int(t))
@@ -191,6 +240,13 @@ func (s *JSONStats) SetMaxTXTSAttempts(workerid int, attempts int64) {
 	}
 }
 
+// SetMaxGrantLatency atomically sets max time from the grant request receipt to the grant transmission
+func (s *JSONStats) SetMaxGrantLatency(t ptp.MessageType, latency int64) {
+	if latency > s.grantLatency.load(int(t)) {
+		s.grantLatency.store(int(t), latency)
+	}
+}
+
 // SetUTCOffsetSec atomically sets the utcoffset
 func (s *JSONStats) SetUTCOffsetSec(utcoffsetSec int64) {
 	atomic.StoreInt64(&s.utcoffsetSec, utcoffsetSec)
@@ -210,3 +266,124 @@ func (s *JSONStats) SetClockClass(clockclass int64) {
 func (s *JSONStats) SetDrain(drain int64) {
 	atomic.StoreInt64(&s.drain, drain)
 }
+
+// SetTenantSubscriptions atomically sets number of subscriptions held by the tenant
+func (s *JSONStats) SetTenantSubscriptions(tenant string, subs int64) {
+	s.tenantSubs.store(tenant, subs)
+}
+
+// SetTenantPacketRate atomically sets packets per second granted to the tenant
+func (s *JSONStats) SetTenantPacketRate(tenant string, rate int64) {
+	s.tenantRate.store(tenant, rate)
+}
+
+// IncTenantDenied atomically add 1 to the counter of subscriptions denied to the tenant over quota
+func (s *JSONStats) IncTenantDenied(tenant string) {
+	s.tenantDenied.inc(tenant)
+}
+
+// IncQuotaDenied atomically add 1 to the counter of subscriptions denied over client or global quota
+func (s *JSONStats) IncQuotaDenied(scope string) {
+	s.quotaDenied.inc(scope)
+}
+
+// IncQuotaDowngraded atomically add 1 to the counter of grants downgraded to fit the quota
+func (s *JSONStats) IncQuotaDowngraded(t ptp.MessageType) {
+	s.quotaDowngraded.inc(int(t))
+}
+
+// SetGlobalSubscriptions atomically sets number of subscriptions held by all subscribers
+func (s *JSONStats) SetGlobalSubscriptions(subs int64) {
+	s.quotaUsage.store("global.subscriptions", subs)
+}
+
+// SetGlobalPacketRate atomically sets packets per second granted to all subscribers
+func (s *JSONStats) SetGlobalPacketRate(rate int64) {
+	s.quotaUsage.store("global.packet_rate", rate)
+}
+
+// SetMaxTXTSLatency atomically sets max time it took worker to read TX timestamp
+func (s *JSONStats) SetMaxTXTSLatency(workerid int, latency int64) {
+	if latency > s.txtsLatency.load(workerid) {
+		s.txtsLatency.store(workerid, latency)
+	}
+}
+
+// SetWorkerSenders atomically sets number of senders of the worker
+func (s *JSONStats) SetWorkerSenders(workerid int, senders int64) {
+	s.workerSenders.store(workerid, senders)
+}
+
+// IncWorkerScaleUp atomically add 1 to the counter of senders added by autoscaling
+func (s *JSONStats) IncWorkerScaleUp() {
+	s.workerScale.inc("up")
+}
+
+// IncWorkerScaleDown atomically add 1 to the counter of senders removed by autoscaling
+func (s *JSONStats) IncWorkerScaleDown() {
+	s.workerScale.inc("down")
+}
+
+// IncDomainTX atomically add 1 to the counter of messages sent in the domain
+func (s *JSONStats) IncDomainTX(domain uint8, t ptp.MessageType) {
+	s.domain.inc(fmt.Sprintf("%d.tx.%s", domain, strings.ToLower(t.String())))
+}
+
+// SetConfigVersion atomically sets the version of dynamic config in use
+func (s *JSONStats) SetConfigVersion(version int64) {
+	atomic.StoreInt64(&s.configVersion, version)
+}
+
+// SetLeapNext atomically sets the next leap second: 1 inserted, -1 deleted, 0 none known
+func (s *JSONStats) SetLeapNext(leap int64) {
+	atomic.StoreInt64(&s.leapNext, leap)
+}
+
+// SetLeapNextUnix atomically sets when the next leap second transition is, as unix time
+func (s *JSONStats) SetLeapNextUnix(unixSec int64) {
+	atomic.StoreInt64(&s.leapNextUnix, unixSec)
+}
+
+// SetDomainClockClass atomically sets the clock class announced in the domain
+func (s *JSONStats) SetDomainClockClass(domain uint8, clockclass int64) {
+	s.domain.store(fmt.Sprintf("%d.clockclass", domain), clockclass)
+}
+
+// SetDomainClockAccuracy atomically sets the clock accuracy announced in the domain
+func (s *JSONStats) SetDomainClockAccuracy(domain uint8, clockaccuracy int64) {
+	s.domain.store(fmt.Sprintf("%d.clockaccuracy", domain), clockaccuracy)
+}
+
+// IncACLDenied atomically add 1 to the counter of requests from subscribers denied by ACL
+func (s *JSONStats) IncACLDenied(t ptp.MessageType) {
+	s.aclDenied.inc(int(t))
+}
+
+// IncFloodThrottled atomically add 1 to the counter of DelayReqs dropped from subscribers exceeding their granted rate
+func (s *JSONStats) IncFloodThrottled() {
+	s.flood.inc("throttled")
+}
+
+// IncFloodBlacklisted atomically add 1 to the counter of subscribers blacklisted for flooding
+func (s *JSONStats) IncFloodBlacklisted() {
+	s.flood.inc("blacklisted")
+}
+
+// SetFloodOffenders atomically sets number of subscribers currently throttled or blacklisted
+func (s *JSONStats) SetFloodOffenders(offenders int64) {
+	s.flood.store("offenders", offenders)
+}
+
+// SetWorkerTurnaround atomically sets p50, p99 and max time it took the worker to answer DelayReq
+func (s *JSONStats) SetWorkerTurnaround(workerid int, p50, p99, max int64) {
+	s.turnaround.store(fmt.Sprintf("worker.%d.turnaround_ns.p50", workerid), p50)
+	s.turnaround.store(fmt.Sprintf("worker.%d.turnaround_ns.p99", workerid), p99)
+	s.turnaround.store(fmt.Sprintf("worker.%d.turnaround_ns.max", workerid), max)
+}
+
+// SetTurnaround atomically sets p50, p99 and max time it took to answer DelayReq over all workers
+func (s *JSONStats) SetTurnaround(p50, p99, max int64) {
+	s.turnaround.store("turnaround_ns.p50", p50)
+	s.turnaround.store("turnaround_ns.p99", p99)
+	s.turnaround.store("turnaround_ns.max", max)
+}
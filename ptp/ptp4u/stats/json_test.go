@@ -26,6 +26,7 @@ import (
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
 	"github.com/stretchr/testify/require"
 )
 
@@ -147,6 +148,54 @@ func TestJSONStatsWorkerSubs(t *testing.T) {
 	require.Equal(t, int64(0), stats.tx.load(10))
 }
 
+func TestJSONStatsReclaimedGrant(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncReclaimedGrant(ptp.MessageSync)
+	require.Equal(t, int64(1), stats.reclaimedGrant.load(int(ptp.MessageSync)))
+
+	stats.Snapshot()
+	require.Equal(t, int64(1), stats.report.reclaimedGrant.load(int(ptp.MessageSync)))
+}
+
+func TestJSONStatsGrantLatency(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetMaxGrantLatency(ptp.MessageSync, 42)
+	stats.SetMaxGrantLatency(ptp.MessageSync, 10)
+	require.Equal(t, int64(42), stats.grantLatency.load(int(ptp.MessageSync)))
+
+	stats.IncGrantLatencySLOBreach(ptp.MessageSync)
+	require.Equal(t, int64(1), stats.grantSLOBreach.load(int(ptp.MessageSync)))
+
+	stats.Snapshot()
+	require.Equal(t, int64(42), stats.report.grantLatency.load(int(ptp.MessageSync)))
+	require.Equal(t, int64(1), stats.report.grantSLOBreach.load(int(ptp.MessageSync)))
+}
+
+func TestJSONStatsIncTXOneStep(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncTXOneStep(ptp.MessageSync)
+	require.Equal(t, int64(1), stats.txOneStep.load(int(ptp.MessageSync)))
+
+	stats.Snapshot()
+	require.Equal(t, int64(1), stats.report.txOneStep.load(int(ptp.MessageSync)))
+}
+
+func TestJSONStatsIncTXTSFailure(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncTXTSFailure(timestamp.FailureTXTimestampTimeout)
+	stats.IncTXTSFailure(timestamp.FailureTXTimestampTimeout)
+	stats.IncTXTSFailure(timestamp.FailureDriverBug)
+	require.Equal(t, int64(2), stats.txtsFailures.load(int(timestamp.FailureTXTimestampTimeout)))
+	require.Equal(t, int64(1), stats.txtsFailures.load(int(timestamp.FailureDriverBug)))
+
+	stats.Snapshot()
+	require.Equal(t, int64(2), stats.report.txtsFailures.load(int(timestamp.FailureTXTimestampTimeout)))
+}
+
 func TestJSONStatsSetMaxTXTSAttempts(t *testing.T) {
 	stats := NewJSONStats()
 
@@ -175,6 +224,22 @@ func TestJSONStatsSetClockCLass(t *testing.T) {
 	require.Equal(t, int64(42), stats.clockclass)
 }
 
+func TestJSONStatsSetConfigVersion(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetConfigVersion(42)
+	require.Equal(t, int64(42), stats.configVersion)
+}
+
+func TestJSONStatsSetLeap(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetLeapNext(-1)
+	stats.SetLeapNextUnix(1798761600)
+	require.Equal(t, int64(-1), stats.leapNext)
+	require.Equal(t, int64(1798761600), stats.leapNextUnix)
+}
+
 func TestJSONStatsSetDrain(t *testing.T) {
 	stats := NewJSONStats()
 
@@ -182,6 +247,14 @@ func TestJSONStatsSetDrain(t *testing.T) {
 	require.Equal(t, int64(1), stats.drain)
 }
 
+func TestJSONStatsIncReloadFailure(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncReloadFailure()
+	stats.IncReloadFailure()
+	require.Equal(t, int64(2), stats.reloadFailed)
+}
+
 func TestJSONStatsSnapshot(t *testing.T) {
 	stats := NewJSONStats()
 
@@ -196,9 +269,11 @@ func TestJSONStatsSnapshot(t *testing.T) {
 	stats.IncRXSignalingGrant(ptp.MessageDelayResp)
 	stats.SetClockAccuracy(1)
 	stats.SetClockClass(1)
+	stats.SetConfigVersion(1)
 	stats.SetUTCOffsetSec(1)
 	stats.SetDrain(1)
 	stats.IncReload()
+	stats.IncReloadFailure()
 
 	stats.Snapshot()
 
@@ -210,8 +285,10 @@ func TestJSONStatsSnapshot(t *testing.T) {
 	expectedStats.utcoffsetSec = 1
 	expectedStats.clockaccuracy = 1
 	expectedStats.clockclass = 1
+	expectedStats.configVersion = 1
 	expectedStats.drain = 1
 	expectedStats.reload = 1
+	expectedStats.reloadFailed = 1
 
 	require.Equal(t, expectedStats.subscriptions.m, stats.report.subscriptions.m)
 	require.Equal(t, expectedStats.tx.m, stats.report.tx.m)
@@ -219,8 +296,10 @@ func TestJSONStatsSnapshot(t *testing.T) {
 	require.Equal(t, expectedStats.utcoffsetSec, stats.report.utcoffsetSec)
 	require.Equal(t, expectedStats.clockaccuracy, stats.report.clockaccuracy)
 	require.Equal(t, expectedStats.clockclass, stats.report.clockclass)
+	require.Equal(t, expectedStats.configVersion, stats.report.configVersion)
 	require.Equal(t, expectedStats.drain, stats.report.drain)
 	require.Equal(t, expectedStats.reload, stats.report.reload)
+	require.Equal(t, expectedStats.reloadFailed, stats.report.reloadFailed)
 }
 
 func TestJSONExport(t *testing.T) {
@@ -241,8 +320,12 @@ func TestJSONExport(t *testing.T) {
 	stats.SetUTCOffsetSec(1)
 	stats.SetClockAccuracy(1)
 	stats.SetClockClass(1)
+	stats.SetConfigVersion(1)
+	stats.SetLeapNext(1)
+	stats.SetLeapNextUnix(1798761600)
 	stats.SetDrain(1)
 	stats.IncReload()
+	stats.IncReloadFailure()
 
 	stats.Snapshot()
 
@@ -265,8 +348,143 @@ func TestJSONExport(t *testing.T) {
 	expectedMap["utcoffset_sec"] = 1
 	expectedMap["clockaccuracy"] = 1
 	expectedMap["clockclass"] = 1
+	expectedMap["config_version"] = 1
+	expectedMap["leap.next"] = 1
+	expectedMap["leap.next_unix"] = 1798761600
 	expectedMap["drain"] = 1
 	expectedMap["reload"] = 1
+	expectedMap["reload_failed"] = 1
 
 	require.Equal(t, expectedMap, data)
 }
+
+func TestJSONStatsTenants(t *testing.T) {
+	stats := NewJSONStats()
+	stats.SetTenantSubscriptions("a", 3)
+	stats.SetTenantPacketRate("a", 12)
+	stats.IncTenantDenied("a")
+	stats.IncTenantDenied("a")
+	stats.Snapshot()
+
+	m := stats.report.toMap()
+	require.Equal(t, int64(3), m["tenant.a.subscriptions"])
+	require.Equal(t, int64(12), m["tenant.a.packet_rate"])
+	require.Equal(t, int64(2), m["tenant.a.denied"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.tenantDenied.load("a"))
+}
+
+func TestJSONStatsQuotas(t *testing.T) {
+	stats := NewJSONStats()
+	stats.SetGlobalSubscriptions(5)
+	stats.SetGlobalPacketRate(20)
+	stats.IncQuotaDenied("client")
+	stats.IncQuotaDenied("global")
+	stats.IncQuotaDenied("global")
+	stats.IncQuotaDowngraded(ptp.MessageSync)
+	stats.Snapshot()
+
+	m := stats.report.toMap()
+	require.Equal(t, int64(5), m["quota.global.subscriptions"])
+	require.Equal(t, int64(20), m["quota.global.packet_rate"])
+	require.Equal(t, int64(1), m["quota.client.denied"])
+	require.Equal(t, int64(2), m["quota.global.denied"])
+	require.Equal(t, int64(1), m["quota.downgraded.sync"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.quotaDenied.load("global"))
+	require.Equal(t, int64(0), stats.quotaDowngraded.load(int(ptp.MessageSync)))
+}
+
+func TestJSONStatsAutoscaling(t *testing.T) {
+	stats := NewJSONStats()
+	stats.SetMaxTXTSLatency(1, 2000)
+	stats.SetMaxTXTSLatency(1, 1000)
+	stats.SetWorkerSenders(1, 3)
+	stats.IncWorkerScaleUp()
+	stats.IncWorkerScaleUp()
+	stats.IncWorkerScaleDown()
+	stats.Snapshot()
+
+	m := stats.report.toMap()
+	require.Equal(t, int64(2000), m["worker.1.txts_latency_ns"])
+	require.Equal(t, int64(3), m["worker.1.senders"])
+	require.Equal(t, int64(2), m["worker.scale_up"])
+	require.Equal(t, int64(1), m["worker.scale_down"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.txtsLatency.load(1))
+	require.Equal(t, int64(0), stats.workerScale.load("up"))
+}
+
+func TestJSONStatsDomains(t *testing.T) {
+	stats := NewJSONStats()
+	stats.IncDomainTX(0, ptp.MessageSync)
+	stats.IncDomainTX(24, ptp.MessageSync)
+	stats.IncDomainTX(24, ptp.MessageSync)
+	stats.IncDomainTX(24, ptp.MessageAnnounce)
+	stats.SetDomainClockClass(24, 7)
+	stats.SetDomainClockAccuracy(24, 0x22)
+	stats.Snapshot()
+
+	m := stats.report.toMap()
+	require.Equal(t, int64(1), m["domain.0.tx.sync"])
+	require.Equal(t, int64(2), m["domain.24.tx.sync"])
+	require.Equal(t, int64(1), m["domain.24.tx.announce"])
+	require.Equal(t, int64(7), m["domain.24.clockclass"])
+	require.Equal(t, int64(0x22), m["domain.24.clockaccuracy"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.domain.load("24.tx.sync"))
+}
+
+func TestJSONStatsACL(t *testing.T) {
+	stats := NewJSONStats()
+	stats.IncACLDenied(ptp.MessageSync)
+	stats.IncACLDenied(ptp.MessageDelayReq)
+	stats.IncACLDenied(ptp.MessageDelayReq)
+	stats.Snapshot()
+
+	m := stats.report.toMap()
+	require.Equal(t, int64(1), m["acl.denied.sync"])
+	require.Equal(t, int64(2), m["acl.denied.delay_req"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.aclDenied.load(int(ptp.MessageDelayReq)))
+}
+
+func TestJSONStatsFlood(t *testing.T) {
+	stats := NewJSONStats()
+	stats.IncFloodThrottled()
+	stats.IncFloodThrottled()
+	stats.IncFloodBlacklisted()
+	stats.SetFloodOffenders(3)
+	stats.Snapshot()
+
+	m := stats.report.toMap()
+	require.Equal(t, int64(2), m["flood.throttled"])
+	require.Equal(t, int64(1), m["flood.blacklisted"])
+	require.Equal(t, int64(3), m["flood.offenders"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.flood.load("throttled"))
+}
+
+func TestJSONStatsTurnaround(t *testing.T) {
+	stats := NewJSONStats()
+	stats.SetWorkerTurnaround(1, 10, 20, 30)
+	stats.SetTurnaround(11, 21, 31)
+	stats.Snapshot()
+
+	m := stats.report.toMap()
+	require.Equal(t, int64(10), m["worker.1.turnaround_ns.p50"])
+	require.Equal(t, int64(20), m["worker.1.turnaround_ns.p99"])
+	require.Equal(t, int64(30), m["worker.1.turnaround_ns.max"])
+	require.Equal(t, int64(11), m["turnaround_ns.p50"])
+	require.Equal(t, int64(21), m["turnaround_ns.p99"])
+	require.Equal(t, int64(31), m["turnaround_ns.max"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.turnaround.load("turnaround_ns.max"))
+}
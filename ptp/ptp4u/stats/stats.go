@@ -27,6 +27,7 @@ import (
 	"sync"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
 )
 
 // Stats is a metric collection interface
@@ -65,9 +66,24 @@ type Stats interface {
 	// IncWorkerSubs atomically add 1 to the counter
 	IncWorkerSubs(workerid int)
 
+	// IncReclaimedGrant atomically add 1 to the counter
+	IncReclaimedGrant(t ptp.MessageType)
+
 	// IncReload atomically add 1 to the counter
 	IncReload()
 
+	// IncReloadFailure atomically add 1 to the counter
+	IncReloadFailure()
+
+	// IncGrantLatencySLOBreach atomically add 1 to the counter
+	IncGrantLatencySLOBreach(t ptp.MessageType)
+
+	// IncTXOneStep atomically add 1 to the counter
+	IncTXOneStep(t ptp.MessageType)
+
+	// IncTXTSFailure atomically add 1 to the counter of TX timestamp failures of the class
+	IncTXTSFailure(c timestamp.FailureClass)
+
 	// DecSubscription atomically removes 1 from the counter
 	DecSubscription(t ptp.MessageType)
 
@@ -98,6 +114,9 @@ type Stats interface {
 	// SetMaxTXTSAttempts atomically sets number of retries for get latest TX timestamp
 	SetMaxTXTSAttempts(workerid int, retries int64)
 
+	// SetMaxGrantLatency atomically sets max time from the grant request receipt to the grant transmission
+	SetMaxGrantLatency(t ptp.MessageType, latency int64)
+
 	// SetUTCOffsetSec atomically sets the utcoffset
 	SetUTCOffsetSec(utcoffsetSec int64)
 
@@ -107,8 +126,77 @@ type Stats interface {
 	// SetClockClass atomically sets the clock class
 	SetClockClass(clockclass int64)
 
+	// SetConfigVersion atomically sets the version of dynamic config in use
+	SetConfigVersion(version int64)
+
+	// SetLeapNext atomically sets the next leap second: 1 inserted, -1 deleted, 0 none known
+	SetLeapNext(leap int64)
+
+	// SetLeapNextUnix atomically sets when the next leap second transition is, as unix time
+	SetLeapNextUnix(unixSec int64)
+
 	// SetDrain atomically sets the drain status
 	SetDrain(drain int64)
+
+	// SetTenantSubscriptions atomically sets number of subscriptions held by the tenant
+	SetTenantSubscriptions(tenant string, subs int64)
+
+	// SetTenantPacketRate atomically sets packets per second granted to the tenant
+	SetTenantPacketRate(tenant string, rate int64)
+
+	// IncTenantDenied atomically add 1 to the counter of subscriptions denied to the tenant over quota
+	IncTenantDenied(tenant string)
+
+	// IncQuotaDenied atomically add 1 to the counter of subscriptions denied over client or global quota
+	IncQuotaDenied(scope string)
+
+	// IncQuotaDowngraded atomically add 1 to the counter of grants downgraded to fit the quota
+	IncQuotaDowngraded(t ptp.MessageType)
+
+	// SetGlobalSubscriptions atomically sets number of subscriptions held by all subscribers
+	SetGlobalSubscriptions(subs int64)
+
+	// SetGlobalPacketRate atomically sets packets per second granted to all subscribers
+	SetGlobalPacketRate(rate int64)
+
+	// SetMaxTXTSLatency atomically sets max time it took worker to read TX timestamp
+	SetMaxTXTSLatency(workerid int, latency int64)
+
+	// SetWorkerSenders atomically sets number of senders of the worker
+	SetWorkerSenders(workerid int, senders int64)
+
+	// IncWorkerScaleUp atomically add 1 to the counter of senders added by autoscaling
+	IncWorkerScaleUp()
+
+	// IncWorkerScaleDown atomically add 1 to the counter of senders removed by autoscaling
+	IncWorkerScaleDown()
+
+	// IncDomainTX atomically add 1 to the counter of messages sent in the domain
+	IncDomainTX(domain uint8, t ptp.MessageType)
+
+	// SetDomainClockClass atomically sets the clock class announced in the domain
+	SetDomainClockClass(domain uint8, clockclass int64)
+
+	// SetDomainClockAccuracy atomically sets the clock accuracy announced in the domain
+	SetDomainClockAccuracy(domain uint8, clockaccuracy int64)
+
+	// IncACLDenied atomically add 1 to the counter of requests from subscribers denied by ACL
+	IncACLDenied(t ptp.MessageType)
+
+	// IncFloodThrottled atomically add 1 to the counter of DelayReqs dropped from subscribers exceeding their granted rate
+	IncFloodThrottled()
+
+	// IncFloodBlacklisted atomically add 1 to the counter of subscribers blacklisted for flooding
+	IncFloodBlacklisted()
+
+	// SetFloodOffenders atomically sets number of subscribers currently throttled or blacklisted
+	SetFloodOffenders(offenders int64)
+
+	// SetWorkerTurnaround atomically sets p50, p99 and max time it took the worker to answer DelayReq
+	SetWorkerTurnaround(workerid int, p50, p99, max int64)
+
+	// SetTurnaround atomically sets p50, p99 and max time it took to answer DelayReq over all workers
+	SetTurnaround(p50, p99, max int64)
 }
 
 // syncMapInt64 sync map of PTP messages
@@ -178,6 +266,65 @@ func (s *syncMapInt64) reset() {
 	s.Unlock()
 }
 
+// syncMapStrInt64 sync map of per-tenant counters
+type syncMapStrInt64 struct {
+	sync.Mutex
+	m map[string]int64
+}
+
+// init initializes the underlying map
+func (s *syncMapStrInt64) init() {
+	s.m = make(map[string]int64)
+}
+
+// keys returns slice of keys of the underlying map
+func (s *syncMapStrInt64) keys() []string {
+	keys := make([]string, 0, len(s.m))
+	s.Lock()
+	for k := range s.m {
+		keys = append(keys, k)
+	}
+	s.Unlock()
+	return keys
+}
+
+// load gets the value by the key
+func (s *syncMapStrInt64) load(key string) int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.m[key]
+}
+
+// inc increments the counter for the given key
+func (s *syncMapStrInt64) inc(key string) {
+	s.Lock()
+	s.m[key]++
+	s.Unlock()
+}
+
+// store saves the value with the key
+func (s *syncMapStrInt64) store(key string, value int64) {
+	s.Lock()
+	s.m[key] = value
+	s.Unlock()
+}
+
+// copy all key-values between maps
+func (s *syncMapStrInt64) copy(dst *syncMapStrInt64) {
+	for _, t := range s.keys() {
+		dst.store(t, s.load(t))
+	}
+}
+
+// reset stats to 0
+func (s *syncMapStrInt64) reset() {
+	s.Lock()
+	for t := range s.m {
+		s.m[t] = 0
+	}
+	s.Unlock()
+}
+
 type counters struct {
 	rx                syncMapInt64
 	rxSignalingGrant  syncMapInt64
@@ -187,13 +334,35 @@ type counters struct {
 	txSignalingGrant  syncMapInt64
 	txSignalingCancel syncMapInt64
 	txtsattempts      syncMapInt64
+	reclaimedGrant    syncMapInt64
+	grantLatency      syncMapInt64
+	grantSLOBreach    syncMapInt64
+	txOneStep         syncMapInt64
+	txtsFailures      syncMapInt64
 	workerQueue       syncMapInt64
 	workerSubs        syncMapInt64
+	tenantSubs        syncMapStrInt64
+	tenantRate        syncMapStrInt64
+	tenantDenied      syncMapStrInt64
+	quotaDenied       syncMapStrInt64
+	quotaDowngraded   syncMapInt64
+	quotaUsage        syncMapStrInt64
+	txtsLatency       syncMapInt64
+	workerSenders     syncMapInt64
+	workerScale       syncMapStrInt64
+	domain            syncMapStrInt64
+	aclDenied         syncMapInt64
+	flood             syncMapStrInt64
+	turnaround        syncMapStrInt64
 	utcoffsetSec      int64
 	clockaccuracy     int64
 	clockclass        int64
+	configVersion     int64
+	leapNext          int64
+	leapNextUnix      int64
 	drain             int64
 	reload            int64
+	reloadFailed      int64
 }
 
 func (c *counters) init() {
@@ -207,6 +376,24 @@ func (c *counters) init() {
 	c.workerQueue.init()
 	c.workerSubs.init()
 	c.txtsattempts.init()
+	c.reclaimedGrant.init()
+	c.grantLatency.init()
+	c.grantSLOBreach.init()
+	c.txOneStep.init()
+	c.txtsFailures.init()
+	c.tenantSubs.init()
+	c.tenantRate.init()
+	c.tenantDenied.init()
+	c.quotaDenied.init()
+	c.quotaDowngraded.init()
+	c.quotaUsage.init()
+	c.txtsLatency.init()
+	c.workerSenders.init()
+	c.workerScale.init()
+	c.domain.init()
+	c.aclDenied.init()
+	c.flood.init()
+	c.turnaround.init()
 }
 
 func (c *counters) reset() {
@@ -220,11 +407,33 @@ func (c *counters) reset() {
 	c.workerQueue.reset()
 	c.workerSubs.reset()
 	c.txtsattempts.reset()
+	c.reclaimedGrant.reset()
+	c.grantLatency.reset()
+	c.grantSLOBreach.reset()
+	c.txOneStep.reset()
+	c.txtsFailures.reset()
+	c.tenantSubs.reset()
+	c.tenantRate.reset()
+	c.tenantDenied.reset()
+	c.quotaDenied.reset()
+	c.quotaDowngraded.reset()
+	c.quotaUsage.reset()
+	c.txtsLatency.reset()
+	c.workerSenders.reset()
+	c.workerScale.reset()
+	c.domain.reset()
+	c.aclDenied.reset()
+	c.flood.reset()
+	c.turnaround.reset()
 	c.utcoffsetSec = 0
 	c.clockaccuracy = 0
 	c.clockclass = 0
+	c.configVersion = 0
+	c.leapNext = 0
+	c.leapNextUnix = 0
 	c.drain = 0
 	c.reload = 0
+	c.reloadFailed = 0
 }
 
 // toMap converts counters to a map
@@ -288,11 +497,101 @@ func (c *counters) toMap() (export map[string]int64) {
 		res[fmt.Sprintf("worker.%d.txtsattempts", t)] = c
 	}
 
+	for _, t := range c.reclaimedGrant.keys() {
+		c := c.reclaimedGrant.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("reclaimed.grant.%s", mt)] = c
+	}
+
+	for _, t := range c.grantLatency.keys() {
+		c := c.grantLatency.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("tx.signaling.grant.latency_ns.%s", mt)] = c
+	}
+
+	for _, t := range c.grantSLOBreach.keys() {
+		c := c.grantSLOBreach.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("tx.signaling.grant.slo_breach.%s", mt)] = c
+	}
+
+	for _, t := range c.txOneStep.keys() {
+		c := c.txOneStep.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("tx.one_step.%s", mt)] = c
+	}
+
+	for _, t := range c.txtsFailures.keys() {
+		c := c.txtsFailures.load(t)
+		res[fmt.Sprintf("txts.failures.%s", timestamp.FailureClass(t))] = c
+	}
+
+	for _, t := range c.tenantSubs.keys() {
+		res[fmt.Sprintf("tenant.%s.subscriptions", t)] = c.tenantSubs.load(t)
+	}
+
+	for _, t := range c.tenantRate.keys() {
+		res[fmt.Sprintf("tenant.%s.packet_rate", t)] = c.tenantRate.load(t)
+	}
+
+	for _, t := range c.tenantDenied.keys() {
+		res[fmt.Sprintf("tenant.%s.denied", t)] = c.tenantDenied.load(t)
+	}
+
+	for _, t := range c.quotaDenied.keys() {
+		res[fmt.Sprintf("quota.%s.denied", t)] = c.quotaDenied.load(t)
+	}
+
+	for _, t := range c.quotaDowngraded.keys() {
+		c := c.quotaDowngraded.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("quota.downgraded.%s", mt)] = c
+	}
+
+	for _, t := range c.quotaUsage.keys() {
+		res[fmt.Sprintf("quota.%s", t)] = c.quotaUsage.load(t)
+	}
+
+	for _, t := range c.txtsLatency.keys() {
+		c := c.txtsLatency.load(t)
+		res[fmt.Sprintf("worker.%d.txts_latency_ns", t)] = c
+	}
+
+	for _, t := range c.workerSenders.keys() {
+		c := c.workerSenders.load(t)
+		res[fmt.Sprintf("worker.%d.senders", t)] = c
+	}
+
+	for _, t := range c.workerScale.keys() {
+		res[fmt.Sprintf("worker.scale_%s", t)] = c.workerScale.load(t)
+	}
+
+	for _, t := range c.domain.keys() {
+		res[fmt.Sprintf("domain.%s", t)] = c.domain.load(t)
+	}
+
+	for _, t := range c.aclDenied.keys() {
+		c := c.aclDenied.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("acl.denied.%s", mt)] = c
+	}
+
+	for _, t := range c.flood.keys() {
+		res[fmt.Sprintf("flood.%s", t)] = c.flood.load(t)
+	}
+
+	for _, t := range c.turnaround.keys() {
+		res[t] = c.turnaround.load(t)
+	}
 	res["utcoffset_sec"] = c.utcoffsetSec
 	res["clockaccuracy"] = c.clockaccuracy
 	res["clockclass"] = c.clockclass
+	res["config_version"] = c.configVersion
+	res["leap.next"] = c.leapNext
+	res["leap.next_unix"] = c.leapNextUnix
 	res["drain"] = c.drain
 	res["reload"] = c.reload
+	res["reload_failed"] = c.reloadFailed
 
 	return res
 }
@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
 	"github.com/stretchr/testify/require"
 )
 
@@ -75,8 +76,12 @@ func TestSyncMapInt64Counters(t *testing.T) {
 	c.utcoffsetSec = 1
 	c.clockaccuracy = 1
 	c.clockclass = 1
+	c.configVersion = 1
+	c.leapNext = 1
+	c.leapNextUnix = 1
 	c.drain = 1
 	c.reload = 1
+	c.reloadFailed = 1
 
 	require.Equal(t, int64(1), c.subscriptions.load(1))
 	require.Equal(t, int64(1), c.rx.load(1))
@@ -89,8 +94,12 @@ func TestSyncMapInt64Counters(t *testing.T) {
 	require.Equal(t, int64(1), c.utcoffsetSec)
 	require.Equal(t, int64(1), c.clockaccuracy)
 	require.Equal(t, int64(1), c.clockclass)
+	require.Equal(t, int64(1), c.configVersion)
+	require.Equal(t, int64(1), c.leapNext)
+	require.Equal(t, int64(1), c.leapNextUnix)
 	require.Equal(t, int64(1), c.drain)
 	require.Equal(t, int64(1), c.reload)
+	require.Equal(t, int64(1), c.reloadFailed)
 
 	c.reset()
 
@@ -105,8 +114,12 @@ func TestSyncMapInt64Counters(t *testing.T) {
 	require.Equal(t, int64(0), c.utcoffsetSec)
 	require.Equal(t, int64(0), c.clockaccuracy)
 	require.Equal(t, int64(0), c.clockclass)
+	require.Equal(t, int64(0), c.configVersion)
+	require.Equal(t, int64(0), c.leapNext)
+	require.Equal(t, int64(0), c.leapNextUnix)
 	require.Equal(t, int64(0), c.drain)
 	require.Equal(t, int64(0), c.reload)
+	require.Equal(t, int64(0), c.reloadFailed)
 }
 
 func TestCountersToMap(t *testing.T) {
@@ -117,11 +130,20 @@ func TestCountersToMap(t *testing.T) {
 	c.tx.store(int(ptp.MessageSync), 2)
 	c.rxSignalingGrant.store(int(ptp.MessageDelayResp), 3)
 	c.rxSignalingCancel.store(int(ptp.MessageSync), 1)
+	c.reclaimedGrant.store(int(ptp.MessageSync), 4)
+	c.grantLatency.store(int(ptp.MessageAnnounce), 5)
+	c.grantSLOBreach.store(int(ptp.MessageAnnounce), 6)
+	c.txOneStep.store(int(ptp.MessageSync), 7)
+	c.txtsFailures.store(int(timestamp.FailureDriverBug), 8)
 	c.utcoffsetSec = 1
 	c.clockaccuracy = 42
 	c.clockclass = 6
+	c.configVersion = 12
+	c.leapNext = -1
+	c.leapNextUnix = 1767225600
 	c.drain = 1
 	c.reload = 2
+	c.reloadFailed = 3
 
 	result := c.toMap()
 
@@ -130,11 +152,20 @@ func TestCountersToMap(t *testing.T) {
 	expectedMap["tx.sync"] = 2
 	expectedMap["rx.signaling.grant.delay_resp"] = 3
 	expectedMap["rx.signaling.cancel.sync"] = 1
+	expectedMap["reclaimed.grant.sync"] = 4
+	expectedMap["tx.signaling.grant.latency_ns.announce"] = 5
+	expectedMap["tx.signaling.grant.slo_breach.announce"] = 6
+	expectedMap["tx.one_step.sync"] = 7
+	expectedMap["txts.failures.driver_bug"] = 8
 	expectedMap["utcoffset_sec"] = 1
 	expectedMap["clockaccuracy"] = 42
 	expectedMap["clockclass"] = 6
+	expectedMap["config_version"] = 12
+	expectedMap["leap.next"] = -1
+	expectedMap["leap.next_unix"] = 1767225600
 	expectedMap["drain"] = 1
 	expectedMap["reload"] = 2
+	expectedMap["reload_failed"] = 3
 
 	require.Equal(t, expectedMap, result)
 }
@@ -97,15 +97,6 @@ func (c *udpConnTS) WriteToWithTS(b []byte, addr net.Addr) (int, time.Time, erro
 	return n, hwts, nil
 }
 
-// corrToDuration converts PTP CorrectionField to time.Duration, ignoring
-// case where correction is too big, and dropping fractions of nanoseconds
-func corrToDuration(correction ptp.Correction) (corr time.Duration) {
-	if !correction.TooBig() {
-		corr = time.Duration(correction.Nanoseconds())
-	}
-	return
-}
-
 // Config specifies Client run options
 type Config struct {
 	// address of a server to talk to
@@ -146,6 +137,8 @@ type Client struct {
 	clockID ptp.ClockIdentity
 	// where we store timestamps
 	m *measurements
+	// matches FollowUp to Sync and DelayResp to DelayReq, and catches duplicates
+	seq *ptp.SequenceTracker
 	// what to do when we receive latest measurement
 	callback func(*MeasurementResult)
 }
@@ -155,6 +148,7 @@ func New(cfg *Config, callback func(*MeasurementResult)) *Client {
 	c := &Client{
 		inChan:   make(chan *inPacket, 10),
 		m:        newMeasurements(),
+		seq:      ptp.NewSequenceTracker(),
 		cfg:      cfg,
 		callback: callback,
 	}
@@ -336,7 +330,11 @@ func (c *Client) handleGrantUnicast(tlv *ptp.GrantUnicastTransmissionTLV) error
 			return fmt.Errorf("server denied us grant for %s", msgType)
 		}
 		// ask for sync messages
-		seq, err := c.sendGeneralMsg(reqUnicast(c.clockID, c.cfg.Duration, ptp.MessageSync))
+		req, err := reqUnicast(c.clockID, c.cfg.Duration, ptp.MessageSync)
+		if err != nil {
+			return err
+		}
+		seq, err := c.sendGeneralMsg(req)
 		if err != nil {
 			return err
 		}
@@ -346,7 +344,11 @@ func (c *Client) handleGrantUnicast(tlv *ptp.GrantUnicastTransmissionTLV) error
 			return fmt.Errorf("server denied us grant for %s", msgType)
 		}
 		// ask for delay_resp messages
-		seq, err := c.sendGeneralMsg(reqUnicast(c.clockID, c.cfg.Duration, ptp.MessageDelayResp))
+		req, err := reqUnicast(c.clockID, c.cfg.Duration, ptp.MessageDelayResp)
+		if err != nil {
+			return err
+		}
+		seq, err := c.sendGeneralMsg(req)
 		if err != nil {
 			return err
 		}
@@ -365,7 +367,11 @@ func (c *Client) handleGrantUnicast(tlv *ptp.GrantUnicastTransmissionTLV) error
 // handleCancelUnicast handles SIGNALLING packet that marks end of unicast transmission
 func (c *Client) handleCancelUnicast(tlv *ptp.CancelUnicastTransmissionTLV) error {
 	c.logReceive(ptp.MessageSignaling, "unicast transmission cancelled, dying")
-	seq, err := c.sendGeneralMsg(reqAckCancelUnicast(c.clockID, tlv.MsgTypeAndFlags.MsgType()))
+	req, err := reqAckCancelUnicast(c.clockID, tlv.MsgTypeAndFlags.MsgType())
+	if err != nil {
+		return err
+	}
+	seq, err := c.sendGeneralMsg(req)
 	if err != nil {
 		return err
 	}
@@ -385,16 +391,16 @@ func (c *Client) handleAnnounce(b *ptp.Announce) error {
 
 // handleSync handles SYNC packet and adds send timestamp to measurements
 func (c *Client) handleSync(b *ptp.SyncDelayReq, ts time.Time) error {
-	c.logReceive(ptp.MessageSync, "seq=%d, our ReceiveTimestamp(T2)=%v, correctionField(C1)=%v", b.SequenceID, ts, corrToDuration(b.CorrectionField))
-	c.m.addSync(b.SequenceID, ts, corrToDuration(b.CorrectionField))
+	c.logReceive(ptp.MessageSync, "seq=%d, our ReceiveTimestamp(T2)=%v, correctionField(C1)=%v", b.SequenceID, ts, b.CorrectionField.Duration())
+	c.m.addSync(b.SequenceID, ts, b.CorrectionField.Duration())
 	return nil
 }
 
 // handleDelay handles DELAY packet and adds ReceiveTimestamp to measurements
 func (c *Client) handleDelay(b *ptp.DelayResp) error {
-	c.logReceive(ptp.MessageDelayResp, "seq=%d, server ReceiveTimestamp(T4)=%v, correctionField(C3)=%v", b.SequenceID, b.ReceiveTimestamp.Time(), corrToDuration(b.CorrectionField))
+	c.logReceive(ptp.MessageDelayResp, "seq=%d, server ReceiveTimestamp(T4)=%v, correctionField(C3)=%v", b.SequenceID, b.ReceiveTimestamp.Time(), b.CorrectionField.Duration())
 	// store data in measurements
-	c.m.addDelayResp(b.SequenceID, b.ReceiveTimestamp.Time(), corrToDuration(b.CorrectionField))
+	c.m.addDelayResp(b.SequenceID, b.ReceiveTimestamp.Time(), b.CorrectionField.Duration())
 
 	// do whatever needs to be done with current measurements
 	res, err := c.m.latest()
@@ -408,18 +414,29 @@ func (c *Client) handleDelay(b *ptp.DelayResp) error {
 
 // handleFollowUp handles FOLLOW_UP packet and sends DELAY_REQ packet
 func (c *Client) handleFollowUp(b *ptp.FollowUp) error {
-	c.logReceive(ptp.MessageFollowUp, "seq=%d, server PreciseOriginTimestamp(T1)=%v, correctionField(C2)=%v", b.SequenceID, b.PreciseOriginTimestamp.Time(), corrToDuration(b.CorrectionField))
-	c.m.addFollowUp(b.SequenceID, b.PreciseOriginTimestamp.Time(), corrToDuration(b.CorrectionField))
+	c.logReceive(ptp.MessageFollowUp, "seq=%d, server PreciseOriginTimestamp(T1)=%v, correctionField(C2)=%v", b.SequenceID, b.PreciseOriginTimestamp.Time(), b.CorrectionField.Duration())
+	c.m.addFollowUp(b.SequenceID, b.PreciseOriginTimestamp.Time(), b.CorrectionField.Duration())
 	// ask for delay
 	seq, hwts, err := c.sendEventMsg(reqDelay(c.clockID))
 	if err != nil {
 		return err
 	}
 	c.m.addDelayReq(seq, hwts)
+	c.seq.Sent(ptp.MessageDelayReq, seq)
 	c.logSent(ptp.MessageDelayReq, "seq=%d, our TransmissionTimestamp(T3)=%v", seq, hwts)
 	return nil
 }
 
+// checkSequence tells if the message is worth handling: duplicates and stale messages are dropped
+func (c *Client) checkSequence(h *ptp.Header) bool {
+	status := c.seq.Observe(h.SourcePortIdentity, h.MessageType(), h.SequenceID)
+	if !status.Accept() {
+		c.logReceive(h.MessageType(), "seq=%d is %s, ignoring", h.SequenceID, status)
+		return false
+	}
+	return true
+}
+
 // dispatch handler based on msg type
 func (c *Client) handleMsg(msg *inPacket) error {
 	msgType, err := ptp.ProbeMsgType(msg.data)
@@ -460,18 +477,27 @@ func (c *Client) handleMsg(msg *inPacket) error {
 		if err := ptp.FromBytes(msg.data, b); err != nil {
 			return fmt.Errorf("reading sync msg: %w", err)
 		}
+		if !c.checkSequence(&b.Header) {
+			return nil
+		}
 		return c.handleSync(b, msg.ts)
 	case ptp.MessageDelayResp:
 		b := &ptp.DelayResp{}
 		if err := ptp.FromBytes(msg.data, b); err != nil {
 			return fmt.Errorf("reading delay_resp msg: %w", err)
 		}
+		if !c.checkSequence(&b.Header) {
+			return nil
+		}
 		return c.handleDelay(b)
 	case ptp.MessageFollowUp:
 		b := &ptp.FollowUp{}
 		if err := ptp.FromBytes(msg.data, b); err != nil {
 			return fmt.Errorf("reading follow_up msg: %w", err)
 		}
+		if !c.checkSequence(&b.Header) {
+			return nil
+		}
 		return c.handleFollowUp(b)
 	default:
 		c.logReceive(msgType, "unsupported, ignoring")
@@ -525,7 +551,11 @@ func (c *Client) runInternal(skipSetup bool) error {
 			default:
 				switch c.state {
 				case stateInit:
-					seq, err := c.sendGeneralMsg(reqUnicast(c.clockID, c.cfg.Duration, ptp.MessageAnnounce))
+					req, err := reqUnicast(c.clockID, c.cfg.Duration, ptp.MessageAnnounce)
+					if err != nil {
+						return err
+					}
+					seq, err := c.sendGeneralMsg(req)
 					if err != nil {
 						return err
 					}
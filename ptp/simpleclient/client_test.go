@@ -237,7 +237,7 @@ func TestClientRun(t *testing.T) {
 			default:
 				t.Errorf("got unexpected grant for %s", msgType)
 			}
-		case *ptp.CancelUnicastTransmissionTLV:
+		case *ptp.AcknowledgeCancelUnicastTransmissionTLV:
 			return 0, nil
 		default:
 			t.Errorf("got unsupported TLV type %s(%d)", tlv.Type(), tlv.Type())
@@ -306,3 +306,23 @@ func TestClientTimeout(t *testing.T) {
 	require.Error(t, err, "full client run should fail")
 	assert.Equal(t, 0, len(history))
 }
+
+func TestClientDuplicateFollowUp(t *testing.T) {
+	c := New(&Config{}, func(m *MeasurementResult) {})
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	eventConn := NewMockUDPConnWithTS(ctrl)
+	c.eventConn = eventConn
+	// only one DelayReq is sent
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).Return(10, time.Now(), nil)
+
+	syncBytes, err := ptp.Bytes(syncPkt(1))
+	require.NoError(t, err)
+	require.NoError(t, c.handleMsg(&inPacket{data: syncBytes, ts: time.Now()}))
+	fwupBytes, err := ptp.Bytes(fwupPkt(1))
+	require.NoError(t, err)
+	require.NoError(t, c.handleMsg(&inPacket{data: fwupBytes}))
+	require.NoError(t, c.handleMsg(&inPacket{data: fwupBytes}))
+	require.Equal(t, uint64(1), c.seq.Stats().Duplicates)
+}
@@ -24,69 +24,16 @@ import (
 )
 
 // reqUnicast is a helper to build ptp.RequestUnicastTransmission
-func reqUnicast(clockID ptp.ClockIdentity, duration time.Duration, what ptp.MessageType) *ptp.Signaling {
-	l := binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.RequestUnicastTransmissionTLV{})
-	return &ptp.Signaling{
-		Header: ptp.Header{
-			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSignaling, 0),
-			Version:         ptp.Version,
-			SequenceID:      0, // will be populated on sending
-			MessageLength:   uint16(l),
-			FlagField:       ptp.FlagUnicast,
-			SourcePortIdentity: ptp.PortIdentity{
-				PortNumber:    1,
-				ClockIdentity: clockID,
-			},
-			LogMessageInterval: 0x7f,
-		},
-		TargetPortIdentity: ptp.PortIdentity{
-			PortNumber:    0xffff,
-			ClockIdentity: 0xffffffffffffffff,
-		},
-		TLVs: []ptp.TLV{
-			&ptp.RequestUnicastTransmissionTLV{
-				TLVHead: ptp.TLVHead{
-					TLVType:     ptp.TLVRequestUnicastTransmission,
-					LengthField: uint16(binary.Size(ptp.RequestUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{})),
-				},
-				MsgTypeAndReserved:    ptp.NewUnicastMsgTypeAndFlags(what, 0),
-				LogInterMessagePeriod: 1,
-				DurationField:         uint32(duration.Seconds()), // seconds
-			},
-		},
-	}
+func reqUnicast(clockID ptp.ClockIdentity, duration time.Duration, what ptp.MessageType) (*ptp.Signaling, error) {
+	source := ptp.PortIdentity{PortNumber: 1, ClockIdentity: clockID}
+	// SequenceID will be populated on sending
+	return ptp.NewSignalingBuilder(source, ptp.DefaultTargetPortIdentity, 0).RequestUnicast(what, 1, duration).Build()
 }
 
 // reqAckCancelUnicast is a helper to build ptp.AcknowledgeCancelUnicastTransmission
-func reqAckCancelUnicast(clockID ptp.ClockIdentity, what ptp.MessageType) *ptp.Signaling {
-	l := binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.AcknowledgeCancelUnicastTransmissionTLV{})
-	return &ptp.Signaling{
-		Header: ptp.Header{
-			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSignaling, 0),
-			Version:         ptp.Version,
-			SequenceID:      0, // will be populated on sending
-			MessageLength:   uint16(l),
-			FlagField:       ptp.FlagUnicast,
-			SourcePortIdentity: ptp.PortIdentity{
-				PortNumber:    1,
-				ClockIdentity: clockID,
-			},
-			LogMessageInterval: 0x7f,
-		},
-		TargetPortIdentity: ptp.PortIdentity{
-			PortNumber:    0xffff,
-			ClockIdentity: 0xffffffffffffffff,
-		},
-		TLVs: []ptp.TLV{
-			&ptp.AcknowledgeCancelUnicastTransmissionTLV{
-				TLVHead: ptp.TLVHead{
-					TLVType:     ptp.TLVCancelUnicastTransmission,
-					LengthField: uint16(binary.Size(ptp.AcknowledgeCancelUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{})),
-				},
-				MsgTypeAndFlags: ptp.NewUnicastMsgTypeAndFlags(what, 0),
-			},
-		},
-	}
+func reqAckCancelUnicast(clockID ptp.ClockIdentity, what ptp.MessageType) (*ptp.Signaling, error) {
+	source := ptp.PortIdentity{PortNumber: 1, ClockIdentity: clockID}
+	return ptp.NewSignalingBuilder(source, ptp.DefaultTargetPortIdentity, 0).AcknowledgeCancelUnicast(what).Build()
 }
 
 // reqDelay is a helper to build ptp.SyncDelayReq
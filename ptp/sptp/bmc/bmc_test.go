@@ -114,3 +114,18 @@ func TestTelcoDscmp(t *testing.T) {
 	require.Equal(t, TelcoDscmp(&lp1, &lp2, 1, 2), ABetter)
 	require.Equal(t, TelcoDscmp(&lp1, &lp2, 2, 1), BBetter)
 }
+
+func TestForProfile(t *testing.T) {
+	// a has better priority1, b has better priority2 and local priority
+	a := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterPriority1: 1, GrandmasterPriority2: 2}}
+	b := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterPriority1: 2, GrandmasterPriority2: 1}}
+	require.Equal(t, ABetter, ForProfile(ptp.ProfileDefault)(&a, &b, 2, 1))
+	require.Equal(t, ABetter, ForProfile(ptp.ProfileSMPTE)(&a, &b, 2, 1))
+	require.Equal(t, BBetter, ForProfile(ptp.ProfileG8275_1)(&a, &b, 2, 1))
+	require.Equal(t, BBetter, ForProfile(ptp.ProfileG8275_2)(&a, &b, 2, 1))
+
+	// telecom profiles break ties with local priority
+	b.GrandmasterPriority2 = 2
+	require.Equal(t, BBetter, ForProfile(ptp.ProfileG8275_2)(&a, &b, 2, 1))
+	require.Equal(t, ABetter, ForProfile(ptp.ProfileG8275_2)(&a, &b, 1, 2))
+}
@@ -0,0 +1,39 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bmc
+
+import (
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// Comparator compares two Announces, taking local priorities of their ports into account if the profile uses them
+type Comparator func(a, b *ptp.Announce, localPrioA, localPrioB int) ComparisonResult
+
+// DefaultDscmp is Dscmp as Comparator, ignoring local priorities
+func DefaultDscmp(a, b *ptp.Announce, _, _ int) ComparisonResult {
+	return Dscmp(a, b)
+}
+
+// ForProfile returns BMCA comparator of the profile.
+// Telecom profiles use alternate BMCA which ignores priority1 and breaks ties with localPriority,
+// others use default data set comparison
+func ForProfile(p ptp.Profile) Comparator {
+	if p.Preset().LocalPriority {
+		return TelcoDscmp
+	}
+	return DefaultDscmp
+}
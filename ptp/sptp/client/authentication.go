@@ -0,0 +1,84 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// minAuthKeyLength is the shortest key we accept for HMAC-SHA256-128
+const minAuthKeyLength = 16
+
+// AuthenticationConfig describes message authentication with AUTHENTICATION TLV (IEEE 1588-2019 section 16.14),
+// using HMAC-SHA256-128 and keys shared with GMs
+type AuthenticationConfig struct {
+	SPP     uint8             `yaml:"spp"`     // Security Parameters Pointer
+	Keys    map[uint32]string `yaml:"keys"`    // key ID to hex encoded key
+	Servers map[string]uint32 `yaml:"servers"` // ID of the key shared with the server. Messages to and from other servers are not authenticated
+}
+
+// Validate AuthenticationConfig is sane
+func (c *AuthenticationConfig) Validate() error {
+	for id, k := range c.Keys {
+		key, err := hex.DecodeString(k)
+		if err != nil {
+			return fmt.Errorf("key %d must be hex encoded: %w", id, err)
+		}
+		if len(key) < minAuthKeyLength {
+			return fmt.Errorf("key %d must be at least %d bytes long", id, minAuthKeyLength)
+		}
+	}
+	for server, id := range c.Servers {
+		if _, found := c.Keys[id]; !found {
+			return fmt.Errorf("unknown key %d is specified for server %q", id, server)
+		}
+	}
+	return nil
+}
+
+// authenticator signs messages we send to the server and verifies messages we receive from it
+type authenticator struct {
+	spp   uint8
+	keyID uint32
+	key   []byte
+}
+
+// newAuthenticator returns authenticator for the server, nil if messages to and from the server are not authenticated
+func newAuthenticator(cfg *AuthenticationConfig, server string) (*authenticator, error) {
+	id, found := cfg.Servers[server]
+	if !found {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(cfg.Keys[id])
+	if err != nil {
+		return nil, fmt.Errorf("decoding key %d: %w", id, err)
+	}
+	return &authenticator{spp: cfg.SPP, keyID: id, key: key}, nil
+}
+
+// sign appends AUTHENTICATION TLV to the message
+func (a *authenticator) sign(b []byte) ([]byte, error) {
+	return ptp.SignMessage(b, a.spp, a.keyID, a.key)
+}
+
+// verify checks message carries valid AUTHENTICATION TLV
+func (a *authenticator) verify(b []byte) error {
+	return ptp.VerifyMessage(b, a.spp, a.keyID, a.key)
+}
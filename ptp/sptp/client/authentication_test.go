@@ -0,0 +1,123 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+const testAuthKey = "000102030405060708090a0b0c0d0e0f"
+
+func TestAuthenticationConfigValidate(t *testing.T) {
+	require.NoError(t, (&AuthenticationConfig{}).Validate())
+	cfg := &AuthenticationConfig{
+		Keys:    map[uint32]string{1: testAuthKey},
+		Servers: map[string]uint32{"192.168.0.10": 1},
+	}
+	require.NoError(t, cfg.Validate())
+
+	cfg.Servers["192.168.0.11"] = 2
+	require.Error(t, cfg.Validate())
+	delete(cfg.Servers, "192.168.0.11")
+
+	cfg.Keys[2] = "not hex"
+	require.Error(t, cfg.Validate())
+	cfg.Keys[2] = "0001"
+	require.Error(t, cfg.Validate())
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	cfg := &AuthenticationConfig{
+		SPP:     3,
+		Keys:    map[uint32]string{1: testAuthKey},
+		Servers: map[string]uint32{"192.168.0.10": 1},
+	}
+	a, err := newAuthenticator(cfg, "192.168.0.11")
+	require.NoError(t, err)
+	require.Nil(t, a, "server is not authenticated")
+
+	a, err = newAuthenticator(cfg, "192.168.0.10")
+	require.NoError(t, err)
+	key, err := hex.DecodeString(testAuthKey)
+	require.NoError(t, err)
+	require.Equal(t, &authenticator{spp: 3, keyID: 1, key: key}, a)
+}
+
+func TestClientRunAuthenticated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cid := ptp.ClockIdentity(0xc42a1fffe6d7ca6)
+
+	eventConn := NewMockUDPConnWithTS(ctrl)
+	statsServer := NewMockStatsServer(ctrl)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, &MeasurementConfig{}, statsServer)
+	require.NoError(t, err)
+	c.auth, err = newAuthenticator(&AuthenticationConfig{
+		Keys:    map[uint32]string{1: testAuthKey},
+		Servers: map[string]uint32{"127.0.0.1": 1},
+	}, "127.0.0.1")
+	require.NoError(t, err)
+	spoofer := &authenticator{keyID: 1, key: []byte("0123456789abcdef")}
+
+	sign := func(a *authenticator, p ptp.Packet) []byte {
+		b, err := ptp.Bytes(p)
+		require.NoError(t, err)
+		if a == nil {
+			return b
+		}
+		b, err = a.sign(b)
+		require.NoError(t, err)
+		return b
+	}
+
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.sync", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.announce", int64(1))
+	// unauthenticated and spoofed announces are dropped
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.auth_failed", int64(1)).Times(2)
+	var announce *ptp.Announce
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).DoAndReturn(func(b []byte, _ net.Addr) (int, time.Time, error) {
+		require.NoError(t, c.auth.verify(b), "delay request must be signed")
+		delayReq := &ptp.SyncDelayReq{}
+		require.NoError(t, ptp.FromBytes(b, delayReq))
+		seq := int(delayReq.SequenceID)
+
+		c.rx.push(&inPacket{data: sign(c.auth, syncPkt(seq)), ts: time.Now()})
+		spoofed := announcePkt(seq)
+		spoofed.CurrentUTCOffset = 1
+		c.rx.push(&inPacket{data: sign(nil, spoofed)})
+		c.rx.push(&inPacket{data: sign(spoofer, spoofed)})
+		announce = announcePkt(seq)
+		c.rx.push(&inPacket{data: sign(c.auth, announce)})
+		return len(b), time.Now(), nil
+	})
+
+	runResult := c.RunOnce(context.Background(), 100*time.Millisecond)
+	require.NoError(t, runResult.Error)
+	require.NotNil(t, runResult.Measurement)
+	require.Equal(t, announce.CurrentUTCOffset, runResult.Measurement.Announce.CurrentUTCOffset)
+	require.Equal(t, announce.SequenceID, runResult.Measurement.Announce.SequenceID)
+}
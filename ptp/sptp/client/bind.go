@@ -0,0 +1,56 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindToDevice restricts socket to the interface or VRF device, see SO_BINDTODEVICE in socket(7)
+func bindToDevice(fd int, device string) error {
+	return unix.SetsockoptString(fd, unix.SOL_SOCKET, unix.SO_BINDTODEVICE, device)
+}
+
+// listenUDP binds to the port on all addresses. If device is set, socket is bound to it before binding to the port,
+// so it's only reachable (and only routes) via this interface or VRF
+func listenUDP(port int, device string) (*net.UDPConn, error) {
+	lc := net.ListenConfig{}
+	if device != "" {
+		lc.Control = func(_, _ string, c syscall.RawConn) error {
+			var serr error
+			if err := c.Control(func(fd uintptr) {
+				serr = bindToDevice(int(fd), device)
+			}); err != nil {
+				return err
+			}
+			if serr != nil {
+				return fmt.Errorf("binding socket to device %q: %w", device, serr)
+			}
+			return nil
+		}
+	}
+	conn, err := lc.ListenPacket(context.Background(), "udp", net.JoinHostPort("::", fmt.Sprint(port)))
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
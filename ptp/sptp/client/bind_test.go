@@ -0,0 +1,50 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/facebook/time/timestamp"
+)
+
+func TestListenUDP(t *testing.T) {
+	conn, err := listenUDP(0, "")
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NotZero(t, conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func TestListenUDPBindToDevice(t *testing.T) {
+	conn, err := listenUDP(0, "lo")
+	if err != nil {
+		t.Skipf("binding to device is not permitted: %v", err)
+	}
+	defer conn.Close()
+	fd, err := timestamp.ConnFd(conn)
+	require.NoError(t, err)
+	device, err := unix.GetsockoptString(fd, unix.SOL_SOCKET, unix.SO_BINDTODEVICE)
+	require.NoError(t, err)
+	require.Equal(t, "lo", device)
+
+	_, err = listenUDP(0, "nosuchdevice0")
+	require.Error(t, err)
+}
@@ -17,12 +17,15 @@ limitations under the License.
 package client
 
 import (
+	"sort"
+
 	ptp "github.com/facebook/time/ptp/protocol"
 
 	"github.com/facebook/time/ptp/sptp/bmc"
 )
 
-func bmca(msgs []*ptp.Announce, prios map[ptp.ClockIdentity]int) *ptp.Announce {
+// bmca selects best announce using cmp. Optional tieBreak is consulted when announces are equal in everything but GM identities.
+func bmca(msgs []*ptp.Announce, prios map[ptp.ClockIdentity]int, cmp bmc.Comparator, tieBreak func(a, b *ptp.Announce) bmc.ComparisonResult) *ptp.Announce {
 	if len(msgs) == 0 {
 		return nil
 	}
@@ -32,9 +35,41 @@ func bmca(msgs []*ptp.Announce, prios map[ptp.ClockIdentity]int) *ptp.Announce {
 		b := msg
 		localPrioA := prios[a.AnnounceBody.GrandmasterIdentity]
 		localPrioB := prios[b.AnnounceBody.GrandmasterIdentity]
-		if bmc.TelcoDscmp(a, b, localPrioA, localPrioB) < 0 {
+		if tieBreak != nil && announcesEqual(cmp, a, b, localPrioA, localPrioB) {
+			if cr := tieBreak(a, b); cr != bmc.Unknown {
+				if cr < 0 {
+					best = b
+				}
+				continue
+			}
+		}
+		if cmp(a, b, localPrioA, localPrioB) < 0 {
 			best = b
 		}
 	}
 	return best
 }
+
+// bmcaDomains runs BMCA within each PTP domain, and returns best announce of the most preferred domain which has any.
+// Domains of equal priority are preferred by domain number.
+func bmcaDomains(msgs []*ptp.Announce, prios map[ptp.ClockIdentity]int, domainPrio func(domain int) int, cmp bmc.Comparator, tieBreak func(a, b *ptp.Announce) bmc.ComparisonResult) *ptp.Announce {
+	byDomain := map[uint8][]*ptp.Announce{}
+	for _, msg := range msgs {
+		byDomain[msg.DomainNumber] = append(byDomain[msg.DomainNumber], msg)
+	}
+	if len(byDomain) < 2 {
+		return bmca(msgs, prios, cmp, tieBreak)
+	}
+	domains := make([]uint8, 0, len(byDomain))
+	for domain := range byDomain {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		pi, pj := domainPrio(int(domains[i])), domainPrio(int(domains[j]))
+		if pi != pj {
+			return pi < pj
+		}
+		return domains[i] < domains[j]
+	})
+	return bmca(byDomain[domains[0]], prios, cmp, tieBreak)
+}
@@ -18,6 +18,7 @@ package client
 
 import (
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/sptp/bmc"
 	"github.com/stretchr/testify/require"
 	"testing"
 )
@@ -25,13 +26,69 @@ import (
 func TestBmcaProperlyUsesClockQuality(t *testing.T) {
 	best := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: ptp.ClockClass7}}}
 	worse := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: ptp.ClockClass13}}}
-	selected := bmca([]*ptp.Announce{&best, &worse}, map[ptp.ClockIdentity]int{1: 2, 2: 1})
+	selected := bmca([]*ptp.Announce{&best, &worse}, map[ptp.ClockIdentity]int{1: 2, 2: 1}, bmc.TelcoDscmp, nil)
 	require.Equal(t, best, *selected)
 }
 
 func TestBmcaProperlyUsesLocalPriority(t *testing.T) {
 	best := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterPriority1: 1}}  // GrandMasterIdentity is ignored with TelcoDscmp
 	worse := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterPriority1: 2}} // GrandMasterIdentity is ignored with TelcoDscmp
-	selected := bmca([]*ptp.Announce{&best, &worse}, map[ptp.ClockIdentity]int{1: 1, 2: 2})
+	selected := bmca([]*ptp.Announce{&best, &worse}, map[ptp.ClockIdentity]int{1: 1, 2: 2}, bmc.TelcoDscmp, nil)
 	require.Equal(t, best, *selected)
 }
+
+func TestBmcaTieBreak(t *testing.T) {
+	a := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1}}
+	b := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2}}
+	preferB := func(_, _ *ptp.Announce) bmc.ComparisonResult { return bmc.BBetter }
+	noPreference := func(_, _ *ptp.Announce) bmc.ComparisonResult { return bmc.Unknown }
+
+	selected := bmca([]*ptp.Announce{&a, &b}, map[ptp.ClockIdentity]int{1: 1, 2: 1}, bmc.TelcoDscmp, nil)
+	require.Equal(t, a, *selected)
+	selected = bmca([]*ptp.Announce{&a, &b}, map[ptp.ClockIdentity]int{1: 1, 2: 1}, bmc.TelcoDscmp, noPreference)
+	require.Equal(t, a, *selected)
+	selected = bmca([]*ptp.Announce{&a, &b}, map[ptp.ClockIdentity]int{1: 1, 2: 1}, bmc.TelcoDscmp, preferB)
+	require.Equal(t, b, *selected)
+	// local priority wins over tie-break
+	selected = bmca([]*ptp.Announce{&a, &b}, map[ptp.ClockIdentity]int{1: 1, 2: 2}, bmc.TelcoDscmp, preferB)
+	require.Equal(t, a, *selected)
+}
+
+func TestBmcaTieBreakDefaultProfile(t *testing.T) {
+	a := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterPriority1: 128}}
+	b := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterPriority1: 128}}
+	preferB := func(_, _ *ptp.Announce) bmc.ComparisonResult { return bmc.BBetter }
+
+	selected := bmca([]*ptp.Announce{&a, &b}, map[ptp.ClockIdentity]int{}, bmc.DefaultDscmp, preferB)
+	require.Equal(t, b, *selected)
+	// priority1 wins over tie-break
+	b.GrandmasterPriority1 = 129
+	selected = bmca([]*ptp.Announce{&a, &b}, map[ptp.ClockIdentity]int{}, bmc.DefaultDscmp, preferB)
+	require.Equal(t, a, *selected)
+}
+
+func TestBmcaDomains(t *testing.T) {
+	prod := ptp.Announce{Header: ptp.Header{DomainNumber: 0}, AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: ptp.ClockClass13}}}
+	prodBetter := ptp.Announce{Header: ptp.Header{DomainNumber: 0}, AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: ptp.ClockClass7}}}
+	canary := ptp.Announce{Header: ptp.Header{DomainNumber: 24}, AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 3, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: ptp.ClockClass6}}}
+	prios := map[ptp.ClockIdentity]int{1: 1, 2: 2, 3: 1}
+	domainPrios := map[int]int{0: 1, 24: 2}
+	domainPrio := func(domain int) int { return domainPrios[domain] }
+
+	// BMCA runs within most preferred domain, even if other domain has better GM
+	selected := bmcaDomains([]*ptp.Announce{&canary, &prod, &prodBetter}, prios, domainPrio, bmc.TelcoDscmp, nil)
+	require.Equal(t, prodBetter, *selected)
+	// other domain is used when preferred one has no GMs
+	selected = bmcaDomains([]*ptp.Announce{&canary}, prios, domainPrio, bmc.TelcoDscmp, nil)
+	require.Equal(t, canary, *selected)
+	// domain priority decides
+	domainPrios = map[int]int{0: 2, 24: 1}
+	selected = bmcaDomains([]*ptp.Announce{&prod, &prodBetter, &canary}, prios, domainPrio, bmc.TelcoDscmp, nil)
+	require.Equal(t, canary, *selected)
+	// domain number breaks ties
+	domainPrios = map[int]int{}
+	selected = bmcaDomains([]*ptp.Announce{&canary, &prod}, prios, domainPrio, bmc.TelcoDscmp, nil)
+	require.Equal(t, prod, *selected)
+
+	require.Nil(t, bmcaDomains(nil, prios, domainPrio, bmc.TelcoDscmp, nil))
+}
@@ -0,0 +1,92 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/facebook/time/phc"
+)
+
+// BridgeConfig describes disciplining a PHC other than the one timestamping packets, like PHC of another NIC or a timecard
+type BridgeConfig struct {
+	Device   string        `yaml:"device"`    // PHC to discipline, like /dev/ptp1. Disabled if empty
+	MaxDelay time.Duration `yaml:"max_delay"` // leave the clock as is if reading either PHC took longer than this, 0 means no limit
+}
+
+// Validate BridgeConfig is sane
+func (c *BridgeConfig) Validate() error {
+	if c.MaxDelay < 0 {
+		return fmt.Errorf("max_delay must be 0 or positive")
+	}
+	return nil
+}
+
+// bridge measures offset between PHC timestamping packets and PHC we discipline, so offset of the latter from GM is known.
+// Timestamping PHC is left free running, and both are cross-timestamped against system clock every tick
+type bridge struct {
+	cfg    *BridgeConfig
+	source string
+	stats  StatsServer
+	// returns offset between system clock and PHC device, like PTP_SYS_OFFSET_EXTENDED
+	sysoff func(device string) (phc.SysoffResult, error)
+}
+
+// newBridge creates bridge from PHC source timestamping packets to PHC of cfg
+func newBridge(cfg *BridgeConfig, source string, stats StatsServer) *bridge {
+	return &bridge{
+		cfg:    cfg,
+		source: source,
+		stats:  stats,
+		sysoff: func(device string) (phc.SysoffResult, error) {
+			return phc.TimeAndOffsetFromDevice(device, phc.MethodIoctlSysOffsetExtended)
+		},
+	}
+}
+
+// phcOffset returns how far target PHC is ahead of the source one, and how long it took to read both
+func (b *bridge) phcOffset() (time.Duration, time.Duration, error) {
+	src, err := b.sysoff(b.source)
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading %s: %w", b.source, err)
+	}
+	dst, err := b.sysoff(b.cfg.Device)
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading %s: %w", b.cfg.Device, err)
+	}
+	// sysoff offsets are system time minus PHC time
+	return src.Offset - dst.Offset, src.Delay + dst.Delay, nil
+}
+
+// offset turns offset of the source PHC from GM into offset of the target one
+func (b *bridge) offset(sourceOffset time.Duration) (time.Duration, error) {
+	phcOffset, delay, err := b.phcOffset()
+	if err != nil {
+		return 0, err
+	}
+	b.stats.SetCounter("ptp.sptp.bridge.phc_offset_ns", phcOffset.Nanoseconds())
+	b.stats.SetCounter("ptp.sptp.bridge.delay_ns", delay.Nanoseconds())
+	if b.cfg.MaxDelay > 0 && delay > b.cfg.MaxDelay {
+		return 0, fmt.Errorf("reading PHCs took %v, more than %v", delay, b.cfg.MaxDelay)
+	}
+	offset := sourceOffset + phcOffset
+	b.stats.SetCounter("ptp.sptp.bridge.source_offset_ns", sourceOffset.Nanoseconds())
+	b.stats.SetCounter("ptp.sptp.bridge.offset_ns", offset.Nanoseconds())
+	servoLog.Debugf("bridge: source offset %10d phc offset %10d delay %10d", sourceOffset.Nanoseconds(), phcOffset.Nanoseconds(), delay.Nanoseconds())
+	return offset, nil
+}
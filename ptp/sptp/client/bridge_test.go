@@ -0,0 +1,142 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/phc"
+	"github.com/facebook/time/servo"
+)
+
+func TestBridgeConfigValidate(t *testing.T) {
+	require.NoError(t, (&BridgeConfig{}).Validate())
+	require.NoError(t, (&BridgeConfig{Device: "/dev/ptp1", MaxDelay: 10 * time.Microsecond}).Validate())
+	require.Error(t, (&BridgeConfig{Device: "/dev/ptp1", MaxDelay: -time.Microsecond}).Validate())
+}
+
+// fakeSysoff returns offsets between system clock and PHC devices
+func fakeSysoff(offsets map[string]phc.SysoffResult, err error) func(string) (phc.SysoffResult, error) {
+	return func(device string) (phc.SysoffResult, error) {
+		if err != nil {
+			return phc.SysoffResult{}, err
+		}
+		res, ok := offsets[device]
+		if !ok {
+			return phc.SysoffResult{}, fmt.Errorf("no such device %s", device)
+		}
+		return res, nil
+	}
+}
+
+func TestBridgeOffset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStatsServer := NewMockStatsServer(ctrl)
+
+	b := newBridge(&BridgeConfig{Device: "/dev/ptp1"}, "/dev/ptp0", mockStatsServer)
+	// source PHC is 37s ahead of system clock, target one is 3us further ahead
+	b.sysoff = fakeSysoff(map[string]phc.SysoffResult{
+		"/dev/ptp0": {Offset: -37 * time.Second, Delay: 2 * time.Microsecond},
+		"/dev/ptp1": {Offset: -37*time.Second - 3*time.Microsecond, Delay: 5 * time.Microsecond},
+	}, nil)
+
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.bridge.phc_offset_ns", int64(3000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.bridge.delay_ns", int64(7000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.bridge.source_offset_ns", int64(-1000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.bridge.offset_ns", int64(2000))
+	offset, err := b.offset(-time.Microsecond)
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Microsecond, offset)
+
+	// reading PHCs took too long to trust the offset
+	b.cfg.MaxDelay = 5 * time.Microsecond
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.bridge.phc_offset_ns", int64(3000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.bridge.delay_ns", int64(7000))
+	_, err = b.offset(-time.Microsecond)
+	require.Error(t, err)
+
+	b.sysoff = fakeSysoff(nil, fmt.Errorf("no PTP_SYS_OFFSET_EXTENDED"))
+	_, err = b.offset(-time.Microsecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "/dev/ptp0")
+}
+
+func TestProcessResultsBridge(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockServo := NewMockServo(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1)).Times(2)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100)).Times(2)
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).Times(2)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any()).AnyTimes()
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	cfg.Bridge.Device = "/dev/ptp1"
+	b := newBridge(&cfg.Bridge, "/dev/ptp0", mockStatsServer)
+	p := &SPTP{
+		clock:  mockClock,
+		pi:     mockServo,
+		stats:  mockStatsServer,
+		cfg:    cfg,
+		bridge: b,
+	}
+	require.NoError(t, p.initClients())
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -100 * time.Microsecond,
+				Timestamp: ts,
+			},
+		},
+	}
+
+	// disciplined PHC is 250us ahead of the timestamping one, so it's 150us ahead of GM
+	b.sysoff = fakeSysoff(map[string]phc.SysoffResult{
+		"/dev/ptp0": {Offset: -37 * time.Second, Delay: time.Microsecond},
+		"/dev/ptp1": {Offset: -37*time.Second - 250*time.Microsecond, Delay: time.Microsecond},
+	}, nil)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.bridge.phc_offset_ns", int64(250000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.bridge.delay_ns", int64(2000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.bridge.source_offset_ns", int64(-100000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.bridge.offset_ns", int64(150000))
+	mockServo.EXPECT().Sample(int64(150*time.Microsecond), uint64(ts.UnixNano())).Return(0.0, servo.StateJump)
+	mockClock.EXPECT().Step(-150 * time.Microsecond).Return(nil)
+	p.processResults(results)
+	require.True(t, p.synced)
+
+	// clock is left alone if PHCs can't be read
+	b.sysoff = fakeSysoff(nil, fmt.Errorf("no PTP_SYS_OFFSET_EXTENDED"))
+	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.bridge.errors", int64(1))
+	p.processResults(results)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	gmstats "github.com/facebook/time/ptp/sptp/stats"
+)
+
+// maxBurstCount is how many exchanges single burst may run
+const maxBurstCount = 1024
+
+var (
+	errBurstInProgress = errors.New("burst is already in progress")
+	errBurstNotRunning = errors.New("sptp is not running")
+)
+
+// burstRequest is a request to run burst, handled by the main loop
+type burstRequest struct {
+	server   string
+	count    int
+	interval time.Duration
+	reply    chan burstReply
+}
+
+type burstReply struct {
+	result *gmstats.BurstResult
+	err    error
+}
+
+// Burst temporarily switches the GM to a high-rate burst of count exchanges every interval and returns their statistics.
+// Burst measurements never reach the servo, and while burst runs the GM is reported with its last regular results
+func (p *SPTP) Burst(ctx context.Context, server string, count int, interval time.Duration) (*gmstats.BurstResult, error) {
+	c, found := p.clients[server]
+	if !found {
+		return nil, fmt.Errorf("unknown server %q", server)
+	}
+	if c.negotiation != nil {
+		return nil, fmt.Errorf("burst is not supported with unicast negotiation")
+	}
+	if count < 1 || count > maxBurstCount {
+		return nil, fmt.Errorf("count must be between 1 and %d, got %d", maxBurstCount, count)
+	}
+	if interval < minInterval || interval > maxInterval {
+		return nil, fmt.Errorf("interval must be between %v and %v, got %v", minInterval, maxInterval, interval)
+	}
+	req := &burstRequest{
+		server:   server,
+		count:    count,
+		interval: interval,
+		reply:    make(chan burstReply, 1),
+	}
+	select {
+	case p.burstReqs <- req:
+	case <-ctx.Done():
+		return nil, errBurstNotRunning
+	}
+	select {
+	case r := <-req.reply:
+		return r.result, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// startBurst is called from the main loop. GM is excluded from regular exchanges until burst is done
+func (p *SPTP) startBurst(ctx context.Context, req *burstRequest) {
+	if p.bursting != "" {
+		req.reply <- burstReply{err: errBurstInProgress}
+		return
+	}
+	p.bursting = req.server
+	c := p.clients[req.server]
+	log.Infof("starting burst of %d exchanges every %v with %s", req.count, req.interval, req.server)
+	go func() {
+		res := p.runBurst(ctx, c, req.count, req.interval)
+		log.Infof("burst with %s done: %d succeeded, %d failed", req.server, res.Succeeded, res.Failed)
+		req.reply <- burstReply{result: res}
+		p.burstDone <- req.server
+	}()
+}
+
+// runBurst runs count exchanges with the GM every interval.
+// Regular measurements are set aside, so path delay filter doesn't see burst samples
+func (p *SPTP) runBurst(ctx context.Context, c *Client, count int, interval time.Duration) *gmstats.BurstResult {
+	saved := c.m
+	c.m = newMeasurements(&MeasurementConfig{})
+	defer func() {
+		c.m = saved
+	}()
+
+	timeout := p.cfg.ExchangeTimeout
+	if timeout > interval {
+		timeout = interval
+	}
+	res := &gmstats.BurstResult{
+		GMAddress: c.server,
+		Count:     count,
+		Interval:  interval.Nanoseconds(),
+		Samples:   make([]gmstats.BurstSample, 0, count),
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				res.Summarize()
+				return res
+			case <-ticker.C:
+			}
+		}
+		r := c.RunOnce(ctx, timeout)
+		s := gmstats.BurstSample{Timestamp: time.Now().UnixNano()}
+		switch {
+		case r.Error != nil:
+			s.Error = r.Error.Error()
+		case r.Measurement == nil:
+			s.Error = "missing measurement"
+		default:
+			s.Timestamp = r.Measurement.Timestamp.UnixNano()
+			s.Offset = r.Measurement.Offset.Nanoseconds()
+			s.Delay = r.Measurement.Delay.Nanoseconds()
+		}
+		res.Samples = append(res.Samples, s)
+	}
+	res.Summarize()
+	return res
+}
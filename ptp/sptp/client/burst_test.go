@@ -0,0 +1,113 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func newBurstTestSPTP(t *testing.T, ctrl *gomock.Controller, exchanges int) *SPTP {
+	mockEventConn := NewMockUDPConnWithTS(ctrl)
+	mockEventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).Times(exchanges)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1)).Times(exchanges)
+
+	p := &SPTP{
+		stats: mockStatsServer,
+		cfg: &Config{
+			Interval:        time.Second,
+			ExchangeTimeout: 10 * time.Millisecond,
+			Servers: map[string]int{
+				"192.168.0.10": 1,
+				"192.168.0.11": 2,
+			},
+		},
+		eventConn: mockEventConn,
+	}
+	require.NoError(t, p.initClients())
+	return p
+}
+
+func TestBurstValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p := newBurstTestSPTP(t, ctrl, 0)
+	ctx := context.Background()
+
+	_, err := p.Burst(ctx, "192.168.0.12", 10, time.Second)
+	require.EqualError(t, err, `unknown server "192.168.0.12"`)
+	_, err = p.Burst(ctx, "192.168.0.10", 0, time.Second)
+	require.EqualError(t, err, "count must be between 1 and 1024, got 0")
+	_, err = p.Burst(ctx, "192.168.0.10", 10, time.Millisecond)
+	require.EqualError(t, err, "interval must be between 7.8125ms and 1h0m0s, got 1ms")
+
+	// main loop is not running
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Burst(ctx, "192.168.0.10", 10, time.Second)
+	require.ErrorIs(t, err, errBurstNotRunning)
+}
+
+func TestStartBurst(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p := newBurstTestSPTP(t, ctrl, 3)
+	c := p.clients["192.168.0.10"]
+	m := c.m
+
+	req := &burstRequest{server: "192.168.0.10", count: 3, interval: 10 * time.Millisecond, reply: make(chan burstReply, 1)}
+	p.startBurst(context.Background(), req)
+	require.Equal(t, "192.168.0.10", p.bursting)
+
+	// only one burst at a time
+	other := &burstRequest{server: "192.168.0.11", count: 3, interval: 10 * time.Millisecond, reply: make(chan burstReply, 1)}
+	p.startBurst(context.Background(), other)
+	require.ErrorIs(t, (<-other.reply).err, errBurstInProgress)
+
+	r := <-req.reply
+	require.NoError(t, r.err)
+	require.Equal(t, "192.168.0.10", r.result.GMAddress)
+	require.Equal(t, 3, r.result.Count)
+	require.Equal(t, int64(10*time.Millisecond), r.result.Interval)
+	require.Len(t, r.result.Samples, 3)
+	// nobody answers
+	require.Equal(t, 0, r.result.Succeeded)
+	require.Equal(t, 3, r.result.Failed)
+	require.Equal(t, "192.168.0.10", <-p.burstDone)
+	// regular measurements are back
+	require.Same(t, m, c.m)
+}
+
+func TestExchangeSkipsBurst(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p := newBurstTestSPTP(t, ctrl, 3)
+
+	results := p.exchange(context.Background())
+	require.Len(t, results, 2)
+
+	p.bursting = "192.168.0.11"
+	results = p.exchange(context.Background())
+	require.Len(t, results, 2)
+	require.False(t, results["192.168.0.10"].stale)
+	require.True(t, results["192.168.0.11"].stale)
+}
@@ -0,0 +1,335 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/facebook/time/ptp/pcapng"
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+)
+
+const (
+	captureSnapLen = 65535
+	// packets read from general port are not timestamped by the kernel
+	captureTSUserspace = "userspace"
+)
+
+var errCaptureDisabled = errors.New("packet capture is disabled")
+
+// CaptureConfig describes in-memory capture of PTP packets exchanged with GMs, which can be dumped on demand
+type CaptureConfig struct {
+	Window     time.Duration `yaml:"window"`      // keep packets for this long, disabled if 0
+	MaxPackets int           `yaml:"max_packets"` // keep at most this many packets
+}
+
+// Validate CaptureConfig is sane
+func (c *CaptureConfig) Validate() error {
+	if c.Window < 0 {
+		return fmt.Errorf("window must be 0 or positive")
+	}
+	if c.Window > 0 && c.MaxPackets <= 0 {
+		return fmt.Errorf("max_packets must be positive")
+	}
+	return nil
+}
+
+// capturedPacket is PTP message we sent or received, with timestamp we got for it
+type capturedPacket struct {
+	// system time packet was captured at, PHC timestamps can be far from it
+	captured time.Time
+	ts       time.Time
+	tsSource string
+	outgoing bool
+	// local port for UDP, unused for L2
+	localPort int
+	peer      net.Addr
+	data      []byte
+}
+
+// captureRing keeps packets seen during last window, up to max packets
+type captureRing struct {
+	sync.Mutex
+	window  time.Duration
+	max     int
+	now     func() time.Time
+	packets []*capturedPacket
+}
+
+func newCaptureRing(cfg *CaptureConfig) *captureRing {
+	return &captureRing{
+		window: cfg.Window,
+		max:    cfg.MaxPackets,
+		now:    time.Now,
+	}
+}
+
+// add copies the packet into the ring, dropping packets which are too old or don't fit
+func (r *captureRing) add(pkt *capturedPacket) {
+	pkt.data = append([]byte(nil), pkt.data...)
+	pkt.captured = r.now()
+	if pkt.ts.IsZero() {
+		pkt.ts = pkt.captured
+		pkt.tsSource = captureTSUserspace
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.packets = append(r.packets, pkt)
+	cutoff := r.now().Add(-r.window)
+	drop := len(r.packets) - r.max
+	if drop < 0 {
+		drop = 0
+	}
+	for drop < len(r.packets) && r.packets[drop].captured.Before(cutoff) {
+		drop++
+	}
+	r.packets = r.packets[drop:]
+}
+
+// snapshot returns packets captured during last window
+func (r *captureRing) snapshot() []*capturedPacket {
+	r.Lock()
+	defer r.Unlock()
+	cutoff := r.now().Add(-r.window)
+	out := make([]*capturedPacket, 0, len(r.packets))
+	for _, pkt := range r.packets {
+		if !pkt.captured.Before(cutoff) {
+			out = append(out, pkt)
+		}
+	}
+	return out
+}
+
+// captureEndpoints are addresses of our side, used to rebuild headers kernel added to captured packets
+type captureEndpoints struct {
+	iface string
+	mac   net.HardwareAddr
+	ipv4  net.IP
+	ipv6  net.IP
+}
+
+// newCaptureEndpoints picks MAC and first global unicast addresses of the interface
+func newCaptureEndpoints(iface *net.Interface) *captureEndpoints {
+	e := &captureEndpoints{
+		iface: iface.Name,
+		mac:   iface.HardwareAddr,
+		ipv4:  net.IPv4zero.To4(),
+		ipv6:  net.IPv6unspecified,
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return e
+	}
+	v4, v6 := false, false
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || !ipnet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if ip := ipnet.IP.To4(); ip != nil && !v4 {
+			e.ipv4, v4 = ip, true
+		} else if ip == nil && !v6 {
+			e.ipv6, v6 = ipnet.IP, true
+		}
+	}
+	return e
+}
+
+// frame wraps captured PTP message into Ethernet frame, with IP and UDP headers unless it was sent over L2
+func (e *captureEndpoints) frame(pkt *capturedPacket) ([]byte, error) {
+	eth := &layers.Ethernet{SrcMAC: e.mac, DstMAC: make(net.HardwareAddr, 6)}
+	if e.mac == nil {
+		eth.SrcMAC = make(net.HardwareAddr, 6)
+	}
+	var l []gopacket.SerializableLayer
+	switch peer := pkt.peer.(type) {
+	case *L2Addr:
+		eth.DstMAC = peer.MAC
+		eth.EthernetType = layers.EthernetType(ptp.EtherTypePTP)
+		l = []gopacket.SerializableLayer{eth}
+	case *net.UDPAddr:
+		udp := &layers.UDP{SrcPort: layers.UDPPort(pkt.localPort), DstPort: layers.UDPPort(peer.Port)}
+		var ip gopacket.NetworkLayer
+		if peer.IP.To4() != nil {
+			eth.EthernetType = layers.EthernetTypeIPv4
+			ip = &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: e.ipv4, DstIP: peer.IP.To4()}
+		} else {
+			eth.EthernetType = layers.EthernetTypeIPv6
+			ip = &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: e.ipv6, DstIP: peer.IP}
+		}
+		if err := udp.SetNetworkLayerForChecksum(ip); err != nil {
+			return nil, err
+		}
+		l = []gopacket.SerializableLayer{eth, ip.(gopacket.SerializableLayer), udp}
+	default:
+		return nil, fmt.Errorf("unsupported peer address %v", pkt.peer)
+	}
+	if !pkt.outgoing {
+		reverse(eth, l)
+	}
+	l = append(l, gopacket.Payload(pkt.data))
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, l...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// reverse swaps source and destination in all headers, so frame looks like it was received
+func reverse(eth *layers.Ethernet, l []gopacket.SerializableLayer) {
+	eth.SrcMAC, eth.DstMAC = eth.DstMAC, eth.SrcMAC
+	for _, layer := range l {
+		switch v := layer.(type) {
+		case *layers.IPv4:
+			v.SrcIP, v.DstIP = v.DstIP, v.SrcIP
+		case *layers.IPv6:
+			v.SrcIP, v.DstIP = v.DstIP, v.SrcIP
+		case *layers.UDP:
+			v.SrcPort, v.DstPort = v.DstPort, v.SrcPort
+		}
+	}
+}
+
+// writePcapng writes captured packets as pcapng, annotating every packet with its timestamp source, direction and decoded message
+func (r *captureRing) writePcapng(w io.Writer, e *captureEndpoints) error {
+	pw, err := pcapng.NewWriter(w, "sptp capture", e.iface, layers.LinkTypeEthernet, captureSnapLen)
+	if err != nil {
+		return fmt.Errorf("writing pcapng header: %w", err)
+	}
+	for _, pkt := range r.snapshot() {
+		frame, err := e.frame(pkt)
+		if err != nil {
+			return fmt.Errorf("building frame: %w", err)
+		}
+		comment := fmt.Sprintf("peer=%s %s", pkt.peer, pcapng.Comment(pkt.tsSource, pkt.outgoing, pkt.data))
+		if err := pw.WritePacket(pkt.ts, frame, len(frame), comment); err != nil {
+			return fmt.Errorf("writing packet: %w", err)
+		}
+	}
+	return pw.Flush()
+}
+
+// captureConn records packets sent and received over connection without kernel timestamps
+type captureConn struct {
+	UDPConn
+	ring      *captureRing
+	localPort int
+}
+
+// ReadFromUDP reads packet and captures it
+func (c *captureConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	n, addr, err := c.UDPConn.ReadFromUDP(b)
+	if err == nil && addr != nil {
+		c.ring.add(&capturedPacket{localPort: c.localPort, peer: addr, data: b[:n]})
+	}
+	return n, addr, err
+}
+
+// WriteTo sends packet and captures it
+func (c *captureConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.UDPConn.WriteTo(b, addr)
+	if err == nil {
+		c.ring.add(&capturedPacket{outgoing: true, localPort: c.localPort, peer: addr, data: b})
+	}
+	return n, err
+}
+
+// captureConnTS records packets sent and received over connection, with timestamps kernel reported for them
+type captureConnTS struct {
+	UDPConnWithTS
+	ring      *captureRing
+	localPort int
+	tsSource  string
+}
+
+// WriteTo sends packet and captures it
+func (c *captureConnTS) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.UDPConnWithTS.WriteTo(b, addr)
+	if err == nil {
+		c.ring.add(&capturedPacket{outgoing: true, localPort: c.localPort, peer: addr, data: b})
+	}
+	return n, err
+}
+
+// WriteToWithTS sends packet and captures it with its TX timestamp
+func (c *captureConnTS) WriteToWithTS(b []byte, addr net.Addr) (int, time.Time, error) {
+	n, ts, err := c.UDPConnWithTS.WriteToWithTS(b, addr)
+	if err == nil || errors.Is(err, errNoTXTS) {
+		src := c.tsSource
+		if err != nil {
+			src = captureTSUserspace
+		}
+		c.ring.add(&capturedPacket{ts: ts, tsSource: src, outgoing: true, localPort: c.localPort, peer: addr, data: b})
+	}
+	return n, ts, err
+}
+
+// ReadPacketWithRXTimestamp reads packet and captures it with its RX timestamp
+func (c *captureConnTS) ReadPacketWithRXTimestamp() ([]byte, unix.Sockaddr, time.Time, error) {
+	b, sa, ts, err := c.UDPConnWithTS.ReadPacketWithRXTimestamp()
+	if err != nil {
+		return b, sa, ts, err
+	}
+	var peer net.Addr
+	switch v := sa.(type) {
+	case *unix.SockaddrLinklayer:
+		// packet socket sees our own frames as well, they are captured when sent
+		if v.Pkttype == unix.PACKET_OUTGOING {
+			return b, sa, ts, err
+		}
+		peer = &L2Addr{MAC: SockaddrToMAC(sa)}
+	case *unix.SockaddrInet4:
+		peer = &net.UDPAddr{IP: timestamp.SockaddrToIP(sa), Port: v.Port}
+	case *unix.SockaddrInet6:
+		peer = &net.UDPAddr{IP: timestamp.SockaddrToIP(sa), Port: v.Port}
+	default:
+		return b, sa, ts, err
+	}
+	c.ring.add(&capturedPacket{ts: ts, tsSource: c.tsSource, localPort: c.localPort, peer: peer, data: b})
+	return b, sa, ts, err
+}
+
+// initCapture wraps all connections so packets going through them are captured
+func (p *SPTP) initCapture(iface *net.Interface) {
+	log.Infof("capturing PTP packets exchanged during last %v", p.cfg.Capture.Window)
+	p.capture = newCaptureRing(&p.cfg.Capture)
+	p.captureEndpoints = newCaptureEndpoints(iface)
+	p.genConn = &captureConn{UDPConn: p.genConn, ring: p.capture, localPort: p.cfg.ListenGeneralPort()}
+	p.eventConn = &captureConnTS{UDPConnWithTS: p.eventConn, ring: p.capture, localPort: p.cfg.ListenEventPort(), tsSource: p.cfg.Timestamping}
+	if p.l2Conn != nil {
+		p.l2Conn = &captureConnTS{UDPConnWithTS: p.l2Conn, ring: p.capture, tsSource: p.cfg.Timestamping}
+	}
+}
+
+// WriteCapture writes packets exchanged during last capture window as pcapng
+func (p *SPTP) WriteCapture(w io.Writer) error {
+	if p.capture == nil {
+		return errCaptureDisabled
+	}
+	return p.capture.writePcapng(w, p.captureEndpoints)
+}
@@ -0,0 +1,204 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+func testCaptureSync(t *testing.T, seq uint16) []byte {
+	sync := &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSync, 0),
+			Version:         ptp.Version,
+			MessageLength:   44,
+			SequenceID:      seq,
+		},
+	}
+	b, err := ptp.Bytes(sync)
+	require.NoError(t, err)
+	return b
+}
+
+func TestCaptureConfigValidate(t *testing.T) {
+	c := &CaptureConfig{}
+	require.NoError(t, c.Validate())
+	c.Window = -time.Second
+	require.EqualError(t, c.Validate(), "window must be 0 or positive")
+	c.Window = time.Minute
+	require.EqualError(t, c.Validate(), "max_packets must be positive")
+	c.MaxPackets = 10
+	require.NoError(t, c.Validate())
+}
+
+func TestCaptureRing(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	r := newCaptureRing(&CaptureConfig{Window: time.Minute, MaxPackets: 3})
+	r.now = func() time.Time { return now }
+	peer := &net.UDPAddr{IP: net.ParseIP("192.168.0.10"), Port: 319}
+
+	data := []byte{1, 2, 3}
+	r.add(&capturedPacket{peer: peer, data: data})
+	// ring has its own copy
+	data[0] = 42
+	got := r.snapshot()
+	require.Len(t, got, 1)
+	require.Equal(t, []byte{1, 2, 3}, got[0].data)
+	require.Equal(t, now, got[0].ts)
+	require.Equal(t, captureTSUserspace, got[0].tsSource)
+
+	// PHC timestamp is kept, but window is measured in system time
+	hwts := now.Add(37 * time.Second)
+	now = now.Add(30 * time.Second)
+	r.add(&capturedPacket{ts: hwts, tsSource: HWTIMESTAMP, peer: peer, data: data})
+	got = r.snapshot()
+	require.Len(t, got, 2)
+	require.Equal(t, hwts, got[1].ts)
+	require.Equal(t, HWTIMESTAMP, got[1].tsSource)
+
+	// first packet is out of window
+	now = now.Add(31 * time.Second)
+	require.Len(t, r.snapshot(), 1)
+
+	// no more than max packets are kept
+	for i := 0; i < 5; i++ {
+		r.add(&capturedPacket{peer: peer, data: []byte{byte(i)}})
+	}
+	got = r.snapshot()
+	require.Len(t, got, 3)
+	require.Equal(t, []byte{2}, got[0].data)
+	require.Equal(t, []byte{4}, got[2].data)
+}
+
+func TestCaptureConnTS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	conn := NewMockUDPConnWithTS(ctrl)
+	r := newCaptureRing(&CaptureConfig{Window: time.Minute, MaxPackets: 10})
+	c := &captureConnTS{UDPConnWithTS: conn, ring: r, localPort: 319, tsSource: HWTIMESTAMP}
+
+	peer := &net.UDPAddr{IP: net.ParseIP("192.168.0.10"), Port: 319}
+	txts := time.Unix(1700000000, 1)
+	conn.EXPECT().WriteToWithTS([]byte{1}, peer).Return(1, txts, nil)
+	_, _, err := c.WriteToWithTS([]byte{1}, peer)
+	require.NoError(t, err)
+
+	// packet is out, so it's captured with userspace time
+	sent := time.Unix(1700000000, 2)
+	conn.EXPECT().WriteToWithTS([]byte{2}, peer).Return(1, sent, errNoTXTS)
+	_, _, err = c.WriteToWithTS([]byte{2}, peer)
+	require.ErrorIs(t, err, errNoTXTS)
+
+	rxts := time.Unix(1700000000, 3)
+	sa := &unix.SockaddrInet4{Addr: [4]byte{192, 168, 0, 10}, Port: 319}
+	conn.EXPECT().ReadPacketWithRXTimestamp().Return([]byte{3}, sa, rxts, nil)
+	_, _, _, err = c.ReadPacketWithRXTimestamp()
+	require.NoError(t, err)
+
+	// our own frames seen by packet socket are not captured twice
+	ll := &unix.SockaddrLinklayer{Pkttype: unix.PACKET_OUTGOING}
+	conn.EXPECT().ReadPacketWithRXTimestamp().Return([]byte{4}, ll, rxts, nil)
+	_, _, _, err = c.ReadPacketWithRXTimestamp()
+	require.NoError(t, err)
+
+	got := r.snapshot()
+	require.Len(t, got, 3)
+	require.Equal(t, &capturedPacket{captured: got[0].captured, ts: txts, tsSource: HWTIMESTAMP, outgoing: true, localPort: 319, peer: peer, data: []byte{1}}, got[0])
+	require.Equal(t, &capturedPacket{captured: got[1].captured, ts: sent, tsSource: captureTSUserspace, outgoing: true, localPort: 319, peer: peer, data: []byte{2}}, got[1])
+	require.Equal(t, &capturedPacket{captured: got[2].captured, ts: rxts, tsSource: HWTIMESTAMP, localPort: 319, peer: &net.UDPAddr{IP: net.IP{192, 168, 0, 10}, Port: 319}, data: []byte{3}}, got[2])
+}
+
+func TestCaptureWritePcapng(t *testing.T) {
+	r := newCaptureRing(&CaptureConfig{Window: time.Minute, MaxPackets: 10})
+	e := &captureEndpoints{
+		iface: "eth0",
+		mac:   net.HardwareAddr{0x0c, 0x42, 0xa1, 0x6d, 0x7c, 0xa6},
+		ipv4:  net.IP{192, 168, 0, 1},
+		ipv6:  net.ParseIP("fd00::1"),
+	}
+	gm6 := &net.UDPAddr{IP: net.ParseIP("fd00::2"), Port: 319}
+	gm4 := &net.UDPAddr{IP: net.IP{192, 168, 0, 2}, Port: 320}
+	gmMAC := net.HardwareAddr{0x0c, 0x42, 0xa1, 0x00, 0x00, 0x01}
+	ts := time.Unix(1700000000, 123456789)
+	r.add(&capturedPacket{ts: ts, tsSource: HWTIMESTAMP, outgoing: true, localPort: 319, peer: gm6, data: testCaptureSync(t, 1)})
+	r.add(&capturedPacket{localPort: 320, peer: gm4, data: testCaptureSync(t, 2)})
+	r.add(&capturedPacket{ts: ts, tsSource: HWTIMESTAMP, peer: &L2Addr{MAC: gmMAC}, data: testCaptureSync(t, 3)})
+
+	var out bytes.Buffer
+	require.NoError(t, r.writePcapng(&out, e))
+	require.True(t, bytes.Contains(out.Bytes(), []byte("peer=[fd00::2]:319 ts=hardware dir=out type=SYNC seq=1")))
+	require.True(t, bytes.Contains(out.Bytes(), []byte("peer=192.168.0.2:320 ts=userspace dir=in type=SYNC seq=2")))
+	require.True(t, bytes.Contains(out.Bytes(), []byte("peer=0c:42:a1:00:00:01 ts=hardware dir=in type=SYNC seq=3")))
+
+	pr, err := pcapgo.NewNgReader(bytes.NewReader(out.Bytes()), pcapgo.DefaultNgReaderOptions)
+	require.NoError(t, err)
+	require.Equal(t, layers.LinkTypeEthernet, pr.LinkType())
+
+	// sent over IPv6
+	data, ci, err := pr.ReadPacketData()
+	require.NoError(t, err)
+	require.Equal(t, ts.UnixNano(), ci.Timestamp.UnixNano())
+	pkt := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	require.Equal(t, e.mac, pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet).SrcMAC)
+	ip6 := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	require.Equal(t, e.ipv6, ip6.SrcIP)
+	require.Equal(t, gm6.IP, ip6.DstIP)
+	udp := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	require.Equal(t, layers.UDPPort(319), udp.SrcPort)
+	require.Equal(t, layers.UDPPort(319), udp.DstPort)
+	require.Equal(t, testCaptureSync(t, 1), udp.Payload)
+
+	// received over IPv4, so headers are reversed
+	data, _, err = pr.ReadPacketData()
+	require.NoError(t, err)
+	pkt = gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	require.Equal(t, e.mac, pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet).DstMAC)
+	ip4 := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	require.Equal(t, gm4.IP.To4(), ip4.SrcIP.To4())
+	require.Equal(t, e.ipv4.To4(), ip4.DstIP.To4())
+	udp = pkt.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	require.Equal(t, layers.UDPPort(320), udp.SrcPort)
+	require.Equal(t, layers.UDPPort(320), udp.DstPort)
+	require.Equal(t, testCaptureSync(t, 2), udp.Payload)
+
+	// received over L2
+	data, _, err = pr.ReadPacketData()
+	require.NoError(t, err)
+	pkt = gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	eth := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	require.Equal(t, gmMAC, eth.SrcMAC)
+	require.Equal(t, e.mac, eth.DstMAC)
+	require.Equal(t, layers.EthernetType(ptp.EtherTypePTP), eth.EthernetType)
+	require.Equal(t, testCaptureSync(t, 3), eth.Payload)
+}
+
+func TestWriteCaptureDisabled(t *testing.T) {
+	p := &SPTP{cfg: DefaultConfig()}
+	require.ErrorIs(t, p.WriteCapture(&bytes.Buffer{}), errCaptureDisabled)
+}
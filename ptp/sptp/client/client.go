@@ -24,41 +24,22 @@ import (
 	rnd "math/rand"
 	"net"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/fatih/color"
-	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	sptpproto "github.com/facebook/time/ptp/protocol/sptp"
 	"github.com/facebook/time/ptp/sptp/stats"
+	"github.com/facebook/time/timestamp"
 )
 
-// corrToDuration converts PTP CorrectionField to time.Duration, ignoring
-// case where correction is too big, and dropping fractions of nanoseconds
-func corrToDuration(correction ptp.Correction) (corr time.Duration) {
-	if !correction.TooBig() {
-		corr = time.Duration(correction.Nanoseconds())
-	}
-	return
-}
-
 // reqDelay is a helper to build ptp.SyncDelayReq
-func reqDelay(clockID ptp.ClockIdentity) *ptp.SyncDelayReq {
-	return &ptp.SyncDelayReq{
-		Header: ptp.Header{
-			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageDelayReq, 0),
-			Version:         ptp.Version,
-			SequenceID:      0, // will be populated on sending
-			MessageLength:   uint16(binary.Size(ptp.SyncDelayReq{})),
-			FlagField:       ptp.FlagUnicast | ptp.FlagProfileSpecific1,
-			SourcePortIdentity: ptp.PortIdentity{
-				PortNumber:    1,
-				ClockIdentity: clockID,
-			},
-			LogMessageInterval: 0x7f,
-		},
-	}
+func reqDelay(clockID ptp.ClockIdentity, domain uint8) *ptp.SyncDelayReq {
+	// sequence ID will be populated on sending
+	return sptpproto.NewDelayReq(ptp.PortIdentity{PortNumber: 1, ClockIdentity: clockID}, domain, 0)
 }
 
 // RunResult is what we return from single client-server interaction
@@ -66,6 +47,8 @@ type RunResult struct {
 	Server      string
 	Measurement *MeasurementResult
 	Error       error
+	// result of previous exchange, as server wasn't polled this tick
+	stale bool
 }
 
 // inPacket is input packet data + receive timestamp
@@ -80,26 +63,59 @@ type Client struct {
 	// packet sequence counter
 	eventSequence uint16
 
-	// chan for received packets regardless of port
-	inChan chan *inPacket
-	// listening connection on port 319
+	// packets received regardless of port
+	rx *rxQueue
+	// listening connection on event port, 319 by default
 	eventConn UDPConnWithTS
 	// our clockID derived from MAC address
 	clockID ptp.ClockIdentity
+	// PTP domain we talk to the server in, messages from other domains are dropped
+	domain uint8
 
-	eventAddr *net.UDPAddr
+	// UDP address of server event port or L2Addr, depending on transport
+	eventAddr net.Addr
+
+	// connection on general port and general packet sequence counter, only used with unicast negotiation
+	genConn     UDPConn
+	genAddr     net.Addr
+	genSequence uint16
+	// grants we have from the server, nil if unicast negotiation is disabled
+	negotiation *unicastNegotiation
+	// server multicasts Sync, FollowUp and Announce, we only send it DelayReq
+	hybrid bool
 
 	// where we store timestamps
 	m *measurements
+	// matches responses to requests and catches duplicates
+	seq *ptp.SequenceTracker
+	// pairs Syncs with FollowUps when server schedules Syncs itself
+	syncs *ptp.SyncMatcher
 
 	// where we store our metrics
 	stats StatsServer
+
+	// signs messages we send and verifies messages we receive, nil if messages are not authenticated
+	auth *authenticator
+
+	// use userspace send time as T3 when TX timestamp is not available
+	fallbackTXTS bool
+	// how many times we tried to get TX timestamp, and how many times we failed
+	txtsAttempts int64
+	txtsFailures int64
+	// failures because kernel didn't report TX timestamp in time, or NIC driver reported invalid one
+	txtsTimeouts   int64
+	txtsDriverBugs int64
+}
+
+// serverScheduled reports if server sends us Sync on its own schedule, independent of our DelayReq
+func (c *Client) serverScheduled() bool {
+	return c.negotiation != nil || c.hybrid
 }
 
 func (c *Client) sendEventMsg(p ptp.Packet) (uint16, time.Time, error) {
 	seq := c.eventSequence
 	p.SetSequence(c.eventSequence)
-	b, err := ptp.Bytes(p)
+	b, err := c.bytes(p)
 	if err != nil {
 		return 0, time.Time{}, err
 	}
@@ -107,32 +123,100 @@ func (c *Client) sendEventMsg(p ptp.Packet) (uint16, time.Time, error) {
 	_, hwts, err := c.eventConn.WriteToWithTS(b, c.eventAddr)
 	c.eventSequence++
 	if err != nil {
+		if errors.Is(err, errNoTXTS) {
+			atomic.AddInt64(&c.txtsAttempts, 1)
+			atomic.AddInt64(&c.txtsFailures, 1)
+			switch timestamp.Classify(err) {
+			case timestamp.FailureTXTimestampTimeout:
+				atomic.AddInt64(&c.txtsTimeouts, 1)
+			case timestamp.FailureDriverBug:
+				atomic.AddInt64(&c.txtsDriverBugs, 1)
+			}
+			// packet is out, so we still know its sequence and userspace send time
+			return seq, hwts, err
+		}
 		return 0, time.Time{}, err
 	}
+	atomic.AddInt64(&c.txtsAttempts, 1)
 
-	log.Debugf("sent packet via port %d to %v", ptp.PortEvent, c.eventAddr)
+	networkLog.Debugf("sent event packet to %v", c.eventAddr)
 	return seq, hwts, nil
 }
 
+// bytes marshals the message, adding AUTHENTICATION TLV if messages to the server are authenticated
+func (c *Client) bytes(p ptp.Packet) ([]byte, error) {
+	b, err := ptp.Bytes(p)
+	if err != nil || c.auth == nil {
+		return b, err
+	}
+	return c.auth.sign(b)
+}
+
+// sendDelayReq sends DelayReq and records its departure time
+func (c *Client) sendDelayReq() error {
+	seq, hwts, err := c.sendEventMsg(reqDelay(c.clockID, c.domain))
+	if err != nil {
+		if !c.fallbackTXTS || !canFallbackTXTS(err) {
+			return err
+		}
+		networkLog.Warningf("%s: %v, using userspace send time as T3", c.server, err)
+		c.m.addT3Fallback(seq, hwts)
+	} else {
+		c.m.addT3(seq, hwts)
+	}
+	c.seq.Sent(ptp.MessageDelayReq, seq)
+	c.logSent(ptp.MessageDelayReq, "seq=%d, our T3=%v", seq, hwts)
+	c.stats.UpdateCounterBy(fmt.Sprintf("%s%s", stats.PortStatsTxPrefix, strings.ToLower(ptp.MessageDelayReq.String())), 1)
+	return nil
+}
+
+// canFallbackTXTS reports if packet is out and its TX timestamp is just late or bogus, so userspace send time can stand in for it
+func canFallbackTXTS(err error) bool {
+	if !errors.Is(err, errNoTXTS) {
+		return false
+	}
+	return errors.Is(err, timestamp.ErrTXTimestampTimeout) || errors.Is(err, timestamp.ErrDriverBug)
+}
+
+// txtsStats returns how many times we tried to get TX timestamp, and how many times we failed
+func (c *Client) txtsStats() (attempts int64, failures int64) {
+	return atomic.LoadInt64(&c.txtsAttempts), atomic.LoadInt64(&c.txtsFailures)
+}
+
+// txtsFailureStats returns how many TX timestamp failures were timeouts, and how many were NIC driver bugs
+func (c *Client) txtsFailureStats() (timeouts int64, driverBugs int64) {
+	return atomic.LoadInt64(&c.txtsTimeouts), atomic.LoadInt64(&c.txtsDriverBugs)
+}
+
 // newClient initializes sptp client
-func newClient(target string, clockID ptp.ClockIdentity, eventConn UDPConnWithTS, mcfg *MeasurementConfig, stats StatsServer) (*Client, error) {
+func newClient(target string, eventPort int, clockID ptp.ClockIdentity, eventConn UDPConnWithTS, mcfg *MeasurementConfig, stats StatsServer) (*Client, error) {
 	// addresses
 	// where to send to
-	eventAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(target, fmt.Sprintf("%d", ptp.PortEvent)))
+	eventAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(target, fmt.Sprintf("%d", eventPort)))
 	if err != nil {
 		return nil, err
 	}
-	c := &Client{
+	return newClientWithAddr(target, eventAddr, clockID, eventConn, mcfg, stats), nil
+}
+
+// newL2Client initializes sptp client talking to the server over IEEE 802.3 transport
+func newL2Client(target net.HardwareAddr, clockID ptp.ClockIdentity, eventConn UDPConnWithTS, mcfg *MeasurementConfig, stats StatsServer) *Client {
+	return newClientWithAddr(target.String(), &L2Addr{MAC: target}, clockID, eventConn, mcfg, stats)
+}
+
+func newClientWithAddr(target string, eventAddr net.Addr, clockID ptp.ClockIdentity, eventConn UDPConnWithTS, mcfg *MeasurementConfig, stats StatsServer) *Client {
+	return &Client{
 		clockID:       clockID,
 		eventSequence: uint16(rnd.Int31n(65536)),
 		eventConn:     eventConn,
 		eventAddr:     eventAddr,
-		inChan:        make(chan *inPacket, 100),
+		rx:            newRXQueue(rxQueueSize),
 		server:        target,
 		m:             newMeasurements(mcfg),
+		seq:           ptp.NewSequenceTracker(),
+		syncs:         ptp.NewSyncMatcher(),
 		stats:         stats,
 	}
-	return c, nil
 }
 
 // dispatch handler based on msg type
@@ -141,6 +225,20 @@ func (c *Client) handleMsg(msg *inPacket) error {
 	if err != nil {
 		return err
 	}
+	if c.auth != nil {
+		if err := c.auth.verify(msg.data); err != nil {
+			// could be anyone spoofing the server, so just drop the message
+			c.logReceive(msgType, "%v, ignoring", err)
+			c.stats.UpdateCounterBy("ptp.sptp.portstats.rx.auth_failed", 1)
+			return nil
+		}
+	}
+	// domainNumber is 5th byte of the header, messages too short to carry full header are reported when parsed
+	if len(msg.data) >= binary.Size(ptp.Header{}) && msg.data[4] != c.domain {
+		c.logReceive(msgType, "domain %d, expected %d, ignoring", msg.data[4], c.domain)
+		c.stats.UpdateCounterBy("ptp.sptp.portstats.rx.wrong_domain", 1)
+		return nil
+	}
 	switch msgType {
 	case ptp.MessageAnnounce:
 		announce := &ptp.Announce{}
@@ -148,6 +246,9 @@ func (c *Client) handleMsg(msg *inPacket) error {
 			return fmt.Errorf("reading announce msg: %w", err)
 		}
 		c.stats.UpdateCounterBy(fmt.Sprintf("%s%s", stats.PortStatsRxPrefix, strings.ToLower(msgType.String())), 1)
+		if !c.checkSequence(&announce.Header) {
+			return nil
+		}
 		return c.handleAnnounce(announce)
 	case ptp.MessageSync:
 		b := &ptp.SyncDelayReq{}
@@ -155,7 +256,37 @@ func (c *Client) handleMsg(msg *inPacket) error {
 			return fmt.Errorf("reading sync msg: %w", err)
 		}
 		c.stats.UpdateCounterBy(fmt.Sprintf("%s%s", stats.PortStatsRxPrefix, strings.ToLower(msgType.String())), 1)
+		if !c.checkSequence(&b.Header) {
+			return nil
+		}
 		return c.handleSync(b, msg.ts)
+	case ptp.MessageFollowUp:
+		b := &ptp.FollowUp{}
+		if err := ptp.FromBytes(msg.data, b); err != nil {
+			return fmt.Errorf("reading followup msg: %w", err)
+		}
+		c.stats.UpdateCounterBy(fmt.Sprintf("%s%s", stats.PortStatsRxPrefix, strings.ToLower(msgType.String())), 1)
+		if !c.checkSequence(&b.Header) {
+			return nil
+		}
+		return c.handleFollowUp(b)
+	case ptp.MessageDelayResp:
+		b := &ptp.DelayResp{}
+		if err := ptp.FromBytes(msg.data, b); err != nil {
+			return fmt.Errorf("reading delay_resp msg: %w", err)
+		}
+		c.stats.UpdateCounterBy(fmt.Sprintf("%s%s", stats.PortStatsRxPrefix, strings.ToLower(msgType.String())), 1)
+		if !c.checkSequence(&b.Header) {
+			return nil
+		}
+		return c.handleDelayResp(b)
+	case ptp.MessageSignaling:
+		b := &ptp.Signaling{}
+		if err := ptp.FromBytes(msg.data, b); err != nil {
+			return fmt.Errorf("reading signaling msg: %w", err)
+		}
+		c.stats.UpdateCounterBy(fmt.Sprintf("%s%s", stats.PortStatsRxPrefix, strings.ToLower(msgType.String())), 1)
+		return c.handleSignaling(b)
 	default:
 		c.logReceive(msgType, "unsupported, ignoring")
 		c.stats.UpdateCounterBy(fmt.Sprintf("%s%s", stats.PortStatsRxPrefix, strings.ToLower(msgType.String())), 1)
@@ -166,34 +297,94 @@ func (c *Client) handleMsg(msg *inPacket) error {
 
 // couple of helpers to log nice lines about happening communication
 func (c *Client) logSent(t ptp.MessageType, msg string, v ...interface{}) {
-	log.Debugf(color.GreenString("[%s] client -> %s (%s)", c.server, t, fmt.Sprintf(msg, v...)))
+	protocolLog.Debugf(color.GreenString("[%s] client -> %s (%s)", c.server, t, fmt.Sprintf(msg, v...)))
 }
 func (c *Client) logReceive(t ptp.MessageType, msg string, v ...interface{}) {
-	log.Debugf(color.BlueString("[%s] server -> %s (%s)", c.server, t, fmt.Sprintf(msg, v...)))
+	protocolLog.Debugf(color.BlueString("[%s] server -> %s (%s)", c.server, t, fmt.Sprintf(msg, v...)))
 }
 
 // handleAnnounce handles ANNOUNCE packet and records UTC offset from it's data
 func (c *Client) handleAnnounce(b *ptp.Announce) error {
 	c.logReceive(ptp.MessageAnnounce, "seq=%d, T1=%v, CF2=%v, gmIdentity=%s, gmTimeSource=%s, stepsRemoved=%d",
-		b.SequenceID, b.OriginTimestamp.Time(), corrToDuration(b.CorrectionField), b.GrandmasterIdentity, b.TimeSource, b.StepsRemoved)
+		b.SequenceID, b.OriginTimestamp.Time(), b.CorrectionField.Duration(), b.GrandmasterIdentity, b.TimeSource, b.StepsRemoved)
 	c.m.currentUTCoffset = time.Duration(b.CurrentUTCOffset) * time.Second
+	if c.serverScheduled() {
+		// with standard unicast negotiation or multicast announce carries no timestamps
+		c.m.addAnnounce(*b)
+		return nil
+	}
 	// announce carries T1 and CF2
 	c.m.addT1(b.SequenceID, b.OriginTimestamp.Time())
-	c.m.addCF2(b.SequenceID, corrToDuration(b.CorrectionField))
+	c.m.addCF2(b.SequenceID, b.CorrectionField.Duration())
 	c.m.addAnnounce(*b)
 	return nil
 }
 
 // handleSync handles SYNC packet and adds send timestamp to measurements
 func (c *Client) handleSync(b *ptp.SyncDelayReq, ts time.Time) error {
-	c.logReceive(ptp.MessageSync, "seq=%d, T2=%v, T4=%v, CF1=%v", b.SequenceID, ts, b.OriginTimestamp.Time(), corrToDuration(b.CorrectionField))
+	if c.serverScheduled() {
+		c.logReceive(ptp.MessageSync, "seq=%d, T2=%v, CF1=%v, twoStep=%v", b.SequenceID, ts, b.CorrectionField.Duration(), b.FlagField&ptp.FlagTwoStep != 0)
+		// in one-step mode sync carries T1, otherwise it will come in FollowUp
+		if o := c.syncs.Sync(b, ts); o != nil {
+			c.m.addSyncOrigin(o)
+		}
+		return nil
+	}
+	c.logReceive(ptp.MessageSync, "seq=%d, T2=%v, T4=%v, CF1=%v", b.SequenceID, ts, b.OriginTimestamp.Time(), b.CorrectionField.Duration())
 	// T2 and CF1
-	c.m.addT2andCF1(b.SequenceID, ts, corrToDuration(b.CorrectionField))
+	c.m.addT2andCF1(b.SequenceID, ts, b.CorrectionField.Duration())
 	// sync carries T4 as well
 	c.m.addT4(b.SequenceID, b.OriginTimestamp.Time())
 	return nil
 }
 
+// handleFollowUp handles FOLLOW_UP packet and records T1 from it, only used with unicast negotiation or multicast
+func (c *Client) handleFollowUp(b *ptp.FollowUp) error {
+	if !c.serverScheduled() {
+		c.logReceive(ptp.MessageFollowUp, "unicast negotiation is disabled, ignoring")
+		c.stats.UpdateCounterBy("ptp.sptp.portstats.rx.unsupported", 1)
+		return nil
+	}
+	c.logReceive(ptp.MessageFollowUp, "seq=%d, T1=%v, CF1=%v", b.SequenceID, b.PreciseOriginTimestamp.Time(), b.CorrectionField.Duration())
+	if o := c.syncs.FollowUp(b); o != nil {
+		c.m.addSyncOrigin(o)
+	}
+	return nil
+}
+
+// handleDelayResp handles DELAY_RESP packet and records T4 and CF2 from it, only used with unicast negotiation or multicast
+func (c *Client) handleDelayResp(b *ptp.DelayResp) error {
+	if !c.serverScheduled() {
+		c.logReceive(ptp.MessageDelayResp, "unicast negotiation is disabled, ignoring")
+		c.stats.UpdateCounterBy("ptp.sptp.portstats.rx.unsupported", 1)
+		return nil
+	}
+	c.logReceive(ptp.MessageDelayResp, "seq=%d, T4=%v, CF2=%v", b.SequenceID, b.ReceiveTimestamp.Time(), b.CorrectionField.Duration())
+	c.m.addT4(b.SequenceID, b.ReceiveTimestamp.Time())
+	c.m.addCF2(b.SequenceID, b.CorrectionField.Duration())
+	return nil
+}
+
+// checkSequence tracks sequence ID of the message and tells if it's worth handling: duplicates and stale messages are dropped
+func (c *Client) checkSequence(h *ptp.Header) bool {
+	msgType := h.MessageType()
+	var status ptp.SequenceStatus
+	if !c.serverScheduled() && (msgType == ptp.MessageSync || msgType == ptp.MessageAnnounce) {
+		// Sync and Announce carry timestamps of our DelayReq
+		status = c.seq.ObserveResponse(h.SourcePortIdentity, msgType, ptp.MessageDelayReq, h.SequenceID)
+	} else {
+		status = c.seq.Observe(h.SourcePortIdentity, msgType, h.SequenceID)
+	}
+	if status != ptp.SequenceOK {
+		c.stats.UpdateCounterBy(fmt.Sprintf("ptp.sptp.portstats.rx.seq.%s", status), 1)
+	}
+	if !status.Accept() {
+		c.logReceive(msgType, "seq=%d is %s, ignoring", h.SequenceID, status)
+		return false
+	}
+	return true
+}
+
 // RunOnce produces one client-server exchange
 func (c *Client) RunOnce(ctx context.Context, timeout time.Duration) *RunResult {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
@@ -205,34 +396,47 @@ func (c *Client) RunOnce(ctx context.Context, timeout time.Duration) *RunResult
 	}
 	c.m.cleanup()
 
+	if c.negotiation != nil {
+		eg.Go(func() error {
+			return c.runNegotiated(ctx, &result)
+		})
+		result.Error = eg.Wait()
+		return &result
+	}
+
+	measure := c.m.latest
+	if c.hybrid {
+		// Sync comes from multicast with its own sequence, unrelated to our DelayReq
+		measure = c.m.latestCombined
+	}
 	eg.Go(func() error {
 		// ask for delay
-		seq, hwts, err := c.sendEventMsg(reqDelay(c.clockID))
-		if err != nil {
+		if err := c.sendDelayReq(); err != nil {
 			return err
 		}
-		c.m.addT3(seq, hwts)
-		c.logSent(ptp.MessageDelayReq, "seq=%d, our T3=%v", seq, hwts)
-		c.stats.UpdateCounterBy(fmt.Sprintf("%s%s", stats.PortStatsTxPrefix, strings.ToLower(ptp.MessageDelayReq.String())), 1)
 
 		for {
 			select {
 			case <-ctx.Done():
-				log.Debugf("cancelled main loop")
+				protocolLog.Debugf("cancelled main loop")
 				return ctx.Err()
-			case msg := <-c.inChan:
+			case <-c.rx.ready:
+				msg := c.rx.pop()
+				if msg == nil {
+					continue
+				}
 				if err := c.handleMsg(msg); err != nil {
 					return err
 				}
-				latest, err := c.m.latest()
+				latest, err := measure()
 
 				if err != nil {
-					log.Debugf("getting latest measurement: %v", err)
+					protocolLog.Debugf("getting latest measurement: %v", err)
 					if !errors.Is(err, errNotEnoughData) {
 						return err
 					}
 				} else {
-					log.Debugf("latest measurement: %+v", latest)
+					protocolLog.Debugf("latest measurement: %+v", latest)
 					result.Measurement = latest
 					return nil
 				}
@@ -243,3 +447,57 @@ func (c *Client) RunOnce(ctx context.Context, timeout time.Duration) *RunResult
 
 	return &result
 }
+
+// runNegotiated is RunOnce for the server that sends us Sync, FollowUp and DelayResp only after unicast negotiation
+func (c *Client) runNegotiated(ctx context.Context, result *RunResult) error {
+	if err := c.requestGrants(time.Now()); err != nil {
+		return err
+	}
+	delayReqSent := false
+	sendDelayReq := func() error {
+		if delayReqSent || !c.negotiation.granted(ptp.MessageDelayResp, time.Now()) {
+			return nil
+		}
+		if err := c.sendDelayReq(); err != nil {
+			return err
+		}
+		delayReqSent = true
+		return nil
+	}
+	if err := sendDelayReq(); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			protocolLog.Debugf("cancelled main loop")
+			if !delayReqSent {
+				return fmt.Errorf("%w for %s", errNoGrant, ptp.MessageDelayResp)
+			}
+			return ctx.Err()
+		case <-c.rx.ready:
+			msg := c.rx.pop()
+			if msg == nil {
+				continue
+			}
+			if err := c.handleMsg(msg); err != nil {
+				return err
+			}
+			// grant might have just arrived
+			if err := sendDelayReq(); err != nil {
+				return err
+			}
+			latest, err := c.m.latestCombined()
+			if err != nil {
+				protocolLog.Debugf("getting latest measurement: %v", err)
+				if !errors.Is(err, errNotEnoughData) {
+					return err
+				}
+			} else {
+				protocolLog.Debugf("latest measurement: %+v", latest)
+				result.Measurement = latest
+				return nil
+			}
+		}
+	}
+}
@@ -19,6 +19,7 @@ package client
 import (
 	"context"
 	"encoding/binary"
+	"fmt"
 	"net"
 	"testing"
 	"time"
@@ -27,6 +28,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
 )
 
 func announcePkt(seq int) *ptp.Announce {
@@ -73,7 +75,7 @@ func TestClientRun(t *testing.T) {
 	eventConn := NewMockUDPConnWithTS(ctrl)
 	mcfg := &MeasurementConfig{}
 	statsServer := NewMockStatsServer(ctrl)
-	c, err := newClient("127.0.0.1", cid, eventConn, mcfg, statsServer)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, mcfg, statsServer)
 	require.NoError(t, err)
 
 	// put stuff into measurements to make sure it got cleaned before the run
@@ -96,21 +98,21 @@ func TestClientRun(t *testing.T) {
 		sync := syncPkt(int(delayReq.SequenceID))
 		syncBytes, err := ptp.Bytes(sync)
 		require.Nil(t, err)
-		c.inChan <- &inPacket{
+		c.rx.push(&inPacket{
 			data: syncBytes,
 			ts:   time.Now(),
-		}
+		})
 		// send in irrelevant packet client should ignore
-		c.inChan <- &inPacket{
+		c.rx.push(&inPacket{
 			data: []byte{1, 2, 3, 4, 5},
-		}
+		})
 
 		announce = announcePkt(int(delayReq.SequenceID))
 		announceBytes, err := ptp.Bytes(announce)
 		require.Nil(t, err)
-		c.inChan <- &inPacket{
+		c.rx.push(&inPacket{
 			data: announceBytes,
-		}
+		})
 
 		return len(syncBytes), time.Now(), nil
 	})
@@ -131,6 +133,47 @@ func TestClientRun(t *testing.T) {
 	require.Equal(t, 1, len(c.m.data))
 }
 
+func TestClientRunHybrid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cid := ptp.ClockIdentity(0xc42a1fffe6d7ca6)
+
+	eventConn := NewMockUDPConnWithTS(ctrl)
+	statsServer := NewMockStatsServer(ctrl)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, &MeasurementConfig{}, statsServer)
+	require.NoError(t, err)
+	c.hybrid = true
+
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.announce", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.sync", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.follow_up", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.delay_resp", int64(1))
+
+	now := time.Now()
+	t1 := now.Add(-time.Millisecond)
+	// multicast messages arrived since the last exchange, with sequence of their own
+	announce := announcePkt(7)
+	c.rx.push(&inPacket{data: packetBytes(t, announce)})
+	c.rx.push(&inPacket{data: packetBytes(t, twoStepSyncPkt(1000)), ts: now})
+	c.rx.push(&inPacket{data: packetBytes(t, followUpPkt(1000, t1))})
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).DoAndReturn(func(b []byte, _ net.Addr) (int, time.Time, error) {
+		delayReq := &ptp.SyncDelayReq{}
+		require.NoError(t, ptp.FromBytes(b, delayReq))
+		c.rx.push(&inPacket{data: packetBytes(t, delayRespPkt(int(delayReq.SequenceID), now.Add(2*time.Millisecond)))})
+		return len(b), now.Add(time.Millisecond), nil
+	})
+
+	runResult := c.RunOnce(context.Background(), 100*time.Millisecond)
+	require.NoError(t, runResult.Error)
+	require.NotNil(t, runResult.Measurement)
+	require.Equal(t, *announce, runResult.Measurement.Announce)
+	require.Equal(t, t1.UnixNano(), runResult.Measurement.T1.UnixNano())
+	require.Equal(t, now, runResult.Measurement.T2)
+	require.Equal(t, now.Add(time.Millisecond), runResult.Measurement.T3)
+	require.Equal(t, time.Millisecond, runResult.Measurement.ClientToServerDiff)
+}
+
 func TestClientTimeout(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -139,7 +182,7 @@ func TestClientTimeout(t *testing.T) {
 	eventConn := NewMockUDPConnWithTS(ctrl)
 	mcfg := &MeasurementConfig{}
 	statsServer := NewMockStatsServer(ctrl)
-	c, err := newClient("127.0.0.1", cid, eventConn, mcfg, statsServer)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, mcfg, statsServer)
 	require.NoError(t, err)
 	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1))
 	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any())
@@ -158,7 +201,7 @@ func TestClientBadPacket(t *testing.T) {
 	eventConn := NewMockUDPConnWithTS(ctrl)
 	mcfg := &MeasurementConfig{}
 	statsServer := NewMockStatsServer(ctrl)
-	c, err := newClient("127.0.0.1", cid, eventConn, mcfg, statsServer)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, mcfg, statsServer)
 	require.NoError(t, err)
 
 	// handle whatever client is sending over eventConn
@@ -167,10 +210,10 @@ func TestClientBadPacket(t *testing.T) {
 		delayReq := &ptp.SyncDelayReq{}
 		err := ptp.FromBytes(b, delayReq)
 		require.Nil(t, err, "reading delayReq msg")
-		c.inChan <- &inPacket{
+		c.rx.push(&inPacket{
 			data: []byte{},
 			ts:   time.Now(),
-		}
+		})
 
 		return 10, time.Now(), nil
 	})
@@ -181,3 +224,154 @@ func TestClientBadPacket(t *testing.T) {
 	require.Error(t, runResult.Error, "full client run should fail")
 	require.Equal(t, "127.0.0.1", runResult.Server, "run result should have correct server")
 }
+
+func TestClientWrongDomain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cid := ptp.ClockIdentity(0xc42a1fffe6d7ca6)
+
+	eventConn := NewMockUDPConnWithTS(ctrl)
+	statsServer := NewMockStatsServer(ctrl)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, &MeasurementConfig{}, statsServer)
+	require.NoError(t, err)
+	c.domain = 24
+	// announce we send back is not a response to our DelayReq, but close enough to not be stale
+	c.eventSequence = 2
+
+	// DelayReq goes out in our domain
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).DoAndReturn(func(b []byte, _ net.Addr) (int, time.Time, error) {
+		delayReq := &ptp.SyncDelayReq{}
+		require.NoError(t, ptp.FromBytes(b, delayReq))
+		require.Equal(t, uint8(24), delayReq.DomainNumber)
+		return len(b), time.Now(), nil
+	})
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1))
+	require.NoError(t, c.sendDelayReq())
+	require.Len(t, c.m.data, 1)
+
+	// messages from other domains are dropped
+	announce := announcePkt(1)
+	b, err := ptp.Bytes(announce)
+	require.NoError(t, err)
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.wrong_domain", int64(1))
+	require.NoError(t, c.handleMsg(&inPacket{data: b}))
+	require.Len(t, c.m.data, 1)
+
+	announce.DomainNumber = 24
+	b, err = ptp.Bytes(announce)
+	require.NoError(t, err)
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.seq.unmatched", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.announce", int64(1))
+	require.NoError(t, c.handleMsg(&inPacket{data: b}))
+	require.Len(t, c.m.data, 2)
+}
+
+func TestClientSequence(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cid := ptp.ClockIdentity(0xc42a1fffe6d7ca6)
+
+	eventConn := NewMockUDPConnWithTS(ctrl)
+	statsServer := NewMockStatsServer(ctrl)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, &MeasurementConfig{}, statsServer)
+	require.NoError(t, err)
+	c.eventSequence = 100
+
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).Return(10, time.Now(), nil)
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1))
+	require.NoError(t, c.sendDelayReq())
+
+	// response to our DelayReq
+	announce := announcePkt(100)
+	b, err := ptp.Bytes(announce)
+	require.NoError(t, err)
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.announce", int64(1))
+	require.NoError(t, c.handleMsg(&inPacket{data: b}))
+	require.False(t, c.m.data[100].t1.IsZero())
+
+	// duplicate is dropped
+	c.m.data[100].t1 = time.Time{}
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.seq.duplicate", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.announce", int64(1))
+	require.NoError(t, c.handleMsg(&inPacket{data: b}))
+	require.True(t, c.m.data[100].t1.IsZero())
+
+	// response to the request we no longer track is dropped
+	announce = announcePkt(100 - 64)
+	b, err = ptp.Bytes(announce)
+	require.NoError(t, err)
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.seq.stale", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.announce", int64(1))
+	require.NoError(t, c.handleMsg(&inPacket{data: b}))
+	require.NotContains(t, c.m.data, uint16(100-64))
+}
+
+func TestClientSendDelayReqNoTXTS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cid := ptp.ClockIdentity(0xc42a1fffe6d7ca6)
+
+	eventConn := NewMockUDPConnWithTS(ctrl)
+	mcfg := &MeasurementConfig{}
+	statsServer := NewMockStatsServer(ctrl)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, mcfg, statsServer)
+	require.NoError(t, err)
+	sent := time.Now()
+	noTXTS := &txtsError{err: &timestamp.Error{Kind: timestamp.ErrTXTimestampTimeout, Err: fmt.Errorf("no TX timestamp found after 10 tries")}}
+	zeroTXTS := &txtsError{err: &timestamp.Error{Kind: timestamp.ErrDriverBug, Err: fmt.Errorf("got zero timestamp")}}
+	otherTXTS := &txtsError{err: fmt.Errorf("failed to find timestamp in socket control message")}
+
+	// timestamp is there
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1))
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).Return(10, sent, nil)
+	require.NoError(t, c.sendDelayReq())
+	require.Equal(t, sent, c.m.data[c.eventSequence-1].t3)
+	require.False(t, c.m.data[c.eventSequence-1].t3Fallback)
+
+	// no timestamp, no fallback
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).Return(10, sent, noTXTS)
+	require.ErrorIs(t, c.sendDelayReq(), errNoTXTS)
+	require.NotContains(t, c.m.data, c.eventSequence-1)
+
+	// no timestamp, userspace send time is used instead
+	c.fallbackTXTS = true
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1))
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).Return(10, sent, noTXTS)
+	require.NoError(t, c.sendDelayReq())
+	require.Equal(t, sent, c.m.data[c.eventSequence-1].t3)
+	require.True(t, c.m.data[c.eventSequence-1].t3Fallback)
+
+	// bogus timestamp, userspace send time is used instead
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1))
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).Return(10, sent, zeroTXTS)
+	require.NoError(t, c.sendDelayReq())
+	require.True(t, c.m.data[c.eventSequence-1].t3Fallback)
+
+	// unclassified failure has nothing to do with timing, no fallback
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).Return(10, sent, otherTXTS)
+	require.ErrorIs(t, c.sendDelayReq(), errNoTXTS)
+	require.NotContains(t, c.m.data, c.eventSequence-1)
+
+	// failure to send is not about timestamps
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).Return(0, time.Time{}, fmt.Errorf("network is unreachable"))
+	require.Error(t, c.sendDelayReq())
+
+	attempts, failures := c.txtsStats()
+	require.Equal(t, int64(5), attempts)
+	require.Equal(t, int64(4), failures)
+	timeouts, driverBugs := c.txtsFailureStats()
+	require.Equal(t, int64(2), timeouts)
+	require.Equal(t, int64(1), driverBugs)
+}
+
+func TestTXTSError(t *testing.T) {
+	cause := &timestamp.Error{Kind: timestamp.ErrTXTimestampTimeout, Err: fmt.Errorf("no TX timestamp found after 10 tries")}
+	err := &txtsError{err: cause}
+	require.EqualError(t, err, "failed to get timestamp of last packet: no TX timestamp found after 10 tries")
+	require.ErrorIs(t, err, errNoTXTS)
+	require.ErrorIs(t, err, timestamp.ErrTXTimestampTimeout)
+	require.Equal(t, timestamp.FailureTXTimestampTimeout, timestamp.Classify(err))
+	require.True(t, canFallbackTXTS(err))
+	require.False(t, canFallbackTXTS(cause))
+	require.False(t, canFallbackTXTS(&txtsError{err: fmt.Errorf("boom")}))
+}
@@ -17,12 +17,12 @@ limitations under the License.
 package client
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/facebook/time/clock"
 	"github.com/facebook/time/phc"
-	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 )
 
@@ -75,9 +75,9 @@ type SysClock struct{}
 
 // AdjFreqPPB adjusts PHC frequency
 func (c *SysClock) AdjFreqPPB(freqPPB float64) error {
-	state, err := clock.AdjFreqPPB(unix.CLOCK_REALTIME, freqPPB)
-	if err == nil && state != unix.TIME_OK {
-		log.Warningf("clock state %d is not TIME_OK after adjusting frequency", state)
+	state, err := clock.AdjFreqPPB(clock.ClockRealtime, freqPPB)
+	if err == nil && state != clock.TimeOK {
+		servoLog.Warningf("clock state %d is not TIME_OK after adjusting frequency", state)
 	}
 	return err
 }
@@ -95,33 +95,55 @@ func (c *SysClock) SetSync() error {
 	return err
 }
 
+// SetLeap arms kernel to apply leap second at the end of current UTC day
+func (c *SysClock) SetLeap(leap int) error {
+	_, err := clock.SetLeap(clock.ClockRealtime, leap)
+	return err
+}
+
+// SetTAIOffset sets offset between TAI and UTC kernel uses for CLOCK_TAI
+func (c *SysClock) SetTAIOffset(offset int) error {
+	_, err := clock.SetTAIOffset(clock.ClockRealtime, offset)
+	return err
+}
+
 // Step jumps time on PHC
 func (c *SysClock) Step(step time.Duration) error {
-	state, err := clock.Step(unix.CLOCK_REALTIME, step)
-	if err == nil && state != unix.TIME_OK {
-		log.Warningf("clock state %d is not TIME_OK after stepping", state)
+	state, err := clock.Step(clock.ClockRealtime, step)
+	if err == nil && state != clock.TimeOK {
+		servoLog.Warningf("clock state %d is not TIME_OK after stepping", state)
 	}
 	return err
 }
 
 // FrequencyPPB returns current PHC frequency
 func (c *SysClock) FrequencyPPB() (float64, error) {
-	freqPPB, state, err := clock.FrequencyPPB(unix.CLOCK_REALTIME)
-	if err == nil && state != unix.TIME_OK {
-		log.Warningf("clock state %d is not TIME_OK after getting current frequency", state)
+	freqPPB, state, err := clock.FrequencyPPB(clock.ClockRealtime)
+	if err == nil && state != clock.TimeOK {
+		servoLog.Warningf("clock state %d is not TIME_OK after getting current frequency", state)
 	}
 	return freqPPB, err
 }
 
 // MaxFreqPPB returns maximum frequency adjustment supported by PHC
 func (c *SysClock) MaxFreqPPB() (float64, error) {
-	freqPPB, state, err := clock.MaxFreqPPB(unix.CLOCK_REALTIME)
-	if err == nil && state != unix.TIME_OK {
-		log.Warningf("clock state %d is not TIME_OK after getting max frequency adjustment", state)
+	freqPPB, state, err := clock.MaxFreqPPB(clock.ClockRealtime)
+	if err == nil && state != clock.TimeOK {
+		servoLog.Warningf("clock state %d is not TIME_OK after getting max frequency adjustment", state)
 	}
 	return freqPPB, err
 }
 
+// newSysClock returns SysClock, or FreeRunningClock if system clock can't be disciplined on this platform
+func newSysClock() Clock {
+	c := &SysClock{}
+	if _, err := c.FrequencyPPB(); errors.Is(err, clock.ErrUnsupported) {
+		servoLog.Warningf("system clock can't be adjusted on this platform, will NOT adjust clock: %v", err)
+		return &FreeRunningClock{}
+	}
+	return c
+}
+
 // FreeRunningClock is a dummy clock that does nothing
 type FreeRunningClock struct{}
 
@@ -17,13 +17,26 @@ limitations under the License.
 package client
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 	yaml "gopkg.in/yaml.v2"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/sptp/bmc"
+)
+
+// Config value bounds
+const (
+	minInterval = time.Second / 128
+	maxInterval = time.Hour
+	// DSCP is 6 bits
+	maxDSCP = 63
 )
 
 // BackoffConfig describes configuration for backoff in case of unavailable GM
@@ -68,9 +81,27 @@ func (c *MeasurementConfig) Validate() error {
 	return nil
 }
 
+// ServerPorts describes UDP ports of the server, if they are not standard, for example behind NAT or port forwarding
+type ServerPorts struct {
+	Event   int `yaml:"event"`   // port we send event messages to, 0 means 319
+	General int `yaml:"general"` // port we send general messages to, 0 means 320
+}
+
+// Validate ServerPorts is sane
+func (c *ServerPorts) Validate() error {
+	if c.Event < 0 || c.Event > 65535 {
+		return fmt.Errorf("event port must be between 0 and 65535, got %d", c.Event)
+	}
+	if c.General < 0 || c.General > 65535 {
+		return fmt.Errorf("general port must be between 0 and 65535, got %d", c.General)
+	}
+	return nil
+}
+
 // Config specifies PTPNG run options
 type Config struct {
 	Iface                    string
+	BindDevice               string
 	Timestamping             string
 	MonitoringPort           int
 	Interval                 time.Duration
@@ -78,12 +109,42 @@ type Config struct {
 	DSCP                     int
 	FirstStepThreshold       time.Duration
 	Servers                  map[string]int
+	Transports               map[string]string
+	EventPort                int
+	GeneralPort              int
+	ServerPorts              map[string]ServerPorts
+	ServerIntervals          map[string]time.Duration
+	ServerDomains            map[string]int
+	DomainPriorities         map[int]int
+	Profile                  string
+	Stagger                  bool
+	MaxClockClass            int
+	QualifyAnnounces         bool
+	ArmLeapSecond            bool
+	MaintainTAIOffset        bool
 	Measurement              MeasurementConfig
+	NICLatency               map[string]NICLatency
 	MetricsAggregationWindow time.Duration
 	AttemptsTXTS             int
 	TimeoutTXTS              time.Duration
+	FallbackTXTS             bool
+	ListenerWorkers          int
 	FreeRunning              bool
 	Backoff                  BackoffConfig
+	MeasurementLog           MeasurementLogConfig
+	UnicastNegotiation       UnicastNegotiationConfig
+	Proximity                ProximityConfig
+	Consensus                ConsensusConfig
+	StepPolicy               StepPolicyConfig
+	DrainFile                string
+	ServoState               ServoStateConfig
+	ShadowServo              ShadowServoConfig
+	Capture                  CaptureConfig
+	Phc2Sys                  Phc2SysConfig
+	Bridge                   BridgeConfig
+	Authentication           AuthenticationConfig
+	Maintenance              MaintenanceConfig
+	Logging                  LoggingConfig
 }
 
 // DefaultConfig returns Config initialized with default values
@@ -95,67 +156,400 @@ func DefaultConfig() *Config {
 		AttemptsTXTS:             10,
 		TimeoutTXTS:              time.Duration(50) * time.Millisecond,
 		Timestamping:             HWTIMESTAMP,
+		ListenerWorkers:          4,
+		ServoState: ServoStateConfig{
+			MaxAge: time.Hour,
+		},
+		Capture: CaptureConfig{
+			MaxPackets: 100000,
+		},
+		UnicastNegotiation: UnicastNegotiationConfig{
+			Duration:       time.Minute,
+			RenewBefore:    10 * time.Second,
+			RequestTimeout: time.Second,
+		},
 	}
 }
 
-// Validate config is sane
+// Validate config is sane, reporting all problems at once
 func (c *Config) Validate() error {
-	if c.Interval <= 0 {
-		return fmt.Errorf("interval must be greater than zero")
+	var errs ConfigErrors
+	if c.Interval < minInterval || c.Interval > maxInterval {
+		errs.add(fmt.Errorf("interval must be between %v and %v, got %v", minInterval, maxInterval, c.Interval))
 	}
 	if c.AttemptsTXTS <= 0 {
-		return fmt.Errorf("attemptstxts must be greater than zero")
+		errs.add(fmt.Errorf("attemptstxts must be greater than zero"))
 	}
 	if c.TimeoutTXTS <= 0 {
-		return fmt.Errorf("timeouttxts must be greater than zero")
+		errs.add(fmt.Errorf("timeouttxts must be greater than zero"))
+	}
+	if c.ListenerWorkers < 0 {
+		errs.add(fmt.Errorf("listenerworkers must be 0 or positive"))
 	}
 	if c.MetricsAggregationWindow <= 0 {
-		return fmt.Errorf("metricsaggregationwindow must be greater than zero")
+		errs.add(fmt.Errorf("metricsaggregationwindow must be greater than zero"))
+	}
+	if c.MonitoringPort < 0 || c.MonitoringPort > 65535 {
+		errs.add(fmt.Errorf("monitoringport must be between 0 and 65535, got %d", c.MonitoringPort))
 	}
-	if c.MonitoringPort < 0 {
-		return fmt.Errorf("monitoringport must be 0 or positive")
+	if c.DSCP < 0 || c.DSCP > maxDSCP {
+		errs.add(fmt.Errorf("dscp must be between 0 and %d, got %d", maxDSCP, c.DSCP))
 	}
-	if c.DSCP < 0 {
-		return fmt.Errorf("dscp must be 0 or positive")
+	if c.MaxClockClass < 0 || c.MaxClockClass > 255 {
+		errs.add(fmt.Errorf("maxclockclass must be between 0 and 255, got %d", c.MaxClockClass))
 	}
 	if c.ExchangeTimeout <= 0 || c.ExchangeTimeout >= c.Interval {
-		return fmt.Errorf("exchangetimeout must be greater than zero but less than interval")
+		errs.add(fmt.Errorf("exchangetimeout must be greater than zero but less than interval"))
 	}
 	if len(c.Servers) == 0 {
-		return fmt.Errorf("at least one server must be specified")
+		errs.add(fmt.Errorf("at least one server must be specified"))
+	}
+	for server := range c.Servers {
+		if _, found := c.Transports[server]; !found && net.ParseIP(server) == nil {
+			errs.add(fmt.Errorf("server %q must be an IP address to use %q transport", server, TransportUDP))
+		}
+	}
+	for server, transport := range c.Transports {
+		if _, found := c.Servers[server]; !found {
+			errs.add(fmt.Errorf("transport is specified for unknown server %q", server))
+			continue
+		}
+		switch transport {
+		case TransportUDP, TransportHybrid:
+			if net.ParseIP(server) == nil {
+				errs.add(fmt.Errorf("server %q must be an IP address to use %q transport", server, transport))
+			}
+			if transport == TransportHybrid && c.UnicastNegotiation.Enabled {
+				errs.add(fmt.Errorf("server %q can't use %q transport with unicastnegotiation", server, TransportHybrid))
+			}
+		case TransportL2:
+			if mac, err := net.ParseMAC(server); err != nil || len(mac) != 6 {
+				errs.add(fmt.Errorf("server %q must be a MAC address to use %q transport", server, TransportL2))
+			}
+		default:
+			errs.add(fmt.Errorf("transport for server %q must be one of %q, %q or %q", server, TransportUDP, TransportL2, TransportHybrid))
+		}
+	}
+	if v4, v6 := c.multicastFamilies(); (v4 || v6) && (c.ListenEventPort() != ptp.PortEvent || c.ListenGeneralPort() != ptp.PortGeneral) {
+		errs.add(fmt.Errorf("%q transport requires eventport %d and generalport %d to receive multicast", TransportHybrid, ptp.PortEvent, ptp.PortGeneral))
+	}
+	for server, interval := range c.ServerIntervals {
+		if _, found := c.Servers[server]; !found {
+			errs.add(fmt.Errorf("interval is specified for unknown server %q", server))
+			continue
+		}
+		if interval < c.Interval || c.Interval <= 0 || interval%c.Interval != 0 {
+			errs.add(fmt.Errorf("interval for server %q must be a multiple of interval %v, got %v", server, c.Interval, interval))
+		}
+	}
+	if c.Profile != "" {
+		if _, err := ptp.ProfileFromString(c.Profile); err != nil {
+			errs.add(err)
+		}
+	}
+	c.validateDomains(&errs)
+	if c.EventPort < 0 || c.EventPort > 65535 {
+		errs.add(fmt.Errorf("eventport must be between 0 and 65535, got %d", c.EventPort))
+	}
+	if c.GeneralPort < 0 || c.GeneralPort > 65535 {
+		errs.add(fmt.Errorf("generalport must be between 0 and 65535, got %d", c.GeneralPort))
+	}
+	if c.ListenEventPort() == c.ListenGeneralPort() {
+		errs.add(fmt.Errorf("eventport and generalport must be different, got %d", c.ListenEventPort()))
+	}
+	for server, ports := range c.ServerPorts {
+		if _, found := c.Servers[server]; !found {
+			errs.add(fmt.Errorf("ports are specified for unknown server %q", server))
+			continue
+		}
+		if c.Transport(server) != TransportUDP {
+			errs.add(fmt.Errorf("ports are specified for server %q, but it doesn't use %q transport", server, TransportUDP))
+			continue
+		}
+		if err := ports.Validate(); err != nil {
+			errs.add(fmt.Errorf("invalid ports for server %q: %w", server, err))
+		}
+	}
+	if len(c.ServerIntervals) > 0 && c.UnicastNegotiation.Enabled {
+		errs.add(fmt.Errorf("serverintervals can't be used with unicastnegotiation"))
 	}
 	if c.Timestamping != HWTIMESTAMP && c.Timestamping != SWTIMESTAMP {
-		return fmt.Errorf("only %q and %q timestamping is supported", HWTIMESTAMP, SWTIMESTAMP)
+		errs.add(fmt.Errorf("only %q and %q timestamping is supported", HWTIMESTAMP, SWTIMESTAMP))
 	}
 	if c.Iface == "" {
-		return fmt.Errorf("iface must be specified")
+		errs.add(fmt.Errorf("iface must be specified"))
+	}
+	if len(c.BindDevice) >= unix.IFNAMSIZ {
+		errs.add(fmt.Errorf("binddevice must be shorter than %d characters", unix.IFNAMSIZ))
+	}
+	if err := c.Authentication.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid authentication config: %w", err))
+	}
+	for server := range c.Authentication.Servers {
+		if _, found := c.Servers[server]; !found {
+			errs.add(fmt.Errorf("authentication is specified for unknown server %q", server))
+		}
 	}
 	if err := c.Measurement.Validate(); err != nil {
-		return fmt.Errorf("invalid measurement config: %w", err)
+		errs.add(fmt.Errorf("invalid measurement config: %w", err))
+	}
+	for iface, l := range c.NICLatency {
+		if err := l.Validate(); err != nil {
+			errs.add(fmt.Errorf("invalid niclatency config for %q: %w", iface, err))
+		}
 	}
 	if err := c.Backoff.Validate(); err != nil {
-		return fmt.Errorf("invalid backoff config: %w", err)
+		errs.add(fmt.Errorf("invalid backoff config: %w", err))
 	}
-	return nil
+	if err := c.MeasurementLog.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid measurementlog config: %w", err))
+	}
+	if err := c.UnicastNegotiation.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid unicastnegotiation config: %w", err))
+	}
+	if err := c.Proximity.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid proximity config: %w", err))
+	}
+	if err := c.Consensus.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid consensus config: %w", err))
+	}
+	if err := c.StepPolicy.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid steppolicy config: %w", err))
+	}
+	if c.StepPolicy.Policy == StepPolicyNever && c.FirstStepThreshold != 0 {
+		errs.add(fmt.Errorf("firststepthreshold can't be used with %q step policy", StepPolicyNever))
+	}
+	if err := c.ServoState.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid servostate config: %w", err))
+	}
+	if err := c.ShadowServo.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid shadowservo config: %w", err))
+	}
+	if err := c.Capture.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid capture config: %w", err))
+	}
+	if err := c.Phc2Sys.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid phc2sys config: %w", err))
+	}
+	if err := c.Bridge.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid bridge config: %w", err))
+	}
+	if err := c.Maintenance.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid maintenance config: %w", err))
+	}
+	if err := c.Logging.Validate(); err != nil {
+		errs.add(fmt.Errorf("invalid logging config: %w", err))
+	}
+	if c.Phc2Sys.Enabled && (c.Timestamping != HWTIMESTAMP || c.FreeRunning) {
+		errs.add(fmt.Errorf("phc2sys requires %q timestamping and can't be used in freerunning mode", HWTIMESTAMP))
+	}
+	if c.Bridge.Device != "" && (c.Timestamping != HWTIMESTAMP || c.FreeRunning) {
+		errs.add(fmt.Errorf("bridge requires %q timestamping and can't be used in freerunning mode", HWTIMESTAMP))
+	}
+	if c.ArmLeapSecond && !c.disciplinesSysClock() {
+		errs.add(fmt.Errorf("armleapsecond requires system clock to be disciplined, either with %q timestamping or with phc2sys", SWTIMESTAMP))
+	}
+	if c.MaintainTAIOffset && !c.disciplinesSysClock() {
+		errs.add(fmt.Errorf("maintaintaioffset requires system clock to be disciplined, either with %q timestamping or with phc2sys", SWTIMESTAMP))
+	}
+	return errs.errOrNil()
 }
 
-// ReadConfig reads config from the file
+// disciplinesSysClock reports if SPTP adjusts system realtime clock, directly or via phc2sys
+func (c *Config) disciplinesSysClock() bool {
+	if c.FreeRunning {
+		return false
+	}
+	return c.Timestamping == SWTIMESTAMP || c.Phc2Sys.Enabled
+}
+
+// ReadConfig reads config from the file. Unknown keys are reported as errors, as most likely they are typos
 func ReadConfig(path string) (*Config, error) {
+	c, keyErrs, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyErrs) > 0 {
+		return nil, keyErrs
+	}
+	return c, nil
+}
+
+// readConfig reads config from the file, returning unknown keys separately so they can be reported together with other problems
+func readConfig(path string) (*Config, ConfigErrors, error) {
 	c := DefaultConfig()
 	cData, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = yaml.Unmarshal(cData, &c)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return c, nil
+	keyErrs, err := checkConfigKeys(cData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, keyErrs, nil
+}
+
+// Transport returns transport we use to talk to the server, UDP by default
+func (c *Config) Transport(server string) string {
+	if t, found := c.Transports[server]; found {
+		return t
+	}
+	return TransportUDP
+}
+
+// IfaceLatency returns latencies of the NIC to correct timestamps taken on iface with, zero if not configured
+func (c *Config) IfaceLatency(iface string) NICLatency {
+	return c.NICLatency[iface]
+}
+
+// ServerInterval returns how often to poll the server
+func (c *Config) ServerInterval(server string) time.Duration {
+	if i, found := c.ServerIntervals[server]; found {
+		return i
+	}
+	return c.Interval
+}
+
+// LongestServerInterval returns the longest polling interval across all servers
+func (c *Config) LongestServerInterval() time.Duration {
+	longest := c.Interval
+	for server := range c.Servers {
+		if i := c.ServerInterval(server); i > longest {
+			longest = i
+		}
+	}
+	return longest
+}
+
+// ServerDomain returns PTP domain of the server. By default it's the default domain of configured profile, or 0
+func (c *Config) ServerDomain(server string) int {
+	if domain, found := c.ServerDomains[server]; found {
+		return domain
+	}
+	if p, ok := c.ptpProfile(); ok {
+		return int(p.Preset().DefaultDomain)
+	}
+	return 0
+}
+
+// ptpProfile returns configured PTP profile, and false if there is none
+func (c *Config) ptpProfile() (ptp.Profile, bool) {
+	if c.Profile == "" {
+		return ptp.ProfileDefault, false
+	}
+	p, err := ptp.ProfileFromString(c.Profile)
+	return p, err == nil
+}
+
+// Comparator returns BMCA comparator of configured profile.
+// Without profile it's telecom alternate BMCA, so local priorities of servers are respected
+func (c *Config) Comparator() bmc.Comparator {
+	if p, ok := c.ptpProfile(); ok {
+		return bmc.ForProfile(p)
+	}
+	return bmc.TelcoDscmp
+}
+
+// DomainPriority returns priority of PTP domain, lower is preferred. Priority of single domain doesn't matter
+func (c *Config) DomainPriority(domain int) int {
+	return c.DomainPriorities[domain]
+}
+
+// validateDomains checks servers are grouped in valid PTP domains, and if there are several of them, all have distinct priorities
+func (c *Config) validateDomains(errs *ConfigErrors) {
+	used := map[int]bool{}
+	for server := range c.Servers {
+		used[c.ServerDomain(server)] = true
+	}
+	for server, domain := range c.ServerDomains {
+		if _, found := c.Servers[server]; !found {
+			errs.add(fmt.Errorf("domain is specified for unknown server %q", server))
+			continue
+		}
+		if domain < 0 || domain > 255 {
+			errs.add(fmt.Errorf("domain of server %q must be between 0 and 255, got %d", server, domain))
+			continue
+		}
+		if p, ok := c.ptpProfile(); ok && !p.Preset().DomainAllowed(uint8(domain)) {
+			errs.add(fmt.Errorf("domain of server %q must be between %d and %d for %s profile, got %d", server, p.Preset().MinDomain, p.Preset().MaxDomain, p, domain))
+		}
+	}
+	prios := map[int]int{}
+	for domain, prio := range c.DomainPriorities {
+		if !used[domain] {
+			errs.add(fmt.Errorf("priority is specified for domain %d, which has no servers", domain))
+			continue
+		}
+		if other, found := prios[prio]; found {
+			if other > domain {
+				other, domain = domain, other
+			}
+			errs.add(fmt.Errorf("domains %d and %d have the same priority %d", other, domain, prio))
+			continue
+		}
+		prios[prio] = domain
+	}
+	if len(used) > 1 {
+		for domain := range used {
+			if _, found := c.DomainPriorities[domain]; !found {
+				errs.add(fmt.Errorf("priority must be specified for domain %d, as servers are in %d domains", domain, len(used)))
+			}
+		}
+	}
+}
+
+// ListenEventPort returns local UDP port we receive event messages on
+func (c *Config) ListenEventPort() int {
+	if c.EventPort != 0 {
+		return c.EventPort
+	}
+	return ptp.PortEvent
+}
+
+// ListenGeneralPort returns local UDP port we receive general messages on
+func (c *Config) ListenGeneralPort() int {
+	if c.GeneralPort != 0 {
+		return c.GeneralPort
+	}
+	return ptp.PortGeneral
+}
+
+// ServerEventPort returns UDP port we send event messages to the server on
+func (c *Config) ServerEventPort(server string) int {
+	if p := c.ServerPorts[server].Event; p != 0 {
+		return p
+	}
+	return ptp.PortEvent
+}
+
+// ServerGeneralPort returns UDP port we send general messages to the server on
+func (c *Config) ServerGeneralPort(server string) int {
+	if p := c.ServerPorts[server].General; p != 0 {
+		return p
+	}
+	return ptp.PortGeneral
+}
+
+// hasL2Servers reports if we talk to any of the servers over L2 transport
+func (c *Config) hasL2Servers() bool {
+	for server := range c.Servers {
+		if c.Transport(server) == TransportL2 {
+			return true
+		}
+	}
+	return false
 }
 
 func addrToIPstr(address string) string {
+	if _, err := net.ParseMAC(address); err == nil {
+		return address
+	}
 	if net.ParseIP(address) == nil {
 		names, err := net.LookupHost(address)
 		if err == nil && len(names) > 0 {
@@ -169,11 +563,12 @@ func addrToIPstr(address string) string {
 func PrepareConfig(cfgPath string, targets []string, iface string, monitoringPort int, interval time.Duration, dscp int) (*Config, error) {
 	cfg := DefaultConfig()
 	var err error
+	var errs ConfigErrors
 	warn := func(name string) {
 		log.Warningf("overriding %s from CLI flag", name)
 	}
 	if cfgPath != "" {
-		cfg, err = ReadConfig(cfgPath)
+		cfg, errs, err = readConfig(cfgPath)
 		if err != nil {
 			return nil, fmt.Errorf("reading config from %q: %w", cfgPath, err)
 		}
@@ -212,8 +607,16 @@ func PrepareConfig(cfgPath string, targets []string, iface string, monitoringPor
 		warn("dscp")
 		cfg.DSCP = dscp
 	}
+	// report unknown keys together with everything else that is wrong
+	var validateErrs ConfigErrors
 	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("validating config: %w", err)
+		if !errors.As(err, &validateErrs) {
+			validateErrs = ConfigErrors{err}
+		}
+	}
+	errs = append(errs, validateErrs...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("validating config: %w", errs)
 	}
 	log.Debugf("config: %+v", cfg)
 	return cfg, nil
@@ -0,0 +1,197 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigErrors is a list of all problems found in config, so they can be fixed at once
+type ConfigErrors []error
+
+// Error implements error interface
+func (e ConfigErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d problems: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns all errors in the list
+func (e ConfigErrors) Unwrap() []error {
+	return e
+}
+
+// add appends err to the list unless it's nil
+func (e *ConfigErrors) add(err error) {
+	if err != nil {
+		*e = append(*e, err)
+	}
+}
+
+// errOrNil returns nil if there are no errors, so empty list is never returned as non-nil error
+func (e ConfigErrors) errOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// yamlFields returns types of struct fields by yaml key, same way yaml.v2 derives keys
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// levenshtein returns edit distance between two strings
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// suggestKey returns known key closest to the unknown one, empty string if none is close enough to be a typo
+func suggestKey(key string, known []string) string {
+	key = strings.ToLower(key)
+	best := ""
+	bestDistance := len(key)/3 + 1
+	for _, k := range known {
+		if d := levenshtein(key, k); d < bestDistance {
+			best = k
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// unknownKeys walks parsed yaml node and reports every key which doesn't map to a field of struct type t
+func unknownKeys(prefix string, node interface{}, t reflect.Type) ConfigErrors {
+	m, ok := node.(map[interface{}]interface{})
+	if !ok {
+		return nil
+	}
+	// maps like serverports hold a struct per item
+	if t.Kind() == reflect.Map {
+		return unknownMapKeys(prefix, m, t.Elem())
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	fields := yamlFields(t)
+	known := make([]string, 0, len(fields))
+	for k := range fields {
+		known = append(known, k)
+	}
+	sort.Strings(known)
+	keys := make([]string, 0, len(m))
+	values := map[string]interface{}{}
+	for k, v := range m {
+		key := fmt.Sprint(k)
+		keys = append(keys, key)
+		values[key] = v
+	}
+	sort.Strings(keys)
+
+	var errs ConfigErrors
+	for _, key := range keys {
+		ft, found := fields[key]
+		if !found {
+			if s := suggestKey(key, known); s != "" {
+				errs.add(fmt.Errorf("unknown key %q, did you mean %q?", prefix+key, prefix+s))
+			} else {
+				errs.add(fmt.Errorf("unknown key %q", prefix+key))
+			}
+			continue
+		}
+		errs = append(errs, unknownKeys(prefix+key+".", values[key], ft)...)
+	}
+	return errs
+}
+
+// unknownMapKeys checks every item of parsed yaml map against struct type t
+func unknownMapKeys(prefix string, m map[interface{}]interface{}, t reflect.Type) ConfigErrors {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	values := map[string]interface{}{}
+	for k, v := range m {
+		key := fmt.Sprint(k)
+		keys = append(keys, key)
+		values[key] = v
+	}
+	sort.Strings(keys)
+
+	var errs ConfigErrors
+	for _, key := range keys {
+		errs = append(errs, unknownKeys(prefix+key+".", values[key], t)...)
+	}
+	return errs
+}
+
+// checkConfigKeys reports all keys in yaml config SPTP doesn't know about
+func checkConfigKeys(data []byte) (ConfigErrors, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return unknownKeys("", raw, reflect.TypeOf(Config{})), nil
+}
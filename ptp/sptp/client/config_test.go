@@ -17,11 +17,15 @@ limitations under the License.
 package client
 
 import (
+	"errors"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/sptp/bmc"
 )
 
 func TestReadConfigMissing(t *testing.T) {
@@ -41,7 +45,19 @@ func TestReadConfigDefaults(t *testing.T) {
 		MetricsAggregationWindow: time.Duration(60) * time.Second,
 		AttemptsTXTS:             10,
 		TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+		ListenerWorkers:          4,
 		Timestamping:             HWTIMESTAMP,
+		UnicastNegotiation: UnicastNegotiationConfig{
+			Duration:       time.Minute,
+			RenewBefore:    10 * time.Second,
+			RequestTimeout: time.Second,
+		},
+		ServoState: ServoStateConfig{
+			MaxAge: time.Hour,
+		},
+		Capture: CaptureConfig{
+			MaxPackets: 100000,
+		},
 	}
 	require.Equal(t, want, cfg)
 }
@@ -87,18 +103,229 @@ measurement:
 			"192.168.0.13": 3,
 			"192.168.0.15": 1,
 		},
-		AttemptsTXTS: 12,
-		TimeoutTXTS:  time.Duration(40) * time.Millisecond,
+		AttemptsTXTS:    12,
+		TimeoutTXTS:     time.Duration(40) * time.Millisecond,
+		ListenerWorkers: 4,
 		Measurement: MeasurementConfig{
 			PathDelayFilterLength:         59,
 			PathDelayFilter:               "median",
 			PathDelayDiscardFilterEnabled: true,
 			PathDelayDiscardBelow:         2 * time.Microsecond,
 		},
+		UnicastNegotiation: UnicastNegotiationConfig{
+			Duration:       time.Minute,
+			RenewBefore:    10 * time.Second,
+			RequestTimeout: time.Second,
+		},
+		ServoState: ServoStateConfig{
+			MaxAge: time.Hour,
+		},
+		Capture: CaptureConfig{
+			MaxPackets: 100000,
+		},
 	}
 	require.Equal(t, want, cfg)
 }
 
+func TestReadConfigPorts(t *testing.T) {
+	f, err := os.CreateTemp("", "sptp")
+	require.NoError(t, err)
+	defer os.Remove(f.Name()) // clean up
+	_, err = f.Write([]byte(`iface: eth0
+eventport: 10319
+generalport: 10320
+servers:
+  192.168.0.10: 1
+  192.168.0.11: 2
+serverports:
+  192.168.0.10:
+    event: 11319
+    general: 11320
+  192.168.0.11:
+    event: 12319
+`))
+	require.NoError(t, err)
+	cfg, err := ReadConfig(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, 10319, cfg.ListenEventPort())
+	require.Equal(t, 10320, cfg.ListenGeneralPort())
+	require.Equal(t, 11319, cfg.ServerEventPort("192.168.0.10"))
+	require.Equal(t, 11320, cfg.ServerGeneralPort("192.168.0.10"))
+	require.Equal(t, 12319, cfg.ServerEventPort("192.168.0.11"))
+	require.Equal(t, ptp.PortGeneral, cfg.ServerGeneralPort("192.168.0.11"))
+
+	// standard ports by default
+	cfg = DefaultConfig()
+	require.Equal(t, ptp.PortEvent, cfg.ListenEventPort())
+	require.Equal(t, ptp.PortGeneral, cfg.ListenGeneralPort())
+	require.Equal(t, ptp.PortEvent, cfg.ServerEventPort("192.168.0.10"))
+	require.Equal(t, ptp.PortGeneral, cfg.ServerGeneralPort("192.168.0.10"))
+}
+
+func TestReadConfigLogging(t *testing.T) {
+	f, err := os.CreateTemp("", "sptp")
+	require.NoError(t, err)
+	defer os.Remove(f.Name()) // clean up
+	_, err = f.Write([]byte(`iface: eth0
+servers:
+  192.168.0.10: 1
+logging:
+  levels:
+    network: debug
+    servo: warning
+  rate_limit: 1m
+`))
+	require.NoError(t, err)
+	cfg, err := ReadConfig(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, LoggingConfig{Levels: map[string]string{"network": "debug", "servo": "warning"}, RateLimit: time.Minute}, cfg.Logging)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Logging.Levels["kernel"] = "debug"
+	err = cfg.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid logging config")
+}
+
+func TestReadConfigDomains(t *testing.T) {
+	f, err := os.CreateTemp("", "sptp")
+	require.NoError(t, err)
+	defer os.Remove(f.Name()) // clean up
+	_, err = f.Write([]byte(`iface: eth0
+servers:
+  192.168.0.10: 1
+  192.168.0.11: 2
+  192.168.0.20: 1
+serverdomains:
+  192.168.0.20: 24
+domainpriorities:
+  0: 1
+  24: 2
+`))
+	require.NoError(t, err)
+	cfg, err := ReadConfig(f.Name())
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, 0, cfg.ServerDomain("192.168.0.10"))
+	require.Equal(t, 24, cfg.ServerDomain("192.168.0.20"))
+	require.Equal(t, 1, cfg.DomainPriority(0))
+	require.Equal(t, 2, cfg.DomainPriority(24))
+}
+
+func TestConfigValidateDomains(t *testing.T) {
+	testCases := []struct {
+		name    string
+		domains map[string]int
+		prios   map[int]int
+		wantErr string
+	}{
+		{
+			name: "single domain",
+			domains: map[string]int{
+				"192.168.0.10": 24,
+				"192.168.0.11": 24,
+			},
+		},
+		{
+			name: "several domains",
+			domains: map[string]int{
+				"192.168.0.11": 24,
+			},
+			prios: map[int]int{0: 2, 24: 1},
+		},
+		{
+			name: "unknown server",
+			domains: map[string]int{
+				"192.168.0.12": 24,
+			},
+			wantErr: `domain is specified for unknown server "192.168.0.12"`,
+		},
+		{
+			name: "domain out of range",
+			domains: map[string]int{
+				"192.168.0.10": 256,
+				"192.168.0.11": 256,
+			},
+			wantErr: "2 problems: domain of server \"192.168.0.1[01]\" must be between 0 and 255, got 256; domain of server \"192.168.0.1[01]\" must be between 0 and 255, got 256",
+		},
+		{
+			name:    "priority of domain without servers",
+			prios:   map[int]int{24: 1},
+			wantErr: "priority is specified for domain 24, which has no servers",
+		},
+		{
+			name: "missing priority",
+			domains: map[string]int{
+				"192.168.0.11": 24,
+			},
+			prios:   map[int]int{0: 1},
+			wantErr: "priority must be specified for domain 24, as servers are in 2 domains",
+		},
+		{
+			name: "same priority",
+			domains: map[string]int{
+				"192.168.0.11": 24,
+			},
+			prios:   map[int]int{0: 1, 24: 1},
+			wantErr: "domains 0 and 24 have the same priority 1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := DefaultConfig()
+			c.Iface = "eth0"
+			c.Servers = map[string]int{
+				"192.168.0.10": 1,
+				"192.168.0.11": 2,
+			}
+			c.ServerDomains = tc.domains
+			c.DomainPriorities = tc.prios
+			err := c.Validate()
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Regexp(t, "^"+tc.wantErr+"$", err.Error())
+			}
+		})
+	}
+}
+
+func TestConfigProfile(t *testing.T) {
+	a := &ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterPriority1: 1, GrandmasterPriority2: 2}}
+	b := &ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterPriority1: 2, GrandmasterPriority2: 1}}
+	c := DefaultConfig()
+	c.Iface = "eth0"
+	c.Servers = map[string]int{"192.168.0.10": 1, "192.168.0.11": 2}
+	require.NoError(t, c.Validate())
+	require.Equal(t, 0, c.ServerDomain("192.168.0.10"))
+	require.Equal(t, bmc.BBetter, c.Comparator()(a, b, 1, 1), "telecom BMCA ignores priority1 by default")
+
+	c.Profile = "default"
+	require.NoError(t, c.Validate())
+	require.Equal(t, bmc.ABetter, c.Comparator()(a, b, 1, 1))
+
+	c.Profile = "g8275.2"
+	c.ServerDomains = map[string]int{"192.168.0.11": 45}
+	c.DomainPriorities = map[int]int{44: 1, 45: 2}
+	require.NoError(t, c.Validate())
+	require.Equal(t, 44, c.ServerDomain("192.168.0.10"))
+	require.Equal(t, 45, c.ServerDomain("192.168.0.11"))
+	require.Equal(t, bmc.BBetter, c.Comparator()(a, b, 1, 1))
+
+	c.ServerDomains = map[string]int{"192.168.0.10": 0, "192.168.0.11": 0}
+	c.DomainPriorities = nil
+	err := c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `domain of server "192.168.0.11" must be between 44 and 63 for g8275.2 profile, got 0`)
+
+	c.ServerDomains = nil
+	c.Profile = "enterprise"
+	err = c.Validate()
+	require.Error(t, err)
+	require.Equal(t, `unknown PTP profile "enterprise"`, err.Error())
+}
+
 func TestBackoffConfigValidate(t *testing.T) {
 	testCases := []struct {
 		name    string
@@ -442,96 +669,897 @@ func TestConfigValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			err := tc.in.Validate()
-			if tc.wantErr {
-				require.Error(t, err)
-			} else {
-				require.NoError(t, err)
-			}
-		})
-	}
-}
-
-func TestPrepareConfig(t *testing.T) {
-	f, err := os.CreateTemp("", "sptp")
-	require.NoError(t, err)
-	defer os.Remove(f.Name()) // clean up
-	_, err = f.Write([]byte(`iface: eth0
-interval: 1s
-exchangetimeout: 200ms
-timestamping: hardware
-monitoringport: 4269
-dscp: 35
-firststepthreshold: 1s
-metricsaggregationwindow: 10s
-attemptstxts: 12
-timeouttxts: 40ms
-servers:
-  192.168.0.10: 2
-  192.168.0.13: 3
-  192.168.0.15: 1
-measurement:
-  path_delay_filter_length: 59
-  path_delay_filter: "median"
-  path_delay_discard_filter_enabled: true
-  path_delay_discard_below: 2us
-`))
-	require.NoError(t, err)
-	cfg, err := PrepareConfig(f.Name(), nil, "eth1", 3456, 2*time.Second, 42)
-	require.NoError(t, err)
-	want := &Config{
-		Iface:                    "eth1",
-		Timestamping:             "hardware",
-		MonitoringPort:           3456,
-		Interval:                 2 * time.Second,
-		ExchangeTimeout:          200 * time.Millisecond,
-		DSCP:                     42,
-		FirstStepThreshold:       time.Second,
-		MetricsAggregationWindow: 10 * time.Second,
-		Servers: map[string]int{
-			"192.168.0.10": 2,
-			"192.168.0.13": 3,
-			"192.168.0.15": 1,
+		{
+			name: "l2 transport",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10":      0,
+					"0c:42:a1:6d:7c:a6": 1,
+				},
+				Transports: map[string]string{
+					"0c:42:a1:6d:7c:a6": TransportL2,
+					"192.168.0.10":      TransportUDP,
+				},
+			},
+			wantErr: false,
 		},
-		AttemptsTXTS: 12,
-		TimeoutTXTS:  time.Duration(40) * time.Millisecond,
-		Measurement: MeasurementConfig{
-			PathDelayFilterLength:         59,
-			PathDelayFilter:               "median",
-			PathDelayDiscardFilterEnabled: true,
-			PathDelayDiscardBelow:         2 * time.Microsecond,
+		{
+			name: "l2 transport, not a MAC",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				Transports: map[string]string{
+					"192.168.0.10": TransportL2,
+				},
+			},
+			wantErr: true,
 		},
-	}
-	require.Equal(t, want, cfg)
-}
-
-func TestPrepareConfigDefaults(t *testing.T) {
-	cfg, err := PrepareConfig("", []string{"192.168.0.10"}, "eth1", 3456, 2*time.Second, 42)
-	require.NoError(t, err)
-	want := &Config{
-		Iface:                    "eth1",
-		Timestamping:             "hardware",
-		MonitoringPort:           3456,
-		Interval:                 2 * time.Second,
-		ExchangeTimeout:          100 * time.Millisecond,
-		DSCP:                     42,
-		FirstStepThreshold:       0,
-		MetricsAggregationWindow: 60 * time.Second,
-		Servers: map[string]int{
-			"192.168.0.10": 0,
+		{
+			name: "unknown transport",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				Transports: map[string]string{
+					"192.168.0.10": "carrier pigeon",
+				},
+			},
+			wantErr: true,
 		},
-		AttemptsTXTS: 10,
-		TimeoutTXTS:  time.Duration(50) * time.Millisecond,
-		Measurement: MeasurementConfig{
-			PathDelayFilterLength:         0,
-			PathDelayFilter:               "",
-			PathDelayDiscardFilterEnabled: false,
-			PathDelayDiscardBelow:         0,
+		{
+			name: "transport for unknown server",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				Transports: map[string]string{
+					"192.168.0.11": TransportUDP,
+				},
+			},
+			wantErr: true,
 		},
-	}
-	require.Equal(t, want, cfg)
+		{
+			name: "step policy never",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				StepPolicy: StepPolicyConfig{
+					Policy:    StepPolicyNever,
+					MaxOffset: time.Second,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "bad step policy",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				StepPolicy: StepPolicyConfig{
+					Policy: "sometimes",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "step policy never with firststepthreshold",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				FirstStepThreshold: time.Second,
+				StepPolicy: StepPolicyConfig{
+					Policy: StepPolicyNever,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "binddevice too long",
+			in: Config{
+				Iface:                    "eth0",
+				BindDevice:               "averyveryverylongvrf",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "authentication for unknown server",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				Authentication: AuthenticationConfig{
+					Keys:    map[uint32]string{1: "000102030405060708090a0b0c0d0e0f"},
+					Servers: map[string]uint32{"192.168.0.11": 1},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative listenerworkers",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				ListenerWorkers:          -1,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "phc2sys",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				Phc2Sys: Phc2SysConfig{
+					Enabled:  true,
+					Interval: time.Second,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "phc2sys no interval",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				Phc2Sys: Phc2SysConfig{
+					Enabled: true,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "phc2sys with sw timestamps",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             SWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				Phc2Sys: Phc2SysConfig{
+					Enabled:  true,
+					Interval: time.Second,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "bridge",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				Bridge: BridgeConfig{
+					Device:   "/dev/ptp1",
+					MaxDelay: 10 * time.Microsecond,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "bridge with sw timestamps",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             SWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				Bridge: BridgeConfig{
+					Device: "/dev/ptp1",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "DSCP too large",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				DSCP:                     64,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "interval too small",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Millisecond,
+				ExchangeTimeout:          100 * time.Microsecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "interval too large",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 2 * time.Hour,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "monitoringport too large",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				MonitoringPort:           65536,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "server is not an IP",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"gm.example.com": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "server interval",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				ServerIntervals: map[string]time.Duration{
+					"192.168.0.10": 4 * time.Second,
+				},
+				Stagger: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "server interval for unknown server",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				ServerIntervals: map[string]time.Duration{
+					"192.168.0.11": 4 * time.Second,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "server interval not a multiple of interval",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				ServerIntervals: map[string]time.Duration{
+					"192.168.0.10": 1500 * time.Millisecond,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "server interval with unicast negotiation",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+				ServerIntervals: map[string]time.Duration{
+					"192.168.0.10": 2 * time.Second,
+				},
+				UnicastNegotiation: UnicastNegotiationConfig{
+					Enabled:        true,
+					Duration:       time.Minute,
+					RenewBefore:    10 * time.Second,
+					RequestTimeout: time.Second,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "maxclockclass too large",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				MaxClockClass:            256,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "armleapsecond without disciplining system clock",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				ArmLeapSecond:            true,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "armleapsecond with software timestamping",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             SWTIMESTAMP,
+				ArmLeapSecond:            true,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "maintaintaioffset without disciplining system clock",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				MaintainTAIOffset:        true,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "maintaintaioffset with phc2sys",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				MaintainTAIOffset:        true,
+				Phc2Sys:                  Phc2SysConfig{Enabled: true, Interval: time.Second},
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "eventport too large",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				EventPort:                65536,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "generalport same as eventport",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				EventPort:                10320,
+				GeneralPort:              10320,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "generalport is default eventport",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				GeneralPort:              319,
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "serverports for unknown server",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				ServerPorts: map[string]ServerPorts{
+					"192.168.0.11": {Event: 10319},
+				},
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "serverports for L2 server",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				Transports: map[string]string{
+					"0c:42:a1:6d:7c:a6": TransportL2,
+				},
+				ServerPorts: map[string]ServerPorts{
+					"0c:42:a1:6d:7c:a6": {Event: 10319},
+				},
+				Servers: map[string]int{
+					"0c:42:a1:6d:7c:a6": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "serverports out of range",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				ServerPorts: map[string]ServerPorts{
+					"192.168.0.10": {General: -1},
+				},
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "custom ports",
+			in: Config{
+				Iface:                    "eth0",
+				Interval:                 time.Second,
+				ExchangeTimeout:          100 * time.Millisecond,
+				MetricsAggregationWindow: time.Duration(60) * time.Second,
+				AttemptsTXTS:             10,
+				TimeoutTXTS:              time.Duration(50) * time.Millisecond,
+				Timestamping:             HWTIMESTAMP,
+				EventPort:                10319,
+				GeneralPort:              10320,
+				ServerPorts: map[string]ServerPorts{
+					"192.168.0.10": {Event: 11319, General: 11320},
+				},
+				Servers: map[string]int{
+					"192.168.0.10": 0,
+				},
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.in.Validate()
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidateHybrid(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Iface = "eth0"
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 0,
+		"fd00::1":      1,
+		"192.168.0.11": 2,
+	}
+	cfg.Transports = map[string]string{
+		"192.168.0.10": TransportHybrid,
+		"fd00::1":      TransportHybrid,
+	}
+	require.NoError(t, cfg.Validate())
+	v4, v6 := cfg.multicastFamilies()
+	require.True(t, v4)
+	require.True(t, v6)
+
+	cfg.EventPort = 10319
+	cfg.UnicastNegotiation.Enabled = true
+	err := cfg.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `"hybrid" transport requires eventport 319 and generalport 320 to receive multicast`)
+	require.Contains(t, err.Error(), `server "192.168.0.10" can't use "hybrid" transport with unicastnegotiation`)
+
+	cfg = DefaultConfig()
+	cfg.Iface = "eth0"
+	cfg.Servers = map[string]int{
+		"0c:42:a1:6d:7c:a6": 0,
+	}
+	cfg.Transports = map[string]string{
+		"0c:42:a1:6d:7c:a6": TransportHybrid,
+	}
+	err = cfg.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `server "0c:42:a1:6d:7c:a6" must be an IP address to use "hybrid" transport`)
+}
+
+func TestPrepareConfig(t *testing.T) {
+	f, err := os.CreateTemp("", "sptp")
+	require.NoError(t, err)
+	defer os.Remove(f.Name()) // clean up
+	_, err = f.Write([]byte(`iface: eth0
+interval: 1s
+exchangetimeout: 200ms
+timestamping: hardware
+monitoringport: 4269
+dscp: 35
+firststepthreshold: 1s
+metricsaggregationwindow: 10s
+attemptstxts: 12
+timeouttxts: 40ms
+servers:
+  192.168.0.10: 2
+  192.168.0.13: 3
+  192.168.0.15: 1
+measurement:
+  path_delay_filter_length: 59
+  path_delay_filter: "median"
+  path_delay_discard_filter_enabled: true
+  path_delay_discard_below: 2us
+`))
+	require.NoError(t, err)
+	cfg, err := PrepareConfig(f.Name(), nil, "eth1", 3456, 2*time.Second, 42)
+	require.NoError(t, err)
+	want := &Config{
+		Iface:                    "eth1",
+		Timestamping:             "hardware",
+		MonitoringPort:           3456,
+		Interval:                 2 * time.Second,
+		ExchangeTimeout:          200 * time.Millisecond,
+		DSCP:                     42,
+		FirstStepThreshold:       time.Second,
+		MetricsAggregationWindow: 10 * time.Second,
+		Servers: map[string]int{
+			"192.168.0.10": 2,
+			"192.168.0.13": 3,
+			"192.168.0.15": 1,
+		},
+		AttemptsTXTS:    12,
+		TimeoutTXTS:     time.Duration(40) * time.Millisecond,
+		ListenerWorkers: 4,
+		Measurement: MeasurementConfig{
+			PathDelayFilterLength:         59,
+			PathDelayFilter:               "median",
+			PathDelayDiscardFilterEnabled: true,
+			PathDelayDiscardBelow:         2 * time.Microsecond,
+		},
+		UnicastNegotiation: UnicastNegotiationConfig{
+			Duration:       time.Minute,
+			RenewBefore:    10 * time.Second,
+			RequestTimeout: time.Second,
+		},
+		ServoState: ServoStateConfig{
+			MaxAge: time.Hour,
+		},
+		Capture: CaptureConfig{
+			MaxPackets: 100000,
+		},
+	}
+	require.Equal(t, want, cfg)
+}
+
+func TestPrepareConfigDefaults(t *testing.T) {
+	cfg, err := PrepareConfig("", []string{"192.168.0.10"}, "eth1", 3456, 2*time.Second, 42)
+	require.NoError(t, err)
+	want := &Config{
+		Iface:                    "eth1",
+		Timestamping:             "hardware",
+		MonitoringPort:           3456,
+		Interval:                 2 * time.Second,
+		ExchangeTimeout:          100 * time.Millisecond,
+		DSCP:                     42,
+		FirstStepThreshold:       0,
+		MetricsAggregationWindow: 60 * time.Second,
+		Servers: map[string]int{
+			"192.168.0.10": 0,
+		},
+		AttemptsTXTS:    10,
+		TimeoutTXTS:     time.Duration(50) * time.Millisecond,
+		ListenerWorkers: 4,
+		Measurement: MeasurementConfig{
+			PathDelayFilterLength:         0,
+			PathDelayFilter:               "",
+			PathDelayDiscardFilterEnabled: false,
+			PathDelayDiscardBelow:         0,
+		},
+		UnicastNegotiation: UnicastNegotiationConfig{
+			Duration:       time.Minute,
+			RenewBefore:    10 * time.Second,
+			RequestTimeout: time.Second,
+		},
+		ServoState: ServoStateConfig{
+			MaxAge: time.Hour,
+		},
+		Capture: CaptureConfig{
+			MaxPackets: 100000,
+		},
+	}
+	require.Equal(t, want, cfg)
+}
+
+func TestConfigValidateAllErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DSCP = 64
+	cfg.Timestamping = "magic"
+	err := cfg.Validate()
+	require.Error(t, err)
+	var errs ConfigErrors
+	require.True(t, errors.As(err, &errs))
+	// no servers, no iface, bad dscp and timestamping
+	require.Len(t, errs, 4)
+	require.Contains(t, err.Error(), "4 problems")
+}
+
+func TestSuggestKey(t *testing.T) {
+	known := []string{"interval", "iface", "dscp", "servers"}
+	require.Equal(t, "interval", suggestKey("intreval", known))
+	require.Equal(t, "interval", suggestKey("Interval", known))
+	require.Equal(t, "dscp", suggestKey("dsc", known))
+	require.Equal(t, "", suggestKey("completelyunrelated", known))
+	require.Equal(t, 3, levenshtein("kitten", "sitting"))
+	require.Equal(t, 0, levenshtein("", ""))
+}
+
+func TestReadConfigUnknownKeys(t *testing.T) {
+	f, err := os.CreateTemp("", "sptp")
+	require.NoError(t, err)
+	defer os.Remove(f.Name()) // clean up
+	_, err = f.Write([]byte(`iface: eth0
+intreval: 1s
+foo: bar
+servers:
+  192.168.0.10: 2
+measurement:
+  path_delay_filtr: "median"
+`))
+	require.NoError(t, err)
+	_, err = ReadConfig(f.Name())
+	require.Error(t, err)
+	var errs ConfigErrors
+	require.True(t, errors.As(err, &errs))
+	require.Equal(t, 3, len(errs))
+	require.Equal(t, `unknown key "foo"`, errs[0].Error())
+	require.Equal(t, `unknown key "intreval", did you mean "interval"?`, errs[1].Error())
+	require.Equal(t, `unknown key "measurement.path_delay_filtr", did you mean "measurement.path_delay_filter"?`, errs[2].Error())
+}
+
+func TestPrepareConfigAllErrors(t *testing.T) {
+	f, err := os.CreateTemp("", "sptp")
+	require.NoError(t, err)
+	defer os.Remove(f.Name()) // clean up
+	_, err = f.Write([]byte(`iface: eth0
+timestmaping: hardware
+dscp: 100
+servers:
+  192.168.0.10: 2
+`))
+	require.NoError(t, err)
+	_, err = PrepareConfig(f.Name(), nil, "", 0, 0, 0)
+	require.Error(t, err)
+	var errs ConfigErrors
+	require.True(t, errors.As(err, &errs))
+	// typo is reported along with out of range dscp
+	require.Len(t, errs, 2)
+	require.Contains(t, err.Error(), `unknown key "timestmaping", did you mean "timestamping"?`)
+	require.Contains(t, err.Error(), "dscp must be between 0 and 63, got 100")
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package client
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -35,6 +36,29 @@ const (
 	SWTIMESTAMP = timestamp.SWTIMESTAMP
 )
 
+// errNoTXTS is returned by WriteToWithTS when packet was sent, but kernel didn't give us its TX timestamp.
+// Time returned alongside is the userspace time right before sending.
+var errNoTXTS = errors.New("failed to get timestamp of last packet")
+
+// txtsError is errNoTXTS keeping the reason, so it can be classified with timestamp.Classify
+type txtsError struct {
+	err error
+}
+
+func (e *txtsError) Error() string {
+	return fmt.Sprintf("%v: %v", errNoTXTS, e.err)
+}
+
+// Unwrap returns the reason kernel didn't give us TX timestamp
+func (e *txtsError) Unwrap() error {
+	return e.err
+}
+
+// Is makes txtsError match errNoTXTS
+func (e *txtsError) Is(target error) bool {
+	return target == errNoTXTS
+}
+
 // UDPConn describes what functionality we expect from UDP connection
 type UDPConn interface {
 	ReadFromUDP(b []byte) (int, *net.UDPAddr, error)
@@ -65,13 +89,14 @@ func newUDPConnTS(conn *net.UDPConn, connFd int) *udpConnTS {
 func (c *udpConnTS) WriteToWithTS(b []byte, addr net.Addr) (int, time.Time, error) {
 	c.l.Lock()
 	defer c.l.Unlock()
+	sent := time.Now()
 	n, err := c.WriteTo(b, addr)
 	if err != nil {
 		return 0, time.Time{}, err
 	}
 	hwts, _, err := timestamp.ReadTXtimestamp(c.connFd)
 	if err != nil {
-		return 0, time.Time{}, fmt.Errorf("failed to get timestamp of last packet: %w", err)
+		return n, sent, &txtsError{err: err}
 	}
 	return n, hwts, nil
 }
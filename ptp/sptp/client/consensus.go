@@ -0,0 +1,112 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ConsensusConfig describes configuration of the check that best GM agrees with the rest of responsive GMs
+type ConsensusConfig struct {
+	Enabled   bool          `yaml:"enabled"`   // compare offset to best GM with offsets to other GMs every tick
+	Threshold time.Duration `yaml:"threshold"` // best GM is a falseticker suspect if its offset is further than threshold from the consensus
+	MinGMs    int           `yaml:"min_gms"`   // how many other GMs are needed to form the consensus
+	Failover  bool          `yaml:"failover"`  // exclude falseticker suspect from BMCA and sync to the next best GM
+}
+
+// Validate ConsensusConfig is sane
+func (c *ConsensusConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Threshold <= 0 {
+		return fmt.Errorf("threshold must be greater than zero")
+	}
+	if c.MinGMs <= 0 {
+		return fmt.Errorf("min_gms must be greater than zero")
+	}
+	return nil
+}
+
+// consensus checks if best GM is a falseticker: a GM with wrong time but perfectly good announces
+type consensus struct {
+	cfg *ConsensusConfig
+	// GM currently suspected, so we only complain once
+	suspect string
+}
+
+func newConsensus(cfg *ConsensusConfig) *consensus {
+	return &consensus{cfg: cfg}
+}
+
+// median returns median of the offsets, which must not be empty
+func median(offsets []time.Duration) time.Duration {
+	sorted := make([]time.Duration, len(offsets))
+	copy(sorted, offsets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return sorted[mid-1] + (sorted[mid]-sorted[mid-1])/2
+}
+
+// divergence returns how far offset to best GM is from the median offset to the others.
+// It reports false if there are not enough other GMs to tell
+func (c *consensus) divergence(best string, offsets map[string]time.Duration) (time.Duration, bool) {
+	bestOffset, found := offsets[best]
+	if !found {
+		return 0, false
+	}
+	others := make([]time.Duration, 0, len(offsets))
+	for addr, offset := range offsets {
+		if addr != best {
+			others = append(others, offset)
+		}
+	}
+	if len(others) == 0 || len(others) < c.cfg.MinGMs {
+		return 0, false
+	}
+	d := bestOffset - median(others)
+	if d < 0 {
+		d = -d
+	}
+	return d, true
+}
+
+// check reports if best GM diverges from the consensus of the other GMs, given offsets measured to all of them this tick,
+// along with the divergence
+func (c *consensus) check(best string, offsets map[string]time.Duration) (time.Duration, bool) {
+	d, ok := c.divergence(best, offsets)
+	if !ok {
+		return 0, false
+	}
+	if d <= c.cfg.Threshold {
+		if c.suspect == best {
+			servoLog.Infof("best master %q agrees with other GMs again", best)
+			c.suspect = ""
+		}
+		return d, false
+	}
+	if c.suspect != best {
+		servoLog.Warningf("falseticker suspect: offset to best master %q is %v away from the consensus of %d other GMs, threshold is %v", best, d, len(offsets)-1, c.cfg.Threshold)
+		c.suspect = best
+	}
+	return d, true
+}
@@ -0,0 +1,73 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsensusConfigValidate(t *testing.T) {
+	cfg := ConsensusConfig{}
+	require.NoError(t, cfg.Validate())
+	cfg = ConsensusConfig{Enabled: true, Threshold: time.Millisecond, MinGMs: 2}
+	require.NoError(t, cfg.Validate())
+	cfg.MinGMs = 0
+	require.Error(t, cfg.Validate())
+	cfg = ConsensusConfig{Enabled: true, Threshold: 0, MinGMs: 2}
+	require.Error(t, cfg.Validate())
+}
+
+func TestMedian(t *testing.T) {
+	require.Equal(t, 5*time.Microsecond, median([]time.Duration{5 * time.Microsecond}))
+	require.Equal(t, 2*time.Microsecond, median([]time.Duration{3 * time.Microsecond, 1 * time.Microsecond, 2 * time.Microsecond}))
+	require.Equal(t, -15*time.Microsecond, median([]time.Duration{-10 * time.Microsecond, -20 * time.Microsecond}))
+	offsets := []time.Duration{3, 1, 2}
+	median(offsets)
+	require.Equal(t, []time.Duration{3, 1, 2}, offsets, "input is not reordered")
+}
+
+func TestConsensusCheck(t *testing.T) {
+	c := newConsensus(&ConsensusConfig{Enabled: true, Threshold: 100 * time.Microsecond, MinGMs: 2})
+	offsets := map[string]time.Duration{
+		"a": 10 * time.Microsecond,
+		"b": 20 * time.Microsecond,
+	}
+	_, suspect := c.check("a", offsets)
+	require.False(t, suspect, "not enough GMs to form consensus")
+	_, suspect = c.check("c", offsets)
+	require.False(t, suspect, "best GM was not measured")
+
+	offsets["c"] = 30 * time.Microsecond
+	d, suspect := c.check("a", offsets)
+	require.False(t, suspect)
+	require.Equal(t, 15*time.Microsecond, d)
+
+	offsets["a"] = 5 * time.Millisecond
+	d, suspect = c.check("a", offsets)
+	require.True(t, suspect)
+	require.Equal(t, 4975*time.Microsecond, d)
+	require.Equal(t, "a", c.suspect)
+
+	offsets["a"] = -70 * time.Microsecond
+	d, suspect = c.check("a", offsets)
+	require.False(t, suspect, "within threshold")
+	require.Equal(t, 95*time.Microsecond, d)
+	require.Equal(t, "", c.suspect)
+}
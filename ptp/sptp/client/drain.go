@@ -0,0 +1,86 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// Signals to drain and undrain SPTP
+const (
+	drainSignal   = unix.SIGUSR1
+	undrainSignal = unix.SIGUSR2
+)
+
+// drain tells if we are asked to stop disciplining the clock, either by signal or by drain file.
+// While drained we keep measuring and reporting, but never touch the clock.
+type drain struct {
+	file     string
+	signaled int32
+}
+
+func newDrain(file string) *drain {
+	return &drain{file: file}
+}
+
+// set drains or undrains on request
+func (d *drain) set(drained bool) {
+	var v int32
+	if drained {
+		v = 1
+	}
+	atomic.StoreInt32(&d.signaled, v)
+}
+
+// active reports if we are drained
+func (d *drain) active() bool {
+	if atomic.LoadInt32(&d.signaled) == 1 {
+		return true
+	}
+	if d.file == "" {
+		return false
+	}
+	_, err := os.Stat(d.file)
+	return err == nil
+}
+
+// handleSignals drains on SIGUSR1 and undrains on SIGUSR2 until context is cancelled
+func (d *drain) handleSignals(ctx context.Context) {
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, drainSignal, undrainSignal)
+	defer signal.Stop(sigchan)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigchan:
+			if sig == drainSignal {
+				log.Warningf("got %v, draining", sig)
+				d.set(true)
+			} else {
+				log.Warningf("got %v, undraining", sig)
+				d.set(false)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/servo"
+)
+
+func TestDrainActive(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "drain")
+	d := newDrain(file)
+	require.False(t, d.active())
+	d.set(true)
+	require.True(t, d.active())
+	d.set(false)
+	require.False(t, d.active())
+
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	require.True(t, d.active())
+	require.NoError(t, os.Remove(file))
+	require.False(t, d.active())
+
+	require.False(t, newDrain("").active())
+}
+
+func TestProcessResultsDrain(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockServo := NewMockServo(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1)).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100)).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).AnyTimes()
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	p := &SPTP{
+		clock: mockClock,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		cfg:   cfg,
+		drain: newDrain(""),
+	}
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -100 * time.Microsecond,
+				Timestamp: ts,
+			},
+		},
+	}
+	require.NoError(t, p.initClients())
+
+	// not drained, business as usual
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.drained", int64(0))
+	mockServo.EXPECT().Sample(int64(-100*time.Microsecond), gomock.Any()).Return(12.3, servo.StateLocked)
+	mockClock.EXPECT().AdjFreqPPB(-12.3).Return(nil)
+	p.processResults(results)
+	require.Equal(t, "192.168.0.10", p.bestGM)
+
+	// drained, clock and servo are left alone
+	p.drain.set(true)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.drained", int64(1)).Times(2)
+	p.processResults(results)
+	p.processResults(results)
+	require.True(t, p.drained)
+
+	// undrained, servo starts over from current frequency
+	p.drain.set(false)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.drained", int64(0))
+	mockClock.EXPECT().FrequencyPPB().Return(10.0, nil)
+	mockClock.EXPECT().MaxFreqPPB().Return(500000.0, nil)
+	p.processResults(results)
+	require.False(t, p.drained)
+	require.NotEqual(t, mockServo, p.pi)
+}
@@ -17,16 +17,56 @@ limitations under the License.
 package client
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	gmstats "github.com/facebook/time/ptp/sptp/stats"
 )
 
+// Burster runs on-demand burst of exchanges with the GM
+type Burster interface {
+	Burst(ctx context.Context, server string, count int, interval time.Duration) (*gmstats.BurstResult, error)
+}
+
+// Capturer writes packets captured during last capture window as pcapng
+type Capturer interface {
+	WriteCapture(w io.Writer) error
+}
+
+// Maintainer controls the clock manually on authenticated requests
+type Maintainer interface {
+	Maintain(ctx context.Context, requester string, token string, req *gmstats.MaintenanceRequest) (*gmstats.MaintenanceState, error)
+}
+
+// capturePath is the http path packet capture is downloaded from
+const capturePath = "/capture"
+
+// loggingPath is the http path log channel levels are read and changed at
+const loggingPath = "/logging"
+
 // JSONStats is what we want to report as stats via http
 type JSONStats struct {
 	Stats
+
+	burstLock sync.RWMutex
+	burster   Burster
+
+	captureLock sync.RWMutex
+	capturer    Capturer
+
+	maintainLock sync.RWMutex
+	maintainer   Maintainer
 }
 
 // NewJSONStats returns a new JSONStats
@@ -34,11 +74,36 @@ func NewJSONStats() *JSONStats {
 	return &JSONStats{Stats: *NewStats()}
 }
 
+// SetBurster enables on-demand burst measurements via http
+func (s *JSONStats) SetBurster(b Burster) {
+	s.burstLock.Lock()
+	defer s.burstLock.Unlock()
+	s.burster = b
+}
+
+// SetCapturer enables download of captured packets via http
+func (s *JSONStats) SetCapturer(c Capturer) {
+	s.captureLock.Lock()
+	defer s.captureLock.Unlock()
+	s.capturer = c
+}
+
+// SetMaintainer enables manual clock control via http
+func (s *JSONStats) SetMaintainer(m Maintainer) {
+	s.maintainLock.Lock()
+	defer s.maintainLock.Unlock()
+	s.maintainer = m
+}
+
 // Start runs http server and initializes maps
 func (s *JSONStats) Start(monitoringport int) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleRootRequest)
 	mux.HandleFunc("/counters", s.handleCountersRequest)
+	mux.HandleFunc(gmstats.BurstPath, s.handleBurstRequest)
+	mux.HandleFunc(capturePath, s.handleCaptureRequest)
+	mux.HandleFunc(loggingPath, s.handleLoggingRequest)
+	mux.HandleFunc(gmstats.MaintenancePath, s.handleMaintenanceRequest)
 	addr := fmt.Sprintf(":%d", monitoringport)
 	log.Infof("Starting http json server on %s", addr)
 	err := http.ListenAndServe(addr, mux)
@@ -72,3 +137,172 @@ func (s *JSONStats) handleCountersRequest(w http.ResponseWriter, _ *http.Request
 		log.Errorf("Failed to reply: %v", err)
 	}
 }
+
+// handleBurstRequest runs on-demand burst with the GM and replies with its result
+func (s *JSONStats) handleBurstRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "burst must be requested with POST", http.StatusMethodNotAllowed)
+		return
+	}
+	s.burstLock.RLock()
+	b := s.burster
+	s.burstLock.RUnlock()
+	if b == nil {
+		http.Error(w, "burst is not available", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	count := gmstats.DefaultBurstCount
+	if v := q.Get("count"); v != "" {
+		c, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parsing count: %v", err), http.StatusBadRequest)
+			return
+		}
+		count = c
+	}
+	interval := gmstats.DefaultBurstInterval
+	if v := q.Get("interval"); v != "" {
+		i, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parsing interval: %v", err), http.StatusBadRequest)
+			return
+		}
+		interval = i
+	}
+	res, err := b.Burst(r.Context(), q.Get("server"), count, interval)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errBurstInProgress) {
+			code = http.StatusConflict
+		} else if errors.Is(err, errBurstNotRunning) {
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	js, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(js); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
+
+// handleCaptureRequest replies with pcapng of packets captured during last capture window
+func (s *JSONStats) handleCaptureRequest(w http.ResponseWriter, _ *http.Request) {
+	s.captureLock.RLock()
+	c := s.capturer
+	s.captureLock.RUnlock()
+	if c == nil {
+		http.Error(w, "capture is not available", http.StatusServiceUnavailable)
+		return
+	}
+	var buf bytes.Buffer
+	if err := c.WriteCapture(&buf); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, errCaptureDisabled) {
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pcapng")
+	w.Header().Set("Content-Disposition", `attachment; filename="sptp.pcapng"`)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
+
+// handleLoggingRequest replies with levels of log channels, changing level of a channel first if requested with POST
+func (s *JSONStats) handleLoggingRequest(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		q := r.URL.Query()
+		if err := SetLogLevel(q.Get("channel"), q.Get("level")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Infof("log channel %q level set to %q", q.Get("channel"), q.Get("level"))
+	default:
+		http.Error(w, "log levels must be requested with GET or changed with POST", http.StatusMethodNotAllowed)
+		return
+	}
+	js, err := json.Marshal(LogLevels())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(js); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
+
+// handleMaintenanceRequest replies with state of manual clock control, performing requested action first if it's a POST
+func (s *JSONStats) handleMaintenanceRequest(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := &gmstats.MaintenanceRequest{}
+	switch r.Method {
+	case http.MethodGet:
+		req.Action = gmstats.MaintenanceStatus
+	case http.MethodPost:
+		req.Action = q.Get("action")
+	default:
+		http.Error(w, "maintenance state must be requested with GET or action performed with POST", http.StatusMethodNotAllowed)
+		return
+	}
+	s.maintainLock.RLock()
+	m := s.maintainer
+	s.maintainLock.RUnlock()
+	if m == nil {
+		http.Error(w, "maintenance is not available", http.StatusServiceUnavailable)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if v := q.Get("amount"); v != "" {
+		a, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parsing amount: %v", err), http.StatusBadRequest)
+			return
+		}
+		req.Amount = a
+	}
+	if v := q.Get("duration"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parsing duration: %v", err), http.StatusBadRequest)
+			return
+		}
+		req.Duration = d
+	}
+	res, err := m.Maintain(r.Context(), r.RemoteAddr, token, req)
+	if err != nil {
+		code := http.StatusBadRequest
+		switch {
+		case errors.Is(err, errMaintenanceUnauthorized):
+			code = http.StatusUnauthorized
+		case errors.Is(err, errMaintenanceDisabled), errors.Is(err, errMaintenanceNotRunning):
+			code = http.StatusServiceUnavailable
+		case errors.Is(err, errMaintenanceConflict):
+			code = http.StatusConflict
+		case errors.Is(err, errMaintenanceClock):
+			code = http.StatusInternalServerError
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	js, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(js); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
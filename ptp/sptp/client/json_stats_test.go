@@ -17,8 +17,13 @@ limitations under the License.
 package client
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -92,3 +97,175 @@ func TestJSONStats(t *testing.T) {
 	}
 	require.Equal(t, expectedStats, gms)
 }
+
+type fakeBurster struct {
+	server   string
+	count    int
+	interval time.Duration
+	err      error
+}
+
+func (b *fakeBurster) Burst(_ context.Context, server string, count int, interval time.Duration) (*gmstats.BurstResult, error) {
+	b.server, b.count, b.interval = server, count, interval
+	if b.err != nil {
+		return nil, b.err
+	}
+	return &gmstats.BurstResult{GMAddress: server, Count: count, Interval: interval.Nanoseconds(), Succeeded: count}, nil
+}
+
+func TestJSONStatsBurst(t *testing.T) {
+	stats := NewJSONStats()
+	ts := httptest.NewServer(http.HandlerFunc(stats.handleBurstRequest))
+	defer ts.Close()
+
+	// not available until SPTP is set
+	_, err := gmstats.FetchBurst(ts.URL, "192.168.0.10", 16, time.Second/4)
+	require.EqualError(t, err, "Service Unavailable: burst is not available")
+
+	b := &fakeBurster{}
+	stats.SetBurster(b)
+	r, err := gmstats.FetchBurst(ts.URL, "192.168.0.10", 16, time.Second/4)
+	require.NoError(t, err)
+	require.Equal(t, &gmstats.BurstResult{GMAddress: "192.168.0.10", Count: 16, Interval: int64(time.Second / 4), Succeeded: 16}, r)
+	require.Equal(t, "192.168.0.10", b.server)
+	require.Equal(t, 16, b.count)
+	require.Equal(t, time.Second/4, b.interval)
+
+	b.err = errBurstInProgress
+	_, err = gmstats.FetchBurst(ts.URL, "192.168.0.10", 16, time.Second/4)
+	require.EqualError(t, err, "Conflict: burst is already in progress")
+
+	resp, err := http.Get(ts.URL + gmstats.BurstPath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+type fakeMaintainer struct {
+	token string
+	req   *gmstats.MaintenanceRequest
+	err   error
+}
+
+func (m *fakeMaintainer) Maintain(_ context.Context, _ string, token string, req *gmstats.MaintenanceRequest) (*gmstats.MaintenanceState, error) {
+	m.token, m.req = token, req
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &gmstats.MaintenanceState{Frozen: req.Action == gmstats.MaintenanceFreeze}, nil
+}
+
+func TestJSONStatsMaintenance(t *testing.T) {
+	stats := NewJSONStats()
+	ts := httptest.NewServer(http.HandlerFunc(stats.handleMaintenanceRequest))
+	defer ts.Close()
+
+	// not available until SPTP is set
+	_, err := gmstats.RequestMaintenance(ts.URL, "sekrit", &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceStatus})
+	require.EqualError(t, err, "Service Unavailable: maintenance is not available")
+
+	m := &fakeMaintainer{}
+	stats.SetMaintainer(m)
+	s, err := gmstats.RequestMaintenance(ts.URL, "sekrit", &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceStatus})
+	require.NoError(t, err)
+	require.Equal(t, &gmstats.MaintenanceState{}, s)
+	require.Equal(t, "sekrit", m.token)
+	require.Equal(t, &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceStatus}, m.req)
+
+	s, err = gmstats.RequestMaintenance(ts.URL, "sekrit", &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceFreeze})
+	require.NoError(t, err)
+	require.Equal(t, &gmstats.MaintenanceState{Frozen: true}, s)
+
+	_, err = gmstats.RequestMaintenance(ts.URL, "sekrit", &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceSlew, Amount: -time.Microsecond, Duration: time.Minute})
+	require.NoError(t, err)
+	require.Equal(t, &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceSlew, Amount: -time.Microsecond, Duration: time.Minute}, m.req)
+
+	m.err = errMaintenanceUnauthorized
+	_, err = gmstats.RequestMaintenance(ts.URL, "wrong", &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceFreeze})
+	require.EqualError(t, err, "Unauthorized: invalid maintenance token")
+
+	m.err = fmt.Errorf("%w: slew is in progress", errMaintenanceConflict)
+	_, err = gmstats.RequestMaintenance(ts.URL, "sekrit", &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceStep, Amount: time.Microsecond})
+	require.EqualError(t, err, "Conflict: can't do it now: slew is in progress")
+
+	resp, err := http.Post(ts.URL+gmstats.MaintenancePath+"?action=step&amount=soon", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+type fakeCapturer struct {
+	err error
+}
+
+func (c *fakeCapturer) WriteCapture(w io.Writer) error {
+	if c.err != nil {
+		return c.err
+	}
+	_, err := w.Write([]byte("pcapng"))
+	return err
+}
+
+func TestJSONStatsCapture(t *testing.T) {
+	stats := NewJSONStats()
+	ts := httptest.NewServer(http.HandlerFunc(stats.handleCaptureRequest))
+	defer ts.Close()
+
+	// not available until SPTP is set
+	resp, err := http.Get(ts.URL + capturePath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	c := &fakeCapturer{}
+	stats.SetCapturer(c)
+	resp, err = http.Get(ts.URL + capturePath)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/x-pcapng", resp.Header.Get("Content-Type"))
+	require.Equal(t, "pcapng", string(body))
+
+	c.err = errCaptureDisabled
+	resp, err = http.Get(ts.URL + capturePath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestJSONStatsLogging(t *testing.T) {
+	defer func() { require.NoError(t, ApplyLoggingConfig(&LoggingConfig{})) }()
+	stats := NewJSONStats()
+	ts := httptest.NewServer(http.HandlerFunc(stats.handleLoggingRequest))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+loggingPath+"?channel=network&level=debug", "", nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	levels := map[string]string{}
+	require.NoError(t, json.Unmarshal(body, &levels))
+	require.Equal(t, "debug", levels[LogChannelNetwork])
+	require.Len(t, levels, 3)
+
+	resp, err = http.Post(ts.URL+loggingPath+"?channel=nope&level=debug", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+loggingPath+"?channel=servo&level=loud", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+loggingPath, nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
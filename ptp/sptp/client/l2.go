@@ -0,0 +1,147 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/facebook/time/timestamp"
+)
+
+// Supported transports
+const (
+	// TransportUDP is PTP over UDP over IP (IEEE 1588-2019 Annex C and D)
+	TransportUDP = "udp"
+	// TransportL2 is PTP over IEEE 802.3 / Ethernet (IEEE 1588-2019 Annex E)
+	TransportL2 = "l2"
+	// TransportHybrid is PTP over UDP where Sync, FollowUp and Announce are multicast by the server, and DelayReq is unicast to it
+	TransportHybrid = "hybrid"
+)
+
+// L2Addr is an Ethernet address of the server we talk to over IEEE 802.3 transport
+type L2Addr struct {
+	MAC net.HardwareAddr
+}
+
+// Network returns name of the network
+func (a *L2Addr) Network() string {
+	return "ethernet"
+}
+
+// String returns MAC address as string
+func (a *L2Addr) String() string {
+	return a.MAC.String()
+}
+
+// SockaddrToMAC converts link layer socket address to MAC address, nil if it's not link layer address
+func SockaddrToMAC(sa unix.Sockaddr) net.HardwareAddr {
+	ll, ok := sa.(*unix.SockaddrLinklayer)
+	if !ok {
+		return nil
+	}
+	return net.HardwareAddr(ll.Addr[:ll.Halen])
+}
+
+// l2ConnTS is a raw AF_PACKET socket bound to ethertype 0x88F7 on a single interface.
+// It implements UDPConnWithTS so clients don't care which transport they use.
+type l2ConnTS struct {
+	connFd  int
+	ifindex int
+	l       sync.Mutex
+}
+
+func newL2ConnTS(iface *net.Interface) (*l2ConnTS, error) {
+	// SOCK_DGRAM so kernel builds and strips Ethernet header for us
+	connFd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM, int(timestamp.Htons(unix.ETH_P_1588)))
+	if err != nil {
+		return nil, fmt.Errorf("creating packet socket: %w", err)
+	}
+	sa := &unix.SockaddrLinklayer{
+		Protocol: timestamp.Htons(unix.ETH_P_1588),
+		Ifindex:  iface.Index,
+	}
+	if err := unix.Bind(connFd, sa); err != nil {
+		unix.Close(connFd)
+		return nil, fmt.Errorf("binding packet socket to %s: %w", iface.Name, err)
+	}
+	return &l2ConnTS{
+		connFd:  connFd,
+		ifindex: iface.Index,
+	}, nil
+}
+
+func (c *l2ConnTS) sockaddr(addr net.Addr) (*unix.SockaddrLinklayer, error) {
+	a, ok := addr.(*L2Addr)
+	if !ok {
+		return nil, fmt.Errorf("unsupported address %v for L2 transport", addr)
+	}
+	if len(a.MAC) != 6 {
+		return nil, fmt.Errorf("unsupported MAC address %v for L2 transport", a.MAC)
+	}
+	sa := &unix.SockaddrLinklayer{
+		Protocol: timestamp.Htons(unix.ETH_P_1588),
+		Ifindex:  c.ifindex,
+		Halen:    uint8(len(a.MAC)),
+	}
+	copy(sa.Addr[:], a.MAC)
+	return sa, nil
+}
+
+// ReadFromUDP is not supported, all packets are read with ReadPacketWithRXTimestamp
+func (c *l2ConnTS) ReadFromUDP(_ []byte) (int, *net.UDPAddr, error) {
+	return 0, nil, fmt.Errorf("ReadFromUDP is not supported by L2 transport")
+}
+
+// WriteTo sends packet to L2Addr
+func (c *l2ConnTS) WriteTo(b []byte, addr net.Addr) (int, error) {
+	sa, err := c.sockaddr(addr)
+	if err != nil {
+		return 0, err
+	}
+	if err := unix.Sendto(c.connFd, b, 0, sa); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *l2ConnTS) WriteToWithTS(b []byte, addr net.Addr) (int, time.Time, error) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	sent := time.Now()
+	n, err := c.WriteTo(b, addr)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	hwts, _, err := timestamp.ReadTXtimestamp(c.connFd)
+	if err != nil {
+		return n, sent, &txtsError{err: err}
+	}
+	return n, hwts, nil
+}
+
+func (c *l2ConnTS) ReadPacketWithRXTimestamp() ([]byte, unix.Sockaddr, time.Time, error) {
+	return timestamp.ReadPacketWithRXTimestamp(c.connFd)
+}
+
+func (c *l2ConnTS) Close() error {
+	return unix.Close(c.connFd)
+}
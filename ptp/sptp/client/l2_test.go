@@ -0,0 +1,151 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+)
+
+func TestSockaddrToMAC(t *testing.T) {
+	mac, err := net.ParseMAC("0c:42:a1:6d:7c:a6")
+	require.NoError(t, err)
+	sa := &unix.SockaddrLinklayer{Halen: 6}
+	copy(sa.Addr[:], mac)
+	require.Equal(t, mac, SockaddrToMAC(sa))
+	require.Nil(t, SockaddrToMAC(&unix.SockaddrInet4{}))
+}
+
+func TestL2ConnSockaddr(t *testing.T) {
+	mac, err := net.ParseMAC("0c:42:a1:6d:7c:a6")
+	require.NoError(t, err)
+	c := &l2ConnTS{ifindex: 3}
+	sa, err := c.sockaddr(&L2Addr{MAC: mac})
+	require.NoError(t, err)
+	require.Equal(t, 3, sa.Ifindex)
+	require.Equal(t, timestamp.Htons(unix.ETH_P_1588), sa.Protocol)
+	require.Equal(t, uint8(6), sa.Halen)
+	require.Equal(t, [8]byte{0x0c, 0x42, 0xa1, 0x6d, 0x7c, 0xa6}, sa.Addr)
+
+	_, err = c.sockaddr(&net.UDPAddr{IP: net.ParseIP("192.168.0.10"), Port: 319})
+	require.Error(t, err)
+
+	long, err := net.ParseMAC("00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01")
+	require.NoError(t, err)
+	_, err = c.sockaddr(&L2Addr{MAC: long})
+	require.Error(t, err)
+}
+
+func TestConfigTransport(t *testing.T) {
+	cfg := &Config{
+		Servers: map[string]int{
+			"192.168.0.10":      0,
+			"0c:42:a1:6d:7c:a6": 1,
+		},
+	}
+	require.Equal(t, TransportUDP, cfg.Transport("192.168.0.10"))
+	require.False(t, cfg.hasL2Servers())
+	cfg.Transports = map[string]string{"0c:42:a1:6d:7c:a6": TransportL2}
+	require.Equal(t, TransportL2, cfg.Transport("0c:42:a1:6d:7c:a6"))
+	require.True(t, cfg.hasL2Servers())
+}
+
+func TestRunListenerL2(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEventConn := NewMockUDPConnWithTS(ctrl)
+	mockEventConn.EXPECT().ReadPacketWithRXTimestamp().DoAndReturn(func() ([]byte, unix.Sockaddr, time.Time, error) {
+		time.Sleep(time.Second)
+		return nil, &unix.SockaddrInet4{}, time.Time{}, nil
+	}).AnyTimes()
+	mockGenConn := NewMockUDPConn(ctrl)
+	mockGenConn.EXPECT().ReadFromUDP(gomock.Any()).DoAndReturn(func(_ []byte) (int, *net.UDPAddr, error) {
+		time.Sleep(time.Second)
+		return 0, &net.UDPAddr{}, nil
+	}).AnyTimes()
+
+	mac, err := net.ParseMAC("0c:42:a1:6d:7c:a6")
+	require.NoError(t, err)
+	sent := 0
+	mockL2Conn := NewMockUDPConnWithTS(ctrl)
+	mockL2Conn.EXPECT().ReadPacketWithRXTimestamp().DoAndReturn(func() ([]byte, unix.Sockaddr, time.Time, error) {
+		if sent > 10 {
+			time.Sleep(time.Second)
+			return nil, &unix.SockaddrLinklayer{}, time.Time{}, nil
+		}
+		sa := &unix.SockaddrLinklayer{Halen: 6}
+		copy(sa.Addr[:], mac)
+		// every other packet is our own outgoing frame which must be ignored
+		if sent%2 == 0 {
+			sa.Pkttype = unix.PACKET_OUTGOING
+		}
+		sent++
+		return []byte{1, 2, 3, 4}, sa, time.Now(), nil
+	}).AnyTimes()
+
+	p := &SPTP{
+		stats: NewMockStatsServer(ctrl),
+		cfg: &Config{
+			Interval: time.Second,
+			Servers: map[string]int{
+				"192.168.0.10":      1,
+				"0C:42:A1:6D:7C:A6": 2,
+			},
+			Transports: map[string]string{
+				"0C:42:A1:6D:7C:A6": TransportL2,
+			},
+		},
+		eventConn: mockEventConn,
+		genConn:   mockGenConn,
+		l2Conn:    mockL2Conn,
+	}
+	require.NoError(t, p.initClients())
+	c, found := p.clients["0c:42:a1:6d:7c:a6"]
+	require.True(t, found, "L2 client address must be normalized")
+	require.Equal(t, &L2Addr{MAC: mac}, c.eventAddr)
+	require.Equal(t, mockL2Conn, c.eventConn)
+	require.Equal(t, 2, p.priorities["0c:42:a1:6d:7c:a6"])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = p.RunListener(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 5, c.rx.len())
+	require.Equal(t, 0, p.clients["192.168.0.10"].rx.len())
+}
+
+func TestL2ClientUsesSameAddrForNegotiation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mac, err := net.ParseMAC("0c:42:a1:6d:7c:a6")
+	require.NoError(t, err)
+	l2Conn := NewMockUDPConnWithTS(ctrl)
+	c := newL2Client(mac, ptp.ClockIdentity(0xc42a1fffe6d7ca6), l2Conn, &MeasurementConfig{}, NewMockStatsServer(ctrl))
+	require.Equal(t, "0c:42:a1:6d:7c:a6", c.server)
+	require.NoError(t, c.enableNegotiation(NewMockUDPConn(ctrl), ptp.PortGeneral, testNegotiationConfig(), time.Second))
+	require.Equal(t, c.eventAddr, c.genAddr)
+	require.Equal(t, l2Conn, c.genConn)
+}
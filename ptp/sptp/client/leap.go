@@ -0,0 +1,74 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"github.com/facebook/time/clock"
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// leapSetter is a clock kernel can apply leap seconds to
+type leapSetter interface {
+	SetLeap(leap int) error
+}
+
+// leapFromAnnounce returns leap second GM announces for the end of current UTC day
+func leapFromAnnounce(a *ptp.Announce) int {
+	switch {
+	case a.FlagField&ptp.FlagLeap61 != 0:
+		return clock.LeapInsert
+	case a.FlagField&ptp.FlagLeap59 != 0:
+		return clock.LeapDelete
+	}
+	return clock.LeapNone
+}
+
+// leapArmer keeps kernel leap second state in line with what best master announces
+type leapArmer struct {
+	clock leapSetter
+	// leap second kernel is armed for
+	armed int
+	// if we have set kernel state at least once
+	known bool
+}
+
+func newLeapArmer(c leapSetter) *leapArmer {
+	return &leapArmer{clock: c}
+}
+
+// update arms or disarms kernel if announced leap second has changed
+func (l *leapArmer) update(leap int) error {
+	if l.known && leap == l.armed {
+		return nil
+	}
+	if err := l.clock.SetLeap(leap); err != nil {
+		return err
+	}
+	switch leap {
+	case clock.LeapInsert:
+		servoLog.Warningf("best master announces leap second insertion at the end of UTC day, armed kernel")
+	case clock.LeapDelete:
+		servoLog.Warningf("best master announces leap second deletion at the end of UTC day, armed kernel")
+	default:
+		if l.known {
+			servoLog.Infof("best master no longer announces leap second, disarmed kernel")
+		}
+	}
+	l.armed = leap
+	l.known = true
+	return nil
+}
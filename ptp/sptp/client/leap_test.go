@@ -0,0 +1,72 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/clock"
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+type fakeLeapClock struct {
+	calls []int
+	err   error
+}
+
+func (c *fakeLeapClock) SetLeap(leap int) error {
+	c.calls = append(c.calls, leap)
+	return c.err
+}
+
+func TestLeapFromAnnounce(t *testing.T) {
+	a := &ptp.Announce{}
+	require.Equal(t, clock.LeapNone, leapFromAnnounce(a))
+	a.FlagField = ptp.FlagUnicast | ptp.FlagLeap61
+	require.Equal(t, clock.LeapInsert, leapFromAnnounce(a))
+	a.FlagField = ptp.FlagUnicast | ptp.FlagLeap59
+	require.Equal(t, clock.LeapDelete, leapFromAnnounce(a))
+}
+
+func TestLeapArmerUpdate(t *testing.T) {
+	c := &fakeLeapClock{}
+	l := newLeapArmer(c)
+
+	// kernel state is cleared on first update
+	require.NoError(t, l.update(clock.LeapNone))
+	require.NoError(t, l.update(clock.LeapNone))
+	require.Equal(t, []int{clock.LeapNone}, c.calls)
+
+	require.NoError(t, l.update(clock.LeapInsert))
+	require.NoError(t, l.update(clock.LeapInsert))
+	require.NoError(t, l.update(clock.LeapNone))
+	require.Equal(t, []int{clock.LeapNone, clock.LeapInsert, clock.LeapNone}, c.calls)
+}
+
+func TestLeapArmerUpdateError(t *testing.T) {
+	c := &fakeLeapClock{err: fmt.Errorf("nope")}
+	l := newLeapArmer(c)
+
+	require.Error(t, l.update(clock.LeapDelete))
+	// retried on next update
+	c.err = nil
+	require.NoError(t, l.update(clock.LeapDelete))
+	require.Equal(t, []int{clock.LeapDelete, clock.LeapDelete}, c.calls)
+}
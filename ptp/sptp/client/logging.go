@@ -0,0 +1,234 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// names of log channels
+const (
+	LogChannelProtocol = "protocol" // packets, negotiation, best master selection
+	LogChannelServo    = "servo"    // clock discipline
+	LogChannelNetwork  = "network"  // sockets, timestamps, receivers
+)
+
+// LoggingConfig describes per-channel logging
+type LoggingConfig struct {
+	Levels    map[string]string `yaml:"levels"`     // log level of each channel, channels not listed use global level
+	RateLimit time.Duration     `yaml:"rate_limit"` // log the same warning at most once per this interval, disabled if 0
+}
+
+// Validate LoggingConfig is sane
+func (c *LoggingConfig) Validate() error {
+	if c.RateLimit < 0 {
+		return fmt.Errorf("rate_limit must be 0 or positive")
+	}
+	for channel, level := range c.Levels {
+		if _, found := logChannels[channel]; !found {
+			return fmt.Errorf("unknown log channel %q", channel)
+		}
+		if _, err := log.ParseLevel(level); err != nil {
+			return fmt.Errorf("log channel %q: %w", channel, err)
+		}
+	}
+	return nil
+}
+
+// limitedLog is the state of rate limiting of a single warning
+type limitedLog struct {
+	last       time.Time
+	suppressed int
+}
+
+// logChannel logs through standard logger, with its own level and rate limiting of warnings
+type logChannel struct {
+	name string
+
+	sync.Mutex
+	// level of the channel, global level is used if not set
+	level     *log.Level
+	rateLimit time.Duration
+	// rate limiting state of warnings, by format
+	limited map[string]*limitedLog
+	now     func() time.Time
+}
+
+func newLogChannel(name string) *logChannel {
+	return &logChannel{name: name, limited: map[string]*limitedLog{}, now: time.Now}
+}
+
+var (
+	protocolLog = newLogChannel(LogChannelProtocol)
+	servoLog    = newLogChannel(LogChannelServo)
+	networkLog  = newLogChannel(LogChannelNetwork)
+
+	logChannels = map[string]*logChannel{
+		LogChannelProtocol: protocolLog,
+		LogChannelServo:    servoLog,
+		LogChannelNetwork:  networkLog,
+	}
+)
+
+// ApplyLoggingConfig sets levels and rate limiting of all log channels
+func ApplyLoggingConfig(cfg *LoggingConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	for name, c := range logChannels {
+		if err := c.setLevel(cfg.Levels[name]); err != nil {
+			return err
+		}
+		c.setRateLimit(cfg.RateLimit)
+	}
+	return nil
+}
+
+// SetLogLevel changes level of a log channel at runtime. Empty level makes channel use global level
+func SetLogLevel(channel, level string) error {
+	c, found := logChannels[channel]
+	if !found {
+		return fmt.Errorf("unknown log channel %q", channel)
+	}
+	return c.setLevel(level)
+}
+
+// LogLevels returns current level of each log channel
+func LogLevels() map[string]string {
+	levels := make(map[string]string, len(logChannels))
+	for name, c := range logChannels {
+		levels[name] = c.getLevel().String()
+	}
+	return levels
+}
+
+func (c *logChannel) setLevel(level string) error {
+	c.Lock()
+	defer c.Unlock()
+	if level == "" {
+		c.level = nil
+		return nil
+	}
+	l, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	c.level = &l
+	return nil
+}
+
+func (c *logChannel) getLevel() log.Level {
+	c.Lock()
+	defer c.Unlock()
+	if c.level == nil {
+		return log.GetLevel()
+	}
+	return *c.level
+}
+
+func (c *logChannel) setRateLimit(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.rateLimit = d
+	c.limited = map[string]*limitedLog{}
+}
+
+// allow reports if warning with this format can be logged now, along with how many were suppressed since the last one
+func (c *logChannel) allow(format string) (int, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if c.rateLimit <= 0 {
+		return 0, true
+	}
+	now := c.now()
+	l, found := c.limited[format]
+	if !found {
+		c.limited[format] = &limitedLog{last: now}
+		return 0, true
+	}
+	if now.Sub(l.last) < c.rateLimit {
+		l.suppressed++
+		return 0, false
+	}
+	suppressed := l.suppressed
+	l.last = now
+	l.suppressed = 0
+	return suppressed, true
+}
+
+func (c *logChannel) logf(level log.Level, format string, args ...interface{}) {
+	if level > c.getLevel() {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if level == log.WarnLevel {
+		suppressed, ok := c.allow(format)
+		if !ok {
+			return
+		}
+		if suppressed > 0 {
+			msg = fmt.Sprintf("%s (%d similar messages suppressed)", msg, suppressed)
+		}
+	}
+	c.logger(level).WithField("channel", c.name).Log(level, msg)
+}
+
+// logger returns logger which logs at level, using the same output and formatting as standard logger
+func (c *logChannel) logger(level log.Level) *log.Logger {
+	logger := log.StandardLogger()
+	if logger.IsLevelEnabled(level) {
+		return logger
+	}
+	// channel is more verbose than the rest
+	verbose := log.New()
+	verbose.SetOutput(logger.Out)
+	verbose.SetFormatter(logger.Formatter)
+	verbose.SetLevel(level)
+	return verbose
+}
+
+// Event logs warning with fields describing what happened. Events are never rate limited
+func (c *logChannel) Event(fields log.Fields, format string, args ...interface{}) {
+	if log.WarnLevel > c.getLevel() {
+		return
+	}
+	c.logger(log.WarnLevel).WithFields(fields).WithField("channel", c.name).Warningf(format, args...)
+}
+
+// Debugf logs debug message to the channel
+func (c *logChannel) Debugf(format string, args ...interface{}) {
+	c.logf(log.DebugLevel, format, args...)
+}
+
+// Infof logs info message to the channel
+func (c *logChannel) Infof(format string, args ...interface{}) {
+	c.logf(log.InfoLevel, format, args...)
+}
+
+// Warningf logs warning to the channel, unless the same warning was logged less than rate limit ago
+func (c *logChannel) Warningf(format string, args ...interface{}) {
+	c.logf(log.WarnLevel, format, args...)
+}
+
+// Errorf logs error to the channel
+func (c *logChannel) Errorf(format string, args ...interface{}) {
+	c.logf(log.ErrorLevel, format, args...)
+}
@@ -0,0 +1,144 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggingConfigValidate(t *testing.T) {
+	require.NoError(t, (&LoggingConfig{}).Validate())
+	require.NoError(t, (&LoggingConfig{Levels: map[string]string{"servo": "debug"}, RateLimit: time.Minute}).Validate())
+
+	err := (&LoggingConfig{RateLimit: -time.Second}).Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "rate_limit")
+
+	err = (&LoggingConfig{Levels: map[string]string{"kernel": "debug"}}).Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown log channel")
+
+	err = (&LoggingConfig{Levels: map[string]string{"network": "loud"}}).Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "network")
+}
+
+// captureLog redirects standard logger to a buffer until returned func is called
+func captureLog(level log.Level) (*bytes.Buffer, func()) {
+	var buf bytes.Buffer
+	logger := log.StandardLogger()
+	out, oldLevel := logger.Out, logger.GetLevel()
+	logger.SetOutput(&buf)
+	logger.SetLevel(level)
+	return &buf, func() {
+		logger.SetOutput(out)
+		logger.SetLevel(oldLevel)
+	}
+}
+
+func TestLogChannelLevels(t *testing.T) {
+	buf, restore := captureLog(log.InfoLevel)
+	defer restore()
+	defer func() { require.NoError(t, ApplyLoggingConfig(&LoggingConfig{})) }()
+
+	require.NoError(t, ApplyLoggingConfig(&LoggingConfig{Levels: map[string]string{"network": "debug", "servo": "error"}}))
+	require.Equal(t, map[string]string{"network": "debug", "servo": "error", "protocol": "info"}, LogLevels())
+
+	networkLog.Debugf("network debug")
+	servoLog.Warningf("servo warning")
+	protocolLog.Debugf("protocol debug")
+	protocolLog.Infof("protocol info")
+	out := buf.String()
+	require.Contains(t, out, "network debug")
+	require.Contains(t, out, "channel=network")
+	require.NotContains(t, out, "servo warning")
+	require.NotContains(t, out, "protocol debug")
+	require.Contains(t, out, "protocol info")
+
+	// changed at runtime
+	require.NoError(t, SetLogLevel("servo", "warning"))
+	servoLog.Warningf("servo warning")
+	require.Contains(t, buf.String(), "servo warning")
+	require.NoError(t, SetLogLevel("servo", ""))
+	require.Equal(t, "info", LogLevels()["servo"])
+
+	err := SetLogLevel("kernel", "debug")
+	require.Error(t, err)
+	err = SetLogLevel("servo", "loud")
+	require.Error(t, err)
+}
+
+func TestLogChannelRateLimit(t *testing.T) {
+	buf, restore := captureLog(log.InfoLevel)
+	defer restore()
+	c := newLogChannel("test")
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+	c.setRateLimit(time.Minute)
+
+	for i := 0; i < 5; i++ {
+		c.Warningf("ignoring packets from server %v", i)
+		now = now.Add(time.Second)
+	}
+	c.Warningf("something else")
+	// errors are never suppressed
+	c.Errorf("failed")
+	c.Errorf("failed")
+	out := buf.String()
+	require.Equal(t, 1, strings.Count(out, "ignoring packets"))
+	require.Contains(t, out, "ignoring packets from server 0")
+	require.Contains(t, out, "something else")
+	require.Equal(t, 2, strings.Count(out, "failed"))
+
+	now = now.Add(time.Minute)
+	c.Warningf("ignoring packets from server %v", 5)
+	require.Contains(t, buf.String(), "ignoring packets from server 5 (4 similar messages suppressed)")
+
+	// disabled
+	c.setRateLimit(0)
+	buf.Reset()
+	c.Warningf("ignoring packets from server %v", 6)
+	c.Warningf("ignoring packets from server %v", 7)
+	require.Equal(t, 2, strings.Count(buf.String(), "ignoring packets"))
+}
+
+func TestLogChannelEvent(t *testing.T) {
+	buf, restore := captureLog(log.InfoLevel)
+	defer restore()
+	c := newLogChannel("test")
+	c.setRateLimit(time.Minute)
+
+	// events are never suppressed
+	c.Event(log.Fields{"event": "maintenance", "action": "freeze"}, "clock frozen")
+	c.Event(log.Fields{"event": "maintenance", "action": "freeze"}, "clock frozen")
+	out := buf.String()
+	require.Equal(t, 2, strings.Count(out, "clock frozen"))
+	require.Contains(t, out, "event=maintenance")
+	require.Contains(t, out, "action=freeze")
+	require.Contains(t, out, "channel=test")
+
+	require.NoError(t, c.setLevel("error"))
+	buf.Reset()
+	c.Event(log.Fields{"event": "maintenance"}, "clock frozen")
+	require.Empty(t, buf.String())
+}
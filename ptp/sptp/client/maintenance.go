@@ -0,0 +1,327 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	gmstats "github.com/facebook/time/ptp/sptp/stats"
+)
+
+// minMaintenanceTokenLength is the shortest maintenance token we accept
+const minMaintenanceTokenLength = 16
+
+var (
+	errMaintenanceDisabled     = errors.New("maintenance is not enabled")
+	errMaintenanceUnauthorized = errors.New("invalid maintenance token")
+	errMaintenanceNotRunning   = errors.New("sptp is not running")
+	errMaintenanceConflict     = errors.New("can't do it now")
+	errMaintenanceClock        = errors.New("failed to adjust the clock")
+)
+
+// MaintenanceConfig describes manual control of the clock via monitoring API, for controlled recovery during incidents
+type MaintenanceConfig struct {
+	TokenFile string        `yaml:"token_file"` // file holding the token requests must carry, maintenance is disabled if empty
+	MaxStep   time.Duration `yaml:"max_step"`   // refuse to step or slew the clock by more than this, unlimited if 0
+}
+
+// Validate MaintenanceConfig is sane
+func (c *MaintenanceConfig) Validate() error {
+	if c.MaxStep < 0 {
+		return fmt.Errorf("max_step must be 0 or positive")
+	}
+	return nil
+}
+
+// readMaintenanceToken reads the token from the file, ignoring surrounding whitespace
+func readMaintenanceToken(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading maintenance token: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if len(token) < minMaintenanceTokenLength {
+		return nil, fmt.Errorf("maintenance token in %s must be at least %d characters long", path, minMaintenanceTokenLength)
+	}
+	return []byte(token), nil
+}
+
+// maintenanceRequest is a request to control the clock manually, handled by the main loop
+type maintenanceRequest struct {
+	gmstats.MaintenanceRequest
+	requester string
+	reply     chan maintenanceReply
+}
+
+type maintenanceReply struct {
+	state *gmstats.MaintenanceState
+	err   error
+}
+
+// maintenance is the state of manual clock control. Only the main loop touches it
+type maintenance struct {
+	token   []byte
+	maxStep time.Duration
+	frozen  bool
+	// while slewing, frequency clock had before slew and offset applied on top of it
+	slewBase  float64
+	slewPPB   float64
+	slewEnd   time.Time
+	slewTimer *time.Timer
+}
+
+func newMaintenance(cfg *MaintenanceConfig) (*maintenance, error) {
+	token, err := readMaintenanceToken(cfg.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return &maintenance{token: token, maxStep: cfg.MaxStep}, nil
+}
+
+// slewing reports if slew is in progress
+func (m *maintenance) slewing() bool {
+	return m.slewTimer != nil
+}
+
+// holds reports if the clock is under manual control, so servo must leave it alone
+func (m *maintenance) holds() bool {
+	return m.frozen || m.slewing()
+}
+
+// slewDone returns channel which fires once slew is over, nil if there is no slew in progress
+func (m *maintenance) slewDone() <-chan time.Time {
+	if m == nil || m.slewTimer == nil {
+		return nil
+	}
+	return m.slewTimer.C
+}
+
+func (m *maintenance) state() *gmstats.MaintenanceState {
+	s := &gmstats.MaintenanceState{Frozen: m.frozen, Slewing: m.slewing()}
+	if s.Slewing {
+		s.SlewPPB = m.slewPPB
+		s.SlewEnd = m.slewEnd.UnixNano()
+	}
+	return s
+}
+
+// validate checks request makes sense before it's passed to the main loop
+func (m *maintenance) validate(req *gmstats.MaintenanceRequest) error {
+	switch req.Action {
+	case gmstats.MaintenanceStatus, gmstats.MaintenanceFreeze, gmstats.MaintenanceResume:
+		return nil
+	case gmstats.MaintenanceStep, gmstats.MaintenanceSlew:
+	default:
+		return fmt.Errorf("unknown maintenance action %q", req.Action)
+	}
+	if req.Amount == 0 {
+		return fmt.Errorf("amount to %s the clock by must be specified", req.Action)
+	}
+	if m.maxStep > 0 && (req.Amount > m.maxStep || req.Amount < -m.maxStep) {
+		return fmt.Errorf("amount %v exceeds max step %v", req.Amount, m.maxStep)
+	}
+	if req.Action == gmstats.MaintenanceSlew && req.Duration <= 0 {
+		return fmt.Errorf("duration to slew the clock over must be positive")
+	}
+	return nil
+}
+
+// Maintain controls the clock manually on request authenticated with the token, and returns resulting state.
+// Clock can be stepped or slewed by the amount, and servo can be frozen and resumed. Every action is logged as an event
+func (p *SPTP) Maintain(ctx context.Context, requester string, token string, req *gmstats.MaintenanceRequest) (*gmstats.MaintenanceState, error) {
+	m := p.maintenance
+	if m == nil {
+		return nil, errMaintenanceDisabled
+	}
+	fields := maintenanceFields(requester, req)
+	if subtle.ConstantTimeCompare([]byte(token), m.token) != 1 {
+		servoLog.Event(fields, "refused unauthorized maintenance request")
+		return nil, errMaintenanceUnauthorized
+	}
+	if err := m.validate(req); err != nil {
+		return nil, err
+	}
+	r := &maintenanceRequest{
+		MaintenanceRequest: *req,
+		requester:          requester,
+		reply:              make(chan maintenanceReply, 1),
+	}
+	select {
+	case p.maintenanceReqs <- r:
+	case <-ctx.Done():
+		return nil, errMaintenanceNotRunning
+	}
+	select {
+	case reply := <-r.reply:
+		return reply.state, reply.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// maintenanceFields describes maintenance request in a log event
+func maintenanceFields(requester string, req *gmstats.MaintenanceRequest) log.Fields {
+	fields := log.Fields{"event": "maintenance", "action": req.Action, "requester": requester}
+	if req.Action == gmstats.MaintenanceStep || req.Action == gmstats.MaintenanceSlew {
+		fields["amount"] = req.Amount.String()
+	}
+	if req.Action == gmstats.MaintenanceSlew {
+		fields["duration"] = req.Duration.String()
+	}
+	return fields
+}
+
+// handleMaintenance is called from the main loop
+func (p *SPTP) handleMaintenance(req *maintenanceRequest) {
+	m := p.maintenance
+	err := p.applyMaintenance(req)
+	if req.Action != gmstats.MaintenanceStatus {
+		fields := maintenanceFields(req.requester, &req.MaintenanceRequest)
+		if err != nil {
+			fields["error"] = err.Error()
+			servoLog.Event(fields, "maintenance %s failed", req.Action)
+		} else {
+			p.stats.UpdateCounterBy("ptp.sptp.maintenance.actions", 1)
+			servoLog.Event(fields, "maintenance %s done", req.Action)
+		}
+		p.reportMaintenance()
+	}
+	if err != nil {
+		req.reply <- maintenanceReply{err: err}
+		return
+	}
+	req.reply <- maintenanceReply{state: m.state()}
+}
+
+func (p *SPTP) applyMaintenance(req *maintenanceRequest) error {
+	m := p.maintenance
+	switch req.Action {
+	case gmstats.MaintenanceFreeze:
+		m.frozen = true
+		return nil
+	case gmstats.MaintenanceResume:
+		if !m.holds() {
+			return nil
+		}
+		if err := p.stopSlew(); err != nil {
+			return err
+		}
+		m.frozen = false
+		return p.restartServo()
+	case gmstats.MaintenanceStep, gmstats.MaintenanceSlew:
+		if p.drained {
+			return fmt.Errorf("%w: drained, clock belongs to someone else", errMaintenanceConflict)
+		}
+		if m.slewing() {
+			return fmt.Errorf("%w: slew is in progress", errMaintenanceConflict)
+		}
+	}
+	switch req.Action {
+	case gmstats.MaintenanceStep:
+		if err := p.clock.Step(req.Amount); err != nil {
+			return fmt.Errorf("%w: %v", errMaintenanceClock, err)
+		}
+	case gmstats.MaintenanceSlew:
+		return p.startSlew(req.Amount, req.Duration)
+	}
+	return nil
+}
+
+// startSlew corrects the clock by amount over duration by adjusting its frequency. Servo leaves the clock alone until slew is over
+func (p *SPTP) startSlew(amount, duration time.Duration) error {
+	m := p.maintenance
+	base, err := p.clock.FrequencyPPB()
+	if err != nil {
+		return fmt.Errorf("%w: reading frequency: %v", errMaintenanceClock, err)
+	}
+	ppb := float64(amount) / float64(duration) * 1e9
+	maxFreq, err := p.clock.MaxFreqPPB()
+	if err != nil {
+		return fmt.Errorf("%w: reading max frequency: %v", errMaintenanceClock, err)
+	}
+	if math.Abs(base+ppb) > maxFreq {
+		return fmt.Errorf("slewing by %v over %v needs %.0f ppb on top of %.0f ppb, but clock only supports %.0f ppb, slew over longer duration", amount, duration, ppb, base, maxFreq)
+	}
+	if err := p.clock.AdjFreqPPB(base + ppb); err != nil {
+		return fmt.Errorf("%w: %v", errMaintenanceClock, err)
+	}
+	m.slewBase = base
+	m.slewPPB = ppb
+	m.slewEnd = time.Now().Add(duration)
+	m.slewTimer = time.NewTimer(duration)
+	return nil
+}
+
+// stopSlew brings the clock back to the frequency it had before slew started
+func (p *SPTP) stopSlew() error {
+	m := p.maintenance
+	if !m.slewing() {
+		return nil
+	}
+	m.slewTimer.Stop()
+	m.slewTimer = nil
+	if err := p.clock.AdjFreqPPB(m.slewBase); err != nil {
+		return fmt.Errorf("%w: restoring frequency after slew: %v", errMaintenanceClock, err)
+	}
+	return nil
+}
+
+// finishSlew is called from the main loop once slew is over. Servo takes over unless it's frozen
+func (p *SPTP) finishSlew() {
+	fields := log.Fields{"event": "maintenance", "action": "slew_done"}
+	err := p.stopSlew()
+	if err == nil && !p.maintenance.frozen {
+		err = p.restartServo()
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		servoLog.Event(fields, "finishing maintenance slew failed")
+	} else {
+		servoLog.Event(fields, "maintenance slew done")
+	}
+	p.reportMaintenance()
+}
+
+// restartServo starts servo over from current clock frequency, as someone else was in charge of the clock in the meantime
+func (p *SPTP) restartServo() error {
+	if err := p.initServo(); err != nil {
+		return fmt.Errorf("reinitializing servo: %w", err)
+	}
+	p.syncInterval()
+	return nil
+}
+
+func (p *SPTP) reportMaintenance() {
+	var frozen, slewing int64
+	if p.maintenance.frozen {
+		frozen = 1
+	}
+	if p.maintenance.slewing() {
+		slewing = 1
+	}
+	p.stats.SetCounter("ptp.sptp.maintenance.frozen", frozen)
+	p.stats.SetCounter("ptp.sptp.maintenance.slewing", slewing)
+}
@@ -0,0 +1,242 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	gmstats "github.com/facebook/time/ptp/sptp/stats"
+	"github.com/facebook/time/servo"
+)
+
+const testMaintenanceToken = "0123456789abcdef"
+
+func TestMaintenanceConfigValidate(t *testing.T) {
+	require.NoError(t, (&MaintenanceConfig{}).Validate())
+	require.NoError(t, (&MaintenanceConfig{TokenFile: "/etc/sptp.token", MaxStep: time.Second}).Validate())
+	require.EqualError(t, (&MaintenanceConfig{MaxStep: -time.Second}).Validate(), "max_step must be 0 or positive")
+}
+
+func TestReadMaintenanceToken(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	_, err := readMaintenanceToken(file)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(file, []byte("short\n"), 0600))
+	_, err = readMaintenanceToken(file)
+	require.EqualError(t, err, "maintenance token in "+file+" must be at least 16 characters long")
+
+	require.NoError(t, os.WriteFile(file, []byte(testMaintenanceToken+"\n"), 0600))
+	token, err := readMaintenanceToken(file)
+	require.NoError(t, err)
+	require.Equal(t, []byte(testMaintenanceToken), token)
+}
+
+func TestMaintainValidation(t *testing.T) {
+	p := &SPTP{maintenanceReqs: make(chan *maintenanceRequest)}
+	ctx := context.Background()
+	_, err := p.Maintain(ctx, "[::1]:4242", testMaintenanceToken, &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceFreeze})
+	require.ErrorIs(t, err, errMaintenanceDisabled)
+
+	p.maintenance = &maintenance{token: []byte(testMaintenanceToken), maxStep: time.Second}
+	_, err = p.Maintain(ctx, "[::1]:4242", "wrong", &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceFreeze})
+	require.ErrorIs(t, err, errMaintenanceUnauthorized)
+	_, err = p.Maintain(ctx, "[::1]:4242", "", &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceStatus})
+	require.ErrorIs(t, err, errMaintenanceUnauthorized)
+
+	_, err = p.Maintain(ctx, "[::1]:4242", testMaintenanceToken, &gmstats.MaintenanceRequest{Action: "reboot"})
+	require.EqualError(t, err, `unknown maintenance action "reboot"`)
+	_, err = p.Maintain(ctx, "[::1]:4242", testMaintenanceToken, &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceStep})
+	require.EqualError(t, err, "amount to step the clock by must be specified")
+	_, err = p.Maintain(ctx, "[::1]:4242", testMaintenanceToken, &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceStep, Amount: -2 * time.Second})
+	require.EqualError(t, err, "amount -2s exceeds max step 1s")
+	_, err = p.Maintain(ctx, "[::1]:4242", testMaintenanceToken, &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceSlew, Amount: time.Millisecond})
+	require.EqualError(t, err, "duration to slew the clock over must be positive")
+
+	// main loop is not running
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Maintain(ctx, "[::1]:4242", testMaintenanceToken, &gmstats.MaintenanceRequest{Action: gmstats.MaintenanceFreeze})
+	require.ErrorIs(t, err, errMaintenanceNotRunning)
+}
+
+func newMaintenanceTestSPTP(ctrl *gomock.Controller) (*SPTP, *MockClock, *MockStatsServer) {
+	mockClock := NewMockClock(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	cfg := DefaultConfig()
+	p := &SPTP{
+		cfg:         cfg,
+		clock:       mockClock,
+		pi:          NewMockServo(ctrl),
+		stats:       mockStatsServer,
+		maintenance: &maintenance{token: []byte(testMaintenanceToken)},
+	}
+	return p, mockClock, mockStatsServer
+}
+
+// maintain passes request to handleMaintenance, as the main loop does
+func maintain(p *SPTP, action string, amount, duration time.Duration) (*gmstats.MaintenanceState, error) {
+	req := &maintenanceRequest{
+		MaintenanceRequest: gmstats.MaintenanceRequest{Action: action, Amount: amount, Duration: duration},
+		requester:          "[::1]:4242",
+		reply:              make(chan maintenanceReply, 1),
+	}
+	p.handleMaintenance(req)
+	r := <-req.reply
+	return r.state, r.err
+}
+
+func TestHandleMaintenance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p, mockClock, mockStatsServer := newMaintenanceTestSPTP(ctrl)
+	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.maintenance.actions", int64(1)).Times(4)
+
+	s, err := maintain(p, gmstats.MaintenanceStatus, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, &gmstats.MaintenanceState{}, s)
+
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.frozen", int64(1))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.slewing", int64(0))
+	s, err = maintain(p, gmstats.MaintenanceFreeze, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, &gmstats.MaintenanceState{Frozen: true}, s)
+
+	mockClock.EXPECT().Step(-time.Millisecond).Return(nil)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.frozen", int64(1))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.slewing", int64(0))
+	_, err = maintain(p, gmstats.MaintenanceStep, -time.Millisecond, 0)
+	require.NoError(t, err)
+
+	// 1us over 10s is 100ppb on top of current frequency
+	mockClock.EXPECT().FrequencyPPB().Return(20.0, nil)
+	mockClock.EXPECT().MaxFreqPPB().Return(500000.0, nil)
+	mockClock.EXPECT().AdjFreqPPB(120.0).Return(nil)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.frozen", int64(1))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.slewing", int64(1))
+	s, err = maintain(p, gmstats.MaintenanceSlew, time.Microsecond, 10*time.Second)
+	require.NoError(t, err)
+	require.True(t, s.Frozen)
+	require.True(t, s.Slewing)
+	require.Equal(t, 100.0, s.SlewPPB)
+	require.NotNil(t, p.maintenance.slewDone())
+
+	// one thing at a time
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.frozen", int64(1))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.slewing", int64(1))
+	_, err = maintain(p, gmstats.MaintenanceStep, time.Millisecond, 0)
+	require.ErrorIs(t, err, errMaintenanceConflict)
+
+	// resume aborts slew, and servo starts over from frequency clock had before slew
+	mockClock.EXPECT().AdjFreqPPB(20.0).Return(nil)
+	mockClock.EXPECT().FrequencyPPB().Return(20.0, nil)
+	mockClock.EXPECT().MaxFreqPPB().Return(500000.0, nil)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.frozen", int64(0))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.slewing", int64(0))
+	s, err = maintain(p, gmstats.MaintenanceResume, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, &gmstats.MaintenanceState{}, s)
+	require.Nil(t, p.maintenance.slewDone())
+
+	// clock is not ours while drained
+	p.drained = true
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.frozen", int64(0))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.slewing", int64(0))
+	_, err = maintain(p, gmstats.MaintenanceStep, time.Millisecond, 0)
+	require.ErrorIs(t, err, errMaintenanceConflict)
+}
+
+func TestHandleMaintenanceSlewTooFast(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p, mockClock, mockStatsServer := newMaintenanceTestSPTP(ctrl)
+
+	mockClock.EXPECT().FrequencyPPB().Return(20.0, nil)
+	mockClock.EXPECT().MaxFreqPPB().Return(500000.0, nil)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.frozen", int64(0))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.maintenance.slewing", int64(0))
+	_, err := maintain(p, gmstats.MaintenanceSlew, time.Second, time.Second)
+	require.EqualError(t, err, "slewing by 1s over 1s needs 1000000000 ppb on top of 20 ppb, but clock only supports 500000 ppb, slew over longer duration")
+	require.False(t, p.maintenance.slewing())
+}
+
+func TestFinishSlew(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p, mockClock, mockStatsServer := newMaintenanceTestSPTP(ctrl)
+	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.maintenance.actions", int64(1))
+	mockStatsServer.EXPECT().SetCounter(gomock.Any(), gomock.Any()).AnyTimes()
+
+	mockClock.EXPECT().FrequencyPPB().Return(20.0, nil)
+	mockClock.EXPECT().MaxFreqPPB().Return(500000.0, nil)
+	mockClock.EXPECT().AdjFreqPPB(-99980.0).Return(nil)
+	_, err := maintain(p, gmstats.MaintenanceSlew, -time.Microsecond, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	<-p.maintenance.slewDone()
+	mockClock.EXPECT().AdjFreqPPB(20.0).Return(nil)
+	mockClock.EXPECT().FrequencyPPB().Return(20.0, nil)
+	mockClock.EXPECT().MaxFreqPPB().Return(500000.0, nil)
+	p.finishSlew()
+	require.False(t, p.maintenance.holds())
+}
+
+func TestProcessResultsManualControl(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p, mockClock, mockStatsServer := newMaintenanceTestSPTP(ctrl)
+	mockServo := p.pi.(*MockServo)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1)).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100)).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).AnyTimes()
+	p.cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -100 * time.Microsecond,
+				Timestamp: ts,
+			},
+		},
+	}
+	require.NoError(t, p.initClients())
+
+	// frozen, clock and servo are left alone
+	p.maintenance.frozen = true
+	p.processResults(results)
+	require.Equal(t, "192.168.0.10", p.bestGM)
+
+	p.maintenance.frozen = false
+	mockServo.EXPECT().Sample(int64(-100*time.Microsecond), gomock.Any()).Return(12.3, servo.StateLocked)
+	mockClock.EXPECT().AdjFreqPPB(-12.3).Return(nil)
+	p.processResults(results)
+}
@@ -0,0 +1,251 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/facebook/time/servo"
+)
+
+// MeasurementLogConfig describes configuration for structured log of every sync exchange
+type MeasurementLogConfig struct {
+	Path       string `yaml:"path"`        // where to write the log, disabled if empty
+	MaxSize    int64  `yaml:"max_size"`    // rotate the log once it reaches this many bytes, never rotate if 0
+	MaxBackups int    `yaml:"max_backups"` // how many rotated logs to keep
+}
+
+// Validate MeasurementLogConfig is sane
+func (c *MeasurementLogConfig) Validate() error {
+	if c.MaxSize < 0 {
+		return fmt.Errorf("max_size must be 0 or positive")
+	}
+	if c.MaxBackups < 0 {
+		return fmt.Errorf("max_backups must be 0 or positive")
+	}
+	return nil
+}
+
+// MeasurementLogEntry is a single line of measurement log, describing one exchange with one GM
+type MeasurementLogEntry struct {
+	Tick              time.Time `json:"tick"`
+	GM                string    `json:"gm"`
+	GMIdentity        string    `json:"gm_identity,omitempty"`
+	Selected          bool      `json:"selected"`
+	Error             string    `json:"error,omitempty"`
+	T1                int64     `json:"t1,omitempty"`
+	T2                int64     `json:"t2,omitempty"`
+	T3                int64     `json:"t3,omitempty"`
+	T4                int64     `json:"t4,omitempty"`
+	T3Fallback        bool      `json:"t3_fallback,omitempty"` // T3 is userspace send time
+	CorrectionFieldRX int64     `json:"cf_rx"`
+	CorrectionFieldTX int64     `json:"cf_tx"`
+	Offset            int64     `json:"offset"`
+	Delay             int64     `json:"delay"`
+	// servo output is only present for selected GM
+	ServoFreq  *float64 `json:"servo_freq,omitempty"`
+	ServoState string   `json:"servo_state,omitempty"`
+}
+
+func unixNanoOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// newMeasurementLogEntry converts RunResult to MeasurementLogEntry
+func newMeasurementLogEntry(tick time.Time, addr string, r *RunResult) *MeasurementLogEntry {
+	e := &MeasurementLogEntry{
+		Tick: tick,
+		GM:   addr,
+	}
+	if r.Error != nil {
+		e.Error = r.Error.Error()
+		return e
+	}
+	m := r.Measurement
+	if m == nil {
+		e.Error = "Measurement is missing on RunResult"
+		return e
+	}
+	e.GMIdentity = m.Announce.GrandmasterIdentity.String()
+	e.T1 = unixNanoOrZero(m.T1)
+	e.T2 = unixNanoOrZero(m.T2)
+	e.T3 = unixNanoOrZero(m.T3)
+	e.T4 = unixNanoOrZero(m.T4)
+	e.T3Fallback = m.T3Fallback
+	e.CorrectionFieldRX = m.CorrectionFieldRX.Nanoseconds()
+	e.CorrectionFieldTX = m.CorrectionFieldTX.Nanoseconds()
+	e.Offset = m.Offset.Nanoseconds()
+	e.Delay = m.Delay.Nanoseconds()
+	return e
+}
+
+// setServo records servo output on the entry
+func (e *MeasurementLogEntry) setServo(freq float64, state servo.State) {
+	e.ServoFreq = &freq
+	e.ServoState = state.String()
+}
+
+// measurementLog writes MeasurementLogEntry as JSON lines to the rotating file
+type measurementLog struct {
+	sync.Mutex
+
+	cfg  *MeasurementLogConfig
+	f    *os.File
+	size int64
+}
+
+// newMeasurementLog opens measurement log file for appending
+func newMeasurementLog(cfg *MeasurementLogConfig) (*measurementLog, error) {
+	l := &measurementLog{cfg: cfg}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *measurementLog) open() error {
+	f, err := os.OpenFile(l.cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("opening measurement log: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("getting measurement log size: %w", err)
+	}
+	l.f = f
+	l.size = st.Size()
+	return nil
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// rotate shifts path.N-1 to path.N, ..., path to path.1 and reopens the log
+func (l *measurementLog) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	if l.cfg.MaxBackups == 0 {
+		if err := os.Remove(l.cfg.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return l.open()
+	}
+	for i := l.cfg.MaxBackups - 1; i > 0; i-- {
+		if err := os.Rename(backupName(l.cfg.Path, i), backupName(l.cfg.Path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(l.cfg.Path, backupName(l.cfg.Path, 1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return l.open()
+}
+
+// Write writes entries to the log, one line per entry
+func (l *measurementLog) Write(entries []*MeasurementLogEntry) error {
+	l.Lock()
+	defer l.Unlock()
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		b = append(b, '\n')
+		if l.cfg.MaxSize > 0 && l.size > 0 && l.size+int64(len(b)) > l.cfg.MaxSize {
+			if err := l.rotate(); err != nil {
+				return fmt.Errorf("rotating measurement log: %w", err)
+			}
+		}
+		n, err := l.f.Write(b)
+		l.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes underlying file
+func (l *measurementLog) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	return l.f.Close()
+}
+
+// ReadMeasurementLog parses measurement log written by SPTP
+func ReadMeasurementLog(r io.Reader) ([]*MeasurementLogEntry, error) {
+	entries := []*MeasurementLogEntry{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := &MeasurementLogEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("parsing line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// MeasurementLogTrace reconstructs offsets of the free-running clock from exchanges with selected GM,
+// taking out the steps and frequency adjustments SPTP made based on recorded servo output
+func MeasurementLogTrace(entries []*MeasurementLogEntry) []servo.SimSample {
+	trace := []servo.SimSample{}
+	// phase correction and frequency SPTP applied to the clock, relative to the frequency clock had when servo started
+	var correction, freq, initial float64
+	var last time.Time
+	for _, e := range entries {
+		if !e.Selected || e.Error != "" || e.ServoFreq == nil {
+			continue
+		}
+		if last.IsZero() {
+			// servo starts from current clock frequency
+			initial = *e.ServoFreq
+		} else {
+			correction += freq * float64(e.Tick.Sub(last)) / 1e9
+		}
+		last = e.Tick
+		trace = append(trace, servo.SimSample{Timestamp: e.Tick, Offset: e.Offset - int64(correction)})
+		switch e.ServoState {
+		case servo.StateJump.String():
+			correction -= float64(e.Offset)
+		case servo.StateLocked.String():
+			freq = initial - *e.ServoFreq
+		}
+	}
+	return trace
+}
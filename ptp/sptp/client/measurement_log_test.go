@@ -0,0 +1,209 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/servo"
+)
+
+func readMeasurementLog(t *testing.T, path string) []*MeasurementLogEntry {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	entries, err := ReadMeasurementLog(f)
+	require.NoError(t, err)
+	return entries
+}
+
+func TestMeasurementLogConfigValidate(t *testing.T) {
+	cfg := MeasurementLogConfig{}
+	require.NoError(t, cfg.Validate())
+	cfg.MaxSize = -1
+	require.Error(t, cfg.Validate())
+	cfg.MaxSize = 100
+	cfg.MaxBackups = -1
+	require.Error(t, cfg.Validate())
+}
+
+func TestNewMeasurementLogEntry(t *testing.T) {
+	tick := time.Unix(1678000000, 0)
+	e := newMeasurementLogEntry(tick, "192.168.0.10", &RunResult{Error: fmt.Errorf("oops")})
+	require.Equal(t, &MeasurementLogEntry{Tick: tick, GM: "192.168.0.10", Error: "oops"}, e)
+
+	e = newMeasurementLogEntry(tick, "192.168.0.10", &RunResult{})
+	require.Equal(t, &MeasurementLogEntry{Tick: tick, GM: "192.168.0.10", Error: "Measurement is missing on RunResult"}, e)
+
+	m := &MeasurementResult{
+		Delay:             time.Microsecond,
+		Offset:            -time.Millisecond,
+		CorrectionFieldRX: 10,
+		CorrectionFieldTX: 20,
+		T1:                time.Unix(0, 1),
+		T2:                time.Unix(0, 2),
+		T3:                time.Unix(0, 3),
+		T4:                time.Unix(0, 4),
+	}
+	m.Announce.GrandmasterIdentity = ptp.ClockIdentity(0x42)
+	e = newMeasurementLogEntry(tick, "192.168.0.10", &RunResult{Measurement: m})
+	e.setServo(12.3, servo.StateLocked)
+	freq := 12.3
+	want := &MeasurementLogEntry{
+		Tick:              tick,
+		GM:                "192.168.0.10",
+		GMIdentity:        "000000.0000.000042",
+		T1:                1,
+		T2:                2,
+		T3:                3,
+		T4:                4,
+		CorrectionFieldRX: 10,
+		CorrectionFieldTX: 20,
+		Offset:            -1000000,
+		Delay:             1000,
+		ServoFreq:         &freq,
+		ServoState:        "LOCKED",
+	}
+	require.Equal(t, want, e)
+}
+
+func TestMeasurementLogRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "measurements.log")
+	l, err := newMeasurementLog(&MeasurementLogConfig{Path: path, MaxSize: 100, MaxBackups: 2})
+	require.NoError(t, err)
+	defer l.Close()
+	for i := 0; i < 4; i++ {
+		err = l.Write([]*MeasurementLogEntry{{GM: fmt.Sprintf("gm%d", i), Tick: time.Unix(0, 0).UTC()}})
+		require.NoError(t, err)
+	}
+	// each entry is more than half of max size, so we expect every entry in it's own file
+	require.Equal(t, "gm3", readMeasurementLog(t, path)[0].GM)
+	require.Equal(t, "gm2", readMeasurementLog(t, backupName(path, 1))[0].GM)
+	require.Equal(t, "gm1", readMeasurementLog(t, backupName(path, 2))[0].GM)
+	_, err = os.Stat(backupName(path, 3))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestReadMeasurementLog(t *testing.T) {
+	in := `{"tick":"2023-03-05T07:06:40Z","gm":"gm1","selected":true,"cf_rx":0,"cf_tx":0,"offset":-10,"delay":100,"servo_freq":1.5,"servo_state":"LOCKED"}
+
+{"tick":"2023-03-05T07:06:41Z","gm":"gm2","selected":false,"error":"timeout","cf_rx":0,"cf_tx":0,"offset":0,"delay":0}
+`
+	entries, err := ReadMeasurementLog(strings.NewReader(in))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "gm1", entries[0].GM)
+	require.Equal(t, 1.5, *entries[0].ServoFreq)
+	require.Equal(t, "timeout", entries[1].Error)
+
+	_, err = ReadMeasurementLog(strings.NewReader("{}\nnope\n"))
+	require.EqualError(t, err, "parsing line 2: invalid character 'o' in literal null (expecting 'u')")
+}
+
+func TestMeasurementLogTrace(t *testing.T) {
+	start := time.Unix(1678000000, 0)
+	freq := func(f float64) *float64 { return &f }
+	entries := []*MeasurementLogEntry{
+		{Tick: start, GM: "gm1", Selected: true, Offset: 1000, ServoFreq: freq(-50), ServoState: "INIT"},
+		// not selected, ignored
+		{Tick: start, GM: "gm2", Offset: 5000},
+		{Tick: start.Add(time.Second), GM: "gm1", Selected: true, Offset: 1100, ServoFreq: freq(-50), ServoState: "JUMP"},
+		// clock was stepped by -1100
+		{Tick: start.Add(2 * time.Second), GM: "gm1", Selected: true, Offset: 100, ServoFreq: freq(50), ServoState: "LOCKED"},
+		// clock frequency was adjusted by -100 ppb
+		{Tick: start.Add(3 * time.Second), GM: "gm1", Selected: true, Error: "timeout"},
+		{Tick: start.Add(4 * time.Second), GM: "gm1", Selected: true, Offset: -100, ServoFreq: freq(50), ServoState: "LOCKED"},
+	}
+	want := []servo.SimSample{
+		{Timestamp: start, Offset: 1000},
+		{Timestamp: start.Add(time.Second), Offset: 1100},
+		{Timestamp: start.Add(2 * time.Second), Offset: 1200},
+		{Timestamp: start.Add(4 * time.Second), Offset: 1200},
+	}
+	require.Equal(t, want, MeasurementLogTrace(entries))
+}
+
+func TestProcessResultsMeasurementLog(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockClock.EXPECT().Step(gomock.Any()).Return(nil)
+	mockServo := NewMockServo(ctrl)
+	mockServo.EXPECT().Sample(int64(-200002000), gomock.Any()).Return(12.3, servo.StateJump)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter(gomock.Any(), gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).Times(2)
+
+	path := filepath.Join(t.TempDir(), "measurements.log")
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+		"192.168.0.11": 2,
+	}
+	cfg.MeasurementLog.Path = path
+	mlog, err := newMeasurementLog(&cfg.MeasurementLog)
+	require.NoError(t, err)
+	defer mlog.Close()
+	p := &SPTP{
+		clock: mockClock,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		cfg:   cfg,
+		mlog:  mlog,
+	}
+	err = p.initClients()
+	require.NoError(t, err)
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -200002 * time.Microsecond,
+				Timestamp: ts,
+				T2:        ts,
+			},
+		},
+		"192.168.0.11": {
+			Server: "192.168.0.11",
+			Error:  fmt.Errorf("context deadline exceeded"),
+		},
+	}
+	p.processResults(results)
+	entries := readMeasurementLog(t, path)
+	require.Len(t, entries, 2)
+	require.Equal(t, "192.168.0.10", entries[0].GM)
+	require.True(t, entries[0].Selected)
+	require.Equal(t, ts.UnixNano(), entries[0].T2)
+	require.Equal(t, int64(-200002000), entries[0].Offset)
+	require.Equal(t, "JUMP", entries[0].ServoState)
+	require.Equal(t, 12.3, *entries[0].ServoFreq)
+	require.Equal(t, "192.168.0.11", entries[1].GM)
+	require.False(t, entries[1].Selected)
+	require.Equal(t, "context deadline exceeded", entries[1].Error)
+	require.Nil(t, entries[1].ServoFreq)
+}
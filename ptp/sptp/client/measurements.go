@@ -22,8 +22,6 @@ import (
 	"sync"
 	"time"
 
-	log "github.com/sirupsen/logrus"
-
 	ptp "github.com/facebook/time/ptp/protocol"
 )
 
@@ -44,7 +42,9 @@ type mData struct {
 	t3  time.Time     // departure time of DelayReq from OC
 	t4  time.Time     // arrival time of DelayReq packet on GM
 	c2  time.Duration // // correctionFiled of DelayReq
-	c1  time.Duration // correctionField of Sync
+	c1  time.Duration // correctionField of Sync, plus correctionField of FollowUp in two-step mode
+	// t3 is userspace send time, as TX timestamp wasn't available
+	t3Fallback bool
 }
 
 func (d *mData) Complete() bool {
@@ -65,6 +65,8 @@ type MeasurementResult struct {
 	T2                 time.Time
 	T3                 time.Time
 	T4                 time.Time
+	// T3 is userspace send time instead of TX timestamp
+	T3Fallback bool
 }
 
 // measurements abstracts away tracking and calculation of various packet timestamps
@@ -76,6 +78,8 @@ type measurements struct {
 	data             map[uint16]*mData
 	announce         ptp.Announce
 	delaysWindow     *slidingWindow
+	// latency of the NIC, to move timestamps to the wire
+	latency NICLatency
 }
 
 func (m *measurements) addAnnounce(announce ptp.Announce) {
@@ -106,6 +110,21 @@ func (m *measurements) addT1(seq uint16, ts time.Time) {
 		m.data[seq] = &mData{seq: seq, t1: ts}
 	}
 }
+
+// addSyncOrigin stores T1, T2 and correctionField of Sync, together with FollowUp if master is two-step
+func (m *measurements) addSyncOrigin(o *ptp.SyncOrigin) {
+	m.Lock()
+	defer m.Unlock()
+	v, found := m.data[o.SequenceID]
+	if !found {
+		v = &mData{seq: o.SequenceID}
+		m.data[o.SequenceID] = v
+	}
+	v.t1 = o.T1
+	v.t2 = o.T2
+	v.c1 = o.Correction
+}
+
 func (m *measurements) addCF2(seq uint16, correction time.Duration) {
 	m.Lock()
 	defer m.Unlock()
@@ -128,6 +147,19 @@ func (m *measurements) addT3(seq uint16, ts time.Time) {
 	}
 }
 
+// addT3Fallback records userspace send time as t3, when TX timestamp is not available
+func (m *measurements) addT3Fallback(seq uint16, ts time.Time) {
+	m.Lock()
+	defer m.Unlock()
+	v, found := m.data[seq]
+	if found {
+		v.t3 = ts
+		v.t3Fallback = true
+	} else {
+		m.data[seq] = &mData{seq: seq, t3: ts, t3Fallback: true}
+	}
+}
+
 // addDelayResp stores ts and seq of DELAY_RESP packet and updates history with latest measurements
 func (m *measurements) addT4(seq uint16, ts time.Time) {
 	m.Lock()
@@ -144,7 +176,7 @@ func (m *measurements) delay(newDelay time.Duration) time.Duration {
 	lastDelay := m.delaysWindow.lastSample()
 	// we want to have at least one sample recorded, even if it doesn't meet the filter, otherwise we'll never sync
 	if !math.IsNaN(lastDelay) && (m.cfg.PathDelayDiscardFilterEnabled && m.delaysWindow.Full() && newDelay < m.cfg.PathDelayDiscardBelow) {
-		log.Warningf("(%s) bad path delay %v < %v filtered out", m.announce.GrandmasterIdentity, newDelay, m.cfg.PathDelayDiscardBelow)
+		servoLog.Warningf("(%s) bad path delay %v < %v filtered out", m.announce.GrandmasterIdentity, newDelay, m.cfg.PathDelayDiscardBelow)
 	} else {
 		m.delaysWindow.add(float64(newDelay))
 	}
@@ -176,10 +208,52 @@ func (m *measurements) latest() (*MeasurementResult, error) {
 	if lastData == nil {
 		return nil, errNotEnoughData
 	}
+	return m.result(lastData), nil
+}
+
+// latestCombined is used when Sync and DelayReq sequences are independent (unicast negotiation),
+// so we take last sample where we have t1 and t2 and last sample where we have t3 and t4
+func (m *measurements) latestCombined() (*MeasurementResult, error) {
+	m.Lock()
+	defer m.Unlock()
+	var lastSync, lastDelay *mData
+	for _, v := range m.data {
+		if !v.t1.IsZero() && !v.t2.IsZero() && (lastSync == nil || v.t2.After(lastSync.t2)) {
+			lastSync = v
+		}
+		if !v.t3.IsZero() && !v.t4.IsZero() && (lastDelay == nil || v.t3.After(lastDelay.t3)) {
+			lastDelay = v
+		}
+	}
+	if lastSync == nil || lastDelay == nil {
+		return nil, errNotEnoughData
+	}
+	return m.result(&mData{
+		seq: lastDelay.seq,
+		t1:  lastSync.t1,
+		t2:  lastSync.t2,
+		t3:  lastDelay.t3,
+		t4:  lastDelay.t4,
+		c1:  lastSync.c1,
+		c2:  lastDelay.c2,
+
+		t3Fallback: lastDelay.t3Fallback,
+	}), nil
+}
+
+// result calculates MeasurementResult from complete mData
+func (m *measurements) result(lastData *mData) *MeasurementResult {
+	c1 := lastData.c1
+	// Sync hit the wire before it was timestamped, and DelayReq after
+	t2 := lastData.t2.Add(-m.latency.Ingress)
+	t3 := lastData.t3
+	if !lastData.t3Fallback {
+		t3 = t3.Add(m.latency.Egress)
+	}
 	// offset = ((t2 − t1 − c1) − (t4 − t3 − c2))/2
 	// delay = ((t2 − t1 − c1) + (t4 − t3 − c2))/2
-	clientToServerDiff := lastData.t4.Sub(lastData.t3) - lastData.c2
-	serverToClientDiff := lastData.t2.Sub(lastData.t1) - lastData.c1
+	clientToServerDiff := lastData.t4.Sub(t3) - lastData.c2
+	serverToClientDiff := t2.Sub(lastData.t1) - c1
 	newDelay := (clientToServerDiff + serverToClientDiff) / 2
 	delay := m.delay(newDelay)
 	offset := serverToClientDiff - delay
@@ -190,15 +264,16 @@ func (m *measurements) latest() (*MeasurementResult, error) {
 		Offset:             offset,
 		ServerToClientDiff: serverToClientDiff,
 		ClientToServerDiff: clientToServerDiff,
-		CorrectionFieldRX:  lastData.c1,
+		CorrectionFieldRX:  c1,
 		CorrectionFieldTX:  lastData.c2,
-		Timestamp:          lastData.t2,
+		Timestamp:          t2,
 		T1:                 lastData.t1,
-		T2:                 lastData.t2,
-		T3:                 lastData.t3,
+		T2:                 t2,
+		T3:                 t3,
 		T4:                 lastData.t4,
+		T3Fallback:         lastData.t3Fallback,
 		Announce:           m.announce,
-	}, nil
+	}
 }
 
 func (m *measurements) cleanup() {
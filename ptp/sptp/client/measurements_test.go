@@ -20,6 +20,7 @@ import (
 	"testing"
 	"time"
 
+	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -337,6 +338,82 @@ func TestMeasurementsPathDelayFilter(t *testing.T) {
 	assert.Equal(t, want, got, "measurements with mean path delay filter and skipped path delay sample")
 }
 
+func TestMeasurementsT3Fallback(t *testing.T) {
+	mcfg := &MeasurementConfig{}
+	m := newMeasurements(mcfg)
+	var seq uint16 = 1
+	timeDelaySent, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	m.addT3Fallback(seq, timeDelaySent)
+	m.addT4(seq, timeDelaySent.Add(100*time.Millisecond))
+	m.addT1(seq, timeDelaySent.Add(110*time.Millisecond))
+	m.addT2andCF1(seq, timeDelaySent.Add(210*time.Millisecond), 0)
+	m.addCF2(seq, 0)
+
+	got, err := m.latest()
+	require.NoError(t, err)
+	require.Equal(t, timeDelaySent, got.T3)
+	require.True(t, got.T3Fallback)
+
+	got, err = m.latestCombined()
+	require.NoError(t, err)
+	require.True(t, got.T3Fallback)
+}
+
+func TestMeasurementsSyncOrigin(t *testing.T) {
+	mcfg := &MeasurementConfig{}
+	m := newMeasurements(mcfg)
+	var seq uint16 = 1
+	timeDelaySent, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	m.addT3(seq, timeDelaySent)
+	m.addT4(seq, timeDelaySent.Add(100*time.Millisecond))
+	m.addCF2(seq, 0)
+	m.addSyncOrigin(&ptp.SyncOrigin{
+		SequenceID: seq,
+		T1:         timeDelaySent.Add(110 * time.Millisecond),
+		T2:         timeDelaySent.Add(210 * time.Millisecond),
+		Correction: 2 * time.Millisecond,
+		TwoStep:    true,
+	})
+
+	got, err := m.latest()
+	require.NoError(t, err)
+	require.Equal(t, timeDelaySent.Add(110*time.Millisecond), got.T1)
+	require.Equal(t, 2*time.Millisecond, got.CorrectionFieldRX)
+	require.Equal(t, 98*time.Millisecond, got.ServerToClientDiff)
+}
+
+func TestMeasurementsNICLatency(t *testing.T) {
+	mcfg := &MeasurementConfig{}
+	m := newMeasurements(mcfg)
+	m.latency = NICLatency{Ingress: 400 * time.Nanosecond, Egress: 200 * time.Nanosecond}
+	var seq uint16 = 1
+	timeDelaySent, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	m.addT3(seq, timeDelaySent)
+	m.addT4(seq, timeDelaySent.Add(100*time.Millisecond))
+	m.addT1(seq, timeDelaySent.Add(110*time.Millisecond))
+	m.addT2andCF1(seq, timeDelaySent.Add(210*time.Millisecond), 0)
+	m.addCF2(seq, 0)
+
+	got, err := m.latest()
+	require.NoError(t, err)
+	require.Equal(t, timeDelaySent.Add(200*time.Nanosecond), got.T3)
+	require.Equal(t, timeDelaySent.Add(210*time.Millisecond-400*time.Nanosecond), got.T2)
+	require.Equal(t, got.T2, got.Timestamp)
+	require.Equal(t, 100*time.Millisecond-200*time.Nanosecond, got.ClientToServerDiff)
+	require.Equal(t, 100*time.Millisecond-400*time.Nanosecond, got.ServerToClientDiff)
+	require.Equal(t, 100*time.Millisecond-300*time.Nanosecond, got.Delay)
+	require.Equal(t, -100*time.Nanosecond, got.Offset)
+
+	// userspace send time is not a NIC timestamp
+	m.addT3Fallback(seq, timeDelaySent)
+	got, err = m.latest()
+	require.NoError(t, err)
+	require.Equal(t, timeDelaySent, got.T3)
+}
+
 func TestMeasurementsCleanup(t *testing.T) {
 	mcfg := &MeasurementConfig{}
 	m := newMeasurements(mcfg)
@@ -0,0 +1,64 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// PTP primary multicast groups (IEEE 1588-2019 Annex C and D)
+var (
+	multicastGroupIPv4 = net.ParseIP("224.0.1.129")
+	multicastGroupIPv6 = net.ParseIP("ff0e::181")
+)
+
+// multicastFamilies reports which address families hybrid servers use
+func (c *Config) multicastFamilies() (v4 bool, v6 bool) {
+	for server := range c.Servers {
+		if c.Transport(server) != TransportHybrid {
+			continue
+		}
+		if ip := net.ParseIP(server); ip.To4() != nil {
+			v4 = true
+		} else {
+			v6 = true
+		}
+	}
+	return v4, v6
+}
+
+// joinMulticast joins PTP primary multicast groups on the interface, so dual stack socket receives messages servers multicast
+func joinMulticast(connFd int, iface *net.Interface, v4, v6 bool) error {
+	if v4 {
+		mreq := &unix.IPMreqn{Ifindex: int32(iface.Index)}
+		copy(mreq.Multiaddr[:], multicastGroupIPv4.To4())
+		if err := unix.SetsockoptIPMreqn(connFd, unix.IPPROTO_IP, unix.IP_ADD_MEMBERSHIP, mreq); err != nil {
+			return fmt.Errorf("joining multicast group %s on %s: %w", multicastGroupIPv4, iface.Name, err)
+		}
+	}
+	if v6 {
+		mreq := &unix.IPv6Mreq{Interface: uint32(iface.Index)}
+		copy(mreq.Multiaddr[:], multicastGroupIPv6.To16())
+		if err := unix.SetsockoptIPv6Mreq(connFd, unix.IPPROTO_IPV6, unix.IPV6_JOIN_GROUP, mreq); err != nil {
+			return fmt.Errorf("joining multicast group %s on %s: %w", multicastGroupIPv6, iface.Name, err)
+		}
+	}
+	return nil
+}
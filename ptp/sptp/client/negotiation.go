@@ -0,0 +1,250 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/sptp/stats"
+)
+
+var errNoGrant = errors.New("no unicast grant")
+
+// messages we need grants for in order to run the exchange
+var negotiatedMessages = []ptp.MessageType{ptp.MessageAnnounce, ptp.MessageSync, ptp.MessageDelayResp}
+
+// UnicastNegotiationConfig describes configuration of standard unicast negotiation (IEEE 1588-2019 16.1),
+// which is required by servers that refuse DelayReq without a grant
+type UnicastNegotiationConfig struct {
+	Enabled        bool          `yaml:"enabled"`         // negotiate grants instead of relying on SPTP server behaviour
+	Duration       time.Duration `yaml:"duration"`        // duration of grants we request
+	RenewBefore    time.Duration `yaml:"renew_before"`    // request grant renewal this long before it expires
+	RequestTimeout time.Duration `yaml:"request_timeout"` // resend grant request if we got no response in this time
+}
+
+// Validate UnicastNegotiationConfig is sane
+func (c *UnicastNegotiationConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Duration < time.Second {
+		return fmt.Errorf("duration must be at least 1s")
+	}
+	if c.RenewBefore <= 0 || c.RenewBefore >= c.Duration {
+		return fmt.Errorf("renew_before must be greater than zero but less than duration")
+	}
+	if c.RequestTimeout <= 0 {
+		return fmt.Errorf("request_timeout must be greater than zero")
+	}
+	return nil
+}
+
+// grant tracks state of unicast transmission grant for single message type
+type grant struct {
+	expires   time.Time
+	requested time.Time
+}
+
+// unicastNegotiation keeps track of grants we have from the server
+type unicastNegotiation struct {
+	sync.Mutex
+
+	cfg      *UnicastNegotiationConfig
+	interval ptp.LogInterval
+	grants   map[ptp.MessageType]*grant
+}
+
+func newUnicastNegotiation(cfg *UnicastNegotiationConfig, interval time.Duration) (*unicastNegotiation, error) {
+	li, err := ptp.NewLogInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	n := &unicastNegotiation{
+		cfg:      cfg,
+		interval: li,
+		grants:   map[ptp.MessageType]*grant{},
+	}
+	for _, msgType := range negotiatedMessages {
+		n.grants[msgType] = &grant{}
+	}
+	return n, nil
+}
+
+// granted reports if we have valid grant for msgType
+func (n *unicastNegotiation) granted(msgType ptp.MessageType, now time.Time) bool {
+	n.Lock()
+	defer n.Unlock()
+	g, found := n.grants[msgType]
+	return found && now.Before(g.expires)
+}
+
+// toRequest returns message types we need to request (or renew) grants for, and marks them as requested
+func (n *unicastNegotiation) toRequest(now time.Time) []ptp.MessageType {
+	n.Lock()
+	defer n.Unlock()
+	res := []ptp.MessageType{}
+	for _, msgType := range negotiatedMessages {
+		g := n.grants[msgType]
+		if now.Before(g.expires.Add(-n.cfg.RenewBefore)) {
+			continue
+		}
+		if now.Before(g.requested.Add(n.cfg.RequestTimeout)) {
+			continue
+		}
+		g.requested = now
+		res = append(res, msgType)
+	}
+	return res
+}
+
+// setGrant records the GRANT_UNICAST_TRANSMISSION. Zero duration means server denied the request.
+func (n *unicastNegotiation) setGrant(msgType ptp.MessageType, duration time.Duration, now time.Time) error {
+	n.Lock()
+	defer n.Unlock()
+	g, found := n.grants[msgType]
+	if !found {
+		return fmt.Errorf("got unexpected grant for %s", msgType)
+	}
+	g.requested = time.Time{}
+	if duration == 0 {
+		g.expires = time.Time{}
+		return fmt.Errorf("server denied us grant for %s", msgType)
+	}
+	g.expires = now.Add(duration)
+	return nil
+}
+
+// cancel drops the grant for msgType
+func (n *unicastNegotiation) cancel(msgType ptp.MessageType) {
+	n.Lock()
+	defer n.Unlock()
+	if g, found := n.grants[msgType]; found {
+		g.expires = time.Time{}
+		g.requested = time.Time{}
+	}
+}
+
+// reqUnicast is a helper to build ptp.Signaling with REQUEST_UNICAST_TRANSMISSION TLV
+func reqUnicast(clockID ptp.ClockIdentity, domain uint8, duration time.Duration, interval ptp.LogInterval, what ptp.MessageType) (*ptp.Signaling, error) {
+	source := ptp.PortIdentity{PortNumber: 1, ClockIdentity: clockID}
+	// SequenceID will be populated on sending
+	return ptp.NewSignalingBuilder(source, ptp.DefaultTargetPortIdentity, domain).RequestUnicast(what, interval, duration).Build()
+}
+
+// reqAckCancelUnicast is a helper to build ptp.Signaling with ACKNOWLEDGE_CANCEL_UNICAST_TRANSMISSION TLV
+func reqAckCancelUnicast(clockID ptp.ClockIdentity, domain uint8, what ptp.MessageType) (*ptp.Signaling, error) {
+	source := ptp.PortIdentity{PortNumber: 1, ClockIdentity: clockID}
+	return ptp.NewSignalingBuilder(source, ptp.DefaultTargetPortIdentity, domain).AcknowledgeCancelUnicast(what).Build()
+}
+
+// enableNegotiation switches client to standard unicast negotiation mode, sending general messages to genPort of the server
+func (c *Client) enableNegotiation(genConn UDPConn, genPort int, cfg *UnicastNegotiationConfig, interval time.Duration) error {
+	n, err := newUnicastNegotiation(cfg, interval)
+	if err != nil {
+		return err
+	}
+	// there are no ports in L2 transport, all messages go to the same address
+	if _, ok := c.eventAddr.(*L2Addr); ok {
+		c.genConn = c.eventConn
+		c.genAddr = c.eventAddr
+		c.negotiation = n
+		return nil
+	}
+	genAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(c.server, fmt.Sprintf("%d", genPort)))
+	if err != nil {
+		return err
+	}
+	c.genConn = genConn
+	c.genAddr = genAddr
+	c.negotiation = n
+	return nil
+}
+
+func (c *Client) sendGeneralMsg(p ptp.Packet) (uint16, error) {
+	seq := c.genSequence
+	p.SetSequence(c.genSequence)
+	b, err := c.bytes(p)
+	if err != nil {
+		return 0, err
+	}
+	_, err = c.genConn.WriteTo(b, c.genAddr)
+	c.genSequence++
+	if err != nil {
+		return 0, err
+	}
+	protocolLog.Debugf("sent general packet to %v", c.genAddr)
+	return seq, nil
+}
+
+// requestGrants sends REQUEST_UNICAST_TRANSMISSION for all grants that are missing or about to expire
+func (c *Client) requestGrants(now time.Time) error {
+	for _, msgType := range c.negotiation.toRequest(now) {
+		req, err := reqUnicast(c.clockID, c.domain, c.negotiation.cfg.Duration, c.negotiation.interval, msgType)
+		if err != nil {
+			return err
+		}
+		seq, err := c.sendGeneralMsg(req)
+		if err != nil {
+			return fmt.Errorf("requesting unicast grant for %s: %w", msgType, err)
+		}
+		c.logSent(ptp.MessageSignaling, "request unicast grant for %s, seq=%d", msgType, seq)
+		c.stats.UpdateCounterBy(fmt.Sprintf("%s%s", stats.PortStatsTxPrefix, strings.ToLower(ptp.MessageSignaling.String())), 1)
+	}
+	return nil
+}
+
+// handleSignaling handles SIGNALING packet with any of the unicast negotiation TLVs
+func (c *Client) handleSignaling(b *ptp.Signaling) error {
+	if c.negotiation == nil {
+		c.logReceive(ptp.MessageSignaling, "unicast negotiation is disabled, ignoring")
+		c.stats.UpdateCounterBy("ptp.sptp.portstats.rx.unsupported", 1)
+		return nil
+	}
+	for _, tlv := range b.TLVs {
+		switch v := tlv.(type) {
+		case *ptp.GrantUnicastTransmissionTLV:
+			msgType := v.MsgTypeAndReserved.MsgType()
+			duration := time.Duration(v.DurationField) * time.Second
+			c.logReceive(ptp.MessageSignaling, "unicast grant for %s, duration=%v", msgType, duration)
+			if err := c.negotiation.setGrant(msgType, duration, time.Now()); err != nil {
+				return err
+			}
+		case *ptp.CancelUnicastTransmissionTLV:
+			msgType := v.MsgTypeAndFlags.MsgType()
+			c.logReceive(ptp.MessageSignaling, "unicast transmission of %s cancelled", msgType)
+			c.negotiation.cancel(msgType)
+			ack, err := reqAckCancelUnicast(c.clockID, c.domain, msgType)
+			if err != nil {
+				return err
+			}
+			seq, err := c.sendGeneralMsg(ack)
+			if err != nil {
+				return err
+			}
+			c.logSent(ptp.MessageSignaling, "ACK CANCEL for %s, seq=%d", msgType, seq)
+		default:
+			c.logReceive(ptp.MessageSignaling, "unsupported TLV %s, ignoring", tlv.Type())
+		}
+	}
+	return nil
+}
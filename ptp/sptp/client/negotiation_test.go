@@ -0,0 +1,332 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+func testNegotiationConfig() *UnicastNegotiationConfig {
+	return &UnicastNegotiationConfig{
+		Enabled:        true,
+		Duration:       time.Minute,
+		RenewBefore:    10 * time.Second,
+		RequestTimeout: time.Second,
+	}
+}
+
+func grantPkt(what ptp.MessageType, duration uint32) *ptp.Signaling {
+	l := binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.GrantUnicastTransmissionTLV{})
+	return &ptp.Signaling{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageSignaling, 0),
+			Version:            ptp.Version,
+			MessageLength:      uint16(l),
+			FlagField:          ptp.FlagUnicast,
+			LogMessageInterval: 0x7f,
+		},
+		TargetPortIdentity: ptp.DefaultTargetPortIdentity,
+		TLVs: []ptp.TLV{
+			&ptp.GrantUnicastTransmissionTLV{
+				TLVHead: ptp.TLVHead{
+					TLVType:     ptp.TLVGrantUnicastTransmission,
+					LengthField: uint16(binary.Size(ptp.GrantUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{})),
+				},
+				MsgTypeAndReserved: ptp.NewUnicastMsgTypeAndFlags(what, 0),
+				DurationField:      duration,
+				Renewal:            1,
+			},
+		},
+	}
+}
+
+func cancelPkt(what ptp.MessageType) *ptp.Signaling {
+	l := binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.CancelUnicastTransmissionTLV{})
+	return &ptp.Signaling{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageSignaling, 0),
+			Version:            ptp.Version,
+			MessageLength:      uint16(l),
+			FlagField:          ptp.FlagUnicast,
+			LogMessageInterval: 0x7f,
+		},
+		TargetPortIdentity: ptp.DefaultTargetPortIdentity,
+		TLVs: []ptp.TLV{
+			&ptp.CancelUnicastTransmissionTLV{
+				TLVHead: ptp.TLVHead{
+					TLVType:     ptp.TLVCancelUnicastTransmission,
+					LengthField: uint16(binary.Size(ptp.CancelUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{})),
+				},
+				MsgTypeAndFlags: ptp.NewUnicastMsgTypeAndFlags(what, 0),
+			},
+		},
+	}
+}
+
+func twoStepSyncPkt(seq int) *ptp.SyncDelayReq {
+	p := syncPkt(seq)
+	p.FlagField |= ptp.FlagTwoStep
+	p.OriginTimestamp = ptp.Timestamp{}
+	return p
+}
+
+func followUpPkt(seq int, t1 time.Time) *ptp.FollowUp {
+	return &ptp.FollowUp{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageFollowUp, 0),
+			Version:            ptp.Version,
+			SequenceID:         uint16(seq),
+			MessageLength:      uint16(binary.Size(ptp.FollowUp{})),
+			FlagField:          ptp.FlagUnicast,
+			LogMessageInterval: 0x7f,
+			CorrectionField:    ptp.NewCorrection(10),
+		},
+		FollowUpBody: ptp.FollowUpBody{
+			PreciseOriginTimestamp: ptp.NewTimestamp(t1),
+		},
+	}
+}
+
+func delayRespPkt(seq int, t4 time.Time) *ptp.DelayResp {
+	return &ptp.DelayResp{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageDelayResp, 0),
+			Version:            ptp.Version,
+			SequenceID:         uint16(seq),
+			MessageLength:      uint16(binary.Size(ptp.DelayResp{})),
+			FlagField:          ptp.FlagUnicast,
+			LogMessageInterval: 0x7f,
+		},
+		DelayRespBody: ptp.DelayRespBody{
+			ReceiveTimestamp: ptp.NewTimestamp(t4),
+		},
+	}
+}
+
+func packetBytes(t *testing.T, p ptp.Packet) []byte {
+	b, err := ptp.Bytes(p)
+	require.NoError(t, err)
+	return b
+}
+
+func TestUnicastNegotiationConfigValidate(t *testing.T) {
+	cfg := UnicastNegotiationConfig{}
+	require.NoError(t, cfg.Validate(), "disabled config is always valid")
+
+	cfg = *testNegotiationConfig()
+	require.NoError(t, cfg.Validate())
+
+	cfg.Duration = time.Millisecond
+	require.Error(t, cfg.Validate())
+
+	cfg = *testNegotiationConfig()
+	cfg.RenewBefore = cfg.Duration
+	require.Error(t, cfg.Validate())
+
+	cfg = *testNegotiationConfig()
+	cfg.RequestTimeout = 0
+	require.Error(t, cfg.Validate())
+}
+
+func TestUnicastNegotiationGrants(t *testing.T) {
+	n, err := newUnicastNegotiation(testNegotiationConfig(), time.Second)
+	require.NoError(t, err)
+	require.Equal(t, ptp.LogInterval(0), n.interval)
+
+	now := time.Now()
+	require.Equal(t, negotiatedMessages, n.toRequest(now))
+	// requests are in flight, nothing to request
+	require.Empty(t, n.toRequest(now.Add(100*time.Millisecond)))
+	// no response, request again
+	require.Equal(t, negotiatedMessages, n.toRequest(now.Add(time.Second)))
+	require.False(t, n.granted(ptp.MessageSync, now))
+
+	now = now.Add(time.Second)
+	require.NoError(t, n.setGrant(ptp.MessageSync, time.Minute, now))
+	require.NoError(t, n.setGrant(ptp.MessageAnnounce, time.Minute, now))
+	require.Error(t, n.setGrant(ptp.MessageDelayResp, 0, now), "zero duration means denied")
+	require.Error(t, n.setGrant(ptp.MessageManagement, time.Minute, now), "we never asked for this")
+	require.True(t, n.granted(ptp.MessageSync, now))
+	require.False(t, n.granted(ptp.MessageDelayResp, now))
+	require.Equal(t, []ptp.MessageType{ptp.MessageDelayResp}, n.toRequest(now))
+
+	// time to renew
+	require.NoError(t, n.setGrant(ptp.MessageDelayResp, time.Minute, now))
+	require.Empty(t, n.toRequest(now.Add(49*time.Second)))
+	require.Equal(t, negotiatedMessages, n.toRequest(now.Add(50*time.Second)))
+	require.False(t, n.granted(ptp.MessageSync, now.Add(time.Minute)))
+
+	n.cancel(ptp.MessageAnnounce)
+	require.False(t, n.granted(ptp.MessageAnnounce, now))
+}
+
+func TestReqUnicast(t *testing.T) {
+	cid := ptp.ClockIdentity(0xc42a1fffe6d7ca6)
+	req, err := reqUnicast(cid, 0, time.Minute, ptp.LogInterval(-1), ptp.MessageSync)
+	require.NoError(t, err)
+	b := packetBytes(t, req)
+	p := &ptp.Signaling{}
+	require.NoError(t, ptp.FromBytes(b, p))
+	require.Equal(t, cid, p.SourcePortIdentity.ClockIdentity)
+	require.Len(t, p.TLVs, 1)
+	tlv, ok := p.TLVs[0].(*ptp.RequestUnicastTransmissionTLV)
+	require.True(t, ok)
+	require.Equal(t, ptp.MessageSync, tlv.MsgTypeAndReserved.MsgType())
+	require.Equal(t, ptp.LogInterval(-1), tlv.LogInterMessagePeriod)
+	require.Equal(t, uint32(60), tlv.DurationField)
+
+	ackReq, err := reqAckCancelUnicast(cid, 0, ptp.MessageDelayResp)
+	require.NoError(t, err)
+	b = packetBytes(t, ackReq)
+	p = &ptp.Signaling{}
+	require.NoError(t, ptp.FromBytes(b, p))
+	require.Len(t, p.TLVs, 1)
+	ack, ok := p.TLVs[0].(*ptp.AcknowledgeCancelUnicastTransmissionTLV)
+	require.True(t, ok)
+	require.Equal(t, ptp.MessageDelayResp, ack.MsgTypeAndFlags.MsgType())
+}
+
+func TestClientHandleSignaling(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cid := ptp.ClockIdentity(0xc42a1fffe6d7ca6)
+
+	eventConn := NewMockUDPConnWithTS(ctrl)
+	genConn := NewMockUDPConn(ctrl)
+	statsServer := NewMockStatsServer(ctrl)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, &MeasurementConfig{}, statsServer)
+	require.NoError(t, err)
+
+	// disabled negotiation means we ignore signaling
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.signaling", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.unsupported", int64(1))
+	require.NoError(t, c.handleMsg(&inPacket{data: packetBytes(t, grantPkt(ptp.MessageSync, 60))}))
+
+	require.NoError(t, c.enableNegotiation(genConn, ptp.PortGeneral, testNegotiationConfig(), time.Second))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.signaling", int64(1)).Times(3)
+	require.NoError(t, c.handleMsg(&inPacket{data: packetBytes(t, grantPkt(ptp.MessageSync, 60))}))
+	require.True(t, c.negotiation.granted(ptp.MessageSync, time.Now()))
+
+	require.Error(t, c.handleMsg(&inPacket{data: packetBytes(t, grantPkt(ptp.MessageDelayResp, 0))}))
+	require.False(t, c.negotiation.granted(ptp.MessageDelayResp, time.Now()))
+
+	genConn.EXPECT().WriteTo(gomock.Any(), gomock.Any()).DoAndReturn(func(b []byte, addr net.Addr) (int, error) {
+		require.Equal(t, "127.0.0.1:320", addr.String())
+		p := &ptp.Signaling{}
+		require.NoError(t, ptp.FromBytes(b, p))
+		ack, ok := p.TLVs[0].(*ptp.AcknowledgeCancelUnicastTransmissionTLV)
+		require.True(t, ok)
+		require.Equal(t, ptp.MessageSync, ack.MsgTypeAndFlags.MsgType())
+		return len(b), nil
+	})
+	require.NoError(t, c.handleMsg(&inPacket{data: packetBytes(t, cancelPkt(ptp.MessageSync))}))
+	require.False(t, c.negotiation.granted(ptp.MessageSync, time.Now()))
+}
+
+func TestClientRunNegotiated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cid := ptp.ClockIdentity(0xc42a1fffe6d7ca6)
+
+	eventConn := NewMockUDPConnWithTS(ctrl)
+	genConn := NewMockUDPConn(ctrl)
+	statsServer := NewMockStatsServer(ctrl)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, &MeasurementConfig{}, statsServer)
+	require.NoError(t, err)
+	require.NoError(t, c.enableNegotiation(genConn, ptp.PortGeneral, testNegotiationConfig(), time.Second))
+
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.signaling", int64(1)).Times(3)
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.signaling", int64(1)).Times(3)
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.announce", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.sync", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.follow_up", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1))
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.rx.delay_resp", int64(1))
+
+	now := time.Now()
+	t1 := now.Add(-time.Millisecond)
+	syncSeq := 42
+	var announce *ptp.Announce
+	// server grants whatever we ask for, and starts sending announce and sync right away
+	genConn.EXPECT().WriteTo(gomock.Any(), gomock.Any()).Times(3).DoAndReturn(func(b []byte, _ net.Addr) (int, error) {
+		req := &ptp.Signaling{}
+		require.NoError(t, ptp.FromBytes(b, req))
+		tlv, ok := req.TLVs[0].(*ptp.RequestUnicastTransmissionTLV)
+		require.True(t, ok)
+		what := tlv.MsgTypeAndReserved.MsgType()
+		c.rx.push(&inPacket{data: packetBytes(t, grantPkt(what, tlv.DurationField))})
+		switch what {
+		case ptp.MessageAnnounce:
+			announce = announcePkt(1)
+			c.rx.push(&inPacket{data: packetBytes(t, announce)})
+		case ptp.MessageSync:
+			c.rx.push(&inPacket{data: packetBytes(t, twoStepSyncPkt(syncSeq)), ts: now})
+			c.rx.push(&inPacket{data: packetBytes(t, followUpPkt(syncSeq, t1))})
+		}
+		return len(b), nil
+	})
+	// DelayReq can only be sent once we've got the grant for DelayResp
+	eventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).DoAndReturn(func(b []byte, _ net.Addr) (int, time.Time, error) {
+		require.True(t, c.negotiation.granted(ptp.MessageDelayResp, time.Now()))
+		delayReq := &ptp.SyncDelayReq{}
+		require.NoError(t, ptp.FromBytes(b, delayReq))
+		c.rx.push(&inPacket{data: packetBytes(t, delayRespPkt(int(delayReq.SequenceID), now.Add(2*time.Millisecond)))})
+		return len(b), now.Add(time.Millisecond), nil
+	})
+
+	runResult := c.RunOnce(context.Background(), 100*time.Millisecond)
+	require.NoError(t, runResult.Error)
+	require.NotNil(t, runResult.Measurement)
+	require.Equal(t, *announce, runResult.Measurement.Announce)
+	require.Equal(t, t1.UnixNano(), runResult.Measurement.T1.UnixNano())
+	require.Equal(t, now, runResult.Measurement.T2)
+	require.Equal(t, now.Add(time.Millisecond), runResult.Measurement.T3)
+	require.Equal(t, time.Duration(10), runResult.Measurement.CorrectionFieldRX)
+	require.Equal(t, time.Millisecond, runResult.Measurement.ClientToServerDiff)
+}
+
+func TestClientRunNegotiatedNoGrant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cid := ptp.ClockIdentity(0xc42a1fffe6d7ca6)
+
+	eventConn := NewMockUDPConnWithTS(ctrl)
+	genConn := NewMockUDPConn(ctrl)
+	statsServer := NewMockStatsServer(ctrl)
+	c, err := newClient("127.0.0.1", ptp.PortEvent, cid, eventConn, &MeasurementConfig{}, statsServer)
+	require.NoError(t, err)
+	require.NoError(t, c.enableNegotiation(genConn, ptp.PortGeneral, testNegotiationConfig(), time.Second))
+
+	// server never replies
+	statsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.signaling", int64(1)).Times(3)
+	genConn.EXPECT().WriteTo(gomock.Any(), gomock.Any()).Times(3).Return(0, nil)
+
+	runResult := c.RunOnce(context.Background(), 50*time.Millisecond)
+	require.Error(t, runResult.Error)
+	require.True(t, errors.Is(runResult.Error, errNoGrant))
+	require.Nil(t, runResult.Measurement)
+}
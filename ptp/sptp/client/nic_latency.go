@@ -0,0 +1,37 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// NICLatency is how far timestamping point of the NIC is from the wire.
+// Drivers like igb and igc already compensate PHY latencies in the kernel, so these are for drivers which don't
+type NICLatency struct {
+	Ingress time.Duration `yaml:"ingress"` // from the wire to RX timestamp
+	Egress  time.Duration `yaml:"egress"`  // from TX timestamp to the wire
+}
+
+// Validate NICLatency is sane
+func (l *NICLatency) Validate() error {
+	if l.Ingress < 0 || l.Egress < 0 {
+		return fmt.Errorf("ingress and egress must be 0 or positive")
+	}
+	return nil
+}
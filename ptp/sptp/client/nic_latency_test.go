@@ -0,0 +1,72 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNICLatencyValidate(t *testing.T) {
+	l := NICLatency{}
+	require.NoError(t, l.Validate())
+	l = NICLatency{Ingress: 448 * time.Nanosecond, Egress: 178 * time.Nanosecond}
+	require.NoError(t, l.Validate())
+
+	l = NICLatency{Ingress: -time.Nanosecond}
+	require.EqualError(t, l.Validate(), "ingress and egress must be 0 or positive")
+}
+
+func TestReadConfigNICLatency(t *testing.T) {
+	f, err := os.CreateTemp("", "sptp")
+	require.NoError(t, err)
+	defer os.Remove(f.Name()) // clean up
+	_, err = f.Write([]byte(`iface: eth0
+servers:
+  192.168.0.10: 1
+niclatency:
+  eth0:
+    ingress: 310ns
+    egress: 80ns
+  eth1:
+    ingress: 1us
+    egress: 500ns
+`))
+	require.NoError(t, err)
+	cfg, err := ReadConfig(f.Name())
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, NICLatency{Ingress: 310 * time.Nanosecond, Egress: 80 * time.Nanosecond}, cfg.IfaceLatency("eth0"))
+	require.Equal(t, NICLatency{Ingress: time.Microsecond, Egress: 500 * time.Nanosecond}, cfg.IfaceLatency("eth1"))
+	require.Equal(t, NICLatency{}, cfg.IfaceLatency("eth2"))
+
+	cfg.NICLatency["eth1"] = NICLatency{Egress: -time.Nanosecond}
+	err = cfg.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid niclatency config for "eth1"`)
+
+	// keys of every interface are checked
+	_, err = f.Write([]byte(`  eth2:
+    egres: 500ns
+`))
+	require.NoError(t, err)
+	_, err = ReadConfig(f.Name())
+	require.EqualError(t, err, `unknown key "niclatency.eth2.egres", did you mean "niclatency.eth2.egress"?`)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// OneShotResult is outcome of single exchange with one GM
+type OneShotResult struct {
+	Server   string `json:"server"`
+	Priority int    `json:"priority"`
+	// would be selected as best master by BMCA
+	Selected     bool             `json:"selected"`
+	Error        string           `json:"error,omitempty"`
+	OffsetNS     int64            `json:"offset_ns"`
+	DelayNS      int64            `json:"delay_ns"`
+	GMIdentity   string           `json:"gm_identity,omitempty"`
+	GMPriority1  uint8            `json:"gm_priority1"`
+	GMPriority2  uint8            `json:"gm_priority2"`
+	ClockQuality ptp.ClockQuality `json:"clock_quality"`
+	StepsRemoved uint16           `json:"steps_removed"`
+	TimeSource   string           `json:"time_source,omitempty"`
+	UTCOffset    int16            `json:"utc_offset"`
+}
+
+// OneShotReachable returns how many GMs we successfully exchanged packets with
+func OneShotReachable(results []*OneShotResult) int {
+	reachable := 0
+	for _, r := range results {
+		if r.Error == "" {
+			reachable++
+		}
+	}
+	return reachable
+}
+
+// RunOneShot runs single exchange with all configured GMs and returns results sorted by server, without touching the clock
+func (p *SPTP) RunOneShot(ctx context.Context) []*OneShotResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		log.Debugf("starting listener")
+		if err := p.RunListener(ctx); err != nil && ctx.Err() == nil {
+			log.Fatal(err)
+		}
+	}()
+	return p.oneShotResults(p.exchange(ctx))
+}
+
+// oneShotResults converts exchange results into one-shot report, marking GM BMCA would select
+func (p *SPTP) oneShotResults(results map[string]*RunResult) []*OneShotResult {
+	announces := []*ptp.Announce{}
+	localPrioMap := map[ptp.ClockIdentity]int{}
+	out := make([]*OneShotResult, 0, len(results))
+	byID := map[ptp.ClockIdentity]*OneShotResult{}
+	for addr, res := range results {
+		r := &OneShotResult{
+			Server:   addr,
+			Priority: p.priorities[addr],
+		}
+		out = append(out, r)
+		if res.Error != nil {
+			r.Error = res.Error.Error()
+			continue
+		}
+		if res.Measurement == nil {
+			r.Error = "missing measurement"
+			continue
+		}
+		m := res.Measurement
+		r.OffsetNS = m.Offset.Nanoseconds()
+		r.DelayNS = m.Delay.Nanoseconds()
+		r.GMIdentity = m.Announce.GrandmasterIdentity.String()
+		r.GMPriority1 = m.Announce.GrandmasterPriority1
+		r.GMPriority2 = m.Announce.GrandmasterPriority2
+		r.ClockQuality = m.Announce.GrandmasterClockQuality
+		r.StepsRemoved = m.Announce.StepsRemoved
+		r.TimeSource = m.Announce.TimeSource.String()
+		r.UTCOffset = m.Announce.CurrentUTCOffset
+		if err := p.clockClassRefused(res); err != nil {
+			r.Error = err.Error()
+			continue
+		}
+		announces = append(announces, &m.Announce)
+		localPrioMap[m.Announce.GrandmasterIdentity] = p.priorities[addr]
+		byID[m.Announce.GrandmasterIdentity] = r
+	}
+	if best := bmcaDomains(announces, localPrioMap, p.cfg.DomainPriority, p.cfg.Comparator(), nil); best != nil {
+		byID[best.GrandmasterIdentity].Selected = true
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Server < out[j].Server
+	})
+	return out
+}
+
+// WriteOneShotText prints one-shot results as human readable table
+func WriteOneShotText(w io.Writer, results []*OneShotResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tPRIO\tSELECTED\tOFFSET(ns)\tDELAY(ns)\tGM IDENTITY\tP1\tP2\tCLASS\tACCURACY\tSTEPS\tUTC OFFSET\tERROR")
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Fprintf(tw, "%s\t%d\t\t\t\t\t\t\t\t\t\t\t%s\n", r.Server, r.Priority, r.Error)
+			continue
+		}
+		selected := ""
+		if r.Selected {
+			selected = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%d\t%s\t%d\t%d\t%d\t0x%02x\t%d\t%d\t\n",
+			r.Server, r.Priority, selected, r.OffsetNS, r.DelayNS, r.GMIdentity,
+			r.GMPriority1, r.GMPriority2, r.ClockQuality.ClockClass, r.ClockQuality.ClockAccuracy,
+			r.StepsRemoved, r.UTCOffset)
+	}
+	return tw.Flush()
+}
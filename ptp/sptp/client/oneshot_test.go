@@ -0,0 +1,111 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+func TestOneShotResults(t *testing.T) {
+	announce := func(id ptp.ClockIdentity, class ptp.ClockClass) ptp.Announce {
+		return ptp.Announce{
+			AnnounceBody: ptp.AnnounceBody{
+				CurrentUTCOffset:        37,
+				GrandmasterPriority1:    128,
+				GrandmasterPriority2:    128,
+				GrandmasterIdentity:     id,
+				GrandmasterClockQuality: ptp.ClockQuality{ClockClass: class, ClockAccuracy: ptp.ClockAccuracyNanosecond100},
+				StepsRemoved:            1,
+				TimeSource:              ptp.TimeSourceGNSS,
+			},
+		}
+	}
+	p := &SPTP{
+		cfg: DefaultConfig(),
+		priorities: map[string]int{
+			"192.168.0.10": 1,
+			"192.168.0.11": 2,
+			"192.168.0.12": 3,
+		},
+	}
+	results := map[string]*RunResult{
+		"192.168.0.12": {
+			Server: "192.168.0.12",
+			Error:  fmt.Errorf("context deadline exceeded"),
+		},
+		"192.168.0.11": {
+			Server: "192.168.0.11",
+			Measurement: &MeasurementResult{
+				Offset:   -100 * time.Nanosecond,
+				Delay:    2 * time.Microsecond,
+				Announce: announce(2, ptp.ClockClass6),
+			},
+		},
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Offset:   200 * time.Nanosecond,
+				Delay:    3 * time.Microsecond,
+				Announce: announce(1, ptp.ClockClass7),
+			},
+		},
+	}
+	got := p.oneShotResults(results)
+	require.Len(t, got, 3)
+	require.Equal(t, 2, OneShotReachable(got))
+
+	require.Equal(t, "192.168.0.10", got[0].Server)
+	require.Equal(t, 1, got[0].Priority)
+	require.False(t, got[0].Selected)
+	require.Equal(t, int64(200), got[0].OffsetNS)
+	require.Equal(t, int64(3000), got[0].DelayNS)
+
+	// better clock class wins
+	require.Equal(t, "192.168.0.11", got[1].Server)
+	require.True(t, got[1].Selected)
+	require.Equal(t, ptp.ClockIdentity(2).String(), got[1].GMIdentity)
+	require.Equal(t, int16(37), got[1].UTCOffset)
+	require.Equal(t, ptp.TimeSourceGNSS.String(), got[1].TimeSource)
+
+	require.Equal(t, "192.168.0.12", got[2].Server)
+	require.Equal(t, "context deadline exceeded", got[2].Error)
+	require.False(t, got[2].Selected)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteOneShotText(&buf, got))
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 4)
+	require.Contains(t, string(lines[0]), "OFFSET(ns)")
+	require.Contains(t, string(lines[2]), "*")
+	require.Contains(t, string(lines[3]), "context deadline exceeded")
+
+	require.Equal(t, 0, OneShotReachable(p.oneShotResults(map[string]*RunResult{"192.168.0.12": results["192.168.0.12"]})))
+
+	// GM with worse clock class is refused
+	p.cfg.MaxClockClass = int(ptp.ClockClass6)
+	got = p.oneShotResults(results)
+	require.Equal(t, "clock class 7 is worse than maxclockclass 6", got[0].Error)
+	require.True(t, got[1].Selected)
+	require.Equal(t, 1, OneShotReachable(got))
+}
@@ -0,0 +1,190 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/facebook/time/phc"
+	"github.com/facebook/time/servo"
+)
+
+// Phc2SysConfig describes built-in phc2sys-like loop, disciplining system clock from already synced PHC
+type Phc2SysConfig struct {
+	Enabled            bool          `yaml:"enabled"`
+	Interval           time.Duration `yaml:"interval"`             // how often to measure PHC-sys offset
+	FirstStepThreshold time.Duration `yaml:"first_step_threshold"` // step system clock on first update if offset is larger than this, 0 means never
+}
+
+// Validate Phc2SysConfig is sane
+func (c *Phc2SysConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+	if c.FirstStepThreshold < 0 {
+		return fmt.Errorf("first_step_threshold must be 0 or positive")
+	}
+	return nil
+}
+
+// phc2sys measures offset between system clock and PHC, and optionally disciplines system clock from PHC with its own servo.
+// PHC is in TAI, so offset is only known once we know UTC offset from the best master,
+// and system clock is only disciplined once SPTP has synced PHC.
+type phc2sys struct {
+	sync.Mutex
+
+	cfg      *Phc2SysConfig
+	interval time.Duration
+	clock    Clock
+	pi       Servo
+	stats    StatsServer
+	// returns offset between system clock and PHC, like PTP_SYS_OFFSET_EXTENDED
+	sysoff func() (phc.SysoffResult, error)
+
+	// UTC offset of PHC, reported by GM
+	utcOffset      time.Duration
+	utcOffsetKnown bool
+	// if we are disciplining system clock right now
+	enabled bool
+}
+
+// newPhc2Sys creates phc2sys for PHC device. Unless cfg is enabled, it only reports offset every interval
+func newPhc2Sys(cfg *Phc2SysConfig, interval time.Duration, device string, stats StatsServer) *phc2sys {
+	if cfg.Enabled {
+		interval = cfg.Interval
+	}
+	return &phc2sys{
+		cfg:      cfg,
+		interval: interval,
+		clock:    newSysClock(),
+		stats:    stats,
+		sysoff: func() (phc.SysoffResult, error) {
+			return phc.TimeAndOffsetFromDevice(device, phc.MethodIoctlSysOffsetExtended)
+		},
+	}
+}
+
+// setUTCOffset sets current UTC offset of PHC
+func (s *phc2sys) setUTCOffset(utcOffset time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.utcOffset = utcOffset
+	s.utcOffsetKnown = true
+}
+
+// enable starts disciplining system clock, if configured
+func (s *phc2sys) enable() {
+	s.Lock()
+	defer s.Unlock()
+	if !s.cfg.Enabled {
+		return
+	}
+	if !s.enabled {
+		servoLog.Infof("phc2sys: PHC is synced, disciplining system clock")
+	}
+	s.enabled = true
+}
+
+// disable stops disciplining system clock
+func (s *phc2sys) disable() {
+	s.Lock()
+	defer s.Unlock()
+	if s.enabled {
+		servoLog.Warningf("phc2sys: not disciplining system clock")
+		// someone else may be in charge of system clock now, start over when enabled
+		s.pi = nil
+	}
+	s.enabled = false
+}
+
+// sync runs single iteration of the loop
+func (s *phc2sys) sync() error {
+	s.Lock()
+	defer s.Unlock()
+	if !s.utcOffsetKnown {
+		return nil
+	}
+	res, err := s.sysoff()
+	if err != nil {
+		return fmt.Errorf("reading PHC-sys offset: %w", err)
+	}
+	// system clock is in UTC
+	offset := res.Offset + s.utcOffset
+	s.stats.SetCounter("ptp.sptp.phc2sys.offset_ns", offset.Nanoseconds())
+	s.stats.SetCounter("ptp.sptp.phc2sys.delay_ns", res.Delay.Nanoseconds())
+	if !s.enabled {
+		servoLog.Debugf("phc2sys: offset %10d delay %10d", offset.Nanoseconds(), res.Delay.Nanoseconds())
+		return nil
+	}
+	if s.pi == nil {
+		pi, err := newServo(s.clock, s.cfg.FirstStepThreshold)
+		if err != nil {
+			return fmt.Errorf("creating servo: %w", err)
+		}
+		pi.SyncInterval(s.interval.Seconds())
+		s.pi = pi
+	}
+	freqAdj, state := s.pi.Sample(int64(offset), uint64(res.SysTime.UnixNano()))
+	servoLog.Debugf("phc2sys: offset %10d s%d freq %+7.0f delay %10d", offset.Nanoseconds(), state, freqAdj, res.Delay.Nanoseconds())
+	switch state {
+	case servo.StateJump:
+		if err := s.clock.Step(-1 * offset); err != nil {
+			return fmt.Errorf("failed to step sys clock by %v: %w", -1*offset, err)
+		}
+	case servo.StateLocked:
+		if err := s.clock.AdjFreqPPB(-1 * freqAdj); err != nil {
+			return fmt.Errorf("failed to adjust sys clock freq to %v: %w", -1*freqAdj, err)
+		}
+		if sysClk, ok := s.clock.(*SysClock); ok {
+			if err := sysClk.SetSync(); err != nil {
+				return fmt.Errorf("failed to set sys clock sync state: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// run measures offset and disciplines system clock until context is cancelled
+func (s *phc2sys) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.Lock()
+			defer s.Unlock()
+			if s.enabled && s.pi != nil {
+				freqAdj := s.pi.MeanFreq()
+				servoLog.Infof("phc2sys: exiting, setting sys clock freq to: %v", -1*freqAdj)
+				if err := s.clock.AdjFreqPPB(-1 * freqAdj); err != nil {
+					servoLog.Errorf("phc2sys: failed to adjust sys clock freq to %v: %v", -1*freqAdj, err)
+				}
+			}
+			return
+		case <-ticker.C:
+			if err := s.sync(); err != nil {
+				servoLog.Errorf("phc2sys: %v", err)
+			}
+		}
+	}
+}
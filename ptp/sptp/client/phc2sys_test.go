@@ -0,0 +1,189 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/phc"
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/servo"
+)
+
+func TestPhc2SysConfigValidate(t *testing.T) {
+	require.NoError(t, (&Phc2SysConfig{}).Validate())
+	require.NoError(t, (&Phc2SysConfig{Enabled: true, Interval: time.Second}).Validate())
+	require.Error(t, (&Phc2SysConfig{Enabled: true}).Validate())
+	require.Error(t, (&Phc2SysConfig{Enabled: true, Interval: time.Second, FirstStepThreshold: -time.Second}).Validate())
+}
+
+func TestPhc2SysSync(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockServo := NewMockServo(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+
+	var sysoffErr error
+	s := &phc2sys{
+		cfg:      &Phc2SysConfig{Enabled: true, Interval: time.Second},
+		interval: time.Second,
+		clock:    mockClock,
+		pi:       mockServo,
+		stats:    mockStatsServer,
+		sysoff: func() (phc.SysoffResult, error) {
+			// system clock is 37s behind PHC, plus 100us
+			return phc.SysoffResult{
+				Offset:  -37*time.Second + 100*time.Microsecond,
+				Delay:   2 * time.Microsecond,
+				SysTime: ts,
+			}, sysoffErr
+		},
+	}
+
+	// UTC offset is unknown, nothing to report
+	require.NoError(t, s.sync())
+
+	// offset is reported, but system clock is left alone until PHC is synced
+	s.setUTCOffset(37 * time.Second)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.phc2sys.offset_ns", int64(100000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.phc2sys.delay_ns", int64(2000))
+	require.NoError(t, s.sync())
+
+	s.enable()
+	mockServo.EXPECT().Sample(int64(100*time.Microsecond), uint64(ts.UnixNano())).Return(12.3, servo.StateLocked)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.phc2sys.offset_ns", int64(100000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.phc2sys.delay_ns", int64(2000))
+	mockClock.EXPECT().AdjFreqPPB(-12.3).Return(nil)
+	require.NoError(t, s.sync())
+
+	mockServo.EXPECT().Sample(int64(100*time.Microsecond), uint64(ts.UnixNano())).Return(0.0, servo.StateJump)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.phc2sys.offset_ns", int64(100000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.phc2sys.delay_ns", int64(2000))
+	mockClock.EXPECT().Step(-100 * time.Microsecond).Return(nil)
+	require.NoError(t, s.sync())
+
+	sysoffErr = fmt.Errorf("ioctl failed")
+	require.Error(t, s.sync())
+
+	// disabling drops the servo, it starts over from current frequency once enabled again
+	s.disable()
+	require.Nil(t, s.pi)
+	sysoffErr = nil
+	s.enable()
+	mockClock.EXPECT().FrequencyPPB().Return(10.0, nil)
+	mockClock.EXPECT().MaxFreqPPB().Return(500000.0, nil)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.phc2sys.offset_ns", int64(100000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.phc2sys.delay_ns", int64(2000))
+	require.NoError(t, s.sync())
+	require.NotNil(t, s.pi)
+}
+
+func TestProcessResultsPhc2Sys(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockServo := NewMockServo(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1)).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100)).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).AnyTimes()
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	cfg.Phc2Sys = Phc2SysConfig{Enabled: true, Interval: time.Second}
+	p := &SPTP{
+		clock:   mockClock,
+		pi:      mockServo,
+		stats:   mockStatsServer,
+		cfg:     cfg,
+		phc2sys: newPhc2Sys(&cfg.Phc2Sys, cfg.Interval, "/dev/ptp0", mockStatsServer),
+	}
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -100 * time.Microsecond,
+				Timestamp: ts,
+				Announce: ptp.Announce{
+					AnnounceBody: ptp.AnnounceBody{
+						CurrentUTCOffset: 37,
+					},
+				},
+			},
+		},
+	}
+	require.NoError(t, p.initClients())
+
+	// PHC is not synced yet, system clock is left alone
+	mockServo.EXPECT().Sample(int64(-100*time.Microsecond), gomock.Any()).Return(0.0, servo.StateInit)
+	p.processResults(results)
+	require.False(t, p.phc2sys.enabled)
+	require.True(t, p.phc2sys.utcOffsetKnown)
+	require.Equal(t, 37*time.Second, p.phc2sys.utcOffset)
+
+	mockServo.EXPECT().Sample(int64(-100*time.Microsecond), gomock.Any()).Return(12.3, servo.StateLocked)
+	mockClock.EXPECT().AdjFreqPPB(-12.3).Return(nil)
+	p.processResults(results)
+	require.True(t, p.phc2sys.enabled)
+
+	// drained, system clock is left alone as well
+	p.drain = newDrain("")
+	p.drain.set(true)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.drained", int64(1))
+	p.processResults(results)
+	require.False(t, p.phc2sys.enabled)
+}
+
+func TestPhc2SysReportOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+
+	s := newPhc2Sys(&Phc2SysConfig{}, 2*time.Second, "/dev/ptp0", mockStatsServer)
+	require.Equal(t, 2*time.Second, s.interval)
+	s.clock = mockClock
+	s.sysoff = func() (phc.SysoffResult, error) {
+		return phc.SysoffResult{Offset: -37*time.Second - time.Millisecond, Delay: 2 * time.Microsecond}, nil
+	}
+	s.setUTCOffset(37 * time.Second)
+	// not configured to discipline system clock, so it's never touched
+	s.enable()
+	require.False(t, s.enabled)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.phc2sys.offset_ns", int64(-1000000))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.phc2sys.delay_ns", int64(2000))
+	require.NoError(t, s.sync())
+	require.Nil(t, s.pi)
+
+	require.Equal(t, time.Second, newPhc2Sys(&Phc2SysConfig{Enabled: true, Interval: time.Second}, 2*time.Second, "/dev/ptp0", mockStatsServer).interval)
+}
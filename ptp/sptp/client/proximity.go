@@ -0,0 +1,111 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/sptp/bmc"
+)
+
+// ProximityConfig describes configuration of path delay based tie-break between GMs BMCA deems equal
+type ProximityConfig struct {
+	Enabled   bool          `yaml:"enabled"`   // prefer closer GM if BMCA can't tell GMs apart
+	Window    int           `yaml:"window"`    // over how many last path delays we average
+	Threshold time.Duration `yaml:"threshold"` // GMs with average path delays within threshold are in the same proximity group
+}
+
+// Validate ProximityConfig is sane
+func (c *ProximityConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Window <= 0 {
+		return fmt.Errorf("window must be greater than zero")
+	}
+	if c.Threshold < 0 {
+		return fmt.Errorf("threshold must be 0 or positive")
+	}
+	return nil
+}
+
+// announcesEqual reports if cmp has nothing but GM identities or ports to tell announces apart:
+// either it can't tell them apart at all, or swapping identities and ports between them flips its choice
+func announcesEqual(cmp bmc.Comparator, a, b *ptp.Announce, localPrioA, localPrioB int) bool {
+	cr := cmp(a, b, localPrioA, localPrioB)
+	if cr == bmc.Unknown {
+		return true
+	}
+	swappedA, swappedB := *a, *b
+	swappedA.GrandmasterIdentity, swappedB.GrandmasterIdentity = b.GrandmasterIdentity, a.GrandmasterIdentity
+	swappedA.SourcePortIdentity, swappedB.SourcePortIdentity = b.SourcePortIdentity, a.SourcePortIdentity
+	swapped := cmp(&swappedA, &swappedB, localPrioA, localPrioB)
+	return swapped != bmc.Unknown && (cr > 0) != (swapped > 0)
+}
+
+// proximity keeps recent path delays of all GMs
+type proximity struct {
+	cfg    *ProximityConfig
+	delays map[string]*slidingWindow
+}
+
+func newProximity(cfg *ProximityConfig) *proximity {
+	return &proximity{
+		cfg:    cfg,
+		delays: map[string]*slidingWindow{},
+	}
+}
+
+// add records path delay measured to GM
+func (p *proximity) add(addr string, delay time.Duration) {
+	w, found := p.delays[addr]
+	if !found {
+		w = newSlidingWindow(p.cfg.Window)
+		p.delays[addr] = w
+	}
+	w.add(float64(delay))
+}
+
+// delay returns average recent path delay to GM, NaN if we have no samples
+func (p *proximity) delay(addr string) float64 {
+	w, found := p.delays[addr]
+	if !found {
+		return math.NaN()
+	}
+	return w.mean()
+}
+
+// compare prefers GM with lower average path delay, if GMs are in different proximity groups
+func (p *proximity) compare(addrA, addrB string) bmc.ComparisonResult {
+	delayA := p.delay(addrA)
+	delayB := p.delay(addrB)
+	if math.IsNaN(delayA) || math.IsNaN(delayB) {
+		return bmc.Unknown
+	}
+	if math.Abs(delayA-delayB) <= float64(p.cfg.Threshold) {
+		return bmc.Unknown
+	}
+	if delayA < delayB {
+		protocolLog.Infof("GMs %q and %q are equal, preferring closer %q by path delay %v vs %v", addrA, addrB, addrA, time.Duration(delayA), time.Duration(delayB))
+		return bmc.ABetter
+	}
+	protocolLog.Infof("GMs %q and %q are equal, preferring closer %q by path delay %v vs %v", addrA, addrB, addrB, time.Duration(delayB), time.Duration(delayA))
+	return bmc.BBetter
+}
@@ -0,0 +1,98 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/sptp/bmc"
+)
+
+func TestProximityConfigValidate(t *testing.T) {
+	cfg := ProximityConfig{}
+	require.NoError(t, cfg.Validate())
+	cfg = ProximityConfig{Enabled: true, Window: 10, Threshold: time.Microsecond}
+	require.NoError(t, cfg.Validate())
+	cfg.Window = 0
+	require.Error(t, cfg.Validate())
+	cfg = ProximityConfig{Enabled: true, Window: 10, Threshold: -1}
+	require.Error(t, cfg.Validate())
+}
+
+func TestAnnouncesEqual(t *testing.T) {
+	newAnnounce := func(id ptp.ClockIdentity) *ptp.Announce {
+		return &ptp.Announce{
+			Header: ptp.Header{SourcePortIdentity: ptp.PortIdentity{ClockIdentity: id, PortNumber: 1}},
+			AnnounceBody: ptp.AnnounceBody{
+				GrandmasterIdentity:     id,
+				GrandmasterPriority1:    128,
+				GrandmasterClockQuality: ptp.ClockQuality{ClockClass: ptp.ClockClass6},
+				GrandmasterPriority2:    128,
+				StepsRemoved:            1,
+			},
+		}
+	}
+	for _, cmp := range []bmc.Comparator{bmc.DefaultDscmp, bmc.TelcoDscmp} {
+		a, b := newAnnounce(1), newAnnounce(2)
+		require.True(t, announcesEqual(cmp, a, b, 1, 1))
+		require.True(t, announcesEqual(cmp, b, a, 1, 1))
+		// same GM seen via different ports
+		require.True(t, announcesEqual(cmp, a, a, 1, 1))
+
+		b.GrandmasterClockQuality.ClockClass = ptp.ClockClass7
+		require.False(t, announcesEqual(cmp, a, b, 1, 1))
+		b = newAnnounce(2)
+		b.GrandmasterPriority2 = 127
+		require.False(t, announcesEqual(cmp, a, b, 1, 1))
+	}
+
+	// only default profile ranks on priority1
+	a, b := newAnnounce(1), newAnnounce(2)
+	b.GrandmasterPriority1 = 129
+	require.False(t, announcesEqual(bmc.DefaultDscmp, a, b, 1, 1))
+	require.False(t, announcesEqual(bmc.DefaultDscmp, b, a, 1, 1))
+	require.True(t, announcesEqual(bmc.TelcoDscmp, a, b, 1, 1))
+
+	// only telecom profile ranks on local priority
+	a, b = newAnnounce(1), newAnnounce(2)
+	require.True(t, announcesEqual(bmc.DefaultDscmp, a, b, 1, 2))
+	require.False(t, announcesEqual(bmc.TelcoDscmp, a, b, 1, 2))
+}
+
+func TestProximityCompare(t *testing.T) {
+	p := newProximity(&ProximityConfig{Enabled: true, Window: 2, Threshold: 10 * time.Microsecond})
+	require.Equal(t, bmc.Unknown, p.compare("a", "b"), "no data")
+
+	p.add("a", 100*time.Microsecond)
+	require.Equal(t, bmc.Unknown, p.compare("a", "b"), "no data for b")
+
+	p.add("b", 105*time.Microsecond)
+	require.Equal(t, bmc.Unknown, p.compare("a", "b"), "same proximity group")
+
+	p.add("b", 135*time.Microsecond)
+	require.Equal(t, bmc.ABetter, p.compare("a", "b"))
+	require.Equal(t, bmc.BBetter, p.compare("b", "a"))
+
+	// old samples fall out of the window
+	p.add("a", 200*time.Microsecond)
+	p.add("a", 200*time.Microsecond)
+	require.Equal(t, bmc.BBetter, p.compare("a", "b"))
+}
@@ -0,0 +1,101 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"sync"
+)
+
+// rxQueueSize is how many received packets we keep for each client
+const rxQueueSize = 100
+
+// rxQueue is a bounded ring buffer of packets received from the server.
+// Listener never blocks on it: once it's full, the oldest packet is dropped,
+// as it most likely belongs to the exchange we already gave up on.
+type rxQueue struct {
+	sync.Mutex
+	packets []*inPacket
+	head    int
+	size    int
+	dropped int64
+	// signalled when there are packets to pop
+	ready chan struct{}
+}
+
+func newRXQueue(capacity int) *rxQueue {
+	return &rxQueue{
+		packets: make([]*inPacket, capacity),
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+func (q *rxQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// push adds packet to the queue, dropping the oldest one if the queue is full. Returns true if packet was dropped
+func (q *rxQueue) push(p *inPacket) bool {
+	q.Lock()
+	defer q.Unlock()
+	dropped := false
+	if q.size == len(q.packets) {
+		q.packets[q.head] = nil
+		q.head = (q.head + 1) % len(q.packets)
+		q.size--
+		q.dropped++
+		dropped = true
+	}
+	q.packets[(q.head+q.size)%len(q.packets)] = p
+	q.size++
+	q.signal()
+	return dropped
+}
+
+// pop removes the oldest packet from the queue, nil if the queue is empty
+func (q *rxQueue) pop() *inPacket {
+	q.Lock()
+	defer q.Unlock()
+	if q.size == 0 {
+		return nil
+	}
+	p := q.packets[q.head]
+	q.packets[q.head] = nil
+	q.head = (q.head + 1) % len(q.packets)
+	q.size--
+	// keep consumer waking up until the queue is drained
+	if q.size > 0 {
+		q.signal()
+	}
+	return p
+}
+
+// len returns number of packets in the queue
+func (q *rxQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return q.size
+}
+
+// drops returns how many packets were dropped because the queue was full
+func (q *rxQueue) drops() int64 {
+	q.Lock()
+	defer q.Unlock()
+	return q.dropped
+}
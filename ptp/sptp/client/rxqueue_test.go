@@ -0,0 +1,56 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRXQueue(t *testing.T) {
+	q := newRXQueue(3)
+	require.Nil(t, q.pop())
+	require.Equal(t, 0, q.len())
+
+	for i := 0; i < 3; i++ {
+		require.False(t, q.push(&inPacket{data: []byte{byte(i)}}))
+	}
+	require.Equal(t, 3, q.len())
+	require.Equal(t, int64(0), q.drops())
+	// queue is full, oldest packets go first
+	require.True(t, q.push(&inPacket{data: []byte{3}}))
+	require.True(t, q.push(&inPacket{data: []byte{4}}))
+	require.Equal(t, 3, q.len())
+	require.Equal(t, int64(2), q.drops())
+
+	for i := 2; i < 5; i++ {
+		<-q.ready
+		p := q.pop()
+		require.NotNil(t, p)
+		require.Equal(t, []byte{byte(i)}, p.data)
+	}
+	require.Nil(t, q.pop())
+	require.Equal(t, 0, q.len())
+	require.Len(t, q.ready, 0, "drained queue must not wake consumer up")
+
+	// wraps around
+	require.False(t, q.push(&inPacket{data: []byte{5}}))
+	<-q.ready
+	require.Equal(t, []byte{5}, q.pop().data)
+	require.Equal(t, int64(2), q.drops())
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/facebook/time/servo"
+)
+
+// ServoStateConfig describes where servo state is kept between restarts, so SPTP can warm start the servo
+type ServoStateConfig struct {
+	Path   string        `yaml:"path"`    // where to save servo state on exit, disabled if empty
+	MaxAge time.Duration `yaml:"max_age"` // ignore saved state older than this, 0 means never
+}
+
+// Validate ServoStateConfig is sane
+func (c *ServoStateConfig) Validate() error {
+	if c.MaxAge < 0 {
+		return fmt.Errorf("max_age must be 0 or positive")
+	}
+	return nil
+}
+
+// servoStateFile is the content of servo state file
+type servoStateFile struct {
+	Saved time.Time           `json:"saved"`
+	Iface string              `json:"iface"`
+	Servo *servo.PiServoState `json:"servo"`
+}
+
+// writeServoState atomically writes servo state of the clock on the iface
+func writeServoState(path string, iface string, now time.Time, st *servo.PiServoState) error {
+	b, err := json.Marshal(&servoStateFile{Saved: now, Iface: iface, Servo: st})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readServoState reads servo state saved for the clock on the iface, refusing state which is too old
+func readServoState(cfg *ServoStateConfig, iface string, now time.Time) (*servo.PiServoState, error) {
+	b, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	f := &servoStateFile{}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", cfg.Path, err)
+	}
+	if f.Servo == nil {
+		return nil, fmt.Errorf("no servo state in %s", cfg.Path)
+	}
+	if f.Iface != iface {
+		return nil, fmt.Errorf("servo state was saved for iface %q, not %q", f.Iface, iface)
+	}
+	if age := now.Sub(f.Saved); cfg.MaxAge > 0 && age > cfg.MaxAge {
+		return nil, fmt.Errorf("servo state is %v old, more than max age %v", age, cfg.MaxAge)
+	}
+	return f.Servo, nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/servo"
+)
+
+func TestServoStateConfigValidate(t *testing.T) {
+	require.NoError(t, (&ServoStateConfig{}).Validate())
+	require.NoError(t, (&ServoStateConfig{Path: "/var/run/sptp.servo", MaxAge: time.Hour}).Validate())
+	require.Error(t, (&ServoStateConfig{MaxAge: -time.Hour}).Validate())
+}
+
+func TestServoStateReadWrite(t *testing.T) {
+	cfg := &ServoStateConfig{Path: filepath.Join(t.TempDir(), "servo.json"), MaxAge: time.Hour}
+	now := time.Unix(1678000000, 0)
+
+	_, err := readServoState(cfg, "eth0", now)
+	require.True(t, os.IsNotExist(err))
+
+	want := &servo.PiServoState{Freq: -12345.6, OffsetMean: 3, OffsetStdev: 40, FreqStdev: 5.5}
+	require.NoError(t, writeServoState(cfg.Path, "eth0", now, want))
+	got, err := readServoState(cfg, "eth0", now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	_, err = readServoState(cfg, "eth1", now.Add(time.Minute))
+	require.EqualError(t, err, `servo state was saved for iface "eth0", not "eth1"`)
+
+	_, err = readServoState(cfg, "eth0", now.Add(2*time.Hour))
+	require.EqualError(t, err, "servo state is 2h0m0s old, more than max age 1h0m0s")
+
+	cfg.MaxAge = 0
+	_, err = readServoState(cfg, "eth0", now.Add(2*time.Hour))
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(cfg.Path, []byte("{}"), 0644))
+	_, err = readServoState(cfg, "eth0", now)
+	require.EqualError(t, err, "no servo state in "+cfg.Path)
+}
+
+func TestSPTPServoStateWarmStart(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Iface = "eth0"
+	cfg.ServoState.Path = filepath.Join(t.TempDir(), "servo.json")
+	pi := servo.NewPiServo(servo.DefaultServoConfig(), servo.DefaultPiServoCfg(), -100)
+	servo.NewPiServoFilter(pi, servo.DefaultPiServoFilterCfg())
+	pi.SyncInterval(1)
+	p := &SPTP{cfg: cfg, pi: pi}
+
+	// nothing to warm start from
+	p.warmStartServo()
+	_, state := pi.Sample(100, 1)
+	require.Equal(t, servo.StateInit, state)
+
+	// never synced, nothing to save
+	p.saveServoState()
+	_, err := os.Stat(cfg.ServoState.Path)
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, writeServoState(cfg.ServoState.Path, "eth0", time.Now(), &servo.PiServoState{Freq: -12345, OffsetStdev: 100}))
+	pi = servo.NewPiServo(servo.DefaultServoConfig(), servo.DefaultPiServoCfg(), -100)
+	servo.NewPiServoFilter(pi, servo.DefaultPiServoFilterCfg())
+	pi.SyncInterval(1)
+	p.pi = pi
+	p.warmStartServo()
+	freq, state := pi.Sample(10, 1)
+	require.Equal(t, servo.StateLocked, state)
+	require.InDelta(t, -12345+10, freq, 0.001)
+
+	p.synced = true
+	p.saveServoState()
+	st, err := readServoState(&cfg.ServoState, "eth0", time.Now())
+	require.NoError(t, err)
+	require.Equal(t, pi.State(), st)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/facebook/time/servo"
+)
+
+// ShadowServoConfig describes a shadow servo: one which is fed the same samples as the active servo, but never touches the clock.
+// It's used to evaluate candidate servo parameters in production before switching to them.
+type ShadowServoConfig struct {
+	Enabled       bool          `yaml:"enabled"`        // run shadow servo alongside the active one
+	KpScale       float64       `yaml:"kp_scale"`       // proportional constant scale, 0 means default
+	KiScale       float64       `yaml:"ki_scale"`       // integral constant scale, 0 means default
+	KpNormMax     float64       `yaml:"kp_norm_max"`    // max normalized proportional constant, 0 means default
+	KiNormMax     float64       `yaml:"ki_norm_max"`    // max normalized integral constant, 0 means default
+	StepThreshold time.Duration `yaml:"step_threshold"` // step the clock if offset is larger than this, 0 means never
+}
+
+// Validate ShadowServoConfig is sane
+func (c *ShadowServoConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.KpScale < 0 || c.KiScale < 0 {
+		return fmt.Errorf("kp_scale and ki_scale must be 0 or positive")
+	}
+	if c.KpNormMax < 0 || c.KiNormMax < 0 {
+		return fmt.Errorf("kp_norm_max and ki_norm_max must be 0 or positive")
+	}
+	if c.StepThreshold < 0 {
+		return fmt.Errorf("step_threshold must be 0 or positive")
+	}
+	return nil
+}
+
+// piServoCfg returns PI servo config with candidate parameters applied on top of the defaults
+func (c *ShadowServoConfig) piServoCfg() *servo.PiServoCfg {
+	cfg := servo.DefaultPiServoCfg()
+	if c.KpScale != 0 {
+		cfg.PiKpScale = c.KpScale
+	}
+	if c.KiScale != 0 {
+		cfg.PiKiScale = c.KiScale
+	}
+	if c.KpNormMax != 0 {
+		cfg.PiKpNormMax = c.KpNormMax
+	}
+	if c.KiNormMax != 0 {
+		cfg.PiKiNormMax = c.KiNormMax
+	}
+	return cfg
+}
+
+// newShadowServo creates shadow PI servo with candidate parameters, starting from current clock frequency like the active one
+func newShadowServo(cfg *ShadowServoConfig, clock Clock, firstStepThreshold time.Duration) (*servo.PiServo, error) {
+	freq, err := clock.FrequencyPPB()
+	if err != nil {
+		return nil, err
+	}
+	servoCfg := servo.DefaultServoConfig()
+	if firstStepThreshold != 0 {
+		servoCfg.FirstUpdate = true
+		servoCfg.FirstStepThreshold = int64(firstStepThreshold)
+	}
+	servoCfg.StepThreshold = int64(cfg.StepThreshold)
+	pi := servo.NewPiServo(servoCfg, cfg.piServoCfg(), -freq)
+	if maxFreq, err := clock.MaxFreqPPB(); err == nil {
+		pi.SetMaxFreq(maxFreq)
+	}
+	servo.NewPiServoFilter(pi, servo.DefaultPiServoFilterCfg())
+	return pi, nil
+}
+
+// sampleShadow feeds the sample the active servo got into the shadow servo,
+// and reports what shadow servo would have done compared to what the active one did
+func (p *SPTP) sampleShadow(offset time.Duration, ts time.Time, freqAdj float64, state servo.State) {
+	shadowFreqAdj, shadowState := p.shadow.Sample(int64(offset), uint64(ts.UnixNano()))
+	servoLog.Infof("shadow servo: s%d freq %+7.0f, active servo: s%d freq %+7.0f, diff %+7.0f", shadowState, shadowFreqAdj, state, freqAdj, shadowFreqAdj-freqAdj)
+	p.stats.SetCounter("ptp.sptp.shadow.state", int64(shadowState))
+	p.stats.SetCounter("ptp.sptp.shadow.freq_ppb", int64(-1*shadowFreqAdj))
+	p.stats.SetCounter("ptp.sptp.shadow.freq_diff_ppb", int64(freqAdj-shadowFreqAdj))
+}
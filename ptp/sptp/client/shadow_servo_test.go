@@ -0,0 +1,143 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/servo"
+)
+
+func TestShadowServoConfigValidate(t *testing.T) {
+	c := &ShadowServoConfig{KpScale: -1}
+	require.NoError(t, c.Validate(), "disabled config is not validated")
+	c = &ShadowServoConfig{Enabled: true}
+	require.NoError(t, c.Validate())
+	c = &ShadowServoConfig{Enabled: true, KpScale: 0.5, KiScale: 0.1, KpNormMax: 0.8, KiNormMax: 1.5, StepThreshold: time.Millisecond}
+	require.NoError(t, c.Validate())
+	c = &ShadowServoConfig{Enabled: true, KiScale: -0.1}
+	require.Error(t, c.Validate())
+	c = &ShadowServoConfig{Enabled: true, KpNormMax: -1}
+	require.Error(t, c.Validate())
+	c = &ShadowServoConfig{Enabled: true, StepThreshold: -time.Second}
+	require.Error(t, c.Validate())
+}
+
+func TestShadowServoPiServoCfg(t *testing.T) {
+	c := &ShadowServoConfig{Enabled: true}
+	require.Equal(t, servo.DefaultPiServoCfg(), c.piServoCfg())
+
+	c = &ShadowServoConfig{Enabled: true, KpScale: 0.5, KiNormMax: 1.5}
+	want := servo.DefaultPiServoCfg()
+	want.PiKpScale = 0.5
+	want.PiKiNormMax = 1.5
+	require.Equal(t, want, c.piServoCfg())
+}
+
+func TestInitServoShadow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockClock.EXPECT().FrequencyPPB().Return(12.3, nil).Times(3)
+	mockClock.EXPECT().MaxFreqPPB().Return(500000.0, nil).Times(3)
+
+	cfg := DefaultConfig()
+	p := &SPTP{clock: mockClock, cfg: cfg}
+	require.NoError(t, p.initServo())
+	require.Nil(t, p.shadow)
+
+	cfg.ShadowServo = ShadowServoConfig{Enabled: true, KpScale: 0.5}
+	require.NoError(t, p.initServo())
+	require.NotNil(t, p.shadow)
+	require.IsType(t, &servo.PiServo{}, p.shadow)
+}
+
+func TestProcessResultsShadowServo(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockServo := NewMockServo(ctrl)
+	mockShadow := NewMockServo(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	counters := map[string]int64{}
+	mockStatsServer.EXPECT().SetCounter(gomock.Any(), gomock.Any()).Do(func(key string, val int64) { counters[key] = val }).AnyTimes()
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).AnyTimes()
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	p := &SPTP{
+		clock:  mockClock,
+		pi:     mockServo,
+		shadow: mockShadow,
+		stats:  mockStatsServer,
+		cfg:    cfg,
+	}
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    100 * time.Nanosecond,
+				Timestamp: ts,
+			},
+		},
+	}
+	require.NoError(t, p.initClients())
+
+	// both servos get the same sample, only the active one adjusts the clock
+	mockServo.EXPECT().Sample(int64(100), uint64(ts.UnixNano())).Return(12.0, servo.StateLocked)
+	mockShadow.EXPECT().Sample(int64(100), uint64(ts.UnixNano())).Return(42.0, servo.StateLocked)
+	mockClock.EXPECT().AdjFreqPPB(-12.0).Return(nil)
+	p.processResults(results)
+	require.True(t, p.synced)
+	require.Equal(t, int64(servo.StateLocked), counters["ptp.sptp.shadow.state"])
+	require.Equal(t, int64(-42), counters["ptp.sptp.shadow.freq_ppb"])
+	require.Equal(t, int64(-30), counters["ptp.sptp.shadow.freq_diff_ppb"])
+
+	// shadow servo wants to step, but it never touches the clock
+	mockServo.EXPECT().Sample(int64(100), gomock.Any()).Return(12.0, servo.StateLocked)
+	mockShadow.EXPECT().Sample(int64(100), gomock.Any()).Return(0.0, servo.StateJump)
+	mockClock.EXPECT().AdjFreqPPB(-12.0).Return(nil)
+	p.processResults(results)
+	require.Equal(t, int64(servo.StateJump), counters["ptp.sptp.shadow.state"])
+}
+
+func TestSyncIntervalShadow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockServo := NewMockServo(ctrl)
+	mockShadow := NewMockServo(ctrl)
+	cfg := DefaultConfig()
+	cfg.Interval = 2 * time.Second
+
+	p := &SPTP{pi: mockServo, cfg: cfg}
+	mockServo.EXPECT().SyncInterval(2.0)
+	p.syncInterval()
+
+	p.shadow = mockShadow
+	mockServo.EXPECT().SyncInterval(2.0)
+	mockShadow.EXPECT().SyncInterval(2.0)
+	p.syncInterval()
+}
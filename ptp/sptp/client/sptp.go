@@ -21,7 +21,10 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -30,6 +33,7 @@ import (
 
 	"github.com/facebook/time/phc"
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/sptp/bmc"
 	"github.com/facebook/time/servo"
 	"github.com/facebook/time/timestamp"
 )
@@ -47,22 +51,68 @@ type SPTP struct {
 	cfg *Config
 
 	pi Servo
+	// optional servo evaluating candidate parameters, never touches the clock
+	shadow Servo
 
 	stats StatsServer
 
 	clock Clock
 
 	bestGM string
+	// if we have adjusted the clock at least once
+	synced bool
 
 	clients    map[string]*Client
 	priorities map[string]int
 	backoff    map[string]*backoff
 	lastTick   time.Time
+	// total GC pause as of last tick
+	lastGCPause uint64
+	// how many times listener workers were restarted after read errors
+	listenerRestarts int64
+	// GMs with intervals longer than default are polled every Nth tick
+	pollEvery   map[string]int
+	lastResults map[string]*RunResult
+	ticks       int
+	// on-demand burst requests, and GM we are running burst with, handled by the main loop
+	burstReqs chan *burstRequest
+	burstDone chan string
+	bursting  string
+	// manual clock control, nil unless configured, and its requests handled by the main loop
+	maintenance     *maintenance
+	maintenanceReqs chan *maintenanceRequest
+
+	// optional structured log of every exchange
+	mlog *measurementLog
+	// BMCA comparator of configured profile
+	compare bmc.Comparator
+	// optional path delay based tie-break for BMCA
+	proximity *proximity
+	// optional check of best GM against the rest of GMs
+	consensus *consensus
+	// optional foreign master qualification of GMs before BMCA
+	foreign *ptp.ForeignMasterDS
+	// stops us from touching the clock, nil if we can't be drained
+	drain   *drain
+	drained bool
+	// reports system clock offset from PHC and optionally disciplines it, nil without HW timestamps
+	phc2sys *phc2sys
+	// measures offset of the PHC we discipline from the one timestamping packets, nil unless they differ
+	bridge *bridge
+	// arms kernel leap second state of system clock, nil unless configured
+	leap *leapArmer
+	// keeps kernel TAI offset in line with best master, nil unless configured
+	tai *taiKeeper
 
 	clockID ptp.ClockIdentity
 	genConn UDPConn
-	// listening connection on port 319
+	// listening connection on event port, 319 by default
 	eventConn UDPConnWithTS
+	// raw socket for servers we talk to over IEEE 802.3, nil if there are none
+	l2Conn UDPConnWithTS
+	// packets exchanged during last capture window, nil unless configured
+	capture          *captureRing
+	captureEndpoints *captureEndpoints
 }
 
 // NewSPTP creates SPTP client
@@ -70,6 +120,7 @@ func NewSPTP(cfg *Config, stats StatsServer) (*SPTP, error) {
 	p := &SPTP{
 		cfg:   cfg,
 		stats: stats,
+		drain: newDrain(cfg.DrainFile),
 	}
 	if err := p.init(); err != nil {
 		return nil, err
@@ -77,6 +128,13 @@ func NewSPTP(cfg *Config, stats StatsServer) (*SPTP, error) {
 	if err := p.initClients(); err != nil {
 		return nil, err
 	}
+	if cfg.Maintenance.TokenFile != "" {
+		m, err := newMaintenance(&cfg.Maintenance)
+		if err != nil {
+			return nil, err
+		}
+		p.maintenance = m
+	}
 	return p, nil
 }
 
@@ -84,16 +142,96 @@ func (p *SPTP) initClients() error {
 	p.clients = map[string]*Client{}
 	p.priorities = map[string]int{}
 	p.backoff = map[string]*backoff{}
+	p.pollEvery = map[string]int{}
+	p.lastResults = map[string]*RunResult{}
+	p.burstReqs = make(chan *burstRequest)
+	// only one burst runs at a time, so it never blocks
+	p.burstDone = make(chan string, 1)
+	p.maintenanceReqs = make(chan *maintenanceRequest)
+	p.compare = p.cfg.Comparator()
+	if p.cfg.Proximity.Enabled {
+		p.proximity = newProximity(&p.cfg.Proximity)
+	}
+	if p.cfg.Consensus.Enabled {
+		p.consensus = newConsensus(&p.cfg.Consensus)
+	}
+	if p.cfg.QualifyAnnounces {
+		// we poll GMs ourselves, so their announce interval is our polling interval
+		p.foreign = ptp.NewForeignMasterDS(p.cfg.LongestServerInterval())
+	}
+	latency := p.cfg.IfaceLatency(p.cfg.Iface)
+	if latency != (NICLatency{}) {
+		log.Infof("correcting timestamps on %s by NIC latency: ingress %v, egress %v", p.cfg.Iface, latency.Ingress, latency.Egress)
+	}
 	for server, prio := range p.cfg.Servers {
 		// normalize the address
-		ns := net.ParseIP(server).String()
-		c, err := newClient(ns, p.clockID, p.eventConn, &p.cfg.Measurement, p.stats)
+		var c *Client
+		var ns string
+		if p.cfg.Transport(server) == TransportL2 {
+			mac, err := net.ParseMAC(server)
+			if err != nil {
+				return fmt.Errorf("initializing L2 client %q: %w", server, err)
+			}
+			ns = mac.String()
+			c = newL2Client(mac, p.clockID, p.l2Conn, &p.cfg.Measurement, p.stats)
+		} else {
+			ns = net.ParseIP(server).String()
+			var err error
+			c, err = newClient(ns, p.cfg.ServerEventPort(server), p.clockID, p.eventConn, &p.cfg.Measurement, p.stats)
+			if err != nil {
+				return fmt.Errorf("initializing client %q: %w", ns, err)
+			}
+		}
+		c.fallbackTXTS = p.cfg.FallbackTXTS
+		c.m.latency = latency
+		c.hybrid = p.cfg.Transport(server) == TransportHybrid
+		c.domain = uint8(p.cfg.ServerDomain(server))
+		auth, err := newAuthenticator(&p.cfg.Authentication, server)
 		if err != nil {
-			return fmt.Errorf("initializing client %q: %w", ns, err)
+			return fmt.Errorf("initializing authentication for %q: %w", ns, err)
+		}
+		c.auth = auth
+		if p.cfg.UnicastNegotiation.Enabled {
+			if err := c.enableNegotiation(p.genConn, p.cfg.ServerGeneralPort(server), &p.cfg.UnicastNegotiation, p.cfg.Interval); err != nil {
+				return fmt.Errorf("enabling unicast negotiation for %q: %w", ns, err)
+			}
 		}
 		p.clients[ns] = c
 		p.priorities[ns] = prio
 		p.backoff[ns] = newBackoff(p.cfg.Backoff)
+		if p.cfg.Interval > 0 {
+			p.pollEvery[ns] = int(p.cfg.ServerInterval(server) / p.cfg.Interval)
+		}
+	}
+	return nil
+}
+
+// enableTimestamps enables HW or SW timestamps on the socket according to config
+func (p *SPTP) enableTimestamps(connFd int, name string) error {
+	switch p.cfg.Timestamping {
+	case "": // auto-detection
+		if err := timestamp.EnableHWTimestamps(connFd, p.cfg.Iface); err != nil {
+			// only fall back if NIC can't do it, otherwise something is wrong with the setup
+			if !errors.Is(err, timestamp.ErrNoHWSupport) {
+				return fmt.Errorf("failed to enable hardware timestamps on %s: %w", name, err)
+			}
+			if err := timestamp.EnableSWTimestamps(connFd); err != nil {
+				return fmt.Errorf("failed to enable timestamps on %s: %w", name, err)
+			}
+			networkLog.Warningf("Failed to enable hardware timestamps on %s, falling back to software timestamps: %v", name, err)
+		} else {
+			networkLog.Infof("Using hardware timestamps")
+		}
+	case HWTIMESTAMP:
+		if err := timestamp.EnableHWTimestamps(connFd, p.cfg.Iface); err != nil {
+			return fmt.Errorf("failed to enable hardware timestamps on %s: %w", name, err)
+		}
+	case SWTIMESTAMP:
+		if err := timestamp.EnableSWTimestamps(connFd); err != nil {
+			return fmt.Errorf("failed to enable software timestamps on %s: %w", name, err)
+		}
+	default:
+		return fmt.Errorf("unknown type of typestamping: %q", p.cfg.Timestamping)
 	}
 	return nil
 }
@@ -110,14 +248,20 @@ func (p *SPTP) init() error {
 	}
 	p.clockID = cid
 
+	if p.cfg.BindDevice != "" {
+		if _, err := net.InterfaceByName(p.cfg.BindDevice); err != nil {
+			return fmt.Errorf("unable to find device %q to bind to: %w", p.cfg.BindDevice, err)
+		}
+		networkLog.Infof("binding sockets to device %s", p.cfg.BindDevice)
+	}
 	// bind to general port
-	genConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: ptp.PortGeneral})
+	genConn, err := listenUDP(p.cfg.ListenGeneralPort(), p.cfg.BindDevice)
 	if err != nil {
 		return err
 	}
 	p.genConn = genConn
 	// bind to event port
-	eventConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: ptp.PortEvent})
+	eventConn, err := listenUDP(p.cfg.ListenEventPort(), p.cfg.BindDevice)
 	if err != nil {
 		return err
 	}
@@ -135,26 +279,8 @@ func (p *SPTP) init() error {
 	}
 
 	// we need to enable HW or SW timestamps on event port
-	switch p.cfg.Timestamping {
-	case "": // auto-detection
-		if err = timestamp.EnableHWTimestamps(connFd, p.cfg.Iface); err != nil {
-			if err = timestamp.EnableSWTimestamps(connFd); err != nil {
-				return fmt.Errorf("failed to enable timestamps on port %d: %w", ptp.PortEvent, err)
-			}
-			log.Warningf("Failed to enable hardware timestamps on port %d, falling back to software timestamps", ptp.PortEvent)
-		} else {
-			log.Infof("Using hardware timestamps")
-		}
-	case HWTIMESTAMP:
-		if err = timestamp.EnableHWTimestamps(connFd, p.cfg.Iface); err != nil {
-			return fmt.Errorf("failed to enable hardware timestamps on port %d: %w", ptp.PortEvent, err)
-		}
-	case SWTIMESTAMP:
-		if err = timestamp.EnableSWTimestamps(connFd); err != nil {
-			return fmt.Errorf("failed to enable software timestamps on port %d: %w", ptp.PortEvent, err)
-		}
-	default:
-		return fmt.Errorf("unknown type of typestamping: %q", p.cfg.Timestamping)
+	if err := p.enableTimestamps(connFd, fmt.Sprintf("port %d", p.cfg.ListenEventPort())); err != nil {
+		return err
 	}
 	// set it to blocking mode, otherwise recvmsg will just return with nothing most of the time
 	if err = unix.SetNonblock(connFd, false); err != nil {
@@ -162,12 +288,41 @@ func (p *SPTP) init() error {
 	}
 	p.eventConn = newUDPConnTS(eventConn, connFd)
 
+	// Sync goes to event port, FollowUp and Announce to general port
+	if v4, v6 := p.cfg.multicastFamilies(); v4 || v6 {
+		genFd, err := timestamp.ConnFd(genConn)
+		if err != nil {
+			return err
+		}
+		for _, fd := range []int{connFd, genFd} {
+			if err := joinMulticast(fd, iface, v4, v6); err != nil {
+				return err
+			}
+		}
+		networkLog.Infof("joined PTP multicast groups on %s", iface.Name)
+	}
+
+	// raw socket is only needed if we talk to any server over L2
+	if p.cfg.hasL2Servers() {
+		l2Conn, err := newL2ConnTS(iface)
+		if err != nil {
+			return err
+		}
+		if err := p.enableTimestamps(l2Conn.connFd, "L2 socket"); err != nil {
+			return err
+		}
+		p.l2Conn = l2Conn
+	}
+	if p.cfg.Capture.Window > 0 {
+		p.initCapture(iface)
+	}
+
 	// Configure TX timestamp attempts and timemouts
 	timestamp.AttemptsTXTS = p.cfg.AttemptsTXTS
 	timestamp.TimeoutTXTS = p.cfg.TimeoutTXTS
 
 	if p.cfg.FreeRunning {
-		log.Warningf("operating in FreeRunning mode, will NOT adjust clock")
+		servoLog.Warningf("operating in FreeRunning mode, will NOT adjust clock")
 		p.clock = &FreeRunningClock{}
 	} else {
 		if p.cfg.Timestamping == HWTIMESTAMP {
@@ -176,104 +331,246 @@ func (p *SPTP) init() error {
 				return err
 			}
 			p.clock = phcDev
+			if p.cfg.Bridge.Device != "" {
+				servoLog.Infof("will discipline %s bridging offsets from %s", p.cfg.Bridge.Device, phcDev.devicePath)
+				p.bridge = newBridge(&p.cfg.Bridge, phcDev.devicePath, p.stats)
+				p.clock = &PHC{devicePath: p.cfg.Bridge.Device}
+			}
 		} else {
-			p.clock = &SysClock{}
+			p.clock = newSysClock()
 		}
 	}
 
-	freq, err := p.clock.FrequencyPPB()
-	log.Debugf("starting PHC frequency: %v", freq)
+	if err := p.initServo(); err != nil {
+		return err
+	}
+	if p.cfg.ServoState.Path != "" {
+		p.warmStartServo()
+	}
+
+	// always report how far system clock is from PHC, even if we don't discipline it
+	if p.cfg.Timestamping == HWTIMESTAMP {
+		device, err := phc.IfaceToPHCDevice(p.cfg.Iface)
+		if err != nil {
+			return fmt.Errorf("failed to map iface to device: %w", err)
+		}
+		// system clock follows the PHC we discipline
+		if p.cfg.Bridge.Device != "" {
+			device = p.cfg.Bridge.Device
+		}
+		if p.cfg.Phc2Sys.Enabled {
+			servoLog.Infof("will discipline system clock from %s", device)
+		}
+		p.phc2sys = newPhc2Sys(&p.cfg.Phc2Sys, p.cfg.Interval, device, p.stats)
+	}
+
+	if p.cfg.ArmLeapSecond {
+		p.leap = newLeapArmer(&SysClock{})
+	}
+
+	if p.cfg.MaintainTAIOffset {
+		p.tai = newTAIKeeper(&SysClock{})
+	}
+
+	if p.cfg.MeasurementLog.Path != "" {
+		log.Infof("writing measurement log to %s", p.cfg.MeasurementLog.Path)
+		var err error
+		p.mlog, err = newMeasurementLog(&p.cfg.MeasurementLog)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initServo creates new servo starting from current clock frequency
+func (p *SPTP) initServo() error {
+	pi, err := newServo(p.clock, p.cfg.FirstStepThreshold)
 	if err != nil {
 		return err
 	}
+	p.pi = pi
+	if !p.cfg.ShadowServo.Enabled {
+		return nil
+	}
+	shadow, err := newShadowServo(&p.cfg.ShadowServo, p.clock, p.cfg.FirstStepThreshold)
+	if err != nil {
+		return err
+	}
+	p.shadow = shadow
+	return nil
+}
+
+// syncInterval sets servo sync interval, for shadow servo as well
+func (p *SPTP) syncInterval() {
+	p.pi.SyncInterval(p.cfg.Interval.Seconds())
+	if p.shadow != nil {
+		p.shadow.SyncInterval(p.cfg.Interval.Seconds())
+	}
+}
+
+// warmStartServo starts servo from state saved on previous exit, if there is one
+func (p *SPTP) warmStartServo() {
+	pi, ok := p.pi.(*servo.PiServo)
+	if !ok {
+		return
+	}
+	st, err := readServoState(&p.cfg.ServoState, p.cfg.Iface, time.Now())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			servoLog.Warningf("not using saved servo state: %v", err)
+		}
+		return
+	}
+	servoLog.Infof("warm starting servo with saved freq %v", st.Freq)
+	pi.WarmStart(st)
+}
+
+// saveServoState saves servo state on exit, so we can warm start next time
+func (p *SPTP) saveServoState() {
+	pi, ok := p.pi.(*servo.PiServo)
+	if !ok || !p.synced {
+		return
+	}
+	if err := writeServoState(p.cfg.ServoState.Path, p.cfg.Iface, time.Now(), pi.State()); err != nil {
+		servoLog.Errorf("failed to save servo state: %v", err)
+	}
+}
+
+// newServo creates PI servo for the clock, starting from its current frequency
+func newServo(clock Clock, firstStepThreshold time.Duration) (*servo.PiServo, error) {
+	freq, err := clock.FrequencyPPB()
+	servoLog.Debugf("starting PHC frequency: %v", freq)
+	if err != nil {
+		return nil, err
+	}
 
 	servoCfg := servo.DefaultServoConfig()
 	// update first step threshold if it's configured
-	if p.cfg.FirstStepThreshold != 0 {
+	if firstStepThreshold != 0 {
 		// allow stepping clock on first update
 		servoCfg.FirstUpdate = true
-		servoCfg.FirstStepThreshold = int64(p.cfg.FirstStepThreshold)
+		servoCfg.FirstStepThreshold = int64(firstStepThreshold)
 	}
 	pi := servo.NewPiServo(servoCfg, servo.DefaultPiServoCfg(), -freq)
-	maxFreq, err := p.clock.MaxFreqPPB()
+	maxFreq, err := clock.MaxFreqPPB()
 	if err != nil {
-		log.Warningf("max PHC frequency error: %v", err)
+		servoLog.Warningf("max PHC frequency error: %v", err)
 		maxFreq = phc.DefaultMaxClockFreqPPB
 	} else {
 		pi.SetMaxFreq(maxFreq)
 	}
-	log.Debugf("max PHC frequency: %v", maxFreq)
+	servoLog.Debugf("max PHC frequency: %v", maxFreq)
 	piFilterCfg := servo.DefaultPiServoFilterCfg()
 	servo.NewPiServoFilter(pi, piFilterCfg)
-	p.pi = pi
-	return nil
+	return pi, nil
 }
 
-// RunListener starts a listener, must be run before any client-server interactions happen
-func (p *SPTP) RunListener(ctx context.Context) error {
-	eg, ctx := errgroup.WithContext(ctx)
-	// get packets from general port
-	eg.Go(func() error {
-		// it's done in non-blocking way, so if context is cancelled we exit correctly
-		doneChan := make(chan error, 1)
-		go func() {
-			for {
-				response := make([]uint8, 1024)
-				n, addr, err := p.genConn.ReadFromUDP(response)
-				if err != nil {
-					doneChan <- err
-					return
-				}
-				if addr == nil {
-					doneChan <- fmt.Errorf("received packet on port 320 with nil source address")
-					return
-				}
-				log.Debugf("got packet on port 320, n = %v, addr = %v", n, addr)
-				cc, found := p.clients[addr.IP.String()]
-				if !found {
-					log.Warningf("ignoring packets from server %v", addr)
-					continue
-				}
-				cc.inChan <- &inPacket{data: response[:n]}
+// dispatch hands packet received from the server over to its client, never blocking the listener
+func (p *SPTP) dispatch(server string, pkt *inPacket) {
+	cc, found := p.clients[server]
+	if !found {
+		networkLog.Warningf("ignoring packets from server %v", server)
+		return
+	}
+	if cc.rx.push(pkt) {
+		networkLog.Debugf("RX queue for server %v is full, dropped oldest packet", server)
+	}
+}
+
+// maxListenerRestarts is how many times listener workers of a socket are restarted after read errors before we give up
+const maxListenerRestarts = 10
+
+// listen runs pool of workers reading from the same socket with read.
+// Failed workers are restarted and counted in restarts, until maxListenerRestarts is used up and the error is returned.
+// It's done in non-blocking way, so if context is cancelled we exit correctly
+func listen(ctx context.Context, name string, workers int, restarts *int64, read func() error) error {
+	doneChan := make(chan error, workers)
+	worker := func() {
+		for {
+			if err := read(); err != nil {
+				doneChan <- err
+				return
 			}
-		}()
+		}
+	}
+	for i := 0; i < workers; i++ {
+		go worker()
+	}
+	budget := maxListenerRestarts
+	for {
 		select {
 		case <-ctx.Done():
-			log.Debugf("cancelled general port receiver")
+			networkLog.Debugf("cancelled %s receiver", name)
 			return ctx.Err()
 		case err := <-doneChan:
-			return err
+			if budget == 0 {
+				return err
+			}
+			budget--
+			atomic.AddInt64(restarts, 1)
+			networkLog.Warningf("restarting %s receiver after error: %v", name, err)
+			go worker()
 		}
+	}
+}
+
+// RunListener starts a listener, must be run before any client-server interactions happen
+func (p *SPTP) RunListener(ctx context.Context) error {
+	// every socket is read by at least one worker
+	workers := p.cfg.ListenerWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	eg, ctx := errgroup.WithContext(ctx)
+	// get packets from general port
+	eg.Go(func() error {
+		return listen(ctx, "general port", workers, &p.listenerRestarts, func() error {
+			response := make([]uint8, 1024)
+			n, addr, err := p.genConn.ReadFromUDP(response)
+			if err != nil {
+				return err
+			}
+			if addr == nil {
+				return fmt.Errorf("received packet on port %d with nil source address", p.cfg.ListenGeneralPort())
+			}
+			networkLog.Debugf("got packet on port %d, n = %v, addr = %v", p.cfg.ListenGeneralPort(), n, addr)
+			p.dispatch(addr.IP.String(), &inPacket{data: response[:n]})
+			return nil
+		})
 	})
 	// get packets from event port
 	eg.Go(func() error {
-		// it's done in non-blocking way, so if context is cancelled we exit correctly
-		doneChan := make(chan error, 1)
-		go func() {
-			for {
-				response, addr, rxtx, err := p.eventConn.ReadPacketWithRXTimestamp()
+		return listen(ctx, "event port", workers, &p.listenerRestarts, func() error {
+			response, addr, rxtx, err := p.eventConn.ReadPacketWithRXTimestamp()
+			if err != nil {
+				return err
+			}
+			networkLog.Debugf("got packet on port %d, addr = %v", p.cfg.ListenEventPort(), addr)
+			ip := timestamp.SockaddrToIP(addr)
+			p.dispatch(ip.String(), &inPacket{data: response, ts: rxtx})
+			return nil
+		})
+	})
+	// get packets from L2 socket, both event and general messages come here
+	if p.l2Conn != nil {
+		eg.Go(func() error {
+			return listen(ctx, "L2", workers, &p.listenerRestarts, func() error {
+				response, addr, rxtx, err := p.l2Conn.ReadPacketWithRXTimestamp()
 				if err != nil {
-					doneChan <- err
-					return
+					return err
 				}
-				log.Debugf("got packet on port 319, addr = %v", addr)
-				ip := timestamp.SockaddrToIP(addr)
-				cc, found := p.clients[ip.String()]
-				if !found {
-					log.Warningf("ignoring packets from server %v", ip)
-					continue
+				// packet socket sees our own frames as well
+				if ll, ok := addr.(*unix.SockaddrLinklayer); ok && ll.Pkttype == unix.PACKET_OUTGOING {
+					return nil
 				}
-				cc.inChan <- &inPacket{data: response, ts: rxtx}
-			}
-		}()
-		select {
-		case <-ctx.Done():
-			log.Debugf("cancelled event port receiver")
-			return ctx.Err()
-		case err := <-doneChan:
-			return err
-		}
-	})
+				mac := SockaddrToMAC(addr)
+				networkLog.Debugf("got packet on L2 socket, addr = %v", mac)
+				p.dispatch(mac.String(), &inPacket{data: response, ts: rxtx})
+				return nil
+			})
+		})
+	}
 
 	return eg.Wait()
 }
@@ -281,16 +578,28 @@ func (p *SPTP) RunListener(ctx context.Context) error {
 func (p *SPTP) handleExchangeError(addr string, err error) {
 	if errors.Is(err, errBackoff) {
 		b := p.backoff[addr].tick()
-		log.Debugf("backoff %s: %d seconds", addr, b)
+		protocolLog.Debugf("backoff %s: %d seconds", addr, b)
 	} else {
-		log.Errorf("result %s: %+v", addr, err)
+		protocolLog.Errorf("result %s: %+v", addr, err)
 		b := p.backoff[addr].bump()
 		if b != 0 {
-			log.Warningf("backoff %s: extended by %d", addr, b)
+			protocolLog.Warningf("backoff %s: extended by %d", addr, b)
 		}
 	}
 }
 
+// clockClassRefused returns error if GM announces clock class worse than we accept
+func (p *SPTP) clockClassRefused(res *RunResult) error {
+	if p.cfg.MaxClockClass == 0 || res.Error != nil || res.Measurement == nil {
+		return nil
+	}
+	class := res.Measurement.Announce.GrandmasterClockQuality.ClockClass
+	if int(class) > p.cfg.MaxClockClass {
+		return fmt.Errorf("clock class %d is worse than maxclockclass %d", class, p.cfg.MaxClockClass)
+	}
+	return nil
+}
+
 func (p *SPTP) processResults(results map[string]*RunResult) {
 	now := time.Now()
 	if !p.lastTick.IsZero() {
@@ -301,28 +610,89 @@ func (p *SPTP) processResults(results map[string]*RunResult) {
 			log.Warningf("tick took %vms, which is outside of expected +-10%% from the interval %vms", tickDuration.Milliseconds(), p.cfg.Interval.Milliseconds())
 		}
 		p.stats.SetCounter("ptp.sptp.tick_duration_ns", int64(tickDuration))
+		// GC stops the world, and long pauses show up as tick jitter
+		gcPause := gcPauseTotal()
+		p.stats.SetCounter("ptp.sptp.tick_gc_pause_ns", int64(gcPause-p.lastGCPause))
+		p.lastGCPause = gcPause
+		p.stats.SetCounter("ptp.sptp.listener.restarts", atomic.LoadInt64(&p.listenerRestarts))
+	} else {
+		p.lastGCPause = gcPauseTotal()
 	}
 	p.lastTick = now
+	var logEntries map[string]*MeasurementLogEntry
+	if p.mlog != nil {
+		logEntries = make(map[string]*MeasurementLogEntry, len(results))
+		defer p.writeMeasurementLog(logEntries)
+	}
 	gmsTotal := len(results)
 	gmsAvailable := 0
 	announces := []*ptp.Announce{}
 	idsToClients := map[ptp.ClockIdentity]string{}
 	localPrioMap := map[ptp.ClockIdentity]int{}
+	// offsets to GMs considered for best master, measured this tick
+	var offsets map[string]time.Duration
+	if p.consensus != nil {
+		offsets = map[string]time.Duration{}
+	}
+	if p.foreign != nil {
+		p.foreign.Expire(now)
+	}
 	for addr, res := range results {
 		s := runResultToStats(addr, res, p.priorities[addr], addr == p.bestGM)
+		refused := p.clockClassRefused(res)
+		if refused != nil {
+			s.Error = refused.Error()
+		}
+		if c, found := p.clients[addr]; found {
+			s.TXTSAttempts, s.TXTSFailures = c.txtsStats()
+			s.TXTSTimeouts, s.TXTSDriverBugs = c.txtsFailureStats()
+			s.RXDrops = c.rx.drops()
+			s.RXQueueLen = c.rx.len()
+			s.Domain = int(c.domain)
+		}
 		p.stats.SetGMStats(s)
+		if logEntries != nil && !res.stale {
+			logEntries[addr] = newMeasurementLogEntry(now, addr, res)
+		}
 		if res.Error == nil {
-			p.backoff[addr].reset()
-			log.Debugf("result %s: %+v", addr, res.Measurement)
+			if !res.stale {
+				p.backoff[addr].reset()
+				protocolLog.Debugf("result %s: %+v", addr, res.Measurement)
+			}
 		} else {
-			p.handleExchangeError(addr, res.Error)
+			if !res.stale {
+				p.handleExchangeError(addr, res.Error)
+			}
 			continue
 		}
 		if res.Measurement == nil {
-			log.Errorf("result for %s is missing Measurement", addr)
+			protocolLog.Errorf("result for %s is missing Measurement", addr)
+			continue
+		}
+		if refused != nil {
+			if !res.stale {
+				protocolLog.Warningf("not considering %s for best master: %v", addr, refused)
+			}
 			continue
 		}
+		if p.foreign != nil {
+			if !res.stale {
+				p.foreign.Add(&res.Measurement.Announce, now)
+			}
+			if !p.foreign.IsQualified(res.Measurement.Announce.SourcePortIdentity, now) {
+				if !res.stale {
+					protocolLog.Infof("not considering %s for best master: not qualified yet", addr)
+				}
+				continue
+			}
+		}
 		gmsAvailable++
+		if p.proximity != nil && !res.stale {
+			p.proximity.add(addr, res.Measurement.Delay)
+		}
+		if offsets != nil && !res.stale {
+			offsets[addr] = res.Measurement.Offset
+		}
 		announces = append(announces, &res.Measurement.Announce)
 		idsToClients[res.Measurement.Announce.GrandmasterIdentity] = addr
 		localPrioMap[res.Measurement.Announce.GrandmasterIdentity] = p.priorities[addr]
@@ -333,71 +703,270 @@ func (p *SPTP) processResults(results map[string]*RunResult) {
 	} else {
 		p.stats.SetCounter("ptp.sptp.gms.available_pct", int64(0))
 	}
-	best := bmca(announces, localPrioMap)
+	var tieBreak func(a, b *ptp.Announce) bmc.ComparisonResult
+	if p.proximity != nil {
+		tieBreak = func(a, b *ptp.Announce) bmc.ComparisonResult {
+			return p.proximity.compare(idsToClients[a.GrandmasterIdentity], idsToClients[b.GrandmasterIdentity])
+		}
+	}
+	best := bmcaDomains(announces, localPrioMap, p.cfg.DomainPriority, p.compare, tieBreak)
 	if best == nil {
-		log.Warningf("no Best Master selected")
+		protocolLog.Warningf("no Best Master selected")
 		p.bestGM = ""
 		return
 	}
 	bestAddr := idsToClients[best.GrandmasterIdentity]
+	if p.consensus != nil {
+		bestAddr = p.checkConsensus(bestAddr, offsets, announces, idsToClients, localPrioMap, tieBreak)
+	}
 	bm := results[bestAddr].Measurement
 	if p.bestGM != bestAddr {
-		log.Warningf("new best master selected: %q (%s)", bestAddr, bm.Announce.GrandmasterIdentity)
+		protocolLog.Warningf("new best master selected: %q (%s) in domain %d", bestAddr, bm.Announce.GrandmasterIdentity, bm.Announce.DomainNumber)
 		p.bestGM = bestAddr
 	}
-	log.Debugf("best master %q (%s)", bestAddr, bm.Announce.GrandmasterIdentity)
-	freqAdj, state := p.pi.Sample(int64(bm.Offset), uint64(bm.Timestamp.UnixNano()))
-	log.Infof("offset %10d s%d freq %+7.0f path delay %10d", bm.Offset.Nanoseconds(), state, freqAdj, bm.Delay.Nanoseconds())
+	protocolLog.Debugf("best master %q (%s)", bestAddr, bm.Announce.GrandmasterIdentity)
+	if p.phc2sys != nil {
+		p.phc2sys.setUTCOffset(time.Duration(bm.Announce.CurrentUTCOffset) * time.Second)
+	}
+	if p.drain != nil && !p.checkDrain() {
+		servoLog.Infof("offset %10d (drained) path delay %10d", bm.Offset.Nanoseconds(), bm.Delay.Nanoseconds())
+		if p.phc2sys != nil {
+			p.phc2sys.disable()
+		}
+		return
+	}
+	if p.maintenance != nil && p.maintenance.holds() {
+		servoLog.Infof("offset %10d (manual control) path delay %10d", bm.Offset.Nanoseconds(), bm.Delay.Nanoseconds())
+		return
+	}
+	if p.leap != nil {
+		if err := p.leap.update(leapFromAnnounce(&bm.Announce)); err != nil {
+			servoLog.Errorf("failed to arm leap second: %v", err)
+		}
+	}
+	if p.tai != nil {
+		if offset, ok := utcOffsetFromAnnounce(&bm.Announce); !ok {
+			servoLog.Debugf("best master doesn't announce valid UTC offset, leaving kernel TAI offset as is")
+		} else if err := p.tai.update(offset); err != nil {
+			servoLog.Errorf("failed to update kernel TAI offset: %v", err)
+		}
+	}
+	if results[bestAddr].stale {
+		// servo has already seen this measurement
+		servoLog.Debugf("best master %q was not polled this tick, leaving the clock as is", bestAddr)
+		return
+	}
+	offset := bm.Offset
+	if p.bridge != nil {
+		var err error
+		if offset, err = p.bridge.offset(bm.Offset); err != nil {
+			servoLog.Errorf("bridge: leaving the clock as is: %v", err)
+			p.stats.UpdateCounterBy("ptp.sptp.bridge.errors", 1)
+			return
+		}
+	}
+	if !p.cfg.StepPolicy.offsetAllowed(offset, p.synced) {
+		servoLog.Errorf("offset %v to best master %q exceeds max offset %v, refusing to adjust the clock", offset, bestAddr, p.cfg.StepPolicy.MaxOffset)
+		p.stats.UpdateCounterBy("ptp.sptp.clock.adjustments_refused", 1)
+		return
+	}
+	freqAdj, state := p.pi.Sample(int64(offset), uint64(bm.Timestamp.UnixNano()))
+	servoLog.Infof("offset %10d s%d freq %+7.0f path delay %10d", offset.Nanoseconds(), state, freqAdj, bm.Delay.Nanoseconds())
+	if e, ok := logEntries[bestAddr]; ok {
+		e.Selected = true
+		e.setServo(freqAdj, state)
+	}
+	if p.shadow != nil {
+		p.sampleShadow(offset, bm.Timestamp, freqAdj, state)
+	}
 	switch state {
 	case servo.StateJump:
-		if err := p.clock.Step(-1 * bm.Offset); err != nil {
-			log.Errorf("failed to step freq by %v: %v", -1*bm.Offset, err)
+		if !p.cfg.StepPolicy.stepAllowed(p.synced) {
+			servoLog.Warningf("step policy %q doesn't allow stepping clock by %v, adjusting freq instead", p.cfg.StepPolicy.Policy, -1*offset)
+			p.stats.UpdateCounterBy("ptp.sptp.clock.steps_refused", 1)
+			if err := p.clock.AdjFreqPPB(-1 * freqAdj); err != nil {
+				servoLog.Errorf("failed to adjust freq to %v: %v", -1*freqAdj, err)
+				break
+			}
+			p.synced = true
+			break
 		}
+		if err := p.clock.Step(-1 * offset); err != nil {
+			servoLog.Errorf("failed to step freq by %v: %v", -1*offset, err)
+			break
+		}
+		p.synced = true
 	case servo.StateLocked:
 		if err := p.clock.AdjFreqPPB(-1 * freqAdj); err != nil {
-			log.Errorf("failed to adjust freq to %v: %v", -1*freqAdj, err)
+			servoLog.Errorf("failed to adjust freq to %v: %v", -1*freqAdj, err)
 		}
 		if sysClk, ok := p.clock.(*SysClock); ok {
 			if err := sysClk.SetSync(); err != nil {
-				log.Errorf("failed to set sys clock sync state")
+				servoLog.Errorf("failed to set sys clock sync state")
 			}
 		}
+		p.synced = true
+	}
+	if p.synced && p.phc2sys != nil {
+		p.phc2sys.enable()
 	}
 }
 
-func (p *SPTP) runInternal(ctx context.Context) error {
-	p.pi.SyncInterval(p.cfg.Interval.Seconds())
-	var lock sync.Mutex
+// checkConsensus compares best GM with the rest of GMs and returns GM to sync to:
+// the next best one if best GM is a falseticker suspect and failover is configured, or best GM otherwise
+func (p *SPTP) checkConsensus(bestAddr string, offsets map[string]time.Duration, announces []*ptp.Announce, idsToClients map[ptp.ClockIdentity]string, localPrioMap map[ptp.ClockIdentity]int, tieBreak func(a, b *ptp.Announce) bmc.ComparisonResult) string {
+	divergence, suspect := p.consensus.check(bestAddr, offsets)
+	p.stats.SetCounter("ptp.sptp.consensus.divergence_ns", int64(divergence))
+	if !suspect {
+		p.stats.SetCounter("ptp.sptp.consensus.falseticker_suspect", 0)
+		return bestAddr
+	}
+	p.stats.SetCounter("ptp.sptp.consensus.falseticker_suspect", 1)
+	if !p.cfg.Consensus.Failover {
+		return bestAddr
+	}
+	rest := make([]*ptp.Announce, 0, len(announces))
+	for _, a := range announces {
+		if idsToClients[a.GrandmasterIdentity] != bestAddr {
+			rest = append(rest, a)
+		}
+	}
+	next := bmcaDomains(rest, localPrioMap, p.cfg.DomainPriority, p.compare, tieBreak)
+	if next == nil {
+		servoLog.Errorf("falseticker suspect %q is the only GM we can sync to", bestAddr)
+		return bestAddr
+	}
+	nextAddr := idsToClients[next.GrandmasterIdentity]
+	servoLog.Debugf("failing over from falseticker suspect %q to %q", bestAddr, nextAddr)
+	return nextAddr
+}
 
-	tick := func() {
-		eg, ictx := errgroup.WithContext(ctx)
-		results := map[string]*RunResult{}
-		for addr, c := range p.clients {
-			addr := addr
-			c := c
-			if p.backoff[addr].active() {
-				// skip talking to this GM, we are in backoff mode
-				lock.Lock()
+// checkDrain updates drain state and reports if we can discipline the clock.
+// Once undrained, servo is started over, as someone else was in charge of the clock in the meantime
+func (p *SPTP) checkDrain() bool {
+	drained := p.drain.active()
+	if drained {
+		p.stats.SetCounter("ptp.sptp.drained", 1)
+	} else {
+		p.stats.SetCounter("ptp.sptp.drained", 0)
+	}
+	if drained == p.drained {
+		return !drained
+	}
+	p.drained = drained
+	if drained {
+		servoLog.Warningf("drained, not disciplining the clock")
+		return false
+	}
+	servoLog.Warningf("undrained, starting to discipline the clock again")
+	if err := p.initServo(); err != nil {
+		servoLog.Errorf("failed to reinitialize servo: %v", err)
+		p.drained = true
+		return false
+	}
+	p.syncInterval()
+	return true
+}
+
+// writeMeasurementLog writes entries of a single tick to measurement log, sorted by GM address
+func (p *SPTP) writeMeasurementLog(entries map[string]*MeasurementLogEntry) {
+	addrs := make([]string, 0, len(entries))
+	for addr := range entries {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	sorted := make([]*MeasurementLogEntry, 0, len(entries))
+	for _, addr := range addrs {
+		sorted = append(sorted, entries[addr])
+	}
+	if err := p.mlog.Write(sorted); err != nil {
+		log.Errorf("failed to write measurement log: %v", err)
+	}
+}
+
+// pollDue reports if GM has to be polled this tick
+func (p *SPTP) pollDue(addr string) bool {
+	every := p.pollEvery[addr]
+	return every <= 1 || p.ticks%every == 0
+}
+
+// staggerDelay returns how long to wait before starting i-th of n exchanges,
+// so they are spread evenly over the interval and don't contend for TX timestamps
+func (p *SPTP) staggerDelay(i, n int) time.Duration {
+	if !p.cfg.Stagger || n == 0 {
+		return 0
+	}
+	window := p.cfg.Interval - p.cfg.ExchangeTimeout
+	return window * time.Duration(i) / time.Duration(n)
+}
+
+// exchange runs single exchange with all GMs due to be polled, skipping these in backoff.
+// GMs not polled this tick, or busy with a burst, are reported with their previous results
+func (p *SPTP) exchange(ctx context.Context) map[string]*RunResult {
+	var lock sync.Mutex
+	eg, ictx := errgroup.WithContext(ctx)
+	results := map[string]*RunResult{}
+	due := []string{}
+	for addr := range p.clients {
+		if !p.pollDue(addr) || addr == p.bursting {
+			if last, found := p.lastResults[addr]; found {
 				results[addr] = &RunResult{
-					Server: addr,
-					Error:  errBackoff,
+					Server:      addr,
+					Measurement: last.Measurement,
+					Error:       last.Error,
+					stale:       true,
 				}
-				lock.Unlock()
-				continue
 			}
-			eg.Go(func() error {
-				res := c.RunOnce(ictx, p.cfg.ExchangeTimeout)
-				lock.Lock()
-				defer lock.Unlock()
-				results[addr] = res
-				return nil
-			})
+			continue
 		}
-		err := eg.Wait()
-		if err != nil {
-			log.Errorf("run failed: %v", err)
+		if p.backoff[addr].active() {
+			// skip talking to this GM, we are in backoff mode
+			results[addr] = &RunResult{
+				Server: addr,
+				Error:  errBackoff,
+			}
+			continue
 		}
-		p.processResults(results)
+		due = append(due, addr)
+	}
+	// stagger in stable order
+	sort.Strings(due)
+	for i, addr := range due {
+		addr := addr
+		c := p.clients[addr]
+		delay := p.staggerDelay(i, len(due))
+		eg.Go(func() error {
+			var res *RunResult
+			select {
+			case <-ictx.Done():
+				res = &RunResult{Server: addr, Error: ictx.Err()}
+			case <-time.After(delay):
+				res = c.RunOnce(ictx, p.cfg.ExchangeTimeout)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			results[addr] = res
+			return nil
+		})
+	}
+	err := eg.Wait()
+	if err != nil {
+		log.Errorf("run failed: %v", err)
+	}
+	p.ticks++
+	for addr, res := range results {
+		if !res.stale {
+			p.lastResults[addr] = res
+		}
+	}
+	return results
+}
+
+func (p *SPTP) runInternal(ctx context.Context) error {
+	p.syncInterval()
+
+	tick := func() {
+		p.processResults(p.exchange(ctx))
 	}
 
 	timer := time.NewTimer(0)
@@ -405,23 +974,54 @@ func (p *SPTP) runInternal(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			log.Debugf("cancelled main loop")
-			freqAdj := p.pi.MeanFreq()
-			log.Infof("Existing, setting freq to: %v", -1*freqAdj)
-			if err := p.clock.AdjFreqPPB(-1 * freqAdj); err != nil {
-				log.Errorf("failed to adjust freq to %v: %v", -1*freqAdj, err)
+			if p.drained {
+				log.Infof("Exiting, drained so leaving the clock as is")
+			} else if p.maintenance != nil && p.maintenance.holds() {
+				log.Infof("Exiting, clock is under manual control so leaving it as is")
+				if err := p.stopSlew(); err != nil {
+					log.Error(err)
+				}
+			} else {
+				freqAdj := p.pi.MeanFreq()
+				log.Infof("Existing, setting freq to: %v", -1*freqAdj)
+				if err := p.clock.AdjFreqPPB(-1 * freqAdj); err != nil {
+					log.Errorf("failed to adjust freq to %v: %v", -1*freqAdj, err)
+				}
+				if p.cfg.ServoState.Path != "" {
+					p.saveServoState()
+				}
+			}
+			if p.mlog != nil {
+				if err := p.mlog.Close(); err != nil {
+					log.Errorf("failed to close measurement log: %v", err)
+				}
 			}
 			return ctx.Err()
 		case <-timer.C:
 			timer.Reset(p.cfg.Interval)
 			tick()
+		case req := <-p.burstReqs:
+			p.startBurst(ctx, req)
+		case <-p.burstDone:
+			p.bursting = ""
+		case req := <-p.maintenanceReqs:
+			p.handleMaintenance(req)
+		case <-p.maintenance.slewDone():
+			p.finishSlew()
 		}
 	}
 }
 
 // Run makes things run, continuously
 func (p *SPTP) Run(ctx context.Context) error {
+	if p.drain != nil {
+		go p.drain.handleSignals(ctx)
+	}
+	if p.phc2sys != nil {
+		go p.phc2sys.run(ctx)
+	}
 	go func() {
-		log.Debugf("starting listener")
+		networkLog.Debugf("starting listener")
 		if err := p.RunListener(ctx); err != nil {
 			log.Fatal(err)
 		}
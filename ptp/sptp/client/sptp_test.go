@@ -20,9 +20,11 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"runtime"
 	"testing"
 	"time"
 
+	"github.com/facebook/time/clock"
 	ptp "github.com/facebook/time/ptp/protocol"
 	gmstats "github.com/facebook/time/ptp/sptp/stats"
 	"github.com/facebook/time/servo"
@@ -133,6 +135,8 @@ func TestProcessResultsSingle(t *testing.T) {
 	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1))
 	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100))
 	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any())
 	mockStatsServer.EXPECT().SetGMStats(gomock.Any())
 	p.processResults(results)
 	require.Equal(t, "192.168.0.10", p.bestGM)
@@ -209,6 +213,8 @@ func TestProcessResultsMulti(t *testing.T) {
 	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(2))
 	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100))
 	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any())
 	mockStatsServer.EXPECT().SetGMStats(gomock.Any())
 	mockStatsServer.EXPECT().SetGMStats(gomock.Any())
 	p.processResults(results)
@@ -229,9 +235,13 @@ func TestRunInternalAllDead(t *testing.T) {
 	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(2)).Times(2)
 	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(0)).Times(2)
 	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any())
 	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1)).Times(4)
-	mockStatsServer.EXPECT().SetGMStats(&gmstats.Stat{GMAddress: "192.168.0.10", Error: context.DeadlineExceeded.Error(), Priority3: 1}).Times(2)
-	mockStatsServer.EXPECT().SetGMStats(&gmstats.Stat{GMAddress: "192.168.0.11", Error: context.DeadlineExceeded.Error(), Priority3: 2}).Times(2)
+	for i := int64(1); i <= 2; i++ {
+		mockStatsServer.EXPECT().SetGMStats(&gmstats.Stat{GMAddress: "192.168.0.10", Error: context.DeadlineExceeded.Error(), Priority3: 1, TXTSAttempts: i})
+		mockStatsServer.EXPECT().SetGMStats(&gmstats.Stat{GMAddress: "192.168.0.11", Error: context.DeadlineExceeded.Error(), Priority3: 2, TXTSAttempts: i})
+	}
 
 	p := &SPTP{
 		clock: mockClock,
@@ -287,7 +297,7 @@ func TestRunListenerNoAddr(t *testing.T) {
 	}
 	err := p.initClients()
 	require.NoError(t, err)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 	err = p.RunListener(ctx)
 	require.EqualError(t, err, "received packet on port 320 with nil source address")
@@ -326,6 +336,116 @@ func TestRunListenerError(t *testing.T) {
 	require.EqualError(t, err, "some error")
 }
 
+func TestListenRestarts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var restarts int64
+	calls := 0
+	// fail three times, then block until cancelled
+	err := listen(ctx, "test", 1, &restarts, func() error {
+		calls++
+		if calls <= 3 {
+			return fmt.Errorf("some error")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int64(3), restarts)
+
+	// persistent errors use up restarts
+	restarts = 0
+	err = listen(context.Background(), "test", 2, &restarts, func() error {
+		return fmt.Errorf("some error")
+	})
+	require.EqualError(t, err, "some error")
+	require.Equal(t, int64(maxListenerRestarts), restarts)
+}
+
+func TestProcessResultsSelfTelemetry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1)).Times(2)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(0)).Times(2)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any()).Do(func(_ string, v int64) {
+		require.GreaterOrEqual(t, v, int64(0))
+	})
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", int64(2))
+	var got *gmstats.Stat
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).Do(func(s *gmstats.Stat) { got = s }).Times(2)
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	p := &SPTP{
+		stats:            mockStatsServer,
+		cfg:              cfg,
+		listenerRestarts: 2,
+	}
+	err := p.initClients()
+	require.NoError(t, err)
+	for i := 0; i < rxQueueSize+3; i++ {
+		p.dispatch("192.168.0.10", &inPacket{})
+	}
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Error:  fmt.Errorf("oops"),
+		},
+	}
+	p.processResults(results)
+	require.Equal(t, rxQueueSize, got.RXQueueLen)
+	require.Equal(t, int64(3), got.RXDrops)
+	// the rest is only reported from the second tick on
+	runtime.GC()
+	p.processResults(results)
+}
+
+func TestRunListenerFlood(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var addrBytes [4]byte
+	copy(addrBytes[:], net.ParseIP("192.168.0.10").To4())
+	mockEventConn := NewMockUDPConnWithTS(ctrl)
+	// server floods us with packets as fast as we can read them
+	mockEventConn.EXPECT().ReadPacketWithRXTimestamp().DoAndReturn(func() ([]byte, unix.Sockaddr, time.Time, error) {
+		if ctx.Err() != nil {
+			return nil, nil, time.Time{}, ctx.Err()
+		}
+		return []byte{1, 2, 3, 4}, &unix.SockaddrInet4{Addr: addrBytes, Port: 319}, time.Now(), nil
+	}).MinTimes(rxQueueSize + 1)
+	mockGenConn := NewMockUDPConn(ctrl)
+	mockGenConn.EXPECT().ReadFromUDP(gomock.Any()).DoAndReturn(func(_ []byte) (int, *net.UDPAddr, error) {
+		<-ctx.Done()
+		return 0, nil, ctx.Err()
+	}).AnyTimes()
+
+	p := &SPTP{
+		stats: NewMockStatsServer(ctrl),
+		cfg: &Config{
+			Interval:        time.Second,
+			ListenerWorkers: 4,
+			Servers: map[string]int{
+				"192.168.0.10": 1,
+			},
+		},
+		eventConn: mockEventConn,
+		genConn:   mockGenConn,
+	}
+	require.NoError(t, p.initClients())
+	err := p.RunListener(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	// nobody reads from the client, yet listener wasn't blocked and memory use is bounded
+	c := p.clients["192.168.0.10"]
+	require.Equal(t, rxQueueSize, c.rx.len())
+	require.Greater(t, c.rx.drops(), int64(0))
+}
+
 func TestRunListenerGood(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -394,33 +514,404 @@ func TestRunListenerGood(t *testing.T) {
 	defer cancel()
 	err = p.RunListener(ctx)
 	require.ErrorIs(t, err, context.DeadlineExceeded)
-	receivedEvent10 := 0
-	receivedGen10 := 0
-	receivedEvent11 := 0
-	receivedGen11 := 0
-	nctx, ncancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
-	defer ncancel()
-LOOP:
-	for {
-		select {
-		case <-nctx.Done():
-			break LOOP
-		case p := <-p.clients["192.168.0.10"].inChan:
-			if p.data[0] == 1 {
-				receivedEvent10++
-			} else if p.data[0] == 9 {
-				receivedGen10++
-			}
-		case p := <-p.clients["192.168.0.11"].inChan:
-			if p.data[0] == 1 {
-				receivedEvent11++
-			} else if p.data[0] == 9 {
-				receivedGen11++
+	// count what's queued for the client, split by port
+	received := func(c *Client) (event int, gen int) {
+		for pkt := c.rx.pop(); pkt != nil; pkt = c.rx.pop() {
+			if pkt.data[0] == 1 {
+				event++
+			} else if pkt.data[0] == 9 {
+				gen++
 			}
 		}
+		return event, gen
 	}
+	receivedEvent10, receivedGen10 := received(p.clients["192.168.0.10"])
+	receivedEvent11, receivedGen11 := received(p.clients["192.168.0.11"])
 	require.Equal(t, sentGen/2, receivedGen10, "expect to receive N general packets to client 192.168.0.10")
 	require.Equal(t, sentEvent/2+1, receivedEvent10, "expect to receive N event packets to client 192.168.0.10")
 	require.Equal(t, sentGen/2+1, receivedGen11, "expect to receive N general packets to client 192.168.0.11")
 	require.Equal(t, sentEvent/2, receivedEvent11, "expect to receive N event packets to client 192.168.0.11")
 }
+
+func TestStaggerDelay(t *testing.T) {
+	p := &SPTP{
+		cfg: &Config{
+			Interval:        time.Second,
+			ExchangeTimeout: 200 * time.Millisecond,
+		},
+	}
+	require.Equal(t, time.Duration(0), p.staggerDelay(1, 4))
+	p.cfg.Stagger = true
+	require.Equal(t, time.Duration(0), p.staggerDelay(0, 4))
+	require.Equal(t, 200*time.Millisecond, p.staggerDelay(1, 4))
+	require.Equal(t, 600*time.Millisecond, p.staggerDelay(3, 4))
+	require.Equal(t, time.Duration(0), p.staggerDelay(0, 0))
+}
+
+func TestExchangeServerIntervals(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEventConn := NewMockUDPConnWithTS(ctrl)
+	// 192.168.0.10 is polled every tick, 192.168.0.11 every other tick
+	mockEventConn.EXPECT().WriteToWithTS(gomock.Any(), gomock.Any()).Times(5)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.portstats.tx.delay_req", int64(1)).Times(5)
+
+	p := &SPTP{
+		stats: mockStatsServer,
+		cfg: &Config{
+			Interval:        time.Second,
+			ExchangeTimeout: 10 * time.Millisecond,
+			Servers: map[string]int{
+				"192.168.0.10": 1,
+				"192.168.0.11": 2,
+			},
+			ServerIntervals: map[string]time.Duration{
+				"192.168.0.11": 2 * time.Second,
+			},
+		},
+		eventConn: mockEventConn,
+	}
+	require.NoError(t, p.initClients())
+	require.Equal(t, 2, p.pollEvery["192.168.0.11"])
+
+	results := p.exchange(context.Background())
+	require.Len(t, results, 2)
+	require.False(t, results["192.168.0.10"].stale)
+	require.False(t, results["192.168.0.11"].stale)
+
+	results = p.exchange(context.Background())
+	require.Len(t, results, 2)
+	require.False(t, results["192.168.0.10"].stale)
+	require.True(t, results["192.168.0.11"].stale)
+	require.ErrorIs(t, results["192.168.0.11"].Error, context.DeadlineExceeded)
+
+	results = p.exchange(context.Background())
+	require.False(t, results["192.168.0.11"].stale)
+}
+
+func TestProcessResultsStale(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockClock.EXPECT().AdjFreqPPB(gomock.Any()).Return(nil)
+	mockServo := NewMockServo(ctrl)
+	// only fresh measurement gets to servo
+	mockServo.EXPECT().Sample(int64(-100001000), gomock.Any()).Return(14.2, servo.StateLocked)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1)).Times(2)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100)).Times(2)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any())
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).Times(2)
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	p := &SPTP{
+		clock: mockClock,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		cfg:   cfg,
+	}
+	require.NoError(t, p.initClients())
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -100001 * time.Microsecond,
+				Timestamp: ts,
+			},
+		},
+	}
+	p.processResults(results)
+	require.Equal(t, "192.168.0.10", p.bestGM)
+
+	results["192.168.0.10"].stale = true
+	p.processResults(results)
+	require.Equal(t, "192.168.0.10", p.bestGM)
+}
+
+func TestProcessResultsConsensus(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockClock.EXPECT().AdjFreqPPB(gomock.Any()).Return(nil).Times(2)
+	mockServo := NewMockServo(ctrl)
+	// without failover we still follow the suspect
+	mockServo.EXPECT().Sample(int64(5000000), gomock.Any()).Return(14.2, servo.StateLocked)
+	// with failover we follow the next best GM
+	mockServo.EXPECT().Sample(int64(10000), gomock.Any()).Return(14.2, servo.StateLocked)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(3)).Times(2)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100)).Times(2)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.consensus.divergence_ns", int64(4985000)).Times(2)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.consensus.falseticker_suspect", int64(1)).Times(2)
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).Times(6)
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+		"192.168.0.11": 1,
+		"192.168.0.12": 1,
+	}
+	cfg.Consensus = ConsensusConfig{Enabled: true, Threshold: 100 * time.Microsecond, MinGMs: 2}
+	p := &SPTP{
+		clock: mockClock,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		cfg:   cfg,
+	}
+	require.NoError(t, p.initClients())
+	results := map[string]*RunResult{}
+	for i, offset := range []time.Duration{5 * time.Millisecond, 10 * time.Microsecond, 20 * time.Microsecond} {
+		addr := fmt.Sprintf("192.168.0.1%d", i)
+		announce := announcePkt(i)
+		announce.GrandmasterIdentity = ptp.ClockIdentity(i + 1)
+		announce.GrandmasterPriority2 = uint8(i)
+		results[addr] = &RunResult{
+			Server: addr,
+			Measurement: &MeasurementResult{
+				Delay:     100 * time.Microsecond,
+				Offset:    offset,
+				Timestamp: ts,
+				Announce:  *announce,
+			},
+		}
+	}
+	p.processResults(results)
+	require.Equal(t, "192.168.0.10", p.bestGM)
+
+	cfg.Consensus.Failover = true
+	p.processResults(results)
+	require.Equal(t, "192.168.0.11", p.bestGM)
+}
+
+func TestProcessResultsMaxClockClass(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// GM is refused, clock is left alone
+	mockClock := NewMockClock(ctrl)
+	mockServo := NewMockServo(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(0))
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).Do(func(s *gmstats.Stat) {
+		require.Equal(t, "clock class 248 is worse than maxclockclass 7", s.Error)
+		require.Equal(t, 1, s.GMPresent)
+	})
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	cfg.MaxClockClass = int(ptp.ClockClass7)
+	p := &SPTP{
+		clock: mockClock,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		cfg:   cfg,
+	}
+	require.NoError(t, p.initClients())
+	announce := announcePkt(0)
+	announce.GrandmasterClockQuality.ClockClass = ptp.ClockClass(248)
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -100001 * time.Microsecond,
+				Timestamp: ts,
+				Announce:  *announce,
+			},
+		},
+	}
+	p.processResults(results)
+	require.Equal(t, "", p.bestGM)
+}
+
+func TestProcessResultsQualifyAnnounces(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockClock.EXPECT().AdjFreqPPB(gomock.Any()).Return(nil)
+	mockServo := NewMockServo(ctrl)
+	mockServo.EXPECT().Sample(gomock.Any(), gomock.Any()).Return(12.3, servo.StateLocked)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1)).Times(2)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(0))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any())
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any())
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).Times(2)
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	cfg.QualifyAnnounces = true
+	p := &SPTP{
+		clock: mockClock,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		cfg:   cfg,
+	}
+	require.NoError(t, p.initClients())
+	require.NotNil(t, p.foreign)
+	result := func(seq int) map[string]*RunResult {
+		return map[string]*RunResult{
+			"192.168.0.10": {
+				Server: "192.168.0.10",
+				Measurement: &MeasurementResult{
+					Delay:     299995 * time.Microsecond,
+					Offset:    -100001 * time.Microsecond,
+					Timestamp: ts,
+					Announce:  *announcePkt(seq),
+				},
+			},
+		}
+	}
+	// single announce doesn't qualify GM
+	p.processResults(result(1))
+	require.Equal(t, "", p.bestGM)
+
+	p.processResults(result(2))
+	require.Equal(t, "192.168.0.10", p.bestGM)
+}
+
+func TestProcessResultsArmLeapSecond(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockClock.EXPECT().AdjFreqPPB(gomock.Any()).Return(nil)
+	mockServo := NewMockServo(ctrl)
+	mockServo.EXPECT().Sample(gomock.Any(), gomock.Any()).Return(12.3, servo.StateLocked)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1))
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100))
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).Do(func(s *gmstats.Stat) {
+		require.Equal(t, 1, s.Leap)
+	})
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	leapClock := &fakeLeapClock{}
+	p := &SPTP{
+		clock: mockClock,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		cfg:   cfg,
+		leap:  newLeapArmer(leapClock),
+	}
+	require.NoError(t, p.initClients())
+	announce := announcePkt(0)
+	announce.FlagField |= ptp.FlagLeap61
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -100001 * time.Microsecond,
+				Timestamp: ts,
+				Announce:  *announce,
+			},
+		},
+	}
+	p.processResults(results)
+	require.Equal(t, "192.168.0.10", p.bestGM)
+	require.Equal(t, []int{clock.LeapInsert}, leapClock.calls)
+}
+
+func TestProcessResultsMaintainTAIOffset(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockClock.EXPECT().AdjFreqPPB(gomock.Any()).Return(nil).Times(taiOffsetConfirmations)
+	mockServo := NewMockServo(ctrl)
+	mockServo.EXPECT().Sample(gomock.Any(), gomock.Any()).Return(12.3, servo.StateLocked).Times(taiOffsetConfirmations)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.total", int64(1)).Times(taiOffsetConfirmations)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.gms.available_pct", int64(100)).Times(taiOffsetConfirmations)
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).Times(taiOffsetConfirmations)
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_duration_ns", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.tick_gc_pause_ns", gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetCounter("ptp.sptp.listener.restarts", gomock.Any()).AnyTimes()
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	taiClock := &fakeTAIClock{}
+	p := &SPTP{
+		clock: mockClock,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		cfg:   cfg,
+		tai:   newTAIKeeper(taiClock),
+	}
+	require.NoError(t, p.initClients())
+	announce := announcePkt(0)
+	announce.FlagField |= ptp.FlagCurrentUtcOffsetValid | ptp.FlagPTPTimescale
+	announce.CurrentUTCOffset = 37
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -100001 * time.Microsecond,
+				Timestamp: ts,
+				Announce:  *announce,
+			},
+		},
+	}
+	for i := 0; i < taiOffsetConfirmations; i++ {
+		p.processResults(results)
+	}
+	require.Equal(t, "192.168.0.10", p.bestGM)
+	require.Equal(t, []int{37}, taiClock.calls)
+}
+
+func TestInitClientsServerPorts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+		"192.168.0.11": 2,
+	}
+	cfg.ServerPorts = map[string]ServerPorts{
+		"192.168.0.10": {Event: 11319, General: 11320},
+	}
+	cfg.UnicastNegotiation.Enabled = true
+	p := &SPTP{
+		stats:   NewMockStatsServer(ctrl),
+		cfg:     cfg,
+		genConn: NewMockUDPConn(ctrl),
+	}
+	require.NoError(t, p.initClients())
+	require.Equal(t, "192.168.0.10:11319", p.clients["192.168.0.10"].eventAddr.String())
+	require.Equal(t, "192.168.0.10:11320", p.clients["192.168.0.10"].genAddr.String())
+	require.Equal(t, "192.168.0.11:319", p.clients["192.168.0.11"].eventAddr.String())
+	require.Equal(t, "192.168.0.11:320", p.clients["192.168.0.11"].genAddr.String())
+}
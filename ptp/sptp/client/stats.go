@@ -19,6 +19,7 @@ package client
 import (
 	"sync"
 
+	ptp "github.com/facebook/time/ptp/protocol"
 	gmstats "github.com/facebook/time/ptp/sptp/stats"
 )
 
@@ -137,6 +138,12 @@ func runResultToStats(address string, r *RunResult, p3 int, selected bool) *gmst
 	s.IngressTime = r.Measurement.Timestamp.UnixNano()
 	s.CorrectionFieldRX = r.Measurement.CorrectionFieldRX.Nanoseconds()
 	s.CorrectionFieldTX = r.Measurement.CorrectionFieldTX.Nanoseconds()
+	s.TimeSource = r.Measurement.Announce.TimeSource.String()
+	s.UTCOffset = int(r.Measurement.Announce.CurrentUTCOffset)
+	s.UTCOffsetValid = r.Measurement.Announce.FlagField&ptp.FlagCurrentUtcOffsetValid != 0
+	s.TimeTraceable = r.Measurement.Announce.FlagField&ptp.FlagTimeTraceable != 0
+	s.FrequencyTraceable = r.Measurement.Announce.FlagField&ptp.FlagFrequencyTraceable != 0
+	s.Leap = leapFromAnnounce(&r.Measurement.Announce)
 	if selected {
 		s.Selected = true
 	}
@@ -66,14 +66,16 @@ func TestRunResultToStats(t *testing.T) {
 			Version:            ptp.Version,
 			SequenceID:         123,
 			MessageLength:      uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.AnnounceBody{})),
-			FlagField:          ptp.FlagUnicast,
+			FlagField:          ptp.FlagUnicast | ptp.FlagCurrentUtcOffsetValid | ptp.FlagTimeTraceable | ptp.FlagLeap61,
 			LogMessageInterval: 0x7f,
 		},
 		AnnounceBody: ptp.AnnounceBody{
 			OriginTimestamp:      ptp.NewTimestamp(time.Now()),
+			CurrentUTCOffset:     37,
 			GrandmasterPriority1: 1,
 			GrandmasterPriority2: 2,
 			GrandmasterIdentity:  2248787489,
+			TimeSource:           ptp.TimeSourceGNSS,
 			GrandmasterClockQuality: ptp.ClockQuality{
 				ClockClass:              ptp.ClockClass6,
 				ClockAccuracy:           ptp.ClockAccuracyMicrosecond250,
@@ -113,6 +115,11 @@ func TestRunResultToStats(t *testing.T) {
 		StepsRemoved:      1,
 		CorrectionFieldRX: int64(6 * time.Microsecond),
 		CorrectionFieldTX: int64(4 * time.Microsecond),
+		TimeSource:        "GNSS",
+		UTCOffset:         37,
+		UTCOffsetValid:    true,
+		TimeTraceable:     true,
+		Leap:              1,
 	}
 
 	t.Run("not selected", func(t *testing.T) {
@@ -0,0 +1,75 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// Supported clock step policies
+const (
+	// StepPolicyAlways lets servo step the clock whenever it decides to. Used when policy is not set
+	StepPolicyAlways = "always"
+	// StepPolicyFirst lets servo step the clock only until the clock is synced for the first time
+	StepPolicyFirst = "first"
+	// StepPolicyNever never steps the clock, only adjusts its frequency
+	StepPolicyNever = "never"
+)
+
+// StepPolicyConfig describes when we are allowed to step the clock and how far we are willing to go
+type StepPolicyConfig struct {
+	Policy             string        `yaml:"policy"`                // always, first or never
+	MaxOffset          time.Duration `yaml:"max_offset"`            // refuse to adjust the clock if offset to GM is larger than this, 0 means no limit
+	MaxOffsetAfterSync bool          `yaml:"max_offset_after_sync"` // only enforce MaxOffset once we synced the clock, letting the first adjustment be of any size
+}
+
+// Validate StepPolicyConfig is sane
+func (c *StepPolicyConfig) Validate() error {
+	switch c.Policy {
+	case "", StepPolicyAlways, StepPolicyFirst, StepPolicyNever:
+	default:
+		return fmt.Errorf("policy must be either %q, %q or %q", StepPolicyAlways, StepPolicyFirst, StepPolicyNever)
+	}
+	if c.MaxOffset < 0 {
+		return fmt.Errorf("max_offset must be 0 or positive")
+	}
+	return nil
+}
+
+// stepAllowed reports if clock can be stepped, given we have synced the clock before or not
+func (c *StepPolicyConfig) stepAllowed(synced bool) bool {
+	switch c.Policy {
+	case StepPolicyNever:
+		return false
+	case StepPolicyFirst:
+		return !synced
+	default:
+		return true
+	}
+}
+
+// offsetAllowed reports if we can adjust the clock using this offset, given we have synced the clock before or not
+func (c *StepPolicyConfig) offsetAllowed(offset time.Duration, synced bool) bool {
+	if c.MaxOffset == 0 || (c.MaxOffsetAfterSync && !synced) {
+		return true
+	}
+	if offset < 0 {
+		offset = -offset
+	}
+	return offset <= c.MaxOffset
+}
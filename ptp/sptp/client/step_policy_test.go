@@ -0,0 +1,181 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/servo"
+)
+
+func TestStepPolicyConfigValidate(t *testing.T) {
+	for _, policy := range []string{"", StepPolicyAlways, StepPolicyFirst, StepPolicyNever} {
+		c := &StepPolicyConfig{Policy: policy}
+		require.NoError(t, c.Validate(), policy)
+	}
+	c := &StepPolicyConfig{Policy: "sometimes"}
+	require.Error(t, c.Validate())
+	c = &StepPolicyConfig{MaxOffset: -time.Second}
+	require.Error(t, c.Validate())
+}
+
+func TestStepPolicyStepAllowed(t *testing.T) {
+	c := &StepPolicyConfig{}
+	require.True(t, c.stepAllowed(false))
+	require.True(t, c.stepAllowed(true))
+	c.Policy = StepPolicyAlways
+	require.True(t, c.stepAllowed(false))
+	require.True(t, c.stepAllowed(true))
+	c.Policy = StepPolicyFirst
+	require.True(t, c.stepAllowed(false))
+	require.False(t, c.stepAllowed(true))
+	c.Policy = StepPolicyNever
+	require.False(t, c.stepAllowed(false))
+	require.False(t, c.stepAllowed(true))
+}
+
+func TestStepPolicyOffsetAllowed(t *testing.T) {
+	c := &StepPolicyConfig{}
+	require.True(t, c.offsetAllowed(24*time.Hour, true))
+	c.MaxOffset = time.Millisecond
+	require.False(t, c.offsetAllowed(24*time.Hour, false))
+	require.True(t, c.offsetAllowed(time.Millisecond, true))
+	require.True(t, c.offsetAllowed(-time.Millisecond, true))
+	require.False(t, c.offsetAllowed(time.Millisecond+1, true))
+	require.False(t, c.offsetAllowed(-24*time.Hour, true))
+	// not synced yet, anything goes
+	c.MaxOffsetAfterSync = true
+	require.True(t, c.offsetAllowed(24*time.Hour, false))
+	require.False(t, c.offsetAllowed(-24*time.Hour, true))
+}
+
+func TestProcessResultsStepPolicy(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockServo := NewMockServo(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter(gomock.Any(), gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).AnyTimes()
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	cfg.StepPolicy = StepPolicyConfig{
+		Policy:    StepPolicyFirst,
+		MaxOffset: time.Second,
+	}
+	p := &SPTP{
+		clock: mockClock,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		cfg:   cfg,
+	}
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -10 * time.Second,
+				Timestamp: ts,
+			},
+		},
+	}
+	require.NoError(t, p.initClients())
+
+	// GM is way off on start, we don't touch the clock at all
+	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.clock.adjustments_refused", int64(1))
+	p.processResults(results)
+	require.False(t, p.synced)
+
+	// first step is allowed, and offset is not limited before we synced if configured so
+	p.cfg.StepPolicy.MaxOffsetAfterSync = true
+	mockServo.EXPECT().Sample(int64(-10*time.Second), gomock.Any()).Return(12.3, servo.StateJump)
+	mockClock.EXPECT().Step(10 * time.Second).Return(nil)
+	p.processResults(results)
+	require.True(t, p.synced)
+
+	// second step is not allowed, we adjust frequency instead
+	results["192.168.0.10"].Measurement.Offset = -100 * time.Millisecond
+	mockServo.EXPECT().Sample(int64(-100*time.Millisecond), gomock.Any()).Return(12.3, servo.StateJump)
+	mockClock.EXPECT().AdjFreqPPB(-12.3).Return(nil)
+	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.clock.steps_refused", int64(1))
+	p.processResults(results)
+
+	// GM is way off, we don't touch the clock at all
+	results["192.168.0.10"].Measurement.Offset = 10 * 365 * 24 * time.Hour
+	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.clock.adjustments_refused", int64(1))
+	p.processResults(results)
+}
+
+func TestProcessResultsStepPolicyNever(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClock := NewMockClock(ctrl)
+	mockServo := NewMockServo(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter(gomock.Any(), gomock.Any()).AnyTimes()
+	mockStatsServer.EXPECT().SetGMStats(gomock.Any()).AnyTimes()
+
+	cfg := DefaultConfig()
+	cfg.Servers = map[string]int{
+		"192.168.0.10": 1,
+	}
+	cfg.StepPolicy = StepPolicyConfig{
+		Policy:             StepPolicyNever,
+		MaxOffset:          time.Second,
+		MaxOffsetAfterSync: true,
+	}
+	p := &SPTP{
+		clock: mockClock,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		cfg:   cfg,
+	}
+	results := map[string]*RunResult{
+		"192.168.0.10": {
+			Server: "192.168.0.10",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -100 * time.Millisecond,
+				Timestamp: ts,
+			},
+		},
+	}
+	require.NoError(t, p.initClients())
+
+	// servo wants to step, but we only adjust frequency, which still counts as synced
+	mockServo.EXPECT().Sample(int64(-100*time.Millisecond), gomock.Any()).Return(12.3, servo.StateJump)
+	mockClock.EXPECT().AdjFreqPPB(-12.3).Return(nil)
+	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.clock.steps_refused", int64(1))
+	p.processResults(results)
+	require.True(t, p.synced)
+
+	// so max offset guard is on
+	results["192.168.0.10"].Measurement.Offset = 10 * 365 * 24 * time.Hour
+	mockStatsServer.EXPECT().UpdateCounterBy("ptp.sptp.clock.adjustments_refused", int64(1))
+	p.processResults(results)
+}
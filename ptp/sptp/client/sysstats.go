@@ -32,6 +32,13 @@ type SysStats struct {
 	memstats *runtime.MemStats
 }
 
+// gcPauseTotal returns cumulative time the world was stopped for GC since the program start
+func gcPauseTotal() uint64 {
+	m := &runtime.MemStats{}
+	runtime.ReadMemStats(m)
+	return m.PauseTotalNs
+}
+
 // setRate is a helper function to make a crude rate/diff
 func setRate(name string, counts map[string]uint64, cur, prev uint64, interval time.Duration) {
 	if prev > cur {
@@ -17,6 +17,7 @@ limitations under the License.
 package client
 
 import (
+	"runtime"
 	"testing"
 	"time"
 
@@ -54,3 +55,9 @@ func TestSetRate(t *testing.T) {
 	}
 	require.Equal(t, expected, stats)
 }
+
+func TestGCPauseTotal(t *testing.T) {
+	before := gcPauseTotal()
+	runtime.GC()
+	require.GreaterOrEqual(t, gcPauseTotal(), before)
+}
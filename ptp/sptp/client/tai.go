@@ -0,0 +1,92 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// sane range of UTC offset in seconds. As of 2017 it's 37
+const (
+	minTAIOffset = 30
+	maxTAIOffset = 50
+)
+
+// taiOffsetConfirmations is how many updates in a row have to bring new UTC offset before kernel gets it
+const taiOffsetConfirmations = 3
+
+// taiOffsetSetter is a clock kernel keeps TAI offset of
+type taiOffsetSetter interface {
+	SetTAIOffset(offset int) error
+}
+
+// utcOffsetFromAnnounce returns UTC offset in seconds GM announces, false if GM doesn't vouch for it
+func utcOffsetFromAnnounce(a *ptp.Announce) (int, bool) {
+	if a.FlagField&ptp.FlagCurrentUtcOffsetValid == 0 || a.FlagField&ptp.FlagPTPTimescale == 0 {
+		return 0, false
+	}
+	return int(a.CurrentUTCOffset), true
+}
+
+// taiKeeper keeps kernel TAI offset, used by CLOCK_TAI, in line with UTC offset best master announces
+type taiKeeper struct {
+	clock taiOffsetSetter
+	// offset kernel was set to
+	offset int
+	// if we have set kernel offset at least once
+	known bool
+	// offset waiting for confirmation and how many updates in a row brought it
+	pending int
+	seen    int
+}
+
+func newTAIKeeper(c taiOffsetSetter) *taiKeeper {
+	return &taiKeeper{clock: c}
+}
+
+// update sets kernel TAI offset once new sane offset is confirmed by several updates in a row
+func (k *taiKeeper) update(offset int) error {
+	if offset < minTAIOffset || offset > maxTAIOffset {
+		return fmt.Errorf("UTC offset %ds is outside of sane range [%d, %d]", offset, minTAIOffset, maxTAIOffset)
+	}
+	if k.known && offset == k.offset {
+		k.seen = 0
+		return nil
+	}
+	if offset != k.pending {
+		k.pending = offset
+		k.seen = 0
+	}
+	k.seen++
+	if k.seen < taiOffsetConfirmations {
+		return nil
+	}
+	if err := k.clock.SetTAIOffset(offset); err != nil {
+		return err
+	}
+	if k.known {
+		servoLog.Warningf("best master changed UTC offset from %ds to %ds, updated kernel TAI offset", k.offset, offset)
+	} else {
+		servoLog.Infof("set kernel TAI offset to %ds", offset)
+	}
+	k.offset = offset
+	k.known = true
+	k.seen = 0
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+type fakeTAIClock struct {
+	calls []int
+	err   error
+}
+
+func (c *fakeTAIClock) SetTAIOffset(offset int) error {
+	c.calls = append(c.calls, offset)
+	return c.err
+}
+
+func TestUTCOffsetFromAnnounce(t *testing.T) {
+	a := &ptp.Announce{}
+	a.CurrentUTCOffset = 37
+	_, ok := utcOffsetFromAnnounce(a)
+	require.False(t, ok)
+
+	a.FlagField = ptp.FlagCurrentUtcOffsetValid
+	_, ok = utcOffsetFromAnnounce(a)
+	require.False(t, ok)
+
+	a.FlagField = ptp.FlagUnicast | ptp.FlagCurrentUtcOffsetValid | ptp.FlagPTPTimescale
+	offset, ok := utcOffsetFromAnnounce(a)
+	require.True(t, ok)
+	require.Equal(t, 37, offset)
+}
+
+func TestTAIKeeperUpdate(t *testing.T) {
+	c := &fakeTAIClock{}
+	k := newTAIKeeper(c)
+
+	// needs confirmation before the first set
+	require.NoError(t, k.update(37))
+	require.NoError(t, k.update(37))
+	require.Empty(t, c.calls)
+	require.NoError(t, k.update(37))
+	require.NoError(t, k.update(37))
+	require.Equal(t, []int{37}, c.calls)
+
+	// a glitch doesn't get to kernel
+	require.NoError(t, k.update(38))
+	require.NoError(t, k.update(37))
+	require.NoError(t, k.update(38))
+	require.NoError(t, k.update(38))
+	require.Equal(t, []int{37}, c.calls)
+	require.NoError(t, k.update(38))
+	require.Equal(t, []int{37, 38}, c.calls)
+
+	require.Error(t, k.update(0))
+	require.Error(t, k.update(51))
+	require.Equal(t, []int{37, 38}, c.calls)
+}
+
+func TestTAIKeeperUpdateError(t *testing.T) {
+	c := &fakeTAIClock{err: fmt.Errorf("nope")}
+	k := newTAIKeeper(c)
+
+	require.NoError(t, k.update(37))
+	require.NoError(t, k.update(37))
+	require.Error(t, k.update(37))
+	// retried on next update
+	c.err = nil
+	require.NoError(t, k.update(37))
+	require.Equal(t, []int{37, 37}, c.calls)
+}
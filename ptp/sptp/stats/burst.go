@@ -0,0 +1,146 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// on-demand burst defaults
+const (
+	// BurstPath is the http path on-demand burst measurements are requested on
+	BurstPath = "/burst"
+	// DefaultBurstCount is how many exchanges burst runs by default
+	DefaultBurstCount = 64
+	// DefaultBurstInterval is how often burst exchanges are run by default
+	DefaultBurstInterval = time.Second / 8
+)
+
+// BurstSample is a single exchange of a burst
+type BurstSample struct {
+	// time offset was measured at, unix nanoseconds
+	Timestamp int64  `json:"timestamp"`
+	Offset    int64  `json:"offset"`
+	Delay     int64  `json:"delay"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BurstSummary is a summary of a series of nanosecond values
+type BurstSummary struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	StdDev float64 `json:"stddev"`
+}
+
+// BurstResult is the outcome of on-demand high-rate burst of exchanges with one GM
+type BurstResult struct {
+	GMAddress string        `json:"gm_address"`
+	Count     int           `json:"count"`
+	Interval  int64         `json:"interval"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Offset    BurstSummary  `json:"offset"`
+	Delay     BurstSummary  `json:"delay"`
+	Samples   []BurstSample `json:"samples"`
+}
+
+// NewBurstSummary calculates summary of values
+func NewBurstSummary(values []float64) BurstSummary {
+	if len(values) == 0 {
+		return BurstSummary{}
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	s := BurstSummary{
+		Min: sorted[0],
+		Max: sorted[len(sorted)-1],
+	}
+	for _, v := range sorted {
+		s.Mean += v
+	}
+	s.Mean /= float64(len(sorted))
+	if l := len(sorted); l%2 == 0 {
+		s.Median = (sorted[l/2-1] + sorted[l/2]) / 2
+	} else {
+		s.Median = sorted[l/2]
+	}
+	for _, v := range sorted {
+		s.StdDev += (v - s.Mean) * (v - s.Mean)
+	}
+	s.StdDev = math.Sqrt(s.StdDev / float64(len(sorted)))
+	return s
+}
+
+// Summarize fills in counts and summaries from the samples
+func (r *BurstResult) Summarize() {
+	offsets := []float64{}
+	delays := []float64{}
+	r.Succeeded = 0
+	r.Failed = 0
+	for _, s := range r.Samples {
+		if s.Error != "" {
+			r.Failed++
+			continue
+		}
+		r.Succeeded++
+		offsets = append(offsets, float64(s.Offset))
+		delays = append(delays, float64(s.Delay))
+	}
+	r.Offset = NewBurstSummary(offsets)
+	r.Delay = NewBurstSummary(delays)
+}
+
+// FetchBurst asks SPTP client at the url to run burst of count exchanges with the GM every interval and returns the result
+func FetchBurst(u string, server string, count int, interval time.Duration) (*BurstResult, error) {
+	q := url.Values{}
+	q.Set("server", server)
+	q.Set("count", fmt.Sprint(count))
+	q.Set("interval", interval.String())
+	c := http.Client{
+		// burst takes a while, give it some slack on top
+		Timeout: time.Duration(count)*interval + 5*time.Second,
+	}
+
+	resp, err := c.Post(fmt.Sprintf("%s%s?%s", u, BurstPath, q.Encode()), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", http.StatusText(resp.StatusCode), strings.TrimSpace(string(b)))
+	}
+
+	r := &BurstResult{}
+	err = json.Unmarshal(b, r)
+	return r, err
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBurstSummary(t *testing.T) {
+	require.Equal(t, BurstSummary{}, NewBurstSummary(nil))
+	require.Equal(t, BurstSummary{Min: 1, Max: 4, Mean: 2.5, Median: 2.5, StdDev: 1.118033988749895}, NewBurstSummary([]float64{4, 1, 3, 2}))
+	require.Equal(t, BurstSummary{Min: -3, Max: 3, Mean: 0, Median: 0, StdDev: 2.449489742783178}, NewBurstSummary([]float64{3, 0, -3}))
+}
+
+func TestBurstResultSummarize(t *testing.T) {
+	r := &BurstResult{
+		Samples: []BurstSample{
+			{Offset: 10, Delay: 100},
+			{Error: "timeout"},
+			{Offset: 30, Delay: 300},
+		},
+	}
+	r.Summarize()
+	require.Equal(t, 2, r.Succeeded)
+	require.Equal(t, 1, r.Failed)
+	require.Equal(t, BurstSummary{Min: 10, Max: 30, Mean: 20, Median: 20, StdDev: 10}, r.Offset)
+	require.Equal(t, BurstSummary{Min: 100, Max: 300, Mean: 200, Median: 200, StdDev: 100}, r.Delay)
+}
+
+func TestFetchBurst(t *testing.T) {
+	sampleResp := `{"gm_address": "192.168.0.10", "count": 2, "interval": 125000000, "succeeded": 2, "failed": 0, "offset": {"min": 1, "max": 3, "mean": 2, "median": 2, "stddev": 1}, "delay": {"min": 10, "max": 30, "mean": 20, "median": 20, "stddev": 10}, "samples": [{"timestamp": 1, "offset": 1, "delay": 10}, {"timestamp": 2, "offset": 3, "delay": 30}]}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, BurstPath, r.URL.Path)
+		require.Equal(t, "192.168.0.10", r.URL.Query().Get("server"))
+		require.Equal(t, "2", r.URL.Query().Get("count"))
+		require.Equal(t, "125ms", r.URL.Query().Get("interval"))
+		_, _ = w.Write([]byte(sampleResp))
+	}))
+	defer ts.Close()
+
+	r, err := FetchBurst(ts.URL, "192.168.0.10", 2, DefaultBurstInterval)
+	require.NoError(t, err)
+	expected := &BurstResult{
+		GMAddress: "192.168.0.10",
+		Count:     2,
+		Interval:  int64(125 * time.Millisecond),
+		Succeeded: 2,
+		Offset:    BurstSummary{Min: 1, Max: 3, Mean: 2, Median: 2, StdDev: 1},
+		Delay:     BurstSummary{Min: 10, Max: 30, Mean: 20, Median: 20, StdDev: 10},
+		Samples: []BurstSample{
+			{Timestamp: 1, Offset: 1, Delay: 10},
+			{Timestamp: 2, Offset: 3, Delay: 30},
+		},
+	}
+	require.Equal(t, expected, r)
+}
+
+func TestFetchBurstError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `unknown server "192.168.0.10"`, http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	_, err := FetchBurst(ts.URL, "192.168.0.10", 2, DefaultBurstInterval)
+	require.EqualError(t, err, `Bad Request: unknown server "192.168.0.10"`)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MaintenancePath is the http path manual clock control is requested on
+const MaintenancePath = "/maintenance"
+
+// maintenance actions
+const (
+	// MaintenanceStatus only reports current state
+	MaintenanceStatus = "status"
+	// MaintenanceStep steps the clock by the amount
+	MaintenanceStep = "step"
+	// MaintenanceSlew corrects the clock by the amount over the duration by adjusting its frequency
+	MaintenanceSlew = "slew"
+	// MaintenanceFreeze stops servo from adjusting the clock
+	MaintenanceFreeze = "freeze"
+	// MaintenanceResume aborts slew and lets servo adjust the clock again
+	MaintenanceResume = "resume"
+)
+
+// MaintenanceRequest is a request to control the clock manually
+type MaintenanceRequest struct {
+	Action string
+	// positive amount moves the clock forward
+	Amount   time.Duration
+	Duration time.Duration
+}
+
+// MaintenanceState is the state of manual clock control
+type MaintenanceState struct {
+	// servo doesn't adjust the clock
+	Frozen  bool `json:"frozen"`
+	Slewing bool `json:"slewing"`
+	// frequency offset applied on top of the frequency clock had when slew started
+	SlewPPB float64 `json:"slew_ppb,omitempty"`
+	// when slew ends, unix nanoseconds
+	SlewEnd int64 `json:"slew_end,omitempty"`
+}
+
+// RequestMaintenance asks SPTP client at the url to perform the maintenance action authenticated with the token, and returns resulting state
+func RequestMaintenance(u string, token string, req *MaintenanceRequest) (*MaintenanceState, error) {
+	q := url.Values{}
+	method := http.MethodPost
+	switch req.Action {
+	case MaintenanceStatus:
+		method = http.MethodGet
+	case MaintenanceStep:
+		q.Set("amount", req.Amount.String())
+	case MaintenanceSlew:
+		q.Set("amount", req.Amount.String())
+		q.Set("duration", req.Duration.String())
+	}
+	if method == http.MethodPost {
+		q.Set("action", req.Action)
+	}
+	r, err := http.NewRequest(method, fmt.Sprintf("%s%s?%s", u, MaintenancePath, q.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	c := http.Client{Timeout: 5 * time.Second}
+	resp, err := c.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", http.StatusText(resp.StatusCode), strings.TrimSpace(string(b)))
+	}
+
+	s := &MaintenanceState{}
+	err = json.Unmarshal(b, s)
+	return s, err
+}
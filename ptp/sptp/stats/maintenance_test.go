@@ -0,0 +1,63 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMaintenance(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, MaintenancePath, r.URL.Path)
+		require.Equal(t, "Bearer sekrit", r.Header.Get("Authorization"))
+		q := r.URL.Query()
+		switch r.Method {
+		case http.MethodGet:
+			require.Empty(t, q)
+			_, _ = w.Write([]byte(`{"frozen": true, "slewing": false}`))
+		case http.MethodPost:
+			require.Equal(t, MaintenanceSlew, q.Get("action"))
+			require.Equal(t, "-1ms", q.Get("amount"))
+			require.Equal(t, "10s", q.Get("duration"))
+			_, _ = w.Write([]byte(`{"frozen": false, "slewing": true, "slew_ppb": -100, "slew_end": 42}`))
+		}
+	}))
+	defer ts.Close()
+
+	s, err := RequestMaintenance(ts.URL, "sekrit", &MaintenanceRequest{Action: MaintenanceStatus})
+	require.NoError(t, err)
+	require.Equal(t, &MaintenanceState{Frozen: true}, s)
+
+	s, err = RequestMaintenance(ts.URL, "sekrit", &MaintenanceRequest{Action: MaintenanceSlew, Amount: -time.Millisecond, Duration: 10 * time.Second})
+	require.NoError(t, err)
+	require.Equal(t, &MaintenanceState{Slewing: true, SlewPPB: -100, SlewEnd: 42}, s)
+}
+
+func TestRequestMaintenanceError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid maintenance token", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	_, err := RequestMaintenance(ts.URL, "wrong", &MaintenanceRequest{Action: MaintenanceFreeze})
+	require.EqualError(t, err, "Unauthorized: invalid maintenance token")
+}
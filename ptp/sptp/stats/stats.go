@@ -36,6 +36,7 @@ const (
 // Stat is a representation of a monitoring struct for sptp client
 type Stat struct {
 	GMAddress         string           `json:"gm_address"`
+	Domain            int              `json:"domain"`
 	ClockQuality      ptp.ClockQuality `json:"clock_quality"`
 	Error             string           `json:"error"`
 	GMPresent         int              `json:"gm_present"`
@@ -50,6 +51,20 @@ type Stat struct {
 	StepsRemoved      int              `json:"steps_removed"`
 	CorrectionFieldRX int64            `json:"cf_rx"`
 	CorrectionFieldTX int64            `json:"cf_tx"`
+	TXTSAttempts      int64            `json:"txts_attempts"`
+	TXTSFailures      int64            `json:"txts_failures"`
+	TXTSTimeouts      int64            `json:"txts_timeouts"`
+	TXTSDriverBugs    int64            `json:"txts_driver_bugs"`
+	RXDrops           int64            `json:"rx_drops"`
+	RXQueueLen        int              `json:"rx_queue_len"`
+	// time properties announced by GM
+	TimeSource         string `json:"time_source"`
+	UTCOffset          int    `json:"utc_offset"`
+	UTCOffsetValid     bool   `json:"utc_offset_valid"`
+	TimeTraceable      bool   `json:"time_traceable"`
+	FrequencyTraceable bool   `json:"frequency_traceable"`
+	// leap second announced for the end of current UTC day: 1 to insert, -1 to delete, 0 for none
+	Leap int `json:"leap"`
 }
 
 // Stats is a list of Stat
@@ -97,6 +97,10 @@ type PiServo struct {
 	count              int
 	lastCorrectionTime time.Time
 	filter             *PiServoFilter
+	// started from saved state, first sample is checked against FirstStepThreshold
+	warm bool
+	// current time, replaced in simulation
+	now func() time.Time
 	/* configuration: */
 	cfg *PiServoCfg
 }
@@ -123,7 +127,7 @@ func (s *PiServo) isSpike(offset int64, lastCorrection time.Time) filterState {
 	if s.filter == nil {
 		return filterNoSpike
 	}
-	return s.filter.isSpike(offset, lastCorrection)
+	return s.filter.isSpike(offset, s.now().Sub(lastCorrection))
 }
 
 // Sample function to calculate frequency based on the offset
@@ -136,6 +140,17 @@ func (s *PiServo) Sample(offset int64, localTs uint64) (float64, State) {
 		sOffset = -sOffset
 	}
 
+	if s.warm {
+		s.warm = false
+		if s.FirstUpdate && s.FirstStepThreshold > 0 && s.FirstStepThreshold < sOffset {
+			log.Warningf("servo offset %d is over first step threshold, not using saved state", offset)
+			s.count = 0
+			if s.filter != nil {
+				s.filter.Reset()
+			}
+		}
+	}
+
 	switch s.count {
 	case 0:
 		s.offset[0] = offset
@@ -229,7 +244,7 @@ func (s *PiServo) Sample(offset int64, localTs uint64) (float64, State) {
 	if state == StateLocked && s.filter != nil {
 		s.filter.Sample(&PiServoFilterSample{offset: offset, freq: ppb})
 		s.filter.skippedCount = 0
-		s.lastCorrectionTime = time.Now()
+		s.lastCorrectionTime = s.now()
 	}
 	if state == StateFilter {
 		state = StateLocked
@@ -251,12 +266,12 @@ func (s *PiServo) SyncInterval(interval float64) {
 }
 
 // isSpike is used to check whether supplied offset is spike or not
-func (f *PiServoFilter) isSpike(offset int64, lastCorrection time.Time) filterState {
+func (f *PiServoFilter) isSpike(offset int64, sinceCorrection time.Duration) filterState {
 	if f.skippedCount >= f.cfg.maxSkipCount {
 		return filterReset
 	}
 	maxOffsetLocked := int64(f.cfg.offsetStdevFactor * float64(f.offsetStdev))
-	secPassed := math.Round(time.Since(lastCorrection).Seconds())
+	secPassed := math.Round(sinceCorrection.Seconds())
 	waitFactor := secPassed * (f.cfg.freqStdevFactor*f.freqStdev + float64(f.cfg.maxFreqChange/2))
 
 	maxOffsetLocked += int64(waitFactor)
@@ -319,6 +334,42 @@ func (s *PiServo) MeanFreq() float64 {
 	return s.lastFreq
 }
 
+// PiServoState is servo state which can be saved to warm start the servo later
+type PiServoState struct {
+	Freq        float64 `json:"freq"`
+	OffsetMean  int64   `json:"offset_mean"`
+	OffsetStdev int64   `json:"offset_stdev"`
+	FreqStdev   float64 `json:"freq_stdev"`
+}
+
+// State returns current state of the servo
+func (s *PiServo) State() *PiServoState {
+	st := &PiServoState{Freq: s.MeanFreq()}
+	if s.filter != nil {
+		st.OffsetMean = s.filter.offsetMean
+		st.OffsetStdev = s.filter.offsetStdev
+		st.FreqStdev = s.filter.freqStdev
+	}
+	return st
+}
+
+// WarmStart makes servo skip initial frequency estimation and start locked from saved state.
+// If first offset is over FirstStepThreshold, saved state is discarded and servo starts over.
+// Must be called before the first Sample
+func (s *PiServo) WarmStart(st *PiServoState) {
+	s.lastFreq = st.Freq
+	s.drift = st.Freq
+	s.count = 2
+	s.warm = true
+	s.lastCorrectionTime = s.now()
+	if s.filter != nil {
+		s.filter.offsetMean = st.OffsetMean
+		s.filter.offsetStdev = st.OffsetStdev
+		s.filter.freqMean = st.Freq
+		s.filter.freqStdev = st.FreqStdev
+	}
+}
+
 // NewPiServo to create servo structure
 func NewPiServo(s Servo, cfg *PiServoCfg, freq float64) *PiServo {
 	var pi PiServo
@@ -327,6 +378,7 @@ func NewPiServo(s Servo, cfg *PiServoCfg, freq float64) *PiServo {
 	pi.cfg = cfg
 	pi.lastFreq = freq
 	pi.drift = freq
+	pi.now = time.Now
 
 	return &pi
 }
@@ -140,3 +140,38 @@ func TestPiServoSetFreq(t *testing.T) {
 	require.InEpsilon(t, 11111.0025, pi.lastFreq, 0.00001)
 	require.InEpsilon(t, 11111.0025, pi.drift, 0.00001)
 }
+
+func TestPiServoWarmStart(t *testing.T) {
+	pi := NewPiServo(DefaultServoConfig(), DefaultPiServoCfg(), 0)
+	NewPiServoFilter(pi, DefaultPiServoFilterCfg())
+	pi.SyncInterval(1)
+	pi.WarmStart(&PiServoState{Freq: -111288.406372, OffsetMean: 10, OffsetStdev: 300, FreqStdev: 50})
+	require.InEpsilon(t, -111288.406372, pi.MeanFreq(), 0.00001)
+	state := pi.State()
+	require.Equal(t, &PiServoState{Freq: pi.MeanFreq(), OffsetMean: 10, OffsetStdev: 300, FreqStdev: 50}, state)
+
+	// locked straight away, no frequency estimation
+	freq, st := pi.Sample(100, 1674148530671467104)
+	require.Equal(t, StateLocked, st)
+	require.InEpsilon(t, -111288.406372+0.7*100+0.3*100, freq, 0.00001)
+}
+
+func TestPiServoWarmStartOverThreshold(t *testing.T) {
+	cfg := DefaultServoConfig()
+	cfg.FirstStepThreshold = 200000
+	cfg.FirstUpdate = true
+	pi := NewPiServo(cfg, DefaultPiServoCfg(), 0)
+	NewPiServoFilter(pi, DefaultPiServoFilterCfg())
+	pi.SyncInterval(1)
+	pi.WarmStart(&PiServoState{Freq: -111288.406372, OffsetStdev: 300})
+
+	// saved state is discarded, servo starts over from saved frequency
+	freq, st := pi.Sample(235000, 1674148528671467104)
+	require.Equal(t, StateInit, st)
+	require.InEpsilon(t, -111288.406372, freq, 0.00001)
+	require.Equal(t, int64(0), pi.State().OffsetStdev)
+
+	freq, st = pi.Sample(225000, 1674148529671518924)
+	require.Equal(t, StateJump, st)
+	require.InEpsilon(t, -121289.001025, freq, 0.00001)
+}
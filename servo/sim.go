@@ -0,0 +1,218 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servo
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// SimSample is a single offset measurement of the free-running clock,
+// with all corrections made to the clock at the time of recording taken out
+type SimSample struct {
+	Timestamp time.Time
+	Offset    int64
+}
+
+// FilterParams are tunable parameters of PiServoFilter
+type FilterParams struct {
+	MinOffsetLocked   int64   `json:"min_offset_locked"`
+	MaxFreqChange     int64   `json:"max_freq_change"`
+	MaxSkipCount      int     `json:"max_skip_count"`
+	MaxOffsetInit     int64   `json:"max_offset_init"`
+	OffsetStdevFactor float64 `json:"offset_stdev_factor"`
+	FreqStdevFactor   float64 `json:"freq_stdev_factor"`
+	RingSize          int     `json:"ring_size"`
+}
+
+// DefaultFilterParams returns parameters of DefaultPiServoFilterCfg
+func DefaultFilterParams() *FilterParams {
+	c := DefaultPiServoFilterCfg()
+	return &FilterParams{
+		MinOffsetLocked:   c.minOffsetLocked,
+		MaxFreqChange:     c.maxFreqChange,
+		MaxSkipCount:      c.maxSkipCount,
+		MaxOffsetInit:     c.maxOffsetInit,
+		OffsetStdevFactor: c.offsetStdevFactor,
+		FreqStdevFactor:   c.freqStdevFactor,
+		RingSize:          c.ringSize,
+	}
+}
+
+func (p *FilterParams) cfg() *PiServoFilterCfg {
+	return &PiServoFilterCfg{
+		minOffsetLocked:   p.MinOffsetLocked,
+		maxFreqChange:     p.MaxFreqChange,
+		maxSkipCount:      p.MaxSkipCount,
+		maxOffsetInit:     p.MaxOffsetInit,
+		offsetStdevFactor: p.OffsetStdevFactor,
+		freqStdevFactor:   p.FreqStdevFactor,
+		ringSize:          p.RingSize,
+	}
+}
+
+// SimConfig is a candidate servo configuration
+type SimConfig struct {
+	KpScale float64 `json:"kp_scale"`
+	KiScale float64 `json:"ki_scale"`
+	// nil means no filter
+	Filter *FilterParams `json:"filter,omitempty"`
+}
+
+// SimResult is how well the candidate configuration disciplined the clock over the trace
+type SimResult struct {
+	Config SimConfig `json:"config"`
+	// number of the first sample servo was locked on, -1 if it never locked
+	LockedAt int `json:"locked_at"`
+	// RMS and max absolute offset since servo got locked, ns
+	RMS    float64 `json:"rms"`
+	MaxAbs int64   `json:"max_abs"`
+	Steps  int     `json:"steps"`
+	// how many times servo started over once locked
+	Resets int `json:"resets"`
+}
+
+// Better reports if r disciplined the clock better than o: it locked, had lower RMS offset and locked sooner
+func (r *SimResult) Better(o *SimResult) bool {
+	if (r.LockedAt < 0) != (o.LockedAt < 0) {
+		return r.LockedAt >= 0
+	}
+	if r.RMS != o.RMS {
+		return r.RMS < o.RMS
+	}
+	return r.LockedAt < o.LockedAt
+}
+
+// Simulate replays the trace through PI servo with candidate configuration, disciplining simulated clock every interval
+// the same way SPTP does: stepping it on StateJump and adjusting frequency on StateLocked
+func Simulate(trace []SimSample, interval time.Duration, firstStepThreshold int64, cfg SimConfig) *SimResult {
+	servoCfg := DefaultServoConfig()
+	if firstStepThreshold != 0 {
+		servoCfg.FirstUpdate = true
+		servoCfg.FirstStepThreshold = firstStepThreshold
+	}
+	piCfg := DefaultPiServoCfg()
+	piCfg.PiKpScale = cfg.KpScale
+	piCfg.PiKiScale = cfg.KiScale
+	pi := NewPiServo(servoCfg, piCfg, 0)
+	if cfg.Filter != nil {
+		NewPiServoFilter(pi, cfg.Filter.cfg())
+	}
+	pi.SyncInterval(interval.Seconds())
+
+	res := &SimResult{Config: cfg, LockedAt: -1}
+	var now time.Time
+	pi.now = func() time.Time { return now }
+	// phase correction and frequency applied to the simulated clock
+	var correction, freq float64
+	var sumSq float64
+	var locked int
+	for i, s := range trace {
+		if i > 0 {
+			correction += freq * float64(s.Timestamp.Sub(trace[i-1].Timestamp)) / 1e9
+		}
+		now = s.Timestamp
+		offset := s.Offset + int64(correction)
+		if res.LockedAt >= 0 {
+			sumSq += float64(offset) * float64(offset)
+			locked++
+			if abs := int64(math.Abs(float64(offset))); abs > res.MaxAbs {
+				res.MaxAbs = abs
+			}
+		}
+		freqAdj, state := pi.Sample(offset, uint64(s.Timestamp.UnixNano()))
+		switch state {
+		case StateJump:
+			correction -= float64(offset)
+			res.Steps++
+		case StateLocked:
+			freq = -freqAdj
+			if res.LockedAt < 0 {
+				res.LockedAt = i
+			}
+		case StateInit:
+			// servo starts over after being locked
+			if res.LockedAt >= 0 {
+				res.Resets++
+			}
+		}
+	}
+	if locked > 0 {
+		res.RMS = math.Sqrt(sumSq / float64(locked))
+	}
+	return res
+}
+
+// GridConfigs returns all combinations of candidate parameters
+func GridConfigs(kpScales, kiScales []float64, filters []*FilterParams) []SimConfig {
+	if len(filters) == 0 {
+		filters = []*FilterParams{nil}
+	}
+	configs := make([]SimConfig, 0, len(kpScales)*len(kiScales)*len(filters))
+	for _, kp := range kpScales {
+		for _, ki := range kiScales {
+			for _, f := range filters {
+				configs = append(configs, SimConfig{KpScale: kp, KiScale: ki, Filter: f})
+			}
+		}
+	}
+	return configs
+}
+
+// Tune simulates every candidate configuration and returns results, best first
+func Tune(trace []SimSample, interval time.Duration, firstStepThreshold int64, candidates []SimConfig) []*SimResult {
+	results := make([]*SimResult, 0, len(candidates))
+	for _, c := range candidates {
+		results = append(results, Simulate(trace, interval, firstStepThreshold, c))
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Better(results[j])
+	})
+	return results
+}
+
+// Refine improves the configuration with coordinate descent over kp and ki scales,
+// halving the step every time neither direction helps, for at most iterations simulations
+func Refine(trace []SimSample, interval time.Duration, firstStepThreshold int64, start SimConfig, iterations int) *SimResult {
+	best := Simulate(trace, interval, firstStepThreshold, start)
+	stepKp := start.KpScale / 2
+	stepKi := start.KiScale / 2
+	for n := 0; n < iterations && (stepKp > 1e-6 || stepKi > 1e-6); {
+		improved := false
+		for _, c := range []SimConfig{
+			{KpScale: best.Config.KpScale + stepKp, KiScale: best.Config.KiScale, Filter: start.Filter},
+			{KpScale: best.Config.KpScale - stepKp, KiScale: best.Config.KiScale, Filter: start.Filter},
+			{KpScale: best.Config.KpScale, KiScale: best.Config.KiScale + stepKi, Filter: start.Filter},
+			{KpScale: best.Config.KpScale, KiScale: best.Config.KiScale - stepKi, Filter: start.Filter},
+		} {
+			if c.KpScale <= 0 || c.KiScale <= 0 || n >= iterations {
+				continue
+			}
+			n++
+			if r := Simulate(trace, interval, firstStepThreshold, c); r.Better(best) {
+				best = r
+				improved = true
+			}
+		}
+		if !improved {
+			stepKp /= 2
+			stepKi /= 2
+		}
+	}
+	return best
+}
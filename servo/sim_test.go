@@ -0,0 +1,119 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servo
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// freeRunningTrace is a clock drifting away by drift ppb, with noisy measurements
+func freeRunningTrace(n int, interval time.Duration, drift float64, noise int64) []SimSample {
+	r := rand.New(rand.NewSource(42))
+	start := time.Unix(1700000000, 0)
+	trace := make([]SimSample, 0, n)
+	for i := 0; i < n; i++ {
+		elapsed := time.Duration(i) * interval
+		offset := 1000 + int64(drift*elapsed.Seconds())
+		if noise > 0 {
+			offset += r.Int63n(2*noise) - noise
+		}
+		trace = append(trace, SimSample{Timestamp: start.Add(elapsed), Offset: offset})
+	}
+	return trace
+}
+
+func TestSimulate(t *testing.T) {
+	trace := freeRunningTrace(300, time.Second, 10000, 0)
+	res := Simulate(trace, time.Second, 0, SimConfig{KpScale: kpScale, KiScale: kiScale, Filter: DefaultFilterParams()})
+	require.Equal(t, 1, res.LockedAt)
+	require.Equal(t, 0, res.Steps)
+	require.Equal(t, 0, res.Resets)
+	// worst offset is right after locking, as clock has drifted for a second before first adjustment
+	require.Equal(t, int64(11000), res.MaxAbs)
+	require.Less(t, res.RMS, 1000.0)
+
+	// servo which barely reacts leaves clock drifting
+	slow := Simulate(trace, time.Second, 0, SimConfig{KpScale: 0.01, KiScale: 0.001})
+	require.True(t, res.Better(slow))
+	require.Equal(t, 0, slow.Resets)
+}
+
+func TestSimulateStep(t *testing.T) {
+	trace := freeRunningTrace(100, time.Second, 10000, 0)
+	for i := range trace {
+		trace[i].Offset += int64(time.Millisecond)
+	}
+	res := Simulate(trace, time.Second, int64(100*time.Microsecond), SimConfig{KpScale: kpScale, KiScale: kiScale})
+	require.Equal(t, 1, res.Steps)
+	require.Equal(t, 2, res.LockedAt)
+	require.Less(t, res.MaxAbs, int64(100*time.Microsecond))
+}
+
+func TestSimulateNeverLocks(t *testing.T) {
+	trace := freeRunningTrace(1, time.Second, 10000, 0)
+	res := Simulate(trace, time.Second, 0, SimConfig{KpScale: kpScale, KiScale: kiScale})
+	require.Equal(t, -1, res.LockedAt)
+	require.Equal(t, 0.0, res.RMS)
+}
+
+func TestSimResultBetter(t *testing.T) {
+	locked := &SimResult{LockedAt: 1, RMS: 100}
+	require.True(t, locked.Better(&SimResult{LockedAt: -1}))
+	require.False(t, (&SimResult{LockedAt: -1}).Better(locked))
+	require.True(t, locked.Better(&SimResult{LockedAt: 1, RMS: 200}))
+	require.True(t, locked.Better(&SimResult{LockedAt: 5, RMS: 100}))
+	require.False(t, locked.Better(locked))
+}
+
+func TestGridConfigs(t *testing.T) {
+	configs := GridConfigs([]float64{0.1, 0.7}, []float64{0.3}, nil)
+	require.Equal(t, []SimConfig{{KpScale: 0.1, KiScale: 0.3}, {KpScale: 0.7, KiScale: 0.3}}, configs)
+
+	f := DefaultFilterParams()
+	configs = GridConfigs([]float64{0.7}, []float64{0.1, 0.3}, []*FilterParams{nil, f})
+	require.Len(t, configs, 4)
+	require.Equal(t, SimConfig{KpScale: 0.7, KiScale: 0.3, Filter: f}, configs[3])
+}
+
+func TestTune(t *testing.T) {
+	trace := freeRunningTrace(300, time.Second, 10000, 50)
+	results := Tune(trace, time.Second, 0, GridConfigs([]float64{0.01, 0.7}, []float64{0.001, 0.3}, nil))
+	require.Len(t, results, 4)
+	for i := 1; i < len(results); i++ {
+		require.False(t, results[i].Better(results[i-1]))
+	}
+	// barely reacting servo is the worst
+	require.Equal(t, SimConfig{KpScale: 0.01, KiScale: 0.001}, results[3].Config)
+}
+
+func TestRefine(t *testing.T) {
+	trace := freeRunningTrace(300, time.Second, 10000, 50)
+	start := SimConfig{KpScale: 0.2, KiScale: 0.05}
+	initial := Simulate(trace, time.Second, 0, start)
+	best := Refine(trace, time.Second, 0, start, 40)
+	require.False(t, initial.Better(best))
+	require.Greater(t, best.Config.KpScale, 0.0)
+	require.Greater(t, best.Config.KiScale, 0.0)
+}
+
+func TestDefaultFilterParams(t *testing.T) {
+	require.Equal(t, DefaultPiServoFilterCfg(), DefaultFilterParams().cfg())
+}
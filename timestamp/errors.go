@@ -0,0 +1,127 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Classes of timestamping failures, use errors.Is to check which one the error belongs to
+var (
+	// ErrNoHWSupport means NIC or its driver can't timestamp packets the way we asked
+	ErrNoHWSupport = errors.New("hardware timestamping is not supported")
+	// ErrTXTimestampTimeout means packet was sent, but kernel didn't report its TX timestamp in time
+	ErrTXTimestampTimeout = errors.New("TX timestamp was not reported in time")
+	// ErrDriverBug means NIC driver reported timestamp which can't be right
+	ErrDriverBug = errors.New("NIC driver reported invalid timestamp")
+)
+
+// Hints on what to do about timestamping failures
+const (
+	hintNoHWSupport         = "check `ethtool -T %s` lists hardware-transmit, hardware-receive and hardware-raw-clock, or use software timestamping"
+	hintTXTimestampTimeout  = "NIC may be too busy timestamping other packets, consider increasing TX timestamp attempts or timeout"
+	hintDriverBug           = "consider updating NIC driver and firmware"
+	hintDriverVirtual       = "virtual NICs don't timestamp packets in hardware, use software timestamping"
+	hintDriverSingleTXTS    = "this NIC can only timestamp one packet at a time, so TX timestamps are lost when packets are sent back to back"
+	hintDriverPTPFilterOnly = "this NIC can only timestamp PTP event packets, not all packets"
+)
+
+// driverHints are known limitations of NIC drivers, explaining typical failures better than generic hints
+var driverHints = map[string]string{
+	"virtio_net": hintDriverVirtual,
+	"veth":       hintDriverVirtual,
+	"vmxnet3":    hintDriverVirtual,
+	"hv_netvsc":  hintDriverVirtual,
+	"igb":        hintDriverSingleTXTS,
+	"ixgbe":      hintDriverPTPFilterOnly,
+}
+
+// Error is a timestamping failure, classified by Kind, with NIC driver if known and hint on what to do about it
+type Error struct {
+	// one of ErrNoHWSupport, ErrTXTimestampTimeout or ErrDriverBug
+	Kind error
+	// NIC driver as reported by ethtool, empty if unknown
+	Driver string
+	Hint   string
+	Err    error
+}
+
+// Error returns underlying error together with the driver and hint
+func (e *Error) Error() string {
+	msg := e.Err.Error()
+	if e.Driver != "" {
+		msg = fmt.Sprintf("%s (driver %s)", msg, e.Driver)
+	}
+	if e.Hint != "" {
+		msg = fmt.Sprintf("%s; hint: %s", msg, e.Hint)
+	}
+	return msg
+}
+
+// Unwrap returns underlying error, such as errno
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports if the error belongs to the class of failures
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// newDriverError builds error of the kind, preferring hint specific to NIC driver if we know one
+func newDriverError(kind error, driver string, hint string, err error) *Error {
+	if h, ok := driverHints[driver]; ok {
+		hint = h
+	}
+	return &Error{Kind: kind, Driver: driver, Hint: hint, Err: err}
+}
+
+// FailureClass is a class of timestamping failure, for stats
+type FailureClass int
+
+// Classes of timestamping failures
+const (
+	FailureOther FailureClass = iota
+	FailureNoHWSupport
+	FailureTXTimestampTimeout
+	FailureDriverBug
+)
+
+var failureClassToString = map[FailureClass]string{
+	FailureOther:              "other",
+	FailureNoHWSupport:        "no_hw_support",
+	FailureTXTimestampTimeout: "tx_timeout",
+	FailureDriverBug:          "driver_bug",
+}
+
+func (c FailureClass) String() string {
+	return failureClassToString[c]
+}
+
+// Classify returns class of timestamping failure
+func Classify(err error) FailureClass {
+	switch {
+	case errors.Is(err, ErrNoHWSupport):
+		return FailureNoHWSupport
+	case errors.Is(err, ErrTXTimestampTimeout):
+		return FailureTXTimestampTimeout
+	case errors.Is(err, ErrDriverBug):
+		return FailureDriverBug
+	}
+	return FailureOther
+}
@@ -0,0 +1,68 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestError(t *testing.T) {
+	err := &Error{Kind: ErrNoHWSupport, Err: fmt.Errorf("ioctl failed: %w", syscall.EOPNOTSUPP)}
+	require.EqualError(t, err, "ioctl failed: operation not supported")
+	require.ErrorIs(t, err, ErrNoHWSupport)
+	require.ErrorIs(t, err, syscall.EOPNOTSUPP)
+	require.False(t, errors.Is(err, ErrDriverBug))
+
+	err.Driver = "mlx5_core"
+	err.Hint = "use software timestamping"
+	require.EqualError(t, err, "ioctl failed: operation not supported (driver mlx5_core); hint: use software timestamping")
+
+	// still classified when wrapped
+	wrapped := fmt.Errorf("enabling timestamps: %w", err)
+	var te *Error
+	require.True(t, errors.As(wrapped, &te))
+	require.Equal(t, "mlx5_core", te.Driver)
+	require.ErrorIs(t, wrapped, ErrNoHWSupport)
+}
+
+func TestNewDriverError(t *testing.T) {
+	cause := errors.New("ioctl failed")
+	err := newDriverError(ErrNoHWSupport, "mlx5_core", "generic hint", cause)
+	require.Equal(t, &Error{Kind: ErrNoHWSupport, Driver: "mlx5_core", Hint: "generic hint", Err: cause}, err)
+
+	// known driver limitation explains failure better
+	err = newDriverError(ErrNoHWSupport, "virtio_net", "generic hint", cause)
+	require.Equal(t, &Error{Kind: ErrNoHWSupport, Driver: "virtio_net", Hint: hintDriverVirtual, Err: cause}, err)
+}
+
+func TestClassify(t *testing.T) {
+	require.Equal(t, FailureOther, Classify(errors.New("boom")))
+	require.Equal(t, FailureOther, Classify(nil))
+	require.Equal(t, FailureNoHWSupport, Classify(&Error{Kind: ErrNoHWSupport, Err: errors.New("boom")}))
+	require.Equal(t, FailureTXTimestampTimeout, Classify(fmt.Errorf("sending: %w", &Error{Kind: ErrTXTimestampTimeout, Err: errors.New("boom")})))
+	require.Equal(t, FailureDriverBug, Classify(&Error{Kind: ErrDriverBug, Err: errors.New("boom")}))
+
+	require.Equal(t, "other", FailureOther.String())
+	require.Equal(t, "no_hw_support", FailureNoHWSupport.String())
+	require.Equal(t, "tx_timeout", FailureTXTimestampTimeout.String())
+	require.Equal(t, "driver_bug", FailureDriverBug.String())
+}
@@ -0,0 +1,106 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"fmt"
+
+	"github.com/facebook/time/hostendian"
+	"github.com/jsimonetti/rtnetlink"
+	"golang.org/x/sys/unix"
+)
+
+// maxLowerDevDepth limits how many virtual interfaces can be stacked on top of the physical one, like vlan on bond
+const maxLowerDevDepth = 8
+
+// PhysicalInterface returns the interface which actually timestamps packets sent over iface:
+// vlan, macvlan and ipvlan are followed down to their lower device, and active-backup bond to its active slave.
+// Physical interfaces are returned as is
+func PhysicalInterface(iface string) (string, error) {
+	conn, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return "", fmt.Errorf("can't establish netlink connection: %w", err)
+	}
+	defer conn.Close()
+	links, err := conn.Link.List()
+	if err != nil {
+		return "", fmt.Errorf("listing links: %w", err)
+	}
+	return lowerDevice(links, iface)
+}
+
+// lowerDevice walks down the chain of virtual interfaces starting at iface
+func lowerDevice(links []rtnetlink.LinkMessage, iface string) (string, error) {
+	byIndex := make(map[uint32]*rtnetlink.LinkMessage, len(links))
+	var link *rtnetlink.LinkMessage
+	for i := range links {
+		l := &links[i]
+		byIndex[l.Index] = l
+		if l.Attributes != nil && l.Attributes.Name == iface {
+			link = l
+		}
+	}
+	if link == nil {
+		return "", fmt.Errorf("no such interface %q", iface)
+	}
+	for depth := 0; depth < maxLowerDevDepth; depth++ {
+		info := link.Attributes.Info
+		if info == nil {
+			return link.Attributes.Name, nil
+		}
+		var lower uint32
+		switch info.Kind {
+		case "vlan", "macvlan", "macvtap", "ipvlan":
+			// IFLA_LINK, which rtnetlink calls Type
+			lower = link.Attributes.Type
+		case "bond":
+			lower = bondActiveSlave(info.Data)
+			if lower == 0 {
+				return "", fmt.Errorf("bond %q has no active slave", link.Attributes.Name)
+			}
+		default:
+			return link.Attributes.Name, nil
+		}
+		next, found := byIndex[lower]
+		if !found || next.Attributes == nil {
+			return "", fmt.Errorf("lower device %d of %s %q not found", lower, info.Kind, link.Attributes.Name)
+		}
+		link = next
+	}
+	return "", fmt.Errorf("more than %d virtual interfaces stacked on top of each other at %q", maxLowerDevDepth, iface)
+}
+
+// bondActiveSlave returns index of active slave from IFLA_INFO_DATA of a bond, 0 if there is none
+func bondActiveSlave(data []byte) uint32 {
+	// netlink attributes are length, type and value in host byte order, aligned to 4 bytes
+	for len(data) >= unix.SizeofRtAttr {
+		l := int(hostendian.Order.Uint16(data))
+		t := hostendian.Order.Uint16(data[2:])
+		if l < unix.SizeofRtAttr || l > len(data) {
+			return 0
+		}
+		if t == unix.IFLA_BOND_ACTIVE_SLAVE && l >= unix.SizeofRtAttr+4 {
+			return hostendian.Order.Uint32(data[unix.SizeofRtAttr:])
+		}
+		l = (l + unix.RTA_ALIGNTO - 1) &^ (unix.RTA_ALIGNTO - 1)
+		if l > len(data) {
+			return 0
+		}
+		data = data[l:]
+	}
+	return 0
+}
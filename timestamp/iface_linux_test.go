@@ -0,0 +1,102 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"testing"
+
+	"github.com/facebook/time/hostendian"
+	"github.com/jsimonetti/rtnetlink"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// rtattr builds netlink attribute with uint32 value
+func rtattr(t uint16, v uint32) []byte {
+	b := make([]byte, unix.SizeofRtAttr+4)
+	hostendian.Order.PutUint16(b, uint16(len(b)))
+	hostendian.Order.PutUint16(b[2:], t)
+	hostendian.Order.PutUint32(b[4:], v)
+	return b
+}
+
+func testLinks() []rtnetlink.LinkMessage {
+	bondData := append(rtattr(unix.IFLA_BOND_MODE, 1), rtattr(unix.IFLA_BOND_ACTIVE_SLAVE, 3)...)
+	return []rtnetlink.LinkMessage{
+		{Index: 1, Attributes: &rtnetlink.LinkAttributes{Name: "lo"}},
+		{Index: 2, Attributes: &rtnetlink.LinkAttributes{Name: "eth0"}},
+		{Index: 3, Attributes: &rtnetlink.LinkAttributes{Name: "eth1"}},
+		{Index: 4, Attributes: &rtnetlink.LinkAttributes{Name: "bond0", Info: &rtnetlink.LinkInfo{Kind: "bond", Data: bondData}}},
+		{Index: 5, Attributes: &rtnetlink.LinkAttributes{Name: "bond0.100", Type: 4, Info: &rtnetlink.LinkInfo{Kind: "vlan"}}},
+		{Index: 6, Attributes: &rtnetlink.LinkAttributes{Name: "mv0", Type: 2, Info: &rtnetlink.LinkInfo{Kind: "macvlan"}}},
+		{Index: 7, Attributes: &rtnetlink.LinkAttributes{Name: "bond1", Info: &rtnetlink.LinkInfo{Kind: "bond", Data: rtattr(unix.IFLA_BOND_MODE, 0)}}},
+		{Index: 8, Attributes: &rtnetlink.LinkAttributes{Name: "vlan.broken", Type: 42, Info: &rtnetlink.LinkInfo{Kind: "vlan"}}},
+		{Index: 9, Attributes: &rtnetlink.LinkAttributes{Name: "veth0", Info: &rtnetlink.LinkInfo{Kind: "veth"}}},
+	}
+}
+
+func TestLowerDevice(t *testing.T) {
+	links := testLinks()
+	for iface, want := range map[string]string{
+		"eth0":      "eth0",
+		"bond0":     "eth1",
+		"bond0.100": "eth1",
+		"mv0":       "eth0",
+		"veth0":     "veth0",
+	} {
+		got, err := lowerDevice(links, iface)
+		require.NoError(t, err, iface)
+		require.Equal(t, want, got, iface)
+	}
+
+	_, err := lowerDevice(links, "bond1")
+	require.EqualError(t, err, `bond "bond1" has no active slave`)
+	_, err = lowerDevice(links, "vlan.broken")
+	require.EqualError(t, err, `lower device 42 of vlan "vlan.broken" not found`)
+	_, err = lowerDevice(links, "eth42")
+	require.EqualError(t, err, `no such interface "eth42"`)
+}
+
+func TestLowerDeviceLoop(t *testing.T) {
+	links := []rtnetlink.LinkMessage{
+		{Index: 1, Attributes: &rtnetlink.LinkAttributes{Name: "a", Type: 2, Info: &rtnetlink.LinkInfo{Kind: "vlan"}}},
+		{Index: 2, Attributes: &rtnetlink.LinkAttributes{Name: "b", Type: 1, Info: &rtnetlink.LinkInfo{Kind: "vlan"}}},
+	}
+	_, err := lowerDevice(links, "a")
+	require.Error(t, err)
+}
+
+func TestBondActiveSlave(t *testing.T) {
+	require.Equal(t, uint32(0), bondActiveSlave(nil))
+	require.Equal(t, uint32(3), bondActiveSlave(rtattr(unix.IFLA_BOND_ACTIVE_SLAVE, 3)))
+	// attribute of 5 bytes is padded to 8
+	odd := []byte{5, 0, unix.IFLA_BOND_MODE, 0, 1, 0, 0, 0}
+	if hostendian.IsBigEndian {
+		odd = []byte{0, 5, 0, unix.IFLA_BOND_MODE, 1, 0, 0, 0}
+	}
+	require.Equal(t, uint32(7), bondActiveSlave(append(odd, rtattr(unix.IFLA_BOND_ACTIVE_SLAVE, 7)...)))
+	// truncated
+	require.Equal(t, uint32(0), bondActiveSlave(rtattr(unix.IFLA_BOND_ACTIVE_SLAVE, 7)[:6]))
+}
+
+func TestPhysicalInterfaceLoopback(t *testing.T) {
+	got, err := PhysicalInterface("lo")
+	if err != nil {
+		t.Skipf("netlink is not available: %v", err)
+	}
+	require.Equal(t, "lo", got)
+}
@@ -30,12 +30,24 @@ import (
 const (
 	// HWTSTAMP_TX_ON int 1
 	hwtstampTXON int32 = 0x00000001
+	// HWTSTAMP_TX_ONESTEP_SYNC int 2
+	hwtstampTXOneStepSync int32 = 0x00000002
+	// HWTSTAMP_TX_ONESTEP_P2P int 3
+	hwtstampTXOneStepP2P int32 = 0x00000003
 	// HWTSTAMP_FILTER_ALL int 1
 	hwtstampFilterAll int32 = 0x00000001
 	// HWTSTAMP_FILTER_PTP_V2_EVENT int 12
 	hwtstampFilterPTPv2Event int32 = 0x0000000c
 )
 
+// TX types NIC supports, as bits of tx_types reported by ETHTOOL_GET_TS_INFO
+const (
+	// TXTypeOneStepSync is set if NIC can insert TX timestamps into Sync
+	TXTypeOneStepSync uint32 = 1 << hwtstampTXOneStepSync
+	// TXTypeOneStepP2P is set if NIC can insert TX timestamps into Sync and Pdelay_Resp
+	TXTypeOneStepP2P uint32 = 1 << hwtstampTXOneStepP2P
+)
+
 const (
 	// ControlSizeBytes is a socket control message containing TX/RX timestamp
 	// If the read fails we may endup with multiple timestamps in the buffer
@@ -136,3 +148,8 @@ func SockaddrToIP(sa unix.Sockaddr) net.IP {
 	}
 	return nil
 }
+
+// Htons converts uint16 from host to network byte order, as packet sockets want protocol numbers
+func Htons(i uint16) uint16 {
+	return (i<<8)&0xff00 | i>>8
+}
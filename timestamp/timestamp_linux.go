@@ -68,7 +68,7 @@ func scmDataToTime(data []byte) (ts time.Time, err error) {
 			return ts, err
 		}
 		if ts.UnixNano() == 0 {
-			return ts, fmt.Errorf("got zero timestamp")
+			return ts, &Error{Kind: ErrDriverBug, Hint: hintDriverBug, Err: fmt.Errorf("got zero timestamp")}
 		}
 	}
 
@@ -84,7 +84,7 @@ func byteToTime(data []byte) (time.Time, error) {
 	return time.Unix(sec, nsec), nil
 }
 
-func ioctlTimestamp(fd int, ifname string, filter int32) error {
+func ioctlTimestamp(fd int, ifname string, txType, filter int32) error {
 	// empty config, will be populated after we call SIOCGHWTSTAMP
 	hw := &hwtstampConfig{
 		flags:    0,
@@ -95,22 +95,40 @@ func ioctlTimestamp(fd int, ifname string, filter int32) error {
 	i := &ifreq{data: uintptr(unsafe.Pointer(hw))}
 	copy(i.name[:unix.IFNAMSIZ-1], ifname)
 	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCGHWTSTAMP, uintptr(unsafe.Pointer(i))); errno != 0 {
-		return fmt.Errorf("failed to run ioctl SIOCGHWTSTAMP to see what is enabled: %s (%w)", unix.ErrnoName(errno), errno)
+		return hwtstampError(fd, ifname, fmt.Errorf("failed to run ioctl SIOCGHWTSTAMP to see what is enabled: %s (%w)", unix.ErrnoName(errno), errno))
 	}
 
 	// now check if it matches what we want
-	if hw.txType == hwtstampTXON && hw.rxFilter == filter {
+	if hw.txType == txType && hw.rxFilter == filter {
 		return nil
 	}
 	// set to desired values
-	hw.txType = hwtstampTXON
+	hw.txType = txType
 	hw.rxFilter = filter
 	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCSHWTSTAMP, uintptr(unsafe.Pointer(i))); errno != 0 {
-		return fmt.Errorf("failed to run ioctl SIOCSHWTSTAMP to set timestamps enabled: %s (%w)", unix.ErrnoName(errno), errno)
+		return hwtstampError(fd, ifname, fmt.Errorf("failed to run ioctl SIOCSHWTSTAMP to set timestamps enabled: %s (%w)", unix.ErrnoName(errno), errno))
 	}
 	return nil
 }
 
+// hwtstampError classifies failed SIOCGHWTSTAMP/SIOCSHWTSTAMP ioctl.
+// Driver reports EOPNOTSUPP if it can't timestamp at all, and ERANGE or EINVAL if it can't do requested timestamping
+func hwtstampError(fd int, ifname string, err error) error {
+	if !errors.Is(err, unix.EOPNOTSUPP) && !errors.Is(err, unix.ERANGE) && !errors.Is(err, unix.EINVAL) {
+		return err
+	}
+	return newDriverError(ErrNoHWSupport, NICDriver(fd, ifname), fmt.Sprintf(hintNoHWSupport, ifname), err)
+}
+
+// NICDriver returns name of the interface driver as reported by ethtool, empty if it's unknown. fd can be any socket
+func NICDriver(fd int, ifname string) string {
+	info, err := unix.IoctlGetEthtoolDrvinfo(fd, ifname)
+	if err != nil {
+		return ""
+	}
+	return unix.ByteSliceToString(info.Driver[:])
+}
+
 // EnableSWTimestampsRx enables SW RX timestamps on the socket
 func EnableSWTimestampsRx(connFd int) error {
 	flags := unix.SOF_TIMESTAMPING_RX_SOFTWARE |
@@ -135,15 +153,35 @@ func EnableSWTimestamps(connFd int) error {
 
 // EnableHWTimestamps enables HW timestamps (TX and RX) on the socket
 func EnableHWTimestamps(connFd int, iface string) error {
-	if err := ioctlTimestamp(connFd, iface, hwtstampFilterAll); err != nil {
-		// no permissions - we are done here
+	return enableHWTimestamps(connFd, iface, hwtstampTXON)
+}
+
+// EnableHWTimestampsOneStep enables HW timestamps (TX and RX) on the socket,
+// and makes NIC insert TX timestamp into Sync packets which don't have two-step flag set.
+// Two-step Sync packets still get TX timestamps reported back, given the NIC driver honours the flag
+func EnableHWTimestampsOneStep(connFd int, iface string) error {
+	return enableHWTimestamps(connFd, iface, hwtstampTXOneStepSync)
+}
+
+// EnableHWTimestampsOneStepP2P enables HW timestamps (TX and RX) on the socket,
+// and makes NIC insert TX timestamp into Sync and Pdelay_Resp packets, just like EnableHWTimestampsOneStep does for Sync
+func EnableHWTimestampsOneStepP2P(connFd int, iface string) error {
+	return enableHWTimestamps(connFd, iface, hwtstampTXOneStepP2P)
+}
+
+func enableHWTimestamps(connFd int, iface string, txType int32) error {
+	if err := ioctlHWTimestamps(connFd, iface, txType); err != nil {
 		if errors.Is(err, syscall.EPERM) {
 			return err
 		}
-		// try again with more narrow filter
-		if err := ioctlTimestamp(connFd, iface, hwtstampFilterPTPv2Event); err != nil {
+		// older kernels don't pass the request from vlan, macvlan or bond down to the NIC, so try it ourselves
+		phys, perr := PhysicalInterface(iface)
+		if perr != nil || phys == iface {
 			return err
 		}
+		if err := ioctlHWTimestamps(connFd, phys, txType); err != nil {
+			return fmt.Errorf("enabling timestamps on %s under %s: %w", phys, iface, err)
+		}
 	}
 
 	// Enable hardware timestamp capabilities on socket
@@ -159,6 +197,19 @@ func EnableHWTimestamps(connFd int, iface string) error {
 	return unix.SetsockoptInt(connFd, unix.SOL_SOCKET, unix.SO_SELECT_ERR_QUEUE, 1)
 }
 
+// ioctlHWTimestamps enables HW timestamps on the interface, falling back to timestamping PTP event packets only
+func ioctlHWTimestamps(connFd int, iface string, txType int32) error {
+	if err := ioctlTimestamp(connFd, iface, txType, hwtstampFilterAll); err != nil {
+		// no permissions - we are done here
+		if errors.Is(err, syscall.EPERM) {
+			return err
+		}
+		// try again with more narrow filter
+		return ioctlTimestamp(connFd, iface, txType, hwtstampFilterPTPv2Event)
+	}
+	return nil
+}
+
 func waitForHWTS(connFd int) error {
 	// Wait until TX timestamp is ready
 	fds := []unix.PollFd{{Fd: int32(connFd), Events: unix.POLLERR, Revents: 0}}
@@ -220,7 +271,11 @@ func ReadTXtimestampBuf(connFd int, oob, toob []byte) (time.Time, int, error) {
 	}
 
 	if !txfound {
-		return time.Time{}, attempts, fmt.Errorf("no TX timestamp found after %d tries", AttemptsTXTS)
+		return time.Time{}, attempts, &Error{
+			Kind: ErrTXTimestampTimeout,
+			Hint: hintTXTimestampTimeout,
+			Err:  fmt.Errorf("no TX timestamp found after %d tries", AttemptsTXTS),
+		}
 	}
 	timestamp, err := socketControlMessageTimestamp(oob[:boob])
 	return timestamp, attempts, err
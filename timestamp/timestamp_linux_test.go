@@ -17,6 +17,7 @@ limitations under the License.
 package timestamp
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"runtime"
@@ -64,7 +65,8 @@ func Test_ReadTXtimestamp(t *testing.T) {
 	duration := time.Since(start)
 	require.Equal(t, time.Time{}, txts)
 	require.Equal(t, defaultTXTS, attempts)
-	require.Equal(t, fmt.Errorf("no TX timestamp found after %d tries", defaultTXTS), err)
+	require.ErrorIs(t, err, ErrTXTimestampTimeout)
+	require.EqualError(t, err, fmt.Sprintf("no TX timestamp found after %d tries; hint: %s", defaultTXTS, hintTXTimestampTimeout))
 	require.GreaterOrEqual(t, duration, time.Duration(AttemptsTXTS)*TimeoutTXTS)
 
 	AttemptsTXTS = 10
@@ -75,7 +77,8 @@ func Test_ReadTXtimestamp(t *testing.T) {
 	duration = time.Since(start)
 	require.Equal(t, time.Time{}, txts)
 	require.Equal(t, 10, attempts)
-	require.Equal(t, fmt.Errorf("no TX timestamp found after %d tries", 10), err)
+	require.ErrorIs(t, err, ErrTXTimestampTimeout)
+	require.EqualError(t, err, fmt.Sprintf("no TX timestamp found after %d tries; hint: %s", 10, hintTXTimestampTimeout))
 	require.GreaterOrEqual(t, duration, time.Duration(AttemptsTXTS)*TimeoutTXTS)
 
 	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345}
@@ -143,7 +146,7 @@ func Test_scmDataToTime(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			res, err := scmDataToTime(tt.data)
 			if tt.wantErr {
-				require.Error(t, err)
+				require.ErrorIs(t, err, ErrDriverBug)
 			} else {
 				require.Nil(t, err)
 				require.Equal(t, tt.want, res.UnixNano())
@@ -300,3 +303,22 @@ func TestReadPacketWithRXTXTimestamp(t *testing.T) {
 	require.Equal(t, 1, attempts)
 	require.Nil(t, err)
 }
+
+func TestEnableHWTimestampsNoHWSupport(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	connFd, err := ConnFd(conn)
+	require.NoError(t, err)
+
+	// loopback can't timestamp in hardware
+	err = EnableHWTimestamps(connFd, "lo")
+	if errors.Is(err, unix.EPERM) {
+		t.Skip("no permissions to run SIOCSHWTSTAMP")
+	}
+	require.ErrorIs(t, err, ErrNoHWSupport)
+	require.ErrorIs(t, err, unix.EOPNOTSUPP)
+	require.Equal(t, FailureNoHWSupport, Classify(err))
+	require.Contains(t, err.Error(), "hint: check `ethtool -T lo`")
+}
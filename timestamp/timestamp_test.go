@@ -76,3 +76,7 @@ func TestSockaddrToIP(t *testing.T) {
 	require.Equal(t, ip4.String(), SockaddrToIP(sa4).String())
 	require.Equal(t, ip6.String(), SockaddrToIP(sa6).String())
 }
+
+func TestHtons(t *testing.T) {
+	require.Equal(t, uint16(0xf788), Htons(unix.ETH_P_1588))
+}
@@ -0,0 +1,122 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"errors"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// txBatchPacketSize fits looped back PTP packet together with link layer, IPv6 and UDP headers
+const txBatchPacketSize = 256
+
+// mmsghdr is struct mmsghdr of recvmmsg(2)
+type mmsghdr struct {
+	Hdr unix.Msghdr
+	Len uint32
+}
+
+// TXTimestampBatch reads TX timestamps of many sent packets from MSG_ERRQUEUE with a single recvmmsg call.
+// Kernel loops every sent packet back together with its TX timestamp, so packets can be matched by their contents.
+// Buffers are reused between reads
+type TXTimestampBatch struct {
+	hdrs []mmsghdr
+	iovs []unix.Iovec
+	bufs [][]byte
+	oobs [][]byte
+}
+
+// NewTXTimestampBatch allocates a batch reading up to size TX timestamps at once
+func NewTXTimestampBatch(size int) *TXTimestampBatch {
+	b := &TXTimestampBatch{
+		hdrs: make([]mmsghdr, size),
+		iovs: make([]unix.Iovec, size),
+		bufs: make([][]byte, size),
+		oobs: make([][]byte, size),
+	}
+	for i := 0; i < size; i++ {
+		b.bufs[i] = make([]byte, txBatchPacketSize)
+		b.oobs[i] = make([]byte, ControlSizeBytes)
+		b.iovs[i].Base = &b.bufs[i][0]
+		b.hdrs[i].Hdr.Iov = &b.iovs[i]
+		b.hdrs[i].Hdr.SetIovlen(1)
+		b.hdrs[i].Hdr.Control = &b.oobs[i][0]
+	}
+	return b
+}
+
+// Read reads TX timestamps available on the socket without blocking and returns how many were read
+func (b *TXTimestampBatch) Read(connFd int) (int, error) {
+	for i := range b.hdrs {
+		b.iovs[i].SetLen(txBatchPacketSize)
+		b.hdrs[i].Hdr.SetControllen(ControlSizeBytes)
+		b.hdrs[i].Hdr.Flags = 0
+		b.hdrs[i].Len = 0
+	}
+	n, _, e1 := unix.Syscall6(unix.SYS_RECVMMSG, uintptr(connFd), uintptr(unsafe.Pointer(&b.hdrs[0])), uintptr(len(b.hdrs)), uintptr(unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT), 0, 0)
+	if e1 != 0 {
+		if errors.Is(e1, syscall.EAGAIN) {
+			return 0, nil
+		}
+		return 0, e1
+	}
+	return int(n), nil
+}
+
+// Packet returns i-th packet looped back by kernel, headers included. PTP message is at the end of it
+func (b *TXTimestampBatch) Packet(i int) []byte {
+	return b.bufs[i][:b.hdrs[i].Len]
+}
+
+// Truncated returns true if i-th packet didn't fit into the buffer, so its end is missing
+func (b *TXTimestampBatch) Truncated(i int) bool {
+	return b.hdrs[i].Hdr.Flags&unix.MSG_TRUNC != 0
+}
+
+// Timestamp returns TX timestamp of the i-th packet
+func (b *TXTimestampBatch) Timestamp(i int) (time.Time, error) {
+	return socketControlMessageTimestamp(b.oobs[i][:b.hdrs[i].Hdr.Controllen])
+}
+
+// LoopTXPackets makes kernel return sent packets together with their TX timestamps,
+// so timestamps read in batches can be matched to packets by contents. Timestamps have to be enabled already
+func LoopTXPackets(connFd int) error {
+	flags, err := unix.GetsockoptInt(connFd, unix.SOL_SOCKET, timestamping)
+	if err != nil {
+		return err
+	}
+	return unix.SetsockoptInt(connFd, unix.SOL_SOCKET, timestamping, flags&^unix.SOF_TIMESTAMPING_OPT_TSONLY)
+}
+
+// WaitTXtimestamps waits up to timeout for TX timestamps to appear on the socket, returns true if there are any
+func WaitTXtimestamps(connFd int, timeout time.Duration) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(connFd), Events: unix.POLLERR}}
+	for {
+		n, err := unix.Poll(fds, int(timeout.Milliseconds()))
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return n > 0 && fds[0].Revents&unix.POLLERR != 0, nil
+	}
+}
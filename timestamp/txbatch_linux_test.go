@@ -0,0 +1,74 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTXTimestampBatch(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	connFd, err := ConnFd(conn)
+	require.NoError(t, err)
+	require.NoError(t, EnableSWTimestamps(connFd))
+	require.NoError(t, LoopTXPackets(connFd))
+
+	b := NewTXTimestampBatch(4)
+	// nothing sent yet
+	ready, err := WaitTXtimestamps(connFd, time.Millisecond)
+	require.NoError(t, err)
+	require.False(t, ready)
+	n, err := b.Read(connFd)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345}
+	payloads := [][]byte{[]byte("first"), []byte("second"), []byte("third")}
+	start := time.Now()
+	for _, p := range payloads {
+		_, err = conn.WriteTo(p, addr)
+		require.NoError(t, err)
+	}
+
+	ready, err = WaitTXtimestamps(connFd, time.Second)
+	require.NoError(t, err)
+	require.True(t, ready)
+	// timestamps may trickle in
+	read := 0
+	for i := 0; i < 10 && read < len(payloads); i++ {
+		n, err = b.Read(connFd)
+		require.NoError(t, err)
+		for j := 0; j < n; j++ {
+			require.False(t, b.Truncated(j))
+			require.True(t, bytes.HasSuffix(b.Packet(j), payloads[read]))
+			ts, err := b.Timestamp(j)
+			require.NoError(t, err)
+			require.WithinDuration(t, start, ts, time.Second)
+			read++
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.Equal(t, len(payloads), read)
+}